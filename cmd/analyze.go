@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// runAnalyze prints a table of a data file's usage by key prefix, largest first, and returns the process exit code.
+//
+//	analyze [-key KEY] [-keep-versions N] [-max-age DURATION] <data-file>
+func runAnalyze(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	fs.SetOutput(out)
+	key := fs.String("key", os.Getenv("MKV_ENCRYPTION_KEY"), "encryption key of the data file (defaults to $MKV_ENCRYPTION_KEY)")
+	keepVersions := fs.Int("keep-versions", 0, "versions a retention policy would keep per key; 0 keeps all")
+	maxAge := fs.Duration("max-age", 0, "age after which a retention policy would drop a key; 0 keeps all")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	if fs.NArg() != 1 {
+		return fail(out, errs.Errorf(errs.InvalidArgument, "usage: analyze [-key KEY] [-keep-versions N] [-max-age DURATION] <data-file>"))
+	}
+	dataFile := fs.Arg(0)
+
+	quietStoreLogs()
+
+	// Load into memory so that analyzing never rewrites the data file.
+	data, err := os.Open(dataFile)
+	if err != nil {
+		return fail(out, fmt.Errorf("error opening data file: %w", err))
+	}
+	defer data.Close()
+	kv, err := store.NewKeyValueStoreFromReader(data, []byte(*key))
+	if err != nil {
+		return fail(out, fmt.Errorf("error loading data file: %w", err))
+	}
+	defer kv.Stop()
+
+	report, err := kv.Analyze(store.AnalyzeRetention(store.RetentionPolicy{KeepVersions: *keepVersions, MaxAge: *maxAge}))
+	if err != nil {
+		return fail(out, fmt.Errorf("error analyzing: %w", err))
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PREFIX\tKEYS\tBYTES\tHISTORY\tTTL\tNO TTL\tOLDEST\tNEWEST\tRECLAIMABLE")
+	row := func(prefix string, u store.PrefixUsage) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t%s\t%d\n", prefix, u.Keys, u.Bytes, u.HistoryBytes,
+			u.WithTTL, u.WithoutTTL, formatWrite(u.OldestWrite), formatWrite(u.NewestWrite), u.Reclaimable)
+	}
+	for _, u := range report.Prefixes {
+		if u.Prefix == "" {
+			row("-", u)
+			continue
+		}
+		row(u.Prefix, u)
+	}
+	row("total", report.Total)
+	tw.Flush()
+	return 0
+}
+
+// formatWrite formats a write time for the analysis table.
+func formatWrite(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// runBackup adds a full or differential backup of a data file to a backup directory and returns the
+// process exit code.
+//
+//	backup [-key KEY] [-mode full|diff] <data-file> <backup-dir>
+func runBackup(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.SetOutput(out)
+	key := fs.String("key", os.Getenv("MKV_ENCRYPTION_KEY"), "encryption key of the data file and backups (defaults to $MKV_ENCRYPTION_KEY)")
+	mode := fs.String("mode", string(store.BackupFull), "full to start a new chain, diff to capture the changes since the latest backup")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	if fs.NArg() != 2 || (*mode != string(store.BackupFull) && *mode != string(store.BackupDiff)) {
+		return fail(out, errs.Errorf(errs.InvalidArgument, "usage: backup [-key KEY] [-mode full|diff] <data-file> <backup-dir>"))
+	}
+	dataFile, backupDir := fs.Arg(0), fs.Arg(1)
+
+	quietStoreLogs()
+
+	// Load into memory so that backing up never rewrites the data file.
+	data, err := os.Open(dataFile)
+	if err != nil {
+		return fail(out, fmt.Errorf("error opening data file: %w", err))
+	}
+	defer data.Close()
+	kv, err := store.NewKeyValueStoreFromReader(data, []byte(*key))
+	if err != nil {
+		return fail(out, fmt.Errorf("error loading data file: %w", err))
+	}
+	defer kv.Stop()
+
+	entry, err := kv.Backup(backupDir, store.BackupMode(*mode))
+	if err != nil {
+		return fail(out, fmt.Errorf("error backing up: %w", err))
+	}
+	fmt.Fprintf(out, "wrote %s backup %s of %d keys\n", entry.Mode, entry.Name, entry.Keys)
+	return 0
+}
+
+// runRestore restores the backup chain in a backup directory into a data file, replacing it unless a merging
+// strategy is given, and returns the process exit code.
+//
+//	restore [-key KEY] [-strategy overwrite|last-write-wins|first-write-wins|report-only] <backup-dir> <data-file>
+func runRestore(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.SetOutput(out)
+	key := fs.String("key", os.Getenv("MKV_ENCRYPTION_KEY"), "encryption key of the backups and data file (defaults to $MKV_ENCRYPTION_KEY)")
+	strategy := fs.String("strategy", string(store.RestoreOverwrite), "overwrite, last-write-wins, first-write-wins or report-only")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	switch store.RestoreStrategy(*strategy) {
+	case store.RestoreOverwrite, store.RestoreLastWriteWins, store.RestoreFirstWriteWins, store.RestoreReportOnly:
+	default:
+		return fail(out, errs.Errorf(errs.InvalidArgument, "unknown strategy %q", *strategy))
+	}
+	if fs.NArg() != 2 {
+		return fail(out, errs.Errorf(errs.InvalidArgument, "usage: restore [-key KEY] [-strategy STRATEGY] <backup-dir> <data-file>"))
+	}
+	backupDir, dataFile := fs.Arg(0), fs.Arg(1)
+
+	quietStoreLogs()
+
+	kv, err := store.OpenKeyValueStore(dataFile, []byte(*key), 0, time.Minute, store.WithOwnerFile())
+	if err != nil {
+		return fail(out, err)
+	}
+	defer kv.Stop()
+	report, err := kv.RestoreBackupWith(backupDir, store.RestoreStrategy(*strategy))
+	if err != nil {
+		return fail(out, fmt.Errorf("error restoring: %w", err))
+	}
+	verb := "restored"
+	if report.Strategy == store.RestoreReportOnly {
+		verb = "would restore"
+	}
+	fmt.Fprintf(out, "%s backup %s (%s): %d added, %d overwritten, %d skipped, %d removed, %d unchanged\n", verb,
+		report.Backup.Name, report.Strategy, len(report.Added), len(report.Overwritten), len(report.Skipped), len(report.Removed), report.Unchanged)
+	return 0
+}
@@ -2,20 +2,55 @@ package main
 
 import (
 	"log"
+	"os"
 	"time"
 
 	"github.com/Chahine-tech/minikeyvalue/internal/store"
 )
 
-// Example demonstrates how to use the KeyValueStore.
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			os.Exit(runVerify(os.Args[2:], os.Stdout))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:], os.Stdout))
+		case "encrypt":
+			os.Exit(runEncrypt(os.Args[2:], os.Stdout))
+		case "redis":
+			os.Exit(runRedis(os.Args[2:], os.Stdout))
+		case "backup":
+			os.Exit(runBackup(os.Args[2:], os.Stdout))
+		case "restore":
+			os.Exit(runRestore(os.Args[2:], os.Stdout))
+		case "analyze":
+			os.Exit(runAnalyze(os.Args[2:], os.Stdout))
+		case "upgrade":
+			os.Exit(runUpgrade(os.Args[2:], os.Stdout))
+		case "rollback":
+			os.Exit(runRollback(os.Args[2:], os.Stdout))
+		case "shell":
+			os.Exit(runShell(os.Args[2:], os.Stdin, os.Stdout))
+		case "resp":
+			os.Exit(runRESP(os.Args[2:], os.Stdout))
+		}
+	}
+	example()
+}
+
+// example demonstrates how to use the KeyValueStore.
+func example() {
 	filePath := "data.json"
 	encryptionKey := []byte("encryptionKey")
 
 	// Set a global TTL of 10 seconds.
 	globalTTL := 10 * time.Second
 
-	kv := store.NewKeyValueStore(filePath, encryptionKey, 5*time.Second, globalTTL)
+	kv := store.New(filePath,
+		store.WithEncryptionKey(encryptionKey),
+		store.WithGlobalTTL(globalTTL),
+		store.WithCleanupInterval(5*time.Second),
+	)
 	defer kv.Stop()
 
 	err := kv.Set("key1", "value1", 0)
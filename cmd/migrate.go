@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/sqlitestore"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+const migrateUsage = "usage: migrate [-key KEY] [-key-secret SECRET [-reveal-keys]] [-require-encryption] to-sqlite <data-file> <db-file> | to-file <db-file> <data-file>"
+
+// runMigrate converts a data file into a SQLite database or back and returns the process exit code.
+// With a key secret, the source has hashed keys and so does the destination unless -reveal-keys is given.
+//
+//	migrate [-key KEY] [-key-secret SECRET [-reveal-keys]] [-require-encryption] to-sqlite <data-file> <db-file>
+//	migrate [-key KEY] [-key-secret SECRET [-reveal-keys]] [-require-encryption] to-file <db-file> <data-file>
+func runMigrate(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(out)
+	key := fs.String("key", os.Getenv("MKV_ENCRYPTION_KEY"), "encryption key of the source and destination (defaults to $MKV_ENCRYPTION_KEY)")
+	keySecret := fs.String("key-secret", os.Getenv("MKV_KEY_SECRET"), "key hashing secret of the source (defaults to $MKV_KEY_SECRET)")
+	revealKeys := fs.Bool("reveal-keys", false, "write plaintext keys to the destination instead of hashing them")
+	required := fs.Bool("require-encryption", requireEncryptionDefault(), "refuse to run without a valid key (defaults to $MKV_REQUIRE_ENCRYPTION)")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	if fs.NArg() != 3 {
+		return fail(out, errs.Errorf(errs.InvalidArgument, migrateUsage))
+	}
+	direction, source, destination := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+
+	quietStoreLogs()
+
+	if *required {
+		// Source and destination share the key, so a valid key keeps both encrypted.
+		if err := requireKey([]byte(*key)); err != nil {
+			return fail(out, err)
+		}
+	}
+
+	var hashing keyHashing
+	if *keySecret != "" {
+		hashing = keyHashing{secret: []byte(*keySecret), reveal: *revealKeys}
+	}
+
+	var keys int
+	var err error
+	switch direction {
+	case "to-sqlite":
+		keys, err = fileToSQLite(source, destination, []byte(*key), hashing)
+	case "to-file":
+		keys, err = sqliteToFile(source, destination, []byte(*key), hashing)
+	default:
+		return fail(out, errs.Errorf(errs.InvalidArgument, migrateUsage))
+	}
+	if err != nil {
+		return fail(out, err)
+	}
+	fmt.Fprintf(out, "migrated %d keys to %s\n", keys, destination)
+	return 0
+}
+
+// keyHashing describes whether the source has hashed keys and whether the destination should reveal them.
+type keyHashing struct {
+	secret []byte
+	reveal bool
+}
+
+// source returns the options for reading the source.
+func (h keyHashing) source() []store.Option {
+	if h.secret == nil {
+		return nil
+	}
+	return []store.Option{store.WithKeyHashing(h.secret)}
+}
+
+// destination returns the options for writing the destination.
+func (h keyHashing) destination() []store.Option {
+	if h.reveal {
+		return nil
+	}
+	return h.source()
+}
+
+// fileToSQLite copies the data file at source into the SQLite database at destination.
+func fileToSQLite(source, destination string, key []byte, hashing keyHashing) (int, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return 0, fmt.Errorf("error opening data file: %w", err)
+	}
+	defer file.Close()
+
+	var data io.Reader = file
+	if hashing.reveal {
+		// Load with the secret and hand the plaintext keys on to the destination.
+		src, err := store.NewKeyValueStoreFromReader(file, key, hashing.source()...)
+		if err != nil {
+			return 0, fmt.Errorf("error loading data file: %w", err)
+		}
+		var revealed bytes.Buffer
+		err = src.DumpTo(&revealed, true)
+		src.Stop()
+		if err != nil {
+			return 0, fmt.Errorf("error revealing keys: %w", err)
+		}
+		data = &revealed
+	}
+
+	db, err := sqlitestore.Open(destination)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	kv, err := store.NewKeyValueStoreFromReader(data, key, append(hashing.destination(), store.WithRecordPersister(db))...)
+	if err != nil {
+		return 0, fmt.Errorf("error loading data file: %w", err)
+	}
+	defer kv.Stop()
+	if err := kv.Save(); err != nil {
+		return 0, fmt.Errorf("error writing database: %w", err)
+	}
+	return kv.Size(), nil
+}
+
+// sqliteToFile writes the SQLite database at source to the data file at destination.
+func sqliteToFile(source, destination string, key []byte, hashing keyHashing) (int, error) {
+	if _, err := os.Stat(source); err != nil {
+		return 0, fmt.Errorf("error opening database: %w", err)
+	}
+	db, err := sqlitestore.Open(source)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	kv := store.NewKeyValueStore("", key, 0, time.Minute, append(hashing.source(), store.WithRecordPersister(db))...)
+	defer kv.Stop()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return 0, fmt.Errorf("error creating data file: %w", err)
+	}
+	defer out.Close()
+	if err := kv.DumpTo(out, hashing.reveal); err != nil {
+		return 0, fmt.Errorf("error writing data file: %w", err)
+	}
+	return kv.Size(), nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+const redisUsage = "usage: redis [-key KEY] import <commands-file> <data-file> | export <data-file> <commands-file>"
+
+// runRedis imports a file of Redis commands into a data file or exports a data file as Redis commands,
+// and returns the process exit code. A commands file of "-" means standard input or output.
+//
+//	redis [-key KEY] import <commands-file> <data-file>
+//	redis [-key KEY] export <data-file> <commands-file>
+func runRedis(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("redis", flag.ContinueOnError)
+	fs.SetOutput(out)
+	key := fs.String("key", os.Getenv("MKV_ENCRYPTION_KEY"), "encryption key of the data file (defaults to $MKV_ENCRYPTION_KEY)")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	if fs.NArg() != 3 {
+		return fail(out, errs.Errorf(errs.InvalidArgument, redisUsage))
+	}
+	direction, source, destination := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+
+	quietStoreLogs()
+
+	switch direction {
+	case "import":
+		return redisImport(source, destination, []byte(*key), out)
+	case "export":
+		return redisExport(source, destination, []byte(*key), out)
+	}
+	return fail(out, errs.Errorf(errs.InvalidArgument, redisUsage))
+}
+
+// redisImport sets the keys created by the Redis commands in source in the data file at destination.
+func redisImport(source, destination string, key []byte, out io.Writer) int {
+	in := os.Stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return fail(out, fmt.Errorf("error opening commands file: %w", err))
+		}
+		defer file.Close()
+		in = file
+	}
+
+	kv, err := store.OpenKeyValueStore(destination, key, 0, time.Minute, store.WithOwnerFile())
+	if err != nil {
+		return fail(out, err)
+	}
+	defer kv.Stop()
+	report, err := kv.ImportRedis(in)
+	if err != nil {
+		return fail(out, err)
+	}
+	if err := kv.Save(); err != nil {
+		return fail(out, fmt.Errorf("error writing data file: %w", err))
+	}
+
+	fmt.Fprintf(out, "imported %d keys (%d with TTL), %d already expired\n", report.Imported, report.WithTTL, report.Expired)
+	kinds := make([]string, 0, len(report.Unsupported))
+	for kind := range report.Unsupported {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(out, "skipped %d unsupported %s commands\n", report.Unsupported[kind], kind)
+	}
+	printKeys(out, "skipped", report.Skipped)
+	failed := make([]string, 0, len(report.Errors))
+	for key := range report.Errors {
+		failed = append(failed, key)
+	}
+	sort.Strings(failed)
+	for _, key := range failed {
+		fmt.Fprintf(out, "failed\t%s: %v\n", key, report.Errors[key])
+	}
+	if len(failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// redisExport writes the data file at source to destination as Redis commands.
+func redisExport(source, destination string, key []byte, out io.Writer) int {
+	// Load into memory so that exporting never rewrites the data file.
+	data, err := os.Open(source)
+	if err != nil {
+		return fail(out, fmt.Errorf("error opening data file: %w", err))
+	}
+	defer data.Close()
+	kv, err := store.NewKeyValueStoreFromReader(data, key)
+	if err != nil {
+		return fail(out, fmt.Errorf("error loading data file: %w", err))
+	}
+	defer kv.Stop()
+
+	w := os.Stdout
+	if destination != "-" {
+		file, err := os.Create(destination)
+		if err != nil {
+			return fail(out, fmt.Errorf("error creating commands file: %w", err))
+		}
+		defer file.Close()
+		w = file
+	}
+	n, err := kv.ExportRedis(w)
+	if err != nil {
+		return fail(out, err)
+	}
+	if destination != "-" {
+		fmt.Fprintf(out, "exported %d keys to %s\n", n, destination)
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/resp"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// runRESP serves a data file over the Redis protocol until interrupted, then saves it, and returns the
+// process exit code.
+//
+//	resp [-key KEY] [-addr ADDR] <data-file>
+func runRESP(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("resp", flag.ContinueOnError)
+	fs.SetOutput(out)
+	key := fs.String("key", os.Getenv("MKV_ENCRYPTION_KEY"), "encryption key of the data file (defaults to $MKV_ENCRYPTION_KEY)")
+	addr := fs.String("addr", "127.0.0.1:6379", "TCP address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	if fs.NArg() != 1 {
+		return fail(out, errs.Errorf(errs.InvalidArgument, "usage: resp [-key KEY] [-addr ADDR] <data-file>"))
+	}
+
+	kv, err := store.OpenKeyValueStore(fs.Arg(0), []byte(*key), 0, time.Minute, store.WithOwnerFile())
+	if err != nil {
+		return fail(out, err)
+	}
+	defer kv.Stop()
+
+	server := resp.NewServer(kv)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Println("runRESP: Shutting down")
+		server.Close()
+	}()
+	if err := server.ListenAndServe(*addr); err != nil {
+		return fail(out, err)
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/shell"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// runShell opens a data file in an interactive session reading commands from in, or from a script,
+// and returns the process exit code: 0 once the input ends, and the errs exit code of the first
+// failing command of a script.
+//
+//	shell [-key KEY] [-script FILE] [-yes] [-page N] <data-file>
+func runShell(args []string, in io.Reader, out io.Writer) int {
+	fs := flag.NewFlagSet("shell", flag.ContinueOnError)
+	fs.SetOutput(out)
+	key := fs.String("key", os.Getenv("MKV_ENCRYPTION_KEY"), "encryption key of the data file (defaults to $MKV_ENCRYPTION_KEY)")
+	script := fs.String("script", "", "run the commands in this file instead of reading them interactively")
+	yes := fs.Bool("yes", false, "run dangerous commands such as clear without asking for confirmation")
+	pageSize := fs.Int("page", 20, "lines shown before pausing for more; 0 disables paging")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	if fs.NArg() != 1 {
+		return fail(out, errs.Errorf(errs.InvalidArgument, "usage: shell [-key KEY] [-script FILE] [-yes] [-page N] <data-file>"))
+	}
+	dataFile := fs.Arg(0)
+
+	quietStoreLogs()
+
+	opts := shell.Options{Yes: *yes, PageSize: *pageSize}
+	if *script != "" {
+		f, err := os.Open(*script)
+		if err != nil {
+			return fail(out, fmt.Errorf("error opening script: %w", err))
+		}
+		defer f.Close()
+		in, opts.Script = f, true
+	}
+
+	kv, err := store.OpenKeyValueStore(dataFile, []byte(*key), 0, time.Minute, store.WithOwnerFile())
+	if err != nil {
+		return fail(out, err)
+	}
+	defer kv.Stop()
+	if err := shell.New(kv, in, out, opts).Run(); err != nil {
+		return fail(out, err)
+	}
+	return 0
+}
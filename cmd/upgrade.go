@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// runUpgrade converts a data file in a legacy format to the current one and returns the process exit code.
+// With -migrate-dry-run it reports the migrations that would run without writing anything.
+//
+//	upgrade [-key KEY] [-migrate-dry-run] <data-file>
+func runUpgrade(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("upgrade", flag.ContinueOnError)
+	fs.SetOutput(out)
+	key := fs.String("key", os.Getenv("MKV_ENCRYPTION_KEY"), "encryption key of the data file (defaults to $MKV_ENCRYPTION_KEY)")
+	dryRun := fs.Bool("migrate-dry-run", false, "report the migrations that would run without writing")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	if fs.NArg() != 1 {
+		return fail(out, errs.Errorf(errs.InvalidArgument, "usage: upgrade [-key KEY] [-migrate-dry-run] <data-file>"))
+	}
+	dataFile := fs.Arg(0)
+
+	quietStoreLogs()
+
+	kv, err := store.OpenKeyValueStore(dataFile, []byte(*key), 0, time.Minute,
+		store.WithMigrations(store.DefaultMigrations()...), store.WithOwnerFile())
+	if err != nil {
+		return fail(out, err)
+	}
+	defer kv.Stop()
+
+	plan, err := kv.PlanMigrations()
+	if err != nil {
+		return fail(out, err)
+	}
+	if len(plan.Steps) == 0 {
+		fmt.Fprintf(out, "%s is up to date\n", dataFile)
+		return 0
+	}
+	for _, step := range plan.Steps {
+		fmt.Fprintf(out, "%s: %s -> %s\n", step.Name, step.From, step.To)
+	}
+	if *dryRun {
+		fmt.Fprintf(out, "would migrate %d keys (content hash %s) and preserve the original as %s\n", plan.Keys, plan.Hash, plan.Preserve)
+		return 0
+	}
+	if err := kv.Load(); err != nil {
+		return fail(out, err)
+	}
+	fmt.Fprintf(out, "migrated %d keys, original preserved as %s\n", plan.Keys, plan.Preserve)
+	return 0
+}
+
+// runRollback restores the original of a data file preserved by a migration and returns the process exit code.
+//
+//	rollback [-generation N] <data-file>
+func runRollback(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	fs.SetOutput(out)
+	generation := fs.Int("generation", 0, "preserved original to restore; the latest if zero")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	if fs.NArg() != 1 || *generation < 0 {
+		return fail(out, errs.Errorf(errs.InvalidArgument, "usage: rollback [-generation N] <data-file>"))
+	}
+	dataFile := fs.Arg(0)
+
+	quietStoreLogs()
+
+	restored, err := store.RollbackMigration(dataFile, *generation)
+	if err != nil {
+		return fail(out, err)
+	}
+	fmt.Fprintf(out, "restored %s from generation %d\n", dataFile, restored)
+	return 0
+}
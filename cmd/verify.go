@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// runVerify compares a data file with a backup of it and returns the process exit code:
+// 0 when they match or -repair made them match, 1 when they differ and the errs exit code of the
+// failure otherwise.
+//
+//	verify [-key KEY] [-repair] [-require-encryption] <data-file> <backup-file>
+func runVerify(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(out)
+	key := fs.String("key", os.Getenv("MKV_ENCRYPTION_KEY"), "encryption key of both files (defaults to $MKV_ENCRYPTION_KEY)")
+	repair := fs.Bool("repair", false, "replace divergent keys in the data file with the backup's history")
+	required := fs.Bool("require-encryption", requireEncryptionDefault(), "refuse to run without a valid key or read unencrypted files (defaults to $MKV_REQUIRE_ENCRYPTION)")
+	if err := fs.Parse(args); err != nil {
+		return errs.ExitCode(errs.Wrap(errs.InvalidArgument, err))
+	}
+	if fs.NArg() != 2 {
+		return fail(out, errs.Errorf(errs.InvalidArgument, "usage: verify [-key KEY] [-repair] [-require-encryption] <data-file> <backup-file>"))
+	}
+	dataFile, backupFile := fs.Arg(0), fs.Arg(1)
+
+	quietStoreLogs()
+
+	var opts []store.Option
+	if *required {
+		if err := requireKey([]byte(*key)); err != nil {
+			return fail(out, err)
+		}
+		opts = append(opts, store.RequireEncryption())
+	}
+
+	backup, err := os.Open(backupFile)
+	if err != nil {
+		return fail(out, fmt.Errorf("error opening backup: %w", err))
+	}
+	defer backup.Close()
+
+	var kv *store.KeyValueStore
+	if *repair {
+		kv, err = store.OpenKeyValueStore(dataFile, []byte(*key), 0, time.Minute, append(opts, store.WithOwnerFile())...)
+		if err != nil {
+			return fail(out, err)
+		}
+	} else {
+		// Load into memory so that verifying never rewrites the data file.
+		data, err := os.Open(dataFile)
+		if err != nil {
+			return fail(out, fmt.Errorf("error opening data file: %w", err))
+		}
+		defer data.Close()
+		kv, err = store.NewKeyValueStoreFromReader(data, []byte(*key), opts...)
+		if err != nil {
+			return fail(out, fmt.Errorf("error loading data file: %w", err))
+		}
+	}
+	defer kv.Stop()
+
+	var report store.VerifyReport
+	if *repair {
+		report, err = kv.Repair(backup)
+	} else {
+		report, err = kv.Verify(backup)
+	}
+	if err != nil {
+		return fail(out, fmt.Errorf("error verifying: %w", err))
+	}
+
+	printKeys(out, "missing", report.Missing)
+	printKeys(out, "extra", report.Extra)
+	printKeys(out, "divergent", report.Divergent)
+	printKeys(out, "repaired", report.Repaired)
+
+	if report.Consistent() {
+		fmt.Fprintln(out, "data file matches backup")
+		return 0
+	}
+	if *repair && len(report.Repaired) > 0 {
+		// The report describes the data file before the repair; check what it holds now.
+		if _, err := backup.Seek(0, io.SeekStart); err != nil {
+			return fail(out, fmt.Errorf("error rereading backup: %w", err))
+		}
+		recheck, err := kv.Verify(backup)
+		if err != nil {
+			return fail(out, fmt.Errorf("error verifying repair: %w", err))
+		}
+		if recheck.Consistent() {
+			fmt.Fprintln(out, "data file matches backup after repair")
+			return 0
+		}
+	}
+	return 1
+}
+
+// fail prints err and returns its exit code.
+func fail(out io.Writer, err error) int {
+	fmt.Fprintln(out, err)
+	return errs.ExitCode(err)
+}
+
+// quietStoreLogs keeps the store's operational logging off the output of a subcommand.
+func quietStoreLogs() {
+	log.SetOutput(io.Discard)
+}
+
+// printKeys prints one line per key prefixed with its category.
+func printKeys(out io.Writer, category string, keys []string) {
+	for _, key := range keys {
+		fmt.Fprintf(out, "%s\t%s\n", category, key)
+	}
+}
@@ -0,0 +1,155 @@
+// Package api serves the keys of a KeyValueStore over a JSON HTTP API.
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+	"github.com/Chahine-tech/minikeyvalue/internal/watch"
+)
+
+// Routes served by Handler, besides watch.Pattern. Keys containing a slash must have it escaped as %2F.
+const (
+	KeysPattern                = "GET /api/v1/keys"
+	GetPattern                 = "GET /api/v1/keys/{key}"
+	PutPattern                 = "PUT /api/v1/keys/{key}"
+	DeletePattern              = "DELETE /api/v1/keys/{key}"
+	CompareAndSwapPattern      = "POST /api/v1/keys/{key}/cas"
+	MultiCompareAndSwapPattern = "POST /api/v1/cas"
+	VersionsPattern            = "GET /api/v1/keys/{key}/versions"
+	VersionPattern             = "GET /api/v1/keys/{key}/versions/{version}"
+	DeleteVersionPattern       = "DELETE /api/v1/keys/{key}/versions/{version}"
+	HistoryPattern             = "GET /api/v1/keys/{key}/history"
+)
+
+// APIKeyHeader is the request header carrying the API key, see WithAPIKeys.
+const APIKeyHeader = "X-API-Key"
+
+// retryAfter is the Retry-After header, in seconds, of the responses to requests the store turned away
+// for now: under memory pressure or in maintenance mode.
+const retryAfter = "1"
+
+// maxBodySize is the largest request body accepted.
+const maxBodySize = 64 << 20
+
+// errorResponse is the body of every failed request. Code is the name of the error's kind, such as
+// "not_found", and the status is that of the kind.
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+// errorBody describes the error of an errorResponse.
+type errorBody struct {
+	Code      string           `json:"code"`
+	Message   string           `json:"message"`
+	Condition *failedCondition `json:"condition,omitempty"` // Set for a failed condition of MultiCompareAndSwapPattern
+}
+
+// Option configures the handler.
+type Option func(*api)
+
+// WithAPIKeys requires every request to carry one of keys, mapped to the principal it authenticates, in
+// the APIKeyHeader header; other requests fail as unauthorized. The principal is put in the request
+// context for the store's Authorizer. Without it, requests are not authenticated.
+func WithAPIKeys(keys map[string]string) Option {
+	return func(a *api) {
+		a.apiKeys = keys
+	}
+}
+
+// Handler returns an HTTP handler serving the routes of this package and the watch stream for kv.
+// Versions are numbered from 0, the oldest, as in GetVersion. Every operation uses the request context,
+// so the store's Authorizer sees the principal the server's authentication put there; removing a version
+// is authorized as a delete. The watch stream is authenticated but not authorized per key.
+func Handler(kv *store.KeyValueStore, opts ...Option) http.Handler {
+	a := &api{kv: kv}
+	for _, opt := range opts {
+		opt(a)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(KeysPattern, a.keys)
+	mux.HandleFunc(GetPattern, a.get)
+	mux.HandleFunc(PutPattern, a.put)
+	mux.HandleFunc(DeletePattern, a.delete)
+	mux.HandleFunc(CompareAndSwapPattern, a.compareAndSwap)
+	mux.HandleFunc(MultiCompareAndSwapPattern, a.multiCompareAndSwap)
+	mux.HandleFunc(VersionsPattern, a.versions)
+	mux.HandleFunc(VersionPattern, a.version)
+	mux.HandleFunc(DeleteVersionPattern, a.deleteVersion)
+	mux.HandleFunc(HistoryPattern, a.history)
+	mux.Handle(watch.Pattern, watch.Handler(kv))
+	if a.apiKeys == nil {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := a.authenticate(r.Header.Get(APIKeyHeader))
+		if !ok {
+			fail(w, errs.Errorf(errs.Unauthorized, "missing or unknown API key"))
+			return
+		}
+		mux.ServeHTTP(w, r.WithContext(store.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// api serves the routes of one store.
+type api struct {
+	kv      *store.KeyValueStore
+	apiKeys map[string]string
+}
+
+// authenticate returns the principal of key. Every known key is compared in constant time, so the time
+// taken does not tell how close key is to one of them.
+func (a *api) authenticate(key string) (string, bool) {
+	principal, found := "", false
+	for known, p := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(known)) == 1 {
+			principal, found = p, true
+		}
+	}
+	return principal, found && key != ""
+}
+
+// decode reads the JSON request body into v.
+func decode(w http.ResponseWriter, r *http.Request, v any) error {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return errs.Errorf(errs.InvalidArgument, "request body larger than %d bytes", tooLarge.Limit)
+		}
+		return errs.Errorf(errs.InvalidArgument, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+// writeJSON writes body as the JSON response.
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// fail writes err as an errorResponse with the HTTP status of its kind. Requests turned away for now
+// are told when to retry.
+func fail(w http.ResponseWriter, err error) {
+	kind := errs.KindOf(err)
+	status, _ := errs.HTTPStatusFor(kind)
+	if kind == errs.ResourceExhausted || kind == errs.Unavailable {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	body := errorResponse{Error: errorBody{Code: kind.String(), Message: err.Error()}}
+	var failed *store.ConditionFailedError
+	if errors.As(err, &failed) {
+		body.Error.Condition = &failedCondition{
+			Index:    failed.Index,
+			Key:      failed.Condition.Key,
+			Found:    failed.Found,
+			Value:    failed.Value,
+			Revision: failed.Revision,
+		}
+	}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// defaultPageLimit is the number of keys per response of KeysPattern when the request sets no limit;
+// maxPageLimit is the most a request can ask for.
+const (
+	defaultPageLimit = 1000
+	maxPageLimit     = 10000
+)
+
+// keysResponse is the response body of KeysPattern. Next is the cursor of the next page, empty after
+// the last one.
+type keysResponse struct {
+	Keys []string `json:"keys"`
+	Next string   `json:"next,omitempty"`
+}
+
+// valueResponse is the response body of GetPattern. TTLMillis is the remaining TTL, rounded up, and
+// zero for keys that never expire.
+type valueResponse struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	TTLMillis int64  `json:"ttl_ms,omitempty"`
+}
+
+// putRequest is the request body of PutPattern. A zero TTLMillis applies the store's global TTL, as Set.
+type putRequest struct {
+	Value     string `json:"value"`
+	TTLMillis int64  `json:"ttl_ms"`
+}
+
+// compareAndSwapRequest is the request body of CompareAndSwapPattern.
+type compareAndSwapRequest struct {
+	Old       string `json:"old"`
+	New       string `json:"new"`
+	TTLMillis int64  `json:"ttl_ms"`
+}
+
+// compareAndSwapResponse is the response body of CompareAndSwapPattern.
+type compareAndSwapResponse struct {
+	Swapped bool `json:"swapped"`
+}
+
+// condition is a store.Condition of a multiCompareAndSwapRequest.
+type condition struct {
+	Key        string `json:"key"`
+	Value      string `json:"value,omitempty"`
+	Revision   uint64 `json:"revision,omitempty"`
+	ByRevision bool   `json:"by_revision,omitempty"`
+	Absent     bool   `json:"absent,omitempty"`
+}
+
+// update is a store.Update of a multiCompareAndSwapRequest.
+type update struct {
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`
+	TTLMillis int64  `json:"ttl_ms,omitempty"`
+	Delete    bool   `json:"delete,omitempty"`
+}
+
+// multiCompareAndSwapRequest is the request body of MultiCompareAndSwapPattern.
+type multiCompareAndSwapRequest struct {
+	Conditions []condition `json:"conditions"`
+	Updates    []update    `json:"updates"`
+}
+
+// failedCondition describes the store.ConditionFailedError of a MultiCompareAndSwapPattern request.
+type failedCondition struct {
+	Index    int    `json:"index"`
+	Key      string `json:"key"`
+	Found    bool   `json:"found"`
+	Value    string `json:"value,omitempty"`
+	Revision uint64 `json:"revision,omitempty"`
+}
+
+// keys lists a page of the keys starting with the prefix query parameter, after the cursor one.
+func (a *api) keys(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultPageLimit
+	if s := query.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxPageLimit {
+			fail(w, errs.Errorf(errs.InvalidArgument, "invalid limit '%s': must be between 1 and %d", s, maxPageLimit))
+			return
+		}
+		limit = n
+	}
+	keys, next, err := a.kv.KeysPageContext(r.Context(), query.Get("prefix"), query.Get("cursor"), limit)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, keysResponse{Keys: keys, Next: next})
+}
+
+// get returns the latest value of a key and its remaining TTL.
+func (a *api) get(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	value, remaining, err := a.kv.GetWithTTLContext(r.Context(), key)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	result := valueResponse{Key: key, Value: value}
+	if remaining != store.NoExpiration {
+		result.TTLMillis = (remaining + time.Millisecond - 1).Milliseconds()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// put sets a key.
+func (a *api) put(w http.ResponseWriter, r *http.Request) {
+	var req putRequest
+	if err := decode(w, r, &req); err != nil {
+		fail(w, err)
+		return
+	}
+	ttl, err := ttlParam(req.TTLMillis)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	if err := a.kv.SetContext(r.Context(), r.PathValue("key"), req.Value, ttl); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// delete removes a key.
+func (a *api) delete(w http.ResponseWriter, r *http.Request) {
+	if err := a.kv.DeleteContext(r.Context(), r.PathValue("key")); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// compareAndSwap sets a key to the new value if its latest value is the old one. A value that does not
+// match is not an error: the response reports that nothing was swapped.
+func (a *api) compareAndSwap(w http.ResponseWriter, r *http.Request) {
+	var req compareAndSwapRequest
+	if err := decode(w, r, &req); err != nil {
+		fail(w, err)
+		return
+	}
+	ttl, err := ttlParam(req.TTLMillis)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	swapped, err := a.kv.CompareAndSwapContext(r.Context(), r.PathValue("key"), req.Old, req.New, ttl)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, compareAndSwapResponse{Swapped: swapped})
+}
+
+// multiCompareAndSwap applies updates if every condition holds. A condition that does not hold fails the
+// request as a conflict naming it.
+func (a *api) multiCompareAndSwap(w http.ResponseWriter, r *http.Request) {
+	var req multiCompareAndSwapRequest
+	if err := decode(w, r, &req); err != nil {
+		fail(w, err)
+		return
+	}
+	conditions := make([]store.Condition, len(req.Conditions))
+	for i, c := range req.Conditions {
+		conditions[i] = store.Condition{Key: c.Key, Value: c.Value, Revision: c.Revision, ByRevision: c.ByRevision, Absent: c.Absent}
+	}
+	updates := make([]store.Update, len(req.Updates))
+	for i, u := range req.Updates {
+		ttl, err := ttlParam(u.TTLMillis)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		updates[i] = store.Update{Key: u.Key, Value: u.Value, TTL: ttl, Delete: u.Delete}
+	}
+	if _, err := a.kv.MultiCompareAndSwapContext(r.Context(), conditions, updates); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ttlParam converts a TTL in milliseconds from a request body.
+func ttlParam(millis int64) (time.Duration, error) {
+	if millis < 0 {
+		return 0, errs.Errorf(errs.InvalidArgument, "invalid ttl_ms %d", millis)
+	}
+	return time.Duration(millis) * time.Millisecond, nil
+}
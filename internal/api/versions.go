@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+)
+
+// versionsResponse is the response body of VersionsPattern, oldest version first.
+type versionsResponse struct {
+	Key      string   `json:"key"`
+	Versions []string `json:"versions"`
+}
+
+// versionResponse is the response body of VersionPattern.
+type versionResponse struct {
+	Key     string `json:"key"`
+	Version int    `json:"version"`
+	Value   string `json:"value"`
+}
+
+// historyEntry is a version in the response body of HistoryPattern.
+type historyEntry struct {
+	Version   int       `json:"version"`
+	Value     string    `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+	Revision  uint64    `json:"revision,omitempty"`
+	Encoding  string    `json:"encoding,omitempty"`
+}
+
+// historyResponse is the response body of HistoryPattern, oldest version first.
+type historyResponse struct {
+	Key     string         `json:"key"`
+	History []historyEntry `json:"history"`
+}
+
+// versions lists the values of every version of a key.
+func (a *api) versions(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	values, err := a.kv.GetAllVersionsContext(r.Context(), key)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, versionsResponse{Key: key, Versions: values})
+}
+
+// version returns the value of a version of a key.
+func (a *api) version(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	version, err := versionParam(r)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	value, err := a.kv.GetVersionContext(r.Context(), key, version)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, versionResponse{Key: key, Version: version, Value: value})
+}
+
+// deleteVersion removes a version of a key. The versions after it are renumbered.
+func (a *api) deleteVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := versionParam(r)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	if err := a.kv.RemoveVersionContext(r.Context(), r.PathValue("key"), version); err != nil {
+		fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// history returns every version of a key with its timestamp and revision.
+func (a *api) history(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	versions, err := a.kv.GetHistoryContext(r.Context(), key)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	result := historyResponse{Key: key, History: make([]historyEntry, len(versions))}
+	for i, v := range versions {
+		result.History[i] = historyEntry{Version: i, Value: v.Value, Timestamp: v.Timestamp, Revision: v.Revision, Encoding: v.Encoding}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// versionParam parses the version path parameter.
+func versionParam(r *http.Request) (int, error) {
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || version < 0 {
+		return 0, errs.Errorf(errs.InvalidArgument, "invalid version '%s'", r.PathValue("version"))
+	}
+	return version, nil
+}
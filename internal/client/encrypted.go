@@ -0,0 +1,238 @@
+// Package client provides client-side encryption over a store, so the store only ever holds ciphertext.
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// rotateBatch is how many keys RotatePrefix lists and writes per MultiCompareAndSwap call.
+const rotateBatch = 500
+
+// rotateAttempts is how many times RotatePrefix tries a batch whose keys keep being written concurrently.
+const rotateAttempts = 10
+
+// ErrNotClientEncrypted is returned when reading a value that was not written by an encrypting client.
+var ErrNotClientEncrypted = errors.New("value is not client-encrypted")
+
+// errHashedPrefix is returned by RotatePrefix for a client hashing key names, whose prefixes cannot be listed.
+var errHashedPrefix = errors.New("keys are hashed, so they cannot be listed by prefix")
+
+// Store is the part of the store API the encrypting client uses.
+type Store interface {
+	Set(key, value string, expiration time.Duration) error
+	Get(key string) (string, error)
+	GetWithTTL(key string) (string, time.Duration, error)
+	GetAllVersions(key string) ([]string, error)
+	MultiCompareAndSwap(conditions []store.Condition, updates []store.Update) (bool, error)
+	KeysPage(prefix, cursor string, limit int) ([]string, string, error)
+}
+
+// Option configures an Encrypted client.
+type Option func(*Encrypted)
+
+// WithKeyHMAC stores keys as their HMAC-SHA256 under secret, so the store does not see key names either.
+func WithKeyHMAC(secret []byte) Option {
+	return func(c *Encrypted) {
+		c.keySecret = secret
+	}
+}
+
+// Encrypted encrypts values with AES-GCM before they reach the store and decrypts them on read.
+// Each value is bound to its key, so ciphertext moved to another key fails to decrypt.
+type Encrypted struct {
+	store     Store
+	key       []byte
+	keySecret []byte
+}
+
+// NewEncrypted returns a client encrypting values written to s with key, an AES-128, AES-192 or AES-256 key.
+func NewEncrypted(s Store, key []byte, opts ...Option) (*Encrypted, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("invalid client key size %d: must be 16, 24 or 32 bytes", len(key))
+	}
+	c := &Encrypted{store: s, key: key}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Set encrypts value and stores it under key.
+func (c *Encrypted) Set(key, value string, expiration time.Duration) error {
+	stored := c.storedKey(key)
+	sealed, err := c.seal(stored, value)
+	if err != nil {
+		return err
+	}
+	return c.store.Set(stored, sealed, expiration)
+}
+
+// Get returns the decrypted latest value of key.
+func (c *Encrypted) Get(key string) (string, error) {
+	stored := c.storedKey(key)
+	sealed, err := c.store.Get(stored)
+	if err != nil {
+		return "", err
+	}
+	return c.open(stored, sealed)
+}
+
+// History returns every decrypted version of key, oldest first.
+func (c *Encrypted) History(key string) ([]string, error) {
+	stored := c.storedKey(key)
+	versions, err := c.store.GetAllVersions(stored)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(versions))
+	for i, sealed := range versions {
+		if values[i], err = c.open(stored, sealed); err != nil {
+			return nil, fmt.Errorf("version %d: %w", i, err)
+		}
+	}
+	return values, nil
+}
+
+// RotatePrefix re-encrypts the latest value of every key starting with prefix for next, keeping remaining
+// TTLs, and returns how many keys were rewritten. Keys are listed and written a page at a time with
+// MultiCompareAndSwap, conditioned on the value read, so a write landing between the read and the rewrite
+// is re-read and re-encrypted rather than overwritten; earlier versions stay encrypted with this client's key.
+func (c *Encrypted) RotatePrefix(prefix string, next *Encrypted) (int, error) {
+	if c.keySecret != nil || next.keySecret != nil {
+		return 0, errHashedPrefix
+	}
+
+	rotated := 0
+	for cursor := ""; ; {
+		keys, nextCursor, err := c.store.KeysPage(prefix, cursor, rotateBatch)
+		if err != nil {
+			return rotated, fmt.Errorf("error listing keys: %w", err)
+		}
+		n, err := c.rotateKeys(keys, next)
+		rotated += n
+		if err != nil || nextCursor == "" {
+			return rotated, err
+		}
+		cursor = nextCursor
+	}
+}
+
+// rotateKeys re-encrypts keys for next in a single MultiCompareAndSwap, re-reading the keys written since
+// they were read until it succeeds, and returns how many keys it rewrote.
+func (c *Encrypted) rotateKeys(keys []string, next *Encrypted) (int, error) {
+	conditions := make([]store.Condition, 0, len(keys))
+	updates := make([]store.Update, 0, len(keys))
+	for _, key := range keys {
+		condition, update, ok, err := c.rotation(key, next)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			conditions = append(conditions, condition)
+			updates = append(updates, update)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		if len(updates) == 0 {
+			return 0, nil
+		}
+		_, err := c.store.MultiCompareAndSwap(conditions, updates)
+		var failed *store.ConditionFailedError
+		if !errors.As(err, &failed) {
+			if err != nil {
+				return 0, fmt.Errorf("error writing keys: %w", err)
+			}
+			return len(updates), nil
+		}
+		if attempt == rotateAttempts {
+			return 0, fmt.Errorf("key '%s' kept changing during rotation: %w", failed.Condition.Key, err)
+		}
+
+		// The sealed value read changed; rotate what is there now.
+		i := failed.Index
+		condition, update, ok, err := c.rotation(failed.Condition.Key, next)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			conditions[i], updates[i] = condition, update
+		} else {
+			conditions = append(conditions[:i], conditions[i+1:]...)
+			updates = append(updates[:i], updates[i+1:]...)
+		}
+	}
+}
+
+// rotation reads the latest value of key and returns the write re-encrypting it for next, together with the
+// condition that the value is still the one read. It reports false if the key was removed.
+func (c *Encrypted) rotation(key string, next *Encrypted) (store.Condition, store.Update, bool, error) {
+	sealed, remaining, err := c.store.GetWithTTL(key)
+	if errors.Is(err, store.ErrKeyNotFound) || errors.Is(err, store.ErrKeyExpired) {
+		return store.Condition{}, store.Update{}, false, nil // Removed since listing
+	}
+	if err != nil {
+		return store.Condition{}, store.Update{}, false, fmt.Errorf("error reading key '%s': %w", key, err)
+	}
+	value, err := c.open(key, sealed)
+	if err != nil {
+		return store.Condition{}, store.Update{}, false, err
+	}
+	resealed, err := next.seal(key, value)
+	if err != nil {
+		return store.Condition{}, store.Update{}, false, err
+	}
+	if remaining == store.NoExpiration {
+		remaining = 0
+	}
+	// Sealed values carry a random nonce, so the value read identifies the write that made it.
+	condition := store.Condition{Key: key, Value: sealed}
+	return condition, store.Update{Key: key, Value: resealed, TTL: remaining}, true, nil
+}
+
+// storedKey returns the key under which key is stored.
+func (c *Encrypted) storedKey(key string) string {
+	if c.keySecret == nil {
+		return key
+	}
+	mac := hmac.New(sha256.New, c.keySecret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal encrypts value for the stored key and adds the client encryption marker.
+func (c *Encrypted) seal(stored, value string) (string, error) {
+	encrypted, err := store.EncryptDataWithContext([]byte(value), c.key, []byte(stored))
+	if err != nil {
+		return "", fmt.Errorf("error encrypting value: %v", err)
+	}
+	return store.ClientEncryptedPrefix + base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// open checks the client encryption marker and decrypts the value of the stored key.
+func (c *Encrypted) open(stored, sealed string) (string, error) {
+	encoded, ok := strings.CutPrefix(sealed, store.ClientEncryptedPrefix)
+	if !ok {
+		return "", fmt.Errorf("key '%s': %w", stored, ErrNotClientEncrypted)
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("error decoding value of key '%s': %v", stored, err)
+	}
+	value, err := store.DecryptDataWithContext(encrypted, c.key, []byte(stored))
+	if err != nil {
+		return "", fmt.Errorf("error decrypting value of key '%s': %w", stored, err)
+	}
+	return string(value), nil
+}
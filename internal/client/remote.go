@@ -0,0 +1,639 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// apiKeyHeader is the request header carrying the API key, as api.APIKeyHeader.
+const apiKeyHeader = "X-API-Key"
+
+// defaultTimeout is how long a call of a Remote may take without WithTimeout.
+const defaultTimeout = 10 * time.Second
+
+// defaultMaxIdleConns is how many idle connections a Remote keeps without WithMaxIdleConns.
+const defaultMaxIdleConns = 16
+
+// keysPageLimit is how many keys KeysContext asks for per request.
+const keysPageLimit = 1000
+
+// maxErrorBody is the most of an error response read for its message.
+const maxErrorBody = 64 << 10
+
+// DefaultRetryPolicy is the retry policy of a Remote without WithRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// Errors of a Remote, matched by errors.Is against the code of the API's error responses, which are
+// returned as *APIError.
+var (
+	ErrKeyNotFound  = store.ErrKeyNotFound       // not_found: the key, or the version asked for, does not exist
+	ErrUnauthorized = errors.New("unauthorized") // unauthorized: the API key is missing or unknown
+	ErrForbidden    = store.ErrForbidden         // forbidden: the store's Authorizer denied the operation
+	ErrConflict     = errors.New("conflict")     // conflict: a condition of MultiCompareAndSwap failed, among others
+)
+
+// errWatchEnded is returned when the server ends a watch stream, which Watch reopens.
+var errWatchEnded = errors.New("watch stream ended")
+
+// APIError is an error response of the API. A failed condition of MultiCompareAndSwap also unwraps to
+// the *store.ConditionFailedError describing it.
+type APIError struct {
+	Status  int    // HTTP status
+	Code    string // Name of the error's kind, such as "not_found"; empty if the response had none
+	Message string
+
+	retryAfter time.Duration // Retry-After of the response, if any
+	cause      error
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("HTTP %d: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Is reports whether target is the sentinel error of the code.
+func (e *APIError) Is(target error) bool {
+	switch e.Code {
+	case "not_found":
+		return target == ErrKeyNotFound
+	case "unauthorized":
+		return target == ErrUnauthorized
+	case "forbidden":
+		return target == ErrForbidden
+	case "conflict":
+		return target == ErrConflict
+	}
+	return false
+}
+
+func (e *APIError) Unwrap() error {
+	return e.cause
+}
+
+// RetryPolicy decides how a Remote retries failed requests. Responses the server turned away for now,
+// with status 429 or 503, are retried; so are other 5xx statuses and network errors, but only for PUT,
+// GET and DELETE requests, as a POST may have been applied.
+type RetryPolicy struct {
+	MaxAttempts int           // Attempts per call, the first included; 1 or less disables retries
+	BaseDelay   time.Duration // Delay before the first retry, doubled for each next one, with jitter
+	MaxDelay    time.Duration // Longest backoff delay; a longer Retry-After from the server is still honored
+}
+
+// delay returns how long to wait before the retry following failures failed attempts, which is at least
+// retryAfter. The backoff is drawn from its upper half, so clients failing together spread out.
+func (p RetryPolicy) delay(failures int, retryAfter time.Duration) time.Duration {
+	backoff := p.MaxDelay
+	if shift := failures - 1; shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		backoff = p.BaseDelay << shift
+	}
+	if backoff > 0 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+	return max(backoff, retryAfter)
+}
+
+// RemoteOption configures a Remote.
+type RemoteOption func(*Remote)
+
+// WithAPIKey sends key in the X-API-Key header of every request.
+func WithAPIKey(key string) RemoteOption {
+	return func(r *Remote) {
+		r.apiKey = key
+	}
+}
+
+// WithTimeout bounds every call but Watch, retries included; zero leaves calls bounded by their context only.
+func WithTimeout(timeout time.Duration) RemoteOption {
+	return func(r *Remote) {
+		r.timeout = timeout
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy.
+func WithRetryPolicy(policy RetryPolicy) RemoteOption {
+	return func(r *Remote) {
+		r.retry = policy
+	}
+}
+
+// WithMaxIdleConns sets how many idle connections to the server are kept for reuse.
+func WithMaxIdleConns(n int) RemoteOption {
+	return func(r *Remote) {
+		r.maxIdleConns = n
+	}
+}
+
+// Remote is a store served over HTTP by the api package. It implements Store, so an Encrypted client can
+// run over it. Every method has a variant taking a context; the others use context.Background().
+type Remote struct {
+	baseURL      string
+	apiKey       string
+	timeout      time.Duration
+	retry        RetryPolicy
+	maxIdleConns int
+	http         *http.Client
+}
+
+var _ Store = (*Remote)(nil)
+
+// NewRemote returns a client of the API served at baseURL, such as "http://localhost:8080". Its
+// connections are pooled, so a single Remote should be shared rather than one created per call.
+func NewRemote(baseURL string, opts ...RemoteOption) (*Remote, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL '%s'", baseURL)
+	}
+	r := &Remote{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		timeout:      defaultTimeout,
+		retry:        DefaultRetryPolicy,
+		maxIdleConns: defaultMaxIdleConns,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = r.maxIdleConns
+	transport.MaxIdleConnsPerHost = r.maxIdleConns
+	r.http = &http.Client{Transport: transport}
+	return r, nil
+}
+
+// Close closes the idle connections to the server.
+func (r *Remote) Close() {
+	r.http.CloseIdleConnections()
+}
+
+// valueBody is the body of a key's value, with its TTL in milliseconds.
+type valueBody struct {
+	Value     string `json:"value"`
+	TTLMillis int64  `json:"ttl_ms,omitempty"`
+}
+
+// Get is GetContext with context.Background().
+func (r *Remote) Get(key string) (string, error) {
+	return r.GetContext(context.Background(), key)
+}
+
+// GetContext returns the latest value of key.
+func (r *Remote) GetContext(ctx context.Context, key string) (string, error) {
+	value, _, err := r.GetWithTTLContext(ctx, key)
+	return value, err
+}
+
+// GetWithTTL is GetWithTTLContext with context.Background().
+func (r *Remote) GetWithTTL(key string) (string, time.Duration, error) {
+	return r.GetWithTTLContext(context.Background(), key)
+}
+
+// GetWithTTLContext returns the latest value of key and its remaining TTL, store.NoExpiration if it never
+// expires.
+func (r *Remote) GetWithTTLContext(ctx context.Context, key string) (string, time.Duration, error) {
+	var body valueBody
+	if err := r.do(ctx, http.MethodGet, keyPath(key), nil, &body); err != nil {
+		return "", 0, err
+	}
+	if body.TTLMillis == 0 {
+		return body.Value, store.NoExpiration, nil
+	}
+	return body.Value, time.Duration(body.TTLMillis) * time.Millisecond, nil
+}
+
+// Set is SetContext with context.Background().
+func (r *Remote) Set(key, value string, expiration time.Duration) error {
+	return r.SetContext(context.Background(), key, value, expiration)
+}
+
+// SetContext sets key to value, expiring after expiration, rounded up to the millisecond, if positive.
+func (r *Remote) SetContext(ctx context.Context, key, value string, expiration time.Duration) error {
+	return r.do(ctx, http.MethodPut, keyPath(key), valueBody{Value: value, TTLMillis: millis(expiration)}, nil)
+}
+
+// Delete is DeleteContext with context.Background().
+func (r *Remote) Delete(key string) error {
+	return r.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext removes key.
+func (r *Remote) DeleteContext(ctx context.Context, key string) error {
+	return r.do(ctx, http.MethodDelete, keyPath(key), nil, nil)
+}
+
+// CompareAndSwap is CompareAndSwapContext with context.Background().
+func (r *Remote) CompareAndSwap(key, oldValue, newValue string, ttl time.Duration) (bool, error) {
+	return r.CompareAndSwapContext(context.Background(), key, oldValue, newValue, ttl)
+}
+
+// CompareAndSwapContext sets key to newValue if its latest value is oldValue, and reports whether it did.
+func (r *Remote) CompareAndSwapContext(ctx context.Context, key, oldValue, newValue string, ttl time.Duration) (bool, error) {
+	req := struct {
+		Old       string `json:"old"`
+		New       string `json:"new"`
+		TTLMillis int64  `json:"ttl_ms,omitempty"`
+	}{oldValue, newValue, millis(ttl)}
+	var resp struct {
+		Swapped bool `json:"swapped"`
+	}
+	err := r.do(ctx, http.MethodPost, keyPath(key)+"/cas", req, &resp)
+	return resp.Swapped, err
+}
+
+// MultiCompareAndSwap is MultiCompareAndSwapContext with context.Background().
+func (r *Remote) MultiCompareAndSwap(conditions []store.Condition, updates []store.Update) (bool, error) {
+	return r.MultiCompareAndSwapContext(context.Background(), conditions, updates)
+}
+
+// MultiCompareAndSwapContext applies updates if every condition holds, and reports whether it did. When a
+// condition does not hold, the error unwraps to a *store.ConditionFailedError naming it.
+func (r *Remote) MultiCompareAndSwapContext(ctx context.Context, conditions []store.Condition, updates []store.Update) (bool, error) {
+	type condition struct {
+		Key        string `json:"key"`
+		Value      string `json:"value,omitempty"`
+		Revision   uint64 `json:"revision,omitempty"`
+		ByRevision bool   `json:"by_revision,omitempty"`
+		Absent     bool   `json:"absent,omitempty"`
+	}
+	type update struct {
+		Key       string `json:"key"`
+		Value     string `json:"value,omitempty"`
+		TTLMillis int64  `json:"ttl_ms,omitempty"`
+		Delete    bool   `json:"delete,omitempty"`
+	}
+	var req struct {
+		Conditions []condition `json:"conditions"`
+		Updates    []update    `json:"updates"`
+	}
+	for _, c := range conditions {
+		req.Conditions = append(req.Conditions, condition{c.Key, c.Value, c.Revision, c.ByRevision, c.Absent})
+	}
+	for _, u := range updates {
+		req.Updates = append(req.Updates, update{u.Key, u.Value, millis(u.TTL), u.Delete})
+	}
+
+	err := r.do(ctx, http.MethodPost, "/api/v1/cas", req, nil)
+	var failed *store.ConditionFailedError
+	if errors.As(err, &failed) && failed.Index >= 0 && failed.Index < len(conditions) {
+		failed.Condition = conditions[failed.Index]
+	}
+	return err == nil, err
+}
+
+// KeysPage is KeysPageContext with context.Background().
+func (r *Remote) KeysPage(prefix, cursor string, limit int) ([]string, string, error) {
+	return r.KeysPageContext(context.Background(), prefix, cursor, limit)
+}
+
+// KeysPageContext returns up to limit of the sorted keys starting with prefix that come after cursor, and
+// the cursor of the next page, which is "" after the last page, as store.KeyValueStore.KeysPage.
+func (r *Remote) KeysPageContext(ctx context.Context, prefix, cursor string, limit int) ([]string, string, error) {
+	query := url.Values{"prefix": {prefix}, "cursor": {cursor}, "limit": {strconv.Itoa(limit)}}
+	var page struct {
+		Keys []string `json:"keys"`
+		Next string   `json:"next"`
+	}
+	if err := r.do(ctx, http.MethodGet, "/api/v1/keys?"+query.Encode(), nil, &page); err != nil {
+		return nil, "", err
+	}
+	return page.Keys, page.Next, nil
+}
+
+// KeysContext returns every key starting with prefix, sorted, reading them a page at a time.
+func (r *Remote) KeysContext(ctx context.Context, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	for cursor := ""; ; {
+		page, next, err := r.KeysPageContext(ctx, prefix, cursor, keysPageLimit)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page...)
+		if next == "" {
+			return keys, nil
+		}
+		cursor = next
+	}
+}
+
+// GetVersion is GetVersionContext with context.Background().
+func (r *Remote) GetVersion(key string, version int) (string, error) {
+	return r.GetVersionContext(context.Background(), key, version)
+}
+
+// GetVersionContext returns the value of version of key, numbered from 0, the oldest.
+func (r *Remote) GetVersionContext(ctx context.Context, key string, version int) (string, error) {
+	var resp struct {
+		Value string `json:"value"`
+	}
+	err := r.do(ctx, http.MethodGet, keyPath(key)+"/versions/"+strconv.Itoa(version), nil, &resp)
+	return resp.Value, err
+}
+
+// GetAllVersions is GetAllVersionsContext with context.Background().
+func (r *Remote) GetAllVersions(key string) ([]string, error) {
+	return r.GetAllVersionsContext(context.Background(), key)
+}
+
+// GetAllVersionsContext returns the value of every version of key, oldest first.
+func (r *Remote) GetAllVersionsContext(ctx context.Context, key string) ([]string, error) {
+	var resp struct {
+		Versions []string `json:"versions"`
+	}
+	err := r.do(ctx, http.MethodGet, keyPath(key)+"/versions", nil, &resp)
+	return resp.Versions, err
+}
+
+// GetHistory is GetHistoryContext with context.Background().
+func (r *Remote) GetHistory(key string) ([]store.KeyValue, error) {
+	return r.GetHistoryContext(context.Background(), key)
+}
+
+// GetHistoryContext returns every version of key, oldest first, with its timestamp and revision.
+func (r *Remote) GetHistoryContext(ctx context.Context, key string) ([]store.KeyValue, error) {
+	var resp struct {
+		History []struct {
+			Value     string    `json:"value"`
+			Timestamp time.Time `json:"timestamp"`
+			Revision  uint64    `json:"revision"`
+			Encoding  string    `json:"encoding"`
+		} `json:"history"`
+	}
+	if err := r.do(ctx, http.MethodGet, keyPath(key)+"/history", nil, &resp); err != nil {
+		return nil, err
+	}
+	history := make([]store.KeyValue, len(resp.History))
+	for i, v := range resp.History {
+		history[i] = store.KeyValue{Value: v.Value, Timestamp: v.Timestamp, Revision: v.Revision, Encoding: v.Encoding}
+	}
+	return history, nil
+}
+
+// RemoveVersion is RemoveVersionContext with context.Background().
+func (r *Remote) RemoveVersion(key string, version int) error {
+	return r.RemoveVersionContext(context.Background(), key, version)
+}
+
+// RemoveVersionContext removes version of key; the versions after it are renumbered.
+func (r *Remote) RemoveVersionContext(ctx context.Context, key string, version int) error {
+	return r.do(ctx, http.MethodDelete, keyPath(key)+"/versions/"+strconv.Itoa(version), nil, nil)
+}
+
+// Watch calls handle with the events of the keys starting with prefix after sequence number since, or
+// from when the stream opens if since is 0, until ctx is done or handle returns an error, which Watch
+// returns. Only the Seq, Type, Key and Time of events are set. A dropped stream is reopened after the
+// last event handled, as the retry policy allows. When the events since then are no longer available,
+// Watch returns a *store.EventsTruncatedError, and the keys must be read afresh before watching again.
+func (r *Remote) Watch(ctx context.Context, prefix string, since uint64, handle func(store.Event) error) error {
+	last := since
+	for failures := 0; ; {
+		before := last
+		retry, err := r.watch(ctx, prefix, &last, handle)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retry {
+			return err
+		}
+		if last != before {
+			failures = 0
+		}
+		failures++
+		if failures >= r.retry.MaxAttempts {
+			return err
+		}
+		if err := sleep(ctx, r.retry.delay(failures, retryAfterOf(err))); err != nil {
+			return err
+		}
+	}
+}
+
+// watch reads a watch stream after *last until it ends, updating *last with every event handled, and
+// returns whether to reopen it and why it ended.
+func (r *Remote) watch(ctx context.Context, prefix string, last *uint64, handle func(store.Event) error) (bool, error) {
+	req, err := r.newRequest(ctx, http.MethodGet, "/api/v1/watch?"+url.Values{"prefix": {prefix}}.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	if *last > 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(*last, 10))
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return retryable(resp.StatusCode, true), readAPIError(resp)
+	}
+
+	var name, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			switch field {
+			case "event":
+				name = strings.TrimPrefix(value, " ")
+			case "data":
+				data = strings.TrimPrefix(value, " ")
+			}
+			continue
+		}
+
+		// A blank line ends the event.
+		switch {
+		case name == "truncated":
+			var available struct {
+				Oldest uint64 `json:"oldest"`
+				Latest uint64 `json:"latest"`
+			}
+			json.Unmarshal([]byte(data), &available)
+			return false, &store.EventsTruncatedError{Since: *last, Oldest: available.Oldest, Latest: available.Latest}
+		case data != "":
+			var e struct {
+				Seq  uint64    `json:"seq"`
+				Type string    `json:"type"`
+				Key  string    `json:"key"`
+				Time time.Time `json:"time"`
+			}
+			if err := json.Unmarshal([]byte(data), &e); err != nil {
+				return false, fmt.Errorf("error decoding watch event: %v", err)
+			}
+			*last = e.Seq
+			if err := handle(store.Event{Seq: e.Seq, Type: e.Type, Key: e.Key, Time: e.Time}); err != nil {
+				return false, err
+			}
+		}
+		name, data = "", ""
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, errWatchEnded
+}
+
+// do sends a request to path with body, as JSON if not nil, retrying as the policy allows, and decodes
+// the JSON response into out if not nil.
+func (r *Remote) do(ctx context.Context, method, path string, body, out any) error {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("error encoding request: %v", err)
+		}
+	}
+
+	for failures := 1; ; failures++ {
+		req, err := r.newRequest(ctx, method, path, payload)
+		if err != nil {
+			return err
+		}
+		resp, err := r.http.Do(req)
+		retry := method != http.MethodPost
+		if err == nil {
+			if resp.StatusCode < 300 {
+				defer resp.Body.Close()
+				if out == nil {
+					return nil
+				}
+				if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+					return fmt.Errorf("error decoding response of %s %s: %v", method, path, err)
+				}
+				return nil
+			}
+			err = readAPIError(resp)
+			retry = retryable(resp.StatusCode, retry)
+		}
+		if !retry || ctx.Err() != nil || failures >= r.retry.MaxAttempts {
+			return err
+		}
+		if sleep(ctx, r.retry.delay(failures, retryAfterOf(err))) != nil {
+			return err
+		}
+	}
+}
+
+// newRequest returns a request to path with the JSON payload, if not nil, and the API key.
+func (r *Remote) newRequest(ctx context.Context, method, path string, payload []byte) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.apiKey != "" {
+		req.Header.Set(apiKeyHeader, r.apiKey)
+	}
+	return req, nil
+}
+
+// retryable reports whether a response with status can be retried, for a request that is safe to repeat
+// if idempotent is set.
+func retryable(status int, idempotent bool) bool {
+	switch {
+	case status == http.StatusTooManyRequests, status == http.StatusServiceUnavailable:
+		return true
+	case status >= 500:
+		return idempotent
+	}
+	return false
+}
+
+// readAPIError reads the error response resp and closes its body.
+func readAPIError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+	e := &APIError{Status: resp.StatusCode}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.retryAfter = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(resp.Header.Get("Retry-After")); err == nil {
+		e.retryAfter = time.Until(at)
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	var body struct {
+		Error struct {
+			Code      string `json:"code"`
+			Message   string `json:"message"`
+			Condition *struct {
+				Index    int    `json:"index"`
+				Key      string `json:"key"`
+				Found    bool   `json:"found"`
+				Value    string `json:"value"`
+				Revision uint64 `json:"revision"`
+			} `json:"condition"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &body) != nil || body.Error.Code == "" {
+		e.Message = strings.TrimSpace(string(data))
+		return e
+	}
+	e.Code, e.Message = body.Error.Code, body.Error.Message
+	if c := body.Error.Condition; c != nil {
+		e.cause = &store.ConditionFailedError{
+			Index:     c.Index,
+			Condition: store.Condition{Key: c.Key},
+			Found:     c.Found,
+			Value:     c.Value,
+			Revision:  c.Revision,
+		}
+	}
+	return e
+}
+
+// retryAfterOf returns the Retry-After of err, if it is an *APIError.
+func retryAfterOf(err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.retryAfter
+	}
+	return 0
+}
+
+// sleep waits for d or until ctx is done, returning its error then.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// keyPath returns the API path of key.
+func keyPath(key string) string {
+	return "/api/v1/keys/" + url.PathEscape(key)
+}
+
+// millis returns d in milliseconds, rounded up.
+func millis(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
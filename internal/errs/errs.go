@@ -0,0 +1,202 @@
+// Package errs defines the canonical error taxonomy shared by every surface of the store
+// and maps it to HTTP statuses, gRPC codes and CLI exit codes.
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/client"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// Kind is a canonical error category.
+type Kind int
+
+// Error kinds. Adding a kind requires an entry in every mapping table.
+const (
+	Internal Kind = iota
+	NotFound
+	Conflict
+	InvalidArgument
+	Unauthorized
+	Forbidden
+	ResourceExhausted
+	Unavailable
+)
+
+// kindNames names every kind; it also serves as the list of kinds.
+var kindNames = map[Kind]string{
+	Internal:          "internal",
+	NotFound:          "not_found",
+	Conflict:          "conflict",
+	InvalidArgument:   "invalid_argument",
+	Unauthorized:      "unauthorized",
+	Forbidden:         "forbidden",
+	ResourceExhausted: "resource_exhausted",
+	Unavailable:       "unavailable",
+}
+
+// httpStatuses maps kinds to HTTP status codes.
+var httpStatuses = map[Kind]int{
+	Internal:          http.StatusInternalServerError,
+	NotFound:          http.StatusNotFound,
+	Conflict:          http.StatusConflict,
+	InvalidArgument:   http.StatusBadRequest,
+	Unauthorized:      http.StatusUnauthorized,
+	Forbidden:         http.StatusForbidden,
+	ResourceExhausted: http.StatusTooManyRequests,
+	Unavailable:       http.StatusServiceUnavailable,
+}
+
+// grpcCodes maps kinds to gRPC status codes, using the numeric values of google.golang.org/grpc/codes.
+var grpcCodes = map[Kind]int{
+	Internal:          13,
+	NotFound:          5,
+	Conflict:          10, // Aborted
+	InvalidArgument:   3,
+	Unauthorized:      16, // Unauthenticated
+	Forbidden:         7,  // PermissionDenied
+	ResourceExhausted: 8,
+	Unavailable:       14,
+}
+
+// exitCodes maps kinds to CLI exit codes. 1 is reserved for commands reporting a negative result.
+var exitCodes = map[Kind]int{
+	Internal:          2,
+	NotFound:          3,
+	Conflict:          4,
+	InvalidArgument:   2,
+	Unauthorized:      5,
+	Forbidden:         6,
+	ResourceExhausted: 7,
+	Unavailable:       8,
+}
+
+// Kinds returns every error kind.
+func Kinds() []Kind {
+	kinds := make([]Kind, 0, len(kindNames))
+	for kind := Internal; int(kind) < len(kindNames); kind++ {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// Error is an error classified into a kind.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+// Error returns the message of the wrapped error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap classifies err as kind. It returns nil if err is nil.
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Errorf formats an error of the given kind.
+func Errorf(kind Kind, format string, args ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// KindOf returns the kind of err: the kind it was wrapped with, else the kind of the known store
+// or system error it wraps, else Internal.
+func KindOf(err error) Kind {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e.Kind
+	case errors.Is(err, store.ErrKeyNotFound), errors.Is(err, store.ErrVersionNotFound),
+		errors.Is(err, store.ErrKeyExpired), errors.Is(err, store.ErrListingExpired), errors.Is(err, store.ErrEventsTruncated),
+		errors.Is(err, store.ErrJobNotFound),
+		errors.Is(err, os.ErrNotExist):
+		return NotFound
+	case errors.Is(err, store.ErrWrongEncryptionContext):
+		return Unauthorized
+	case errors.Is(err, store.ErrForbidden), errors.Is(err, os.ErrPermission):
+		return Forbidden
+	case errors.Is(err, store.ErrClientEncrypted), errors.Is(err, store.ErrEncryptionRequired),
+		errors.Is(err, store.ErrValueTooLarge), errors.Is(err, store.ErrWrongType),
+		errors.Is(err, store.ErrInvalidScore), errors.Is(err, store.ErrInvalidKeep),
+		errors.Is(err, store.ErrReservedKey), errors.Is(err, client.ErrNotClientEncrypted):
+		return InvalidArgument
+	case errors.Is(err, store.ErrUnencryptedData), errors.Is(err, store.ErrJobRunning),
+		errors.Is(err, store.ErrComputedKey), errors.Is(err, store.ErrBackupChain),
+		errors.Is(err, store.ErrDataFileInUse), errors.Is(err, store.ErrConditionFailed),
+		errors.Is(err, store.ErrImmutableKey), errors.Is(err, store.ErrNamespaceExists),
+		errors.Is(err, store.ErrTxnDone), errors.Is(err, store.ErrMigrationVerification):
+		return Conflict
+	case errors.Is(err, store.ErrMemoryPressure):
+		return ResourceExhausted
+	case errors.Is(err, store.ErrMaintenanceMode), errors.Is(err, store.ErrStaleReadsDisabled),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return Unavailable
+	default:
+		return Internal
+	}
+}
+
+// HTTPStatusFor returns the HTTP status of kind.
+func HTTPStatusFor(kind Kind) (int, bool) {
+	status, ok := httpStatuses[kind]
+	return status, ok
+}
+
+// GRPCCodeFor returns the gRPC code of kind.
+func GRPCCodeFor(kind Kind) (int, bool) {
+	code, ok := grpcCodes[kind]
+	return code, ok
+}
+
+// ExitCodeFor returns the CLI exit code of kind.
+func ExitCodeFor(kind Kind) (int, bool) {
+	code, ok := exitCodes[kind]
+	return code, ok
+}
+
+// HTTPStatus returns the HTTP status for err, or 200 if err is nil.
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return httpStatuses[KindOf(err)]
+}
+
+// GRPCCode returns the gRPC code for err, or 0 (OK) if err is nil.
+func GRPCCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return grpcCodes[KindOf(err)]
+}
+
+// ExitCode returns the CLI exit code for err, or 0 if err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	return exitCodes[KindOf(err)]
+}
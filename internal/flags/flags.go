@@ -0,0 +1,313 @@
+// Package flags evaluates feature flags kept as JSON documents in a store, with percentage rollouts and
+// attribute rules, caching the documents until the store reports a change to them.
+package flags
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// defaultCacheTTL bounds how long an evaluator trusts a cached flag, in case a change notification was dropped.
+const defaultCacheTTL = time.Minute
+
+// subscriptionBuffer is the notification queue of an evaluator's subscription.
+const subscriptionBuffer = 1024
+
+// MalformedEvent prefixes the notification sent, followed by the flag key, when a flag document is malformed.
+const MalformedEvent = "flag_malformed:"
+
+// ErrMalformedFlag is returned when a flag document does not follow the Flag schema. The flag evaluates to false.
+var ErrMalformedFlag = errors.New("malformed flag")
+
+// Operators of a Rule.
+const (
+	OpIn     = "in"     // The attribute is one of Values
+	OpNotIn  = "not_in" // The attribute is missing or none of Values
+	OpPrefix = "prefix" // The attribute starts with one of Values
+)
+
+// Flag is the JSON document stored under a flag's key, such as
+//
+//	{"enabled": true, "percentage": 25, "rules": [{"attribute": "country", "operator": "in", "values": ["FR", "DE"]}]}
+//
+// A subject gets the flag when it is enabled, the subject matches every rule and its bucket falls within
+// the percentage. Unknown fields make the document malformed, so misspelled settings are not ignored.
+type Flag struct {
+	Enabled    bool     `json:"enabled"`
+	Percentage *float64 `json:"percentage,omitempty"` // Share of subjects from 0 to 100, bucketed by ID; all if omitted
+	Rules      []Rule   `json:"rules,omitempty"`
+}
+
+// Rule matches an attribute of the subject.
+type Rule struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"` // OpIn, OpNotIn or OpPrefix
+	Values    []string `json:"values"`
+}
+
+// Subject is what a flag is evaluated for.
+type Subject struct {
+	ID         string // Stable identifier, such as a user ID, that percentage rollouts bucket by
+	Attributes map[string]string
+}
+
+// Parse decodes and validates a flag document.
+func Parse(document string) (Flag, error) {
+	var flag Flag
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&flag); err != nil {
+		return Flag{}, fmt.Errorf("%w: %v", ErrMalformedFlag, err)
+	}
+	if decoder.More() {
+		return Flag{}, fmt.Errorf("%w: trailing data after the document", ErrMalformedFlag)
+	}
+	if p := flag.Percentage; p != nil && (*p < 0 || *p > 100) {
+		return Flag{}, fmt.Errorf("%w: percentage %v is not between 0 and 100", ErrMalformedFlag, *p)
+	}
+	for i, rule := range flag.Rules {
+		if rule.Attribute == "" {
+			return Flag{}, fmt.Errorf("%w: rule %d has no attribute", ErrMalformedFlag, i)
+		}
+		switch rule.Operator {
+		case OpIn, OpNotIn, OpPrefix:
+		default:
+			return Flag{}, fmt.Errorf("%w: rule %d has unknown operator %q", ErrMalformedFlag, i, rule.Operator)
+		}
+	}
+	return flag, nil
+}
+
+// Bucket returns the position, from 0 up to 100, of a subject in the rollout of a flag. It depends only on
+// the flag key and subject ID, so a subject keeps its bucket as the percentage grows, and different flags
+// roll out to different subjects.
+func Bucket(flagKey, subjectID string) float64 {
+	sum := sha256.Sum256([]byte(flagKey + "\x00" + subjectID))
+	return float64(binary.BigEndian.Uint64(sum[:8])%10000) / 100
+}
+
+// Evaluate reports whether the flag stored under flagKey is on for subject.
+func (f Flag) Evaluate(flagKey string, subject Subject) bool {
+	if !f.Enabled {
+		return false
+	}
+	for _, rule := range f.Rules {
+		if !rule.matches(subject) {
+			return false
+		}
+	}
+	if f.Percentage == nil || *f.Percentage >= 100 {
+		return true
+	}
+	// Without an ID a subject cannot keep its bucket, so it stays out of partial rollouts.
+	return subject.ID != "" && Bucket(flagKey, subject.ID) < *f.Percentage
+}
+
+// matches reports whether subject satisfies the rule.
+func (r Rule) matches(subject Subject) bool {
+	value, present := subject.Attributes[r.Attribute]
+	switch r.Operator {
+	case OpIn:
+		return present && contains(r.Values, value)
+	case OpNotIn:
+		return !present || !contains(r.Values, value)
+	case OpPrefix:
+		for _, prefix := range r.Values {
+			if present && strings.HasPrefix(value, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contains reports whether values holds value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is the part of the store API an Evaluator uses.
+type Store interface {
+	Get(key string) (string, error)
+	Subscribe(filter string, buffer int, listener func(string)) int
+	Unsubscribe(id int) bool
+	Notify(event string)
+}
+
+var _ Store = (*store.KeyValueStore)(nil)
+
+// Option configures an Evaluator.
+type Option func(*Evaluator)
+
+// WithCacheTTL sets how long a cached flag is trusted without a change notification (one minute by default).
+// Zero disables caching.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(e *Evaluator) {
+		e.ttl = ttl
+	}
+}
+
+// Stats counts the evaluations of an Evaluator.
+type Stats struct {
+	Hits          int // Evaluations answered from the cache
+	Misses        int // Evaluations reading the flag from the store
+	Invalidations int // Cached flags dropped after a change notification
+	Malformed     int // Flag documents found malformed
+}
+
+// cachedFlag is a flag document as read from the store.
+type cachedFlag struct {
+	flag    Flag
+	err     error // Set for malformed documents
+	missing bool
+	read    time.Time
+}
+
+// Evaluator evaluates flags, caching each document until the store reports a change to its key.
+type Evaluator struct {
+	store        Store
+	ttl          time.Duration
+	subscription int
+
+	mu         sync.Mutex
+	cache      map[string]cachedFlag
+	generation uint64 // Incremented by every invalidation, so reads racing one are not cached
+	stats      Stats
+}
+
+// NewEvaluator returns an evaluator of the flags in s, subscribed to its change notifications until Close.
+func NewEvaluator(s Store, opts ...Option) *Evaluator {
+	e := &Evaluator{store: s, ttl: defaultCacheTTL, cache: make(map[string]cachedFlag)}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.subscription = s.Subscribe("", subscriptionBuffer, e.invalidate)
+	return e
+}
+
+// Close stops the evaluator's subscription. Later evaluations read the store every time.
+func (e *Evaluator) Close() {
+	e.store.Unsubscribe(e.subscription)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ttl = 0
+	e.cache = make(map[string]cachedFlag)
+}
+
+// Evaluate reports whether the flag stored under flagKey is on for subject. A missing flag is off. A
+// malformed flag is off too, with an error wrapping ErrMalformedFlag; the result is false whenever the
+// error is not nil.
+func (e *Evaluator) Evaluate(flagKey string, subject Subject) (bool, error) {
+	cached, err := e.lookup(flagKey)
+	if err != nil || cached.missing {
+		return false, err
+	}
+	if cached.err != nil {
+		return false, cached.err
+	}
+	return cached.flag.Evaluate(flagKey, subject), nil
+}
+
+// lookup returns the flag document under flagKey from the cache, reading it from the store on a miss.
+func (e *Evaluator) lookup(flagKey string) (cachedFlag, error) {
+	e.mu.Lock()
+	if cached, ok := e.cache[flagKey]; ok && time.Since(cached.read) < e.ttl {
+		e.stats.Hits++
+		e.mu.Unlock()
+		return cached, nil
+	}
+	e.stats.Misses++
+	generation := e.generation
+	e.mu.Unlock()
+
+	cached := cachedFlag{read: time.Now()}
+	document, err := e.store.Get(flagKey)
+	switch {
+	case errors.Is(err, store.ErrKeyNotFound):
+		cached.missing = true
+	case err != nil:
+		return cachedFlag{}, fmt.Errorf("error reading flag '%s': %w", flagKey, err)
+	default:
+		if cached.flag, err = Parse(document); err != nil {
+			cached.err = fmt.Errorf("flag '%s': %w", flagKey, err)
+		}
+	}
+
+	e.mu.Lock()
+	if cached.err != nil {
+		e.stats.Malformed++
+	}
+	if e.ttl > 0 && e.generation == generation {
+		e.cache[flagKey] = cached
+	}
+	e.mu.Unlock()
+
+	if cached.err != nil {
+		log.Printf("Evaluate: %v\n", cached.err)
+		e.store.Notify(MalformedEvent + flagKey)
+	}
+	return cached, nil
+}
+
+// invalidate drops the cached flag a key change notification is about. Notifications replacing the store
+// contents, such as a restored backup, and the "bulk:" summaries standing in for the key notifications of
+// a bulk operation drop every cached flag; others are ignored.
+func (e *Evaluator) invalidate(event string) {
+	eventType, rest, _ := strings.Cut(event, ":")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch eventType {
+	case "added", "updated", "deleted", "expired":
+		if i := strings.LastIndexByte(rest, '@'); i >= 0 {
+			rest = rest[:i]
+		}
+		e.generation++
+		if _, ok := e.cache[rest]; ok {
+			delete(e.cache, rest)
+			e.stats.Invalidations++
+		}
+	case "backup_restored", "load_repaired", "bulk":
+		e.generation++
+		e.stats.Invalidations += len(e.cache)
+		e.cache = make(map[string]cachedFlag)
+	}
+}
+
+// Stats returns the evaluation counts.
+func (e *Evaluator) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+var (
+	sharedMu   sync.Mutex
+	evaluators = make(map[Store]*Evaluator)
+)
+
+// Evaluate reports whether the flag stored in s under flagKey is on for subject, using an evaluator shared
+// by every caller evaluating flags in s. The evaluator is created on first use and lives as long as the process.
+func Evaluate(s Store, flagKey string, subject Subject) (bool, error) {
+	sharedMu.Lock()
+	e, ok := evaluators[s]
+	if !ok {
+		e = NewEvaluator(s)
+		evaluators[s] = e
+	}
+	sharedMu.Unlock()
+	return e.Evaluate(flagKey, subject)
+}
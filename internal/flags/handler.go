@@ -0,0 +1,62 @@
+package flags
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+)
+
+// EvaluatePattern is the route Handler serves. Query parameters other than subject_id are the subject's
+// attributes.
+const EvaluatePattern = "GET /api/v1/flags/{key}/evaluate"
+
+// evaluation is the response body of Handler.
+type evaluation struct {
+	Key       string `json:"key"`
+	SubjectID string `json:"subject_id"`
+	Enabled   bool   `json:"enabled"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Handler returns an HTTP handler evaluating flags with e for clients not written in Go, serving
+// EvaluatePattern. A malformed flag is reported as off with its error; other errors get the status of their kind.
+func Handler(e *Evaluator) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(EvaluatePattern, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		result := evaluation{Key: r.PathValue("key"), SubjectID: query.Get("subject_id")}
+		if result.SubjectID == "" {
+			status, _ := errs.HTTPStatusFor(errs.InvalidArgument)
+			writeEvaluation(w, status, evaluation{Key: result.Key, Error: "subject_id is required"})
+			return
+		}
+
+		subject := Subject{ID: result.SubjectID, Attributes: make(map[string]string)}
+		for name, values := range query {
+			if name != "subject_id" && len(values) > 0 {
+				subject.Attributes[name] = values[0]
+			}
+		}
+
+		enabled, err := e.Evaluate(result.Key, subject)
+		result.Enabled = enabled
+		status := http.StatusOK
+		if err != nil {
+			result.Error = err.Error()
+			if !errors.Is(err, ErrMalformedFlag) {
+				status, _ = errs.HTTPStatusFor(errs.KindOf(err))
+			}
+		}
+		writeEvaluation(w, status, result)
+	})
+	return mux
+}
+
+// writeEvaluation writes result as the JSON response.
+func writeEvaluation(w http.ResponseWriter, status int, result evaluation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,216 @@
+// Package grpc serves the keys of a KeyValueStore over gRPC, with the KeyValue service defined in
+// proto/minikeyvalue/v1/kv.proto, so typed clients can be generated for other languages and key events
+// can be streamed.
+package grpc
+
+//go:generate buf generate
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/grpc/kvpb"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// APIKeyMetadata is the metadata key carrying the API key, see WithAPIKeys.
+const APIKeyMetadata = "x-api-key"
+
+// poll is how often an idle Watch stream reads the event log without being woken, which picks up the
+// events of bulk operations, as they send a single summary notification.
+const poll = 15 * time.Second
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithAPIKeys requires every call to carry one of keys, mapped to the principal it authenticates, in the
+// APIKeyMetadata metadata; other calls fail with Unauthenticated. The principal is put in the call's
+// context for the store's Authorizer. Without it, calls are not authenticated.
+func WithAPIKeys(keys map[string]string) Option {
+	return func(s *Server) {
+		s.apiKeys = keys
+	}
+}
+
+// Server implements the KeyValue service for a store. Every call uses its context, so the store's
+// Authorizer sees the principal; Watch is authenticated but not authorized per key.
+type Server struct {
+	kvpb.UnimplementedKeyValueServer
+	kv      *store.KeyValueStore
+	apiKeys map[string]string
+}
+
+// NewServer returns the KeyValue service of kv.
+func NewServer(kv *store.KeyValueStore, opts ...Option) *Server {
+	s := &Server{kv: kv}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register adds the KeyValue service of kv to server.
+func Register(server *grpc.Server, kv *store.KeyValueStore, opts ...Option) {
+	kvpb.RegisterKeyValueServer(server, NewServer(kv, opts...))
+}
+
+// Get returns the latest value of a key and its remaining TTL.
+func (s *Server) Get(ctx context.Context, req *kvpb.GetRequest) (*kvpb.GetResponse, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	value, remaining, err := s.kv.GetWithTTLContext(ctx, req.GetKey())
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	resp := &kvpb.GetResponse{Value: value}
+	if remaining != store.NoExpiration {
+		resp.TtlMs = (remaining + time.Millisecond - 1).Milliseconds()
+	}
+	return resp, nil
+}
+
+// Set sets a key.
+func (s *Server) Set(ctx context.Context, req *kvpb.SetRequest) (*kvpb.SetResponse, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := ttlOf(req.GetTtlMs())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.kv.SetContext(ctx, req.GetKey(), req.GetValue(), ttl); err != nil {
+		return nil, statusOf(err)
+	}
+	return &kvpb.SetResponse{}, nil
+}
+
+// Delete removes a key.
+func (s *Server) Delete(ctx context.Context, req *kvpb.DeleteRequest) (*kvpb.DeleteResponse, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.kv.DeleteContext(ctx, req.GetKey()); err != nil {
+		return nil, statusOf(err)
+	}
+	return &kvpb.DeleteResponse{}, nil
+}
+
+// CompareAndSwap sets a key to the new value if its latest value is the old one.
+func (s *Server) CompareAndSwap(ctx context.Context, req *kvpb.CompareAndSwapRequest) (*kvpb.CompareAndSwapResponse, error) {
+	ctx, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := ttlOf(req.GetTtlMs())
+	if err != nil {
+		return nil, err
+	}
+	swapped, err := s.kv.CompareAndSwapContext(ctx, req.GetKey(), req.GetOldValue(), req.GetNewValue(), ttl)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &kvpb.CompareAndSwapResponse{Swapped: swapped}, nil
+}
+
+// Watch streams the events of the keys starting with the prefix after the requested sequence number,
+// from the event log, until the client goes away.
+func (s *Server) Watch(req *kvpb.WatchRequest, stream kvpb.KeyValue_WatchServer) error {
+	ctx, err := s.authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	prefix := req.GetPrefix()
+
+	// Subscribe before reading the sequence number, so no event falls in between.
+	wake := make(chan struct{}, 1)
+	id := s.kv.SubscribeFiltered(store.EventFilter{Include: []string{prefix}}, 1, func(string) {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+	defer s.kv.Unsubscribe(id)
+
+	last := s.kv.LastSequence()
+	if req.GetSince() > 0 {
+		last = req.GetSince()
+	}
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		events, err := s.kv.EventsSince(last)
+		if err != nil {
+			return statusOf(err)
+		}
+		for _, e := range events {
+			last = e.Seq
+			if !strings.HasPrefix(e.Key, prefix) {
+				continue
+			}
+			event := &kvpb.Event{Seq: e.Seq, Type: e.Type, Key: e.Key, Time: timestamppb.New(e.Time)}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// authenticate returns ctx with the principal of the call's API key, if the server requires one.
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	if s.apiKeys == nil {
+		return ctx, nil
+	}
+	var key string
+	if values := metadata.ValueFromIncomingContext(ctx, APIKeyMetadata); len(values) > 0 {
+		key = values[0]
+	}
+	// Every known key is compared in constant time, so the time taken does not tell how close key is to one.
+	principal, found := "", false
+	for known, p := range s.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(known)) == 1 {
+			principal, found = p, true
+		}
+	}
+	if !found || key == "" {
+		return nil, statusOf(errs.Errorf(errs.Unauthorized, "missing or unknown API key"))
+	}
+	return store.WithPrincipal(ctx, principal), nil
+}
+
+// ttlOf converts a TTL in milliseconds from a request.
+func ttlOf(millis int64) (time.Duration, error) {
+	if millis < 0 {
+		return 0, statusOf(errs.Errorf(errs.InvalidArgument, "invalid ttl_ms %d", millis))
+	}
+	return time.Duration(millis) * time.Millisecond, nil
+}
+
+// statusOf returns err as a gRPC status with the code of its kind. A canceled call keeps its own status.
+func statusOf(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Code(errs.GRPCCode(err)), err.Error())
+}
@@ -0,0 +1,162 @@
+// Package kvtest provides a builder for seeded KeyValueStore instances in tests.
+package kvtest
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// Builder configures and seeds a KeyValueStore for a test.
+type Builder struct {
+	t              testing.TB
+	filePath       string
+	encryptionKey  []byte
+	globalTTL      time.Duration
+	tickerInterval time.Duration
+	histories      map[string][]string
+	ttls           map[string]time.Duration
+}
+
+// Store is a seeded KeyValueStore bound to the test that built it.
+type Store struct {
+	*store.KeyValueStore
+	t              testing.TB
+	tickerInterval time.Duration
+}
+
+// New creates a new Builder backed by a file in the test's temporary directory.
+func New(t testing.TB) *Builder {
+	t.Helper()
+	return &Builder{
+		t:              t,
+		filePath:       filepath.Join(t.TempDir(), "store.json"),
+		encryptionKey:  []byte("0123456789abcdef0123456789abcdef"),
+		tickerInterval: 1 * time.Second,
+		histories:      make(map[string][]string),
+		ttls:           make(map[string]time.Duration),
+	}
+}
+
+// WithFile sets the path of the persistence file.
+func (b *Builder) WithFile(filePath string) *Builder {
+	b.filePath = filePath
+	return b
+}
+
+// WithEncryptionKey sets the encryption key used by the store.
+func (b *Builder) WithEncryptionKey(key []byte) *Builder {
+	b.encryptionKey = key
+	return b
+}
+
+// WithGlobalTTL sets the global TTL applied to keys set without an explicit TTL.
+func (b *Builder) WithGlobalTTL(ttl time.Duration) *Builder {
+	b.globalTTL = ttl
+	return b
+}
+
+// WithTickerInterval sets the interval of the background cleanup.
+func (b *Builder) WithTickerInterval(interval time.Duration) *Builder {
+	b.tickerInterval = interval
+	return b
+}
+
+// WithKeys seeds the given keys with a single version each.
+func (b *Builder) WithKeys(keys map[string]string) *Builder {
+	for key, value := range keys {
+		b.histories[key] = append(b.histories[key], value)
+	}
+	return b
+}
+
+// WithHistory seeds a key with the given versions, oldest first.
+func (b *Builder) WithHistory(key string, values ...string) *Builder {
+	b.histories[key] = append(b.histories[key], values...)
+	return b
+}
+
+// WithTTL applies a TTL to a seeded key. The TTL is set along with the key's latest version.
+func (b *Builder) WithTTL(key string, ttl time.Duration) *Builder {
+	b.ttls[key] = ttl
+	return b
+}
+
+// Build creates the store, seeds it and registers its cleanup with the test.
+func (b *Builder) Build() *Store {
+	b.t.Helper()
+
+	kv := store.NewKeyValueStore(b.filePath, b.encryptionKey, b.globalTTL, b.tickerInterval)
+	s := &Store{KeyValueStore: kv, t: b.t, tickerInterval: b.tickerInterval}
+	b.t.Cleanup(kv.Stop)
+
+	for key := range b.ttls {
+		if _, ok := b.histories[key]; !ok {
+			b.t.Fatalf("kvtest: TTL configured for key %q without any value", key)
+		}
+	}
+
+	keys := make([]string, 0, len(b.histories))
+	for key := range b.histories {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values := b.histories[key]
+		for i, value := range values {
+			var ttl time.Duration
+			if i == len(values)-1 {
+				ttl = b.ttls[key]
+			}
+			if err := kv.Set(key, value, ttl); err != nil {
+				b.t.Fatalf("kvtest: failed to seed key %q: %v", key, err)
+			}
+		}
+	}
+
+	return s
+}
+
+// MustGet returns the latest value of key and fails the test if it cannot be read.
+func (s *Store) MustGet(key string) string {
+	s.t.Helper()
+	value, err := s.Get(key)
+	if err != nil {
+		s.t.Fatalf("kvtest: failed to get key %q: %v", key, err)
+	}
+	return value
+}
+
+// MustSet sets key to value and fails the test on error.
+func (s *Store) MustSet(key, value string, ttl time.Duration) {
+	s.t.Helper()
+	if err := s.Set(key, value, ttl); err != nil {
+		s.t.Fatalf("kvtest: failed to set key %q: %v", key, err)
+	}
+}
+
+// AssertValue fails the test if the latest value of key is not expected.
+func (s *Store) AssertValue(key, expected string) {
+	s.t.Helper()
+	if value := s.MustGet(key); value != expected {
+		s.t.Errorf("kvtest: expected key %q to be %q, got %q", key, expected, value)
+	}
+}
+
+// AssertKeyAbsent fails the test if key can still be read.
+func (s *Store) AssertKeyAbsent(key string) {
+	s.t.Helper()
+	if value, err := s.Get(key); err == nil {
+		s.t.Errorf("kvtest: expected key %q to be absent, got %q", key, value)
+	}
+}
+
+// AdvanceAndSweep lets d elapse plus one cleanup interval so keys expiring within d have been swept.
+// The store runs on the real clock, so this sleeps.
+func (s *Store) AdvanceAndSweep(d time.Duration) {
+	time.Sleep(d + s.tickerInterval)
+}
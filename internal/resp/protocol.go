@@ -0,0 +1,114 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// protocolError is a malformed request. It is reported to the client before the connection is closed.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// readCommand reads a request: an array of bulk strings as sent by client libraries, or an inline command
+// of space-separated words as typed into telnet. A blank inline line is an empty command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r, maxInline)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+	args := make([]string, 0, max(n, 0))
+	for i := 0; i < n; i++ {
+		header, err := readLine(r, maxInline)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(header, "$") {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%.1s'", header))
+		}
+		size, err := strconv.Atoi(header[1:])
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, protocolError("bulk string not terminated by CRLF")
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line ending in CRLF or LF, without the line ending.
+func readLine(r *bufio.Reader, limit int) (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > limit {
+			return "", protocolError("too big request")
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// writer writes RESP2 replies.
+type writer struct {
+	*bufio.Writer
+}
+
+// status writes a simple string reply.
+func (w *writer) status(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+// error writes an error reply. Line breaks would end the reply early, so they are replaced.
+func (w *writer) error(message string) {
+	w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(message) + "\r\n")
+}
+
+// storeError writes a store error as an error reply.
+func (w *writer) storeError(err error) {
+	w.error("ERR " + err.Error())
+}
+
+// integer writes an integer reply.
+func (w *writer) integer(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+// bulk writes a bulk string reply, which may hold any bytes.
+func (w *writer) bulk(s string) {
+	w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+// null writes a null bulk string reply.
+func (w *writer) null() {
+	w.WriteString("$-1\r\n")
+}
+
+// array writes the header of an array reply of n elements, which the caller writes next.
+func (w *writer) array(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
@@ -0,0 +1,374 @@
+// Package resp serves a KeyValueStore over the Redis wire protocol (RESP2), so redis-cli and Redis client
+// libraries can read and write keys.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+	"github.com/Chahine-tech/minikeyvalue/internal/ttl"
+)
+
+// Limits on requests, matching the defaults of Redis.
+const (
+	maxArgs     = 1024 * 1024
+	maxBulkSize = 512 * 1024 * 1024
+	maxInline   = 64 * 1024
+)
+
+// errQuit ends a connection after the reply to QUIT is written.
+var errQuit = errors.New("quit")
+
+// handler runs a command on its arguments, excluding the command name.
+type handler func(s *Server, w *writer, args []string) error
+
+// commands lists the supported commands by lower-case name with their arity as Redis counts it, including
+// the command name: the exact number of words if positive, or the minimum if negative.
+var commands map[string]struct {
+	arity int
+	run   handler
+}
+
+func init() {
+	commands = map[string]struct {
+		arity int
+		run   handler
+	}{
+		"get":     {2, (*Server).get},
+		"set":     {-3, (*Server).set},
+		"del":     {-2, (*Server).del},
+		"ttl":     {2, (*Server).ttl},
+		"expire":  {3, (*Server).expire},
+		"persist": {2, (*Server).persist},
+		"keys":    {2, (*Server).keys},
+		"ping":    {-1, (*Server).ping},
+		"echo":    {2, (*Server).echo},
+		"quit":    {1, (*Server).quit},
+	}
+}
+
+// Server accepts RESP connections and runs their commands against a store.
+type Server struct {
+	kv *store.KeyValueStore
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewServer creates a server for kv.
+func NewServer(kv *store.KeyValueStore) *Server {
+	return &Server{kv: kv, listeners: make(map[net.Listener]struct{}), conns: make(map[net.Conn]struct{})}
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections until Close.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %v", addr, err)
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until Close, handling each on its own goroutine. It returns nil once the
+// server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	log.Printf("Serve: Listening for RESP connections on %s\n", l.Addr())
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return fmt.Errorf("error accepting connection: %v", err)
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// Close stops the listeners, closes every connection and waits for their commands to finish.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// handle runs the commands read from conn until it is closed or sends QUIT.
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := &writer{bufio.NewWriter(conn)}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			var protoErr protocolError
+			if errors.As(err, &protoErr) {
+				// The stream cannot be resynchronized after a malformed request.
+				w.error("ERR Protocol error: " + protoErr.Error())
+				w.Flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("handle: Error reading from %s: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		err = s.exec(w, args)
+		// Replies to pipelined commands are flushed together.
+		if err == errQuit || r.Buffered() == 0 {
+			if flushErr := w.Flush(); flushErr != nil {
+				return
+			}
+		}
+		if err == errQuit {
+			return
+		}
+	}
+}
+
+// exec runs a command and writes its reply.
+func (s *Server) exec(w *writer, args []string) error {
+	name := strings.ToLower(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return nil
+	}
+	if n := len(args); (cmd.arity > 0 && n != cmd.arity) || (cmd.arity < 0 && n < -cmd.arity) {
+		w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return nil
+	}
+	return cmd.run(s, w, args[1:])
+}
+
+// get replies with the value of a key, or null if it is missing or expired.
+func (s *Server) get(w *writer, args []string) error {
+	value, err := s.kv.Get(args[0])
+	if errors.Is(err, store.ErrKeyNotFound) || errors.Is(err, store.ErrKeyExpired) {
+		w.null()
+		return nil
+	}
+	if err != nil {
+		w.storeError(err)
+		return nil
+	}
+	w.bulk(value)
+	return nil
+}
+
+// set sets a key, with the options EX seconds, PX milliseconds and NX to only create it, as SetNX does. With NX the reply
+// is null if the key exists.
+func (s *Server) set(w *writer, args []string) error {
+	key, value := args[0], args[1]
+	var expiration time.Duration
+	nx := false
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "NX":
+			nx = true
+		case (option == "EX" || option == "PX") && i+1 < len(args) && expiration == 0:
+			unit := time.Second
+			if option == "PX" {
+				unit = time.Millisecond
+			}
+			d, err := ttl.ParseCount(option, args[i+1], unit)
+			if err != nil || d <= 0 {
+				w.error("ERR invalid expire time in 'set' command")
+				return nil
+			}
+			expiration = d
+			i++
+		default:
+			w.error("ERR syntax error")
+			return nil
+		}
+	}
+
+	if nx {
+		set, err := s.kv.SetNX(key, value, expiration)
+		if err != nil {
+			w.storeError(err)
+			return nil
+		}
+		if !set {
+			w.null()
+			return nil
+		}
+		w.status("OK")
+		return nil
+	}
+	if err := s.kv.Set(key, value, expiration); err != nil {
+		w.storeError(err)
+		return nil
+	}
+	w.status("OK")
+	return nil
+}
+
+// del deletes keys and replies with how many existed.
+func (s *Server) del(w *writer, args []string) error {
+	deleted := 0
+	for _, key := range args {
+		err := s.kv.Delete(key)
+		if errors.Is(err, store.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			w.storeError(err)
+			return nil
+		}
+		deleted++
+	}
+	w.integer(int64(deleted))
+	return nil
+}
+
+// ttl replies with the seconds a key has left, -1 if it does not expire and -2 if it does not exist.
+func (s *Server) ttl(w *writer, args []string) error {
+	ttl, err := s.kv.TTL(args[0])
+	if errors.Is(err, store.ErrKeyNotFound) || errors.Is(err, store.ErrKeyExpired) {
+		w.integer(-2)
+		return nil
+	}
+	if err != nil {
+		w.storeError(err)
+		return nil
+	}
+	if ttl == store.NoExpiration {
+		w.integer(-1)
+		return nil
+	}
+	w.integer(int64((ttl + time.Second/2) / time.Second))
+	return nil
+}
+
+// expire sets the TTL of a key in seconds and replies 1, or 0 if the key does not exist. As in Redis, a TTL
+// that is not positive deletes the key.
+func (s *Server) expire(w *writer, args []string) error {
+	expiration, err := ttl.ParseCount("seconds", args[1], time.Second)
+	if err != nil {
+		w.error("ERR value is not an integer or out of range")
+		return nil
+	}
+	if expiration <= 0 {
+		return s.del(w, args[:1])
+	}
+	err = s.kv.Expire(args[0], expiration)
+	if errors.Is(err, store.ErrKeyNotFound) || errors.Is(err, store.ErrKeyExpired) {
+		w.integer(0)
+		return nil
+	}
+	if err != nil {
+		w.storeError(err)
+		return nil
+	}
+	w.integer(1)
+	return nil
+}
+
+// persist removes the TTL of a key and replies 1, or 0 if the key does not exist or has no TTL.
+func (s *Server) persist(w *writer, args []string) error {
+	removed, err := s.kv.Persist(args[0])
+	if errors.Is(err, store.ErrKeyNotFound) || errors.Is(err, store.ErrKeyExpired) {
+		w.integer(0)
+		return nil
+	}
+	if err != nil {
+		w.storeError(err)
+		return nil
+	}
+	if removed {
+		w.integer(1)
+	} else {
+		w.integer(0)
+	}
+	return nil
+}
+
+// keys replies with the keys matching a glob pattern.
+func (s *Server) keys(w *writer, args []string) error {
+	keys, err := s.kv.KeysMatching(args[0])
+	if err != nil {
+		w.storeError(err)
+		return nil
+	}
+	w.array(len(keys))
+	for _, key := range keys {
+		w.bulk(key)
+	}
+	return nil
+}
+
+// ping replies PONG, or echoes its argument.
+func (s *Server) ping(w *writer, args []string) error {
+	switch len(args) {
+	case 0:
+		w.status("PONG")
+	case 1:
+		w.bulk(args[0])
+	default:
+		w.error("ERR wrong number of arguments for 'ping' command")
+	}
+	return nil
+}
+
+// echo replies with its argument.
+func (s *Server) echo(w *writer, args []string) error {
+	w.bulk(args[0])
+	return nil
+}
+
+// quit replies OK and ends the connection.
+func (s *Server) quit(w *writer, _ []string) error {
+	w.status("OK")
+	return errQuit
+}
@@ -0,0 +1,407 @@
+// Package shell implements an interactive session for inspecting and editing a KeyValueStore.
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+	"github.com/Chahine-tech/minikeyvalue/internal/ttl"
+)
+
+// Prompt is printed before each command read in an interactive session.
+const Prompt = "mkv> "
+
+// Options configures a Session.
+type Options struct {
+	Script   bool // Read commands without prompting or paging, stopping at the first that fails
+	Yes      bool // Run dangerous commands without asking for confirmation
+	PageSize int  // Lines shown before pausing for the reader in an interactive session; zero disables paging
+}
+
+// command is a shell command. run receives the arguments split on spaces and the text after the command name.
+type command struct {
+	usage     string
+	help      string
+	dangerous bool
+	run       func(s *Session, args []string, rest string) error
+}
+
+// commands lists the shell commands by name. It is filled in by init, as help and usage errors refer to it.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get":            {usage: "get <key>", help: "print the latest value of a key", run: (*Session).get},
+		"set":            {usage: "set <key> <value...>", help: "set a key to the rest of the line", run: (*Session).set},
+		"setex":          {usage: "setex <key> <ttl> <value...>", help: "set a key that expires after ttl, such as 10m", run: (*Session).setex},
+		"del":            {usage: "del <key>", help: "delete a key", run: (*Session).del},
+		"keys":           {usage: "keys [prefix]", help: "list keys, optionally only those starting with prefix", run: (*Session).keys},
+		"search":         {usage: "search <text>", help: "list keys containing text", run: (*Session).search},
+		"history":        {usage: "history <key>", help: "print every version of a key with its timestamp", run: (*Session).history},
+		"ttl":            {usage: "ttl <key>", help: "print the remaining time to live of a key", run: (*Session).ttl},
+		"expire":         {usage: "expire <prefix> <ttl>", help: "expire keys starting with prefix after ttl", run: (*Session).expire},
+		"stats":          {usage: "stats", help: "print store statistics", run: (*Session).stats},
+		"clear":          {usage: "clear", help: "delete every key", dangerous: true, run: (*Session).clear},
+		"deletebyprefix": {usage: "deletebyprefix <prefix>", help: "delete keys starting with prefix", dangerous: true, run: (*Session).deleteByPrefix},
+		"help":           {usage: "help", help: "list commands", run: (*Session).help},
+	}
+}
+
+// Session runs shell commands against a store, reading them from one stream and writing results to another.
+type Session struct {
+	kv   *store.KeyValueStore
+	in   *bufio.Scanner
+	out  io.Writer
+	opts Options
+}
+
+// New creates a session on kv reading commands from in.
+func New(kv *store.KeyValueStore, in io.Reader, out io.Writer, opts Options) *Session {
+	return &Session{kv: kv, in: bufio.NewScanner(in), out: out, opts: opts}
+}
+
+// Run executes commands until the input ends or a quit command is read. In script mode it returns the
+// error of the first command that fails; otherwise errors are printed and the session goes on.
+// A line ending in a tab lists the completions of its last word instead of running it.
+func (s *Session) Run() error {
+	for {
+		if !s.opts.Script {
+			fmt.Fprint(s.out, Prompt)
+		}
+		line, ok := s.readLine()
+		if !ok {
+			return nil
+		}
+		if partial, found := strings.CutSuffix(line, "\t"); found {
+			fmt.Fprintln(s.out, strings.Join(s.Complete(partial), " "))
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if line == "quit" || line == "exit" {
+			return nil
+		}
+		if err := s.Exec(line); err != nil {
+			if s.opts.Script {
+				return fmt.Errorf("%s: %w", line, err)
+			}
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+	}
+}
+
+// readLine reads the next input line.
+func (s *Session) readLine() (string, bool) {
+	if !s.in.Scan() {
+		return "", false
+	}
+	return s.in.Text(), true
+}
+
+// Exec runs a single command line. Blank lines and lines starting with # do nothing.
+func (s *Session) Exec(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+	name, rest, _ := strings.Cut(line, " ")
+	cmd, ok := commands[name]
+	if !ok {
+		return errs.Errorf(errs.InvalidArgument, "unknown command '%s', try help", name)
+	}
+	rest = strings.TrimSpace(rest)
+	if cmd.dangerous && !s.confirm(line) {
+		if s.opts.Script {
+			return errs.Errorf(errs.InvalidArgument, "%s needs confirmation, pass -yes to run it from a script", name)
+		}
+		fmt.Fprintln(s.out, "aborted")
+		return nil
+	}
+	return cmd.run(s, strings.Fields(rest), rest)
+}
+
+// confirm asks whether to run a dangerous command line. Scripts cannot answer, so they only run such
+// commands with the Yes option.
+func (s *Session) confirm(line string) bool {
+	if s.opts.Yes {
+		return true
+	}
+	if s.opts.Script {
+		return false
+	}
+	fmt.Fprintf(s.out, "really run '%s'? [y/N] ", line)
+	answer, _ := s.readLine()
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// Complete returns the completions of the last word of a partial line: command names for the first
+// word and key names after it, in order.
+func (s *Session) Complete(partial string) []string {
+	fields := strings.Fields(partial)
+	word := ""
+	if len(fields) > 0 && !strings.HasSuffix(partial, " ") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+
+	var candidates []string
+	if len(fields) == 0 {
+		for name := range commands {
+			candidates = append(candidates, name)
+		}
+		candidates = append(candidates, "exit", "quit")
+	} else {
+		candidates = s.kv.Keys()
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// page prints lines, pausing after each page in an interactive session until the reader asks for more.
+func (s *Session) page(lines []string) {
+	for i, line := range lines {
+		if s.opts.PageSize > 0 && !s.opts.Script && i > 0 && i%s.opts.PageSize == 0 {
+			fmt.Fprintf(s.out, "-- %d more, Enter to continue, q to stop --", len(lines)-i)
+			answer, ok := s.readLine()
+			fmt.Fprintln(s.out)
+			if !ok || strings.TrimSpace(answer) == "q" {
+				return
+			}
+		}
+		fmt.Fprintln(s.out, line)
+	}
+}
+
+// usageError reports the usage of the named command.
+func usageError(name string) error {
+	return errs.Errorf(errs.InvalidArgument, "usage: %s", commands[name].usage)
+}
+
+// parseTTL parses a duration argument.
+func parseTTL(arg string) (time.Duration, error) {
+	d, err := ttl.Parse(ttl.Input{TTL: &arg}, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if d == 0 {
+		return 0, errs.Errorf(errs.InvalidArgument, "invalid ttl '%s', expected a positive duration such as 10m", arg)
+	}
+	return d, nil
+}
+
+// get prints the latest value of a key.
+func (s *Session) get(args []string, _ string) error {
+	if len(args) != 1 {
+		return usageError("get")
+	}
+	value, err := s.kv.Get(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, value)
+	return nil
+}
+
+// set sets a key to the rest of the line.
+func (s *Session) set(args []string, rest string) error {
+	if len(args) < 2 {
+		return usageError("set")
+	}
+	_, value, _ := strings.Cut(rest, " ")
+	if err := s.kv.Set(args[0], strings.TrimSpace(value), 0); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, "OK")
+	return nil
+}
+
+// setex sets a key with a TTL to the rest of the line.
+func (s *Session) setex(args []string, rest string) error {
+	if len(args) < 3 {
+		return usageError("setex")
+	}
+	ttl, err := parseTTL(args[1])
+	if err != nil {
+		return err
+	}
+	_, value, _ := strings.Cut(rest, " ")
+	_, value, _ = strings.Cut(strings.TrimSpace(value), " ")
+	if err := s.kv.Set(args[0], strings.TrimSpace(value), ttl); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, "OK")
+	return nil
+}
+
+// del deletes a key, failing if it does not exist.
+func (s *Session) del(args []string, _ string) error {
+	if len(args) != 1 {
+		return usageError("del")
+	}
+	if _, err := s.kv.Get(args[0]); err != nil {
+		return err
+	}
+	if err := s.kv.Delete(args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, "OK")
+	return nil
+}
+
+// keys lists keys starting with an optional prefix.
+func (s *Session) keys(args []string, _ string) error {
+	if len(args) > 1 {
+		return usageError("keys")
+	}
+	prefix := ""
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+	s.listKeys(func(key string) bool { return strings.HasPrefix(key, prefix) })
+	return nil
+}
+
+// search lists keys containing a substring.
+func (s *Session) search(args []string, _ string) error {
+	if len(args) != 1 {
+		return usageError("search")
+	}
+	s.listKeys(func(key string) bool { return strings.Contains(key, args[0]) })
+	return nil
+}
+
+// listKeys pages the keys accepted by match, in order.
+func (s *Session) listKeys(match func(key string) bool) {
+	var keys []string
+	for _, key := range s.kv.Keys() {
+		if match(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	s.page(keys)
+	fmt.Fprintf(s.out, "(%d keys)\n", len(keys))
+}
+
+// history prints every version of a key.
+func (s *Session) history(args []string, _ string) error {
+	if len(args) != 1 {
+		return usageError("history")
+	}
+	// Get loads the store, which reading versions does not.
+	if _, err := s.kv.Get(args[0]); err != nil {
+		return err
+	}
+	versions, err := s.kv.GetHistory(args[0])
+	if err != nil {
+		return err
+	}
+	lines := make([]string, len(versions))
+	for i, version := range versions {
+		lines[i] = fmt.Sprintf("%d\t%s\t%s", i, version.Timestamp.Format(time.RFC3339), version.Value)
+	}
+	s.page(lines)
+	return nil
+}
+
+// ttl prints the remaining TTL of a key.
+func (s *Session) ttl(args []string, _ string) error {
+	if len(args) != 1 {
+		return usageError("ttl")
+	}
+	_, ttl, err := s.kv.GetWithTTL(args[0])
+	if err != nil {
+		return err
+	}
+	if ttl == store.NoExpiration {
+		fmt.Fprintln(s.out, "no expiration")
+		return nil
+	}
+	fmt.Fprintln(s.out, ttl.Round(time.Second))
+	return nil
+}
+
+// expire sets a TTL on keys starting with a prefix.
+func (s *Session) expire(args []string, _ string) error {
+	if len(args) != 2 {
+		return usageError("expire")
+	}
+	ttl, err := parseTTL(args[1])
+	if err != nil {
+		return err
+	}
+	n, err := s.kv.ExpireByPrefix(args[0], ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "expiring %d keys in %v\n", n, ttl)
+	return nil
+}
+
+// stats prints store statistics.
+func (s *Session) stats(args []string, _ string) error {
+	if len(args) != 0 {
+		return usageError("stats")
+	}
+	status := s.kv.EncryptionStatus()
+	deltas := s.kv.DeltaStats()
+	fmt.Fprintf(s.out, "keys\t%d\n", s.kv.Size())
+	fmt.Fprintf(s.out, "sequence\t%d\n", s.kv.LastSequence())
+	fmt.Fprintf(s.out, "encrypted\t%t\n", status.Encrypted)
+	fmt.Fprintf(s.out, "delta versions\t%d\n", deltas.DeltaVersions)
+	fmt.Fprintf(s.out, "write amplification\t%.2f\n", s.kv.WriteAmplification().Factor)
+	return nil
+}
+
+// clear deletes every key.
+func (s *Session) clear(args []string, _ string) error {
+	if len(args) != 0 {
+		return usageError("clear")
+	}
+	n, err := s.kv.DeleteByPrefix("")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "deleted %d keys\n", n)
+	return nil
+}
+
+// deleteByPrefix deletes keys starting with a prefix.
+func (s *Session) deleteByPrefix(args []string, _ string) error {
+	if len(args) != 1 {
+		return usageError("deletebyprefix")
+	}
+	n, err := s.kv.DeleteByPrefix(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "deleted %d keys\n", n)
+	return nil
+}
+
+// help lists the commands with their usage.
+func (s *Session) help(_ []string, _ string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%-30s %s\n", commands[name].usage, commands[name].help)
+	}
+	fmt.Fprintf(s.out, "%-30s %s\n", "quit", "end the session")
+	return nil
+}
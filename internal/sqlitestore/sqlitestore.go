@@ -0,0 +1,258 @@
+// Package sqlitestore persists a KeyValueStore to a SQLite database whose tables can be queried with SQL.
+package sqlitestore
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+
+	_ "modernc.org/sqlite" // Registers the cgo-free "sqlite" driver
+)
+
+// timestampFormat is a fixed-width UTC format so timestamps sort correctly as text.
+const timestampFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+const schema = `
+CREATE TABLE IF NOT EXISTS keys (
+	id   INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+CREATE TABLE IF NOT EXISTS versions (
+	key_id    INTEGER NOT NULL REFERENCES keys(id),
+	seq       INTEGER NOT NULL,
+	value     TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	collapsed INTEGER NOT NULL DEFAULT 0,
+	encoding  TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (key_id, seq)
+);
+CREATE TABLE IF NOT EXISTS expirations (
+	key_id     INTEGER PRIMARY KEY REFERENCES keys(id),
+	expires_at TEXT NOT NULL
+);
+`
+
+// Persister stores keys, their version histories and expirations in SQLite tables.
+// Every mutation runs in its own transaction.
+type Persister struct {
+	db *sql.DB
+}
+
+var _ store.RecordPersister = (*Persister)(nil)
+
+// Open opens or creates the SQLite database at path.
+func Open(path string) (*Persister, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+	// SQLite allows a single writer; one connection avoids "database is locked" errors.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema: %v", err)
+	}
+	if err := addColumn(db, "versions", "encoding", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error upgrading schema: %v", err)
+	}
+	log.Printf("sqlitestore: Opened %s\n", path)
+	return &Persister{db: db}, nil
+}
+
+// addColumn adds a column to a table created by an earlier version of the schema, if it is missing.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf(`SELECT name FROM pragma_table_info('%s')`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// Close closes the database.
+func (p *Persister) Close() error {
+	return p.db.Close()
+}
+
+// LoadRecords reads every key with its versions, in order, and its expiration.
+func (p *Persister) LoadRecords() (map[string][]store.KeyValue, map[string]time.Time, error) {
+	data := make(map[string][]store.KeyValue)
+	expirations := make(map[string]time.Time)
+
+	rows, err := p.db.Query(`SELECT k.name, v.value, v.timestamp, v.collapsed, v.encoding
+		FROM keys k JOIN versions v ON v.key_id = k.id ORDER BY k.id, v.seq`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, timestamp string
+		var version store.KeyValue
+		if err := rows.Scan(&key, &version.Value, &timestamp, &version.Collapsed, &version.Encoding); err != nil {
+			return nil, nil, err
+		}
+		if version.Timestamp, err = time.Parse(timestampFormat, timestamp); err != nil {
+			return nil, nil, fmt.Errorf("invalid timestamp for key '%s': %v", key, err)
+		}
+		data[key] = append(data[key], version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = p.db.Query(`SELECT k.name, e.expires_at FROM keys k JOIN expirations e ON e.key_id = k.id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, expiresAt string
+		if err := rows.Scan(&key, &expiresAt); err != nil {
+			return nil, nil, err
+		}
+		t, err := time.Parse(timestampFormat, expiresAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid expiration for key '%s': %v", key, err)
+		}
+		if _, exists := data[key]; exists {
+			expirations[key] = t
+		}
+	}
+	return data, expirations, rows.Err()
+}
+
+// AppendVersion adds a version to key, creating the key if needed, and sets its expiration.
+func (p *Persister) AppendVersion(key string, version store.KeyValue, expiresAt time.Time) error {
+	return p.inTx(func(tx *sql.Tx) error {
+		keyID, err := keyIDFor(tx, key)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO versions (key_id, seq, value, timestamp, collapsed, encoding)
+			VALUES (?, (SELECT COALESCE(MAX(seq), -1) + 1 FROM versions WHERE key_id = ?), ?, ?, ?, ?)`,
+			keyID, keyID, version.Value, formatTime(version.Timestamp), version.Collapsed, version.Encoding); err != nil {
+			return err
+		}
+		return setExpiration(tx, keyID, expiresAt)
+	})
+}
+
+// ReplaceKey replaces the whole history and expiration of key.
+func (p *Persister) ReplaceKey(key string, versions []store.KeyValue, expiresAt time.Time) error {
+	return p.inTx(func(tx *sql.Tx) error {
+		return replaceKey(tx, key, versions, expiresAt)
+	})
+}
+
+// DeleteKey removes key with its history and expiration.
+func (p *Persister) DeleteKey(key string) error {
+	return p.inTx(func(tx *sql.Tx) error {
+		return deleteKey(tx, key)
+	})
+}
+
+// ReplaceAll replaces the database contents.
+func (p *Persister) ReplaceAll(data map[string][]store.KeyValue, expirations map[string]time.Time) error {
+	return p.inTx(func(tx *sql.Tx) error {
+		for _, table := range []string{"expirations", "versions", "keys"} {
+			if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+				return err
+			}
+		}
+		for key, versions := range data {
+			if err := replaceKey(tx, key, versions, expirations[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inTx runs fn in a transaction, committing if it succeeds.
+func (p *Persister) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// keyIDFor returns the id of key, inserting it if needed.
+func keyIDFor(tx *sql.Tx, key string) (int64, error) {
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO keys (name) VALUES (?)`, key); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM keys WHERE name = ?`, key).Scan(&id)
+	return id, err
+}
+
+// replaceKey writes versions as the full history of key.
+func replaceKey(tx *sql.Tx, key string, versions []store.KeyValue, expiresAt time.Time) error {
+	if err := deleteKey(tx, key); err != nil {
+		return err
+	}
+	keyID, err := keyIDFor(tx, key)
+	if err != nil {
+		return err
+	}
+	for seq, version := range versions {
+		if _, err := tx.Exec(`INSERT INTO versions (key_id, seq, value, timestamp, collapsed, encoding) VALUES (?, ?, ?, ?, ?, ?)`,
+			keyID, seq, version.Value, formatTime(version.Timestamp), version.Collapsed, version.Encoding); err != nil {
+			return err
+		}
+	}
+	return setExpiration(tx, keyID, expiresAt)
+}
+
+// deleteKey removes key and everything referencing it.
+func deleteKey(tx *sql.Tx, key string) error {
+	for _, stmt := range []string{
+		`DELETE FROM versions WHERE key_id IN (SELECT id FROM keys WHERE name = ?)`,
+		`DELETE FROM expirations WHERE key_id IN (SELECT id FROM keys WHERE name = ?)`,
+		`DELETE FROM keys WHERE name = ?`,
+	} {
+		if _, err := tx.Exec(stmt, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setExpiration stores the expiration of a key, or removes it if expiresAt is zero.
+func setExpiration(tx *sql.Tx, keyID int64, expiresAt time.Time) error {
+	if expiresAt.IsZero() {
+		_, err := tx.Exec(`DELETE FROM expirations WHERE key_id = ?`, keyID)
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO expirations (key_id, expires_at) VALUES (?, ?)
+		ON CONFLICT(key_id) DO UPDATE SET expires_at = excluded.expires_at`, keyID, formatTime(expiresAt))
+	return err
+}
+
+// formatTime formats t in UTC with a fixed width.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timestampFormat)
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// IOSubsystem names a part of the persistence layer writing to storage.
+type IOSubsystem string
+
+// Subsystems whose writes are accounted for by WriteAmplification.
+const (
+	IOSnapshot IOSubsystem = "snapshot" // Whole-store saves to the backend
+	IORecords  IOSubsystem = "records"  // Write-through to the record persister
+	IOOffload  IOSubsystem = "offload"  // History sidecar rewrites
+	IOBackup   IOSubsystem = "backup"   // Backup files and their manifest
+)
+
+// ioSubsystems lists every IOSubsystem.
+var ioSubsystems = []IOSubsystem{IOSnapshot, IORecords, IOOffload, IOBackup}
+
+// IOCounts counts the writes of a subsystem.
+type IOCounts struct {
+	Bytes  uint64
+	Writes uint64
+}
+
+// WriteAmplificationStats compares the bytes the store wrote to storage with the bytes clients wrote to it.
+type WriteAmplificationStats struct {
+	LogicalBytes  uint64 // Key and value bytes of the versions written by clients
+	Subsystems    map[IOSubsystem]IOCounts
+	PhysicalBytes uint64  // Bytes written by every subsystem
+	Writes        uint64  // Write calls made by every subsystem
+	Factor        float64 // PhysicalBytes over LogicalBytes; zero before any client write
+	Warnings      uint64  // Windows whose factor exceeded the ceiling set by WithWriteAmplificationCeiling
+}
+
+// ioCounter counts the writes of a subsystem.
+type ioCounter struct {
+	bytes  atomic.Uint64
+	writes atomic.Uint64
+}
+
+// ioAccounting counts client writes and the storage writes made for them.
+type ioAccounting struct {
+	logical    atomic.Uint64
+	subsystems map[IOSubsystem]*ioCounter // Fixed at creation, so it is read without locking
+	warnings   atomic.Uint64
+}
+
+// amplificationCeiling is the write amplification factor above which the store warns.
+type amplificationCeiling struct {
+	ceiling float64
+	window  time.Duration
+}
+
+// newIOAccounting returns counters for every subsystem.
+func newIOAccounting() *ioAccounting {
+	a := &ioAccounting{subsystems: make(map[IOSubsystem]*ioCounter, len(ioSubsystems))}
+	for _, s := range ioSubsystems {
+		a.subsystems[s] = &ioCounter{}
+	}
+	return a
+}
+
+// write counts a write of n bytes by subsystem s.
+func (a *ioAccounting) write(s IOSubsystem, n int) {
+	if a == nil {
+		return
+	}
+	c := a.subsystems[s]
+	c.bytes.Add(uint64(n))
+	c.writes.Add(1)
+}
+
+// clientWrite counts a version written by a client.
+func (a *ioAccounting) clientWrite(key, value string) {
+	if a == nil {
+		return
+	}
+	a.logical.Add(uint64(len(key) + len(value)))
+}
+
+// stats returns the current counts.
+func (a *ioAccounting) stats() WriteAmplificationStats {
+	stats := WriteAmplificationStats{Subsystems: make(map[IOSubsystem]IOCounts, len(ioSubsystems))}
+	if a == nil {
+		return stats
+	}
+	stats.LogicalBytes = a.logical.Load()
+	stats.Warnings = a.warnings.Load()
+	for _, s := range ioSubsystems {
+		counts := IOCounts{Bytes: a.subsystems[s].bytes.Load(), Writes: a.subsystems[s].writes.Load()}
+		stats.Subsystems[s] = counts
+		stats.PhysicalBytes += counts.Bytes
+		stats.Writes += counts.Writes
+	}
+	if stats.LogicalBytes > 0 {
+		stats.Factor = float64(stats.PhysicalBytes) / float64(stats.LogicalBytes)
+	}
+	return stats
+}
+
+// WriteAmplification returns the bytes and write calls of each persistence subsystem since the store was
+// created, and their total relative to the bytes written by clients. Record persister writes count the
+// keys and values handed to the persister, not its own overhead such as database pages and journals.
+func (kv *KeyValueStore) WriteAmplification() WriteAmplificationStats {
+	return kv.ioStats.stats()
+}
+
+// watchWriteAmplification warns whenever the write amplification factor over a window exceeds the ceiling.
+func (kv *KeyValueStore) watchWriteAmplification(c *amplificationCeiling, beat func() bool) {
+	ticker := time.NewTicker(c.window)
+	defer ticker.Stop()
+
+	last := kv.ioStats.stats()
+	for {
+		select {
+		case <-ticker.C:
+			if !beat() {
+				return
+			}
+			kv.injectLoopFault(ComponentWriteAmplification)
+			current := kv.ioStats.stats()
+			logical := current.LogicalBytes - last.LogicalBytes
+			physical := current.PhysicalBytes - last.PhysicalBytes
+			last = current
+			if logical == 0 {
+				continue
+			}
+			if factor := float64(physical) / float64(logical); factor > c.ceiling {
+				kv.ioStats.warnings.Add(1)
+				log.Printf("watchWriteAmplification: Wrote %d bytes for %d client bytes over %v, factor %.1f exceeds %.1f\n",
+					physical, logical, c.window, factor, c.ceiling)
+				kv.notificationManager.Notify(fmt.Sprintf("write_amplification:%.2f", factor))
+			}
+		case <-kv.stopChan:
+			return
+		}
+	}
+}
+
+// countingPersister counts the writes made to a record persister.
+type countingPersister struct {
+	RecordPersister
+	io *ioAccounting
+}
+
+// recordBytes returns the key and value bytes of a record.
+func recordBytes(key string, versions []KeyValue) int {
+	n := len(key)
+	for _, version := range versions {
+		n += len(version.Value)
+	}
+	return n
+}
+
+func (p countingPersister) AppendVersion(key string, version KeyValue, expiresAt time.Time) error {
+	err := p.RecordPersister.AppendVersion(key, version, expiresAt)
+	if err == nil {
+		p.io.write(IORecords, recordBytes(key, []KeyValue{version}))
+	}
+	return err
+}
+
+func (p countingPersister) ReplaceKey(key string, versions []KeyValue, expiresAt time.Time) error {
+	err := p.RecordPersister.ReplaceKey(key, versions, expiresAt)
+	if err == nil {
+		p.io.write(IORecords, recordBytes(key, versions))
+	}
+	return err
+}
+
+func (p countingPersister) DeleteKey(key string) error {
+	err := p.RecordPersister.DeleteKey(key)
+	if err == nil {
+		p.io.write(IORecords, len(key))
+	}
+	return err
+}
+
+func (p countingPersister) ReplaceAll(data map[string][]KeyValue, expirations map[string]time.Time) error {
+	err := p.RecordPersister.ReplaceAll(data, expirations)
+	if err == nil {
+		n := 0
+		for key, versions := range data {
+			n += recordBytes(key, versions)
+		}
+		p.io.write(IORecords, n)
+	}
+	return err
+}
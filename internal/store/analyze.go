@@ -0,0 +1,170 @@
+package store
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultAnalyzeBatch is the number of keys Analyze reads per read lock hold.
+const defaultAnalyzeBatch = 100
+
+// RetentionPolicy describes what a store would keep, for Analyze to estimate what it could drop.
+type RetentionPolicy struct {
+	KeepVersions int           // Versions kept per key; older ones are reclaimable. Zero keeps every version
+	MaxAge       time.Duration // Keys not written for longer are reclaimable whole. Zero keeps every key
+}
+
+// PrefixUsage aggregates the keys sharing a prefix. Byte counts are of keys and values as held in memory,
+// so delta-encoded versions count at their encoded size and offloaded versions not at all.
+type PrefixUsage struct {
+	Prefix       string // First segment of the keys, up to the first ':'; empty for keys without one
+	Keys         int
+	Bytes        int64 // Key names and every version
+	HistoryBytes int64 // Versions other than the latest
+	WithTTL      int
+	WithoutTTL   int
+	OldestWrite  time.Time // Earliest latest-write among the keys
+	NewestWrite  time.Time
+	Reclaimable  int64 // Bytes the retention policy would drop
+}
+
+// AnalysisReport describes the contents of a store by prefix.
+type AnalysisReport struct {
+	Prefixes []PrefixUsage // Largest first, ties by prefix
+	Total    PrefixUsage   // All keys, with an empty prefix
+	Policy   RetentionPolicy
+	AsOf     time.Time // Time the policy was evaluated at
+}
+
+// AnalyzeOption configures Analyze.
+type AnalyzeOption func(*analysis)
+
+// analysis holds the settings of an Analyze run.
+type analysis struct {
+	policy RetentionPolicy
+	asOf   time.Time
+	batch  int
+}
+
+// AnalyzeRetention sets the retention policy whose savings Analyze estimates.
+func AnalyzeRetention(policy RetentionPolicy) AnalyzeOption {
+	return func(a *analysis) {
+		a.policy = policy
+	}
+}
+
+// AnalyzeAsOf evaluates the retention policy's MaxAge as of t instead of now.
+func AnalyzeAsOf(t time.Time) AnalyzeOption {
+	return func(a *analysis) {
+		a.asOf = t
+	}
+}
+
+// AnalyzeBatch sets how many keys Analyze reads per read lock hold.
+func AnalyzeBatch(size int) AnalyzeOption {
+	return func(a *analysis) {
+		if size > 0 {
+			a.batch = size
+		}
+	}
+}
+
+// Analyze aggregates the store by key prefix and estimates the bytes a retention policy would reclaim.
+// Keys are read in batches, releasing the lock between them, so it can run against a live store; keys
+// written during the run may or may not be counted.
+func (kv *KeyValueStore) Analyze(opts ...AnalyzeOption) (AnalysisReport, error) {
+	a := analysis{asOf: time.Now(), batch: defaultAnalyzeBatch}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	report := AnalysisReport{Policy: a.policy, AsOf: a.asOf}
+	if err := kv.ensureLoaded(); err != nil {
+		return report, err
+	}
+
+	kv.RLock()
+	keys := make([]string, 0, len(kv.data))
+	for key := range kv.data {
+		keys = append(keys, key)
+	}
+	kv.RUnlock()
+	sort.Strings(keys)
+
+	usage := make(map[string]*PrefixUsage)
+	for start := 0; start < len(keys); start += a.batch {
+		end := start + a.batch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		kv.RLock()
+		for _, key := range keys[start:end] {
+			versions, exists := kv.data[key]
+			if !exists || len(versions) == 0 {
+				continue
+			}
+			prefix, _, found := strings.Cut(key, ":")
+			if !found {
+				prefix = ""
+			}
+			u := usage[prefix]
+			if u == nil {
+				u = &PrefixUsage{Prefix: prefix}
+				usage[prefix] = u
+			}
+			_, hasTTL := kv.expirations[key]
+			addKeyUsage(u, key, versions, hasTTL, a)
+			addKeyUsage(&report.Total, key, versions, hasTTL, a)
+		}
+		kv.RUnlock()
+	}
+
+	for _, u := range usage {
+		report.Prefixes = append(report.Prefixes, *u)
+	}
+	sort.Slice(report.Prefixes, func(i, j int) bool {
+		if report.Prefixes[i].Bytes != report.Prefixes[j].Bytes {
+			return report.Prefixes[i].Bytes > report.Prefixes[j].Bytes
+		}
+		return report.Prefixes[i].Prefix < report.Prefixes[j].Prefix
+	})
+	log.Printf("Analyze: %d keys in %d prefixes, %d bytes reclaimable\n", report.Total.Keys, len(report.Prefixes), report.Total.Reclaimable)
+	return report, nil
+}
+
+// addKeyUsage adds a key to the aggregate u.
+func addKeyUsage(u *PrefixUsage, key string, versions []KeyValue, hasTTL bool, a analysis) {
+	u.Keys++
+	if hasTTL {
+		u.WithTTL++
+	} else {
+		u.WithoutTTL++
+	}
+
+	bytes := int64(len(key))
+	for i, version := range versions {
+		bytes += int64(len(version.Value))
+		if i < len(versions)-1 {
+			u.HistoryBytes += int64(len(version.Value))
+		}
+	}
+	u.Bytes += bytes
+
+	written := versions[len(versions)-1].Timestamp
+	if u.OldestWrite.IsZero() || written.Before(u.OldestWrite) {
+		u.OldestWrite = written
+	}
+	if written.After(u.NewestWrite) {
+		u.NewestWrite = written
+	}
+
+	switch {
+	case a.policy.MaxAge > 0 && a.asOf.Sub(written) > a.policy.MaxAge:
+		u.Reclaimable += bytes
+	case a.policy.KeepVersions > 0 && len(versions) > a.policy.KeepVersions:
+		for _, version := range versions[:len(versions)-a.policy.KeepVersions] {
+			u.Reclaimable += int64(len(version.Value))
+		}
+	}
+}
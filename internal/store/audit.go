@@ -0,0 +1,65 @@
+package store
+
+import (
+	"log"
+	"time"
+)
+
+// defaultHistoryAuditInterval is the interval of a version history audit configured without one.
+const defaultHistoryAuditInterval = time.Minute
+
+// historyAudit holds the configuration of the version history audit.
+type historyAudit struct {
+	maxVersions int
+	interval    time.Duration
+	handler     func(key string, count int)
+}
+
+// newHistoryAudit creates the configuration of an audit scanning every interval, or every minute unless
+// interval is positive.
+func newHistoryAudit(maxVersions int, interval time.Duration, handler func(key string, count int)) *historyAudit {
+	if interval <= 0 {
+		interval = defaultHistoryAuditInterval
+	}
+	return &historyAudit{maxVersions: maxVersions, interval: interval, handler: handler}
+}
+
+// auditVersionHistories is a background goroutine that periodically reports keys with oversized version histories.
+func (kv *KeyValueStore) auditVersionHistories(audit *historyAudit, beat func() bool) {
+	ticker := time.NewTicker(audit.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !beat() {
+				return
+			}
+			kv.injectLoopFault(ComponentHistoryAudit)
+			kv.scanVersionHistories(audit)
+		case <-kv.stopChan:
+			return
+		}
+	}
+}
+
+// scanVersionHistories checks every key's version count without holding the read lock for the whole scan.
+func (kv *KeyValueStore) scanVersionHistories(audit *historyAudit) {
+	kv.RLock()
+	keys := make([]string, 0, len(kv.data))
+	for key := range kv.data {
+		keys = append(keys, key)
+	}
+	kv.RUnlock()
+
+	for _, key := range keys {
+		kv.RLock()
+		count := len(kv.data[key])
+		kv.RUnlock()
+
+		if count > audit.maxVersions {
+			log.Printf("auditVersionHistories: Key '%s' has %d versions (max %d)\n", key, count, audit.maxVersions)
+			audit.handler(key, count)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrForbidden is returned when the authorizer denies an operation.
+var ErrForbidden = errors.New("forbidden")
+
+// Authorizer decides whether the caller identified by ctx may perform op on key, returning an error to deny it.
+// It runs before the context-aware methods and, for DeleteByPrefixContext, under the store's write lock,
+// so it must not call back into the store.
+type Authorizer func(ctx context.Context, op Op, key string) error
+
+// principalKey is the context key of the authenticated principal.
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated principal, for authorizers to read.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal stored in ctx by WithPrincipal.
+func PrincipalFrom(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok
+}
+
+// authorize checks ctx for cancellation and asks the authorizer, if any, whether op on key is allowed.
+func (kv *KeyValueStore) authorize(ctx context.Context, op Op, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if kv.authorizer == nil {
+		return nil
+	}
+	err := kv.authorizer(ctx, op, key)
+	if err == nil || errors.Is(err, ErrForbidden) {
+		return err
+	}
+	return fmt.Errorf("%w: %s of '%s': %v", ErrForbidden, op, key, err)
+}
+
+// GetContext is Get for the caller identified by ctx.
+func (kv *KeyValueStore) GetContext(ctx context.Context, key string) (string, error) {
+	if err := kv.authorize(ctx, OpGet, key); err != nil {
+		return "", err
+	}
+	return kv.get(ctx, key)
+}
+
+// SetContext is Set for the caller identified by ctx.
+func (kv *KeyValueStore) SetContext(ctx context.Context, key, value string, expiration time.Duration) error {
+	if err := kv.authorize(ctx, OpSet, key); err != nil {
+		return err
+	}
+	if err := kv.set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+	kv.commits.asyncWrites.Add(1)
+	return nil
+}
+
+// DeleteContext is Delete for the caller identified by ctx.
+func (kv *KeyValueStore) DeleteContext(ctx context.Context, key string) error {
+	if err := kv.authorize(ctx, OpDelete, key); err != nil {
+		return err
+	}
+	return kv.remove(ctx, key)
+}
+
+// CompareAndSwapContext is CompareAndSwap for the caller identified by ctx.
+func (kv *KeyValueStore) CompareAndSwapContext(ctx context.Context, key, oldValue, newValue string, ttl time.Duration) (bool, error) {
+	if err := kv.authorize(ctx, OpCompareAndSwap, key); err != nil {
+		return false, err
+	}
+	return kv.compareAndSwap(ctx, key, oldValue, newValue, ttl)
+}
+
+// GetWithTTLContext is GetWithTTL for the caller identified by ctx.
+func (kv *KeyValueStore) GetWithTTLContext(ctx context.Context, key string) (string, time.Duration, error) {
+	if err := kv.authorize(ctx, OpGet, key); err != nil {
+		return "", 0, err
+	}
+	return kv.GetWithTTL(key)
+}
+
+// KeysPageContext is KeysPage for the caller identified by ctx. Keys the caller may not list are left
+// out of the page, which can then hold fewer than limit keys without being the last.
+func (kv *KeyValueStore) KeysPageContext(ctx context.Context, prefix, cursor string, limit int) ([]string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	keys, next, err := kv.KeysPage(prefix, cursor, limit)
+	if err != nil || kv.authorizer == nil {
+		return keys, next, err
+	}
+	allowed := keys[:0]
+	for _, key := range keys {
+		if kv.authorize(ctx, OpKeys, key) == nil {
+			allowed = append(allowed, key)
+		}
+	}
+	return allowed, next, nil
+}
+
+// MultiCompareAndSwapContext is MultiCompareAndSwap for the caller identified by ctx. Every key of the
+// conditions and updates is authorized first; if any is denied, nothing is written.
+func (kv *KeyValueStore) MultiCompareAndSwapContext(ctx context.Context, conditions []Condition, updates []Update) (bool, error) {
+	for _, condition := range conditions {
+		if err := kv.authorize(ctx, OpMultiCompareAndSwap, condition.Key); err != nil {
+			return false, err
+		}
+	}
+	for _, update := range updates {
+		if err := kv.authorize(ctx, OpMultiCompareAndSwap, update.Key); err != nil {
+			return false, err
+		}
+	}
+	return kv.MultiCompareAndSwap(conditions, updates)
+}
+
+// GetVersionContext is GetVersion for the caller identified by ctx.
+func (kv *KeyValueStore) GetVersionContext(ctx context.Context, key string, version int) (string, error) {
+	if err := kv.authorize(ctx, OpGet, key); err != nil {
+		return "", err
+	}
+	return kv.GetVersion(key, version)
+}
+
+// GetAllVersionsContext is GetAllVersions for the caller identified by ctx.
+func (kv *KeyValueStore) GetAllVersionsContext(ctx context.Context, key string) ([]string, error) {
+	if err := kv.authorize(ctx, OpGet, key); err != nil {
+		return nil, err
+	}
+	return kv.GetAllVersions(key)
+}
+
+// GetHistoryContext is GetHistory for the caller identified by ctx.
+func (kv *KeyValueStore) GetHistoryContext(ctx context.Context, key string) ([]KeyValue, error) {
+	if err := kv.authorize(ctx, OpGet, key); err != nil {
+		return nil, err
+	}
+	return kv.GetHistory(key)
+}
+
+// RemoveVersionContext is RemoveVersion for the caller identified by ctx, authorized as a delete of the key.
+func (kv *KeyValueStore) RemoveVersionContext(ctx context.Context, key string, version int) error {
+	if err := kv.authorize(ctx, OpDelete, key); err != nil {
+		return err
+	}
+	return kv.RemoveVersion(key, version)
+}
+
+// SetManyContext is SetMany for the caller identified by ctx. Entries the caller may not set fail
+// with ErrForbidden in the result; the others are set.
+func (kv *KeyValueStore) SetManyContext(ctx context.Context, entries []Entry) SetManyResult {
+	allowed := make([]Entry, 0, len(entries))
+	denied := make(map[string]error)
+	for _, entry := range entries {
+		if err := kv.authorize(ctx, OpSet, entry.Key); err != nil {
+			denied[entry.Key] = err
+			continue
+		}
+		allowed = append(allowed, entry)
+	}
+
+	result := kv.SetMany(allowed)
+	for key, err := range denied {
+		result.Errors[key] = err
+	}
+	return result
+}
+
+// DeleteByPrefix removes every key starting with prefix and returns how many were removed.
+func (kv *KeyValueStore) DeleteByPrefix(prefix string) (int, error) {
+	return kv.deleteByPrefix(context.Background(), prefix, false)
+}
+
+// DeleteByPrefixContext is DeleteByPrefix for the caller identified by ctx. Every matching key is
+// authorized first; if any is denied, nothing is removed.
+func (kv *KeyValueStore) DeleteByPrefixContext(ctx context.Context, prefix string) (int, error) {
+	return kv.deleteByPrefix(ctx, prefix, true)
+}
+
+// deleteByPrefix removes the keys starting with prefix, authorizing each first if asked to.
+func (kv *KeyValueStore) deleteByPrefix(ctx context.Context, prefix string, authorize bool) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, err
+	}
+	if err := kv.admitMutation(); err != nil {
+		return 0, err
+	}
+
+	acquired := kv.lockWrite(OpDelete)
+	defer kv.unlockWrite(OpDelete, acquired)
+
+	for key := range kv.pending {
+		if strings.HasPrefix(key, prefix) {
+			kv.flushPendingLocked(key)
+		}
+	}
+	var keys []string
+	for key := range kv.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if authorize {
+		for _, key := range keys {
+			if err := kv.authorize(ctx, OpDelete, key); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for _, key := range keys {
+		if err := kv.checkComputed(ctx, key); err != nil {
+			return 0, err
+		}
+		if err := kv.checkMutable(key); err != nil {
+			return 0, err
+		}
+	}
+	for _, key := range keys {
+		kv.deleteLocked(key)
+	}
+	return len(keys), nil
+}
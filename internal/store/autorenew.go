@@ -0,0 +1,207 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// autoRenewQueue is the number of extensions waiting for the renewal worker; reads finding it full retry
+// on their next access.
+const autoRenewQueue = 64
+
+// AutoRenewStats counts the TTL extensions of hot keys.
+type AutoRenewStats struct {
+	Tracked    int    // Keys with a TTL under an auto-renew prefix
+	Extensions uint64 // TTL extensions made
+	Capped     uint64 // Extensions cut short, or refused, by the maximum lifetime
+}
+
+// autoRenewRule extends the TTL of keys starting with prefix read more than threshold times in a TTL window.
+type autoRenewRule struct {
+	prefix      string
+	threshold   int
+	maxLifetime time.Duration
+}
+
+// renewState tracks the reads of a key in its current TTL window.
+type renewState struct {
+	rule     autoRenewRule
+	ttl      time.Duration // TTL the key was set with, added by each extension
+	born     time.Time     // When the key was set, from which its lifetime is counted
+	deadline time.Time     // End of the current TTL window
+	reads    int
+	queued   bool
+}
+
+// autoRenew extends the TTL of frequently read keys. Reads only take its own lock; extensions are made by
+// a worker under the store's write lock.
+type autoRenew struct {
+	rules      []autoRenewRule
+	renewals   chan string
+	mu         sync.Mutex
+	keys       map[string]*renewState
+	extensions uint64
+	capped     uint64
+}
+
+// newAutoRenew creates an autoRenew without rules.
+func newAutoRenew() *autoRenew {
+	return &autoRenew{renewals: make(chan string, autoRenewQueue), keys: make(map[string]*renewState)}
+}
+
+// ruleFor returns the rule of the longest prefix of key, if any.
+func (a *autoRenew) ruleFor(key string) (autoRenewRule, bool) {
+	var rule autoRenewRule
+	longest := -1
+	for _, r := range a.rules {
+		if strings.HasPrefix(key, r.prefix) && len(r.prefix) > longest {
+			rule, longest = r, len(r.prefix)
+		}
+	}
+	return rule, longest >= 0
+}
+
+// track starts a new lifetime for key, set at now with a TTL ending at deadline, or stops tracking it if it
+// has no TTL or matches no rule.
+func (a *autoRenew) track(key string, now, deadline time.Time, hasTTL bool) {
+	if a == nil {
+		return
+	}
+	rule, ok := a.ruleFor(key)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !ok || !hasTTL {
+		delete(a.keys, key)
+		return
+	}
+	a.keys[key] = &renewState{rule: rule, ttl: deadline.Sub(now), born: now, deadline: deadline}
+}
+
+// forget stops tracking key.
+func (a *autoRenew) forget(key string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	delete(a.keys, key)
+	a.mu.Unlock()
+}
+
+// reset stops tracking every key, for contents replaced as a whole.
+func (a *autoRenew) reset() {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.keys = make(map[string]*renewState)
+	a.mu.Unlock()
+}
+
+// read counts a read of key whose TTL window ends at deadline and queues its extension once the reads
+// exceed the threshold of its rule.
+func (a *autoRenew) read(key string, deadline time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.keys[key]
+	if !ok {
+		return
+	}
+	if !s.deadline.Equal(deadline) {
+		// The TTL was changed by other means; count reads against the new window.
+		s.deadline, s.reads = deadline, 0
+	}
+	s.reads++
+	if s.queued || s.reads <= s.rule.threshold || !s.born.Add(s.rule.maxLifetime).After(deadline) {
+		return
+	}
+	select {
+	case a.renewals <- key:
+		s.queued = true
+	default:
+	}
+}
+
+// AutoRenewStats returns the number of keys tracked and the TTL extensions made by WithAutoRenew.
+func (kv *KeyValueStore) AutoRenewStats() AutoRenewStats {
+	a := kv.autoRenew
+	if a == nil {
+		return AutoRenewStats{}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return AutoRenewStats{Tracked: len(a.keys), Extensions: a.extensions, Capped: a.capped}
+}
+
+// recordRead feeds a read of key to the auto-renew policy, if enabled. The caller must hold the lock.
+func (kv *KeyValueStore) recordRead(key string) {
+	if kv.autoRenew == nil {
+		return
+	}
+	if deadline, ok := kv.expirations[key]; ok {
+		kv.autoRenew.read(key, deadline)
+	}
+}
+
+// renewHotKeys extends the TTL of the keys queued by reads.
+func (kv *KeyValueStore) renewHotKeys(a *autoRenew, beat func() bool) {
+	ticker := time.NewTicker(listenHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case key := <-a.renewals:
+			if !beat() {
+				return
+			}
+			kv.injectLoopFault(ComponentAutoRenew)
+			kv.extendTTL(a, key)
+		case <-ticker.C:
+			if !beat() {
+				return
+			}
+		case <-kv.stopChan:
+			return
+		}
+	}
+}
+
+// extendTTL extends the TTL of key by the TTL it was set with, up to the maximum lifetime of its rule.
+func (kv *KeyValueStore) extendTTL(a *autoRenew, key string) {
+	acquired := kv.lockWrite(OpExpire)
+	defer kv.unlockWrite(OpExpire, acquired)
+
+	a.mu.Lock()
+	s, ok := a.keys[key]
+	if !ok {
+		a.mu.Unlock()
+		return
+	}
+	s.queued = false
+	deadline, hasTTL := kv.expirations[key]
+	if _, exists := kv.data[key]; !exists || !hasTTL || !time.Now().Before(deadline) {
+		// Expired keys are left to the cleanup sweep.
+		a.mu.Unlock()
+		return
+	}
+	extended := deadline.Add(s.ttl)
+	if limit := s.born.Add(s.rule.maxLifetime); extended.After(limit) {
+		extended = limit
+		a.capped++
+	}
+	if !extended.After(deadline) {
+		a.mu.Unlock()
+		return
+	}
+	s.deadline, s.reads = extended, 0
+	a.extensions++
+	a.mu.Unlock()
+
+	kv.expirations[key] = extended
+	kv.scheduleExpiry(key)
+	kv.persistKey(key)
+	log.Printf("extendTTL: Extended the TTL of hot key '%s' to %v\n", key, extended.Format(time.RFC3339Nano))
+	kv.notificationManager.Notify(fmt.Sprintf("ttl_extended:%s", key))
+}
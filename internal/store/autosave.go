@@ -0,0 +1,185 @@
+package store
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// autosaveSamples is the number of recent autosave durations the interval is derived from.
+const autosaveSamples = 20
+
+// Defaults of AutosaveConfig.
+const (
+	defaultAutosaveOverhead    = 0.05
+	defaultAutosaveMinInterval = time.Second
+	defaultAutosaveMaxInterval = time.Minute
+)
+
+// AutosaveConfig configures WithAdaptiveAutosave.
+type AutosaveConfig struct {
+	MaxOverhead float64       // Fraction of wall time autosaves may take; 0.05 if zero
+	MinInterval time.Duration // Shortest interval between autosaves; 1s if zero
+	MaxInterval time.Duration // Longest interval, bounding the writes a crash loses; 1m if zero
+
+	// Clock reads the time autosaves and write rates are measured with; time.Now if nil.
+	Clock func() time.Time
+}
+
+// AutosaveStats describes the adaptive autosave.
+type AutosaveStats struct {
+	Enabled   bool
+	Interval  time.Duration // Current interval between autosaves
+	SaveP90   time.Duration // 90th percentile of the recent autosave durations
+	WriteRate float64       // Writes per second between the last two autosaves
+	Saves     uint64
+	Skipped   uint64 // Autosaves skipped as nothing was written since the last one
+	Failures  uint64
+}
+
+// adaptiveAutosave chooses the interval between autosaves from their recent durations.
+type adaptiveAutosave struct {
+	config    AutosaveConfig
+	mu        sync.Mutex
+	durations []time.Duration // Ring of the last autosaveSamples durations
+	next      int
+	interval  time.Duration
+	writeRate float64
+	saves     uint64
+	skipped   uint64
+	failures  uint64
+}
+
+// newAdaptiveAutosave creates an adaptiveAutosave starting at the shortest interval.
+func newAdaptiveAutosave(config AutosaveConfig) *adaptiveAutosave {
+	if config.MaxOverhead <= 0 {
+		config.MaxOverhead = defaultAutosaveOverhead
+	}
+	if config.MinInterval <= 0 {
+		config.MinInterval = defaultAutosaveMinInterval
+	}
+	if config.MaxInterval <= 0 {
+		config.MaxInterval = defaultAutosaveMaxInterval
+	}
+	if config.MaxInterval < config.MinInterval {
+		config.MaxInterval = config.MinInterval
+	}
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+	return &adaptiveAutosave{config: config, interval: config.MinInterval}
+}
+
+// currentInterval returns the interval until the next autosave.
+func (a *adaptiveAutosave) currentInterval() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.interval
+}
+
+// p90 returns the 90th percentile of the recorded durations. The caller must hold a.mu.
+func (a *adaptiveAutosave) p90() time.Duration {
+	if len(a.durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), a.durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)*9-1)/10]
+}
+
+// saved records an autosave taking d after writes at writeRate per second and picks the next interval:
+// long enough for autosaves to take at most MaxOverhead of the time, within the configured bounds.
+func (a *adaptiveAutosave) saved(d time.Duration, writeRate float64, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		a.failures++
+		return
+	}
+	a.saves++
+	a.writeRate = writeRate
+	if len(a.durations) < autosaveSamples {
+		a.durations = append(a.durations, d)
+	} else {
+		a.durations[a.next] = d
+		a.next = (a.next + 1) % autosaveSamples
+	}
+
+	p90 := a.p90()
+	interval := time.Duration(float64(p90) / a.config.MaxOverhead)
+	// The ceiling bounds the writes a crash loses, even if saves then take more than their share.
+	interval = min(max(interval, a.config.MinInterval), a.config.MaxInterval)
+	if interval != a.interval {
+		log.Printf("autosave: Saving every %v (p90 save %v, %.1f writes/s)\n", interval, p90, writeRate)
+		a.interval = interval
+	}
+}
+
+// skip records an autosave skipped as nothing was written.
+func (a *adaptiveAutosave) skip() {
+	a.mu.Lock()
+	a.skipped++
+	a.mu.Unlock()
+}
+
+// AutosaveStats returns the current autosave interval and the autosaves made by WithAdaptiveAutosave.
+func (kv *KeyValueStore) AutosaveStats() AutosaveStats {
+	a := kv.autosave
+	if a == nil {
+		return AutosaveStats{}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return AutosaveStats{
+		Enabled:   true,
+		Interval:  a.interval,
+		SaveP90:   a.p90(),
+		WriteRate: a.writeRate,
+		Saves:     a.saves,
+		Skipped:   a.skipped,
+		Failures:  a.failures,
+	}
+}
+
+// autosaveLoop saves the store whenever the interval chosen by a has elapsed and something was written.
+// Saves made by Save, SetDurable and Stop are not measured.
+func (kv *KeyValueStore) autosaveLoop(a *adaptiveAutosave, beat func() bool) {
+	timer := time.NewTimer(a.currentInterval())
+	defer timer.Stop()
+
+	// Writes may land before the loop starts, so count from the start of the sequence rather than its
+	// current value. A store loaded with nothing written since is saved once more.
+	clock := a.config.Clock
+	lastSeq, lastSave := uint64(0), clock()
+	for {
+		select {
+		case <-timer.C:
+			if !beat() {
+				return
+			}
+			kv.injectLoopFault(ComponentAutosave)
+			seq, now := kv.globalSeq.Load(), clock()
+			if seq == lastSeq || !kv.Loaded() {
+				a.skip()
+			} else {
+				start := clock()
+				err := kv.save()
+				if err != nil {
+					log.Printf("autosave: Failed to save: %v\n", err)
+				}
+				var writeRate float64
+				if elapsed := now.Sub(lastSave); elapsed > 0 {
+					writeRate = float64(seq-lastSeq) / elapsed.Seconds()
+				}
+				a.saved(clock().Sub(start), writeRate, err)
+				if err == nil {
+					lastSeq, lastSave = seq, now
+				}
+			}
+			timer.Reset(a.currentInterval())
+		case <-kv.stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// StorageBackend persists the encoded store contents.
+// Load must return an error wrapping os.ErrNotExist when nothing has been saved yet.
+type StorageBackend interface {
+	Load() ([]byte, error)
+	Save(data []byte) error
+}
+
+// FileBackend stores data in a single file.
+type FileBackend struct {
+	Path string
+}
+
+// NewFileBackend creates a FileBackend writing to the given path.
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{Path: path}
+}
+
+// Load reads the file contents.
+func (b *FileBackend) Load() ([]byte, error) {
+	data, err := os.ReadFile(b.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	return data, nil
+}
+
+// Save writes data to a temporary file and renames it over the file, so readers never see a partial save.
+func (b *FileBackend) Save(data []byte) error {
+	tmp := b.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+	if err := os.Rename(tmp, b.Path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing file: %w", err)
+	}
+	return nil
+}
+
+// ModTime returns the last modification time of the file.
+func (b *FileBackend) ModTime() (time.Time, error) {
+	info, err := os.Stat(b.Path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// MemoryBackend keeps data in memory. It is used when a store has no file to persist to.
+type MemoryBackend struct {
+	mu      sync.Mutex
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryBackend creates an empty MemoryBackend.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{}
+}
+
+// Load returns the last saved data.
+func (b *MemoryBackend) Load() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.data == nil {
+		return nil, fmt.Errorf("memory backend is empty: %w", os.ErrNotExist)
+	}
+	return append([]byte(nil), b.data...), nil
+}
+
+// Save replaces the stored data.
+func (b *MemoryBackend) Save(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append([]byte(nil), data...)
+	b.modTime = time.Now()
+	return nil
+}
+
+// ModTime returns the time of the last save.
+func (b *MemoryBackend) ModTime() (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.modTime, nil
+}
+
+// modTimer is implemented by backends that know when their data was last written.
+type modTimer interface {
+	ModTime() (time.Time, error)
+}
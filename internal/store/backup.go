@@ -0,0 +1,556 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// backupManifestFile names the manifest describing the chain in a backup directory.
+const backupManifestFile = "manifest.json"
+
+// BackupMode selects what a backup captures.
+type BackupMode string
+
+// Backup modes. A full backup captures every key and starts a new chain; a differential captures the keys
+// changed since the latest backup in the chain.
+const (
+	BackupFull BackupMode = "full"
+	BackupDiff BackupMode = "diff"
+)
+
+// ErrBackupChain is returned when a backup chain cannot be extended or restored: it has no full backup,
+// a backup is missing or out of order, or a file does not match its recorded hash.
+var ErrBackupChain = errors.New("broken backup chain")
+
+// BackupEntry describes one backup in a chain.
+type BackupEntry struct {
+	Name        string // File name within the backup directory
+	Mode        BackupMode
+	Parent      string `json:",omitempty"` // Backup a differential applies on top of
+	BaseSeq     uint64 // Sequence number covered by the parent, zero for a full backup
+	Seq         uint64 // Sequence number of the latest mutation covered
+	Keys        int    // Keys written, including those recorded as deleted
+	FileHash    string // SHA-256 of the backup file
+	ContentHash string // ContentHash of the store as of this backup
+	Created     time.Time
+}
+
+// BackupManifest describes the backup chain in a directory: a full backup followed by differentials, oldest first.
+type BackupManifest struct {
+	Backups []BackupEntry
+}
+
+// backupTracker records the keys changed since the latest backup, so a differential need not compare
+// the store with its chain. It is guarded by its own mutex, which may be taken under the store lock.
+type backupTracker struct {
+	running sync.Mutex // Serializes backups; taken before the store lock
+	mu      sync.Mutex
+	dir     string              // Directory of the tracked chain
+	last    string              // Latest backup in the tracked chain
+	changed map[string]struct{} // Nil while no chain is tracked
+}
+
+// mark records a change to key. The caller must hold the write lock.
+func (t *backupTracker) mark(key string) {
+	t.mu.Lock()
+	if t.changed != nil {
+		t.changed[key] = struct{}{}
+	}
+	t.mu.Unlock()
+}
+
+// covers reports whether the tracked changes are relative to backup last in dir.
+func (t *backupTracker) covers(dir, last string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.changed != nil && t.dir == dir && t.last == last
+}
+
+// take returns the changes since backup last in dir, or false if they were not tracked, and starts
+// tracking changes since backup next. The caller must hold the lock.
+func (t *backupTracker) take(dir, last, next string) (map[string]struct{}, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	changed, tracked := t.changed, t.changed != nil && t.dir == dir && t.last == last
+	t.dir, t.last, t.changed = dir, next, make(map[string]struct{})
+	return changed, tracked
+}
+
+// reset stops tracking, so the next differential compares the store with its chain.
+func (t *backupTracker) reset() {
+	t.mu.Lock()
+	t.dir, t.last, t.changed = "", "", nil
+	t.mu.Unlock()
+}
+
+// ReadBackupManifest reads the manifest of the backup directory dir. A directory without one has an empty chain.
+func ReadBackupManifest(dir string) (BackupManifest, error) {
+	var manifest BackupManifest
+	data, err := os.ReadFile(filepath.Join(dir, backupManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, fmt.Errorf("error reading backup manifest: %v", err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("error parsing backup manifest: %v", err)
+	}
+	return manifest, nil
+}
+
+// writeBackupManifest replaces the manifest of dir, so a crash leaves either the old chain or the new one.
+// It returns the size of the manifest.
+func writeBackupManifest(dir string, manifest BackupManifest) (int, error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("error marshalling backup manifest: %v", err)
+	}
+	path := filepath.Join(dir, backupManifestFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return 0, fmt.Errorf("error writing backup manifest: %v", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return 0, fmt.Errorf("error writing backup manifest: %v", err)
+	}
+	return len(data), nil
+}
+
+// Backup writes a backup of the store to the directory dir and records it in the directory's manifest.
+// A full backup starts a new chain. A differential holds only the keys changed since the latest backup in
+// the chain, with deleted keys recorded as empty histories; it fails with ErrBackupChain if dir has no full
+// backup. Changes are tracked from the latest backup taken by this store, and otherwise found by comparing
+// the store with the chain. Like SaveTo, backups hold version histories in the persisted format.
+func (kv *KeyValueStore) Backup(dir string, mode BackupMode) (BackupEntry, error) {
+	if mode != BackupFull && mode != BackupDiff {
+		return BackupEntry{}, fmt.Errorf("unknown backup mode '%s'", mode)
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return BackupEntry{}, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return BackupEntry{}, fmt.Errorf("error creating backup directory: %v", err)
+	}
+
+	kv.backups.running.Lock()
+	defer kv.backups.running.Unlock()
+
+	manifest, err := ReadBackupManifest(dir)
+	if err != nil {
+		return BackupEntry{}, err
+	}
+	entry := BackupEntry{Mode: mode, Created: time.Now().UTC()}
+	entry.Name = fmt.Sprintf("backup-%s-%s.mkv", entry.Created.Format("20060102T150405.000000000Z"), mode)
+	var chainHashes map[string]string
+	if mode == BackupDiff {
+		if len(manifest.Backups) == 0 {
+			return BackupEntry{}, fmt.Errorf("%w: no full backup in %s", ErrBackupChain, dir)
+		}
+		parent := manifest.Backups[len(manifest.Backups)-1]
+		entry.Parent, entry.BaseSeq = parent.Name, parent.Seq
+		if !kv.backups.covers(dir, parent.Name) {
+			log.Printf("Backup: Changes since %s not tracked, comparing with the chain\n", parent.Name)
+			chain, err := kv.readBackupChain(dir, manifest)
+			if err != nil {
+				return BackupEntry{}, err
+			}
+			chainHashes = make(map[string]string, len(chain))
+			for key, versions := range chain {
+				chainHashes[key] = historyHash(versions)
+			}
+		}
+	}
+
+	data, err := kv.captureBackup(dir, &entry, chainHashes)
+	if err != nil {
+		kv.backups.reset()
+		return BackupEntry{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, entry.Name), data, 0644); err != nil {
+		kv.backups.reset()
+		return BackupEntry{}, fmt.Errorf("error writing backup: %v", err)
+	}
+	kv.ioStats.write(IOBackup, len(data))
+	sum := sha256.Sum256(data)
+	entry.FileHash = hex.EncodeToString(sum[:])
+
+	if mode == BackupFull {
+		if len(manifest.Backups) > 0 {
+			log.Printf("Backup: Starting a new chain, superseding %d backups in %s\n", len(manifest.Backups), dir)
+		}
+		manifest.Backups = nil
+	}
+	manifest.Backups = append(manifest.Backups, entry)
+	written, err := writeBackupManifest(dir, manifest)
+	if err != nil {
+		kv.backups.reset()
+		return BackupEntry{}, err
+	}
+	kv.ioStats.write(IOBackup, written)
+	log.Printf("Backup: Wrote %s backup %s of %d keys\n", mode, entry.Name, entry.Keys)
+	return entry, nil
+}
+
+// captureBackup encodes the keys entry captures under the read lock and fills in its sequence numbers,
+// key count and content hash. chainHashes holds the history hashes of the chain when changes were not tracked.
+func (kv *KeyValueStore) captureBackup(dir string, entry *BackupEntry, chainHashes map[string]string) ([]byte, error) {
+	kv.RLock()
+	defer kv.RUnlock()
+
+	histories, err := kv.withOffloadedHistories()
+	if err != nil {
+		return nil, err
+	}
+	entry.Seq = kv.globalSeq.Load()
+	entry.ContentHash = hashContents(histories)
+	changed, tracked := kv.backups.take(dir, entry.Parent, entry.Name)
+
+	contents := histories
+	if entry.Mode == BackupDiff {
+		if !tracked && chainHashes == nil {
+			return nil, fmt.Errorf("%w: store contents replaced during backup", ErrBackupChain)
+		}
+		if !tracked {
+			changed = make(map[string]struct{})
+			for key, versions := range histories {
+				if chainHashes[key] != historyHash(versions) {
+					changed[key] = struct{}{}
+				}
+			}
+			for key := range chainHashes {
+				if _, exists := histories[key]; !exists {
+					changed[key] = struct{}{}
+				}
+			}
+		}
+		contents = make(map[string][]KeyValue, len(changed))
+		for key := range changed {
+			// An empty history marks a key deleted since the parent.
+			contents[key] = append([]KeyValue{}, histories[key]...)
+		}
+	}
+	entry.Keys = len(contents)
+	return kv.encodeData(contents)
+}
+
+// RestoreStrategy decides how RestoreBackupWith combines a backup chain with the live contents.
+type RestoreStrategy string
+
+// Restore strategies. Under RestoreLastWriteWins and RestoreFirstWriteWins keys only in the store are left
+// alone and expirations of live keys are kept.
+const (
+	// RestoreOverwrite replaces the store contents with the backup, removing keys it does not hold.
+	RestoreOverwrite RestoreStrategy = "overwrite"
+	// RestoreLastWriteWins takes the backup's history of a key when its latest version is more recent than
+	// the live one; the live history wins a timestamp tie.
+	RestoreLastWriteWins RestoreStrategy = "last-write-wins"
+	// RestoreFirstWriteWins only adds the keys missing from the store.
+	RestoreFirstWriteWins RestoreStrategy = "first-write-wins"
+	// RestoreReportOnly changes nothing and reports what RestoreOverwrite would do.
+	RestoreReportOnly RestoreStrategy = "report-only"
+)
+
+// RestoreReport lists the keys RestoreBackupWith changed, sorted.
+type RestoreReport struct {
+	Strategy    RestoreStrategy
+	Backup      BackupEntry // Latest backup of the chain
+	Added       []string    // Keys only in the backup
+	Overwritten []string    // Keys whose live history was replaced by the backup's
+	Skipped     []string    // Keys whose live history differs from the backup's and was kept
+	Removed     []string    // Keys only in the store, removed by RestoreOverwrite
+	Unchanged   int         // Keys with identical histories in the store and the backup
+}
+
+// Changed returns the number of keys the restore added, overwrote or removed.
+func (r RestoreReport) Changed() int {
+	return len(r.Added) + len(r.Overwritten) + len(r.Removed)
+}
+
+// RestoreBackup replaces the store contents with the backup chain in the directory dir and saves the store.
+// Every backup is checked against the hashes in the manifest before anything is replaced, and a chain with
+// a missing or reordered backup is refused with ErrBackupChain. It returns the latest backup restored.
+func (kv *KeyValueStore) RestoreBackup(dir string) (BackupEntry, error) {
+	report, err := kv.RestoreBackupWith(dir, RestoreOverwrite)
+	return report.Backup, err
+}
+
+// RestoreBackupWith restores the backup chain in the directory dir into the store according to strategy,
+// checking the chain like RestoreBackup, and saves the store. Every key it changes is notified as added,
+// updated or deleted, so subscribers stay in sync with the restored contents.
+func (kv *KeyValueStore) RestoreBackupWith(dir string, strategy RestoreStrategy) (RestoreReport, error) {
+	report := RestoreReport{Strategy: strategy}
+	switch strategy {
+	case RestoreOverwrite, RestoreReportOnly:
+	case RestoreLastWriteWins, RestoreFirstWriteWins:
+		// Merging needs the live contents, while overwriting also recovers a store that cannot load.
+		if err := kv.ensureLoaded(); err != nil {
+			return report, err
+		}
+		if err := kv.admitMutation(); err != nil {
+			return report, err
+		}
+	default:
+		return report, fmt.Errorf("unknown restore strategy %q", strategy)
+	}
+
+	manifest, err := ReadBackupManifest(dir)
+	if err != nil {
+		return report, err
+	}
+	histories, err := kv.readBackupChain(dir, manifest)
+	if err != nil {
+		return report, err
+	}
+	report.Backup = manifest.Backups[len(manifest.Backups)-1]
+	incoming := make(map[string][]KeyValue, len(histories))
+	for key, versions := range histories {
+		if incoming[key], err = materializeVersions(versions); err != nil {
+			return report, fmt.Errorf("error reconstructing backup history of key '%s': %v", key, err)
+		}
+	}
+
+	kv.Lock()
+	for key := range incoming {
+		kv.flushPendingLocked(key)
+	}
+	err = kv.planRestoreLocked(&report, incoming)
+	if err == nil {
+		switch strategy {
+		case RestoreOverwrite:
+			err = kv.overwriteLocked(report, histories)
+		case RestoreLastWriteWins, RestoreFirstWriteWins:
+			kv.applyRestoreLocked(report, incoming)
+		}
+	}
+	kv.Unlock()
+	if err != nil || strategy == RestoreReportOnly {
+		return report, err
+	}
+	if err := kv.save(); err != nil {
+		return report, fmt.Errorf("error saving restored data: %v", err)
+	}
+
+	kv.notificationManager.Notify("backup_restored:" + report.Backup.Name)
+	log.Printf("RestoreBackupWith: Restored %d backups from %s (%s): %d added, %d overwritten, %d skipped, %d removed\n",
+		len(manifest.Backups), dir, strategy, len(report.Added), len(report.Overwritten), len(report.Skipped), len(report.Removed))
+	return report, nil
+}
+
+// planRestoreLocked fills report with what its strategy does to each key, comparing the live histories
+// with the materialized backup histories in incoming. The caller must hold the write lock.
+func (kv *KeyValueStore) planRestoreLocked(report *RestoreReport, incoming map[string][]KeyValue) error {
+	live := map[string][]KeyValue{}
+	if kv.loaded.Load() {
+		var err error
+		if live, err = kv.withOffloadedHistories(); err != nil {
+			return err
+		}
+	}
+
+	for key, versions := range incoming {
+		current, exists := live[key]
+		if !exists {
+			report.Added = append(report.Added, key)
+			continue
+		}
+		current, err := materializeVersions(current)
+		if err != nil {
+			return fmt.Errorf("error reconstructing live history of key '%s': %v", key, err)
+		}
+		switch {
+		case sameHistory(current, versions):
+			report.Unchanged++
+		case report.Strategy == RestoreFirstWriteWins:
+			report.Skipped = append(report.Skipped, key)
+		case report.Strategy == RestoreLastWriteWins && !versions[len(versions)-1].Timestamp.After(current[len(current)-1].Timestamp):
+			report.Skipped = append(report.Skipped, key)
+		default:
+			report.Overwritten = append(report.Overwritten, key)
+		}
+	}
+	if report.Strategy == RestoreOverwrite || report.Strategy == RestoreReportOnly {
+		for key := range live {
+			if _, exists := incoming[key]; !exists {
+				report.Removed = append(report.Removed, key)
+			}
+		}
+	}
+
+	sort.Strings(report.Added)
+	sort.Strings(report.Overwritten)
+	sort.Strings(report.Skipped)
+	sort.Strings(report.Removed)
+	return nil
+}
+
+// overwriteLocked replaces the store contents with the backup histories and notifies the keys report lists
+// as changed. The caller must hold the write lock.
+func (kv *KeyValueStore) overwriteLocked(report RestoreReport, histories map[string][]KeyValue) error {
+	data, err := kv.encodeData(histories)
+	if err != nil {
+		return err
+	}
+	previous := make(map[string]string, len(report.Overwritten)+len(report.Removed))
+	for _, key := range append(report.Overwritten, report.Removed...) {
+		previous[key] = latestValue(kv.data[key])
+	}
+	if err := kv.install(data, time.Now()); err != nil {
+		return err
+	}
+	for key := range kv.expirations {
+		if _, exists := kv.data[key]; !exists {
+			delete(kv.expirations, key)
+		}
+	}
+	kv.restoreSequence(report.Backup.Seq)
+	// Restored versions carry the revisions they had when backed up.
+	for _, key := range report.Added {
+		kv.restampLocked(key)
+	}
+	for _, key := range report.Overwritten {
+		kv.restampLocked(key)
+	}
+
+	for _, key := range report.Added {
+		kv.notificationManager.notifyChange("added", key, "", latestValue(kv.data[key]), kv.globalSeq.Add(1))
+	}
+	for _, key := range report.Overwritten {
+		kv.notificationManager.notifyChange("updated", key, previous[key], latestValue(kv.data[key]), kv.globalSeq.Add(1))
+	}
+	for _, key := range report.Removed {
+		kv.notificationManager.notifyChange("deleted", key, previous[key], "", kv.globalSeq.Add(1))
+	}
+	return nil
+}
+
+// applyRestoreLocked adds and overwrites the keys report lists with their histories in incoming, like Merge.
+// The caller must hold the write lock.
+func (kv *KeyValueStore) applyRestoreLocked(report RestoreReport, incoming map[string][]KeyValue) {
+	for _, key := range report.Added {
+		kv.data[key] = kv.encodeDeltas(key, incoming[key])
+		kv.restampLocked(key)
+		kv.indexAdd(key)
+		kv.persistKey(key)
+		kv.notificationManager.notifyChange("added", key, "", latestValue(incoming[key]), kv.globalSeq.Add(1))
+	}
+	for _, key := range report.Overwritten {
+		previous := latestValue(kv.data[key])
+		kv.data[key] = kv.encodeDeltas(key, incoming[key])
+		kv.restampLocked(key)
+		kv.forgetHistory(key)
+		kv.persistKey(key)
+		kv.notificationManager.notifyChange("updated", key, previous, latestValue(incoming[key]), kv.globalSeq.Add(1))
+	}
+}
+
+// readBackupChain verifies the chain described by manifest and returns the histories it adds up to.
+func (kv *KeyValueStore) readBackupChain(dir string, manifest BackupManifest) (map[string][]KeyValue, error) {
+	if len(manifest.Backups) == 0 {
+		return nil, fmt.Errorf("%w: no backups in %s", ErrBackupChain, dir)
+	}
+
+	var histories map[string][]KeyValue
+	for i, entry := range manifest.Backups {
+		if i == 0 && (entry.Mode != BackupFull || entry.Parent != "") {
+			return nil, fmt.Errorf("%w: chain starts with %s backup %s", ErrBackupChain, entry.Mode, entry.Name)
+		}
+		if i > 0 {
+			parent := manifest.Backups[i-1]
+			if entry.Mode != BackupDiff || entry.Parent != parent.Name || entry.BaseSeq != parent.Seq {
+				return nil, fmt.Errorf("%w: %s does not follow %s", ErrBackupChain, entry.Name, parent.Name)
+			}
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, filepath.Base(entry.Name)))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBackupChain, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != entry.FileHash {
+			return nil, fmt.Errorf("%w: %s does not match its recorded hash", ErrBackupChain, entry.Name)
+		}
+		contents, err := kv.decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("error reading backup %s: %w", entry.Name, err)
+		}
+
+		if histories == nil {
+			histories = contents
+		} else {
+			for key, versions := range contents {
+				if len(versions) == 0 {
+					delete(histories, key)
+					continue
+				}
+				histories[key] = versions
+			}
+		}
+		if hashContents(histories) != entry.ContentHash {
+			return nil, fmt.Errorf("%w: contents after %s do not match its recorded hash", ErrBackupChain, entry.Name)
+		}
+	}
+	return histories, nil
+}
+
+// ContentHash returns a hash of the store contents, as recorded for each backup: the key set and, per key,
+// the latest value and version count.
+func (kv *KeyValueStore) ContentHash() (string, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return "", err
+	}
+	kv.RLock()
+	defer kv.RUnlock()
+	histories, err := kv.withOffloadedHistories()
+	if err != nil {
+		return "", err
+	}
+	return hashContents(histories), nil
+}
+
+// hashContents combines the contentHash of every key, in key order.
+func hashContents(histories map[string][]KeyValue) string {
+	keys := make([]string, 0, len(histories))
+	for key := range histories {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(contentHash(histories[key])))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// historyHash hashes every version of a history, so differentials detect any change to it. Histories
+// whose deltas cannot be applied hash to the empty string, which never matches.
+func historyHash(versions []KeyValue) string {
+	full, err := materializeVersions(versions)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	for _, version := range full {
+		h.Write([]byte(version.Value))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.FormatInt(version.Timestamp.UnixNano(), 10)))
+		h.Write([]byte{0})
+		h.Write([]byte(version.Encoding))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.Itoa(version.Collapsed)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
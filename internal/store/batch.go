@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Entry is a key-value pair to set with an optional TTL.
+type Entry struct {
+	Key   string
+	Value string
+	TTL   time.Duration
+}
+
+// ValueInfo is the latest value of a key as returned by GetManyConsistent.
+type ValueInfo struct {
+	Value     string
+	Version   int       // Index of the value in the key's history, as taken by GetVersion
+	Revision  uint64    // Changes whenever the value does and never repeats, unlike Version, see Condition
+	Timestamp time.Time // Zero for a write still held in a coalescing window
+	ExpiresAt time.Time // Zero if the key does not expire
+}
+
+// SetManyResult reports which keys SetMany created, which it updated and which failed.
+type SetManyResult struct {
+	Created []string
+	Updated []string
+	Errors  map[string]error
+}
+
+// SetMany sets several key-value pairs under a single write lock.
+// Each entry behaves like Set, including its notification and pre-write hooks; Created and Updated
+// list the keys as rewritten by the hooks, while Errors uses the keys as given.
+func (kv *KeyValueStore) SetMany(entries []Entry) SetManyResult {
+	return kv.setMany(entries, nil)
+}
+
+// setMany implements SetMany, suppressing the key events of the writes as those of bulk if set.
+func (kv *KeyValueStore) setMany(entries []Entry, bulk *bulkSuspension) SetManyResult {
+	result := SetManyResult{Errors: make(map[string]error)}
+
+	if err := kv.ensureLoaded(); err != nil {
+		for _, entry := range entries {
+			result.Errors[entry.Key] = err
+		}
+		return result
+	}
+
+	if err := kv.admitMutation(); err != nil {
+		for _, entry := range entries {
+			result.Errors[entry.Key] = err
+		}
+		return result
+	}
+
+	accepted := make([]Entry, 0, len(entries))
+	given := make([]string, 0, len(entries)) // Keys of the accepted entries before the hooks
+	for _, entry := range entries {
+		givenKey := entry.Key
+		key, value, err := kv.applyPreWriteHooks(entry.Key, entry.Value)
+		if err == nil {
+			err = kv.checkComputed(context.Background(), key)
+		}
+		if err != nil {
+			result.Errors[entry.Key] = err
+			continue
+		}
+		entry.Key, entry.Value = key, value
+		kv.recordAccess(entry.Key)
+		if err := kv.admitWrite(); err != nil {
+			result.Errors[entry.Key] = err
+			continue
+		}
+		if err := kv.injectFault(OpSet, entry.Key); err != nil {
+			result.Errors[entry.Key] = err
+			continue
+		}
+		accepted = append(accepted, entry)
+		given = append(given, givenKey)
+	}
+
+	acquired := kv.lockWrite(OpSet)
+	defer kv.unlockWrite(OpSet, acquired)
+	bulk.enter()
+	defer bulk.exit()
+
+	for i, entry := range accepted {
+		// The key may have been frozen while the entries waited for the lock.
+		if err := kv.checkMutable(entry.Key); err != nil {
+			result.Errors[given[i]] = err
+			continue
+		}
+		if kv.writeLocked(entry.Key, entry.Value, entry.TTL) {
+			result.Created = append(result.Created, entry.Key)
+		} else {
+			result.Updated = append(result.Updated, entry.Key)
+		}
+	}
+
+	return result
+}
+
+// Batch applies ops atomically under a single write lock: either every set and delete is applied, in
+// order, or none is. Each behaves like Set or Delete, including its notification and pre-write hooks,
+// and deleting a missing key is not an error. It is MultiCompareAndSwap without conditions.
+func (kv *KeyValueStore) Batch(ops []Update) error {
+	_, err := kv.MultiCompareAndSwap(nil, ops)
+	return err
+}
+
+// GetManyConsistent returns the keys that exist and have not expired, together with the sequence number of
+// the latest mutation they reflect. All values are read under a single read lock, so the result is one point
+// in time: the entries of a SetMany are either all visible or none are.
+func (kv *KeyValueStore) GetManyConsistent(keys []string) (map[string]ValueInfo, uint64, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return nil, 0, fmt.Errorf("data not loaded: %w", err)
+	}
+
+	acquired := kv.lockRead(OpGet)
+	defer kv.unlockRead(OpGet, acquired)
+
+	values := make(map[string]ValueInfo, len(keys))
+	now := time.Now()
+	for _, key := range keys {
+		versions := kv.data[key]
+		// Versions moved to the offload sidecar still count towards the version index.
+		offloaded := 0
+		if kv.offload != nil {
+			offloaded = kv.offload.offloaded[key]
+		}
+		expiresAt := kv.expirations[key]
+		if value, ok := kv.pendingValue(key); ok {
+			values[key] = ValueInfo{
+				Value:     value,
+				Version:   offloaded + len(versions),
+				Revision:  kv.revisionLocked(key),
+				ExpiresAt: expiresAt,
+			}
+			continue
+		}
+		if len(versions) == 0 || (!expiresAt.IsZero() && now.After(expiresAt)) {
+			continue
+		}
+		latest := versions[len(versions)-1]
+		values[key] = ValueInfo{
+			Value:     latest.Value,
+			Version:   offloaded + len(versions) - 1,
+			Revision:  latest.Revision,
+			Timestamp: latest.Timestamp,
+			ExpiresAt: expiresAt,
+		}
+	}
+	return values, kv.globalSeq.Load(), nil
+}
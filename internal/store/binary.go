@@ -0,0 +1,72 @@
+package store
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// SetBytes sets key to a binary value like Set. Values are kept byte for byte in memory; snapshots store
+// values that are not valid UTF-8 in base64, which JSON would otherwise mangle, and text values as is.
+func (kv *KeyValueStore) SetBytes(key string, value []byte, expiration time.Duration) error {
+	return kv.Set(key, string(value), expiration)
+}
+
+// GetBytes returns the latest value of key as bytes, failing like Get.
+func (kv *KeyValueStore) GetBytes(key string) ([]byte, error) {
+	value, err := kv.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(value), nil
+}
+
+// withBinary returns histories with the values that are not valid UTF-8 replaced by their base64 and
+// marked Binary, copying only the histories holding such values.
+func withBinary(histories map[string][]KeyValue) map[string][]KeyValue {
+	var withBinary map[string][]KeyValue
+	for key, versions := range histories {
+		var encoded []KeyValue
+		for i, version := range versions {
+			if utf8.ValidString(version.Value) {
+				continue
+			}
+			if encoded == nil {
+				encoded = append([]KeyValue(nil), versions...)
+			}
+			encoded[i].Value, encoded[i].Binary = base64.StdEncoding.EncodeToString([]byte(version.Value)), true
+		}
+		if encoded == nil {
+			continue
+		}
+		if withBinary == nil {
+			withBinary = make(map[string][]KeyValue, len(histories))
+			for k, v := range histories {
+				withBinary[k] = v
+			}
+		}
+		withBinary[key] = encoded
+	}
+	if withBinary == nil {
+		return histories
+	}
+	return withBinary
+}
+
+// expandBinary reverses withBinary in place.
+func expandBinary(histories map[string][]KeyValue) error {
+	for key, versions := range histories {
+		for i := range versions {
+			if !versions[i].Binary {
+				continue
+			}
+			value, err := base64.StdEncoding.DecodeString(versions[i].Value)
+			if err != nil {
+				return fmt.Errorf("error decoding binary version %d of key '%s': %v", i, key, err)
+			}
+			versions[i].Value, versions[i].Binary = string(value), false
+		}
+	}
+	return nil
+}
@@ -1,31 +1,89 @@
 package store
 
 import (
-	"fmt"
+	"log"
 	"time"
 )
 
 // cleanupExpiredItems is a background goroutine that periodically checks for expired items and removes them from the store.
-func (kv *KeyValueStore) cleanupExpiredItems(tickerInterval time.Duration) {
+func (kv *KeyValueStore) cleanupExpiredItems(tickerInterval time.Duration, beat func() bool) {
 	ticker := time.NewTicker(tickerInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			kv.Lock()
-			now := time.Now()
-			for key, exp := range kv.expirations {
-				if now.After(exp) {
-					delete(kv.data, key)
-					delete(kv.expirations, key)
-					kv.notificationManager.Notify(fmt.Sprintf("expired:%s", key)) // Send expiry notification
+			if !beat() {
+				return
+			}
+			kv.injectLoopFault(ComponentCleanup)
+			if on, _ := kv.MaintenanceMode(); on {
+				// Expired keys stay in expirations and are removed by the first sweep after maintenance.
+				continue
+			}
+			kv.removeExpired()
+			if kv.hasAgeRetention() && kv.Loaded() {
+				if _, err := kv.PruneVersions(); err != nil {
+					log.Printf("cleanup: Failed to prune versions: %v\n", err)
+				}
+			}
+			if kv.offload != nil && kv.Loaded() {
+				if _, err := kv.OffloadColdHistories(); err != nil {
+					log.Printf("cleanup: Failed to offload cold histories: %v\n", err)
 				}
 			}
-			kv.Unlock()
 		case <-kv.stopChan:
-			close(kv.cleanupStopped)
 			return
 		}
 	}
 }
+
+// removeExpired deletes every expired key, releasing the write lock after each batch, and returns how many it deleted.
+func (kv *KeyValueStore) removeExpired() int {
+	now := time.Now()
+	total := 0
+	for {
+		removed, more := kv.removeExpiredBatch(now)
+		total += removed
+		if !more {
+			return total
+		}
+	}
+}
+
+// SweepExpired removes the expired keys now, sending their "expired" notifications, and returns how many
+// it removed. Stores created with WithNoBackground rely on it, as they have no cleanup loop.
+func (kv *KeyValueStore) SweepExpired() (int, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, err
+	}
+	return kv.removeExpired(), nil
+}
+
+// removeExpiredBatch deletes up to CleanupBatch keys expired at now, returning how many it deleted and
+// whether more may remain. Only keys that are due are visited, in deadline order.
+func (kv *KeyValueStore) removeExpiredBatch(now time.Time) (int, bool) {
+	acquired := kv.lockWrite(OpCleanup)
+	defer kv.unlockWrite(OpCleanup, acquired)
+
+	batch := kv.tuning.CleanupBatch
+	removed := 0
+	for {
+		if batch > 0 && removed == batch {
+			return removed, true
+		}
+		key, ok := kv.popDueLocked(now)
+		if !ok {
+			return removed, false
+		}
+		removed++
+		last := latestValue(kv.data[key])
+		delete(kv.data, key)
+		delete(kv.expirations, key)
+		kv.dropPendingLocked(key)
+		kv.scheduleExpiry(key)
+		kv.persistDelete(key)
+		kv.indexRemove(key)
+		kv.notificationManager.notifyChange("expired", key, last, "", kv.globalSeq.Add(1)) // Send expiry notification
+	}
+}
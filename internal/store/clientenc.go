@@ -0,0 +1,17 @@
+package store
+
+import (
+	"errors"
+	"strings"
+)
+
+// ClientEncryptedPrefix marks values encrypted by a client with a key the store does not have.
+const ClientEncryptedPrefix = "mkv-ce1:"
+
+// ErrClientEncrypted is returned by features that need the plaintext of a client-encrypted value.
+var ErrClientEncrypted = errors.New("value is client-encrypted")
+
+// IsClientEncrypted reports whether value carries the client encryption marker.
+func IsClientEncrypted(value string) bool {
+	return strings.HasPrefix(value, ClientEncryptedPrefix)
+}
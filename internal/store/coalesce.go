@@ -0,0 +1,164 @@
+package store
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// coalesceRule collapses writes to keys starting with prefix that arrive within window.
+type coalesceRule struct {
+	prefix string
+	window time.Duration
+}
+
+// pendingWrite is the latest value written to a key during an open coalescing window.
+type pendingWrite struct {
+	value     string
+	at        time.Time // Time of the latest write
+	collapsed int
+	revision  uint64 // Revision the version is committed with, given by each write it collapses
+	gen       uint64 // Window number, so the timer of an earlier window for the key cannot close this one
+	timer     *time.Timer
+}
+
+// coalesceWindow returns the coalescing window for key, or zero if its writes are not coalesced.
+func (kv *KeyValueStore) coalesceWindow(key string) time.Duration {
+	var window time.Duration
+	longest := -1
+	for _, rule := range kv.coalesceRules {
+		if strings.HasPrefix(key, rule.prefix) && len(rule.prefix) > longest {
+			window, longest = rule.window, len(rule.prefix)
+		}
+	}
+	return window
+}
+
+// writeLocked sets key like setLocked, or holds the value pending if the key's writes are coalesced.
+// A pending write updates the expiration of an existing key at once, as the write it stands for would,
+// and the key indexes if it creates the key. It reports whether the key was created. The caller must
+// hold the write lock.
+func (kv *KeyValueStore) writeLocked(key, value string, expiration time.Duration) bool {
+	window := kv.coalesceWindow(key)
+	if window <= 0 || expiration > 0 {
+		// Explicit-TTL writes bypass coalescing but must land after any pending value.
+		kv.flushPendingLocked(key)
+		return kv.setLocked(key, value, expiration)
+	}
+
+	// Pending writes are not persisted until committed, but readers of the stale snapshot see them.
+	kv.staleReads.mark(key)
+	now := time.Now()
+	_, exists := kv.data[key]
+	if exists {
+		kv.setExpirationLocked(key, now, 0)
+	}
+	if p, ok := kv.pending[key]; ok {
+		p.value, p.at, p.revision = value, now, kv.nextRevision()
+		p.collapsed++
+		return false
+	}
+
+	if !exists {
+		kv.indexAdd(key)
+	}
+	kv.pendingGen++
+	gen := kv.pendingGen
+	kv.pending[key] = &pendingWrite{
+		value:    value,
+		at:       now,
+		revision: kv.nextRevision(),
+		gen:      gen,
+		timer:    time.AfterFunc(window, func() { kv.flushPending(key, gen) }),
+	}
+	return !exists
+}
+
+// pendingValue returns the value of an open coalescing window for key, unless the key has expired.
+// The caller must hold the lock.
+func (kv *KeyValueStore) pendingValue(key string) (string, bool) {
+	p, ok := kv.pending[key]
+	if !ok {
+		return "", false
+	}
+	if exp, ok := kv.expirations[key]; ok && time.Now().After(exp) {
+		return "", false
+	}
+	return p.value, true
+}
+
+// withPendingLocked returns versions, the history of key, followed by the write held in its coalescing
+// window as the version it is to be committed as, if there is one. versions is not modified. The caller
+// must hold the lock.
+func (kv *KeyValueStore) withPendingLocked(key string, versions []KeyValue) []KeyValue {
+	p, ok := kv.pending[key]
+	if !ok {
+		return versions
+	}
+	pending := KeyValue{Value: p.value, Timestamp: p.at, Collapsed: p.collapsed, Revision: p.revision}
+	return append(append(make([]KeyValue, 0, len(versions)+1), versions...), pending)
+}
+
+// pendingKeysLocked returns the keys created by writes still held in a coalescing window, which are not
+// in kv.data yet. The caller must hold the lock.
+func (kv *KeyValueStore) pendingKeysLocked() []string {
+	var keys []string
+	for key := range kv.pending {
+		if _, exists := kv.data[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// flushPending commits the pending write of key when the coalescing window gen closes. A later window
+// for the key, opened after the first was flushed early, is left to its own timer.
+func (kv *KeyValueStore) flushPending(key string, gen uint64) {
+	acquired := kv.lockWrite(OpSet)
+	defer kv.unlockWrite(OpSet, acquired)
+	if p, ok := kv.pending[key]; ok && p.gen == gen {
+		kv.flushPendingLocked(key)
+	}
+}
+
+// flushPendingNow commits the pending write of key, if any, without waiting for its window to close.
+func (kv *KeyValueStore) flushPendingNow(key string) {
+	acquired := kv.lockWrite(OpSet)
+	defer kv.unlockWrite(OpSet, acquired)
+	kv.flushPendingLocked(key)
+}
+
+// dropPendingLocked discards the pending write of key, if any, when the key expires with its window
+// still open. The caller must hold the write lock.
+func (kv *KeyValueStore) dropPendingLocked(key string) {
+	if p, ok := kv.pending[key]; ok {
+		p.timer.Stop()
+		delete(kv.pending, key)
+		kv.staleReads.mark(key)
+	}
+}
+
+// flushPendingLocked commits the pending write of key, if any, as a single version recording the
+// number of collapsed writes. The caller must hold the write lock.
+func (kv *KeyValueStore) flushPendingLocked(key string) {
+	p, ok := kv.pending[key]
+	if !ok {
+		return
+	}
+	p.timer.Stop()
+	delete(kv.pending, key)
+
+	kv.appendLocked(key, KeyValue{Value: p.value, Timestamp: p.at, Collapsed: p.collapsed, Revision: p.revision}, 0)
+	if p.collapsed > 0 {
+		log.Printf("flushPending: Collapsed %d writes to key '%s'\n", p.collapsed, key)
+	}
+}
+
+// flushAllPending commits every pending write, closing all coalescing windows.
+func (kv *KeyValueStore) flushAllPending() {
+	kv.Lock()
+	defer kv.Unlock()
+	for key := range kv.pending {
+		kv.flushPendingLocked(key)
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// compactBatchSize is the number of keys compacted per write lock hold.
+const compactBatchSize = 100
+
+// ErrInvalidKeep is returned by Compact when asked to keep fewer than one version per key.
+var ErrInvalidKeep = errors.New("keep must be at least 1")
+
+// Compact prunes the history of every key to at most keep versions and returns how many versions were removed.
+func (kv *KeyValueStore) Compact(keep int) (int, error) {
+	return kv.CompactContext(context.Background(), keep, nil)
+}
+
+// CompactContext is Compact reporting progress in keys, if progress is not nil, and stopping between batches
+// once ctx is canceled. Keys are compacted in batches under the write lock, so a canceled compaction leaves
+// every key either fully compacted or untouched.
+func (kv *KeyValueStore) CompactContext(ctx context.Context, keep int, progress func(done, total int)) (int, error) {
+	if keep < 1 {
+		return 0, fmt.Errorf("%w, got %d", ErrInvalidKeep, keep)
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, fmt.Errorf("data not loaded: %w", err)
+	}
+	if err := kv.admitMutation(); err != nil {
+		return 0, err
+	}
+
+	kv.RLock()
+	keys := make([]string, 0, len(kv.data)+len(kv.pending))
+	for key := range kv.data {
+		keys = append(keys, key)
+	}
+	for key := range kv.pending {
+		if _, exists := kv.data[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	kv.RUnlock()
+	sort.Strings(keys)
+
+	removed := 0
+	for start := 0; start < len(keys); start += compactBatchSize {
+		if err := ctx.Err(); err != nil {
+			log.Printf("Compact: Canceled after %d of %d keys, %d versions removed\n", start, len(keys), removed)
+			return removed, err
+		}
+		end := start + compactBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		n, err := kv.compactBatch(keys[start:end], keep)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+		if progress != nil {
+			progress(end, len(keys))
+		}
+	}
+
+	log.Printf("Compact: Removed %d versions from %d keys\n", removed, len(keys))
+	return removed, nil
+}
+
+// compactBatch prunes a batch of keys under the write lock, skipping keys deleted since they were listed.
+func (kv *KeyValueStore) compactBatch(keys []string, keep int) (int, error) {
+	acquired := kv.lockWrite(OpCleanup)
+	defer kv.unlockWrite(OpCleanup, acquired)
+
+	removed := 0
+	for _, key := range keys {
+		n, err := kv.pruneLocked(key, keep)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
@@ -8,9 +8,17 @@ import (
 
 // CompressData compresses the given data using the zlib compression algorithm.
 func CompressData(data []byte) ([]byte, error) {
+	return compressData(data, zlib.DefaultCompression)
+}
+
+// compressData compresses the given data with zlib at level.
+func compressData(data []byte, level int) ([]byte, error) {
 	var b bytes.Buffer
-	w := zlib.NewWriter(&b)
-	_, err := w.Write(data)
+	w, err := zlib.NewWriterLevel(&b, level)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(data)
 	if err != nil {
 		return nil, err
 	}
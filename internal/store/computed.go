@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrComputedKey is returned when a client writes or deletes a computed key without WithComputedOverride.
+var ErrComputedKey = errors.New("key is computed")
+
+// ReadView gives a computed key function read-only access to the store.
+type ReadView interface {
+	Get(key string) (string, error)
+	GetMulti(keys []string) (map[string]string, map[string]error)
+	GetHistory(key string) ([]KeyValue, error)
+	Keys() []string
+	Size() int
+}
+
+// ComputeFunc computes the value of a computed key from the rest of the store.
+type ComputeFunc func(kv ReadView) (string, error)
+
+// TickerFunc starts a ticker firing every interval, returning its channel and a function stopping it.
+// It lets tests drive computed key schedules without waiting.
+type TickerFunc func(every time.Duration) (ticks <-chan time.Time, stop func())
+
+// ComputedStatus describes a computed key and its recent runs.
+type ComputedStatus struct {
+	Key         string
+	Every       time.Duration
+	Runs        int       // Times the function ran
+	Failures    int       // Runs that failed, leaving the previous value in place
+	LastRun     time.Time // Time of the most recent run
+	LastSuccess time.Time // Time of the most recent successful run
+	LastError   string    // Why the most recent run failed; empty if it succeeded
+}
+
+// ComputedOption configures a computed key.
+type ComputedOption func(*computedKey)
+
+// ComputedTTL sets the TTL of each computed value; by default it is set without an explicit TTL.
+func ComputedTTL(ttl time.Duration) ComputedOption {
+	return func(c *computedKey) {
+		c.ttl = ttl
+	}
+}
+
+// computedKey is a registered computed key.
+type computedKey struct {
+	fn  ComputeFunc
+	ttl time.Duration
+
+	// Guarded by computedKeys.mu.
+	status ComputedStatus
+}
+
+// computedKeys holds the registered computed keys.
+type computedKeys struct {
+	mu   sync.RWMutex
+	keys map[string]*computedKey
+}
+
+// overrideKey is the context key marking a write allowed to replace a computed key.
+type overrideKey struct{}
+
+// WithComputedOverride returns a context whose writes may replace or delete computed keys.
+func WithComputedOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, overrideKey{}, true)
+}
+
+// readView exposes the read methods of a store without the rest of it.
+type readView struct {
+	kv *KeyValueStore
+}
+
+func (v readView) Get(key string) (string, error) { return v.kv.Get(key) }
+func (v readView) GetMulti(keys []string) (map[string]string, map[string]error) {
+	return v.kv.GetMulti(keys)
+}
+func (v readView) GetHistory(key string) ([]KeyValue, error) { return v.kv.GetHistory(key) }
+func (v readView) Keys() []string                            { return v.kv.Keys() }
+func (v readView) Size() int                                 { return v.kv.Size() }
+
+// defaultTicker is the TickerFunc backed by time.Ticker.
+func defaultTicker(every time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(every)
+	return ticker.C, ticker.Stop
+}
+
+// RegisterComputed makes key a computed key: fn runs right away and then every interval until the store stops,
+// and its result is set like any other write, creating a version and a notification. A failing run is logged,
+// counted in ComputedStats and sends a "computed_failed:<key>" notification, leaving the previous value in place.
+// Clients writing or deleting the key fail with ErrComputedKey unless the context has WithComputedOverride.
+func (kv *KeyValueStore) RegisterComputed(key string, every time.Duration, fn ComputeFunc, opts ...ComputedOption) error {
+	if every <= 0 {
+		return fmt.Errorf("RegisterComputed: interval must be positive, got %v", every)
+	}
+	select {
+	case <-kv.stopChan:
+		return fmt.Errorf("RegisterComputed: store is stopped")
+	default:
+	}
+
+	c := &computedKey{fn: fn, status: ComputedStatus{Key: key, Every: every}}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	kv.computed.mu.Lock()
+	if _, exists := kv.computed.keys[key]; exists {
+		kv.computed.mu.Unlock()
+		return fmt.Errorf("RegisterComputed: key '%s' is already computed", key)
+	}
+	if kv.computed.keys == nil {
+		kv.computed.keys = make(map[string]*computedKey)
+	}
+	kv.computed.keys[key] = c
+	kv.computed.mu.Unlock()
+
+	ticks, stop := kv.newTicker(every)
+	kv.backgroundWG.Add(1)
+	go func() {
+		defer kv.backgroundWG.Done()
+		defer stop()
+		kv.recompute(key, c)
+		for {
+			select {
+			case <-ticks:
+				kv.recompute(key, c)
+			case <-kv.stopChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// recompute runs the function of a computed key and sets its result.
+func (kv *KeyValueStore) recompute(key string, c *computedKey) {
+	value, err := kv.runCompute(c.fn)
+	if err == nil {
+		err = kv.set(WithComputedOverride(context.Background()), key, value, c.ttl)
+	}
+
+	now := time.Now()
+	kv.computed.mu.Lock()
+	c.status.Runs++
+	c.status.LastRun = now
+	if err != nil {
+		c.status.Failures++
+		c.status.LastError = err.Error()
+	} else {
+		c.status.LastSuccess = now
+		c.status.LastError = ""
+	}
+	kv.computed.mu.Unlock()
+
+	if err != nil {
+		log.Printf("RegisterComputed: Failed to compute key '%s', keeping the previous value: %v\n", key, err)
+		kv.notificationManager.Notify("computed_failed:" + key)
+	}
+}
+
+// runCompute calls fn, turning a panic into an error so a broken function does not take down the store.
+func (kv *KeyValueStore) runCompute(fn ComputeFunc) (value string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(readView{kv})
+}
+
+// checkComputed returns ErrComputedKey if key is computed and ctx does not override it.
+func (kv *KeyValueStore) checkComputed(ctx context.Context, key string) error {
+	kv.computed.mu.RLock()
+	_, computed := kv.computed.keys[key]
+	kv.computed.mu.RUnlock()
+	if !computed {
+		return nil
+	}
+	if override, _ := ctx.Value(overrideKey{}).(bool); override {
+		return nil
+	}
+	return fmt.Errorf("%w: '%s'", ErrComputedKey, key)
+}
+
+// IsComputed reports whether key is a registered computed key.
+func (kv *KeyValueStore) IsComputed(key string) bool {
+	kv.computed.mu.RLock()
+	defer kv.computed.mu.RUnlock()
+	_, computed := kv.computed.keys[key]
+	return computed
+}
+
+// ComputedStats returns the status of every computed key, sorted by key.
+func (kv *KeyValueStore) ComputedStats() []ComputedStatus {
+	kv.computed.mu.RLock()
+	defer kv.computed.mu.RUnlock()
+	statuses := make([]ComputedStatus, 0, len(kv.computed.keys))
+	for _, c := range kv.computed.keys {
+		statuses = append(statuses, c.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Key < statuses[j].Key })
+	return statuses
+}
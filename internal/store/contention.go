@@ -0,0 +1,248 @@
+package store
+
+import (
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Operations reported in contention profiles in addition to OpGet, OpSet and OpSave.
+const (
+	OpDelete              Op = "delete"
+	OpCompareAndSwap      Op = "compare_and_swap"
+	OpMultiCompareAndSwap Op = "multi_compare_and_swap"
+	OpKeys                Op = "keys"
+	OpSize                Op = "size"
+	OpCleanup             Op = "cleanup"
+	OpExpire              Op = "expire"
+	OpNamespace           Op = "namespace"
+)
+
+// Lock modes reported in contention profiles.
+const (
+	LockRead  = "read"
+	LockWrite = "write"
+)
+
+const (
+	// lockSampleEvery times one out of every lockSampleEvery acquisitions by frequent operations,
+	// keeping the clock reads off most of the hot path. Saves and cleanup sweeps are always timed.
+	lockSampleEvery = 8
+	// lockWaitSamples is the number of recent lock waits kept per operation for percentiles.
+	lockWaitSamples = 256
+	// maxLockHolds is the number of longest lock holds kept in the report.
+	maxLockHolds = 10
+	// slowHoldStackLines limits the stack snippet logged with slow-hold warnings.
+	slowHoldStackLines = 12
+)
+
+// LockWait summarizes the recent time an operation spent waiting for the store lock.
+type LockWait struct {
+	Op    Op
+	Mode  string
+	Count uint64 // Timed acquisitions since the store was created
+	P50   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// LockHold is a single critical section, timed from acquisition to release.
+type LockHold struct {
+	Op       Op
+	Mode     string
+	Duration time.Duration
+	At       time.Time
+}
+
+// ContentionReport lists operations by their worst recent lock waits and the longest lock holds.
+type ContentionReport struct {
+	Waits        []LockWait // Sorted by P99 wait, worst first
+	LongestHolds []LockHold // Sorted by duration, longest first
+}
+
+type lockKey struct {
+	op   Op
+	mode string
+}
+
+// waitSamples is a lock-free ring buffer of the most recent lock waits of one operation.
+type waitSamples struct {
+	samples [lockWaitSamples]atomic.Int64
+	count   atomic.Uint64
+}
+
+// lockProfiler records lock waits and holds.
+type lockProfiler struct {
+	slowHold time.Duration
+	ticks    atomic.Uint64
+
+	waits sync.Map // lockKey -> *waitSamples
+
+	// minHold is the shortest hold in a full holds list, letting shorter holds skip the mutex.
+	minHold atomic.Int64
+	mu      sync.Mutex
+	holds   []LockHold
+}
+
+// newLockProfiler creates a lock profiler warning about holds longer than slowHold, if positive.
+func newLockProfiler(slowHold time.Duration) *lockProfiler {
+	return &lockProfiler{slowHold: slowHold}
+}
+
+// sample reports whether this acquisition by op should be timed.
+func (p *lockProfiler) sample(op Op) bool {
+	if op == OpSave || op == OpCleanup || op == OpExpire || op == OpNamespace {
+		return true
+	}
+	return p.ticks.Add(1)%lockSampleEvery == 0
+}
+
+// recordWait adds a lock wait sample for op.
+func (p *lockProfiler) recordWait(op Op, mode string, wait time.Duration) {
+	key := lockKey{op, mode}
+	v, ok := p.waits.Load(key)
+	if !ok {
+		v, _ = p.waits.LoadOrStore(key, &waitSamples{})
+	}
+	ws := v.(*waitSamples)
+	n := ws.count.Add(1)
+	ws.samples[(n-1)%lockWaitSamples].Store(int64(wait))
+}
+
+// recordHold keeps the hold if it is among the longest seen and warns when it exceeds the threshold.
+func (p *lockProfiler) recordHold(op Op, mode string, hold time.Duration) {
+	if p.slowHold > 0 && hold >= p.slowHold {
+		log.Printf("lock: Slow %s hold by %s took %v\n%s", mode, op, hold, stackSnippet())
+	}
+
+	if int64(hold) <= p.minHold.Load() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.holds) == maxLockHolds && hold <= p.holds[len(p.holds)-1].Duration {
+		return
+	}
+	p.holds = append(p.holds, LockHold{Op: op, Mode: mode, Duration: hold, At: time.Now()})
+	sort.Slice(p.holds, func(i, j int) bool { return p.holds[i].Duration > p.holds[j].Duration })
+	if len(p.holds) > maxLockHolds {
+		p.holds = p.holds[:maxLockHolds]
+	}
+	if len(p.holds) == maxLockHolds {
+		p.minHold.Store(int64(p.holds[len(p.holds)-1].Duration))
+	}
+}
+
+// report builds a contention report from the recorded samples.
+func (p *lockProfiler) report() ContentionReport {
+	var report ContentionReport
+	p.waits.Range(func(k, v any) bool {
+		key, ws := k.(lockKey), v.(*waitSamples)
+		count := ws.count.Load()
+		n := int(count)
+		if n > lockWaitSamples {
+			n = lockWaitSamples
+		}
+		if n == 0 {
+			// No sample yet, as the first wait on this lock is still being recorded.
+			return true
+		}
+		sorted := make([]time.Duration, n)
+		for i := range sorted {
+			sorted[i] = time.Duration(ws.samples[i].Load())
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		report.Waits = append(report.Waits, LockWait{
+			Op:    key.op,
+			Mode:  key.mode,
+			Count: count,
+			P50:   sorted[(n-1)*50/100],
+			P99:   sorted[(n-1)*99/100],
+			Max:   sorted[n-1],
+		})
+		return true
+	})
+	sort.Slice(report.Waits, func(i, j int) bool {
+		if report.Waits[i].P99 != report.Waits[j].P99 {
+			return report.Waits[i].P99 > report.Waits[j].P99
+		}
+		return report.Waits[i].Op < report.Waits[j].Op
+	})
+	p.mu.Lock()
+	report.LongestHolds = append([]LockHold(nil), p.holds...)
+	p.mu.Unlock()
+	return report
+}
+
+// stackSnippet returns the first lines of the calling goroutine's stack.
+func stackSnippet() string {
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	lines := strings.SplitN(string(buf), "\n", slowHoldStackLines+1)
+	if len(lines) > slowHoldStackLines {
+		lines = lines[:slowHoldStackLines]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lockWrite acquires the write lock for op and returns the acquisition time if the acquisition is timed.
+func (kv *KeyValueStore) lockWrite(op Op) time.Time {
+	if kv.contention == nil || !kv.contention.sample(op) {
+		kv.Lock()
+		return time.Time{}
+	}
+	start := time.Now()
+	kv.Lock()
+	acquired := time.Now()
+	kv.contention.recordWait(op, LockWrite, acquired.Sub(start))
+	return acquired
+}
+
+// unlockWrite releases the write lock taken by lockWrite.
+func (kv *KeyValueStore) unlockWrite(op Op, acquired time.Time) {
+	if acquired.IsZero() {
+		kv.Unlock()
+		return
+	}
+	hold := time.Since(acquired)
+	kv.Unlock()
+	kv.contention.recordHold(op, LockWrite, hold)
+}
+
+// lockRead acquires the read lock for op and returns the acquisition time if the acquisition is timed.
+func (kv *KeyValueStore) lockRead(op Op) time.Time {
+	if kv.contention == nil || !kv.contention.sample(op) {
+		kv.RLock()
+		return time.Time{}
+	}
+	start := time.Now()
+	kv.RLock()
+	acquired := time.Now()
+	kv.contention.recordWait(op, LockRead, acquired.Sub(start))
+	return acquired
+}
+
+// unlockRead releases the read lock taken by lockRead.
+func (kv *KeyValueStore) unlockRead(op Op, acquired time.Time) {
+	if acquired.IsZero() {
+		kv.RUnlock()
+		return
+	}
+	hold := time.Since(acquired)
+	kv.RUnlock()
+	kv.contention.recordHold(op, LockRead, hold)
+}
+
+// ContentionReport returns the operations with the worst recent lock waits and the longest lock holds.
+// It is empty unless the store was created with WithContentionProfiling.
+func (kv *KeyValueStore) ContentionReport() ContentionReport {
+	if kv.contention == nil {
+		return ContentionReport{}
+	}
+	return kv.contention.report()
+}
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// defaultDedupThreshold is the smallest value, in bytes, WithValueDeduplication pools by default.
+const defaultDedupThreshold = 256
+
+// poolRecord is the reserved key under which snapshots of a store using WithValueDeduplication keep each
+// pooled value once, referenced by the versions holding it. It never appears among the store's keys.
+const poolRecord = "\x00pool"
+
+// pooledValue is a value shared by the versions referencing it.
+type pooledValue struct {
+	hash  [sha256.Size]byte
+	value string
+	refs  int
+}
+
+// valuePool holds each distinct large value of a store once, by SHA-256, counting the versions referencing it.
+type valuePool struct {
+	threshold int
+	blobs     map[[sha256.Size]byte]*pooledValue
+	held      map[string][]*pooledValue // Pooled value of each version of a key, nil for versions not pooled
+}
+
+// DedupStats describes the values shared by WithValueDeduplication.
+type DedupStats struct {
+	Enabled      bool
+	PoolValues   int     // Distinct values in the pool
+	PoolBytes    int64   // Bytes of the pooled values, each counted once
+	References   int     // Versions referencing a pooled value
+	LogicalBytes int64   // Bytes the referencing versions would take as separate copies
+	BytesSaved   int64   // LogicalBytes minus PoolBytes
+	Ratio        float64 // LogicalBytes over PoolBytes; 1 when nothing is shared
+}
+
+// newValuePool returns an empty pool of values of at least threshold bytes.
+func newValuePool(threshold int) *valuePool {
+	return &valuePool{
+		threshold: threshold,
+		blobs:     make(map[[sha256.Size]byte]*pooledValue),
+		held:      make(map[string][]*pooledValue),
+	}
+}
+
+// pools reports whether version is stored in the pool. Deltas are specific to their version and never are.
+func (p *valuePool) pools(version KeyValue) bool {
+	return !version.Delta && len(version.Value) >= p.threshold
+}
+
+// intern returns the pooled copy of value, adding it to the pool without references if it is new.
+func (p *valuePool) intern(value string) *pooledValue {
+	hash := sha256.Sum256([]byte(value))
+	if pooled, exists := p.blobs[hash]; exists {
+		return pooled
+	}
+	pooled := &pooledValue{hash: hash, value: value}
+	p.blobs[hash] = pooled
+	return pooled
+}
+
+// release drops a reference to pooled, removing it from the pool with its last reference.
+func (p *valuePool) release(pooled *pooledValue) {
+	pooled.refs--
+	if pooled.refs <= 0 {
+		delete(p.blobs, pooled.hash)
+	}
+}
+
+// dedupKeyLocked points the versions of key at the pooled copies of their values and moves the references
+// it held to the values it holds now. It is called after every change to the history of key, including its
+// removal. The caller must hold the write lock.
+func (kv *KeyValueStore) dedupKeyLocked(key string) {
+	p := kv.valuePool
+	if p == nil {
+		return
+	}
+	old := p.held[key]
+	versions := kv.data[key]
+
+	var held []*pooledValue
+	for i := range versions {
+		if !p.pools(versions[i]) {
+			continue
+		}
+		if held == nil {
+			held = make([]*pooledValue, len(versions))
+		}
+		// Versions already pointing at their pooled value compare equal without reading the bytes.
+		if i < len(old) && old[i] != nil && old[i].value == versions[i].Value {
+			held[i] = old[i]
+		} else {
+			held[i] = p.intern(versions[i].Value)
+		}
+		held[i].refs++
+		versions[i].Value = held[i].value
+	}
+	for _, pooled := range old {
+		if pooled != nil {
+			p.release(pooled)
+		}
+	}
+
+	if held == nil {
+		delete(p.held, key)
+	} else {
+		p.held[key] = held
+	}
+}
+
+// dedupResetLocked rebuilds the pool after the store contents were replaced. The caller must hold the write lock.
+func (kv *KeyValueStore) dedupResetLocked() {
+	p := kv.valuePool
+	if p == nil {
+		return
+	}
+	p.blobs = make(map[[sha256.Size]byte]*pooledValue)
+	p.held = make(map[string][]*pooledValue)
+	for key := range kv.data {
+		kv.dedupKeyLocked(key)
+	}
+}
+
+// withPool returns histories with every pooled value replaced by a reference to its SHA-256, and the pooled
+// values once each under the reserved pool record. Histories are returned unchanged if the store does not
+// use WithValueDeduplication.
+func (kv *KeyValueStore) withPool(histories map[string][]KeyValue) map[string][]KeyValue {
+	p := kv.valuePool
+	if p == nil {
+		return histories
+	}
+
+	written := make(map[[sha256.Size]byte]bool)
+	var record []KeyValue
+	withPool := make(map[string][]KeyValue, len(histories)+1)
+	for key, versions := range histories {
+		held := p.held[key]
+		var refs []KeyValue
+		for i, version := range versions {
+			if !p.pools(version) {
+				continue
+			}
+			if refs == nil {
+				refs = append([]KeyValue(nil), versions...)
+			}
+			var hash [sha256.Size]byte
+			if len(held) == len(versions) && held[i] != nil && held[i].value == version.Value {
+				hash = held[i].hash
+			} else {
+				// Histories with offloaded versions restored do not line up with the pool.
+				hash = sha256.Sum256([]byte(version.Value))
+			}
+			if !written[hash] {
+				written[hash] = true
+				record = append(record, KeyValue{Value: version.Value})
+			}
+			refs[i].Value, refs[i].Ref = "", hex.EncodeToString(hash[:])
+		}
+		if refs == nil {
+			refs = versions
+		}
+		withPool[key] = refs
+	}
+	if len(record) > 0 {
+		withPool[poolRecord] = record
+	}
+	return withPool
+}
+
+// expandPool replaces the references in histories with the pooled values they name and removes the reserved
+// pool record. Versions referencing the same value share its memory, whether or not the store pools values.
+func expandPool(histories map[string][]KeyValue) error {
+	values := make(map[string]string)
+	for _, version := range histories[poolRecord] {
+		hash := sha256.Sum256([]byte(version.Value))
+		values[hex.EncodeToString(hash[:])] = version.Value
+	}
+	delete(histories, poolRecord)
+
+	for key, versions := range histories {
+		for i := range versions {
+			if versions[i].Ref == "" {
+				continue
+			}
+			value, found := values[versions[i].Ref]
+			if !found {
+				return fmt.Errorf("version %d of key '%s' references value %s missing from the pool", i, key, versions[i].Ref)
+			}
+			versions[i].Value, versions[i].Ref = value, ""
+		}
+	}
+	return nil
+}
+
+// DedupStats returns the size of the value pool and how much sharing values saves.
+func (kv *KeyValueStore) DedupStats() DedupStats {
+	kv.RLock()
+	defer kv.RUnlock()
+	p := kv.valuePool
+	if p == nil {
+		return DedupStats{}
+	}
+
+	stats := DedupStats{Enabled: true, PoolValues: len(p.blobs), Ratio: 1}
+	for _, pooled := range p.blobs {
+		size := int64(len(pooled.value))
+		stats.PoolBytes += size
+		stats.References += pooled.refs
+		stats.LogicalBytes += size * int64(pooled.refs)
+	}
+	stats.BytesSaved = stats.LogicalBytes - stats.PoolBytes
+	if stats.PoolBytes > 0 {
+		stats.Ratio = float64(stats.LogicalBytes) / float64(stats.PoolBytes)
+	}
+	return stats
+}
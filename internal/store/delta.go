@@ -0,0 +1,297 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// defaultKeyframeEvery is how often a full version is kept in a delta-encoded history.
+const defaultKeyframeEvery = 16
+
+// deltaRule delta-encodes the histories of keys starting with prefix, keeping every keyframeEvery-th
+// version, counted from the oldest, in full.
+type deltaRule struct {
+	prefix        string
+	keyframeEvery int
+}
+
+// DeltaStats describes the space saved by delta-encoded histories.
+type DeltaStats struct {
+	Keys          int   // Keys holding at least one delta-encoded version
+	DeltaVersions int   // Versions stored as deltas
+	StoredBytes   int64 // Bytes of the values as stored, deltas included
+	FullBytes     int64 // Bytes the same values would take stored in full
+	BytesSaved    int64 // FullBytes minus StoredBytes
+}
+
+// deltaRuleFor returns the rule of the longest prefix matching key, or nil if its history is stored in full.
+func (kv *KeyValueStore) deltaRuleFor(key string) *deltaRule {
+	var match *deltaRule
+	for i := range kv.deltaRules {
+		rule := &kv.deltaRules[i]
+		if strings.HasPrefix(key, rule.prefix) && (match == nil || len(rule.prefix) > len(match.prefix)) {
+			match = rule
+		}
+	}
+	return match
+}
+
+// deltaEncodePreviousLocked stores the version before the latest of key as a delta against the latest,
+// unless it is a keyframe. The caller must hold the write lock.
+func (kv *KeyValueStore) deltaEncodePreviousLocked(key string) {
+	rule := kv.deltaRuleFor(key)
+	versions := kv.data[key]
+	prev := len(versions) - 2
+	if rule == nil || prev < 0 || prev%rule.keyframeEvery == 0 || versions[prev].Delta {
+		return
+	}
+	if delta, ok := makeDelta(versions[prev+1].Value, versions[prev].Value); ok {
+		versions[prev].Value = delta
+		versions[prev].Delta = true
+	}
+}
+
+// encodeDeltas returns full, a history without deltas, delta-encoded according to the rule for key.
+func (kv *KeyValueStore) encodeDeltas(key string, full []KeyValue) []KeyValue {
+	rule := kv.deltaRuleFor(key)
+	if rule == nil {
+		return full
+	}
+	encoded := append([]KeyValue(nil), full...)
+	for i := 0; i < len(full)-1; i++ {
+		if i%rule.keyframeEvery == 0 {
+			continue
+		}
+		if delta, ok := makeDelta(full[i+1].Value, full[i].Value); ok {
+			encoded[i].Value = delta
+			encoded[i].Delta = true
+		}
+	}
+	return encoded
+}
+
+// rewriteHistoryLocked replaces the history of key with rewrite applied to its full versions, re-basing
+// the deltas. The caller must hold the write lock.
+func (kv *KeyValueStore) rewriteHistoryLocked(key string, rewrite func(full []KeyValue) []KeyValue) error {
+	full, err := materializeVersions(kv.data[key])
+	if err != nil {
+		return fmt.Errorf("error reconstructing history of key '%s': %v", key, err)
+	}
+	kv.data[key] = kv.encodeDeltas(key, rewrite(full))
+	return nil
+}
+
+// rebaseDeltasLocked delta-encodes every history matching a delta rule, such as after loading data stored
+// in full. The caller must hold the write lock.
+func (kv *KeyValueStore) rebaseDeltasLocked() {
+	if len(kv.deltaRules) == 0 {
+		return
+	}
+	for key := range kv.data {
+		if kv.deltaRuleFor(key) == nil {
+			continue
+		}
+		if err := kv.rewriteHistoryLocked(key, func(full []KeyValue) []KeyValue { return full }); err != nil {
+			log.Printf("load: Keeping history as stored: %v\n", err)
+		}
+	}
+}
+
+// DeltaStats returns how many versions are delta-encoded and the bytes saved by storing them as deltas.
+func (kv *KeyValueStore) DeltaStats() DeltaStats {
+	kv.RLock()
+	defer kv.RUnlock()
+	var stats DeltaStats
+	for _, versions := range kv.data {
+		if !hasDeltas(versions) {
+			continue
+		}
+		full, err := materializeVersions(versions)
+		if err != nil {
+			continue
+		}
+		stats.Keys++
+		for i, version := range versions {
+			if version.Delta {
+				stats.DeltaVersions++
+			}
+			stats.StoredBytes += int64(len(version.Value))
+			stats.FullBytes += int64(len(full[i].Value))
+		}
+	}
+	stats.BytesSaved = stats.FullBytes - stats.StoredBytes
+	return stats
+}
+
+// hasDeltas reports whether any of versions is delta-encoded.
+func hasDeltas(versions []KeyValue) bool {
+	for _, version := range versions {
+		if version.Delta {
+			return true
+		}
+	}
+	return false
+}
+
+// versionValue returns the full value of versions[i], applying the deltas from the nearest full version after it.
+func versionValue(versions []KeyValue, i int) (string, error) {
+	j := i
+	for j < len(versions) && versions[j].Delta {
+		j++
+	}
+	if j == len(versions) {
+		return "", fmt.Errorf("delta-encoded version %d has no full version after it", i)
+	}
+	value := versions[j].Value
+	for k := j - 1; k >= i; k-- {
+		var err error
+		if value, err = applyDelta(value, versions[k].Value); err != nil {
+			return "", fmt.Errorf("version %d: %v", k, err)
+		}
+	}
+	return value, nil
+}
+
+// materializeVersions returns a copy of versions with every delta replaced by the full value.
+func materializeVersions(versions []KeyValue) ([]KeyValue, error) {
+	full := append([]KeyValue(nil), versions...)
+	if !hasDeltas(versions) {
+		return full, nil
+	}
+	if versions[len(versions)-1].Delta {
+		return nil, fmt.Errorf("latest version is delta-encoded")
+	}
+	for k := len(full) - 2; k >= 0; k-- {
+		if !full[k].Delta {
+			continue
+		}
+		value, err := applyDelta(full[k+1].Value, full[k].Value)
+		if err != nil {
+			return nil, fmt.Errorf("version %d: %v", k, err)
+		}
+		full[k].Value = value
+		full[k].Delta = false
+	}
+	return full, nil
+}
+
+// splitLines splits s into lines, each keeping its trailing newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// makeDelta returns a line-based delta turning base into target, and false if it would not be smaller
+// than target. A delta is a sequence of "=start,count\n" operations copying lines of base and
+// "+count\n" operations followed by count literal lines.
+func makeDelta(base, target string) (string, bool) {
+	baseLines := splitLines(base)
+	positions := make(map[string][]int, len(baseLines))
+	for i, line := range baseLines {
+		positions[line] = append(positions[line], i)
+	}
+
+	var delta strings.Builder
+	var literal []string
+	flush := func() {
+		if len(literal) > 0 {
+			delta.WriteString("+" + strconv.Itoa(len(literal)) + "\n")
+			for _, line := range literal {
+				delta.WriteString(line)
+			}
+			literal = literal[:0]
+		}
+	}
+
+	targetLines := splitLines(target)
+	next := 0 // Line of base following the last copied run
+	for t := 0; t < len(targetLines); {
+		start := -1
+		if next < len(baseLines) && baseLines[next] == targetLines[t] {
+			start = next
+		} else if candidates := positions[targetLines[t]]; len(candidates) > 0 {
+			start = candidates[0]
+			for _, c := range candidates {
+				if c >= next {
+					start = c
+					break
+				}
+			}
+		}
+		if start < 0 {
+			literal = append(literal, targetLines[t])
+			t++
+			if delta.Len() >= len(target) {
+				return "", false
+			}
+			continue
+		}
+
+		count := 0
+		for start+count < len(baseLines) && t+count < len(targetLines) && baseLines[start+count] == targetLines[t+count] {
+			count++
+		}
+		flush()
+		delta.WriteString("=" + strconv.Itoa(start) + "," + strconv.Itoa(count) + "\n")
+		t += count
+		next = start + count
+	}
+	flush()
+
+	if delta.Len() >= len(target) {
+		return "", false
+	}
+	return delta.String(), true
+}
+
+// applyDelta reverses makeDelta, turning base into the target the delta was made for.
+func applyDelta(base, delta string) (string, error) {
+	baseLines := splitLines(base)
+	var out strings.Builder
+	for delta != "" {
+		header, rest, ok := strings.Cut(delta, "\n")
+		if !ok || len(header) < 2 {
+			return "", fmt.Errorf("malformed delta operation %q", header)
+		}
+		delta = rest
+		switch header[0] {
+		case '=':
+			startText, countText, _ := strings.Cut(header[1:], ",")
+			start, err1 := strconv.Atoi(startText)
+			count, err2 := strconv.Atoi(countText)
+			if err1 != nil || err2 != nil || start < 0 || count < 0 || start+count > len(baseLines) {
+				return "", fmt.Errorf("malformed delta copy %q", header)
+			}
+			for _, line := range baseLines[start : start+count] {
+				out.WriteString(line)
+			}
+		case '+':
+			count, err := strconv.Atoi(header[1:])
+			if err != nil || count < 0 {
+				return "", fmt.Errorf("malformed delta insert %q", header)
+			}
+			for i := 0; i < count; i++ {
+				line, rest, found := strings.Cut(delta, "\n")
+				if !found {
+					// Only the last line of a value lacks a newline.
+					if i != count-1 {
+						return "", fmt.Errorf("delta insert ends after %d of %d lines", i, count)
+					}
+					out.WriteString(delta)
+					delta = ""
+					break
+				}
+				out.WriteString(line + "\n")
+				delta = rest
+			}
+		default:
+			return "", fmt.Errorf("malformed delta operation %q", header)
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxLineDiffCells bounds the line pairs a line diff compares; larger values are diffed as a whole
+// replacement after their common leading and trailing lines.
+const maxLineDiffCells = 4 << 20
+
+// VersionDiff is the difference between two versions of a key: a field-level diff when both are JSON
+// objects, and a line diff otherwise.
+type VersionDiff struct {
+	Key    string
+	From   int // Version compared from
+	To     int // Version compared to
+	JSON   bool
+	Fields []FieldChange // Changed fields ordered by path, if JSON is set
+	Lines  []LineChange  // Every line of both versions in order, if JSON is not set
+}
+
+// FieldChange is a field of a JSON object added, removed or changed between two versions. Nested objects
+// are compared field by field, with paths joined by dots; arrays and other values are compared whole.
+type FieldChange struct {
+	Path     string
+	Type     string          // "added", "removed" or "changed"
+	OldValue json.RawMessage `json:",omitempty"`
+	NewValue json.RawMessage `json:",omitempty"`
+}
+
+// LineChange is a line of a line diff, with its trailing newline if it had one.
+type LineChange struct {
+	Type string // "unchanged", "added" or "removed"
+	Line string
+}
+
+// Changed reports whether the versions differ.
+func (d VersionDiff) Changed() bool {
+	if d.JSON {
+		return len(d.Fields) > 0
+	}
+	for _, line := range d.Lines {
+		if line.Type != "unchanged" {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the diff with a line per change, prefixed by +, - or ~ for changed fields, and with the
+// unchanged lines of a line diff prefixed by a space.
+func (d VersionDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: version %d -> %d\n", d.Key, d.From, d.To)
+	for _, f := range d.Fields {
+		switch f.Type {
+		case "added":
+			fmt.Fprintf(&b, "+ %s: %s\n", f.Path, f.NewValue)
+		case "removed":
+			fmt.Fprintf(&b, "- %s: %s\n", f.Path, f.OldValue)
+		default:
+			fmt.Fprintf(&b, "~ %s: %s -> %s\n", f.Path, f.OldValue, f.NewValue)
+		}
+	}
+	for _, l := range d.Lines {
+		prefix := "  "
+		switch l.Type {
+		case "added":
+			prefix = "+ "
+		case "removed":
+			prefix = "- "
+		}
+		b.WriteString(prefix + strings.TrimSuffix(l.Line, "\n") + "\n")
+	}
+	return b.String()
+}
+
+// DiffVersions compares versions from and to of key, as numbered by GetVersion. It returns
+// ErrVersionNotFound if either does not exist.
+func (kv *KeyValueStore) DiffVersions(key string, from, to int) (VersionDiff, error) {
+	values, err := kv.GetAllVersions(key)
+	if err != nil {
+		return VersionDiff{}, err
+	}
+	for _, version := range []int{from, to} {
+		if version < 0 || version >= len(values) {
+			return VersionDiff{}, fmt.Errorf("version %d of key '%s': %w", version, key, ErrVersionNotFound)
+		}
+	}
+
+	diff := VersionDiff{Key: key, From: from, To: to}
+	oldObject, oldOK := decodeObject(values[from])
+	newObject, newOK := decodeObject(values[to])
+	if oldOK && newOK {
+		diff.JSON = true
+		diff.Fields = diffObjects("", oldObject, newObject, nil)
+		sort.Slice(diff.Fields, func(i, j int) bool { return diff.Fields[i].Path < diff.Fields[j].Path })
+		return diff, nil
+	}
+	diff.Lines = diffLines(splitLines(values[from]), splitLines(values[to]))
+	return diff, nil
+}
+
+// decodeObject parses value as a JSON object, keeping numbers as written.
+func decodeObject(value string) (map[string]any, bool) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil || object == nil || decoder.More() {
+		return nil, false
+	}
+	return object, true
+}
+
+// diffObjects appends the changes between two JSON objects to changes, with paths under prefix.
+func diffObjects(prefix string, before, after map[string]any, changes []FieldChange) []FieldChange {
+	for field, oldValue := range before {
+		path := prefix + field
+		newValue, ok := after[field]
+		if !ok {
+			changes = append(changes, FieldChange{Path: path, Type: "removed", OldValue: rawJSON(oldValue)})
+			continue
+		}
+		oldChild, oldIsObject := oldValue.(map[string]any)
+		newChild, newIsObject := newValue.(map[string]any)
+		if oldIsObject && newIsObject {
+			changes = diffObjects(path+".", oldChild, newChild, changes)
+		} else if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, FieldChange{Path: path, Type: "changed", OldValue: rawJSON(oldValue), NewValue: rawJSON(newValue)})
+		}
+	}
+	for field, newValue := range after {
+		if _, ok := before[field]; !ok {
+			changes = append(changes, FieldChange{Path: prefix + field, Type: "added", NewValue: rawJSON(newValue)})
+		}
+	}
+	return changes
+}
+
+// rawJSON encodes a decoded JSON value compactly.
+func rawJSON(value any) json.RawMessage {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n"))
+}
+
+// diffLines returns a line diff of before and after based on their longest common subsequence.
+func diffLines(before, after []string) []LineChange {
+	var head, tail []LineChange
+	for len(before) > 0 && len(after) > 0 && before[0] == after[0] {
+		head = append(head, LineChange{Type: "unchanged", Line: before[0]})
+		before, after = before[1:], after[1:]
+	}
+	for len(before) > 0 && len(after) > 0 && before[len(before)-1] == after[len(after)-1] {
+		tail = append(tail, LineChange{Type: "unchanged", Line: before[len(before)-1]})
+		before, after = before[:len(before)-1], after[:len(after)-1]
+	}
+
+	changes := head
+	if len(before)*len(after) > maxLineDiffCells {
+		for _, line := range before {
+			changes = append(changes, LineChange{Type: "removed", Line: line})
+		}
+		for _, line := range after {
+			changes = append(changes, LineChange{Type: "added", Line: line})
+		}
+	} else {
+		// common[i][j] is the length of the longest common subsequence of before[i:] and after[j:].
+		common := make([][]int, len(before)+1)
+		for i := range common {
+			common[i] = make([]int, len(after)+1)
+		}
+		for i := len(before) - 1; i >= 0; i-- {
+			for j := len(after) - 1; j >= 0; j-- {
+				if before[i] == after[j] {
+					common[i][j] = common[i+1][j+1] + 1
+				} else {
+					common[i][j] = max(common[i+1][j], common[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(before) || j < len(after) {
+			switch {
+			case i < len(before) && j < len(after) && before[i] == after[j]:
+				changes = append(changes, LineChange{Type: "unchanged", Line: before[i]})
+				i++
+				j++
+			case j == len(after) || (i < len(before) && common[i+1][j] >= common[i][j+1]):
+				changes = append(changes, LineChange{Type: "removed", Line: before[i]})
+				i++
+			default:
+				changes = append(changes, LineChange{Type: "added", Line: after[j]})
+				j++
+			}
+		}
+	}
+
+	for k := len(tail) - 1; k >= 0; k-- {
+		changes = append(changes, tail[k])
+	}
+	return changes
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultCommitDelay is how long a durable flush waits for other durable writes to join it.
+const defaultCommitDelay = time.Millisecond
+
+// DurabilityStats counts durable and ordinary writes and the saves made for durable writes.
+type DurabilityStats struct {
+	SyncWrites   uint64        // Writes through SetDurable
+	AsyncWrites  uint64        // Writes through Set
+	Flushes      uint64        // Saves run for durable writes
+	AvgFlushWait time.Duration // Average time SetDurable waited for its save
+}
+
+// groupCommit lets concurrent durable writes share saves: a writer waits for the first save that starts
+// after its write, running one itself only if no save is in flight.
+type groupCommit struct {
+	delay     time.Duration
+	mu        sync.Mutex
+	cond      *sync.Cond
+	flushing  bool
+	saves     atomic.Uint64 // Number of saves started, including those not made for durable writes
+	completed uint64        // Number of completed durable flushes
+	covered   uint64        // Number of the latest successful save
+	lastErr   error         // Error of the last completed save
+
+	syncWrites  atomic.Uint64
+	asyncWrites atomic.Uint64
+	flushes     atomic.Uint64
+	waitNanos   atomic.Int64
+}
+
+// newGroupCommit creates an idle group commit barrier waiting delay for durable writes to join a save.
+func newGroupCommit(delay time.Duration) *groupCommit {
+	g := &groupCommit{delay: delay}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// SetDurable sets key like Set and returns only once the write has been saved to the backend or
+// record persister. Concurrent durable writes are persisted by a shared save rather than one each.
+func (kv *KeyValueStore) SetDurable(key, value string, expiration time.Duration) error {
+	if err := kv.set(context.Background(), key, value, expiration); err != nil {
+		return err
+	}
+	kv.commits.syncWrites.Add(1)
+	// A coalesced write is only pending; commit it so the save covers it.
+	kv.flushPendingNow(key)
+
+	start := time.Now()
+	err := kv.waitForSave(kv.commits.saves.Load() + 1)
+	kv.commits.waitNanos.Add(int64(time.Since(start)))
+	return err
+}
+
+// waitForSave blocks until save number save or a later one has succeeded. It fails if a save completing
+// while it waits fails, since the write may then not be persisted.
+func (kv *KeyValueStore) waitForSave(save uint64) error {
+	g := kv.commits
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	completed := g.completed
+	for g.covered < save {
+		if g.completed > completed && g.lastErr != nil {
+			return g.lastErr
+		}
+		if g.flushing {
+			g.cond.Wait()
+			continue
+		}
+
+		g.flushing = true
+		g.mu.Unlock()
+		// Give writers queued behind the previous save time to finish and join this one.
+		time.Sleep(g.delay)
+		target, err := kv.saveNumbered()
+		g.mu.Lock()
+		g.flushing = false
+		g.completed++
+		if err == nil && target > g.covered {
+			g.covered = target
+		}
+		g.lastErr = err
+		g.flushes.Add(1)
+		g.cond.Broadcast()
+	}
+	return nil
+}
+
+// DurabilityStats returns the durable and ordinary write counts and the average durable flush wait.
+func (kv *KeyValueStore) DurabilityStats() DurabilityStats {
+	g := kv.commits
+	stats := DurabilityStats{
+		SyncWrites:  g.syncWrites.Load(),
+		AsyncWrites: g.asyncWrites.Load(),
+		Flushes:     g.flushes.Load(),
+	}
+	if stats.SyncWrites > 0 {
+		stats.AvgFlushWait = time.Duration(g.waitNanos.Load() / int64(stats.SyncWrites))
+	}
+	return stats
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// Content encodings understood by GetDecoded. Encodings are listed in the order they were applied,
+// separated by commas, like an HTTP Content-Encoding header: "gzip, base64" is base64 of gzip.
+const (
+	EncodingIdentity = "identity"
+	EncodingGzip     = "gzip"
+	EncodingBase64   = "base64"
+)
+
+// SetWithEncoding sets key like Set and records the content encoding of value, which GetDecoded reverses.
+// Writes with an encoding bypass write coalescing.
+func (kv *KeyValueStore) SetWithEncoding(key, value, encoding string, expiration time.Duration) error {
+	if err := kv.ensureLoaded(); err != nil {
+		return err
+	}
+	if err := kv.admitMutation(); err != nil {
+		return err
+	}
+	key, value, err := kv.applyPreWriteHooks(key, value)
+	if err != nil {
+		return err
+	}
+	if err := kv.checkComputed(context.Background(), key); err != nil {
+		return err
+	}
+	kv.recordAccess(key)
+	kv.touchHistory(key)
+	if err := kv.admitWrite(); err != nil {
+		return err
+	}
+	if err := kv.injectFault(OpSet, key); err != nil {
+		return err
+	}
+
+	acquired := kv.lockWrite(OpSet)
+	defer kv.unlockWrite(OpSet, acquired)
+
+	if err := kv.checkMutable(key); err != nil {
+		return err
+	}
+	kv.flushPendingLocked(key)
+	kv.appendLocked(key, KeyValue{Value: value, Timestamp: time.Now(), Encoding: normalizeEncoding(encoding)}, expiration)
+	return nil
+}
+
+// GetDecoded returns the latest value of key with its recorded encoding reversed, along with that encoding.
+// A value with an encoding this version does not know is returned untouched.
+func (kv *KeyValueStore) GetDecoded(key string) ([]byte, string, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return nil, "", err
+	}
+	if _, err := kv.Get(key); err != nil {
+		return nil, "", err
+	}
+
+	kv.RLock()
+	var version KeyValue
+	if value, ok := kv.pendingValue(key); ok {
+		version = KeyValue{Value: value}
+	} else if versions := kv.data[key]; len(versions) > 0 {
+		version = versions[len(versions)-1]
+	} else {
+		kv.RUnlock()
+		return nil, "", ErrKeyNotFound
+	}
+	kv.RUnlock()
+
+	if IsClientEncrypted(version.Value) {
+		return nil, version.Encoding, fmt.Errorf("error decoding key '%s': %w", key, ErrClientEncrypted)
+	}
+	decoded, err := DecodeValue([]byte(version.Value), version.Encoding)
+	if err != nil {
+		return nil, version.Encoding, fmt.Errorf("error decoding key '%s': %v", key, err)
+	}
+	return decoded, version.Encoding, nil
+}
+
+// DecodeValue reverses the encodings listed in encoding, last applied first. If any of them is unknown,
+// data is returned untouched.
+func DecodeValue(data []byte, encoding string) ([]byte, error) {
+	encodings := splitEncoding(encoding)
+	for _, e := range encodings {
+		if e != EncodingIdentity && e != EncodingGzip && e != EncodingBase64 {
+			log.Printf("DecodeValue: Unknown encoding '%s', passing value through\n", e)
+			return data, nil
+		}
+	}
+
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		switch encodings[i] {
+		case EncodingGzip:
+			data, err = gunzip(data)
+		case EncodingBase64:
+			data, err = base64.StdEncoding.DecodeString(string(data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s data: %v", encodings[i], err)
+		}
+	}
+	return data, nil
+}
+
+// gunzip decompresses gzip data.
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// splitEncoding parses a comma-separated encoding list, dropping identity entries.
+func splitEncoding(encoding string) []string {
+	var encodings []string
+	for _, e := range strings.Split(encoding, ",") {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e != "" && e != EncodingIdentity {
+			encodings = append(encodings, e)
+		}
+	}
+	return encodings
+}
+
+// normalizeEncoding returns encoding in canonical form, or "" for identity.
+func normalizeEncoding(encoding string) string {
+	return strings.Join(splitEncoding(encoding), ", ")
+}
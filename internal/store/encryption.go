@@ -12,8 +12,18 @@ import (
 	"log"
 )
 
+// ErrWrongEncryptionContext is returned when a ciphertext fails authentication under a configured
+// encryption context. GCM cannot tell a wrong context from a wrong key, so either causes it.
+var ErrWrongEncryptionContext = errors.New("ciphertext does not match the encryption context")
+
 // EncryptData encrypts the given data using the provided key.
 func EncryptData(data []byte, key []byte) ([]byte, error) {
+	return EncryptDataWithContext(data, key, nil)
+}
+
+// EncryptDataWithContext encrypts the given data using the provided key, binding it to context
+// as GCM associated data. The context is not stored in the ciphertext.
+func EncryptDataWithContext(data []byte, key []byte, context []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		log.Println("EncryptData: Error creating new cipher:", err)
@@ -35,7 +45,7 @@ func EncryptData(data []byte, key []byte) ([]byte, error) {
 	}
 
 	log.Println("EncryptData: Sealing data")
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
+	ciphertext := gcm.Seal(nonce, nonce, data, context)
 	log.Printf("EncryptData: nonce size: %d, data size: %d, ciphertext size: %d", len(nonce), len(data), len(ciphertext))
 
 	return ciphertext, nil
@@ -43,6 +53,11 @@ func EncryptData(data []byte, key []byte) ([]byte, error) {
 
 // DecryptData decrypts the given encrypted data using the provided key.
 func DecryptData(encryptedData []byte, key []byte) ([]byte, error) {
+	return DecryptDataWithContext(encryptedData, key, nil)
+}
+
+// DecryptDataWithContext decrypts data encrypted by EncryptDataWithContext under the same context.
+func DecryptDataWithContext(encryptedData []byte, key []byte, context []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		log.Println("DecryptData: Error creating new cipher:", err)
@@ -62,9 +77,12 @@ func DecryptData(encryptedData []byte, key []byte) ([]byte, error) {
 	}
 
 	nonce, ciphertext := encryptedData[:nonceSize], encryptedData[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, context)
 	if err != nil {
 		log.Println("DecryptData: Message authentication failed")
+		if len(context) > 0 {
+			return nil, ErrWrongEncryptionContext
+		}
 		return nil, err
 	}
 
@@ -83,7 +101,7 @@ func (kv *KeyValueStore) RotateEncryptionKey(newEncryptionKey []byte) error {
 	oldEncryptionKey := kv.encryptionKey
 
 	fmt.Printf("Old key: %x\n", oldEncryptionKey)
-	decryptedData, err := DecryptData(data, oldEncryptionKey)
+	decryptedData, err := DecryptDataWithContext(data, oldEncryptionKey, kv.encryptionContext)
 	if err != nil {
 		log.Println("Failed to decrypt data with old key:", err)
 		return fmt.Errorf("failed to decrypt data with old key: %v", err)
@@ -94,7 +112,7 @@ func (kv *KeyValueStore) RotateEncryptionKey(newEncryptionKey []byte) error {
 	kv.encryptionKey = newEncryptionKey
 
 	log.Println("RotateEncryptionKey: Encrypting data with new key")
-	encryptedData, err := EncryptData(decryptedData, kv.encryptionKey)
+	encryptedData, err := EncryptDataWithContext(decryptedData, kv.encryptionKey, kv.encryptionContext)
 	if err != nil {
 		log.Println("Failed to encrypt data with new key:", err)
 		kv.encryptionKey = oldEncryptionKey
@@ -130,7 +148,7 @@ func (kv *KeyValueStore) saveToBytes() ([]byte, error) {
 	kv.RLock()
 	defer kv.RUnlock()
 
-	data, err := json.Marshal(kv.data)
+	data, err := json.Marshal(withBinary(kv.data))
 	if err != nil {
 		log.Println("saveToBytes: Error marshalling data:", err)
 		return nil, fmt.Errorf("error marshalling data: %v", err)
@@ -144,7 +162,7 @@ func (kv *KeyValueStore) saveToBytes() ([]byte, error) {
 
 	if len(kv.encryptionKey) > 0 {
 		log.Println("saveToBytes: Encrypting data")
-		encryptedData, err := EncryptData(compressedData, kv.encryptionKey)
+		encryptedData, err := EncryptDataWithContext(compressedData, kv.encryptionKey, kv.encryptionContext)
 		if err != nil {
 			log.Println("saveToBytes: Error encrypting data:", err)
 			return nil, fmt.Errorf("error encrypting data: %v", err)
@@ -166,10 +184,10 @@ func (kv *KeyValueStore) loadFromBytes(data []byte) error {
 		return fmt.Errorf("error decoding base64: %v", err)
 	}
 
-	decryptedData, err := DecryptData(decodedData, kv.encryptionKey)
+	decryptedData, err := DecryptDataWithContext(decodedData, kv.encryptionKey, kv.encryptionContext)
 	if err != nil {
 
-		return fmt.Errorf("error decrypting data: %v", err)
+		return fmt.Errorf("error decrypting data: %w", err)
 	}
 
 	decompressedData, err := DecompressData(decryptedData)
@@ -181,10 +199,26 @@ func (kv *KeyValueStore) loadFromBytes(data []byte) error {
 	kv.Lock()
 	defer kv.Unlock()
 
-	if err := json.Unmarshal(decompressedData, &kv.data); err != nil {
+	loadedData := make(map[string][]KeyValue)
+	if err := json.Unmarshal(decompressedData, &loadedData); err != nil {
 		log.Println("loadFromBytes: Error unmarshalling data:", err)
 		return fmt.Errorf("error unmarshalling data: %v", err)
 	}
+	if loadedData == nil {
+		log.Println("loadFromBytes: Data is not a JSON object")
+		return errors.New("error unmarshalling data: expected a JSON object")
+	}
+	if err := expandBinary(loadedData); err != nil {
+		return err
+	}
+	immutable := takeImmutable(loadedData)
+	kv.data = loadedData
+	kv.observeRevisionsLocked()
+	kv.dedupResetLocked()
+	kv.autoRenew.reset()
+	kv.valueGrowth.reset()
+	kv.resetImmutableLocked(immutable)
+	kv.indexReset()
 
 	log.Println("loadFromBytes: Data loaded successfully")
 	return nil
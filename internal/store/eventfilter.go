@@ -0,0 +1,88 @@
+package store
+
+import "strings"
+
+// EventFilter selects the events delivered to a subscription made by SubscribeFiltered. An event passes
+// when its type is listed, its key is listed or starts with an included prefix and starts with no
+// excluded one, and Predicate accepts it. The key of a notification that is not a key event, such as "hotkey:k", is the text after
+// its type.
+type EventFilter struct {
+	Keys          []string         `json:"keys,omitempty"`           // Exact keys, included alongside Include
+	Include       []string         `json:"include,omitempty"`        // Key prefixes; with Keys also empty, every key is included
+	Exclude       []string         `json:"exclude,omitempty"`        // Key prefixes excluded even when included
+	Types         []string         `json:"types,omitempty"`          // Event types such as "deleted"; empty includes every type
+	IncludeValues bool             `json:"include_values,omitempty"` // Append "=" and the value to key events
+	Predicate     func(Event) bool `json:"-"`                        // Optional, for in-process subscribers
+}
+
+// notification is an event on its way to the subscriptions.
+type notification struct {
+	text     string // Event as delivered without values, such as "deleted:k@3"
+	event    Event  // Type and key of text; Seq, Time and values are only set for key events
+	hasValue bool   // Whether the event carries values, which notifyKey events do not
+}
+
+// value returns the value string listeners including values receive: the new value of the key, or its
+// last value for deleted and expired events.
+func (n *notification) value() string {
+	if n.event.Type == "deleted" || n.event.Type == "expired" {
+		return n.event.OldValue
+	}
+	return n.event.NewValue
+}
+
+// eventMatcher evaluates an EventFilter.
+type eventMatcher struct {
+	filter EventFilter
+	types  map[string]struct{}
+	keys   map[string]struct{}
+}
+
+// newEventMatcher prepares filter for evaluation.
+func newEventMatcher(filter EventFilter) *eventMatcher {
+	m := &eventMatcher{filter: filter}
+	if len(filter.Types) > 0 {
+		m.types = make(map[string]struct{}, len(filter.Types))
+		for _, t := range filter.Types {
+			m.types[t] = struct{}{}
+		}
+	}
+	if len(filter.Keys) > 0 {
+		m.keys = make(map[string]struct{}, len(filter.Keys))
+		for _, key := range filter.Keys {
+			m.keys[key] = struct{}{}
+		}
+	}
+	return m
+}
+
+// matches reports whether n passes the filter. The cheapest checks come first so most excluded
+// events are rejected without looking at their key.
+func (m *eventMatcher) matches(n *notification) bool {
+	if m.types != nil {
+		if _, ok := m.types[n.event.Type]; !ok {
+			return false
+		}
+	}
+	for _, prefix := range m.filter.Exclude {
+		if strings.HasPrefix(n.event.Key, prefix) {
+			return false
+		}
+	}
+	if m.keys != nil || len(m.filter.Include) > 0 {
+		if _, listed := m.keys[n.event.Key]; !listed && !hasAnyPrefix(n.event.Key, m.filter.Include) {
+			return false
+		}
+	}
+	return m.filter.Predicate == nil || m.filter.Predicate(n.event)
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultEventLogSize is how many recent events EventsSince can replay by default.
+const defaultEventLogSize = 4096
+
+// sequenceRecord is the reserved key under which snapshots and record persisters keep the sequence number
+// of the last mutation, so numbering continues after a restart. It never appears among the store's keys, and
+// starts with reservedKeyPrefix so writes cannot replace it.
+const sequenceRecord = "\x00sequence"
+
+// ErrEventsTruncated is returned by EventsSince when events after the requested sequence number are no
+// longer available, or were never issued by this store. Consumers must resynchronize from a full read.
+var ErrEventsTruncated = errors.New("events truncated")
+
+// EventsTruncatedError reports the range EventsSince can still replay. It wraps ErrEventsTruncated.
+type EventsTruncatedError struct {
+	Since  uint64 // Sequence number requested
+	Oldest uint64 // Sequence number of the oldest event that can be replayed
+	Latest uint64 // Sequence number of the latest mutation
+}
+
+func (e *EventsTruncatedError) Error() string {
+	return fmt.Sprintf("events truncated: requested events after %d, available from %d to %d", e.Since, e.Oldest, e.Latest)
+}
+
+func (e *EventsTruncatedError) Unwrap() error {
+	return ErrEventsTruncated
+}
+
+// Event is a key mutation recorded in the event log, or a notification delivered to the listeners of
+// SubscribeEvents. Only listeners get values; the event log records none.
+type Event struct {
+	Seq      uint64
+	Type     string // added, updated, deleted or expired, or the part of a notification before ':'
+	Key      string
+	Time     time.Time
+	OldValue string // Latest value before an update, or the last value of a deleted or expired key
+	NewValue string // Value of an added or updated key
+}
+
+// String returns the event as string listeners receive it, such as "deleted:k@3" for a key event or
+// "hotkey:k" for another notification.
+func (e Event) String() string {
+	if e.Seq == 0 {
+		return e.Type + ":" + e.Key
+	}
+	return fmt.Sprintf("%s:%s@%d", e.Type, e.Key, e.Seq)
+}
+
+// eventLog keeps the most recent events in a ring.
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event // Ring of at most cap(events) events, oldest at head
+	head   int
+	floor  uint64 // Sequence number up to which events are unavailable
+}
+
+// newEventLog creates an event log holding up to size events.
+func newEventLog(size int) *eventLog {
+	if size <= 0 {
+		size = defaultEventLogSize
+	}
+	return &eventLog{events: make([]Event, 0, size)}
+}
+
+// record adds an event, evicting the oldest when the log is full.
+func (l *eventLog) record(event Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if event.Seq <= l.floor {
+		return
+	}
+	if len(l.events) < cap(l.events) {
+		l.events = append(l.events, event)
+	} else {
+		l.floor = l.events[l.head].Seq
+		l.events[l.head] = event
+		l.head = (l.head + 1) % len(l.events)
+	}
+	// Events are recorded in sequence order except when notifying raced; restore the order.
+	for i := len(l.events) - 1; i > 0; i-- {
+		cur, prev := l.at(i), l.at(i-1)
+		if l.events[prev].Seq <= l.events[cur].Seq {
+			break
+		}
+		l.events[prev], l.events[cur] = l.events[cur], l.events[prev]
+	}
+}
+
+// at returns the index in the ring of the i-th oldest event.
+func (l *eventLog) at(i int) int {
+	return (l.head + i) % len(l.events)
+}
+
+// reset discards every event and makes events up to floor unavailable.
+func (l *eventLog) reset(floor uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = l.events[:0]
+	l.head = 0
+	l.floor = floor
+}
+
+// since returns the events after seq, or an error if some of them are unavailable.
+func (l *eventLog) since(seq, latest uint64) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if seq < l.floor || seq > latest {
+		return nil, &EventsTruncatedError{Since: seq, Oldest: l.floor + 1, Latest: latest}
+	}
+	n := len(l.events)
+	first := sort.Search(n, func(i int) bool { return l.events[l.at(i)].Seq > seq })
+	events := make([]Event, 0, n-first)
+	for i := first; i < n; i++ {
+		events = append(events, l.events[l.at(i)])
+	}
+	return events, nil
+}
+
+// EventsSince returns the events after sequence number seq, oldest first. It returns an *EventsTruncatedError
+// if any of them are no longer available: they were evicted from the event log, happened before the store
+// was last loaded, or seq is ahead of the store, as when presented by a client of a store that lost writes.
+func (kv *KeyValueStore) EventsSince(seq uint64) ([]Event, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return kv.events.since(seq, kv.globalSeq.Load())
+}
+
+// withSequence returns histories with the reserved sequence record added, and the immutable record if any
+// key is immutable.
+func (kv *KeyValueStore) withSequence(histories map[string][]KeyValue) map[string][]KeyValue {
+	withSeq := make(map[string][]KeyValue, len(histories)+2)
+	for key, versions := range histories {
+		withSeq[key] = versions
+	}
+	withSeq[sequenceRecord] = kv.sequenceVersions()
+	if versions := kv.immutableVersions(); versions != nil {
+		withSeq[immutableRecord] = versions
+	}
+	return withSeq
+}
+
+// sequenceVersions returns the history stored under the reserved sequence record.
+func (kv *KeyValueStore) sequenceVersions() []KeyValue {
+	return []KeyValue{{Value: strconv.FormatUint(kv.globalSeq.Load(), 10), Timestamp: time.Now()}}
+}
+
+// takeSequence removes the reserved sequence record from histories and returns the sequence number it holds.
+func takeSequence(histories map[string][]KeyValue) uint64 {
+	versions, ok := histories[sequenceRecord]
+	if !ok {
+		return 0
+	}
+	delete(histories, sequenceRecord)
+	if len(versions) == 0 {
+		return 0
+	}
+	seq, err := strconv.ParseUint(versions[len(versions)-1].Value, 10, 64)
+	if err != nil {
+		log.Printf("load: Ignoring malformed sequence record: %v\n", err)
+		return 0
+	}
+	return seq
+}
+
+// restoreSequence continues numbering after seq and makes earlier events unavailable.
+// The caller must hold the write lock.
+func (kv *KeyValueStore) restoreSequence(seq uint64) {
+	for {
+		current := kv.globalSeq.Load()
+		if current >= seq || kv.globalSeq.CompareAndSwap(current, seq) {
+			break
+		}
+	}
+	kv.events.reset(kv.globalSeq.Load())
+}
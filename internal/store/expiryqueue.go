@@ -0,0 +1,69 @@
+package store
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryQueueSlack is how many stale entries the expiry queue tolerates beyond one per key with a TTL before
+// it is rebuilt from the expirations.
+const expiryQueueSlack = 1024
+
+// expiryEntry is a deadline of key. It is stale once the expiration of key no longer equals it.
+type expiryEntry struct {
+	key      string
+	deadline time.Time
+}
+
+// expiryQueue orders the deadlines of the keys with a TTL, earliest first, so the cleanup sweep only
+// visits keys that are due. The expirations map stays the authority on a key's deadline: entries are
+// pushed whenever a deadline is set and skipped when found stale, instead of being removed.
+type expiryQueue []expiryEntry
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].deadline.Before(q[j].deadline) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x any)        { *q = append(*q, x.(expiryEntry)) }
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// queueExpiry records the current deadline of key, if it has one. The caller must hold the write lock.
+func (kv *KeyValueStore) queueExpiry(key string) {
+	deadline, ok := kv.expirations[key]
+	if !ok {
+		return
+	}
+	if len(kv.expiryQueue) >= 2*len(kv.expirations)+expiryQueueSlack {
+		kv.rebuildExpiryQueue()
+		return
+	}
+	heap.Push(&kv.expiryQueue, expiryEntry{key: key, deadline: deadline})
+}
+
+// rebuildExpiryQueue replaces the expiry queue with the current deadline of every key, dropping stale
+// entries. It must be called after the expirations are replaced. The caller must hold the write lock.
+func (kv *KeyValueStore) rebuildExpiryQueue() {
+	queue := make(expiryQueue, 0, len(kv.expirations))
+	for key, deadline := range kv.expirations {
+		queue = append(queue, expiryEntry{key: key, deadline: deadline})
+	}
+	heap.Init(&queue)
+	kv.expiryQueue = queue
+}
+
+// popDueLocked returns the next key whose current deadline is before now, discarding stale entries, and
+// false once no key is due. The caller must hold the write lock.
+func (kv *KeyValueStore) popDueLocked(now time.Time) (string, bool) {
+	for len(kv.expiryQueue) > 0 && now.After(kv.expiryQueue[0].deadline) {
+		entry := heap.Pop(&kv.expiryQueue).(expiryEntry)
+		if deadline, ok := kv.expirations[entry.key]; ok && deadline.Equal(entry.deadline) {
+			return entry.key, true
+		}
+	}
+	return "", false
+}
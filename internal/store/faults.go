@@ -0,0 +1,229 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"path"
+	"sync"
+	"time"
+)
+
+// Op identifies a store operation.
+type Op string
+
+// Operations that can be targeted by fault injection.
+const (
+	OpGet     Op = "get"
+	OpSet     Op = "set"
+	OpSave    Op = "save"
+	OpMigrate Op = "migrate"
+)
+
+// FaultRule injects latency and/or an error into matching operations.
+type FaultRule struct {
+	Op          Op            // Operation the rule applies to
+	KeyPattern  string        // Optional path.Match pattern; empty matches every key
+	Probability float64       // Chance between 0 and 1 that the rule fires
+	Latency     time.Duration // Delay added before the operation
+	Err         error         // Error returned instead of running the operation
+	Corrupt     bool          // Flip a byte of the data written by the operation; only migrations write through it
+}
+
+// FaultStats counts the faults injected per operation.
+type FaultStats struct {
+	Latencies   map[Op]uint64
+	Errors      map[Op]uint64
+	Corruptions map[Op]uint64
+	Panics      uint64
+}
+
+// FaultInjector injects latency, errors and panics into store operations for resilience testing.
+// It is inert until enabled.
+type FaultInjector struct {
+	mu        sync.Mutex
+	enabled   bool
+	rules     []FaultRule
+	panicKeys map[string]bool
+	loopKills map[string]int
+	stats     FaultStats
+}
+
+// NewFaultInjector creates a disabled FaultInjector.
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{
+		panicKeys: make(map[string]bool),
+		loopKills: make(map[string]int),
+		stats: FaultStats{
+			Latencies:   make(map[Op]uint64),
+			Errors:      make(map[Op]uint64),
+			Corruptions: make(map[Op]uint64),
+		},
+	}
+}
+
+// Enable turns fault injection on or off.
+func (fi *FaultInjector) Enable(enabled bool) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.enabled = enabled
+}
+
+// Enabled reports whether fault injection is on.
+func (fi *FaultInjector) Enabled() bool {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.enabled
+}
+
+// AddRule adds a fault rule.
+func (fi *FaultInjector) AddRule(rule FaultRule) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.rules = append(fi.rules, rule)
+}
+
+// PanicOnKey makes Get and Set of key panic.
+func (fi *FaultInjector) PanicOnKey(key string) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.panicKeys[key] = true
+}
+
+// PanicInLoop makes the next times iterations of the named background loop panic.
+func (fi *FaultInjector) PanicInLoop(component string, times int) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.loopKills[component] += times
+}
+
+// Reset removes all rules and panic triggers.
+func (fi *FaultInjector) Reset() {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.rules = nil
+	fi.panicKeys = make(map[string]bool)
+	fi.loopKills = make(map[string]int)
+}
+
+// Stats returns the number of faults injected so far.
+func (fi *FaultInjector) Stats() FaultStats {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	stats := FaultStats{
+		Latencies:   make(map[Op]uint64, len(fi.stats.Latencies)),
+		Errors:      make(map[Op]uint64, len(fi.stats.Errors)),
+		Corruptions: make(map[Op]uint64, len(fi.stats.Corruptions)),
+		Panics:      fi.stats.Panics,
+	}
+	for op, n := range fi.stats.Latencies {
+		stats.Latencies[op] = n
+	}
+	for op, n := range fi.stats.Errors {
+		stats.Errors[op] = n
+	}
+	for op, n := range fi.stats.Corruptions {
+		stats.Corruptions[op] = n
+	}
+	return stats
+}
+
+// inject applies the rules matching op and key. It sleeps for injected latency and returns the injected error, if any.
+func (fi *FaultInjector) inject(op Op, key string) error {
+	fi.mu.Lock()
+	if !fi.enabled {
+		fi.mu.Unlock()
+		return nil
+	}
+
+	if op != OpSave && fi.panicKeys[key] {
+		fi.stats.Panics++
+		fi.mu.Unlock()
+		panic(fmt.Sprintf("fault injection: panic on key %q", key))
+	}
+
+	var latency time.Duration
+	var err error
+	for _, rule := range fi.rules {
+		if rule.Op != op || !rule.matches(key) || rand.Float64() >= rule.Probability {
+			continue
+		}
+		if rule.Latency > 0 {
+			latency += rule.Latency
+			fi.stats.Latencies[op]++
+		}
+		if rule.Err != nil && err == nil {
+			err = rule.Err
+			fi.stats.Errors[op]++
+		}
+	}
+	fi.mu.Unlock()
+
+	if latency > 0 {
+		log.Printf("FaultInjector: Delaying %s of '%s' by %v\n", op, key, latency)
+		time.Sleep(latency)
+	}
+	if err != nil {
+		log.Printf("FaultInjector: Failing %s of '%s': %v\n", op, key, err)
+	}
+	return err
+}
+
+// matches reports whether key matches the rule's pattern.
+func (rule FaultRule) matches(key string) bool {
+	if rule.KeyPattern == "" {
+		return true
+	}
+	matched, err := path.Match(rule.KeyPattern, key)
+	return err == nil && matched
+}
+
+// injectFault runs the fault injector, if one is configured.
+func (kv *KeyValueStore) injectFault(op Op, key string) error {
+	if kv.faults == nil {
+		return nil
+	}
+	return kv.faults.inject(op, key)
+}
+
+// injectCorruption returns data with a byte flipped if a corrupting rule matching op and key fires, and data
+// unchanged otherwise.
+func (kv *KeyValueStore) injectCorruption(op Op, key string, data []byte) []byte {
+	fi := kv.faults
+	if fi == nil || len(data) == 0 {
+		return data
+	}
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if !fi.enabled {
+		return data
+	}
+	for _, rule := range fi.rules {
+		if rule.Op != op || !rule.Corrupt || !rule.matches(key) || rand.Float64() >= rule.Probability {
+			continue
+		}
+		fi.stats.Corruptions[op]++
+		corrupted := append([]byte(nil), data...)
+		corrupted[rand.Intn(len(corrupted))] ^= 0x01
+		log.Printf("FaultInjector: Corrupting %s of '%s'\n", op, key)
+		return corrupted
+	}
+	return data
+}
+
+// injectLoopFault panics in the named background loop if the fault injector asks for it.
+func (kv *KeyValueStore) injectLoopFault(component string) {
+	fi := kv.faults
+	if fi == nil {
+		return
+	}
+	fi.mu.Lock()
+	if !fi.enabled || fi.loopKills[component] == 0 {
+		fi.mu.Unlock()
+		return
+	}
+	fi.loopKills[component]--
+	fi.stats.Panics++
+	fi.mu.Unlock()
+	panic(fmt.Sprintf("fault injection: panic in %s loop", component))
+}
@@ -0,0 +1,115 @@
+package store
+
+import "strings"
+
+// globMatch reports whether s matches a Redis KEYS style pattern: * matches any run of bytes, ? any
+// single byte, [abc] and [a-z] a byte of the set, [^abc] a byte outside it, and \ escapes the next byte.
+// Unlike path.Match, * also matches '/', and a malformed pattern is matched literally instead of failing.
+func globMatch(pattern, s string) bool {
+	// On a mismatch after a *, retry with the * absorbing one more byte.
+	starP, starS := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				starP, starS = p, i
+				p++
+				continue
+			case '?':
+				p++
+				i++
+				continue
+			case '[':
+				if matched, next, ok := matchClass(pattern, p, s[i]); ok {
+					if matched {
+						p, i = next, i+1
+						continue
+					}
+				} else if s[i] == '[' {
+					p++
+					i++
+					continue
+				}
+			case '\\':
+				// A trailing \ is a literal backslash.
+				if p+1 == len(pattern) && s[i] == '\\' {
+					p++
+					i++
+					continue
+				}
+				if p+1 < len(pattern) && pattern[p+1] == s[i] {
+					p += 2
+					i++
+					continue
+				}
+			default:
+				if pattern[p] == s[i] {
+					p++
+					i++
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		starS++
+		p, i = starP+1, starS
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches c against the class starting at pattern[p] == '['. It returns whether c is in the
+// class, the index after the class, and false if the class is not closed.
+func matchClass(pattern string, p int, c byte) (bool, int, bool) {
+	p++
+	negate := p < len(pattern) && pattern[p] == '^'
+	if negate {
+		p++
+	}
+	matched := false
+	for first := true; p < len(pattern); first = false {
+		if pattern[p] == ']' && !first {
+			return matched != negate, p + 1, true
+		}
+		lo := pattern[p]
+		if lo == '\\' && p+1 < len(pattern) {
+			p++
+			lo = pattern[p]
+		}
+		hi := lo
+		if p+2 < len(pattern) && pattern[p+1] == '-' && pattern[p+2] != ']' {
+			hi = pattern[p+2]
+			p += 2
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+		p++
+	}
+	return false, 0, false
+}
+
+// literalPrefix returns the part of pattern before its first wildcard, which every matching key starts with.
+func literalPrefix(pattern string) string {
+	var prefix strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?', '[':
+			return prefix.String()
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+		}
+		prefix.WriteByte(pattern[i])
+	}
+	return prefix.String()
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// A hash is stored as the JSON object of its fields, like a list is stored as a JSON array, so callers
+// change single fields without reading and rewriting the document themselves.
+
+// decodeHash parses the hash stored under key, which is empty if the key does not exist.
+func decodeHash(key, value string, found bool) (map[string]string, error) {
+	hash := make(map[string]string)
+	if !found {
+		return hash, nil
+	}
+	if err := json.Unmarshal([]byte(value), &hash); err != nil || hash == nil {
+		return nil, fmt.Errorf("key '%s' is not a hash: %w", key, ErrWrongType)
+	}
+	return hash, nil
+}
+
+// updateHash applies modify to the hash stored under key and stores the result, deleting the key when the
+// hash becomes empty. The key keeps its TTL.
+func (kv *KeyValueStore) updateHash(key string, modify func(hash map[string]string)) error {
+	_, _, err := kv.readModifyWrite(key, true, func(current string, found bool) (string, bool, error) {
+		hash, err := decodeHash(key, current, found)
+		if err != nil {
+			return "", false, err
+		}
+		modify(hash)
+		if len(hash) == 0 {
+			return "", true, nil
+		}
+		data, err := json.Marshal(hash)
+		if err != nil {
+			return "", false, err
+		}
+		return string(data), false, nil
+	})
+	return err
+}
+
+// HSet sets fields of the hash stored under key, creating it if needed, and returns how many of them were
+// new. The key keeps its TTL.
+func (kv *KeyValueStore) HSet(key string, fields map[string]string) (int, error) {
+	var added int
+	err := kv.updateHash(key, func(hash map[string]string) {
+		added = 0
+		for field, value := range fields {
+			if _, ok := hash[field]; !ok {
+				added++
+			}
+			hash[field] = value
+		}
+	})
+	return added, err
+}
+
+// HGet returns a field of the hash stored under key. It returns ErrKeyNotFound if the key or the field
+// does not exist.
+func (kv *KeyValueStore) HGet(key, field string) (string, error) {
+	hash, err := kv.HGetAll(key)
+	if err != nil {
+		return "", err
+	}
+	value, ok := hash[field]
+	if !ok {
+		return "", fmt.Errorf("field '%s' of key '%s': %w", field, key, ErrKeyNotFound)
+	}
+	return value, nil
+}
+
+// HDel removes fields from the hash stored under key and returns how many existed. Removing the last
+// field deletes the key.
+func (kv *KeyValueStore) HDel(key string, fields ...string) (int, error) {
+	var removed int
+	err := kv.updateHash(key, func(hash map[string]string) {
+		removed = 0
+		for _, field := range fields {
+			if _, ok := hash[field]; ok {
+				delete(hash, field)
+				removed++
+			}
+		}
+	})
+	return removed, err
+}
+
+// HGetAll returns the fields of the hash stored under key. A key that does not exist is an empty hash.
+func (kv *KeyValueStore) HGetAll(key string) (map[string]string, error) {
+	values, _, err := kv.GetManyConsistent([]string{key})
+	if err != nil {
+		return nil, err
+	}
+	info, found := values[key]
+	return decodeHash(key, info.Value, found)
+}
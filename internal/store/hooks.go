@@ -0,0 +1,63 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PreWriteHook rewrites the key and/or value of a write before it is committed, or aborts it with an error.
+type PreWriteHook func(key, value string) (string, string, error)
+
+// preWriteHook is a hook applied to keys starting with prefix.
+type preWriteHook struct {
+	prefix string
+	fn     PreWriteHook
+}
+
+// preWriteHooks holds the registered pre-write hooks in registration order.
+type preWriteHooks struct {
+	mu    sync.RWMutex
+	hooks []preWriteHook
+}
+
+// RegisterPreWriteHook registers fn for writes to keys starting with prefix. Hooks run in registration
+// order before Set, SetMany and CompareAndSwap take the write lock, each seeing the key and value
+// returned by the previous one, and each runs once per write. The final key and value are what get
+// stored and notified. An error from a hook aborts the write, as does a client-encrypted value.
+func (kv *KeyValueStore) RegisterPreWriteHook(prefix string, fn func(key, value string) (string, string, error)) {
+	kv.preWriteHooks.mu.Lock()
+	defer kv.preWriteHooks.mu.Unlock()
+	kv.preWriteHooks.hooks = append(kv.preWriteHooks.hooks, preWriteHook{prefix: prefix, fn: fn})
+}
+
+// applyPreWriteHooks runs the matching pre-write hooks over key and value and checks that the resulting key
+// is not immutable and the resulting value size. It must be called without the store lock.
+func (kv *KeyValueStore) applyPreWriteHooks(key, value string) (string, string, error) {
+	kv.preWriteHooks.mu.RLock()
+	hooks := kv.preWriteHooks.hooks
+	kv.preWriteHooks.mu.RUnlock()
+
+	for _, hook := range hooks {
+		if !strings.HasPrefix(key, hook.prefix) {
+			continue
+		}
+		if IsClientEncrypted(value) {
+			// Hooks validate and rewrite plaintext, which the store does not have.
+			return "", "", fmt.Errorf("pre-write hook cannot inspect key '%s': %w", key, ErrClientEncrypted)
+		}
+		newKey, newValue, err := hook.fn(key, value)
+		if err != nil {
+			return "", "", fmt.Errorf("pre-write hook rejected key '%s': %w", key, err)
+		}
+		key, value = newKey, newValue
+	}
+	if err := kv.checkMutable(key); err != nil {
+		return "", "", err
+	}
+	// The size limit applies to the value as rewritten by the hooks.
+	if err := kv.checkValueSize(key, value); err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxTrackedHotKeys bounds the number of keys tracked by the hot-key detector.
+	maxTrackedHotKeys = 1024
+	// minHotKeySamples is the number of samples needed in a window before hot-key alerts fire.
+	minHotKeySamples = 100
+	// defaultHotKeyWindow is the window of a detector configured without one.
+	defaultHotKeyWindow = time.Minute
+)
+
+// HotKey describes a frequently accessed key.
+type HotKey struct {
+	Key   string
+	Rate  float64 // Approximate accesses per second
+	Share float64 // Fraction of sampled traffic
+}
+
+// hotKeyDetector samples key accesses and keeps approximate counts over a sliding window.
+type hotKeyDetector struct {
+	sampleEvery    uint64
+	window         time.Duration
+	shareThreshold float64
+	counter        atomic.Uint64
+
+	mu           sync.Mutex
+	windowStart  time.Time
+	hasPrevious  bool
+	current      map[string]float64
+	previous     map[string]float64
+	currentTotal float64
+	prevTotal    float64
+	alerted      map[string]bool
+}
+
+// newHotKeyDetector creates a detector sampling one access out of sampleEvery, over windows of one
+// minute unless window is positive.
+func newHotKeyDetector(sampleEvery uint64, window time.Duration, shareThreshold float64) *hotKeyDetector {
+	if sampleEvery == 0 {
+		sampleEvery = 1
+	}
+	if window <= 0 {
+		window = defaultHotKeyWindow
+	}
+	return &hotKeyDetector{
+		sampleEvery:    sampleEvery,
+		window:         window,
+		shareThreshold: shareThreshold,
+		windowStart:    time.Now(),
+		current:        make(map[string]float64),
+		previous:       make(map[string]float64),
+		alerted:        make(map[string]bool),
+	}
+}
+
+// record samples an access to key. It returns true when the key just crossed the share threshold.
+func (d *hotKeyDetector) record(key string) bool {
+	if d.counter.Add(1)%d.sampleEvery != 0 {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.rotate(time.Now())
+
+	if _, tracked := d.current[key]; !tracked && len(d.current) >= maxTrackedHotKeys {
+		d.evictColdest()
+	}
+	d.current[key]++
+	d.currentTotal++
+
+	if d.shareThreshold <= 0 || d.alerted[key] {
+		return false
+	}
+	total := d.weightedTotal(time.Now())
+	if total < minHotKeySamples {
+		return false
+	}
+	if d.weightedCount(key, time.Now())/total > d.shareThreshold {
+		d.alerted[key] = true
+		return true
+	}
+	return false
+}
+
+// rotate starts a new window when the current one has elapsed.
+func (d *hotKeyDetector) rotate(now time.Time) {
+	elapsed := now.Sub(d.windowStart)
+	if elapsed < d.window {
+		return
+	}
+	if elapsed < 2*d.window {
+		d.previous, d.prevTotal = d.current, d.currentTotal
+		d.hasPrevious = true
+	} else {
+		// The previous window saw no traffic at all.
+		d.previous, d.prevTotal = make(map[string]float64), 0
+		d.hasPrevious = false
+	}
+	d.current, d.currentTotal = make(map[string]float64), 0
+	d.alerted = make(map[string]bool)
+	d.windowStart = now.Add(-(elapsed % d.window))
+}
+
+// evictColdest removes the least accessed key of the current window.
+func (d *hotKeyDetector) evictColdest() {
+	coldest, min := "", 0.0
+	for key, count := range d.current {
+		if coldest == "" || count < min {
+			coldest, min = key, count
+		}
+	}
+	d.currentTotal -= min
+	delete(d.current, coldest)
+}
+
+// previousWeight returns how much of the previous window still overlaps the sliding window.
+func (d *hotKeyDetector) previousWeight(now time.Time) float64 {
+	if !d.hasPrevious {
+		return 0
+	}
+	return 1 - float64(now.Sub(d.windowStart))/float64(d.window)
+}
+
+// weightedCount estimates the sampled accesses of key over the sliding window.
+func (d *hotKeyDetector) weightedCount(key string, now time.Time) float64 {
+	return d.current[key] + d.previous[key]*d.previousWeight(now)
+}
+
+// weightedTotal estimates the sampled accesses of all keys over the sliding window.
+func (d *hotKeyDetector) weightedTotal(now time.Time) float64 {
+	return d.currentTotal + d.prevTotal*d.previousWeight(now)
+}
+
+// top returns the k most accessed keys with their approximate rates.
+func (d *hotKeyDetector) top(k int) []HotKey {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.rotate(now)
+
+	span := now.Sub(d.windowStart)
+	if d.hasPrevious {
+		span = d.window
+	}
+	if span <= 0 {
+		span = time.Millisecond
+	}
+	total := d.weightedTotal(now)
+
+	keys := make(map[string]struct{}, len(d.current)+len(d.previous))
+	for key := range d.current {
+		keys[key] = struct{}{}
+	}
+	for key := range d.previous {
+		keys[key] = struct{}{}
+	}
+
+	hotKeys := make([]HotKey, 0, len(keys))
+	for key := range keys {
+		count := d.weightedCount(key, now)
+		if count <= 0 {
+			continue
+		}
+		hotKey := HotKey{
+			Key:  key,
+			Rate: count * float64(d.sampleEvery) / span.Seconds(),
+		}
+		if total > 0 {
+			hotKey.Share = count / total
+		}
+		hotKeys = append(hotKeys, hotKey)
+	}
+
+	sort.Slice(hotKeys, func(i, j int) bool {
+		if hotKeys[i].Rate != hotKeys[j].Rate {
+			return hotKeys[i].Rate > hotKeys[j].Rate
+		}
+		return hotKeys[i].Key < hotKeys[j].Key
+	})
+	if k >= 0 && len(hotKeys) > k {
+		hotKeys = hotKeys[:k]
+	}
+	return hotKeys
+}
+
+// recordAccess feeds a key access to the hot-key detector, if enabled.
+func (kv *KeyValueStore) recordAccess(key string) {
+	if kv.hotKeys == nil {
+		return
+	}
+	if kv.hotKeys.record(key) {
+		log.Printf("recordAccess: Key '%s' exceeded %.0f%% of traffic\n", key, kv.hotKeys.shareThreshold*100)
+		kv.notificationManager.Notify(fmt.Sprintf("hotkey:%s", key))
+	}
+}
+
+// HotKeys returns up to k of the most accessed keys. It returns nil if hot-key detection is disabled.
+func (kv *KeyValueStore) HotKeys(k int) []HotKey {
+	if kv.hotKeys == nil {
+		return nil
+	}
+	return kv.hotKeys.top(k)
+}
@@ -0,0 +1,243 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// immutableRecord is the reserved key under which snapshots and record persisters keep the immutable keys.
+// It never appears among the store's keys.
+const immutableRecord = "\x00immutable"
+
+// reservedKeyPrefix starts the reserved keys, such as immutableRecord, under which the store keeps its own
+// records alongside the keys.
+const reservedKeyPrefix = "\x00"
+
+// ErrImmutableKey is returned for writes to a key frozen by MarkImmutable.
+var ErrImmutableKey = errors.New("key is immutable")
+
+// ErrReservedKey is returned for writes to a key starting with a NUL byte, which the store reserves for its
+// own records.
+var ErrReservedKey = errors.New("key is reserved")
+
+// immutableValue returns the value of key if it is immutable, without taking the lock.
+func (kv *KeyValueStore) immutableValue(key string) (string, bool) {
+	frozen := kv.immutable.Load()
+	if frozen == nil {
+		return "", false
+	}
+	value, ok := (*frozen)[key]
+	return value, ok
+}
+
+// checkMutable returns ErrReservedKey if key is reserved and ErrImmutableKey if key is immutable.
+func (kv *KeyValueStore) checkMutable(key string) error {
+	if strings.HasPrefix(key, reservedKeyPrefix) {
+		return fmt.Errorf("%w: %q", ErrReservedKey, key)
+	}
+	if _, frozen := kv.immutableValue(key); frozen {
+		return fmt.Errorf("%w: '%s'", ErrImmutableKey, key)
+	}
+	return nil
+}
+
+// MarkImmutable freezes key: Get then reads its value without taking the store lock, writes fail with
+// ErrImmutableKey until UnmarkImmutable, and Delete fails unless forced with ForceDelete. Immutable keys
+// do not expire, so any TTL of the key is removed.
+func (kv *KeyValueStore) MarkImmutable(key string) error {
+	if err := kv.ensureLoaded(); err != nil {
+		return err
+	}
+	if err := kv.admitMutation(); err != nil {
+		return err
+	}
+	kv.Lock()
+	defer kv.Unlock()
+
+	kv.flushPendingLocked(key)
+	versions, exists := kv.data[key]
+	if exp, ok := kv.expirations[key]; !exists || len(versions) == 0 || (ok && time.Now().After(exp)) {
+		return ErrKeyNotFound
+	}
+	if _, frozen := kv.immutableValue(key); frozen {
+		return nil
+	}
+	if _, hasTTL := kv.expirations[key]; hasTTL {
+		delete(kv.expirations, key)
+		kv.scheduleExpiry(key)
+		kv.persistKey(key)
+	}
+	kv.setImmutableLocked(key, latestValue(versions), true)
+	log.Printf("MarkImmutable: Key '%s' is now immutable\n", key)
+	kv.notificationManager.Notify("immutable:" + key)
+	return nil
+}
+
+// UnmarkImmutable makes an immutable key writable again. It is a no-op for keys that are not immutable.
+func (kv *KeyValueStore) UnmarkImmutable(key string) error {
+	if err := kv.ensureLoaded(); err != nil {
+		return err
+	}
+	if err := kv.admitMutation(); err != nil {
+		return err
+	}
+	kv.Lock()
+	defer kv.Unlock()
+
+	if _, frozen := kv.immutableValue(key); !frozen {
+		return nil
+	}
+	kv.setImmutableLocked(key, "", false)
+	log.Printf("UnmarkImmutable: Key '%s' is writable again\n", key)
+	kv.notificationManager.Notify("mutable:" + key)
+	return nil
+}
+
+// ImmutableKeys returns the keys frozen by MarkImmutable, sorted.
+func (kv *KeyValueStore) ImmutableKeys() []string {
+	if err := kv.ensureLoaded(); err != nil {
+		log.Printf("ImmutableKeys: Data not loaded: %v\n", err)
+		return nil
+	}
+	frozen := kv.immutable.Load()
+	if frozen == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(*frozen))
+	for key := range *frozen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ForceDelete removes key like Delete, even if it is immutable.
+func (kv *KeyValueStore) ForceDelete(key string) error {
+	if err := kv.ensureLoaded(); err != nil {
+		return err
+	}
+	if err := kv.admitMutation(); err != nil {
+		return err
+	}
+	acquired := kv.lockWrite(OpDelete)
+	defer kv.unlockWrite(OpDelete, acquired)
+
+	kv.flushPendingLocked(key)
+	if _, exists := kv.data[key]; !exists {
+		return ErrKeyNotFound
+	}
+	// Deleting the key unfreezes it through persistDelete.
+	kv.deleteLocked(key)
+	return nil
+}
+
+// setImmutableLocked freezes key with value, or unfreezes it, by publishing a new copy of the immutable keys
+// for lock-free readers, and persists the change. The caller must hold the write lock.
+func (kv *KeyValueStore) setImmutableLocked(key, value string, frozen bool) {
+	next := make(map[string]string)
+	if current := kv.immutable.Load(); current != nil {
+		for k, v := range *current {
+			next[k] = v
+		}
+	}
+	if frozen {
+		next[key] = value
+	} else {
+		delete(next, key)
+	}
+	kv.immutable.Store(&next)
+	kv.persistImmutable()
+}
+
+// refreshImmutableLocked updates the lock-free copy of key after its history was replaced or removed, such
+// as by a merge or restore. The caller must hold the write lock.
+func (kv *KeyValueStore) refreshImmutableLocked(key string) {
+	current, frozen := kv.immutableValue(key)
+	if !frozen {
+		return
+	}
+	versions, exists := kv.data[key]
+	switch {
+	case !exists || len(versions) == 0:
+		kv.setImmutableLocked(key, "", false)
+	case latestValue(versions) != current:
+		kv.setImmutableLocked(key, latestValue(versions), true)
+	}
+}
+
+// resetImmutableLocked freezes the keys among keys that exist, after the store contents were replaced.
+// The caller must hold the write lock.
+func (kv *KeyValueStore) resetImmutableLocked(keys []string) {
+	if len(keys) == 0 && kv.immutable.Load() == nil {
+		return
+	}
+	next := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if versions, exists := kv.data[key]; exists && len(versions) > 0 {
+			next[key] = latestValue(versions)
+		}
+	}
+	kv.immutable.Store(&next)
+}
+
+// immutableVersions returns the history stored under the reserved immutable record, or nil if no key is
+// immutable.
+func (kv *KeyValueStore) immutableVersions() []KeyValue {
+	frozen := kv.immutable.Load()
+	if frozen == nil || len(*frozen) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(*frozen))
+	for key := range *frozen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	data, _ := json.Marshal(keys)
+	return []KeyValue{{Value: string(data), Timestamp: time.Now()}}
+}
+
+// persistImmutable writes the immutable keys through to the record persister. The caller must hold the
+// write lock.
+func (kv *KeyValueStore) persistImmutable() {
+	if kv.records == nil {
+		return
+	}
+	versions := kv.immutableVersions()
+	if versions == nil {
+		kv.persistFailed("DeleteKey", immutableRecord, kv.records.DeleteKey(immutableRecord))
+		return
+	}
+	sealed, err := kv.sealVersions(versions)
+	if err == nil {
+		err = kv.records.ReplaceKey(immutableRecord, sealed, time.Time{})
+	}
+	kv.persistFailed("ReplaceKey", immutableRecord, err)
+}
+
+// takeImmutable removes the reserved immutable record from histories and returns the keys it lists.
+func takeImmutable(histories map[string][]KeyValue) []string {
+	versions, ok := histories[immutableRecord]
+	if !ok {
+		return nil
+	}
+	delete(histories, immutableRecord)
+	return parseImmutable(latestValue(versions))
+}
+
+// parseImmutable decodes the keys listed by an immutable record.
+func parseImmutable(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var keys []string
+	if err := json.Unmarshal([]byte(value), &keys); err != nil {
+		log.Printf("load: Ignoring malformed immutable record: %v\n", err)
+		return nil
+	}
+	return keys
+}
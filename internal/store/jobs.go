@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxFinishedJobs is how many finished jobs are kept for status queries; older ones are forgotten.
+const maxFinishedJobs = 32
+
+// Errors returned by the job manager.
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobRunning  = errors.New("another job is running")
+)
+
+// Job states.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// JobFunc is a long-running admin operation. It must return promptly once ctx is canceled, and reports
+// its progress as done out of total units of work.
+type JobFunc func(ctx context.Context, progress func(done, total int)) error
+
+// JobStatus describes a tracked job.
+type JobStatus struct {
+	ID       string
+	Name     string
+	State    string
+	Done     int
+	Total    int
+	Percent  float64
+	Started  time.Time
+	Finished time.Time // Zero while running
+	Error    string    // Why the job failed, if it did
+}
+
+// job is a tracked job and its cancellation.
+type job struct {
+	status JobStatus
+	cancel context.CancelFunc
+}
+
+// jobManager runs admin operations as tracked jobs, one at a time.
+type jobManager struct {
+	mu       sync.Mutex
+	next     int
+	jobs     map[string]*job
+	finished []string // IDs of finished jobs, oldest first
+	running  *job
+	wg       sync.WaitGroup
+}
+
+// newJobManager creates an empty jobManager.
+func newJobManager() *jobManager {
+	return &jobManager{jobs: make(map[string]*job)}
+}
+
+// start runs fn in the background as a job named name and returns its ID, or ErrJobRunning if a job is running.
+func (m *jobManager) start(name string, fn JobFunc) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running != nil {
+		return "", fmt.Errorf("%w: %s (%s)", ErrJobRunning, m.running.status.ID, m.running.status.Name)
+	}
+
+	m.next++
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		status: JobStatus{ID: fmt.Sprintf("job-%d", m.next), Name: name, State: JobRunning, Started: time.Now()},
+		cancel: cancel,
+	}
+	m.jobs[j.status.ID] = j
+	m.running = j
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		err := fn(ctx, func(done, total int) { m.progress(j, done, total) })
+		cancel()
+		m.finish(j, err)
+	}()
+	log.Printf("StartJob: Started %s (%s)\n", j.status.ID, name)
+	return j.status.ID, nil
+}
+
+// progress records the progress reported by a running job.
+func (m *jobManager) progress(j *job, done, total int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j.status.Done, j.status.Total = done, total
+	if total > 0 {
+		j.status.Percent = 100 * float64(done) / float64(total)
+	}
+}
+
+// finish records the outcome of a job and forgets the oldest finished jobs.
+func (m *jobManager) finish(j *job, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j.status.Finished = time.Now()
+	switch {
+	case err == nil:
+		j.status.State = JobSucceeded
+		j.status.Percent = 100
+	case errors.Is(err, context.Canceled):
+		j.status.State = JobCanceled
+	default:
+		j.status.State = JobFailed
+		j.status.Error = err.Error()
+	}
+	log.Printf("StartJob: %s (%s) %s after %v\n", j.status.ID, j.status.Name, j.status.State, j.status.Finished.Sub(j.status.Started))
+
+	m.running = nil
+	m.finished = append(m.finished, j.status.ID)
+	if len(m.finished) > maxFinishedJobs {
+		delete(m.jobs, m.finished[0])
+		m.finished = m.finished[1:]
+	}
+}
+
+// status returns the status of the job with the given ID.
+func (m *jobManager) status(id string) (JobStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return JobStatus{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return j.status, nil
+}
+
+// cancelJob asks the job with the given ID to stop. Canceling a finished job does nothing.
+func (m *jobManager) cancelJob(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	j.cancel()
+	return nil
+}
+
+// list returns the status of every tracked job, oldest first.
+func (m *jobManager) list() []JobStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make([]JobStatus, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		statuses = append(statuses, j.status)
+	}
+	sort.Slice(statuses, func(i, k int) bool { return statuses[i].Started.Before(statuses[k].Started) })
+	return statuses
+}
+
+// stop cancels the running job, if any, and waits for it to return.
+func (m *jobManager) stop() {
+	m.mu.Lock()
+	if m.running != nil {
+		m.running.cancel()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// StartJob runs fn in the background as a tracked job and returns its ID. Only one job runs at a time;
+// starting another fails with ErrJobRunning. Stop cancels the running job and waits for it.
+func (kv *KeyValueStore) StartJob(name string, fn JobFunc) (string, error) {
+	return kv.jobs.start(name, fn)
+}
+
+// JobStatus returns the status of a running or recently finished job.
+func (kv *KeyValueStore) JobStatus(id string) (JobStatus, error) {
+	return kv.jobs.status(id)
+}
+
+// CancelJob cancels a running job. The job stops at its next cancellation check and is reported as canceled.
+func (kv *KeyValueStore) CancelJob(id string) error {
+	return kv.jobs.cancelJob(id)
+}
+
+// Jobs returns the status of the running job and of recently finished ones, oldest first.
+func (kv *KeyValueStore) Jobs() []JobStatus {
+	return kv.jobs.list()
+}
+
+// StartCompaction runs CompactContext as a tracked job.
+func (kv *KeyValueStore) StartCompaction(keep int) (string, error) {
+	return kv.StartJob("compact", func(ctx context.Context, progress func(done, total int)) error {
+		_, err := kv.CompactContext(ctx, keep, progress)
+		return err
+	})
+}
+
+// StartRehydrateTTLs runs RehydrateTTLsContext as a tracked job.
+func (kv *KeyValueStore) StartRehydrateTTLs(rule TTLRule) (string, error) {
+	return kv.StartJob("rehydrate_ttls", func(ctx context.Context, progress func(done, total int)) error {
+		_, err := kv.RehydrateTTLsContext(ctx, rule, progress)
+		return err
+	})
+}
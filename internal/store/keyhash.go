@@ -0,0 +1,176 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// keyNameRecordPrefix marks the records holding the encrypted name of a hashed key.
+const keyNameRecordPrefix = "name:"
+
+// errKeyHashingWithoutEncryption is returned when key hashing is enabled on a store without an encryption key,
+// which would leave the key names readable in the hashed-to-name mapping.
+var errKeyHashingWithoutEncryption = errors.New("key hashing requires an encryption key")
+
+// hashedSnapshot is the persisted format of a store with key hashing: histories are keyed by the HMAC of
+// their key, and Keys maps each HMAC to the key encrypted with the store key.
+type hashedSnapshot struct {
+	Keys map[string]string     `json:"keys"`
+	Data map[string][]KeyValue `json:"data"`
+}
+
+// hashKey returns the hex HMAC-SHA256 of key under the key hashing secret.
+func (kv *KeyValueStore) hashKey(key string) string {
+	mac := hmac.New(sha256.New, kv.keySecret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// persistedKey returns the name key is persisted under.
+func (kv *KeyValueStore) persistedKey(key string) string {
+	if kv.keySecret == nil {
+		return key
+	}
+	return kv.hashKey(key)
+}
+
+// hashSnapshot replaces the keys of histories with their HMAC and records their encrypted names.
+func (kv *KeyValueStore) hashSnapshot(histories map[string][]KeyValue) (hashedSnapshot, error) {
+	if len(kv.encryptionKey) == 0 {
+		return hashedSnapshot{}, errKeyHashingWithoutEncryption
+	}
+	snapshot := hashedSnapshot{
+		Keys: make(map[string]string, len(histories)),
+		Data: make(map[string][]KeyValue, len(histories)),
+	}
+	for key, versions := range histories {
+		name, err := kv.sealValue(key)
+		if err != nil {
+			return hashedSnapshot{}, err
+		}
+		hashed := kv.hashKey(key)
+		snapshot.Keys[hashed] = name
+		snapshot.Data[hashed] = versions
+	}
+	return snapshot, nil
+}
+
+// openKeyName decrypts the name of a hashed key and checks it against the hash, which fails
+// when the store uses a different secret than the data was written with.
+func (kv *KeyValueStore) openKeyName(hashed, sealed string) (string, error) {
+	if sealed == "" {
+		return "", fmt.Errorf("no name recorded for hashed key %s", hashed)
+	}
+	key, err := kv.openValue(sealed)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal([]byte(kv.hashKey(key)), []byte(hashed)) {
+		return "", fmt.Errorf("hashed key %s does not match its name; wrong key hashing secret?", hashed)
+	}
+	return key, nil
+}
+
+// unhashSnapshot parses a hashed snapshot and restores the plaintext keys.
+func (kv *KeyValueStore) unhashSnapshot(data []byte) (map[string][]KeyValue, error) {
+	var snapshot hashedSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("error unmarshalling data: %v", err)
+	}
+	histories := make(map[string][]KeyValue, len(snapshot.Data))
+	for hashed, versions := range snapshot.Data {
+		key, err := kv.openKeyName(hashed, snapshot.Keys[hashed])
+		if err != nil {
+			return nil, err
+		}
+		histories[key] = versions
+	}
+	return histories, nil
+}
+
+// keyNameRecord returns the record holding the encrypted name of key.
+func (kv *KeyValueStore) keyNameRecord(key string) (string, []KeyValue, error) {
+	name, err := kv.sealValue(key)
+	if err != nil {
+		return "", nil, err
+	}
+	return keyNameRecordPrefix + kv.hashKey(key), []KeyValue{{Value: name, Timestamp: time.Now()}}, nil
+}
+
+// persistKeyName writes the encrypted name of key to the record persister.
+func (kv *KeyValueStore) persistKeyName(key string) error {
+	if len(kv.encryptionKey) == 0 {
+		return errKeyHashingWithoutEncryption
+	}
+	record, versions, err := kv.keyNameRecord(key)
+	if err != nil {
+		return err
+	}
+	return kv.records.ReplaceKey(record, versions, time.Time{})
+}
+
+// unhashRecords restores the plaintext keys of records loaded from a record persister.
+// Values are still sealed; the names are decrypted here.
+func (kv *KeyValueStore) unhashRecords(data map[string][]KeyValue, expirations map[string]time.Time) (map[string][]KeyValue, map[string]time.Time, error) {
+	names := make(map[string]string)
+	for record, versions := range data {
+		if hashed, ok := strings.CutPrefix(record, keyNameRecordPrefix); ok && len(versions) > 0 {
+			names[hashed] = versions[len(versions)-1].Value
+		}
+	}
+
+	histories := make(map[string][]KeyValue, len(data)-len(names))
+	restored := make(map[string]time.Time, len(expirations))
+	for hashed, versions := range data {
+		if strings.HasPrefix(hashed, keyNameRecordPrefix) {
+			continue
+		}
+		key, err := kv.openKeyName(hashed, names[hashed])
+		if err != nil {
+			return nil, nil, err
+		}
+		histories[key] = versions
+		if expiresAt, ok := expirations[hashed]; ok {
+			restored[key] = expiresAt
+		}
+	}
+	return histories, restored, nil
+}
+
+// DumpTo writes the store contents to w in the persisted format like SaveTo. With revealKeys, a store
+// using key hashing writes plaintext keys, which a store without key hashing can load.
+func (kv *KeyValueStore) DumpTo(w io.Writer, revealKeys bool) error {
+	if !revealKeys || kv.keySecret == nil {
+		return kv.SaveTo(w)
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return err
+	}
+
+	kv.RLock()
+	defer kv.RUnlock()
+
+	histories, err := kv.withOffloadedHistories()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(kv.withSequence(withBinary(histories)))
+	if err != nil {
+		return fmt.Errorf("error marshalling data: %v", err)
+	}
+	encoded, err := kv.sealSnapshot(data)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(encoded); err != nil {
+		return fmt.Errorf("error writing data: %v", err)
+	}
+	return nil
+}
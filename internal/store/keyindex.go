@@ -0,0 +1,91 @@
+package store
+
+import (
+	"sync/atomic"
+)
+
+// keyIndex is a copy-on-write list of keys that can be read without holding the store lock.
+// Writers must hold the store's write lock; every change publishes a new slice and published
+// slices are never modified.
+type keyIndex struct {
+	keys atomic.Pointer[[]string]
+}
+
+// newKeyIndex creates an empty key index.
+func newKeyIndex() *keyIndex {
+	idx := &keyIndex{}
+	idx.keys.Store(&[]string{})
+	return idx
+}
+
+// load returns the current published key list.
+func (idx *keyIndex) load() []string {
+	return *idx.keys.Load()
+}
+
+// add publishes a new key list with key appended, unless it is already listed.
+func (idx *keyIndex) add(key string) {
+	current := idx.load()
+	for _, k := range current {
+		if k == key {
+			return
+		}
+	}
+	next := make([]string, len(current), len(current)+1)
+	copy(next, current)
+	next = append(next, key)
+	idx.keys.Store(&next)
+}
+
+// remove publishes a new key list without key.
+func (idx *keyIndex) remove(key string) {
+	current := idx.load()
+	next := make([]string, 0, len(current))
+	for _, k := range current {
+		if k != key {
+			next = append(next, k)
+		}
+	}
+	idx.keys.Store(&next)
+}
+
+// reset publishes the keys of data as the new key list.
+func (idx *keyIndex) reset(data map[string][]KeyValue) {
+	next := make([]string, 0, len(data))
+	for key := range data {
+		next = append(next, key)
+	}
+	idx.keys.Store(&next)
+}
+
+// indexAdd records a newly created key; recording it again has no effect. The caller must hold the write lock.
+func (kv *KeyValueStore) indexAdd(key string) {
+	if kv.keyIndex != nil {
+		kv.keyIndex.add(key)
+	}
+	if kv.prefixIndex != nil {
+		kv.prefixIndex.add(key)
+	}
+}
+
+// indexRemove records a removed key. The caller must hold the write lock.
+func (kv *KeyValueStore) indexRemove(key string) {
+	if kv.keyIndex != nil {
+		kv.keyIndex.remove(key)
+	}
+	if kv.prefixIndex != nil {
+		kv.prefixIndex.remove(key)
+	}
+}
+
+// indexReset rebuilds the key indexes from the store contents, and makes the next stale read snapshot read
+// them all. The caller must hold the write lock.
+func (kv *KeyValueStore) indexReset() {
+	kv.staleReads.reset()
+	if kv.keyIndex != nil {
+		kv.keyIndex.reset(kv.data)
+	}
+	if kv.prefixIndex != nil {
+		kv.prefixIndex.reset(kv.data)
+	}
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrWrongType is returned by list, hash and sorted set operations on a key holding a value of another type.
+var ErrWrongType = errors.New("key holds a value of another type")
+
+// A list is stored as the JSON array of its elements, so Get returns it in that form, it is persisted,
+// versioned and notified like any value, and Set can seed one. Every operation rewrites the whole array,
+// which suits queues of up to a few thousand elements.
+
+// decodeList parses the list stored under key, which is empty if the key does not exist.
+func decodeList(key, value string, found bool) ([]string, error) {
+	if !found {
+		return nil, nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(value), &list); err != nil {
+		return nil, fmt.Errorf("key '%s' is not a list: %w", key, ErrWrongType)
+	}
+	return list, nil
+}
+
+// encodeList returns the stored form of list, and whether the key should be removed because it is empty.
+func encodeList(list []string) (string, bool, error) {
+	if len(list) == 0 {
+		return "", true, nil
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), false, nil
+}
+
+// updateList applies modify to the list stored under key and stores the result, deleting the key when the
+// list becomes empty. The key keeps its TTL.
+func (kv *KeyValueStore) updateList(key string, modify func(list []string) ([]string, error)) error {
+	_, _, err := kv.readModifyWrite(key, true, func(current string, found bool) (string, bool, error) {
+		list, err := decodeList(key, current, found)
+		if err != nil {
+			return "", false, err
+		}
+		if list, err = modify(list); err != nil {
+			return "", false, err
+		}
+		return encodeList(list)
+	})
+	return err
+}
+
+// LPush inserts values at the head of the list stored under key, creating it if needed, and returns its new
+// length. Values are inserted one after the other, so the last one ends up first.
+func (kv *KeyValueStore) LPush(key string, values ...string) (int, error) {
+	var length int
+	err := kv.updateList(key, func(list []string) ([]string, error) {
+		pushed := make([]string, 0, len(values)+len(list))
+		for i := len(values) - 1; i >= 0; i-- {
+			pushed = append(pushed, values[i])
+		}
+		pushed = append(pushed, list...)
+		length = len(pushed)
+		return pushed, nil
+	})
+	return length, err
+}
+
+// RPush appends values to the tail of the list stored under key, creating it if needed, and returns its new
+// length.
+func (kv *KeyValueStore) RPush(key string, values ...string) (int, error) {
+	var length int
+	err := kv.updateList(key, func(list []string) ([]string, error) {
+		list = append(list, values...)
+		length = len(list)
+		return list, nil
+	})
+	return length, err
+}
+
+// LPop removes and returns the first element of the list stored under key, deleting the key with its last
+// element. It returns ErrKeyNotFound if the key does not exist.
+func (kv *KeyValueStore) LPop(key string) (string, error) {
+	var popped string
+	err := kv.updateList(key, func(list []string) ([]string, error) {
+		if len(list) == 0 {
+			return nil, ErrKeyNotFound
+		}
+		popped = list[0]
+		return list[1:], nil
+	})
+	return popped, err
+}
+
+// RPop removes and returns the last element of the list stored under key, deleting the key with its last
+// element. It returns ErrKeyNotFound if the key does not exist.
+func (kv *KeyValueStore) RPop(key string) (string, error) {
+	var popped string
+	err := kv.updateList(key, func(list []string) ([]string, error) {
+		if len(list) == 0 {
+			return nil, ErrKeyNotFound
+		}
+		popped = list[len(list)-1]
+		return list[:len(list)-1], nil
+	})
+	return popped, err
+}
+
+// LRange returns the elements of the list stored under key from start to stop, both included. Negative
+// indexes count from the end, -1 being the last element, and indexes out of range are clamped, as in Redis.
+// A key that does not exist is an empty list.
+func (kv *KeyValueStore) LRange(key string, start, stop int) ([]string, error) {
+	values, _, err := kv.GetManyConsistent([]string{key})
+	if err != nil {
+		return nil, err
+	}
+	info, found := values[key]
+	list, err := decodeList(key, info.Value, found)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(list)
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return []string{}, nil
+	}
+	return append([]string(nil), list[start:stop+1]...), nil
+}
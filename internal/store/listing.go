@@ -0,0 +1,233 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for key listings.
+const (
+	defaultListingTTL     = 5 * time.Minute
+	defaultMaxListings    = 16
+	defaultMaxListingKeys = 1000000
+)
+
+// ErrListingExpired is returned for a listing that expired, was evicted or never existed.
+// The client should begin a new listing.
+var ErrListingExpired = errors.New("key listing expired or unknown; begin a new listing")
+
+// KeyPage is one page of a key listing.
+type KeyPage struct {
+	Keys []string
+	Next int  // Offset of the next page
+	Done bool // Whether this is the last page
+}
+
+// ListingStats describes the key listings currently held.
+type ListingStats struct {
+	Active int   // Live listings
+	Keys   int   // Keys held across listings
+	Bytes  int64 // Approximate memory held by the listed keys
+}
+
+// keyListing is a frozen, sorted snapshot of the keys matching a prefix.
+type keyListing struct {
+	keys      []string
+	bytes     int64
+	seq       uint64 // Creation order, used to evict the oldest listing
+	expiresAt time.Time
+}
+
+// keyListings holds the live listings and their limits.
+type keyListings struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	maxCount int
+	maxKeys  int
+	nextSeq  uint64
+	byID     map[string]*keyListing
+}
+
+// newKeyListings creates a listing registry with the given limits, using the defaults for limits <= 0.
+func newKeyListings(ttl time.Duration, maxCount, maxKeys int) *keyListings {
+	if ttl <= 0 {
+		ttl = defaultListingTTL
+	}
+	if maxCount <= 0 {
+		maxCount = defaultMaxListings
+	}
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxListingKeys
+	}
+	return &keyListings{ttl: ttl, maxCount: maxCount, maxKeys: maxKeys, byID: make(map[string]*keyListing)}
+}
+
+// purgeExpired drops expired listings. The caller must hold l.mu.
+func (l *keyListings) purgeExpired(now time.Time) {
+	for id, listing := range l.byID {
+		if now.After(listing.expiresAt) {
+			delete(l.byID, id)
+		}
+	}
+}
+
+// evictOldest drops the oldest listing. The caller must hold l.mu.
+func (l *keyListings) evictOldest() {
+	var oldestID string
+	var oldest uint64
+	for id, listing := range l.byID {
+		if oldestID == "" || listing.seq < oldest {
+			oldestID, oldest = id, listing.seq
+		}
+	}
+	if oldestID != "" {
+		log.Printf("BeginKeyListing: Evicting listing %s to stay within %d listings\n", oldestID, l.maxCount)
+		delete(l.byID, oldestID)
+	}
+}
+
+// BeginKeyListing captures the sorted keys starting with prefix and returns a listing ID for paging
+// through them with KeyListingPage. The snapshot does not change with later mutations, so every key
+// in it is returned exactly once. Listings expire after a period without page fetches.
+func (kv *KeyValueStore) BeginKeyListing(prefix string) (string, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return "", err
+	}
+
+	kv.RLock()
+	keys := make([]string, 0)
+	for key := range kv.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range kv.pendingKeysLocked() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	kv.RUnlock()
+
+	l := kv.listings
+	if len(keys) > l.maxKeys {
+		return "", fmt.Errorf("listing of prefix '%s' holds %d keys, above the limit of %d", prefix, len(keys), l.maxKeys)
+	}
+	sort.Strings(keys)
+
+	var bytes int64
+	for _, key := range keys {
+		bytes += int64(len(key))
+	}
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", fmt.Errorf("error generating listing ID: %v", err)
+	}
+	id := hex.EncodeToString(idBytes)
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.purgeExpired(now)
+	for len(l.byID) > 0 && len(l.byID) >= l.maxCount {
+		l.evictOldest()
+	}
+	l.nextSeq++
+	l.byID[id] = &keyListing{keys: keys, bytes: bytes, seq: l.nextSeq, expiresAt: now.Add(l.ttl)}
+
+	log.Printf("BeginKeyListing: Listing %s holds %d keys\n", id, len(keys))
+	return id, nil
+}
+
+// KeyListingPage returns up to limit keys of a listing starting at offset, and extends its lifetime.
+func (kv *KeyValueStore) KeyListingPage(listingID string, offset, limit int) (KeyPage, error) {
+	if offset < 0 || limit <= 0 {
+		return KeyPage{}, fmt.Errorf("invalid page: offset %d, limit %d", offset, limit)
+	}
+
+	l := kv.listings
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	listing, ok := l.byID[listingID]
+	if !ok || now.After(listing.expiresAt) {
+		delete(l.byID, listingID)
+		return KeyPage{}, ErrListingExpired
+	}
+	listing.expiresAt = now.Add(l.ttl)
+
+	if offset > len(listing.keys) {
+		offset = len(listing.keys)
+	}
+	end := offset + limit
+	if end > len(listing.keys) {
+		end = len(listing.keys)
+	}
+	return KeyPage{
+		Keys: append([]string(nil), listing.keys[offset:end]...),
+		Next: end,
+		Done: end == len(listing.keys),
+	}, nil
+}
+
+// EndKeyListing releases a listing before it expires.
+func (kv *KeyValueStore) EndKeyListing(listingID string) {
+	kv.listings.mu.Lock()
+	delete(kv.listings.byID, listingID)
+	kv.listings.mu.Unlock()
+}
+
+// KeyListingStats returns the number of live listings and the keys and memory they hold.
+func (kv *KeyValueStore) KeyListingStats() ListingStats {
+	l := kv.listings
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.purgeExpired(time.Now())
+
+	var stats ListingStats
+	for _, listing := range l.byID {
+		stats.Active++
+		stats.Keys += len(listing.keys)
+		stats.Bytes += listing.bytes
+	}
+	return stats
+}
+
+// KeysPage returns up to limit of the sorted keys starting with prefix that come after cursor, and the
+// cursor of the next page, which is "" after the last page. Pass "" to start. Unlike a key listing the
+// cursor holds no state in the store, so keys written between pages show up if they sort after it.
+func (kv *KeyValueStore) KeysPage(prefix, cursor string, limit int) ([]string, string, error) {
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("invalid page limit %d", limit)
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return nil, "", err
+	}
+
+	kv.RLock()
+	keys := make([]string, 0)
+	for key := range kv.data {
+		if key > cursor && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range kv.pendingKeysLocked() {
+		if key > cursor && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	kv.RUnlock()
+
+	sort.Strings(keys)
+	if len(keys) <= limit {
+		return keys, "", nil
+	}
+	return keys[:limit], keys[limit-1], nil
+}
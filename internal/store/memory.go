@@ -0,0 +1,160 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cgroupMemoryCurrent is the cgroup v2 file reporting the memory used by the process's cgroup.
+const cgroupMemoryCurrent = "/sys/fs/cgroup/memory.current"
+
+// defaultMemoryWatchdogInterval is the sampling interval of a watchdog configured without one.
+const defaultMemoryWatchdogInterval = time.Second
+
+// ErrMemoryPressure is returned by writes rejected while the memory watchdog reports pressure.
+var ErrMemoryPressure = errors.New("write rejected under memory pressure")
+
+// MemoryReader returns the current memory usage in bytes.
+type MemoryReader func() (uint64, error)
+
+// MemoryThresholds configures the memory watchdog.
+type MemoryThresholds struct {
+	HighWater    uint64 // Usage at which a priority save is triggered
+	LowWater     uint64 // Usage below which pressure ends; zero means HighWater
+	RejectWrites bool   // Reject writes with ErrMemoryPressure while under pressure
+}
+
+// memoryWatchdog periodically samples memory usage and reacts when it crosses the high-water mark.
+type memoryWatchdog struct {
+	interval time.Duration
+	read     MemoryReader
+
+	mu         sync.Mutex
+	thresholds MemoryThresholds
+
+	pressure atomic.Bool
+}
+
+// newMemoryWatchdog creates a memory watchdog using read, or the process memory usage if read is nil.
+func newMemoryWatchdog(interval time.Duration, thresholds MemoryThresholds, read MemoryReader) *memoryWatchdog {
+	if interval <= 0 {
+		interval = defaultMemoryWatchdogInterval
+	}
+	if read == nil {
+		read = readMemoryUsage
+	}
+	return &memoryWatchdog{interval: interval, read: read, thresholds: thresholds}
+}
+
+// readMemoryUsage returns the cgroup memory usage when available and the heap in use otherwise.
+func readMemoryUsage() (uint64, error) {
+	if data, err := os.ReadFile(cgroupMemoryCurrent); err == nil {
+		if usage, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil {
+			return usage, nil
+		}
+	}
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse, nil
+}
+
+// getThresholds returns the current thresholds.
+func (w *memoryWatchdog) getThresholds() MemoryThresholds {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.thresholds
+}
+
+// watchMemory is a background goroutine that samples memory usage every interval.
+func (kv *KeyValueStore) watchMemory(w *memoryWatchdog, beat func() bool) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !beat() {
+				return
+			}
+			kv.injectLoopFault(ComponentMemoryWatchdog)
+			kv.checkMemory(w)
+		case <-kv.stopChan:
+			return
+		}
+	}
+}
+
+// checkMemory samples memory usage once, entering or leaving the pressure state as needed.
+func (kv *KeyValueStore) checkMemory(w *memoryWatchdog) {
+	usage, err := w.read()
+	if err != nil {
+		log.Printf("watchMemory: Failed to read memory usage: %v\n", err)
+		return
+	}
+	thresholds := w.getThresholds()
+	lowWater := thresholds.LowWater
+	if lowWater == 0 {
+		lowWater = thresholds.HighWater
+	}
+
+	switch {
+	case !w.pressure.Load() && thresholds.HighWater > 0 && usage >= thresholds.HighWater:
+		w.pressure.Store(true)
+		log.Printf("watchMemory: Usage %d bytes crossed the high-water mark %d, saving\n", usage, thresholds.HighWater)
+		kv.notificationManager.Notify(fmt.Sprintf("memory_pressure:%d", usage))
+		if kv.Loaded() {
+			if err := kv.save(); err != nil {
+				log.Printf("watchMemory: Priority save failed: %v\n", err)
+			}
+		}
+	case w.pressure.Load() && usage < lowWater:
+		w.pressure.Store(false)
+		log.Printf("watchMemory: Usage %d bytes fell below the low-water mark %d\n", usage, lowWater)
+		kv.notificationManager.Notify(fmt.Sprintf("memory_pressure_cleared:%d", usage))
+	}
+}
+
+// admitWrite returns ErrMemoryPressure if writes are being rejected.
+func (kv *KeyValueStore) admitWrite() error {
+	w := kv.memoryWatchdog
+	if w == nil || !w.pressure.Load() || !w.getThresholds().RejectWrites {
+		return nil
+	}
+	return ErrMemoryPressure
+}
+
+// MemoryPressure reports whether memory usage is above the high-water mark and has not yet fallen below the low-water mark.
+func (kv *KeyValueStore) MemoryPressure() bool {
+	return kv.memoryWatchdog != nil && kv.memoryWatchdog.pressure.Load()
+}
+
+// MemoryThresholds returns the memory watchdog thresholds.
+func (kv *KeyValueStore) MemoryThresholds() (MemoryThresholds, error) {
+	if kv.memoryWatchdog == nil {
+		return MemoryThresholds{}, errors.New("memory watchdog not enabled")
+	}
+	return kv.memoryWatchdog.getThresholds(), nil
+}
+
+// SetMemoryThresholds changes the memory watchdog thresholds at runtime.
+func (kv *KeyValueStore) SetMemoryThresholds(thresholds MemoryThresholds) error {
+	if kv.memoryWatchdog == nil {
+		return errors.New("memory watchdog not enabled")
+	}
+	if thresholds.LowWater > thresholds.HighWater {
+		return fmt.Errorf("low-water mark %d above high-water mark %d", thresholds.LowWater, thresholds.HighWater)
+	}
+	kv.memoryWatchdog.mu.Lock()
+	kv.memoryWatchdog.thresholds = thresholds
+	kv.memoryWatchdog.mu.Unlock()
+	log.Printf("SetMemoryThresholds: High %d, low %d, reject writes %v\n", thresholds.HighWater, thresholds.LowWater, thresholds.RejectWrites)
+	return nil
+}
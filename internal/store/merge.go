@@ -0,0 +1,239 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+)
+
+// ConflictPolicy decides how Merge resolves a key whose history differs between the store and the snapshot.
+type ConflictPolicy int
+
+const (
+	// KeepNewest keeps the history whose latest version is more recent.
+	KeepNewest ConflictPolicy = iota
+	// KeepLongestHistory keeps the history with more versions, falling back to KeepNewest on a tie.
+	KeepLongestHistory
+	// MergeHistories interleaves both histories by timestamp, dropping identical adjacent values.
+	MergeHistories
+	// ResolveWithCallback asks MergeOptions.Resolve for the history to keep.
+	ResolveWithCallback
+)
+
+// Resolutions recorded in a MergeReport.
+const (
+	ResolutionKeptLive     = "kept-live"
+	ResolutionTookIncoming = "took-incoming"
+	ResolutionMerged       = "merged"
+	ResolutionCallback     = "callback"
+)
+
+// MergeConflict is a key present in both the store and the snapshot with different histories.
+type MergeConflict struct {
+	Key      string
+	Live     []KeyValue
+	Incoming []KeyValue
+}
+
+// MergeOptions configures Merge.
+type MergeOptions struct {
+	Policy ConflictPolicy
+	// Resolve returns the history to keep for a conflict under ResolveWithCallback. It runs under the
+	// store's write lock and must not call back into the store; an error leaves the live history in place.
+	Resolve func(conflict MergeConflict) ([]KeyValue, error)
+}
+
+// MergeResolution records how a conflicting key was resolved.
+type MergeResolution struct {
+	Key        string
+	Resolution string // One of the Resolution constants
+	Reason     string // Why the policy chose it, such as "newer" or "timestamp tie"
+	Versions   int    // Versions kept
+}
+
+// MergeReport lists what Merge did.
+type MergeReport struct {
+	Imported  []string          // Keys only present in the snapshot
+	Unchanged int               // Keys with identical histories on both sides
+	Conflicts []MergeResolution // Keys with differing histories, sorted by key
+	Errors    map[string]error  // Keys that could not be merged, such as conflicts the callback failed to resolve
+}
+
+// Merge imports a snapshot in the persisted format (as written by SaveTo) read from other into the live store.
+// Keys only in the snapshot are imported, keys only in the store are left alone, and keys whose histories
+// differ are resolved according to opts. Expirations of live keys are kept.
+func (kv *KeyValueStore) Merge(other io.Reader, opts MergeOptions) (MergeReport, error) {
+	report := MergeReport{Errors: make(map[string]error)}
+	if opts.Policy == ResolveWithCallback && opts.Resolve == nil {
+		return report, errors.New("merge policy ResolveWithCallback requires a Resolve callback")
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return report, err
+	}
+	if err := kv.admitMutation(); err != nil {
+		return report, err
+	}
+
+	data, err := io.ReadAll(other)
+	if err != nil {
+		return report, fmt.Errorf("error reading snapshot: %v", err)
+	}
+	snapshot, err := kv.decode(data)
+	if err != nil {
+		return report, err
+	}
+
+	kv.Lock()
+	defer kv.Unlock()
+
+	for key := range snapshot {
+		kv.flushPendingLocked(key)
+	}
+	histories, err := kv.withOffloadedHistories()
+	if err != nil {
+		return report, err
+	}
+
+	keys := make([]string, 0, len(snapshot))
+	for key := range snapshot {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		// Conflicts are resolved on full values; the kept history is delta-encoded again below.
+		incoming, err := materializeVersions(snapshot[key])
+		if err != nil {
+			report.Errors[key] = fmt.Errorf("error reconstructing incoming history: %v", err)
+			continue
+		}
+		if len(incoming) == 0 {
+			// Every key in the store has at least one version, and the policies compare latest versions.
+			report.Errors[key] = errors.New("snapshot holds no versions for the key")
+			continue
+		}
+		live, exists := histories[key]
+		if !exists {
+			kv.data[key] = kv.encodeDeltas(key, incoming)
+			kv.restampLocked(key)
+			kv.indexAdd(key)
+			kv.persistKey(key)
+			kv.notificationManager.notifyChange("added", key, "", latestValue(incoming), kv.globalSeq.Add(1))
+			report.Imported = append(report.Imported, key)
+			continue
+		}
+		if live, err = materializeVersions(live); err != nil {
+			report.Errors[key] = fmt.Errorf("error reconstructing live history: %v", err)
+			continue
+		}
+		if sameHistory(live, incoming) {
+			report.Unchanged++
+			continue
+		}
+
+		resolution, versions, err := resolveConflict(MergeConflict{Key: key, Live: live, Incoming: incoming}, opts)
+		if err != nil {
+			report.Errors[key] = err
+			continue
+		}
+		resolution.Versions = len(versions)
+		report.Conflicts = append(report.Conflicts, resolution)
+		if resolution.Resolution == ResolutionKeptLive {
+			continue
+		}
+		kv.data[key] = kv.encodeDeltas(key, versions)
+		kv.restampLocked(key)
+		kv.forgetHistory(key)
+		kv.persistKey(key)
+		kv.notificationManager.notifyChange("updated", key, latestValue(live), latestValue(versions), kv.globalSeq.Add(1))
+	}
+
+	log.Printf("Merge: %d imported, %d unchanged, %d conflicts, %d failed\n",
+		len(report.Imported), report.Unchanged, len(report.Conflicts), len(report.Errors))
+	return report, nil
+}
+
+// resolveConflict applies the conflict policy and returns the resolution and the history to keep.
+func resolveConflict(conflict MergeConflict, opts MergeOptions) (MergeResolution, []KeyValue, error) {
+	resolution := MergeResolution{Key: conflict.Key}
+	switch opts.Policy {
+	case KeepLongestHistory:
+		switch {
+		case len(conflict.Incoming) > len(conflict.Live):
+			resolution.Resolution, resolution.Reason = ResolutionTookIncoming, "longer history"
+			return resolution, conflict.Incoming, nil
+		case len(conflict.Incoming) < len(conflict.Live):
+			resolution.Resolution, resolution.Reason = ResolutionKeptLive, "longer history"
+			return resolution, conflict.Live, nil
+		}
+		return keepNewest(resolution, conflict, "equal history length, ")
+	case MergeHistories:
+		resolution.Resolution, resolution.Reason = ResolutionMerged, "interleaved by timestamp"
+		return resolution, mergeHistories(conflict.Live, conflict.Incoming), nil
+	case ResolveWithCallback:
+		versions, err := opts.Resolve(conflict)
+		if err != nil {
+			return resolution, nil, err
+		}
+		if len(versions) == 0 {
+			return resolution, nil, fmt.Errorf("resolver returned no versions for key '%s'", conflict.Key)
+		}
+		resolution.Resolution, resolution.Reason = ResolutionCallback, "resolved by callback"
+		return resolution, versions, nil
+	}
+	return keepNewest(resolution, conflict, "")
+}
+
+// keepNewest keeps the history whose latest version is more recent; the live history wins a tie.
+func keepNewest(resolution MergeResolution, conflict MergeConflict, reasonPrefix string) (MergeResolution, []KeyValue, error) {
+	live := conflict.Live[len(conflict.Live)-1].Timestamp
+	incoming := conflict.Incoming[len(conflict.Incoming)-1].Timestamp
+	switch {
+	case incoming.After(live):
+		resolution.Resolution, resolution.Reason = ResolutionTookIncoming, reasonPrefix+"newer"
+		return resolution, conflict.Incoming, nil
+	case incoming.Equal(live):
+		resolution.Resolution, resolution.Reason = ResolutionKeptLive, reasonPrefix+"timestamp tie"
+	default:
+		resolution.Resolution, resolution.Reason = ResolutionKeptLive, reasonPrefix+"newer"
+	}
+	return resolution, conflict.Live, nil
+}
+
+// mergeHistories interleaves two chronological histories by timestamp, taking live versions first on a tie
+// and dropping a version whose value equals the one before it.
+func mergeHistories(live, incoming []KeyValue) []KeyValue {
+	merged := make([]KeyValue, 0, len(live)+len(incoming))
+	add := func(version KeyValue) {
+		if n := len(merged); n > 0 && merged[n-1].Value == version.Value {
+			return
+		}
+		merged = append(merged, version)
+	}
+	i, j := 0, 0
+	for i < len(live) || j < len(incoming) {
+		if j == len(incoming) || (i < len(live) && !incoming[j].Timestamp.Before(live[i].Timestamp)) {
+			add(live[i])
+			i++
+		} else {
+			add(incoming[j])
+			j++
+		}
+	}
+	return merged
+}
+
+// sameHistory reports whether two histories hold the same values at the same times.
+func sameHistory(a, b []KeyValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Value != b[i].Value || !a[i].Timestamp.Equal(b[i].Timestamp) {
+			return false
+		}
+	}
+	return true
+}
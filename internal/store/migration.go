@@ -0,0 +1,299 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suffixes of the files written next to a data file by migrations.
+const (
+	migrationGenerationSuffix = ".migrating"
+	preMigrationSuffix        = ".pre-migration-"
+	postMigrationSuffix       = ".post-migration-"
+)
+
+// ErrMigrationVerification is returned when migrated data written to disk does not reload to the contents
+// the migrations produced. The original data file is left untouched.
+var ErrMigrationVerification = errors.New("migrated data failed verification")
+
+// Migration converts a data file from a format the store no longer reads to a newer one.
+type Migration struct {
+	Name   string                                               // Short name reported in plans and logs
+	From   string                                               // Description of the source format
+	To     string                                               // Description of the target format
+	Detect func(data []byte) bool                               // Reports whether data is in the source format
+	Apply  func(kv *KeyValueStore, data []byte) ([]byte, error) // Converts data to the target format
+}
+
+// FlatMapMigration converts a legacy plain JSON object of keys to string values into plain JSON version
+// histories holding a single version of each value.
+var FlatMapMigration = Migration{
+	Name: "flat-map",
+	From: "plain JSON object of string values",
+	To:   "plain JSON version histories",
+	Detect: func(data []byte) bool {
+		var flat map[string]string
+		return json.Unmarshal(data, &flat) == nil && flat != nil
+	},
+	Apply: func(kv *KeyValueStore, data []byte) ([]byte, error) {
+		var flat map[string]string
+		if err := json.Unmarshal(data, &flat); err != nil {
+			return nil, fmt.Errorf("error unmarshalling flat map: %v", err)
+		}
+		now := time.Now()
+		histories := make(map[string][]KeyValue, len(flat))
+		for key, value := range flat {
+			histories[key] = []KeyValue{{Value: value, Timestamp: now}}
+		}
+		return json.Marshal(histories)
+	},
+}
+
+// PlainJSONMigration seals plain JSON version histories into the current persisted format: compressed,
+// encrypted with the store's key and Base64 encoded.
+var PlainJSONMigration = Migration{
+	Name: "seal-plain-json",
+	From: "plain JSON version histories",
+	To:   "sealed snapshot",
+	Detect: func(data []byte) bool {
+		var histories map[string][]KeyValue
+		return json.Unmarshal(data, &histories) == nil && histories != nil
+	},
+	Apply: func(kv *KeyValueStore, data []byte) ([]byte, error) {
+		var histories map[string][]KeyValue
+		if err := json.Unmarshal(data, &histories); err != nil {
+			return nil, fmt.Errorf("error unmarshalling histories: %v", err)
+		}
+		return kv.encodeData(histories)
+	},
+}
+
+// DefaultMigrations returns the migrations of every legacy format the store knows, in the order they apply.
+func DefaultMigrations() []Migration {
+	return []Migration{FlatMapMigration, PlainJSONMigration}
+}
+
+// MigrationStep describes a migration applied to a data file.
+type MigrationStep struct {
+	Name string
+	From string
+	To   string
+}
+
+// MigrationPlan describes what loading a data file would migrate.
+type MigrationPlan struct {
+	Steps    []MigrationStep // Migrations applied, in order; empty when the file needs none
+	Keys     int             // Keys of the migrated contents
+	Hash     string          // Content hash of the migrated contents
+	Preserve string          // Path the original would be preserved at
+}
+
+// applyMigrations runs every migration detecting its source format in data, in order, and returns the
+// result and the steps applied.
+func (kv *KeyValueStore) applyMigrations(data []byte) ([]byte, []MigrationStep, error) {
+	var steps []MigrationStep
+	for _, m := range kv.migrations {
+		if !m.Detect(data) {
+			continue
+		}
+		migrated, err := m.Apply(kv, data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("migration %s failed: %v", m.Name, err)
+		}
+		data = migrated
+		steps = append(steps, MigrationStep{Name: m.Name, From: m.From, To: m.To})
+	}
+	return data, steps, nil
+}
+
+// migrationHash hashes every version of every key, in key order.
+func migrationHash(histories map[string][]KeyValue) string {
+	keys := make([]string, 0, len(histories))
+	for key := range histories {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(historyHash(histories[key])))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// PlanMigrations reports the migrations loading the data file would apply and the contents they would
+// produce, without writing anything.
+func (kv *KeyValueStore) PlanMigrations() (MigrationPlan, error) {
+	fb, ok := kv.backend.(*FileBackend)
+	if !ok {
+		return MigrationPlan{}, errors.New("migrations need a data file")
+	}
+	data, err := fb.Load()
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	migrated, steps, err := kv.applyMigrations(data)
+	if err != nil || len(steps) == 0 {
+		return MigrationPlan{}, err
+	}
+	histories, err := kv.decode(migrated)
+	if err != nil {
+		return MigrationPlan{}, fmt.Errorf("migrated data does not load: %v", err)
+	}
+	n, err := nextMigrationGeneration(fb.Path)
+	if err != nil {
+		return MigrationPlan{}, err
+	}
+	return MigrationPlan{
+		Steps:    steps,
+		Keys:     len(histories),
+		Hash:     migrationHash(histories),
+		Preserve: fb.Path + preMigrationSuffix + strconv.Itoa(n),
+	}, nil
+}
+
+// migrate applies the store's migrations to data read from the data file. When any applies, the result
+// is written to a generation file and reloaded; only if its contents hash to those of the migrated data
+// is the original preserved as filePath+".pre-migration-<n>" and the generation file renamed over it.
+func (kv *KeyValueStore) migrate(fb *FileBackend, data []byte) ([]byte, error) {
+	if err := kv.injectFault(OpMigrate, fb.Path); err != nil {
+		return nil, err
+	}
+	migrated, steps, err := kv.applyMigrations(data)
+	if err != nil || len(steps) == 0 {
+		return data, err
+	}
+	histories, err := kv.decode(migrated)
+	if err != nil {
+		return nil, fmt.Errorf("migrated data does not load: %v", err)
+	}
+	want := migrationHash(histories)
+
+	generation := fb.Path + migrationGenerationSuffix
+	if err := os.WriteFile(generation, kv.injectCorruption(OpMigrate, fb.Path, migrated), 0644); err != nil {
+		return nil, fmt.Errorf("error writing migrated data: %v", err)
+	}
+	kv.ioStats.write(IOSnapshot, len(migrated))
+	written, err := kv.verifyGeneration(generation, want)
+	if err != nil {
+		os.Remove(generation)
+		return nil, err
+	}
+
+	n, err := nextMigrationGeneration(fb.Path)
+	if err != nil {
+		os.Remove(generation)
+		return nil, err
+	}
+	preserved := fb.Path + preMigrationSuffix + strconv.Itoa(n)
+	if err := os.Link(fb.Path, preserved); err != nil {
+		// Hard links are not supported everywhere; a copy preserves the original as well.
+		if err := os.WriteFile(preserved, data, 0644); err != nil {
+			os.Remove(generation)
+			return nil, fmt.Errorf("error preserving original data: %v", err)
+		}
+	}
+	if err := os.Rename(generation, fb.Path); err != nil {
+		os.Remove(generation)
+		return nil, fmt.Errorf("error replacing data file: %v", err)
+	}
+
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = step.Name
+	}
+	log.Printf("migrate: Applied %s to %d keys, original preserved as %s\n", strings.Join(names, ", "), len(histories), preserved)
+	return written, nil
+}
+
+// verifyGeneration reloads a generation file and checks that its contents hash to want.
+func (kv *KeyValueStore) verifyGeneration(generation, want string) ([]byte, error) {
+	written, err := os.ReadFile(generation)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMigrationVerification, err)
+	}
+	histories, err := kv.decode(written)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMigrationVerification, err)
+	}
+	if got := migrationHash(histories); got != want {
+		return nil, fmt.Errorf("%w: content hash %s, expected %s", ErrMigrationVerification, got, want)
+	}
+	return written, nil
+}
+
+// migrationGenerations returns the generations of the originals preserved next to the data file at path.
+func migrationGenerations(path string) ([]int, error) {
+	matches, err := filepath.Glob(path + preMigrationSuffix + "*")
+	if err != nil {
+		return nil, fmt.Errorf("error listing preserved originals: %v", err)
+	}
+	var generations []int
+	for _, match := range matches {
+		if n, err := strconv.Atoi(strings.TrimPrefix(match, path+preMigrationSuffix)); err == nil && n > 0 {
+			generations = append(generations, n)
+		}
+	}
+	sort.Ints(generations)
+	return generations, nil
+}
+
+// nextMigrationGeneration returns the generation the next preserved original of path takes.
+func nextMigrationGeneration(path string) (int, error) {
+	generations, err := migrationGenerations(path)
+	if err != nil || len(generations) == 0 {
+		return 1, err
+	}
+	return generations[len(generations)-1] + 1, nil
+}
+
+// RollbackMigration restores the original of the data file at path preserved by a migration, the latest
+// one if generation is zero, and returns the generation restored. The migrated file is kept as
+// path+".post-migration-<n>". It fails with ErrDataFileInUse while a process announced with WithOwnerFile
+// that it owns the data file.
+func RollbackMigration(path string, generation int) (int, error) {
+	if pid, owned, err := DataFileOwner(path); err != nil {
+		return 0, err
+	} else if owned {
+		return 0, fmt.Errorf("%w: %s is owned by process %d", ErrDataFileInUse, path, pid)
+	}
+	if generation == 0 {
+		generations, err := migrationGenerations(path)
+		if err != nil {
+			return 0, err
+		}
+		if len(generations) == 0 {
+			return 0, fmt.Errorf("no original of %s preserved by a migration: %w", path, os.ErrNotExist)
+		}
+		generation = generations[len(generations)-1]
+	}
+
+	preserved := path + preMigrationSuffix + strconv.Itoa(generation)
+	original, err := os.ReadFile(preserved)
+	if err != nil {
+		return 0, fmt.Errorf("error reading preserved original: %w", err)
+	}
+	if current, err := os.ReadFile(path); err == nil && !bytes.Equal(current, original) {
+		if err := os.WriteFile(path+postMigrationSuffix+strconv.Itoa(generation), current, 0644); err != nil {
+			return 0, fmt.Errorf("error keeping migrated data: %v", err)
+		}
+	}
+	if err := os.Rename(preserved, path); err != nil {
+		return 0, fmt.Errorf("error restoring preserved original: %v", err)
+	}
+	log.Printf("RollbackMigration: Restored %s from generation %d\n", path, generation)
+	return generation, nil
+}
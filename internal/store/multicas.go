@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrConditionFailed is wrapped by the ConditionFailedError MultiCompareAndSwap returns when a condition
+// does not hold.
+var ErrConditionFailed = errors.New("condition failed")
+
+// Condition is a precondition of MultiCompareAndSwap on the latest value of an existing key, or on the
+// key not existing if Absent is set.
+type Condition struct {
+	Key        string
+	Value      string // Expected latest value, unless ByRevision is set
+	Revision   uint64 // Expected revision, as in ValueInfo.Revision, if ByRevision is set
+	ByRevision bool
+	Absent     bool // Expect the key not to exist or to have expired; Value and Revision are ignored
+}
+
+// Update is a write made by MultiCompareAndSwap.
+type Update struct {
+	Key    string
+	Value  string
+	TTL    time.Duration
+	Delete bool // Remove the key instead of setting it; Value and TTL are ignored
+}
+
+// ConditionFailedError reports the first condition of a MultiCompareAndSwap that did not hold, so the
+// caller can re-read the key and retry.
+type ConditionFailedError struct {
+	Index     int // Position of the condition in the list passed in
+	Condition Condition
+	Found     bool   // Whether the key existed and had not expired
+	Value     string // Latest value of the key, if found
+	Revision  uint64 // Revision of the key, if found
+}
+
+func (e *ConditionFailedError) Error() string {
+	if e.Condition.Absent {
+		return fmt.Sprintf("%v: condition %d: key '%s' exists", ErrConditionFailed, e.Index, e.Condition.Key)
+	}
+	if !e.Found {
+		return fmt.Sprintf("%v: condition %d: key '%s' not found", ErrConditionFailed, e.Index, e.Condition.Key)
+	}
+	return fmt.Sprintf("%v: condition %d: key '%s' is at revision %d", ErrConditionFailed, e.Index, e.Condition.Key, e.Revision)
+}
+
+func (e *ConditionFailedError) Unwrap() error {
+	return ErrConditionFailed
+}
+
+// MultiCompareAndSwap applies updates only if every condition holds, checking and writing under a single
+// write lock, and reports whether it did. Each update behaves like Set or Delete, including its
+// notification and pre-write hooks. When a condition does not hold, nothing is written and the error is a
+// *ConditionFailedError naming it.
+func (kv *KeyValueStore) MultiCompareAndSwap(conditions []Condition, updates []Update) (bool, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return false, err
+	}
+	if err := kv.admitMutation(); err != nil {
+		return false, err
+	}
+	if err := kv.admitWrite(); err != nil {
+		return false, err
+	}
+	accepted := make([]Update, len(updates))
+	for i, update := range updates {
+		if !update.Delete {
+			key, value, err := kv.applyPreWriteHooks(update.Key, update.Value)
+			if err != nil {
+				return false, err
+			}
+			update.Key, update.Value = key, value
+		}
+		if err := kv.checkComputed(context.Background(), update.Key); err != nil {
+			return false, err
+		}
+		if err := kv.checkMutable(update.Key); err != nil {
+			return false, err
+		}
+		accepted[i] = update
+	}
+
+	acquired := kv.lockWrite(OpMultiCompareAndSwap)
+	defer kv.unlockWrite(OpMultiCompareAndSwap, acquired)
+
+	// Keys may have been frozen while the updates waited for the lock.
+	for _, update := range accepted {
+		if err := kv.checkMutable(update.Key); err != nil {
+			return false, err
+		}
+	}
+
+	// Conditions compare against pending values, and updates must land after them.
+	for _, condition := range conditions {
+		kv.flushPendingLocked(condition.Key)
+	}
+	for _, update := range accepted {
+		kv.flushPendingLocked(update.Key)
+	}
+
+	now := time.Now()
+	for i, condition := range conditions {
+		if err := kv.checkConditionLocked(i, condition, now); err != nil {
+			log.Printf("MultiCompareAndSwap: %v\n", err)
+			return false, err
+		}
+	}
+
+	for _, update := range accepted {
+		if !update.Delete {
+			kv.setLocked(update.Key, update.Value, update.TTL)
+		} else if _, exists := kv.data[update.Key]; exists {
+			kv.deleteLocked(update.Key)
+		}
+	}
+	return true, nil
+}
+
+// checkConditionLocked returns a *ConditionFailedError if condition i does not hold at now.
+// The caller must hold the lock.
+func (kv *KeyValueStore) checkConditionLocked(i int, condition Condition, now time.Time) error {
+	failed := &ConditionFailedError{Index: i, Condition: condition}
+	versions := kv.data[condition.Key]
+	if exp, ok := kv.expirations[condition.Key]; len(versions) == 0 || (ok && now.After(exp)) {
+		if condition.Absent {
+			return nil
+		}
+		return failed
+	}
+	failed.Found = true
+	failed.Value = versions[len(versions)-1].Value
+	failed.Revision = kv.revisionLocked(condition.Key)
+
+	if condition.Absent {
+		return failed
+	}
+	if condition.ByRevision && failed.Revision != condition.Revision {
+		return failed
+	}
+	if !condition.ByRevision && failed.Value != condition.Value {
+		return failed
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// defaultNamespaceBatch is how many keys CloneNamespace copies per write lock hold.
+const defaultNamespaceBatch = 1000
+
+// ErrNamespaceExists is returned by CloneNamespace when keys of the destination namespace exist and
+// overwriting them was not requested.
+var ErrNamespaceExists = errors.New("namespace keys exist")
+
+// NamespaceOption configures CloneNamespace.
+type NamespaceOption func(*namespaceClone)
+
+// namespaceClone holds the settings of CloneNamespace.
+type namespaceClone struct {
+	history bool
+	dryRun  bool
+	batch   int
+}
+
+// CloneHistory copies the full history of each key instead of its latest version.
+func CloneHistory() NamespaceOption {
+	return func(c *namespaceClone) {
+		c.history = true
+	}
+}
+
+// CloneDryRun counts the keys CloneNamespace would copy, and checks for collisions, without copying them.
+func CloneDryRun() NamespaceOption {
+	return func(c *namespaceClone) {
+		c.dryRun = true
+	}
+}
+
+// CloneBatch sets how many keys CloneNamespace copies per write lock hold.
+func CloneBatch(size int) NamespaceOption {
+	return func(c *namespaceClone) {
+		if size > 0 {
+			c.batch = size
+		}
+	}
+}
+
+// checkNamespaces refuses empty or nested namespace prefixes, which would copy or swap keys into themselves.
+func checkNamespaces(a, b string) error {
+	if a == "" || b == "" || strings.HasPrefix(a, b) || strings.HasPrefix(b, a) {
+		return fmt.Errorf("namespaces '%s' and '%s' overlap", a, b)
+	}
+	return nil
+}
+
+// liveLocked reports whether key exists and has not expired at now. The caller must hold the lock.
+func (kv *KeyValueStore) liveLocked(key string, now time.Time) bool {
+	if _, exists := kv.data[key]; !exists {
+		return false
+	}
+	exp, hasTTL := kv.expirations[key]
+	return !hasTTL || now.Before(exp)
+}
+
+// CloneNamespace copies every live key starting with src to the same key under dst, with its latest
+// version, or its full history with CloneHistory, and its expiration, and returns how many keys were copied.
+// Keys are copied in batches, releasing the lock in between, with the key notifications of the copies
+// suppressed: the clone sends a "bulk:namespace_clone" summary followed by a
+// "namespace_cloned:<dst>:<count>" notification.
+// Unless overwrite is set, nothing is copied if any destination key exists; one created during the clone
+// is kept and reported with ErrNamespaceExists. Immutable destination keys are never overwritten.
+func (kv *KeyValueStore) CloneNamespace(src, dst string, overwrite bool, opts ...NamespaceOption) (int, error) {
+	settings := namespaceClone{batch: defaultNamespaceBatch}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	if err := checkNamespaces(src, dst); err != nil {
+		return 0, err
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, err
+	}
+	if !settings.dryRun {
+		if err := kv.admitMutation(); err != nil {
+			return 0, err
+		}
+	}
+
+	keys := kv.keysWithPrefix(src)
+	acquired := kv.lockRead(OpNamespace)
+	now := time.Now()
+	live, collisions := 0, 0
+	var collision string
+	for _, key := range keys {
+		if !kv.liveLocked(key, now) {
+			continue
+		}
+		live++
+		target := dst + strings.TrimPrefix(key, src)
+		if _, frozen := kv.immutableValue(target); frozen {
+			kv.unlockRead(OpNamespace, acquired)
+			return 0, fmt.Errorf("%w: '%s'", ErrImmutableKey, target)
+		}
+		if !overwrite && kv.liveLocked(target, now) {
+			if collisions == 0 {
+				collision = target
+			}
+			collisions++
+		}
+	}
+	kv.unlockRead(OpNamespace, acquired)
+	if collisions > 0 {
+		return 0, fmt.Errorf("%w: %d keys of namespace '%s', such as '%s'", ErrNamespaceExists, collisions, dst, collision)
+	}
+	if settings.dryRun {
+		return live, nil
+	}
+
+	if settings.history {
+		for _, key := range keys {
+			if _, err := kv.faultInHistory(key); err != nil {
+				return 0, err
+			}
+		}
+	}
+	bulk := kv.suspendBulk("namespace_clone")
+	count, kept := 0, 0
+	for start := 0; start < len(keys); start += settings.batch {
+		end := min(start+settings.batch, len(keys))
+		copied, skipped := kv.cloneBatch(keys[start:end], src, dst, overwrite, settings.history, bulk)
+		count += copied
+		kept += skipped
+	}
+	bulk.resume(true)
+
+	log.Printf("CloneNamespace: Copied %d keys from '%s' to '%s'\n", count, src, dst)
+	kv.notificationManager.Notify(fmt.Sprintf("namespace_cloned:%s:%d", dst, count))
+	if kept > 0 {
+		return count, fmt.Errorf("%w: %d keys of namespace '%s' were created during the clone and kept", ErrNamespaceExists, kept, dst)
+	}
+	return count, nil
+}
+
+// cloneBatch copies the live keys among keys from src to dst under a single write lock hold. It returns
+// how many were copied and how many were skipped as their destination appeared since the collision check.
+// Key events of the copies are suppressed as those of bulk.
+func (kv *KeyValueStore) cloneBatch(keys []string, src, dst string, overwrite, history bool, bulk *bulkSuspension) (int, int) {
+	acquired := kv.lockWrite(OpNamespace)
+	defer kv.unlockWrite(OpNamespace, acquired)
+	bulk.enter()
+	defer bulk.exit()
+
+	now := time.Now()
+	copied, skipped := 0, 0
+	for _, key := range keys {
+		if !kv.liveLocked(key, now) {
+			continue
+		}
+		target := dst + strings.TrimPrefix(key, src)
+		if !overwrite && kv.liveLocked(target, now) {
+			skipped++
+			continue
+		}
+		if _, frozen := kv.immutableValue(target); frozen {
+			log.Printf("CloneNamespace: Not copying over immutable key '%s'\n", target)
+			continue
+		}
+
+		versions := kv.data[key]
+		if history {
+			full, err := materializeVersions(versions)
+			if err != nil {
+				log.Printf("CloneNamespace: Not copying key '%s': %v\n", key, err)
+				continue
+			}
+			versions = full
+		} else {
+			versions = versions[len(versions)-1:]
+		}
+		exp, hasTTL := kv.expirations[key]
+		kv.moveLocked(target, versions, exp, hasTTL)
+		copied++
+	}
+	return copied, skipped
+}
+
+// moveLocked replaces the history of key with the full history versions and the given expiration, and
+// sends its added or updated notification. The caller must hold the write lock.
+func (kv *KeyValueStore) moveLocked(key string, versions []KeyValue, exp time.Time, hasTTL bool) {
+	previous, existed := kv.data[key]
+	kv.forgetHistory(key)
+	kv.data[key] = kv.encodeDeltas(key, append([]KeyValue(nil), versions...))
+	kv.restampLocked(key)
+	if hasTTL {
+		kv.expirations[key] = exp
+	} else {
+		delete(kv.expirations, key)
+	}
+	kv.scheduleExpiry(key)
+	kv.persistKey(key)
+
+	eventType := "updated"
+	if !existed {
+		kv.indexAdd(key)
+		eventType = "added"
+	}
+	kv.notificationManager.notifyChange(eventType, key, latestValue(previous), latestValue(versions), kv.globalSeq.Add(1))
+}
+
+// PromoteNamespace swaps the keys starting with candidate with those starting with target, under a single
+// write lock hold, so readers see either namespace entirely before or entirely after the swap: each key
+// moves with its history and expiration to the same key under the other prefix. Every changed key sends
+// its notification, followed by a single "namespace_promoted:<target>:<count>" notification counting the
+// keys promoted. It fails with ErrImmutableKey if either namespace holds an immutable key.
+func (kv *KeyValueStore) PromoteNamespace(candidate, target string) error {
+	if err := checkNamespaces(candidate, target); err != nil {
+		return err
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return err
+	}
+	if err := kv.admitMutation(); err != nil {
+		return err
+	}
+
+	acquired := kv.lockWrite(OpNamespace)
+	defer kv.unlockWrite(OpNamespace, acquired)
+
+	for key := range kv.pending {
+		if strings.HasPrefix(key, candidate) || strings.HasPrefix(key, target) {
+			kv.flushPendingLocked(key)
+		}
+	}
+
+	// Read every history before changing anything, so a failure leaves both namespaces alone.
+	type entry struct {
+		versions []KeyValue
+		exp      time.Time
+		hasTTL   bool
+	}
+	moved := make(map[string]entry)
+	promoted := 0
+	for key := range kv.data {
+		var renamed string
+		switch {
+		case strings.HasPrefix(key, candidate):
+			renamed = target + strings.TrimPrefix(key, candidate)
+			promoted++
+		case strings.HasPrefix(key, target):
+			renamed = candidate + strings.TrimPrefix(key, target)
+		default:
+			continue
+		}
+		if err := kv.checkMutable(key); err != nil {
+			return err
+		}
+		if err := kv.faultInHistoryLocked(key); err != nil {
+			return err
+		}
+		versions, err := materializeVersions(kv.data[key])
+		if err != nil {
+			return fmt.Errorf("error reconstructing history of key '%s': %v", key, err)
+		}
+		exp, hasTTL := kv.expirations[key]
+		moved[renamed] = entry{versions, exp, hasTTL}
+	}
+
+	for key, versions := range kv.data {
+		if _, replaced := moved[key]; replaced || !(strings.HasPrefix(key, candidate) || strings.HasPrefix(key, target)) {
+			continue
+		}
+		delete(kv.data, key)
+		delete(kv.expirations, key)
+		kv.scheduleExpiry(key)
+		kv.persistDelete(key)
+		kv.indexRemove(key)
+		kv.notificationManager.notifyChange("deleted", key, latestValue(versions), "", kv.globalSeq.Add(1))
+	}
+	for key, e := range moved {
+		kv.moveLocked(key, e.versions, e.exp, e.hasTTL)
+	}
+
+	log.Printf("PromoteNamespace: Promoted %d keys from '%s' to '%s'\n", promoted, candidate, target)
+	kv.notificationManager.Notify(fmt.Sprintf("namespace_promoted:%s:%d", target, promoted))
+	return nil
+}
@@ -1,81 +1,327 @@
 package store
 
 import (
-	"fmt"
 	"log"
+	"path"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// defaultSubscriptionBuffer is the queue size of subscriptions registered without an explicit buffer.
+const defaultSubscriptionBuffer = 1024
+
+// SubscriptionInfo describes a registered subscription and its delivery statistics.
+type SubscriptionInfo struct {
+	ID            int          `json:"id"`
+	Filter        string       `json:"filter"`
+	ChannelBuffer int          `json:"channel_buffer"`
+	Pending       int          `json:"pending"`
+	Dropped       uint64       `json:"dropped"`
+	RegisteredAt  time.Time    `json:"registered_at"`
+	EventFilter   *EventFilter `json:"event_filter,omitempty"` // Set for subscriptions made by SubscribeFiltered
+	Workers       []WorkerInfo `json:"workers"`
+}
+
+// WorkerInfo describes a delivery worker of a subscription, see WithDeliveryWorkers.
+type WorkerInfo struct {
+	ID        int    `json:"id"`
+	Pending   int    `json:"pending"`
+	Delivered uint64 `json:"delivered"`
+}
+
+// subscription is a listener with its own delivery queues.
+type subscription struct {
+	id           int
+	filter       string
+	matcher      *eventMatcher // Replaces filter for subscriptions made by SubscribeFiltered
+	listener     func(string)
+	onEvent      func(Event) // Replaces listener for subscriptions made by SubscribeEvents
+	workers      []*deliveryWorker
+	done         chan struct{}
+	dropped      atomic.Uint64
+	registeredAt time.Time
+}
+
+// deliveryWorker is a queue of a subscription and the goroutine calling its listener for each event.
+type deliveryWorker struct {
+	ch        chan notification
+	delivered atomic.Uint64
+}
+
 // NotificationManager manages the sending of store event notifications.
 type NotificationManager struct {
-	listeners []func(string)
-	ch        chan string
-	stopChan  chan struct{}
-	mu        sync.Mutex
-	wg        sync.WaitGroup
+	subscriptions []*subscription
+	defaultBuffer int
+	workers       int // Delivery workers per subscription, see WithDeliveryWorkers
+	nextID        int
+	ch            chan notification
+	stopChan      chan struct{}
+	events        *eventLog // Records key events for EventsSince; nil for a standalone manager
+	inline        bool      // Call listeners from Notify instead of delivery goroutines, see WithNoBackground
+	suspensions   []*suspension
+	suspended     atomic.Int32               // Length of suspensions, checked without the lock
+	bulk          atomic.Pointer[suspension] // Suspension of the bulk operation holding the write lock, if any
+	mu            sync.Mutex
+	wg            sync.WaitGroup
 }
 
 // NewNotificationManager creates a new NotificationManager.
 func NewNotificationManager() *NotificationManager {
-	nm := &NotificationManager{
-		listeners: []func(string){},
-		ch:        make(chan string, 10), // Buffer size for notifications
-		stopChan:  make(chan struct{}),
-	}
-
-	go nm.listen()
+	nm := newNotificationManager(10, defaultSubscriptionBuffer)
+	go nm.listen(func() bool { return true }, nil)
 	return nm
 }
 
+// newNotificationManager creates a NotificationManager buffering queue events, whose listen loop the caller starts.
+func newNotificationManager(queue, defaultBuffer int) *NotificationManager {
+	return &NotificationManager{
+		subscriptions: []*subscription{},
+		defaultBuffer: defaultBuffer,
+		workers:       1,
+		ch:            make(chan notification, queue),
+		stopChan:      make(chan struct{}),
+	}
+}
+
 // RegisterListener registers a new listener for notifications.
-func (nm *NotificationManager) RegisterListener(listener func(string)) {
+func (nm *NotificationManager) RegisterListener(listener func(string)) int {
+	return nm.Subscribe("", nm.defaultBuffer, listener)
+}
+
+// Subscribe registers a listener receiving the events matching filter, a path.Match pattern
+// such as "updated:*" (empty matches everything). Each subscription has its own queue of the
+// given size per delivery worker; events arriving while the queue is full are dropped and counted.
+func (nm *NotificationManager) Subscribe(filter string, buffer int, listener func(string)) int {
+	return nm.subscribe(&subscription{filter: filter, listener: listener}, buffer)
+}
+
+// SubscribeKey registers a listener receiving only the events of key. It is SubscribeFiltered with key as
+// the filter's only key.
+func (nm *NotificationManager) SubscribeKey(key string, buffer int, listener func(string)) int {
+	return nm.SubscribeFiltered(EventFilter{Keys: []string{key}}, buffer, listener)
+}
+
+// SubscribePrefix registers a listener receiving only the events of keys starting with prefix. It is
+// SubscribeFiltered with prefix as the filter's only included prefix.
+func (nm *NotificationManager) SubscribePrefix(prefix string, buffer int, listener func(string)) int {
+	return nm.SubscribeFiltered(EventFilter{Include: []string{prefix}}, buffer, listener)
+}
+
+// SubscribeFiltered registers a listener receiving the events passing filter, which is evaluated
+// before events are queued. Otherwise it behaves like Subscribe.
+func (nm *NotificationManager) SubscribeFiltered(filter EventFilter, buffer int, listener func(string)) int {
+	return nm.subscribe(&subscription{matcher: newEventMatcher(filter), listener: listener}, buffer)
+}
+
+// SubscribeEvents registers a listener receiving the events passing filter as Event values, with the old
+// and new values of key events. Otherwise it behaves like SubscribeFiltered.
+func (nm *NotificationManager) SubscribeEvents(filter EventFilter, buffer int, listener func(Event)) int {
+	return nm.subscribe(&subscription{matcher: newEventMatcher(filter), onEvent: listener}, buffer)
+}
+
+// subscribe registers sub with a queue of the given size.
+func (nm *NotificationManager) subscribe(sub *subscription, buffer int) int {
+	if buffer <= 0 {
+		buffer = nm.defaultBuffer
+	}
+
 	nm.mu.Lock()
 	defer nm.mu.Unlock()
-	nm.listeners = append(nm.listeners, listener)
+
+	nm.nextID++
+	sub.id = nm.nextID
+	sub.done = make(chan struct{})
+	sub.registeredAt = time.Now()
+	nm.subscriptions = append(nm.subscriptions, sub)
+	if nm.inline {
+		return sub.id
+	}
+
+	sub.workers = make([]*deliveryWorker, max(nm.workers, 1))
+	for i := range sub.workers {
+		worker := &deliveryWorker{ch: make(chan notification, buffer)}
+		sub.workers[i] = worker
+		nm.wg.Add(1)
+		go nm.deliver(sub, worker)
+	}
+	return sub.id
 }
 
 // UnregisterListener unregisters a listener for notifications.
 func (nm *NotificationManager) UnregisterListener(listener func(string)) {
 	nm.mu.Lock()
 	defer nm.mu.Unlock()
-	for i, l := range nm.listeners {
-		if &l == &listener {
-			nm.listeners = append(nm.listeners[:i], nm.listeners[i+1:]...)
+	for i, sub := range nm.subscriptions {
+		if &sub.listener == &listener {
+			close(sub.done)
+			nm.subscriptions = append(nm.subscriptions[:i], nm.subscriptions[i+1:]...)
 			break
 		}
 	}
 }
 
+// Unsubscribe removes the subscription with the given ID.
+func (nm *NotificationManager) Unsubscribe(id int) bool {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	for i, sub := range nm.subscriptions {
+		if sub.id == id {
+			close(sub.done)
+			nm.subscriptions = append(nm.subscriptions[:i], nm.subscriptions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// DeregisterAllSubscriptions removes every subscription.
+func (nm *NotificationManager) DeregisterAllSubscriptions() {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	for _, sub := range nm.subscriptions {
+		close(sub.done)
+	}
+	nm.subscriptions = []*subscription{}
+}
+
+// Subscriptions returns the registered subscriptions with their delivery statistics.
+func (nm *NotificationManager) Subscriptions() []SubscriptionInfo {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	infos := make([]SubscriptionInfo, 0, len(nm.subscriptions))
+	for _, sub := range nm.subscriptions {
+		info := SubscriptionInfo{
+			ID:           sub.id,
+			Filter:       sub.filter,
+			Dropped:      sub.dropped.Load(),
+			RegisteredAt: sub.registeredAt,
+			Workers:      make([]WorkerInfo, len(sub.workers)),
+		}
+		for i, worker := range sub.workers {
+			info.ChannelBuffer = cap(worker.ch)
+			info.Pending += len(worker.ch)
+			info.Workers[i] = WorkerInfo{ID: i, Pending: len(worker.ch), Delivered: worker.delivered.Load()}
+		}
+		if sub.matcher != nil {
+			filter := sub.matcher.filter
+			info.EventFilter = &filter
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
 // Notify informs all registered listeners of an event.
 func (nm *NotificationManager) Notify(event string) {
-	log.Printf("Notifying listeners: %s", event)
-	nm.ch <- event
+	n := notification{text: event}
+	n.event.Type, n.event.Key, _ = strings.Cut(event, ":")
+	nm.send(n)
+}
+
+// send informs all registered listeners of n.
+func (nm *NotificationManager) send(n notification) {
+	log.Printf("Notifying listeners: %s", n.text)
+	if nm.inline {
+		nm.deliverInline(n)
+		return
+	}
+	nm.ch <- n
+}
+
+// deliverInline calls the listeners of the subscriptions matching n.
+func (nm *NotificationManager) deliverInline(n notification) {
+	nm.mu.Lock()
+	var matched []*subscription
+	for _, sub := range nm.subscriptions {
+		if sub.matches(&n) {
+			matched = append(matched, sub)
+		}
+	}
+	nm.mu.Unlock()
+	for _, sub := range matched {
+		sub.call(&n)
+	}
 }
 
 // NotifyAdd informs all registered listeners that a key has been added.
-func (nm *NotificationManager) NotifyAdd(key string) {
-	nm.Notify(fmt.Sprintf("added:%s", key))
+func (nm *NotificationManager) NotifyAdd(key string, seq uint64) {
+	nm.notifyKey("added", key, seq)
 }
 
 // NotifyUpdate informs all registered headphones when a key is updated.
-func (nm *NotificationManager) NotifyUpdate(key string) {
-	nm.Notify(fmt.Sprintf("updated:%s", key))
+func (nm *NotificationManager) NotifyUpdate(key string, seq uint64) {
+	nm.notifyKey("updated", key, seq)
 }
 
 // NotifyDelete informs all registered listeners that a key has been deleted.
-func (nm *NotificationManager) NotifyDelete(key string) {
-	nm.Notify(fmt.Sprintf("deleted:%s", key))
+func (nm *NotificationManager) NotifyDelete(key string, seq uint64) {
+	nm.notifyKey("deleted", key, seq)
+}
+
+// NotifyExpire informs all registered listeners that a key has expired.
+func (nm *NotificationManager) NotifyExpire(key string, seq uint64) {
+	nm.notifyKey("expired", key, seq)
+}
+
+// notifyKey records a key event in the event log and informs all registered listeners of it.
+func (nm *NotificationManager) notifyKey(eventType, key string, seq uint64) {
+	nm.notifyKeyValue(eventType, key, "", "", false, seq)
+}
+
+// notifyChange is like notifyKey, passing the key's latest value before the event and its value after
+// it on to the subscriptions receiving values. Added keys have no old value, and deleted and expired
+// keys no new one.
+func (nm *NotificationManager) notifyChange(eventType, key, oldValue, newValue string, seq uint64) {
+	nm.notifyKeyValue(eventType, key, oldValue, newValue, true, seq)
+}
+
+// notifyKeyValue implements notifyKey and notifyChange.
+func (nm *NotificationManager) notifyKeyValue(eventType, key, oldValue, newValue string, hasValue bool, seq uint64) {
+	event := Event{Seq: seq, Type: eventType, Key: key, Time: time.Now()}
+	if nm.events != nil {
+		nm.events.record(event)
+	}
+	if nm.suppress(eventType) {
+		return
+	}
+	text := event.String()
+	event.OldValue, event.NewValue = oldValue, newValue
+	nm.send(notification{text: text, event: event, hasValue: hasValue})
 }
 
-// listen listens to events and informs listeners.
-func (nm *NotificationManager) listen() {
+// listen listens to events and queues them on the matching subscriptions, calling beat at least
+// every listenHeartbeat and before each event. fault, if set, runs before each event.
+func (nm *NotificationManager) listen(beat func() bool, fault func()) {
+	ticker := time.NewTicker(listenHeartbeat)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case event := <-nm.ch:
+		case <-ticker.C:
+			if !beat() {
+				return
+			}
+		case n := <-nm.ch:
+			if !beat() {
+				// A replacement loop has taken over; hand the event on to it.
+				nm.ch <- n
+				return
+			}
+			if fault != nil {
+				fault()
+			}
 			nm.mu.Lock()
-			for _, listener := range nm.listeners {
-				// Remove goroutines to guarantee notification order
-				listener(event)
+			for _, sub := range nm.subscriptions {
+				if !sub.matches(&n) {
+					continue
+				}
+				select {
+				case sub.worker(n.event.Key).ch <- n:
+				default:
+					sub.dropped.Add(1)
+				}
 			}
 			nm.mu.Unlock()
 		case <-nm.stopChan:
@@ -84,6 +330,64 @@ func (nm *NotificationManager) listen() {
 	}
 }
 
+// deliver calls the subscription's listener for each event queued on worker, in order.
+func (nm *NotificationManager) deliver(sub *subscription, worker *deliveryWorker) {
+	defer nm.wg.Done()
+	for {
+		select {
+		case n := <-worker.ch:
+			sub.call(&n)
+			worker.delivered.Add(1)
+		case <-sub.done:
+			return
+		case <-nm.stopChan:
+			return
+		}
+	}
+}
+
+// matches reports whether the notification passes the subscription's filter.
+func (sub *subscription) matches(n *notification) bool {
+	if sub.matcher != nil {
+		return sub.matcher.matches(n)
+	}
+	if sub.filter == "" {
+		return true
+	}
+	matched, err := path.Match(sub.filter, n.text)
+	return err == nil && matched
+}
+
+// worker returns the delivery worker of the events of key, hashing it with FNV-1a.
+func (sub *subscription) worker(key string) *deliveryWorker {
+	if len(sub.workers) == 1 {
+		return sub.workers[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return sub.workers[h%uint32(len(sub.workers))]
+}
+
+// call passes n to the subscription's listener.
+func (sub *subscription) call(n *notification) {
+	if sub.onEvent != nil {
+		sub.onEvent(n.event)
+		return
+	}
+	sub.listener(sub.format(n))
+}
+
+// format returns the event a string listener receives for n.
+func (sub *subscription) format(n *notification) string {
+	if sub.matcher != nil && sub.matcher.filter.IncludeValues && n.hasValue {
+		return n.text + "=" + n.value()
+	}
+	return n.text
+}
+
 // Stop stops the notification manager.
 func (nm *NotificationManager) Stop() {
 	close(nm.stopChan)
@@ -0,0 +1,311 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// OffloadStats describes the version histories currently offloaded to the sidecar.
+type OffloadStats struct {
+	Keys           int   // Keys with offloaded versions
+	Versions       int   // Versions held in the sidecar
+	BytesReclaimed int64 // Value bytes no longer held in memory
+}
+
+// historyOffload moves old versions of idle keys to a sidecar backend.
+type historyOffload struct {
+	keepRecent int
+	idleAfter  time.Duration
+	sidecar    StorageBackend
+
+	// offloaded maps keys to the number of their oldest versions held in the sidecar, and bytes to their value size.
+	offloaded map[string]int
+	bytes     map[string]int64
+
+	accessMu   sync.Mutex
+	lastAccess map[string]time.Time
+}
+
+// newHistoryOffload creates a history offloader keeping at least one version in memory.
+func newHistoryOffload(keepRecent int, idleAfter time.Duration, sidecar StorageBackend) *historyOffload {
+	if keepRecent < 1 {
+		keepRecent = 1
+	}
+	return &historyOffload{
+		keepRecent: keepRecent,
+		idleAfter:  idleAfter,
+		sidecar:    sidecar,
+		offloaded:  make(map[string]int),
+		bytes:      make(map[string]int64),
+		lastAccess: make(map[string]time.Time),
+	}
+}
+
+// touch marks key as recently accessed.
+func (h *historyOffload) touch(key string) {
+	h.accessMu.Lock()
+	h.lastAccess[key] = time.Now()
+	h.accessMu.Unlock()
+}
+
+// idleSince returns when key was last accessed, or false if it never was since start-up.
+func (h *historyOffload) idleSince(key string) (time.Time, bool) {
+	h.accessMu.Lock()
+	defer h.accessMu.Unlock()
+	t, ok := h.lastAccess[key]
+	return t, ok
+}
+
+// forget drops the bookkeeping of key after it has been deleted or replaced.
+func (h *historyOffload) forget(key string) {
+	delete(h.offloaded, key)
+	delete(h.bytes, key)
+	h.accessMu.Lock()
+	delete(h.lastAccess, key)
+	h.accessMu.Unlock()
+}
+
+// touchHistory records an access for the offloader, if enabled.
+func (kv *KeyValueStore) touchHistory(key string) {
+	if kv.offload != nil {
+		kv.offload.touch(key)
+	}
+}
+
+// readSidecar decodes the sidecar contents, treating a missing sidecar as empty.
+func (kv *KeyValueStore) readSidecar() (map[string][]KeyValue, error) {
+	data, err := kv.offload.sidecar.Load()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return make(map[string][]KeyValue), nil
+		}
+		return nil, err
+	}
+	return kv.decode(data)
+}
+
+// writeSidecar persists the histories of the keys that are still offloaded.
+// The caller must hold the write lock.
+func (kv *KeyValueStore) writeSidecar(sidecar map[string][]KeyValue) error {
+	for key := range sidecar {
+		if kv.offload.offloaded[key] == 0 {
+			delete(sidecar, key)
+		}
+	}
+	data, err := kv.encodeData(sidecar)
+	if err != nil {
+		return err
+	}
+	if err := kv.offload.sidecar.Save(data); err != nil {
+		return err
+	}
+	kv.ioStats.write(IOOffload, len(data))
+	return nil
+}
+
+// OffloadColdHistories moves all but the most recent versions of idle keys to the sidecar.
+// It returns the number of keys offloaded.
+func (kv *KeyValueStore) OffloadColdHistories() (int, error) {
+	if kv.offload == nil {
+		return 0, errors.New("history offload not enabled")
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, err
+	}
+
+	kv.Lock()
+	defer kv.Unlock()
+
+	h := kv.offload
+	now := time.Now()
+	cold := make(map[string][]KeyValue)
+	for key, versions := range kv.data {
+		if len(versions) <= h.keepRecent {
+			continue
+		}
+		lastAccess, ok := h.idleSince(key)
+		if !ok {
+			lastAccess = versions[len(versions)-1].Timestamp
+		}
+		if now.Sub(lastAccess) < h.idleAfter {
+			continue
+		}
+		cold[key] = versions[:len(versions)-h.keepRecent]
+	}
+	if len(cold) == 0 {
+		return 0, nil
+	}
+
+	sidecar, err := kv.readSidecar()
+	if err != nil {
+		return 0, fmt.Errorf("error reading history sidecar: %v", err)
+	}
+	previous := make(map[string]int, len(cold))
+	for key, versions := range cold {
+		previous[key] = h.offloaded[key]
+		if h.offloaded[key] == 0 {
+			sidecar[key] = nil
+		}
+		sidecar[key] = append(sidecar[key], versions...)
+		h.offloaded[key] += len(versions)
+	}
+	if err := kv.writeSidecar(sidecar); err != nil {
+		for key, n := range previous {
+			h.offloaded[key] = n
+		}
+		return 0, fmt.Errorf("error writing history sidecar: %v", err)
+	}
+
+	for key, versions := range cold {
+		for _, version := range versions {
+			h.bytes[key] += int64(len(version.Value))
+		}
+		// Copy the recent versions so the offloaded ones can be garbage collected.
+		kv.data[key] = append([]KeyValue(nil), kv.data[key][len(versions):]...)
+		kv.dedupKeyLocked(key)
+	}
+
+	log.Printf("OffloadColdHistories: Offloaded history of %d keys\n", len(cold))
+	return len(cold), nil
+}
+
+// faultInHistory restores the offloaded versions of key, if any, and marks the key hot again.
+// It reports whether versions had been offloaded.
+func (kv *KeyValueStore) faultInHistory(key string) (bool, error) {
+	if kv.offload == nil {
+		return false, nil
+	}
+	kv.offload.touch(key)
+
+	kv.RLock()
+	offloaded := kv.offload.offloaded[key]
+	kv.RUnlock()
+	if offloaded == 0 {
+		return false, nil
+	}
+
+	kv.Lock()
+	defer kv.Unlock()
+	return true, kv.faultInHistoryLocked(key)
+}
+
+// faultInHistoryLocked restores the offloaded versions of key. The caller must hold the write lock.
+func (kv *KeyValueStore) faultInHistoryLocked(key string) error {
+	h := kv.offload
+	if h == nil || h.offloaded[key] == 0 {
+		return nil
+	}
+
+	sidecar, err := kv.readSidecar()
+	if err != nil {
+		return fmt.Errorf("error reading history sidecar: %v", err)
+	}
+	versions := sidecar[key]
+	if len(versions) != h.offloaded[key] {
+		return fmt.Errorf("history sidecar holds %d versions of key '%s', expected %d", len(versions), key, h.offloaded[key])
+	}
+
+	kv.data[key] = append(versions, kv.data[key]...)
+	kv.dedupKeyLocked(key)
+	h.offloaded[key] = 0
+	delete(h.bytes, key)
+	if err := kv.writeSidecar(sidecar); err != nil {
+		log.Printf("faultInHistory: Failed to prune sidecar: %v\n", err)
+	}
+
+	log.Printf("faultInHistory: Restored %d versions of key '%s'\n", len(versions), key)
+	return nil
+}
+
+// forgetHistory drops the offloaded versions of key and prunes them from the sidecar.
+// The caller must hold the write lock.
+func (kv *KeyValueStore) forgetHistory(key string) {
+	if kv.offload == nil {
+		return
+	}
+	offloaded := kv.offload.offloaded[key]
+	kv.offload.forget(key)
+	if offloaded == 0 {
+		return
+	}
+	sidecar, err := kv.readSidecar()
+	if err == nil {
+		err = kv.writeSidecar(sidecar)
+	}
+	if err != nil {
+		log.Printf("forgetHistory: Failed to prune sidecar: %v\n", err)
+	}
+}
+
+// offloadedCount returns the number of offloaded versions of key. The caller must hold the lock.
+func (kv *KeyValueStore) offloadedCount(key string) int {
+	if kv.offload == nil {
+		return 0
+	}
+	return kv.offload.offloaded[key]
+}
+
+// loadOffloadIndex rebuilds the offloaded version counts from the sidecar. The caller must hold the write lock.
+func (kv *KeyValueStore) loadOffloadIndex() error {
+	if kv.offload == nil {
+		return nil
+	}
+	sidecar, err := kv.readSidecar()
+	if err != nil {
+		return fmt.Errorf("error reading history sidecar: %v", err)
+	}
+	for key, versions := range sidecar {
+		if _, exists := kv.data[key]; !exists || len(versions) == 0 {
+			continue
+		}
+		kv.offload.offloaded[key] = len(versions)
+		for _, version := range versions {
+			kv.offload.bytes[key] += int64(len(version.Value))
+		}
+	}
+	return nil
+}
+
+// withOffloadedHistories returns the in-memory histories merged with the offloaded versions.
+// The caller must hold the lock.
+func (kv *KeyValueStore) withOffloadedHistories() (map[string][]KeyValue, error) {
+	if kv.offload == nil || len(kv.offload.offloaded) == 0 {
+		return kv.data, nil
+	}
+	sidecar, err := kv.readSidecar()
+	if err != nil {
+		return nil, fmt.Errorf("error reading history sidecar: %v", err)
+	}
+	merged := make(map[string][]KeyValue, len(kv.data))
+	for key, versions := range kv.data {
+		if n := kv.offload.offloaded[key]; n > 0 && len(sidecar[key]) == n {
+			merged[key] = append(append([]KeyValue(nil), sidecar[key]...), versions...)
+			continue
+		}
+		merged[key] = versions
+	}
+	return merged, nil
+}
+
+// OffloadStats returns the number of keys and bytes currently offloaded.
+func (kv *KeyValueStore) OffloadStats() OffloadStats {
+	var stats OffloadStats
+	if kv.offload == nil {
+		return stats
+	}
+	kv.RLock()
+	defer kv.RUnlock()
+	for key, n := range kv.offload.offloaded {
+		if n == 0 {
+			continue
+		}
+		stats.Keys++
+		stats.Versions += n
+		stats.BytesReclaimed += kv.offload.bytes[key]
+	}
+	return stats
+}
@@ -0,0 +1,435 @@
+package store
+
+import "time"
+
+// Option configures optional behaviour of a KeyValueStore.
+type Option func(*KeyValueStore)
+
+// WithBackend sets the storage backend used to persist the store.
+func WithBackend(backend StorageBackend) Option {
+	return func(kv *KeyValueStore) {
+		kv.backend = backend
+	}
+}
+
+// WithGlobalTTL sets the TTL applied to keys set without an explicit TTL.
+func WithGlobalTTL(ttl time.Duration) Option {
+	return func(kv *KeyValueStore) {
+		kv.globalTTL = ttl
+	}
+}
+
+// WithCleanupInterval sets how often expired keys are removed.
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(kv *KeyValueStore) {
+		kv.tickerInterval = interval
+		kv.markTuned(tunedCleanupInterval)
+	}
+}
+
+// WithVersionHistoryAudit starts a background scan every interval that calls handler
+// for each key holding more than maxVersions versions. An interval <= 0 means one minute.
+func WithVersionHistoryAudit(maxVersions int, interval time.Duration, handler func(key string, count int)) Option {
+	return func(kv *KeyValueStore) {
+		kv.historyAudit = newHistoryAudit(maxVersions, interval, handler)
+	}
+}
+
+// WithHotKeyDetection samples one Get/Set out of sampleEvery and tracks the most accessed keys
+// over a sliding window. A "hotkey:<key>" notification fires once per window when a single key
+// exceeds shareThreshold (between 0 and 1) of the sampled traffic. A window <= 0 means one minute.
+func WithHotKeyDetection(sampleEvery uint64, window time.Duration, shareThreshold float64) Option {
+	return func(kv *KeyValueStore) {
+		kv.hotKeys = newHotKeyDetector(sampleEvery, window, shareThreshold)
+	}
+}
+
+// WithStrictLoad makes loading fail on malformed data instead of repairing it.
+func WithStrictLoad() Option {
+	return func(kv *KeyValueStore) {
+		kv.strictLoad = true
+	}
+}
+
+// WithLoadDeduplication removes identical consecutive versions while loading.
+func WithLoadDeduplication() Option {
+	return func(kv *KeyValueStore) {
+		kv.dedupeOnLoad = true
+	}
+}
+
+// WithFaultInjector attaches a fault injector to Get, Set and save. The injector does nothing until enabled.
+func WithFaultInjector(fi *FaultInjector) Option {
+	return func(kv *KeyValueStore) {
+		kv.faults = fi
+	}
+}
+
+// WithHistoryOffload moves all but the keepRecent most recent versions of keys idle for longer than
+// idleAfter to the sidecar backend. Offloaded versions are faulted back in when the history is read.
+func WithHistoryOffload(keepRecent int, idleAfter time.Duration, sidecar StorageBackend) Option {
+	return func(kv *KeyValueStore) {
+		kv.offload = newHistoryOffload(keepRecent, idleAfter, sidecar)
+	}
+}
+
+// WithCopyOnWriteIndex maintains a copy-on-write key list so Keys never waits for writers.
+// Creating and deleting keys copies the list, trading write allocations for lock-free reads.
+func WithCopyOnWriteIndex() Option {
+	return func(kv *KeyValueStore) {
+		kv.keyIndex = newKeyIndex()
+	}
+}
+
+// WithPrefixIndex keeps the keys sorted so Scan finds the keys starting with a prefix by binary search
+// instead of checking every key. Creating and deleting keys moves part of the sorted list.
+func WithPrefixIndex() Option {
+	return func(kv *KeyValueStore) {
+		kv.prefixIndex = &prefixIndex{}
+	}
+}
+
+// WithContentionProfiling times lock waits and holds for ContentionReport. Holds longer than
+// slowHold are logged with a stack snippet; a slowHold of zero disables the warning.
+func WithContentionProfiling(slowHold time.Duration) Option {
+	return func(kv *KeyValueStore) {
+		kv.contention = newLockProfiler(slowHold)
+	}
+}
+
+// WithEncryptionKey sets the key used to encrypt persisted data.
+func WithEncryptionKey(key []byte) Option {
+	return func(kv *KeyValueStore) {
+		kv.encryptionKey = key
+	}
+}
+
+// WithShard routes keys starting with prefix to a separate store persisted at filePath.
+// It only applies to NewShardedKeyValueStore and is ignored by a plain KeyValueStore.
+func WithShard(prefix, filePath string) Option {
+	return func(kv *KeyValueStore) {
+		if kv.shardRoutes == nil {
+			kv.shardRoutes = make(map[string]string)
+		}
+		kv.shardRoutes[prefix] = filePath
+	}
+}
+
+// WithEncryptionContext binds encrypted data to context, such as a cluster name and file path, so it
+// cannot be decrypted by a store configured with a different context. The context is never persisted.
+func WithEncryptionContext(context string) Option {
+	return func(kv *KeyValueStore) {
+		kv.encryptionContext = []byte(context)
+	}
+}
+
+// WithMemoryWatchdog samples memory usage every interval using read, or the cgroup or heap usage if
+// read is nil. Crossing the high-water mark triggers an immediate save and a "memory_pressure"
+// notification, and optionally rejects writes until usage falls below the low-water mark. An interval <= 0
+// means one second.
+func WithMemoryWatchdog(interval time.Duration, thresholds MemoryThresholds, read MemoryReader) Option {
+	return func(kv *KeyValueStore) {
+		kv.memoryWatchdog = newMemoryWatchdog(interval, thresholds, read)
+	}
+}
+
+// WithStaleReads keeps a snapshot of the latest values that GetStale and KeysStale read without locking.
+// The snapshot is refreshed once it is maxStaleness old (one second if zero), or sooner once dirtyThreshold
+// mutations have been made since it was taken; a dirtyThreshold of zero refreshes on age only.
+func WithStaleReads(maxStaleness time.Duration, dirtyThreshold int) Option {
+	return func(kv *KeyValueStore) {
+		if maxStaleness <= 0 {
+			maxStaleness = time.Second
+		}
+		if dirtyThreshold < 0 {
+			dirtyThreshold = 0
+		}
+		kv.staleReads = &staleReads{maxAge: maxStaleness, threshold: uint64(dirtyThreshold), rebuild: true}
+	}
+}
+
+// WithWriteCoalescing collapses writes without an explicit TTL to keys starting with prefix: the first
+// write opens a window, later writes within it replace the pending value, and a single version is
+// committed when it closes. Readers see the pending value. The longest matching prefix applies.
+func WithWriteCoalescing(prefix string, window time.Duration) Option {
+	return func(kv *KeyValueStore) {
+		kv.coalesceRules = append(kv.coalesceRules, coalesceRule{prefix: prefix, window: window})
+	}
+}
+
+// WithRecordPersister writes every mutation through to p instead of saving whole-store snapshots to the
+// backend. Values are encrypted individually when the store has an encryption key.
+func WithRecordPersister(p RecordPersister) Option {
+	return func(kv *KeyValueStore) {
+		kv.records = p
+	}
+}
+
+// WithKeyListingLimits bounds key listings: each expires after ttl without page fetches, at most
+// maxListings are held (evicting the oldest) and a listing may hold at most maxKeys keys. Limits <= 0
+// keep their defaults.
+func WithKeyListingLimits(ttl time.Duration, maxListings, maxKeys int) Option {
+	return func(kv *KeyValueStore) {
+		kv.listings = newKeyListings(ttl, maxListings, maxKeys)
+	}
+}
+
+// WithKeyHashing persists keys as their HMAC-SHA256 under secret, alongside their names encrypted with the
+// store key, so the persisted data reveals no key names without both. Plaintext keys are kept in memory only.
+// It requires an encryption key.
+func WithKeyHashing(secret []byte) Option {
+	return func(kv *KeyValueStore) {
+		kv.keySecret = secret
+	}
+}
+
+// WithSupervisorPolicy sets how background loops are checked and restarted. Fields left zero keep
+// their value from DefaultSupervisorPolicy.
+func WithSupervisorPolicy(policy SupervisorPolicy) Option {
+	return func(kv *KeyValueStore) {
+		if policy.CheckInterval <= 0 {
+			policy.CheckInterval = DefaultSupervisorPolicy.CheckInterval
+		}
+		if policy.StallAfter <= 0 {
+			policy.StallAfter = DefaultSupervisorPolicy.StallAfter
+		}
+		if policy.Backoff <= 0 {
+			policy.Backoff = DefaultSupervisorPolicy.Backoff
+		}
+		if policy.MaxRestarts <= 0 {
+			policy.MaxRestarts = DefaultSupervisorPolicy.MaxRestarts
+		}
+		kv.supervision = policy
+	}
+}
+
+// WithPrecisionExpiry expires keys starting with any of prefixes at their exact deadline using a timer per key,
+// instead of on the next cleanup tick. At most maxTimers keys hold a timer (10000 if zero); further keys are
+// left to the sweep. Each timer costs a few hundred bytes and a short-lived goroutine when it fires.
+func WithPrecisionExpiry(maxTimers int, prefixes ...string) Option {
+	return func(kv *KeyValueStore) {
+		kv.precision = newPrecisionExpiry(maxTimers, prefixes)
+	}
+}
+
+// WithTuningProfile selects a named bundle of internal settings: ProfileLowMemory, ProfileBalanced or
+// ProfileThroughput. Individual options, in any order, and a positive cleanup interval passed to
+// NewKeyValueStore override the profile.
+func WithTuningProfile(profile string) Option {
+	return func(kv *KeyValueStore) {
+		kv.tuningProfile = profile
+	}
+}
+
+// WithCleanupBatch limits how many expired keys a sweep removes per write lock hold; 0 removes all at once.
+func WithCleanupBatch(batch int) Option {
+	return func(kv *KeyValueStore) {
+		kv.tuning.CleanupBatch = batch
+		kv.markTuned(tunedCleanupBatch)
+	}
+}
+
+// WithCompressionLevel sets the zlib level of persisted snapshots, from zlib.HuffmanOnly to zlib.BestCompression.
+func WithCompressionLevel(level int) Option {
+	return func(kv *KeyValueStore) {
+		kv.tuning.CompressionLevel = level
+		kv.markTuned(tunedCompressionLevel)
+	}
+}
+
+// WithNotificationQueue sets how many events are buffered before the notification loop dispatches them.
+func WithNotificationQueue(size int) Option {
+	return func(kv *KeyValueStore) {
+		kv.tuning.NotificationQueue = size
+		kv.markTuned(tunedNotificationQueue)
+	}
+}
+
+// WithSubscriptionBuffer sets the queue size of subscriptions registered without an explicit buffer.
+func WithSubscriptionBuffer(size int) Option {
+	return func(kv *KeyValueStore) {
+		kv.tuning.SubscriptionBuffer = size
+		kv.markTuned(tunedSubscriptionBuffer)
+	}
+}
+
+// WithDeliveryWorkers gives each subscription n delivery workers calling its listener concurrently. The
+// events of a key, or for notifications that are not key events the text after their type, always go to
+// the same worker, so a listener receives the events of each key in the order they were committed, while
+// events of different keys may be delivered out of order and in parallel. The listener must then be safe
+// for concurrent use. A subscription's buffer applies to each of its workers. The default is a single
+// worker, delivering every event in order.
+func WithDeliveryWorkers(n int) Option {
+	return func(kv *KeyValueStore) {
+		kv.deliveryWorkers = n
+	}
+}
+
+// WithAuthorizer makes the context-aware methods consult authorize before running. Without an authorizer
+// every operation is allowed.
+func WithAuthorizer(authorize Authorizer) Option {
+	return func(kv *KeyValueStore) {
+		kv.authorizer = authorize
+	}
+}
+
+// WithCommitDelay sets how long SetDurable waits before saving so concurrent durable writes can share the
+// save. Longer delays mean fewer saves under load but slower acknowledgements; the default is 1ms.
+func WithCommitDelay(delay time.Duration) Option {
+	return func(kv *KeyValueStore) {
+		kv.commitDelay = delay
+	}
+}
+
+// WithEventLog sets how many recent events EventsSince can replay; older ones are evicted.
+func WithEventLog(size int) Option {
+	return func(kv *KeyValueStore) {
+		kv.events = newEventLog(size)
+	}
+}
+
+// WithSlowOpLog records Get, Set, Delete, CompareAndSwap and version reads taking at least config.Threshold,
+// readable through SlowOps. The threshold can be changed at runtime with SetSlowOpThreshold.
+func WithSlowOpLog(config SlowOpLogConfig) Option {
+	return func(kv *KeyValueStore) {
+		kv.slowOps = newSlowOpLog(config)
+	}
+}
+
+// WithDeltaVersions stores all but the latest version of keys starting with prefix as line-based deltas against
+// the next version, keeping every keyframeEvery-th version in full (16 if zero) to bound reconstruction.
+// It suits large values changing a few lines at a time. The longest matching prefix applies.
+func WithDeltaVersions(prefix string, keyframeEvery int) Option {
+	return func(kv *KeyValueStore) {
+		if keyframeEvery <= 0 {
+			keyframeEvery = defaultKeyframeEvery
+		}
+		kv.deltaRules = append(kv.deltaRules, deltaRule{prefix: prefix, keyframeEvery: keyframeEvery})
+	}
+}
+
+// WithVersionRetention bounds the version history of every key: each write drops the versions beyond
+// policy.MaxVersions or older than policy.MaxAge, and the cleanup loop drops versions that age out of
+// keys no longer written. WithKeyRetention overrides it for some keys.
+func WithVersionRetention(policy VersionRetention) Option {
+	return WithKeyRetention("", policy)
+}
+
+// WithKeyRetention is WithVersionRetention for the keys starting with prefix; the longest matching prefix
+// applies, so a rule for a key's full name overrides broader ones. A zero policy keeps every version.
+func WithKeyRetention(prefix string, policy VersionRetention) Option {
+	return func(kv *KeyValueStore) {
+		kv.retentionRules = append(kv.retentionRules, retentionRule{prefix: prefix, policy: policy})
+	}
+}
+
+// WithValueDeduplication stores values of at least threshold bytes (256 if zero) once, shared by every
+// version holding them, and snapshots them once with the versions referencing them by SHA-256. It suits
+// many keys holding the same large values. Record persisters still store every version in full.
+func WithValueDeduplication(threshold int) Option {
+	return func(kv *KeyValueStore) {
+		if threshold <= 0 {
+			threshold = defaultDedupThreshold
+		}
+		kv.valuePool = newValuePool(threshold)
+	}
+}
+
+// WithWriteAmplificationCeiling logs a warning and sends a "write_amplification:<factor>" notification for
+// every window (one minute if zero) in which the store wrote more than ceiling times the bytes clients wrote.
+func WithWriteAmplificationCeiling(ceiling float64, window time.Duration) Option {
+	return func(kv *KeyValueStore) {
+		if window <= 0 {
+			window = time.Minute
+		}
+		kv.ampCeiling = &amplificationCeiling{ceiling: ceiling, window: window}
+	}
+}
+
+// WithOwnerFile announces the process as the owner of the store's data file by writing its pid next to it,
+// in a file named after the data file with an ".owner" suffix, until Stop. Tools check DataFileOwner before
+// writing to the data file. It has no effect on stores not persisting to a file.
+func WithOwnerFile() Option {
+	return func(kv *KeyValueStore) {
+		kv.announceOwner = true
+	}
+}
+
+// WithAutoRenew extends the TTL of keys starting with prefix by the TTL they were set with whenever they are
+// read more than threshold times before it runs out, sending a "ttl_extended:<key>" notification. Keys never
+// live longer than maxLifetime after they were set. It can be given once per prefix; the longest matching
+// prefix applies. Only keys set since the store was created are tracked.
+func WithAutoRenew(prefix string, threshold int, maxLifetime time.Duration) Option {
+	return func(kv *KeyValueStore) {
+		if kv.autoRenew == nil {
+			kv.autoRenew = newAutoRenew()
+		}
+		kv.autoRenew.rules = append(kv.autoRenew.rules, autoRenewRule{prefix: prefix, threshold: threshold, maxLifetime: maxLifetime})
+	}
+}
+
+// WithAdaptiveAutosave saves the store in the background whenever something was written, at an interval
+// adapted to the recent autosave durations so saving takes at most config.MaxOverhead of the time, within
+// config.MinInterval and config.MaxInterval. The maximum wins over the overhead, bounding the writes a crash
+// loses. AutosaveStats reports the current interval.
+func WithAdaptiveAutosave(config AutosaveConfig) Option {
+	return func(kv *KeyValueStore) {
+		kv.autosave = newAdaptiveAutosave(config)
+	}
+}
+
+// WithAutoSave saves the store in the background every interval whenever something was written. It is
+// WithAdaptiveAutosave with a fixed interval.
+func WithAutoSave(interval time.Duration) Option {
+	return WithAdaptiveAutosave(AutosaveConfig{MaxOverhead: 1, MinInterval: interval, MaxInterval: interval})
+}
+
+// WithValueGrowthAlerts tracks the size of the latest value of each key and sends a value_growth notification,
+// "value_growth:<key>@<old size>:<new size>:<bytes per second>", when a value grows beyond config.Threshold
+// bytes or by more than config.Factor within config.Window. Each crossing alerts once: the threshold alert
+// re-arms when the value shrinks back below it, the factor alert when the window ends. Writes are only refused
+// if config.MaxValueBytes is set.
+func WithValueGrowthAlerts(config ValueGrowthConfig) Option {
+	return func(kv *KeyValueStore) {
+		kv.valueGrowth = newValueGrowth(config)
+	}
+}
+
+// WithNoBackground starts no goroutines, for embedding the store as a plain data structure in short-lived
+// tools and tests. Expired keys are refused on access as usual but only removed, with their "expired"
+// notification, by SweepExpired. Notifications are delivered synchronously by the goroutine causing them,
+// often while it holds the store lock, so listeners must not call back into the store and may be called
+// concurrently. WithVersionHistoryAudit, WithMemoryWatchdog, WithStaleReads, WithAutoRenew,
+// WithAdaptiveAutosave, WithAutoSave, WithDeliveryWorkers and WithWriteAmplificationCeiling have no effect,
+// and the timers of WithWriteCoalescing and WithPrecisionExpiry still fire on runtime goroutines. Stop only
+// saves.
+func WithNoBackground() Option {
+	return func(kv *KeyValueStore) {
+		kv.passive = true
+	}
+}
+
+// WithMigrations converts a data file in a legacy format on load by running each migration detecting its
+// source format, in order. The migrated data is verified on disk before it replaces the file, and the
+// original is preserved for RollbackMigration. Migrations only run on stores persisting to a file.
+func WithMigrations(migrations ...Migration) Option {
+	return func(kv *KeyValueStore) {
+		kv.migrations = append(kv.migrations, migrations...)
+	}
+}
+
+// RequireEncryption makes the store refuse to run without a valid encryption key: OpenKeyValueStore and
+// NewKeyValueStoreFromReader fail, loads and saves of a store created otherwise fail, and data written
+// unencrypted is rejected with ErrUnencryptedData instead of being read.
+func RequireEncryption() Option {
+	return func(kv *KeyValueStore) {
+		kv.mustEncrypt = true
+	}
+}
+
+// WithComputedTicker replaces the tickers scheduling computed keys, so tests can trigger recomputation.
+func WithComputedTicker(newTicker TickerFunc) Option {
+	return func(kv *KeyValueStore) {
+		kv.newTicker = newTicker
+	}
+}
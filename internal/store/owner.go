@@ -0,0 +1,100 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ownerFileSuffix is appended to a data file's path to name the file announcing the process that owns it.
+const ownerFileSuffix = ".owner"
+
+// ErrDataFileInUse is returned when another live process has announced that it owns a data file.
+var ErrDataFileInUse = errors.New("data file in use by another process")
+
+// DataFileOwner returns the process that announced it owns the data file at path with WithOwnerFile, if it
+// is still running. An owner file left behind by a process that has exited is removed.
+func DataFileOwner(path string) (int, bool, error) {
+	ownerFile := path + ownerFileSuffix
+	data, err := os.ReadFile(ownerFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("error reading owner file: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err == nil && processAlive(pid) {
+		return pid, true, nil
+	}
+
+	log.Printf("DataFileOwner: Removing stale owner file %s\n", ownerFile)
+	if err := os.Remove(ownerFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, false, fmt.Errorf("error removing stale owner file: %v", err)
+	}
+	return 0, false, nil
+}
+
+// processAlive reports whether the process pid is running. A process that exists but cannot be
+// signalled by this user counts as running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || !(errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH))
+}
+
+// announceOwnership writes the owner file of the store's data file, unless another live process owns it.
+// The file is created exclusively, so of two processes claiming the data file at once only one succeeds.
+func (kv *KeyValueStore) announceOwnership() error {
+	fb, ok := kv.backend.(*FileBackend)
+	if !ok || fb.Path == "" {
+		return nil
+	}
+	pid, owned, err := DataFileOwner(fb.Path)
+	if err != nil {
+		return err
+	}
+	if owned && pid != os.Getpid() {
+		return fmt.Errorf("%w: %s is owned by process %d", ErrDataFileInUse, fb.Path, pid)
+	}
+	ownerFile := fb.Path + ownerFileSuffix
+	if !owned {
+		f, err := os.OpenFile(ownerFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if os.IsExist(err) {
+			return fmt.Errorf("%w: %s was claimed by another process", ErrDataFileInUse, fb.Path)
+		}
+		if err != nil {
+			return fmt.Errorf("error creating owner file: %v", err)
+		}
+		_, err = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(ownerFile)
+			return fmt.Errorf("error writing owner file: %v", err)
+		}
+	}
+	kv.ownerFile = ownerFile
+	return nil
+}
+
+// releaseOwnership removes the owner file written by announceOwnership.
+func (kv *KeyValueStore) releaseOwnership() {
+	if kv.ownerFile == "" {
+		return
+	}
+	if err := os.Remove(kv.ownerFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Stop: Failed to remove owner file: %v\n", err)
+	}
+}
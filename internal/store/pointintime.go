@@ -0,0 +1,34 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// GetAt returns the value key held at t: the latest version written at or before t. It returns
+// ErrVersionNotFound if the oldest version kept was written after t, and ErrKeyNotFound if the key does not
+// exist now, since deleting a key drops its history, or ErrKeyExpired if it has expired, like Get. Versions
+// pruned by Compact or a retention policy are no longer found.
+func (kv *KeyValueStore) GetAt(key string, t time.Time) (string, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return "", fmt.Errorf("data not loaded: %w", err)
+	}
+	// An expired key is gone even though the cleanup has not removed its history yet.
+	kv.RLock()
+	exp, expires := kv.expirations[key]
+	kv.RUnlock()
+	if expires && time.Now().After(exp) {
+		return "", ErrKeyExpired
+	}
+	versions, err := kv.GetHistory(key)
+	if err != nil {
+		return "", err
+	}
+	// Versions are scanned from the latest so a clock stepping back finds the version written last.
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].Timestamp.After(t) {
+			return versions[i].Value, nil
+		}
+	}
+	return "", fmt.Errorf("key '%s' at %s: %w", key, t.Format(time.RFC3339Nano), ErrVersionNotFound)
+}
@@ -0,0 +1,152 @@
+package store
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// defaultMaxPrecisionTimers caps the keys with a precision timer unless WithPrecisionExpiry sets a limit.
+const defaultMaxPrecisionTimers = 10000
+
+// PrecisionExpiryStats describes the precision expiration timers.
+type PrecisionExpiryStats struct {
+	Timers   int    // Keys with a pending timer
+	Fired    uint64 // Keys expired by their timer rather than the sweep
+	Overflow uint64 // Keys left to the sweep because the limit was reached
+}
+
+// precisionTimer is the pending expiration of one key.
+type precisionTimer struct {
+	timer    *time.Timer
+	deadline time.Time
+}
+
+// precisionExpiry expires keys under configured prefixes at their exact deadline.
+// Each pending key holds one runtime timer (a few hundred bytes, no goroutine until it fires).
+type precisionExpiry struct {
+	prefixes  []string
+	maxTimers int
+	timers    map[string]*precisionTimer
+	fired     uint64
+	overflow  uint64
+}
+
+// newPrecisionExpiry creates a precision expiry for keys starting with any of prefixes.
+func newPrecisionExpiry(maxTimers int, prefixes []string) *precisionExpiry {
+	if maxTimers <= 0 {
+		maxTimers = defaultMaxPrecisionTimers
+	}
+	return &precisionExpiry{prefixes: prefixes, maxTimers: maxTimers, timers: make(map[string]*precisionTimer)}
+}
+
+// matches reports whether key expires precisely.
+func (p *precisionExpiry) matches(key string) bool {
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleExpiry cancels the timer of key and starts a new one for its current deadline, if it has one
+// and expires precisely, and queues the deadline for the cleanup sweep. It must be called whenever the
+// expiration of key changes or the key is removed. The caller must hold the write lock.
+func (kv *KeyValueStore) scheduleExpiry(key string) {
+	kv.queueExpiry(key)
+	p := kv.precision
+	if p == nil {
+		return
+	}
+	if t, ok := p.timers[key]; ok {
+		t.timer.Stop()
+		delete(p.timers, key)
+	}
+
+	deadline, ok := kv.expirations[key]
+	if !ok || !p.matches(key) {
+		return
+	}
+	if len(p.timers) >= p.maxTimers {
+		p.overflow++
+		log.Printf("scheduleExpiry: %d precision timers pending, leaving key '%s' to the sweep\n", len(p.timers), key)
+		return
+	}
+
+	t := &precisionTimer{deadline: deadline}
+	t.timer = time.AfterFunc(time.Until(deadline), func() { kv.firePrecisionTimer(key, t) })
+	p.timers[key] = t
+}
+
+// firePrecisionTimer expires key if t is still its current timer. The sweep and the timer both run under
+// the write lock and remove the key together with its timer, so only one of them sends the expiration.
+func (kv *KeyValueStore) firePrecisionTimer(key string, t *precisionTimer) {
+	acquired := kv.lockWrite(OpCleanup)
+	defer kv.unlockWrite(OpCleanup, acquired)
+
+	p := kv.precision
+	if p.timers[key] != t {
+		return
+	}
+	delete(p.timers, key)
+	if on, _ := kv.MaintenanceMode(); on {
+		// Expiry is paused; the first sweep after maintenance removes the key.
+		return
+	}
+	if deadline, ok := kv.expirations[key]; !ok || !deadline.Equal(t.deadline) {
+		return
+	}
+
+	last := latestValue(kv.data[key])
+	delete(kv.data, key)
+	delete(kv.expirations, key)
+	kv.dropPendingLocked(key)
+	kv.persistDelete(key)
+	kv.indexRemove(key)
+	p.fired++
+	kv.notificationManager.notifyChange("expired", key, last, "", kv.globalSeq.Add(1))
+}
+
+// precisionReset reschedules the timers of every key after the expirations were replaced.
+// The caller must hold the write lock.
+func (kv *KeyValueStore) precisionReset() {
+	p := kv.precision
+	if p == nil {
+		return
+	}
+	for key, t := range p.timers {
+		t.timer.Stop()
+		delete(p.timers, key)
+	}
+	for key := range kv.expirations {
+		kv.scheduleExpiry(key)
+	}
+}
+
+// stopPrecisionTimers cancels every pending timer.
+func (kv *KeyValueStore) stopPrecisionTimers() {
+	if kv.precision == nil {
+		return
+	}
+	kv.Lock()
+	defer kv.Unlock()
+	for key, t := range kv.precision.timers {
+		t.timer.Stop()
+		delete(kv.precision.timers, key)
+	}
+}
+
+// PrecisionExpiryStats returns the number of pending precision timers and how keys were expired.
+func (kv *KeyValueStore) PrecisionExpiryStats() PrecisionExpiryStats {
+	if kv.precision == nil {
+		return PrecisionExpiryStats{}
+	}
+	kv.RLock()
+	defer kv.RUnlock()
+	return PrecisionExpiryStats{
+		Timers:   len(kv.precision.timers),
+		Fired:    kv.precision.fired,
+		Overflow: kv.precision.overflow,
+	}
+}
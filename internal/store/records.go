@@ -0,0 +1,242 @@
+package store
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+)
+
+// RecordPersister persists individual mutations instead of whole-store snapshots. Values reach it
+// already encrypted when the store has an encryption key; a zero expiresAt means no expiration.
+type RecordPersister interface {
+	LoadRecords() (map[string][]KeyValue, map[string]time.Time, error)
+	AppendVersion(key string, version KeyValue, expiresAt time.Time) error
+	ReplaceKey(key string, versions []KeyValue, expiresAt time.Time) error
+	DeleteKey(key string) error
+	ReplaceAll(data map[string][]KeyValue, expirations map[string]time.Time) error
+}
+
+// sealValue encrypts a single value for a record persister.
+func (kv *KeyValueStore) sealValue(value string) (string, error) {
+	if len(kv.encryptionKey) == 0 {
+		return value, nil
+	}
+	encrypted, err := EncryptDataWithContext([]byte(value), kv.encryptionKey, kv.encryptionContext)
+	if err != nil {
+		return "", fmt.Errorf("error encrypting value: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// openValue decrypts a single value read from a record persister.
+func (kv *KeyValueStore) openValue(value string) (string, error) {
+	if len(kv.encryptionKey) == 0 {
+		return value, nil
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("error decoding value: %v", err)
+	}
+	decrypted, err := DecryptDataWithContext(encrypted, kv.encryptionKey, kv.encryptionContext)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting value: %w", err)
+	}
+	return string(decrypted), nil
+}
+
+// sealVersions returns a copy of versions in full with every value encrypted. Record persisters have
+// no place for the delta flag, so deltas are applied before they are written and re-encoded on load.
+func (kv *KeyValueStore) sealVersions(versions []KeyValue) ([]KeyValue, error) {
+	full, err := materializeVersions(versions)
+	if err != nil {
+		return nil, fmt.Errorf("error reconstructing history: %v", err)
+	}
+	sealed := make([]KeyValue, len(full))
+	for i, version := range full {
+		value, err := kv.sealValue(version.Value)
+		if err != nil {
+			return nil, err
+		}
+		sealed[i] = version
+		sealed[i].Value = value
+	}
+	return sealed, nil
+}
+
+// loadRecords loads the store contents from the record persister. The caller must hold the write lock.
+func (kv *KeyValueStore) loadRecords() error {
+	data, expirations, err := kv.records.LoadRecords()
+	if err != nil {
+		return fmt.Errorf("error loading records: %v", err)
+	}
+	seq := takeSequence(data)
+	var immutable []string
+	if versions, ok := data[immutableRecord]; ok {
+		delete(data, immutableRecord)
+		if len(versions) > 0 {
+			value, err := kv.openValue(versions[len(versions)-1].Value)
+			if err != nil {
+				return err
+			}
+			immutable = parseImmutable(value)
+		}
+	}
+	if kv.keySecret != nil {
+		if data, expirations, err = kv.unhashRecords(data, expirations); err != nil {
+			return err
+		}
+	}
+	for _, versions := range data {
+		for i := range versions {
+			if versions[i].Value, err = kv.openValue(versions[i].Value); err != nil {
+				return err
+			}
+		}
+	}
+
+	kv.data = data
+	kv.expirations = expirations
+	kv.observeRevisionsLocked()
+	kv.rebaseDeltasLocked()
+	kv.dedupResetLocked()
+	kv.autoRenew.reset()
+	kv.valueGrowth.reset()
+	kv.resetImmutableLocked(immutable)
+	kv.indexReset()
+	kv.precisionReset()
+	kv.rebuildExpiryQueue()
+	kv.restoreSequence(seq)
+	kv.loaded.Store(true)
+	log.Printf("load: Loaded %d keys from records\n", len(data))
+	return nil
+}
+
+// persistAppend writes the latest version of key through to the record persister, marks it changed
+// for the next differential backup and stale read snapshot, pools its value and counts it as written by
+// a client. The caller must hold the write lock.
+func (kv *KeyValueStore) persistAppend(key string) {
+	kv.backups.mark(key)
+	kv.staleReads.mark(key)
+	kv.dedupKeyLocked(key)
+	versions := kv.data[key]
+	kv.ioStats.clientWrite(key, versions[len(versions)-1].Value)
+	kv.refreshImmutableLocked(key)
+	if kv.records == nil {
+		return
+	}
+	var err error
+	if kv.keySecret != nil && len(versions) == 1 {
+		err = kv.persistKeyName(key)
+	}
+	var sealed []KeyValue
+	if err == nil {
+		sealed, err = kv.sealVersions(versions[len(versions)-1:])
+	}
+	if err == nil {
+		err = kv.records.AppendVersion(kv.persistedKey(key), sealed[0], kv.expirations[key])
+	}
+	kv.persistFailed("AppendVersion", key, err)
+}
+
+// persistKey rewrites the history and expiration of key in the record persister, marks it changed
+// for the next differential backup and stale read snapshot and pools its values. The caller must hold
+// the write lock.
+func (kv *KeyValueStore) persistKey(key string) {
+	kv.backups.mark(key)
+	kv.staleReads.mark(key)
+	kv.dedupKeyLocked(key)
+	kv.refreshImmutableLocked(key)
+	if kv.records == nil {
+		return
+	}
+	var err error
+	if kv.keySecret != nil {
+		err = kv.persistKeyName(key)
+	}
+	var sealed []KeyValue
+	if err == nil {
+		sealed, err = kv.sealVersions(kv.data[key])
+	}
+	if err == nil {
+		err = kv.records.ReplaceKey(kv.persistedKey(key), sealed, kv.expirations[key])
+	}
+	kv.persistFailed("ReplaceKey", key, err)
+}
+
+// persistDelete removes key from the record persister, marks it changed for the next differential
+// backup and stale read snapshot, releases its pooled values and drops its offloaded versions, so a key
+// created again under the same name starts a fresh history. The caller must hold the write lock.
+func (kv *KeyValueStore) persistDelete(key string) {
+	kv.backups.mark(key)
+	kv.staleReads.mark(key)
+	kv.dedupKeyLocked(key)
+	kv.forgetHistory(key)
+	kv.autoRenew.forget(key)
+	kv.valueGrowth.forget(key)
+	kv.refreshImmutableLocked(key)
+	if kv.records == nil {
+		return
+	}
+	err := kv.records.DeleteKey(kv.persistedKey(key))
+	if err == nil && kv.keySecret != nil {
+		err = kv.records.DeleteKey(keyNameRecordPrefix + kv.hashKey(key))
+	}
+	kv.persistFailed("DeleteKey", key, err)
+}
+
+// persistFailed logs a failed write-through and marks the records for a full rewrite on the next save.
+func (kv *KeyValueStore) persistFailed(op, key string, err error) {
+	if err == nil {
+		return
+	}
+	log.Printf("%s: Failed to persist key '%s', deferring to next save: %v\n", op, key, err)
+	kv.recordsDirty.Store(true)
+}
+
+// saveRecords rewrites every record if a write-through failed or the contents were replaced wholesale,
+// and otherwise only the sequence record. The caller must hold the lock.
+func (kv *KeyValueStore) saveRecords() error {
+	if !kv.recordsDirty.Load() {
+		log.Println("Save: Records up to date")
+		if err := kv.records.ReplaceKey(sequenceRecord, kv.sequenceVersions(), time.Time{}); err != nil {
+			return fmt.Errorf("error saving sequence: %v", err)
+		}
+		return nil
+	}
+	if kv.keySecret != nil && len(kv.encryptionKey) == 0 {
+		return errKeyHashingWithoutEncryption
+	}
+	data := make(map[string][]KeyValue, len(kv.data))
+	expirations := make(map[string]time.Time, len(kv.expirations))
+	for key, versions := range kv.data {
+		sealed, err := kv.sealVersions(versions)
+		if err != nil {
+			return err
+		}
+		data[kv.persistedKey(key)] = sealed
+		if kv.keySecret != nil {
+			record, name, err := kv.keyNameRecord(key)
+			if err != nil {
+				return err
+			}
+			data[record] = name
+		}
+	}
+	for key, expiresAt := range kv.expirations {
+		expirations[kv.persistedKey(key)] = expiresAt
+	}
+	data[sequenceRecord] = kv.sequenceVersions()
+	if versions := kv.immutableVersions(); versions != nil {
+		sealed, err := kv.sealVersions(versions)
+		if err != nil {
+			return err
+		}
+		data[immutableRecord] = sealed
+	}
+	if err := kv.records.ReplaceAll(data, expirations); err != nil {
+		return fmt.Errorf("error saving records: %v", err)
+	}
+	kv.recordsDirty.Store(false)
+	return nil
+}
@@ -0,0 +1,467 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisImportBatch is the number of keys set per SetMany call by ImportRedis.
+const redisImportBatch = 500
+
+// Limits on RESP commands read by ImportRedis, matching the defaults of Redis.
+const (
+	redisMaxArgs     = 1024 * 1024
+	redisMaxBulkSize = 512 * 1024 * 1024
+)
+
+// redisTypeCommands maps Redis write commands for types other than strings to the type they create.
+var redisTypeCommands = map[string]string{
+	"HSET": "hash", "HMSET": "hash", "HSETNX": "hash",
+	"LPUSH": "list", "RPUSH": "list", "LSET": "list", "LINSERT": "list",
+	"SADD":   "set",
+	"ZADD":   "zset",
+	"XADD":   "stream",
+	"PFADD":  "hyperloglog",
+	"SETBIT": "bitmap", "BITFIELD": "bitmap",
+	"GEOADD": "geo",
+}
+
+// RedisImportReport summarises an ImportRedis run.
+type RedisImportReport struct {
+	Imported    int            // Keys set in the store
+	WithTTL     int            // Imported keys given a TTL
+	Expired     int            // Keys whose TTL had already passed, which were not imported
+	Unsupported map[string]int // Commands skipped by the type they create, or by name for other commands
+	Skipped     []string       // Keys of the skipped commands, sorted
+	Errors      map[string]error
+}
+
+// redisEntry is a string key read from a Redis command file.
+type redisEntry struct {
+	value    string
+	deadline time.Time // Zero for no expiration
+}
+
+// ImportRedis reads a file of Redis commands, either in RESP as sent by redis-cli --pipe or one inline
+// command per line as typed into redis-cli, and sets the string keys it creates. SET (with EX, PX, EXAT or
+// PXAT), SETEX, PSETEX, MSET, EXPIRE, PEXPIRE, EXPIREAT, PEXPIREAT, PERSIST and DEL are applied in order;
+// commands for other types are skipped and reported. A malformed file fails without importing anything.
+// Values are kept byte for byte, including binary values as stored by SetBytes.
+// The key notifications of the imported keys are replaced by a single "bulk:import_redis" summary; writes
+// by other callers during the import are still notified.
+func (kv *KeyValueStore) ImportRedis(r io.Reader) (RedisImportReport, error) {
+	report := RedisImportReport{Unsupported: make(map[string]int), Errors: make(map[string]error)}
+	commands, err := readRedisCommands(bufio.NewReader(r))
+	if err != nil {
+		return report, err
+	}
+
+	now := time.Now()
+	entries := make(map[string]*redisEntry)
+	skipped := make(map[string]bool)
+	for _, args := range commands {
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToUpper(args[0])
+		if kind, ok := redisTypeCommands[name]; ok {
+			report.Unsupported[kind]++
+			if len(args) > 1 {
+				skipped[args[1]] = true
+			}
+			continue
+		}
+		if err := applyRedisCommand(entries, name, args[1:], now); err != nil {
+			if errors.Is(err, errUnsupportedRedisCommand) {
+				report.Unsupported[name]++
+				if len(args) > 1 {
+					skipped[args[1]] = true
+				}
+				continue
+			}
+			return report, fmt.Errorf("error importing Redis command %s: %v", name, err)
+		}
+	}
+	for key := range skipped {
+		report.Skipped = append(report.Skipped, key)
+	}
+	sort.Strings(report.Skipped)
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Consumers get one summary of the import instead of an event per key.
+	bulk := kv.suspendBulk("import_redis")
+	defer bulk.resume(true)
+	batch := make([]Entry, 0, redisImportBatch)
+	flush := func() {
+		result := kv.setMany(batch, bulk)
+		for key, err := range result.Errors {
+			report.Errors[key] = err
+		}
+		for _, entry := range batch {
+			if _, failed := result.Errors[entry.Key]; failed {
+				continue
+			}
+			report.Imported++
+			if entry.TTL > 0 {
+				report.WithTTL++
+			}
+		}
+		batch = batch[:0]
+	}
+	for _, key := range keys {
+		entry := entries[key]
+		var ttl time.Duration
+		if !entry.deadline.IsZero() {
+			if ttl = time.Until(entry.deadline); ttl <= 0 {
+				report.Expired++
+				continue
+			}
+		}
+		batch = append(batch, Entry{Key: key, Value: entry.value, TTL: ttl})
+		if len(batch) == redisImportBatch {
+			flush()
+		}
+	}
+	if len(batch) > 0 {
+		flush()
+	}
+
+	log.Printf("ImportRedis: Imported %d keys (%d with TTL), %d expired, %d unsupported commands, %d failed\n",
+		report.Imported, report.WithTTL, report.Expired, sumCounts(report.Unsupported), len(report.Errors))
+	return report, nil
+}
+
+// errUnsupportedRedisCommand is returned by applyRedisCommand for commands it does not know.
+var errUnsupportedRedisCommand = errors.New("unsupported command")
+
+// applyRedisCommand applies a command to the entries read so far.
+func applyRedisCommand(entries map[string]*redisEntry, name string, args []string, now time.Time) error {
+	switch name {
+	case "SET":
+		if len(args) < 2 {
+			return fmt.Errorf("expected a key and a value")
+		}
+		entry := &redisEntry{value: args[1]}
+		keepTTL := false
+		for i := 2; i < len(args); i++ {
+			option := strings.ToUpper(args[i])
+			switch option {
+			case "NX", "XX", "GET":
+			case "KEEPTTL":
+				keepTTL = true
+			case "EX", "PX", "EXAT", "PXAT":
+				if i+1 == len(args) {
+					return fmt.Errorf("%s needs a value", option)
+				}
+				i++
+				deadline, err := redisDeadline(option, args[i], now)
+				if err != nil {
+					return err
+				}
+				entry.deadline = deadline
+			default:
+				return fmt.Errorf("unknown SET option %q", args[i])
+			}
+		}
+		if previous, ok := entries[args[0]]; ok && keepTTL {
+			entry.deadline = previous.deadline
+		}
+		entries[args[0]] = entry
+	case "SETEX", "PSETEX":
+		if len(args) != 3 {
+			return fmt.Errorf("expected a key, a TTL and a value")
+		}
+		unit := "EX"
+		if name == "PSETEX" {
+			unit = "PX"
+		}
+		deadline, err := redisDeadline(unit, args[1], now)
+		if err != nil {
+			return err
+		}
+		entries[args[0]] = &redisEntry{value: args[2], deadline: deadline}
+	case "MSET":
+		if len(args) == 0 || len(args)%2 != 0 {
+			return fmt.Errorf("expected key and value pairs")
+		}
+		for i := 0; i < len(args); i += 2 {
+			entries[args[i]] = &redisEntry{value: args[i+1]}
+		}
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		if len(args) < 2 {
+			return fmt.Errorf("expected a key and a TTL")
+		}
+		unit := map[string]string{"EXPIRE": "EX", "PEXPIRE": "PX", "EXPIREAT": "EXAT", "PEXPIREAT": "PXAT"}[name]
+		deadline, err := redisDeadline(unit, args[1], now)
+		if err != nil {
+			return err
+		}
+		if entry, ok := entries[args[0]]; ok {
+			entry.deadline = deadline
+		}
+	case "PERSIST":
+		if len(args) != 1 {
+			return fmt.Errorf("expected a key")
+		}
+		if entry, ok := entries[args[0]]; ok {
+			entry.deadline = time.Time{}
+		}
+	case "DEL", "UNLINK":
+		for _, key := range args {
+			delete(entries, key)
+		}
+	default:
+		return errUnsupportedRedisCommand
+	}
+	return nil
+}
+
+// redisDeadline converts a Redis TTL option value into a deadline.
+func redisDeadline(unit, value string, now time.Time) (time.Time, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s value %q", unit, value)
+	}
+	switch unit {
+	case "EX":
+		return now.Add(time.Duration(n) * time.Second), nil
+	case "PX":
+		return now.Add(time.Duration(n) * time.Millisecond), nil
+	case "EXAT":
+		return time.Unix(n, 0), nil
+	default:
+		return time.UnixMilli(n), nil
+	}
+}
+
+// readRedisCommands reads every command from r, detecting RESP from a leading '*'.
+func readRedisCommands(r *bufio.Reader) ([][]string, error) {
+	var commands [][]string
+	for n := 1; ; n++ {
+		first, err := r.Peek(1)
+		if err == io.EOF {
+			return commands, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading Redis commands: %v", err)
+		}
+
+		var args []string
+		if first[0] == '*' {
+			args, err = readRESPCommand(r)
+		} else {
+			var text string
+			if text, err = r.ReadString('\n'); err == io.EOF && text != "" {
+				err = nil
+			}
+			if err == nil {
+				args, err = splitRedisArgs(strings.TrimRight(text, "\r\n"))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading Redis command %d: %v", n, err)
+		}
+		if len(args) > 0 && !strings.HasPrefix(args[0], "#") {
+			commands = append(commands, args)
+		}
+	}
+}
+
+// readRESPCommand reads a RESP array of bulk strings.
+func readRESPCommand(r *bufio.Reader) ([]string, error) {
+	header, err := readRESPLine(r)
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(header[1:])
+	if err != nil || count < 0 || count > redisMaxArgs {
+		return nil, fmt.Errorf("invalid RESP array header %q", header)
+	}
+	args := make([]string, count)
+	for i := range args {
+		header, err := readRESPLine(r)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimPrefix(header, "$"))
+		if !strings.HasPrefix(header, "$") || err != nil || size < 0 || size > redisMaxBulkSize {
+			return nil, fmt.Errorf("invalid RESP bulk string header %q", header)
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("truncated RESP bulk string: %v", err)
+		}
+		if !bytes.HasSuffix(data, []byte("\r\n")) {
+			return nil, fmt.Errorf("RESP bulk string not terminated by CRLF")
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+// readRESPLine reads a CRLF-terminated RESP line without its terminator.
+func readRESPLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("truncated RESP command: %v", err)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
+
+// splitRedisArgs splits an inline command like redis-cli does: arguments are separated by spaces and may be
+// double-quoted, with \n, \r, \t, \b, \a, \\, \" and \xHH escapes, or single-quoted, with \' as the only escape.
+func splitRedisArgs(line string) ([]string, error) {
+	var args []string
+	for i := 0; ; {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg strings.Builder
+		switch quote := line[i]; quote {
+		case '"', '\'':
+			i++
+			for {
+				if i == len(line) {
+					return nil, fmt.Errorf("unbalanced quotes")
+				}
+				c := line[i]
+				if c == quote {
+					i++
+					break
+				}
+				if c == '\\' && i+1 < len(line) {
+					if quote == '\'' {
+						if line[i+1] == '\'' {
+							c = '\''
+							i++
+						}
+					} else if line[i+1] == 'x' && i+3 < len(line) && isHex(line[i+2]) && isHex(line[i+3]) {
+						n, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+						c = byte(n)
+						i += 3
+					} else {
+						i++
+						switch line[i] {
+						case 'n':
+							c = '\n'
+						case 'r':
+							c = '\r'
+						case 't':
+							c = '\t'
+						case 'b':
+							c = '\b'
+						case 'a':
+							c = '\a'
+						default:
+							c = line[i]
+						}
+					}
+				}
+				arg.WriteByte(c)
+				i++
+			}
+			if i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				return nil, fmt.Errorf("closing quote must be followed by a space")
+			}
+		default:
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				arg.WriteByte(line[i])
+				i++
+			}
+		}
+		args = append(args, arg.String())
+	}
+}
+
+// isHex reports whether c is a hexadecimal digit.
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// quoteRedisArg quotes s for an inline redis-cli command, escaping everything but printable ASCII.
+func quoteRedisArg(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' || c == '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// ExportRedis writes the latest value of every live key to w as inline SET commands, each followed by an
+// EXPIRE for keys with a TTL, for piping into redis-cli. It returns the number of keys written.
+func (kv *KeyValueStore) ExportRedis(w io.Writer) (int, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, err
+	}
+	kv.flushAllPending()
+
+	kv.RLock()
+	now := time.Now()
+	keys := make([]string, 0, len(kv.data))
+	for key, versions := range kv.data {
+		if exp, ok := kv.expirations[key]; (ok && !exp.After(now)) || len(versions) == 0 {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	deadlines := make([]time.Time, len(keys))
+	for i, key := range keys {
+		versions := kv.data[key]
+		values[i] = versions[len(versions)-1].Value
+		deadlines[i] = kv.expirations[key]
+	}
+	kv.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for i, key := range keys {
+		fmt.Fprintf(bw, "SET %s %s\n", quoteRedisArg(key), quoteRedisArg(values[i]))
+		if !deadlines[i].IsZero() {
+			// Round up so a key never expires earlier in Redis than it would have here.
+			seconds := (time.Until(deadlines[i]) + time.Second - 1) / time.Second
+			if seconds < 1 {
+				seconds = 1
+			}
+			fmt.Fprintf(bw, "EXPIRE %s %d\n", quoteRedisArg(key), seconds)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("error writing Redis commands: %v", err)
+	}
+	log.Printf("ExportRedis: Exported %d keys\n", len(keys))
+	return len(keys), nil
+}
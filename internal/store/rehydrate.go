@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// rehydrateBatchSize is the number of keys handled per lock acquisition by RehydrateTTLs.
+const rehydrateBatchSize = 100
+
+// TTLRule computes the remaining TTL for a key without expiration from its version history.
+// It returns false to leave the key without expiration. A TTL of zero or less expires the key immediately.
+type TTLRule func(key string, history []KeyValue) (time.Duration, bool)
+
+// RehydrateReport summarises a RehydrateTTLs run.
+type RehydrateReport struct {
+	Scanned  int // Keys without expiration that were considered
+	Assigned int // Keys that received a TTL
+	Expired  int // Keys whose computed deadline had already passed
+	Skipped  int // Keys left without expiration, or changed concurrently
+}
+
+// TTLFromLastWrite returns a rule assigning each key the given TTL counted from its latest write.
+func TTLFromLastWrite(ttl time.Duration) TTLRule {
+	return func(key string, history []KeyValue) (time.Duration, bool) {
+		if len(history) == 0 {
+			return 0, false
+		}
+		return time.Until(history[len(history)-1].Timestamp.Add(ttl)), true
+	}
+}
+
+// RehydrateTTLs assigns TTLs to keys that have no expiration, as computed by rule.
+// Keys are processed in batches and the lock is released between batches, so it can run against a live store.
+func (kv *KeyValueStore) RehydrateTTLs(rule TTLRule) (RehydrateReport, error) {
+	return kv.RehydrateTTLsContext(context.Background(), rule, nil)
+}
+
+// RehydrateTTLsContext is RehydrateTTLs reporting progress in keys, if progress is not nil, and stopping
+// between batches once ctx is canceled.
+func (kv *KeyValueStore) RehydrateTTLsContext(ctx context.Context, rule TTLRule, progress func(done, total int)) (RehydrateReport, error) {
+	var report RehydrateReport
+	if err := kv.ensureLoaded(); err != nil {
+		return report, err
+	}
+
+	kv.RLock()
+	keys := make([]string, 0, len(kv.data))
+	for key := range kv.data {
+		if _, frozen := kv.immutableValue(key); frozen {
+			continue
+		}
+		if _, ok := kv.expirations[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	kv.RUnlock()
+	sort.Strings(keys)
+
+	for start := 0; start < len(keys); start += rehydrateBatchSize {
+		if err := ctx.Err(); err != nil {
+			log.Printf("RehydrateTTLs: Canceled after %d of %d keys\n", start, len(keys))
+			return report, err
+		}
+		end := start + rehydrateBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		kv.rehydrateBatch(keys[start:end], rule, &report)
+		if progress != nil {
+			progress(end, len(keys))
+		}
+	}
+
+	log.Printf("RehydrateTTLs: scanned %d, assigned %d, expired %d, skipped %d\n",
+		report.Scanned, report.Assigned, report.Expired, report.Skipped)
+	return report, nil
+}
+
+// rehydrateBatch computes TTLs for a batch of keys without holding the lock and applies them under the write lock.
+func (kv *KeyValueStore) rehydrateBatch(keys []string, rule TTLRule, report *RehydrateReport) {
+	histories := make(map[string][]KeyValue, len(keys))
+	kv.RLock()
+	for _, key := range keys {
+		if versions, exists := kv.data[key]; exists {
+			histories[key] = append([]KeyValue(nil), versions...)
+		}
+	}
+	kv.RUnlock()
+
+	now := time.Now()
+	deadlines := make(map[string]time.Time, len(histories))
+	for _, key := range keys {
+		history, exists := histories[key]
+		if !exists {
+			continue
+		}
+		report.Scanned++
+		ttl, ok := rule(key, history)
+		if !ok {
+			report.Skipped++
+			continue
+		}
+		deadlines[key] = now.Add(ttl)
+	}
+
+	kv.Lock()
+	defer kv.Unlock()
+
+	now = time.Now()
+	for key, deadline := range deadlines {
+		// Leave keys alone if they were rewritten or given a TTL since the batch was read.
+		versions, exists := kv.data[key]
+		_, hasTTL := kv.expirations[key]
+		_, pending := kv.pending[key]
+		if !exists || hasTTL || pending || !sameLatestVersion(versions, histories[key]) {
+			report.Skipped++
+			continue
+		}
+
+		if !deadline.After(now) {
+			delete(kv.data, key)
+			kv.persistDelete(key)
+			kv.indexRemove(key)
+			kv.notificationManager.notifyChange("expired", key, latestValue(versions), "", kv.globalSeq.Add(1))
+			report.Expired++
+			continue
+		}
+
+		kv.expirations[key] = deadline
+		kv.scheduleExpiry(key)
+		kv.persistKey(key)
+		report.Assigned++
+	}
+}
+
+// sameLatestVersion reports whether versions still ends with the version read ended with. Comparing lengths
+// alone misses a write that retention pruning balanced out.
+func sameLatestVersion(versions, read []KeyValue) bool {
+	if len(versions) != len(read) || len(versions) == 0 {
+		return len(versions) == len(read)
+	}
+	return versions[len(versions)-1].Timestamp.Equal(read[len(read)-1].Timestamp)
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// LoadReport describes the repairs applied to malformed data while loading the store.
+type LoadReport struct {
+	DroppedKeys       []string       // Keys whose version history was empty
+	FilledTimestamps  map[string]int // Versions per key whose zero timestamp was replaced by the file's mtime
+	RemovedDuplicates map[string]int // Identical consecutive versions removed per key
+}
+
+// Repaired reports whether any repair was applied.
+func (r LoadReport) Repaired() bool {
+	return len(r.DroppedKeys) > 0 || len(r.FilledTimestamps) > 0 || len(r.RemovedDuplicates) > 0
+}
+
+// Count returns the total number of repairs applied.
+func (r LoadReport) Count() int {
+	return len(r.DroppedKeys) + sumCounts(r.FilledTimestamps) + sumCounts(r.RemovedDuplicates)
+}
+
+// repairData fixes malformed version histories in data and reports what was changed.
+// Timestamps that were never set are replaced with modTime.
+func repairData(data map[string][]KeyValue, modTime time.Time, dedupe bool) LoadReport {
+	report := LoadReport{
+		FilledTimestamps:  make(map[string]int),
+		RemovedDuplicates: make(map[string]int),
+	}
+
+	for key, versions := range data {
+		if len(versions) == 0 {
+			report.DroppedKeys = append(report.DroppedKeys, key)
+			delete(data, key)
+			continue
+		}
+
+		for i := range versions {
+			if versions[i].Timestamp.IsZero() {
+				versions[i].Timestamp = modTime
+				report.FilledTimestamps[key]++
+			}
+		}
+
+		if dedupe {
+			if full, err := materializeVersions(versions); err == nil {
+				versions = full
+			}
+			deduped := versions[:1]
+			for _, version := range versions[1:] {
+				if version.Value == deduped[len(deduped)-1].Value {
+					report.RemovedDuplicates[key]++
+					continue
+				}
+				deduped = append(deduped, version)
+			}
+			data[key] = deduped
+		}
+	}
+	sort.Strings(report.DroppedKeys)
+
+	return report
+}
+
+// describe returns a short summary of the repairs for logs and errors.
+func (r LoadReport) describe() string {
+	return fmt.Sprintf("%d empty histories, %d missing timestamps, %d duplicate versions",
+		len(r.DroppedKeys), sumCounts(r.FilledTimestamps), sumCounts(r.RemovedDuplicates))
+}
+
+// sumCounts adds up the values of a per-key counter.
+func sumCounts(counts map[string]int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+// LastLoadReport returns the repairs applied by the last load.
+func (kv *KeyValueStore) LastLoadReport() LoadReport {
+	kv.RLock()
+	defer kv.RUnlock()
+	return kv.loadReport
+}
+
+// logRepairs logs each repair applied while loading.
+func logRepairs(report LoadReport) {
+	for _, key := range report.DroppedKeys {
+		log.Printf("load: Dropped key '%s' with empty history\n", key)
+	}
+	for key, n := range report.FilledTimestamps {
+		log.Printf("load: Filled %d missing timestamps for key '%s'\n", n, key)
+	}
+	for key, n := range report.RemovedDuplicates {
+		log.Printf("load: Removed %d duplicate versions for key '%s'\n", n, key)
+	}
+}
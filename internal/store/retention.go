@@ -0,0 +1,124 @@
+package store
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VersionRetention bounds the version history of keys. The latest version of a key is always kept.
+type VersionRetention struct {
+	MaxVersions int           // Versions kept per key; zero keeps any number
+	MaxAge      time.Duration // Versions written longer ago are dropped; zero keeps versions of any age
+}
+
+// retentionRule applies a retention policy to the keys starting with prefix.
+type retentionRule struct {
+	prefix string
+	policy VersionRetention
+}
+
+// retentionFor returns the retention policy of key: the one of the longest matching prefix.
+func (kv *KeyValueStore) retentionFor(key string) (VersionRetention, bool) {
+	var match *retentionRule
+	for i := range kv.retentionRules {
+		rule := &kv.retentionRules[i]
+		if strings.HasPrefix(key, rule.prefix) && (match == nil || len(rule.prefix) > len(match.prefix)) {
+			match = rule
+		}
+	}
+	if match == nil {
+		return VersionRetention{}, false
+	}
+	return match.policy, true
+}
+
+// hasAgeRetention reports whether a retention policy drops versions by age, which the cleanup loop then
+// enforces on keys that are not written.
+func (kv *KeyValueStore) hasAgeRetention() bool {
+	for _, rule := range kv.retentionRules {
+		if rule.policy.MaxAge > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// enforceRetentionLocked drops the versions of key its retention policy does not keep at now and returns
+// how many it dropped. The caller must hold the write lock.
+func (kv *KeyValueStore) enforceRetentionLocked(key string, now time.Time) (int, error) {
+	policy, ok := kv.retentionFor(key)
+	if !ok {
+		return 0, nil
+	}
+	versions := kv.data[key]
+	keep := len(versions)
+	if policy.MaxVersions > 0 && keep > policy.MaxVersions {
+		keep = policy.MaxVersions
+	}
+	if policy.MaxAge > 0 {
+		cutoff := now.Add(-policy.MaxAge)
+		for keep > 1 && versions[len(versions)-keep].Timestamp.Before(cutoff) {
+			keep--
+		}
+	}
+	if keep == len(versions) {
+		return 0, nil
+	}
+	return kv.pruneLocked(key, keep)
+}
+
+// PruneVersions applies the retention policies set with WithVersionRetention and WithKeyRetention to every
+// key now and returns how many versions it dropped. Writes apply them to the key written, and the cleanup
+// loop applies age limits to the other keys; stores created with WithNoBackground call it instead.
+func (kv *KeyValueStore) PruneVersions() (int, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, err
+	}
+	if len(kv.retentionRules) == 0 {
+		return 0, nil
+	}
+
+	kv.RLock()
+	keys := make([]string, 0, len(kv.data))
+	for key := range kv.data {
+		keys = append(keys, key)
+	}
+	kv.RUnlock()
+	sort.Strings(keys)
+
+	removed := 0
+	for start := 0; start < len(keys); start += compactBatchSize {
+		n, err := kv.pruneBatch(keys[start:min(start+compactBatchSize, len(keys))], time.Now())
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	if removed > 0 {
+		log.Printf("PruneVersions: Removed %d versions from %d keys\n", removed, len(keys))
+	}
+	return removed, nil
+}
+
+// pruneBatch applies the retention policies to a batch of keys under the write lock, skipping keys
+// deleted since they were listed.
+func (kv *KeyValueStore) pruneBatch(keys []string, now time.Time) (int, error) {
+	acquired := kv.lockWrite(OpCleanup)
+	defer kv.unlockWrite(OpCleanup, acquired)
+
+	removed := 0
+	for _, key := range keys {
+		if _, exists := kv.data[key]; !exists {
+			continue
+		}
+		n, err := kv.enforceRetentionLocked(key, now)
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
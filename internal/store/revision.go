@@ -0,0 +1,54 @@
+package store
+
+// Every write gives its version a revision, the next value of a counter shared by the store's keys, and
+// changes that make an older version the latest give it a new one. The revision of a key's latest version
+// thus changes whenever its value does and never comes back, unlike the position of the version in the
+// history, which repeats once the key is deleted and set again or its history is pruned.
+
+// nextRevision returns a revision newer than any handed out or loaded by the store.
+func (kv *KeyValueStore) nextRevision() uint64 {
+	return kv.revision.Add(1)
+}
+
+// revisionLocked returns the revision of the latest value of key, including a write held in a coalescing
+// window, or zero if the key does not exist. The caller must hold the lock.
+func (kv *KeyValueStore) revisionLocked(key string) uint64 {
+	if p, ok := kv.pending[key]; ok {
+		return p.revision
+	}
+	versions := kv.data[key]
+	if len(versions) == 0 {
+		return 0
+	}
+	return versions[len(versions)-1].Revision
+}
+
+// restampLocked gives the latest version of key a new revision, after a change other than a write made
+// it the latest. The history is copied, as it may be shared with a snapshot. The caller must hold the
+// write lock.
+func (kv *KeyValueStore) restampLocked(key string) {
+	versions := kv.data[key]
+	if len(versions) == 0 {
+		return
+	}
+	versions = append([]KeyValue(nil), versions...)
+	versions[len(versions)-1].Revision = kv.nextRevision()
+	kv.data[key] = versions
+}
+
+// observeRevisionsLocked makes later revisions newer than those of the loaded histories. Revisions of
+// versions persisted without one stay zero. The caller must hold the write lock.
+func (kv *KeyValueStore) observeRevisionsLocked() {
+	var latest uint64
+	for _, versions := range kv.data {
+		for _, version := range versions {
+			latest = max(latest, version.Revision)
+		}
+	}
+	for {
+		current := kv.revision.Load()
+		if current >= latest || kv.revision.CompareAndSwap(current, latest) {
+			return
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package store
+
+import "fmt"
+
+// RollbackToVersion makes version of key, as numbered by GetVersion, its current value again by appending
+// it as a new version, so the versions written since stay in the history. The key keeps its TTL and is
+// notified as updated. It returns ErrKeyNotFound if the key does not exist and ErrVersionNotFound if the
+// version does not.
+func (kv *KeyValueStore) RollbackToVersion(key string, version int) error {
+	if version < 0 {
+		return fmt.Errorf("version %d of key '%s': %w", version, key, ErrVersionNotFound)
+	}
+	_, _, err := kv.readModifyWrite(key, true, func(_ string, found bool) (string, bool, error) {
+		if !found {
+			return "", false, ErrKeyNotFound
+		}
+		value, err := kv.GetVersion(key, version)
+		if err != nil {
+			return "", false, err
+		}
+		return value, false, nil
+	})
+	return err
+}
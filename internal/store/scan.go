@@ -0,0 +1,133 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// prefixIndex is a sorted list of keys, so the keys starting with a prefix are a contiguous run found by
+// binary search. It is guarded by the store lock.
+type prefixIndex struct {
+	keys []string
+}
+
+// add inserts key in order.
+func (idx *prefixIndex) add(key string) {
+	i := sort.SearchStrings(idx.keys, key)
+	if i < len(idx.keys) && idx.keys[i] == key {
+		return
+	}
+	idx.keys = append(idx.keys, "")
+	copy(idx.keys[i+1:], idx.keys[i:])
+	idx.keys[i] = key
+}
+
+// remove deletes key if present.
+func (idx *prefixIndex) remove(key string) {
+	i := sort.SearchStrings(idx.keys, key)
+	if i < len(idx.keys) && idx.keys[i] == key {
+		idx.keys = append(idx.keys[:i], idx.keys[i+1:]...)
+	}
+}
+
+// reset rebuilds the index from the keys of data.
+func (idx *prefixIndex) reset(data map[string][]KeyValue) {
+	idx.keys = make([]string, 0, len(data))
+	for key := range data {
+		idx.keys = append(idx.keys, key)
+	}
+	sort.Strings(idx.keys)
+}
+
+// withPrefix returns the run of keys starting with prefix. The slice must not be kept past the lock.
+func (idx *prefixIndex) withPrefix(prefix string) []string {
+	start := sort.SearchStrings(idx.keys, prefix)
+	end := start
+	for end < len(idx.keys) && strings.HasPrefix(idx.keys[end], prefix) {
+		end++
+	}
+	return idx.keys[start:end]
+}
+
+// Scan returns the latest values of the keys starting with prefix that exist and have not expired.
+// With WithPrefixIndex the matching keys are found by binary search; otherwise every key is checked.
+func (kv *KeyValueStore) Scan(prefix string) (map[string]string, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return nil, fmt.Errorf("data not loaded: %w", err)
+	}
+
+	acquired := kv.lockRead(OpGet)
+	defer kv.unlockRead(OpGet, acquired)
+
+	values := make(map[string]string)
+	now := time.Now()
+	visit := func(key string) {
+		versions := kv.data[key]
+		if len(versions) == 0 {
+			return
+		}
+		if exp, ok := kv.expirations[key]; ok && now.After(exp) {
+			return
+		}
+		values[key] = versions[len(versions)-1].Value
+	}
+	if kv.prefixIndex != nil {
+		for _, key := range kv.prefixIndex.withPrefix(prefix) {
+			visit(key)
+		}
+	} else {
+		for key := range kv.data {
+			if strings.HasPrefix(key, prefix) {
+				visit(key)
+			}
+		}
+	}
+	// Writes held in a coalescing window are newer than the stored versions.
+	for key := range kv.pending {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if value, ok := kv.pendingValue(key); ok {
+			values[key] = value
+		} else {
+			delete(values, key)
+		}
+	}
+	return values, nil
+}
+
+// KeysMatching returns the keys matching a glob pattern like Redis KEYS, for example "user:*:session".
+// * matches any run of characters including '/' and ':', ? a single byte, [a-z] or [^a-z] a byte of a set,
+// and \ escapes a wildcard. Like Keys, it lists keys whose TTL ran out until cleanup removes them. With
+// WithPrefixIndex only the keys starting with the pattern's literal prefix are checked.
+func (kv *KeyValueStore) KeysMatching(pattern string) ([]string, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return nil, fmt.Errorf("data not loaded: %w", err)
+	}
+
+	acquired := kv.lockRead(OpKeys)
+	defer kv.unlockRead(OpKeys, acquired)
+
+	keys := make([]string, 0)
+	if kv.prefixIndex != nil {
+		for _, key := range kv.prefixIndex.withPrefix(literalPrefix(pattern)) {
+			if globMatch(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+		return keys, nil
+	}
+	for key := range kv.data {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range kv.pendingKeysLocked() {
+		if globMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultShardFile is the file, relative to the base directory, holding keys that match no shard prefix.
+const defaultShardFile = "data.json"
+
+// Store is the key-value API shared by KeyValueStore and ShardedKeyValueStore.
+type Store interface {
+	Set(key, value string, expiration time.Duration) error
+	Get(key string) (string, error)
+	GetWithTTL(key string) (string, time.Duration, error)
+	GetVersion(key string, version int) (string, error)
+	GetAllVersions(key string) ([]string, error)
+	GetHistory(key string) ([]KeyValue, error)
+	RemoveVersion(key string, version int) error
+	CompareAndSwap(key string, oldValue, newValue string, ttl time.Duration) (bool, error)
+	Delete(key string) error
+	Keys() []string
+	Size() int
+	Stop()
+}
+
+var (
+	_ Store = (*KeyValueStore)(nil)
+	_ Store = (*ShardedKeyValueStore)(nil)
+)
+
+// shard is a store holding the keys that start with prefix.
+type shard struct {
+	prefix string
+	store  *KeyValueStore
+}
+
+// ShardedKeyValueStore routes keys to separate stores, each persisted to its own file, by key prefix.
+// Keys matching several prefixes go to the longest one; keys matching none go to the default store.
+type ShardedKeyValueStore struct {
+	shards       []shard // Sorted by descending prefix length
+	defaultShard *KeyValueStore
+}
+
+// NewShardedKeyValueStore creates a store multiplexing shards, given as prefix to file path, and any
+// WithShard options. Relative file paths are resolved against baseDir, which also holds the default
+// store. The remaining options configure every shard, except WithBackend, WithHistoryOffload and
+// WithRecordPersister: they name a single storage resource the shards would overwrite each other in,
+// so they are rejected and every shard persists to its own file.
+func NewShardedKeyValueStore(baseDir string, shards map[string]string, opts ...Option) *ShardedKeyValueStore {
+	// Collect the shards declared through options.
+	probe := &KeyValueStore{}
+	for _, opt := range opts {
+		opt(probe)
+	}
+	if probe.backend != nil || probe.offload != nil || probe.records != nil {
+		log.Println("NewShardedKeyValueStore: Ignoring WithBackend, WithHistoryOffload and WithRecordPersister, which shards cannot share")
+	}
+	routes := make(map[string]string, len(shards)+len(probe.shardRoutes))
+	for prefix, filePath := range shards {
+		routes[prefix] = filePath
+	}
+	for prefix, filePath := range probe.shardRoutes {
+		routes[prefix] = filePath
+	}
+
+	newShard := func(filePath string) *KeyValueStore {
+		if !filepath.IsAbs(filePath) {
+			filePath = filepath.Join(baseDir, filePath)
+		}
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			log.Printf("NewShardedKeyValueStore: Failed to create shard directory: %v\n", err)
+		}
+		shardOpts := append(append([]Option(nil), opts...), withOwnStorage(filePath))
+		return NewKeyValueStore(filePath, nil, 0, defaultCleanupInterval, shardOpts...)
+	}
+
+	s := &ShardedKeyValueStore{defaultShard: newShard(defaultShardFile)}
+	for prefix, filePath := range routes {
+		s.shards = append(s.shards, shard{prefix: prefix, store: newShard(filePath)})
+	}
+	sort.Slice(s.shards, func(i, j int) bool {
+		if len(s.shards[i].prefix) != len(s.shards[j].prefix) {
+			return len(s.shards[i].prefix) > len(s.shards[j].prefix)
+		}
+		return s.shards[i].prefix < s.shards[j].prefix
+	})
+
+	log.Printf("NewShardedKeyValueStore: Created %d shards in %s\n", len(s.shards), baseDir)
+	return s
+}
+
+// withOwnStorage undoes the options naming a storage resource shared by every shard, persisting the
+// shard to filePath alone.
+func withOwnStorage(filePath string) Option {
+	return func(kv *KeyValueStore) {
+		kv.backend = NewFileBackend(filePath)
+		kv.offload = nil
+		kv.records = nil
+	}
+}
+
+// Shard returns the store holding key.
+func (s *ShardedKeyValueStore) Shard(key string) *KeyValueStore {
+	for _, sh := range s.shards {
+		if strings.HasPrefix(key, sh.prefix) {
+			return sh.store
+		}
+	}
+	return s.defaultShard
+}
+
+// stores returns every shard store, the default one last.
+func (s *ShardedKeyValueStore) stores() []*KeyValueStore {
+	stores := make([]*KeyValueStore, 0, len(s.shards)+1)
+	for _, sh := range s.shards {
+		stores = append(stores, sh.store)
+	}
+	return append(stores, s.defaultShard)
+}
+
+// Set sets a key-value pair in the key's shard.
+func (s *ShardedKeyValueStore) Set(key, value string, expiration time.Duration) error {
+	return s.Shard(key).Set(key, value, expiration)
+}
+
+// Get retrieves the latest value for a key from its shard.
+func (s *ShardedKeyValueStore) Get(key string) (string, error) {
+	return s.Shard(key).Get(key)
+}
+
+// GetWithTTL retrieves the latest value and remaining TTL for a key from its shard.
+func (s *ShardedKeyValueStore) GetWithTTL(key string) (string, time.Duration, error) {
+	return s.Shard(key).GetWithTTL(key)
+}
+
+// GetVersion retrieves a specific version of a key from its shard.
+func (s *ShardedKeyValueStore) GetVersion(key string, version int) (string, error) {
+	return s.Shard(key).GetVersion(key, version)
+}
+
+// GetAllVersions retrieves all versions of a key from its shard.
+func (s *ShardedKeyValueStore) GetAllVersions(key string) ([]string, error) {
+	return s.Shard(key).GetAllVersions(key)
+}
+
+// GetHistory retrieves the version history of a key from its shard.
+func (s *ShardedKeyValueStore) GetHistory(key string) ([]KeyValue, error) {
+	return s.Shard(key).GetHistory(key)
+}
+
+// RemoveVersion removes a specific version of a key from its shard.
+func (s *ShardedKeyValueStore) RemoveVersion(key string, version int) error {
+	return s.Shard(key).RemoveVersion(key, version)
+}
+
+// CompareAndSwap compares and swaps the value of a key in its shard.
+func (s *ShardedKeyValueStore) CompareAndSwap(key string, oldValue, newValue string, ttl time.Duration) (bool, error) {
+	return s.Shard(key).CompareAndSwap(key, oldValue, newValue, ttl)
+}
+
+// Delete removes a key from its shard.
+func (s *ShardedKeyValueStore) Delete(key string) error {
+	return s.Shard(key).Delete(key)
+}
+
+// Keys returns the keys of all shards.
+func (s *ShardedKeyValueStore) Keys() []string {
+	keys := make([]string, 0)
+	for _, kv := range s.stores() {
+		keys = append(keys, kv.Keys()...)
+	}
+	return keys
+}
+
+// Size returns the number of keys across all shards.
+func (s *ShardedKeyValueStore) Size() int {
+	size := 0
+	for _, kv := range s.stores() {
+		size += kv.Size()
+	}
+	return size
+}
+
+// Stop stops every shard, saving each to its own file.
+func (s *ShardedKeyValueStore) Stop() {
+	for _, kv := range s.stores() {
+		kv.Stop()
+	}
+}
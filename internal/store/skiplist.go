@@ -0,0 +1,180 @@
+package store
+
+import "math/rand"
+
+// Skiplist parameters, as in Redis: each level holds about a quarter of the nodes of the one below.
+const (
+	skiplistMaxLevel = 32
+	skiplistP        = 4
+)
+
+// skiplistNode is a member of a sorted set. Each level records the node it links to and how many nodes
+// the link skips, so ranks are found in logarithmic time.
+type skiplistNode struct {
+	member string
+	score  float64
+	levels []skiplistLevel
+}
+
+type skiplistLevel struct {
+	forward *skiplistNode
+	span    int
+}
+
+// skiplist orders the members of a sorted set by score, then by member for equal scores.
+type skiplist struct {
+	head   *skiplistNode
+	level  int
+	length int
+	scores map[string]float64
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:   &skiplistNode{levels: make([]skiplistLevel, skiplistMaxLevel)},
+		level:  1,
+		scores: make(map[string]float64),
+	}
+}
+
+// before reports whether n sorts before the member with the given score.
+func (n *skiplistNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+func randomSkiplistLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Intn(skiplistP) == 0 {
+		level++
+	}
+	return level
+}
+
+// set adds member with score, or moves it if it has another score, and reports whether it was added.
+func (s *skiplist) set(member string, score float64) bool {
+	old, exists := s.scores[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		s.remove(member)
+	}
+	s.insert(member, score)
+	return !exists
+}
+
+// insert adds a member that is not in the list.
+func (s *skiplist) insert(member string, score float64) {
+	var update [skiplistMaxLevel]*skiplistNode
+	var rank [skiplistMaxLevel]int
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		if i < s.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	level := randomSkiplistLevel()
+	for i := s.level; i < level; i++ {
+		rank[i] = 0
+		update[i] = s.head
+		update[i].levels[i].span = s.length
+	}
+	s.level = max(s.level, level)
+
+	node := &skiplistNode{member: member, score: score, levels: make([]skiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		node.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = node
+		node.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < s.level; i++ {
+		update[i].levels[i].span++
+	}
+	s.length++
+	s.scores[member] = score
+}
+
+// remove deletes member and reports whether it was in the list.
+func (s *skiplist) remove(member string) bool {
+	score, ok := s.scores[member]
+	if !ok {
+		return false
+	}
+	var update [skiplistMaxLevel]*skiplistNode
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+	node := x.levels[0].forward
+	for i := 0; i < s.level; i++ {
+		if update[i].levels[i].forward == node {
+			update[i].levels[i].span += node.levels[i].span - 1
+			update[i].levels[i].forward = node.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	for s.level > 1 && s.head.levels[s.level-1].forward == nil {
+		s.level--
+	}
+	s.length--
+	delete(s.scores, member)
+	return true
+}
+
+// rank returns the 0-based position of member, or -1 if it is not in the list.
+func (s *skiplist) rank(member string) int {
+	score, ok := s.scores[member]
+	if !ok {
+		return -1
+	}
+	rank := 0
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for f := x.levels[i].forward; f != nil && (f.before(score, member) || f.member == member); f = x.levels[i].forward {
+			rank += x.levels[i].span
+			x = f
+		}
+		if x.member == member && x != s.head {
+			return rank - 1
+		}
+	}
+	return -1
+}
+
+// byRank returns the node at the 0-based position rank, which must be within the list.
+func (s *skiplist) byRank(rank int) *skiplistNode {
+	traversed := 0
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank+1 {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank+1 {
+			return x
+		}
+	}
+	return nil
+}
+
+// firstFrom returns the first node with a score of at least min, or nil.
+func (s *skiplist) firstFrom(min float64) *skiplistNode {
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.score < min {
+			x = x.levels[i].forward
+		}
+	}
+	return x.levels[0].forward
+}
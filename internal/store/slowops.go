@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultSlowOpLogSize is how many slow operations are kept when SlowOpLogConfig.Size is zero.
+const defaultSlowOpLogSize = 256
+
+// SlowOpLogConfig configures the slow operation log.
+type SlowOpLogConfig struct {
+	Threshold time.Duration // Operations taking at least this long are recorded
+	Size      int           // Number of records kept, oldest evicted first
+	Log       bool          // Also log each slow operation as a warning
+}
+
+// SlowOp describes an operation that exceeded the slow operation threshold.
+type SlowOp struct {
+	Op        Op
+	Key       string
+	RequestID string // Request ID from the context, for operations called through a context-aware method
+	Start     time.Time
+	Duration  time.Duration
+	LockWait  time.Duration // Time spent waiting for the store lock
+	Exec      time.Duration // Duration minus LockWait
+	ValueSize int           // Size of the value read or written
+	LazyLoad  bool          // The operation waited for the store to be loaded
+	FaultIn   bool          // The operation restored offloaded history
+}
+
+// slowOpLog keeps the most recent slow operations in a ring.
+type slowOpLog struct {
+	threshold atomic.Int64
+	log       bool
+	mu        sync.Mutex
+	ops       []SlowOp
+	head      int
+}
+
+// newSlowOpLog creates a slow operation log from config.
+func newSlowOpLog(config SlowOpLogConfig) *slowOpLog {
+	size := config.Size
+	if size <= 0 {
+		size = defaultSlowOpLogSize
+	}
+	l := &slowOpLog{log: config.Log, ops: make([]SlowOp, 0, size)}
+	l.threshold.Store(int64(config.Threshold))
+	return l
+}
+
+// record adds op, evicting the oldest record when the log is full.
+func (l *slowOpLog) record(op SlowOp) {
+	l.mu.Lock()
+	if len(l.ops) < cap(l.ops) {
+		l.ops = append(l.ops, op)
+	} else {
+		l.ops[l.head] = op
+		l.head = (l.head + 1) % len(l.ops)
+	}
+	l.mu.Unlock()
+
+	if l.log {
+		log.Printf("WARN SlowOp: %s of '%s' took %v (lock wait %v, %d bytes, lazy load %t, fault-in %t, request %q)\n",
+			op.Op, op.Key, op.Duration, op.LockWait, op.ValueSize, op.LazyLoad, op.FaultIn, op.RequestID)
+	}
+}
+
+// opTrace times a single operation for the slow operation log. A nil trace records nothing.
+type opTrace struct {
+	log       *slowOpLog
+	op        SlowOp
+	lockStart time.Time
+}
+
+// traceOp starts timing op on key, or returns nil if the slow operation log is disabled.
+func (kv *KeyValueStore) traceOp(ctx context.Context, op Op, key string) *opTrace {
+	if kv.slowOps == nil {
+		return nil
+	}
+	requestID, _ := RequestIDFrom(ctx)
+	return &opTrace{
+		log: kv.slowOps,
+		op: SlowOp{
+			Op:        op,
+			Key:       key,
+			RequestID: requestID,
+			Start:     time.Now(),
+			LazyLoad:  !kv.loaded.Load(),
+		},
+	}
+}
+
+// waitingForLock marks the start of the lock acquisition.
+func (t *opTrace) waitingForLock() {
+	if t != nil {
+		t.lockStart = time.Now()
+	}
+}
+
+// lockAcquired marks the end of the lock acquisition.
+func (t *opTrace) lockAcquired() {
+	if t != nil {
+		t.op.LockWait += time.Since(t.lockStart)
+	}
+}
+
+// valueSize records the size of the value read or written.
+func (t *opTrace) valueSize(n int) {
+	if t != nil {
+		t.op.ValueSize = n
+	}
+}
+
+// faultedIn records whether offloaded history was restored.
+func (t *opTrace) faultedIn(restored bool) {
+	if t != nil {
+		t.op.FaultIn = t.op.FaultIn || restored
+	}
+}
+
+// finish records the operation if it took at least the threshold.
+func (t *opTrace) finish() {
+	if t == nil {
+		return
+	}
+	t.op.Duration = time.Since(t.op.Start)
+	if t.op.Duration < time.Duration(t.log.threshold.Load()) {
+		return
+	}
+	t.op.Exec = t.op.Duration - t.op.LockWait
+	t.log.record(t.op)
+}
+
+// SlowOps returns up to limit of the most recent slow operations, newest first; a limit of zero or less
+// returns them all. It is empty unless the store was created with WithSlowOpLog.
+func (kv *KeyValueStore) SlowOps(limit int) []SlowOp {
+	l := kv.slowOps
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := len(l.ops)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	ops := make([]SlowOp, 0, limit)
+	for i := 0; i < limit; i++ {
+		ops = append(ops, l.ops[(l.head+n-1-i)%n])
+	}
+	return ops
+}
+
+// SetSlowOpThreshold changes the threshold of the slow operation log at runtime. It does nothing unless
+// the store was created with WithSlowOpLog.
+func (kv *KeyValueStore) SetSlowOpThreshold(threshold time.Duration) {
+	if kv.slowOps != nil {
+		kv.slowOps.threshold.Store(int64(threshold))
+	}
+}
+
+// SlowOpThreshold returns the threshold of the slow operation log, or zero if it is disabled.
+func (kv *KeyValueStore) SlowOpThreshold() time.Duration {
+	if kv.slowOps == nil {
+		return 0
+	}
+	return time.Duration(kv.slowOps.threshold.Load())
+}
+
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying a request ID, recorded with slow operations.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFrom returns the request ID stored in ctx by WithRequestID.
+func RequestIDFrom(ctx context.Context) (string, bool) {
+	requestID, ok := ctx.Value(requestIDKey{}).(string)
+	return requestID, ok
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ErrInvalidScore is returned when a sorted set score is not a finite number.
+var ErrInvalidScore = errors.New("score is not a finite number")
+
+// maxCachedSortedSets bounds how many sorted sets keep their skiplist between operations.
+const maxCachedSortedSets = 64
+
+// A sorted set is stored as the JSON object of its members and scores, so it is persisted, versioned and
+// notified like any value. Operations run on a skiplist built from that value, which is cached for as long
+// as the stored value is the one it was built from, so reads by rank or score don't decode and sort the
+// whole set again.
+
+// ScoredMember is a member of a sorted set with its score.
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// sortedSetCache holds the skiplists of recently used sorted sets with the value they were built from.
+type sortedSetCache struct {
+	mu   sync.Mutex
+	sets map[string]cachedSortedSet
+}
+
+type cachedSortedSet struct {
+	value string
+	list  *skiplist
+}
+
+// getLocked returns the skiplist of the sorted set stored under key as value, building and caching it if
+// needed. The caller must hold c.mu for as long as it uses the skiplist.
+func (c *sortedSetCache) getLocked(key, value string) (*skiplist, error) {
+	if cached, ok := c.sets[key]; ok && cached.value == value {
+		return cached.list, nil
+	}
+	list, err := decodeSortedSet(key, value)
+	if err != nil {
+		return nil, err
+	}
+	c.putLocked(key, value, list)
+	return list, nil
+}
+
+// take removes the skiplist of the sorted set stored under key as value from the cache, so the caller may
+// modify it, building one if it was not cached.
+func (c *sortedSetCache) take(key, value string, found bool) (*skiplist, error) {
+	if !found {
+		return newSkiplist(), nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.sets[key]; ok && cached.value == value {
+		delete(c.sets, key)
+		return cached.list, nil
+	}
+	return decodeSortedSet(key, value)
+}
+
+// put caches the skiplist of the sorted set stored under key as value.
+func (c *sortedSetCache) put(key, value string, list *skiplist) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.putLocked(key, value, list)
+}
+
+func (c *sortedSetCache) putLocked(key, value string, list *skiplist) {
+	if c.sets == nil {
+		c.sets = make(map[string]cachedSortedSet)
+	}
+	if _, ok := c.sets[key]; !ok && len(c.sets) >= maxCachedSortedSets {
+		for evicted := range c.sets {
+			delete(c.sets, evicted)
+			break
+		}
+	}
+	c.sets[key] = cachedSortedSet{value: value, list: list}
+}
+
+// decodeSortedSet builds the skiplist of the sorted set stored under key.
+func decodeSortedSet(key, value string) (*skiplist, error) {
+	var scores map[string]float64
+	if err := json.Unmarshal([]byte(value), &scores); err != nil || scores == nil {
+		return nil, fmt.Errorf("key '%s' is not a sorted set: %w", key, ErrWrongType)
+	}
+	list := newSkiplist()
+	for member, score := range scores {
+		list.insert(member, score)
+	}
+	return list, nil
+}
+
+// checkScore returns ErrInvalidScore for NaN and infinities, which JSON cannot hold.
+func checkScore(member string, score float64) error {
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return fmt.Errorf("member '%s' scored %v: %w", member, score, ErrInvalidScore)
+	}
+	return nil
+}
+
+// readSortedSet calls read with the skiplist of the sorted set stored under key, which is empty if the key
+// does not exist. read must not keep the skiplist.
+func (kv *KeyValueStore) readSortedSet(key string, read func(list *skiplist)) error {
+	values, _, err := kv.GetManyConsistent([]string{key})
+	if err != nil {
+		return err
+	}
+	info, found := values[key]
+	if !found {
+		read(newSkiplist())
+		return nil
+	}
+	kv.sortedSets.mu.Lock()
+	defer kv.sortedSets.mu.Unlock()
+	list, err := kv.sortedSets.getLocked(key, info.Value)
+	if err != nil {
+		return err
+	}
+	read(list)
+	return nil
+}
+
+// updateSortedSet applies modify to the skiplist of the sorted set stored under key and stores the result,
+// deleting the key when the set becomes empty. The key keeps its TTL.
+func (kv *KeyValueStore) updateSortedSet(key string, modify func(list *skiplist) error) error {
+	var list *skiplist
+	var stored string
+	_, _, err := kv.readModifyWrite(key, true, func(current string, found bool) (string, bool, error) {
+		var err error
+		if list, err = kv.sortedSets.take(key, current, found); err != nil {
+			return "", false, err
+		}
+		if err := modify(list); err != nil {
+			list = nil
+			return "", false, err
+		}
+		if list.length == 0 {
+			return "", true, nil
+		}
+		data, err := json.Marshal(list.scores)
+		if err != nil {
+			return "", false, err
+		}
+		stored = string(data)
+		return stored, false, nil
+	})
+	if err == nil && list.length > 0 {
+		kv.sortedSets.put(key, stored, list)
+	}
+	return err
+}
+
+// ZAdd sets the scores of members of the sorted set stored under key, creating it if needed, and returns
+// how many members were new.
+func (kv *KeyValueStore) ZAdd(key string, members map[string]float64) (int, error) {
+	for member, score := range members {
+		if err := checkScore(member, score); err != nil {
+			return 0, err
+		}
+	}
+	var added int
+	err := kv.updateSortedSet(key, func(list *skiplist) error {
+		added = 0
+		for member, score := range members {
+			if list.set(member, score) {
+				added++
+			}
+		}
+		return nil
+	})
+	return added, err
+}
+
+// ZIncrBy adds delta to the score of member in the sorted set stored under key, adding the member with
+// score delta if needed, and returns its new score.
+func (kv *KeyValueStore) ZIncrBy(key, member string, delta float64) (float64, error) {
+	var score float64
+	err := kv.updateSortedSet(key, func(list *skiplist) error {
+		score = list.scores[member] + delta
+		if err := checkScore(member, score); err != nil {
+			return err
+		}
+		list.set(member, score)
+		return nil
+	})
+	return score, err
+}
+
+// ZRange returns the members of the sorted set stored under key from rank start to stop, both included,
+// lowest score first. Negative ranks count from the highest score, -1 being the last member, so
+// ZRange(key, -10, -1) is a top ten in ascending order. A key that does not exist is an empty set.
+func (kv *KeyValueStore) ZRange(key string, start, stop int) ([]ScoredMember, error) {
+	members := []ScoredMember{}
+	err := kv.readSortedSet(key, func(list *skiplist) {
+		n := list.length
+		if start < 0 {
+			start = max(n+start, 0)
+		}
+		if stop < 0 {
+			stop = n + stop
+		}
+		stop = min(stop, n-1)
+		if start > stop {
+			return
+		}
+		for x := list.byRank(start); x != nil && len(members) <= stop-start; x = x.levels[0].forward {
+			members = append(members, ScoredMember{Member: x.member, Score: x.score})
+		}
+	})
+	return members, err
+}
+
+// ZRangeByScore returns the members of the sorted set stored under key with a score from min to max,
+// both included, lowest score first.
+func (kv *KeyValueStore) ZRangeByScore(key string, min, max float64) ([]ScoredMember, error) {
+	members := []ScoredMember{}
+	err := kv.readSortedSet(key, func(list *skiplist) {
+		for x := list.firstFrom(min); x != nil && x.score <= max; x = x.levels[0].forward {
+			members = append(members, ScoredMember{Member: x.member, Score: x.score})
+		}
+	})
+	return members, err
+}
+
+// ZRank returns the 0-based rank of member in the sorted set stored under key, lowest score first. It
+// returns ErrKeyNotFound if the key or the member does not exist.
+func (kv *KeyValueStore) ZRank(key, member string) (int, error) {
+	rank := -1
+	err := kv.readSortedSet(key, func(list *skiplist) {
+		rank = list.rank(member)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if rank < 0 {
+		return 0, fmt.Errorf("member '%s' of key '%s': %w", member, key, ErrKeyNotFound)
+	}
+	return rank, nil
+}
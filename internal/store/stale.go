@@ -0,0 +1,323 @@
+package store
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// staleCheckInterval is how often the stale read loop checks whether its snapshot is due for a refresh.
+const staleCheckInterval = 10 * time.Millisecond
+
+// ErrStaleReadsDisabled is returned by the stale read methods of a store created without WithStaleReads.
+var ErrStaleReadsDisabled = errors.New("stale reads not enabled")
+
+// StaleStats describes the snapshot served by GetStale and KeysStale.
+type StaleStats struct {
+	Enabled   bool
+	Age       time.Duration // Time since the snapshot was taken
+	Keys      int           // Keys in the snapshot
+	Lag       uint64        // Mutations since the snapshot was taken
+	Refreshes uint64        // Snapshots taken since the store was created
+	Rebuilds  uint64        // Refreshes that read every key rather than those changed since the last
+}
+
+// staleEntry is the latest value of a key as of a snapshot.
+type staleEntry struct {
+	value     string
+	expiresAt time.Time // Zero if the key does not expire
+}
+
+// staleSnapshot is an immutable copy of the latest value of every key. Values are shared with the
+// store rather than copied, so a snapshot costs its map and key list only, and the key list is shared
+// with the previous snapshot while no key is added or removed.
+type staleSnapshot struct {
+	entries map[string]staleEntry
+	keys    []string // Sorted
+	seq     uint64   // globalSeq when the snapshot was taken
+	taken   time.Time
+}
+
+// staleReads publishes snapshots of the store that are read without taking the store lock. Writers
+// record the keys they change, so a refresh only reads those under the store lock.
+type staleReads struct {
+	maxAge    time.Duration
+	threshold uint64 // Mutations after which the snapshot is refreshed early; zero to refresh on age only
+	refreshMu sync.Mutex
+	current   atomic.Pointer[staleSnapshot]
+	refreshes atomic.Uint64
+	rebuilds  atomic.Uint64
+
+	mu      sync.Mutex
+	changed map[string]struct{} // Keys changed since the snapshot was taken
+	rebuild bool                // The store was replaced wholesale, so every key must be read
+}
+
+// mark records a change to key. The caller must hold the write lock.
+func (s *staleReads) mark(key string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.rebuild {
+		if s.changed == nil {
+			s.changed = make(map[string]struct{})
+		}
+		s.changed[key] = struct{}{}
+	}
+	s.mu.Unlock()
+}
+
+// reset makes the next refresh read every key, such as after the contents of the store are replaced.
+// The caller must hold the write lock.
+func (s *staleReads) reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.changed, s.rebuild = nil, true
+	s.mu.Unlock()
+}
+
+// take returns the keys changed since the last refresh, or true if every key must be read, and starts
+// recording changes for the next one. The caller must hold the lock.
+func (s *staleReads) take() (map[string]struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed, rebuild := s.changed, s.rebuild
+	s.changed, s.rebuild = nil, false
+	return changed, rebuild
+}
+
+// checkEvery returns how often the loop checks the snapshot.
+func (s *staleReads) checkEvery() time.Duration {
+	if s.maxAge < staleCheckInterval {
+		return s.maxAge
+	}
+	return staleCheckInterval
+}
+
+// due reports whether the snapshot should be replaced, given the current mutation sequence.
+func (s *staleReads) due(seq uint64) bool {
+	snap := s.current.Load()
+	if snap == nil {
+		return true
+	}
+	if time.Since(snap.taken) >= s.maxAge {
+		return true
+	}
+	return s.threshold > 0 && seq-snap.seq >= s.threshold
+}
+
+// maintainStaleReads refreshes the snapshot whenever it is due, once the store has been loaded.
+func (kv *KeyValueStore) maintainStaleReads(s *staleReads, beat func() bool) {
+	ticker := time.NewTicker(s.checkEvery())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !beat() {
+				return
+			}
+			kv.injectLoopFault(ComponentStaleReads)
+			if kv.loaded.Load() && s.due(kv.globalSeq.Load()) {
+				kv.refreshStale(s)
+			}
+		case <-kv.stopChan:
+			return
+		}
+	}
+}
+
+// refreshStale publishes a new snapshot. The read lock is held only while the keys changed since the
+// previous snapshot are read; the first snapshot, and the first after the store is replaced, read every key.
+// The previous snapshot is copied and the key list sorted after the lock is released.
+func (kv *KeyValueStore) refreshStale(s *staleReads) *staleSnapshot {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	prev := s.current.Load()
+	kv.RLock()
+	changed, rebuild := s.take()
+	if prev == nil || rebuild {
+		snap := kv.scanStaleLocked()
+		kv.RUnlock()
+		s.rebuilds.Add(1)
+		return s.publish(snap, nil)
+	}
+	seq := kv.globalSeq.Load()
+	live := make(map[string]staleEntry, len(changed))
+	for key := range changed {
+		if entry, ok := kv.staleEntryLocked(key); ok {
+			live[key] = entry
+		}
+	}
+	kv.RUnlock()
+
+	snap := &staleSnapshot{entries: prev.entries, keys: prev.keys, seq: seq, taken: time.Now()}
+	if len(changed) == 0 {
+		return s.publish(snap, prev.keys)
+	}
+	snap.entries = make(map[string]staleEntry, len(prev.entries)+len(live))
+	for key, entry := range prev.entries {
+		snap.entries[key] = entry
+	}
+	sameKeys := true
+	for key := range changed {
+		_, had := snap.entries[key]
+		if entry, ok := live[key]; ok {
+			snap.entries[key] = entry
+			sameKeys = sameKeys && had
+		} else if had {
+			delete(snap.entries, key)
+			sameKeys = false
+		}
+	}
+	if sameKeys {
+		return s.publish(snap, prev.keys)
+	}
+	return s.publish(snap, nil)
+}
+
+// scanStaleLocked takes a snapshot of every key. The caller must hold the lock.
+func (kv *KeyValueStore) scanStaleLocked() *staleSnapshot {
+	snap := &staleSnapshot{
+		entries: make(map[string]staleEntry, len(kv.data)+len(kv.pending)),
+		seq:     kv.globalSeq.Load(),
+		taken:   time.Now(),
+	}
+	for key := range kv.data {
+		if entry, ok := kv.staleEntryLocked(key); ok {
+			snap.entries[key] = entry
+		}
+	}
+	for _, key := range kv.pendingKeysLocked() {
+		snap.entries[key], _ = kv.staleEntryLocked(key)
+	}
+	return snap
+}
+
+// staleEntryLocked returns the latest value of key and its expiration, or false if the key does not exist.
+// Like Get, it serves a value still held in a coalescing window. The caller must hold the lock.
+func (kv *KeyValueStore) staleEntryLocked(key string) (staleEntry, bool) {
+	if p, ok := kv.pending[key]; ok {
+		return staleEntry{value: p.value, expiresAt: kv.expirations[key]}, true
+	}
+	versions := kv.data[key]
+	if len(versions) == 0 {
+		return staleEntry{}, false
+	}
+	return staleEntry{value: versions[len(versions)-1].Value, expiresAt: kv.expirations[key]}, true
+}
+
+// publish makes snap the current snapshot, with keys as its key list, or its sorted keys if keys is nil.
+func (s *staleReads) publish(snap *staleSnapshot, keys []string) *staleSnapshot {
+	if keys == nil {
+		keys = make([]string, 0, len(snap.entries))
+		for key := range snap.entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+	snap.keys = keys
+	s.current.Store(snap)
+	s.refreshes.Add(1)
+	return snap
+}
+
+// staleSnapshot returns the current snapshot, taking the first one if none has been taken yet.
+func (kv *KeyValueStore) staleSnapshot() (*staleSnapshot, error) {
+	if kv.staleReads == nil {
+		return nil, ErrStaleReadsDisabled
+	}
+	if snap := kv.staleReads.current.Load(); snap != nil {
+		return snap, nil
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return nil, err
+	}
+	return kv.refreshStale(kv.staleReads), nil
+}
+
+// GetStale returns the latest value of key as of the stale read snapshot, along with the snapshot's age.
+// It never takes the store lock, so it neither waits for writers nor delays them.
+func (kv *KeyValueStore) GetStale(key string) (string, time.Duration, error) {
+	snap, err := kv.staleSnapshot()
+	if err != nil {
+		return "", 0, err
+	}
+	age := time.Since(snap.taken)
+
+	entry, ok := snap.entries[key]
+	if !ok {
+		return "", age, ErrKeyNotFound
+	}
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		return "", age, ErrKeyExpired
+	}
+	return entry.value, age, nil
+}
+
+// KeysStale returns the unexpired keys starting with prefix, in order, as of the stale read snapshot,
+// along with the snapshot's age.
+func (kv *KeyValueStore) KeysStale(prefix string) ([]string, time.Duration, error) {
+	snap, err := kv.staleSnapshot()
+	if err != nil {
+		return nil, 0, err
+	}
+	age := time.Since(snap.taken)
+
+	now := time.Now()
+	var keys []string
+	for i := sort.SearchStrings(snap.keys, prefix); i < len(snap.keys) && strings.HasPrefix(snap.keys[i], prefix); i++ {
+		if exp := snap.entries[snap.keys[i]].expiresAt; !exp.IsZero() && now.After(exp) {
+			continue
+		}
+		keys = append(keys, snap.keys[i])
+	}
+	return keys, age, nil
+}
+
+// GetAllowStale returns the value of key from the stale read snapshot if it is no older than maxStale,
+// and otherwise reads it like Get.
+func (kv *KeyValueStore) GetAllowStale(key string, maxStale time.Duration) (string, error) {
+	if kv.staleReads != nil {
+		if snap := kv.staleReads.current.Load(); snap != nil && time.Since(snap.taken) <= maxStale {
+			value, _, err := kv.GetStale(key)
+			return value, err
+		}
+	}
+	return kv.Get(key)
+}
+
+// RefreshStale replaces the stale read snapshot with the current contents of the store.
+func (kv *KeyValueStore) RefreshStale() error {
+	if kv.staleReads == nil {
+		return ErrStaleReadsDisabled
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return err
+	}
+	snap := kv.refreshStale(kv.staleReads)
+	log.Printf("RefreshStale: Snapshot of %d keys taken\n", len(snap.keys))
+	return nil
+}
+
+// StaleStats returns the age and size of the stale read snapshot.
+func (kv *KeyValueStore) StaleStats() StaleStats {
+	if kv.staleReads == nil {
+		return StaleStats{}
+	}
+	stats := StaleStats{Enabled: true, Refreshes: kv.staleReads.refreshes.Load(), Rebuilds: kv.staleReads.rebuilds.Load()}
+	if snap := kv.staleReads.current.Load(); snap != nil {
+		stats.Age = time.Since(snap.taken)
+		stats.Keys = len(snap.keys)
+		stats.Lag = kv.globalSeq.Load() - snap.seq
+	}
+	return stats
+}
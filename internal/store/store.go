@@ -1,20 +1,43 @@
 package store
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// defaultCleanupInterval is the cleanup interval of stores created without an explicit one.
+const defaultCleanupInterval = 1 * time.Minute
+
+// NoExpiration is the remaining TTL reported for keys that never expire.
+const NoExpiration time.Duration = -1
+
+// Errors returned for missing or expired keys and versions.
+var (
+	ErrKeyNotFound     = errors.New("key not found")
+	ErrVersionNotFound = errors.New("version not found")
+	ErrKeyExpired      = errors.New("key expired")
+)
+
 // KeyValue represents a key-value pair with a timestamp.
 type KeyValue struct {
 	Value     string
 	Timestamp time.Time
+	Collapsed int    `json:",omitempty"` // Writes replaced by this version within a coalescing window
+	Encoding  string `json:",omitempty"` // Content encoding of Value, as recorded by SetWithEncoding
+	Delta     bool   `json:",omitempty"` // Value is a delta against the next version, see WithDeltaVersions
+	Ref       string `json:",omitempty"` // SHA-256 of the pooled value replacing Value in snapshots, see WithValueDeduplication
+	Binary    bool   `json:",omitempty"` // Value is the base64 of a value that is not valid UTF-8, in snapshots only
+	Revision  uint64 `json:",omitempty"` // Revision of the key while this is its latest version, see ValueInfo.Revision
 }
 
 // KeyValueStore represents a simple key-value store with support for TTL, persistence, and encryption.
@@ -22,50 +45,321 @@ type KeyValueStore struct {
 	sync.RWMutex
 	data           map[string][]KeyValue
 	expirations    map[string]time.Time
-	filePath       string
+	expiryQueue    expiryQueue
+	backend        StorageBackend
 	encryptionKey  []byte
 	stopChan       chan struct{}
-	cleanupStopped chan struct{}
 	stopOnce       sync.Once
 	globalTTL      time.Duration
-	loaded         bool
+	tickerInterval time.Duration
+	loaded         atomic.Bool
+	backgroundWG   sync.WaitGroup
+	supervisor     *supervisor
+	supervision    SupervisorPolicy
+	historyAudit   *historyAudit
+	hotKeys        *hotKeyDetector
+	faults         *FaultInjector
+	offload        *historyOffload
+	keyIndex       *keyIndex
+	prefixIndex    *prefixIndex
+	contention     *lockProfiler
+	shardRoutes    map[string]string
+	memoryWatchdog *memoryWatchdog
+	preWriteHooks  preWriteHooks
+	coalesceRules  []coalesceRule
+	pending        map[string]*pendingWrite
+	pendingGen     uint64 // Number of the latest coalescing window
+	records        RecordPersister
+	maintenance    maintenance
+	listings       *keyListings
+	keySecret      []byte // HMAC secret for persisted key names; nil persists keys as is
+	precision      *precisionExpiry
+	tuning         TuningConfig
+	tuningProfile  string
+	tuned          map[string]bool
+	authorizer     Authorizer
+	commits        *groupCommit
+	commitDelay    time.Duration
+	events         *eventLog
+	slowOps        *slowOpLog
+	deltaRules     []deltaRule
+	retentionRules []retentionRule
+	jobs           *jobManager
+	computed       computedKeys
+	newTicker      TickerFunc
+	mustEncrypt    bool
+	staleReads     *staleReads
+	backups        backupTracker
+	sortedSets     sortedSetCache
+	announceOwner  bool
+	ownerFile      string // Owner file written by WithOwnerFile, removed on Stop
+	ownerErr       error
+	valuePool      *valuePool
+	ioStats        *ioAccounting
+	ampCeiling     *amplificationCeiling
+	migrations     []Migration
+	autoRenew      *autoRenew
+	passive        bool
+	autosave       *adaptiveAutosave
+	valueGrowth    *valueGrowth
+	immutable      atomic.Pointer[map[string]string] // Immutable keys and their values, read without the lock
+	recordsDirty   atomic.Bool
+	strictLoad     bool
+	dedupeOnLoad   bool
+	loadReport     LoadReport
+
+	// encryptionContext is bound to ciphertexts as GCM associated data.
+	encryptionContext []byte
+
+	// globalSeq is incremented on every mutation so notification events can be ordered reliably.
+	globalSeq atomic.Uint64
+
+	// revision is the latest revision given to a version, see nextRevision.
+	revision atomic.Uint64
 
 	// Notification Manager
 	notificationManager *NotificationManager
+	deliveryWorkers     int // Delivery workers per subscription, see WithDeliveryWorkers
 }
 
 // NewKeyValueStore creates a new KeyValueStore instance without loading data initially.
-func NewKeyValueStore(filePath string, encryptionKey []byte, globalTTL time.Duration, tickerInterval time.Duration) *KeyValueStore {
+func NewKeyValueStore(filePath string, encryptionKey []byte, globalTTL time.Duration, tickerInterval time.Duration, opts ...Option) *KeyValueStore {
 	kv := &KeyValueStore{
-		data:                make(map[string][]KeyValue),
-		expirations:         make(map[string]time.Time),
-		filePath:            filePath,
-		encryptionKey:       encryptionKey,
-		stopChan:            make(chan struct{}),
-		cleanupStopped:      make(chan struct{}),
-		globalTTL:           globalTTL,
-		notificationManager: NewNotificationManager(),
+		data:           make(map[string][]KeyValue),
+		expirations:    make(map[string]time.Time),
+		pending:        make(map[string]*pendingWrite),
+		listings:       newKeyListings(defaultListingTTL, defaultMaxListings, defaultMaxListingKeys),
+		backend:        NewFileBackend(filePath),
+		encryptionKey:  encryptionKey,
+		stopChan:       make(chan struct{}),
+		globalTTL:      globalTTL,
+		tickerInterval: tickerInterval,
+		supervision:    DefaultSupervisorPolicy,
+		tuning:         defaultTuning(tickerInterval),
+		commitDelay:    defaultCommitDelay,
+		events:         newEventLog(defaultEventLogSize),
+		jobs:           newJobManager(),
+		newTicker:      defaultTicker,
+		ioStats:        newIOAccounting(),
+	}
+	if tickerInterval > 0 {
+		kv.markTuned(tunedCleanupInterval)
+	}
+
+	for _, opt := range opts {
+		opt(kv)
+	}
+	kv.resolveTuning()
+	kv.commits = newGroupCommit(kv.commitDelay)
+	if kv.records != nil {
+		kv.records = countingPersister{RecordPersister: kv.records, io: kv.ioStats}
+	}
+	if kv.announceOwner {
+		if err := kv.announceOwnership(); err != nil {
+			log.Printf("NewKeyValueStore: Not announcing ownership: %v\n", err)
+			kv.ownerErr = err
+		}
+	}
+	kv.notificationManager = newNotificationManager(kv.tuning.NotificationQueue, kv.tuning.SubscriptionBuffer)
+	kv.notificationManager.events = kv.events
+	if kv.deliveryWorkers > 0 {
+		kv.notificationManager.workers = kv.deliveryWorkers
 	}
 
 	// Lazy loading: Data will be loaded only when needed
 	log.Println("NewKeyValueStore: Instance created, lazy loading enabled.")
 
-	go kv.cleanupExpiredItems(tickerInterval)
+	// Background loops run under a supervisor that restarts them if they die or stall.
+	kv.supervisor = newSupervisor(kv.supervision, kv.stopChan, &kv.backgroundWG, kv.notificationManager.Notify)
+	if kv.passive {
+		// Passive stores start no loops; notifications are delivered by the goroutine sending them.
+		kv.notificationManager.inline = true
+		kv.autoRenew = nil
+		return kv
+	}
+	nm := kv.notificationManager
+	// The notification loop outlives Stop, as events may still be sent after it.
+	kv.supervisor.add(ComponentNotifications, listenHeartbeat, false, func(beat func() bool) {
+		nm.listen(beat, func() { kv.injectLoopFault(ComponentNotifications) })
+	})
+	kv.supervisor.add(ComponentCleanup, kv.tickerInterval, true, func(beat func() bool) {
+		kv.cleanupExpiredItems(kv.tickerInterval, beat)
+	})
+	if kv.historyAudit != nil {
+		kv.supervisor.add(ComponentHistoryAudit, kv.historyAudit.interval, true, func(beat func() bool) {
+			kv.auditVersionHistories(kv.historyAudit, beat)
+		})
+	}
+	if kv.memoryWatchdog != nil {
+		kv.supervisor.add(ComponentMemoryWatchdog, kv.memoryWatchdog.interval, true, func(beat func() bool) {
+			kv.watchMemory(kv.memoryWatchdog, beat)
+		})
+	}
+	if kv.staleReads != nil {
+		kv.supervisor.add(ComponentStaleReads, kv.staleReads.checkEvery(), true, func(beat func() bool) {
+			kv.maintainStaleReads(kv.staleReads, beat)
+		})
+	}
+	if kv.autoRenew != nil {
+		a := kv.autoRenew
+		kv.supervisor.add(ComponentAutoRenew, listenHeartbeat, true, func(beat func() bool) {
+			kv.renewHotKeys(a, beat)
+		})
+	}
+	if kv.autosave != nil {
+		a := kv.autosave
+		kv.supervisor.add(ComponentAutosave, a.config.MaxInterval, true, func(beat func() bool) {
+			kv.autosaveLoop(a, beat)
+		})
+	}
+	if kv.ampCeiling != nil {
+		kv.supervisor.add(ComponentWriteAmplification, kv.ampCeiling.window, true, func(beat func() bool) {
+			kv.watchWriteAmplification(kv.ampCeiling, beat)
+		})
+	}
+	kv.backgroundWG.Add(1)
+	go kv.supervisor.watch()
 
 	return kv
 }
 
-func (kv *KeyValueStore) RegisterNotificationListener(listener func(string)) {
-	kv.notificationManager.RegisterListener(listener)
+// NewPassive creates a KeyValueStore running no goroutines, as set up by WithNoBackground. It persists to
+// a MemoryBackend unless WithBackend is given; WithEncryptionKey and WithGlobalTTL configure the rest.
+func NewPassive(opts ...Option) *KeyValueStore {
+	return NewKeyValueStore("", nil, 0, 0, append([]Option{WithBackend(NewMemoryBackend()), WithNoBackground()}, opts...)...)
+}
+
+// New creates a KeyValueStore persisting to filePath and configured by options alone, such as
+// WithEncryptionKey, WithGlobalTTL, WithCleanupInterval (a minute if not given), WithCompressionLevel and
+// WithAutoSave. It loads data lazily like NewKeyValueStore.
+func New(filePath string, opts ...Option) *KeyValueStore {
+	return NewKeyValueStore(filePath, nil, 0, defaultCleanupInterval, opts...)
+}
+
+// Open is New returning configuration errors like OpenKeyValueStore.
+func Open(filePath string, opts ...Option) (*KeyValueStore, error) {
+	return OpenKeyValueStore(filePath, nil, 0, defaultCleanupInterval, opts...)
+}
+
+// OpenKeyValueStore is NewKeyValueStore returning configuration errors, such as RequireEncryption without a valid
+// key or WithOwnerFile on a data file another process owns, instead of deferring them to the first load.
+func OpenKeyValueStore(filePath string, encryptionKey []byte, globalTTL time.Duration, tickerInterval time.Duration, opts ...Option) (*KeyValueStore, error) {
+	kv := NewKeyValueStore(filePath, encryptionKey, globalTTL, tickerInterval, opts...)
+	if err := kv.checkEncryption(); err != nil {
+		kv.Stop()
+		return nil, err
+	}
+	if kv.ownerErr != nil {
+		kv.Stop()
+		return nil, kv.ownerErr
+	}
+	return kv, nil
+}
+
+// NewKeyValueStoreFromReader creates a KeyValueStore loaded from data in the persisted format read from r.
+// The store persists to a MemoryBackend unless WithBackend is given.
+func NewKeyValueStoreFromReader(r io.Reader, encryptionKey []byte, opts ...Option) (*KeyValueStore, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading data: %v", err)
+	}
+
+	opts = append([]Option{WithBackend(NewMemoryBackend())}, opts...)
+	kv, err := OpenKeyValueStore("", encryptionKey, 0, defaultCleanupInterval, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	kv.Lock()
+	err = kv.install(data, time.Now())
+	kv.Unlock()
+	if err != nil {
+		kv.Stop()
+		return nil, err
+	}
+
+	return kv, nil
+}
+
+// LastSequence returns the sequence number of the most recent mutation, including those before the
+// store was last loaded.
+func (kv *KeyValueStore) LastSequence() uint64 {
+	if err := kv.ensureLoaded(); err != nil {
+		log.Printf("LastSequence: Data not loaded: %v\n", err)
+	}
+	return kv.globalSeq.Load()
+}
+
+func (kv *KeyValueStore) RegisterNotificationListener(listener func(string)) int {
+	return kv.notificationManager.RegisterListener(listener)
+}
+
+// RegisterNotificationListenerForKey registers a listener for the events of key only, such as "updated:k@7"
+// but not the events of "k2". It returns the subscription's ID for Unsubscribe.
+func (kv *KeyValueStore) RegisterNotificationListenerForKey(key string, listener func(string)) int {
+	return kv.notificationManager.SubscribeKey(key, 0, listener)
+}
+
+// RegisterNotificationListenerForPrefix registers a listener for the events of keys starting with prefix.
+// It returns the subscription's ID for Unsubscribe.
+func (kv *KeyValueStore) RegisterNotificationListenerForPrefix(prefix string, listener func(string)) int {
+	return kv.notificationManager.SubscribePrefix(prefix, 0, listener)
+}
+
+// Subscribe registers a notification listener for events matching filter with its own queue of buffer events.
+func (kv *KeyValueStore) Subscribe(filter string, buffer int, listener func(string)) int {
+	return kv.notificationManager.Subscribe(filter, buffer, listener)
+}
+
+// SubscribeFiltered registers a listener for the store's events passing filter, evaluated before events are
+// queued so excluded events cost the subscription nothing. It returns the subscription's ID.
+func (kv *KeyValueStore) SubscribeFiltered(filter EventFilter, buffer int, listener func(string)) int {
+	return kv.notificationManager.SubscribeFiltered(filter, buffer, listener)
+}
+
+// SubscribeEvents registers a listener receiving the store's events passing filter as Event values, carrying
+// the old and new values of key events instead of text to parse. It returns the subscription's ID.
+func (kv *KeyValueStore) SubscribeEvents(filter EventFilter, buffer int, listener func(Event)) int {
+	return kv.notificationManager.SubscribeEvents(filter, buffer, listener)
+}
+
+// Unsubscribe removes the notification subscription with the given ID and reports whether it existed.
+func (kv *KeyValueStore) Unsubscribe(id int) bool {
+	return kv.notificationManager.Unsubscribe(id)
+}
+
+// Notify sends event to the notification subscribers, for packages building on the store.
+func (kv *KeyValueStore) Notify(event string) {
+	kv.notificationManager.Notify(event)
+}
+
+// Subscriptions returns the registered notification subscriptions with their delivery statistics.
+func (kv *KeyValueStore) Subscriptions() []SubscriptionInfo {
+	return kv.notificationManager.Subscriptions()
+}
+
+// DeregisterAllSubscriptions removes every notification subscription.
+func (kv *KeyValueStore) DeregisterAllSubscriptions() {
+	kv.notificationManager.DeregisterAllSubscriptions()
 }
 
 // Stop stops the KeyValueStore instance and saves the data to the file.
 func (kv *KeyValueStore) Stop() {
 	kv.stopOnce.Do(func() {
+		// The owner file goes last, so tools waiting for it to disappear find the final save.
+		defer kv.releaseOwnership()
+		kv.jobs.stop()
 		if kv.stopChan != nil {
 			close(kv.stopChan)
-			<-kv.cleanupStopped
+			kv.backgroundWG.Wait()
+		}
+		if !kv.Loaded() {
+			// Nothing was loaded, so saving would overwrite the file with an empty store.
+			log.Println("Stop: Data not loaded, skipping save")
+			return
 		}
+		kv.flushAllPending()
+		kv.stopPrecisionTimers()
 		if err := kv.save(); err != nil {
 			log.Printf("Failed to save data: %v\n", err)
 		}
@@ -74,132 +368,537 @@ func (kv *KeyValueStore) Stop() {
 
 // Set sets a key-value pair in the store with an optional TTL.
 func (kv *KeyValueStore) Set(key, value string, expiration time.Duration) error {
+	if err := kv.set(context.Background(), key, value, expiration); err != nil {
+		return err
+	}
+	kv.commits.asyncWrites.Add(1)
+	return nil
+}
+
+// set implements Set, SetContext and SetDurable.
+func (kv *KeyValueStore) set(ctx context.Context, key, value string, expiration time.Duration) error {
+	trace := kv.traceOp(ctx, OpSet, key)
+	defer trace.finish()
+	trace.valueSize(len(value))
+
 	if err := kv.ensureLoaded(); err != nil {
 		return err
 	}
+	if err := kv.admitMutation(); err != nil {
+		return err
+	}
+	key, value, err := kv.applyPreWriteHooks(key, value)
+	if err != nil {
+		return err
+	}
+	if err := kv.checkComputed(ctx, key); err != nil {
+		return err
+	}
+	kv.recordAccess(key)
+	kv.touchHistory(key)
+	if err := kv.admitWrite(); err != nil {
+		return err
+	}
+	if err := kv.injectFault(OpSet, key); err != nil {
+		return err
+	}
 
-	now := time.Now()
+	trace.waitingForLock()
+	acquired := kv.lockWrite(OpSet)
+	trace.lockAcquired()
+	defer kv.unlockWrite(OpSet, acquired)
 
-	kv.RLock()
-	_, exists := kv.data[key]
-	kv.RUnlock()
+	// The key may have been frozen while the write waited for the lock.
+	if err := kv.checkMutable(key); err != nil {
+		return err
+	}
+	kv.writeLocked(key, value, expiration)
+	return nil
+}
 
-	kv.Lock()
-	defer kv.Unlock()
+// setLocked appends a new version of key, applies its TTL and sends the add or update notification.
+// It reports whether the key was created. The caller must hold the write lock.
+func (kv *KeyValueStore) setLocked(key, value string, expiration time.Duration) bool {
+	return kv.appendLocked(key, KeyValue{Value: value, Timestamp: time.Now()}, expiration)
+}
 
-	if !exists {
-		kv.data[key] = []KeyValue{}
+// appendLocked is setLocked for a prepared version. The caller must hold the write lock.
+func (kv *KeyValueStore) appendLocked(key string, version KeyValue, expiration time.Duration) bool {
+	return kv.appendUntilLocked(key, version, kv.expiryAfter(version.Timestamp, expiration))
+}
+
+// appendUntilLocked is appendLocked for a version expiring at exp, or never if exp is zero. The caller must
+// hold the write lock.
+func (kv *KeyValueStore) appendUntilLocked(key string, version KeyValue, exp time.Time) bool {
+	now := version.Timestamp
+	previous, exists := kv.data[key]
+	previousValue := latestValue(previous)
+	if version.Revision == 0 {
+		version.Revision = kv.nextRevision()
 	}
 
-	kv.data[key] = append(kv.data[key], KeyValue{
-		Value:     value,
-		Timestamp: now,
-	})
+	kv.data[key] = append(kv.data[key], version)
+	kv.deltaEncodePreviousLocked(key)
 
-	if expiration > 0 {
-		kv.expirations[key] = now.Add(expiration)
-	} else if kv.globalTTL > 0 {
-		kv.expirations[key] = now.Add(kv.globalTTL)
-	} else {
-		delete(kv.expirations, key)
+	kv.setExpiryLocked(key, exp)
+	kv.autoRenew.track(key, now, exp, !exp.IsZero())
+	kv.recordValueSize(key, len(version.Value), now)
+	kv.persistAppend(key)
+	if _, err := kv.enforceRetentionLocked(key, now); err != nil {
+		log.Printf("appendLocked: Failed to prune versions of key '%s': %v\n", key, err)
 	}
 
+	seq := kv.globalSeq.Add(1)
 	if exists {
-		kv.notificationManager.NotifyUpdate(key)
+		kv.notificationManager.notifyChange("updated", key, previousValue, version.Value, seq)
 	} else {
-		kv.notificationManager.NotifyAdd(key)
+		kv.indexAdd(key)
+		kv.notificationManager.notifyChange("added", key, "", version.Value, seq)
 	}
 
-	return nil
+	return !exists
+}
+
+// setExpirationLocked sets the expiration of key as a write at now with the given expiration does:
+// after expiration if it is positive, else after the global TTL if there is one, else never. The caller
+// must hold the write lock.
+func (kv *KeyValueStore) setExpirationLocked(key string, now time.Time, expiration time.Duration) {
+	kv.setExpiryLocked(key, kv.expiryAfter(now, expiration))
+}
+
+// expiryAfter returns when a key written at now with the given expiration expires, or the zero time if it
+// never does.
+func (kv *KeyValueStore) expiryAfter(now time.Time, expiration time.Duration) time.Time {
+	if expiration > 0 {
+		return now.Add(expiration)
+	}
+	if kv.globalTTL > 0 {
+		return now.Add(kv.globalTTL)
+	}
+	return time.Time{}
+}
+
+// setExpiryLocked makes key expire at exp, or never if exp is zero. The caller must hold the write lock.
+func (kv *KeyValueStore) setExpiryLocked(key string, exp time.Time) {
+	if exp.IsZero() {
+		delete(kv.expirations, key)
+	} else {
+		kv.expirations[key] = exp
+	}
+	kv.scheduleExpiry(key)
 }
 
 // Get retrieves the latest value for a given key from the store.
 func (kv *KeyValueStore) Get(key string) (string, error) {
+	return kv.get(context.Background(), key)
+}
+
+// get implements Get and GetContext.
+func (kv *KeyValueStore) get(ctx context.Context, key string) (string, error) {
+	trace := kv.traceOp(ctx, OpGet, key)
+	defer trace.finish()
+
 	log.Println("Get: Checking if data is loaded")
 	if err := kv.ensureLoaded(); err != nil {
-		return "", fmt.Errorf("data not loaded: %v", err)
+		return "", fmt.Errorf("data not loaded: %w", err)
+	}
+	kv.recordAccess(key)
+	kv.touchHistory(key)
+	if err := kv.injectFault(OpGet, key); err != nil {
+		return "", err
+	}
+	// Immutable keys are read without the lock, so writers never delay them.
+	if value, ok := kv.immutableValue(key); ok {
+		trace.valueSize(len(value))
+		return value, nil
 	}
 
-	kv.RLock()
-	defer kv.RUnlock()
+	trace.waitingForLock()
+	acquired := kv.lockRead(OpGet)
+	trace.lockAcquired()
+	defer kv.unlockRead(OpGet, acquired)
+
+	// Return a value still held in a coalescing window so writers read their own writes.
+	if value, ok := kv.pendingValue(key); ok {
+		trace.valueSize(len(value))
+		return value, nil
+	}
 
 	values, exists := kv.data[key]
 	if !exists || len(values) == 0 {
-		return "", errors.New("key not found")
+		return "", ErrKeyNotFound
 	}
 
 	if exp, ok := kv.expirations[key]; ok && time.Now().After(exp) {
-		return "", errors.New("key expired")
+		return "", ErrKeyExpired
+	}
+	kv.recordRead(key)
+
+	value := values[len(values)-1].Value
+	trace.valueSize(len(value))
+	return value, nil
+}
+
+// ValueSize returns the size in bytes of the latest value of key without copying it, failing like Get.
+func (kv *KeyValueStore) ValueSize(key string) (int64, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, fmt.Errorf("data not loaded: %w", err)
+	}
+	if value, ok := kv.immutableValue(key); ok {
+		return int64(len(value)), nil
+	}
+
+	acquired := kv.lockRead(OpGet)
+	defer kv.unlockRead(OpGet, acquired)
+
+	if value, ok := kv.pendingValue(key); ok {
+		return int64(len(value)), nil
+	}
+	values, exists := kv.data[key]
+	if !exists || len(values) == 0 {
+		return 0, ErrKeyNotFound
+	}
+	if exp, ok := kv.expirations[key]; ok && time.Now().After(exp) {
+		return 0, ErrKeyExpired
+	}
+	return int64(len(values[len(values)-1].Value)), nil
+}
+
+// GetOrDefault retrieves the latest value for a given key, or defaultValue if it is missing or expired.
+func (kv *KeyValueStore) GetOrDefault(key, defaultValue string) string {
+	value, err := kv.Get(key)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetOrDefaultInt retrieves the latest value for a given key as an integer, or def if it is missing,
+// expired or not an integer.
+func (kv *KeyValueStore) GetOrDefaultInt(key string, def int64) int64 {
+	value, err := kv.Get(key)
+	if err != nil {
+		return def
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// MustGet retrieves the latest value for a given key and panics if it cannot be read.
+// It is meant for initialization code where a missing key is a programming error.
+func (kv *KeyValueStore) MustGet(key string) string {
+	value, err := kv.Get(key)
+	if err != nil {
+		panic(fmt.Sprintf("MustGet: key '%s': %v", key, err))
+	}
+	return value
+}
+
+// GetMulti retrieves the latest values for several keys in a single lock pass.
+// Keys that are missing or expired are reported in the returned error map instead of the value map.
+func (kv *KeyValueStore) GetMulti(keys []string) (map[string]string, map[string]error) {
+	values := make(map[string]string, len(keys))
+	keyErrors := make(map[string]error)
+
+	if err := kv.ensureLoaded(); err != nil {
+		for _, key := range keys {
+			keyErrors[key] = fmt.Errorf("data not loaded: %w", err)
+		}
+		return values, keyErrors
+	}
+
+	acquired := kv.lockRead(OpGet)
+	defer kv.unlockRead(OpGet, acquired)
+
+	now := time.Now()
+	for _, key := range keys {
+		if value, ok := kv.pendingValue(key); ok {
+			values[key] = value
+			continue
+		}
+		versions, exists := kv.data[key]
+		if !exists || len(versions) == 0 {
+			keyErrors[key] = ErrKeyNotFound
+			continue
+		}
+		if exp, ok := kv.expirations[key]; ok && now.After(exp) {
+			keyErrors[key] = ErrKeyExpired
+			continue
+		}
+		values[key] = versions[len(versions)-1].Value
+	}
+
+	return values, keyErrors
+}
+
+// GetWithTTL retrieves the latest value for a given key together with its remaining TTL.
+// The TTL is read in the same lock pass as the value; keys without expiration report NoExpiration.
+func (kv *KeyValueStore) GetWithTTL(key string) (string, time.Duration, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return "", 0, fmt.Errorf("data not loaded: %w", err)
+	}
+
+	acquired := kv.lockRead(OpGet)
+	defer kv.unlockRead(OpGet, acquired)
+
+	values, exists := kv.data[key]
+	_, pending := kv.pending[key]
+	if !pending && (!exists || len(values) == 0) {
+		return "", 0, ErrKeyNotFound
+	}
+	value, ok := kv.pendingValue(key)
+	if !ok && pending {
+		return "", 0, ErrKeyExpired
+	}
+	if !ok {
+		value = values[len(values)-1].Value
+	}
+
+	exp, ok := kv.expirations[key]
+	if !ok {
+		return value, NoExpiration, nil
+	}
+
+	remaining := time.Until(exp)
+	if remaining <= 0 {
+		return "", 0, ErrKeyExpired
 	}
 
-	return values[len(values)-1].Value, nil
+	return value, remaining, nil
 }
 
 // GetVersion retrieves the value for the given key at the specified version
 func (kv *KeyValueStore) GetVersion(key string, version int) (string, error) {
+	trace := kv.traceOp(context.Background(), OpGet, key)
+	defer trace.finish()
+
+	restored, err := kv.faultInHistory(key)
+	trace.faultedIn(restored)
+	if err != nil {
+		return "", err
+	}
+
+	trace.waitingForLock()
 	kv.RLock()
+	trace.lockAcquired()
 	defer kv.RUnlock()
 
-	versions, exists := kv.data[key]
-	if !exists || version >= len(versions) {
-		return "", errors.New("version not found")
+	versions := kv.withPendingLocked(key, kv.data[key])
+	if version >= len(versions) {
+		return "", ErrVersionNotFound
 	}
 
-	return versions[version].Value, nil
+	value, err := versionValue(versions, version)
+	if err != nil {
+		return "", fmt.Errorf("error reconstructing version %d of key '%s': %v", version, key, err)
+	}
+	trace.valueSize(len(value))
+	return value, nil
 }
 
 // GetAllVersions retrieves all versions for a given key from the store.
 func (kv *KeyValueStore) GetAllVersions(key string) ([]string, error) {
+	trace := kv.traceOp(context.Background(), OpGet, key)
+	defer trace.finish()
+
+	restored, err := kv.faultInHistory(key)
+	trace.faultedIn(restored)
+	if err != nil {
+		return nil, err
+	}
+
+	trace.waitingForLock()
 	kv.RLock()
+	trace.lockAcquired()
 	defer kv.RUnlock()
 
-	if values, exists := kv.data[key]; exists {
+	if values, exists := kv.data[key]; exists || kv.pending[key] != nil {
+		values, err := materializeVersions(values)
+		if err != nil {
+			return nil, fmt.Errorf("error reconstructing history of key '%s': %v", key, err)
+		}
+		values = kv.withPendingLocked(key, values)
 		result := make([]string, len(values))
+		size := 0
 		for i, kv := range values {
 			result[i] = kv.Value
+			size += len(kv.Value)
 		}
+		trace.valueSize(size)
 		return result, nil
 	}
-	return nil, errors.New("key not found")
+	return nil, ErrKeyNotFound
 }
 
 // GetHistory retrieves the version history for a given key from the store.
 func (kv *KeyValueStore) GetHistory(key string) ([]KeyValue, error) {
+	trace := kv.traceOp(context.Background(), OpGet, key)
+	defer trace.finish()
+
+	restored, err := kv.faultInHistory(key)
+	trace.faultedIn(restored)
+	if err != nil {
+		return nil, err
+	}
+
+	trace.waitingForLock()
 	kv.RLock()
+	trace.lockAcquired()
 	defer kv.RUnlock()
 
-	if values, exists := kv.data[key]; exists {
+	if values, exists := kv.data[key]; exists || kv.pending[key] != nil {
+		// Delta-encoded histories are rewritten in place, so callers get a reconstructed copy.
+		if kv.deltaRuleFor(key) != nil || hasDeltas(values) {
+			if values, err = materializeVersions(values); err != nil {
+				return nil, fmt.Errorf("error reconstructing history of key '%s': %v", key, err)
+			}
+		}
+		// A write held in a coalescing window is shown as the version it will be committed as.
+		values = kv.withPendingLocked(key, values)
+		size := 0
+		for _, version := range values {
+			size += len(version.Value)
+		}
+		trace.valueSize(size)
 		return values, nil
 	}
-	return nil, errors.New("key not found")
+	return nil, ErrKeyNotFound
 }
 
 // RemoveVersion removes a specific version of a given key from the store.
 func (kv *KeyValueStore) RemoveVersion(key string, version int) error {
+	if err := kv.admitMutation(); err != nil {
+		return err
+	}
+	if err := kv.checkMutable(key); err != nil {
+		return err
+	}
+
 	kv.Lock()
 	defer kv.Unlock()
 
+	if err := kv.checkMutable(key); err != nil {
+		return err
+	}
+	if err := kv.faultInHistoryLocked(key); err != nil {
+		return err
+	}
+
 	versions, exists := kv.data[key]
 	if !exists {
-		return errors.New("key not found")
+		return ErrKeyNotFound
 	}
 	if version >= len(versions) {
-		return errors.New("version not found")
+		return ErrVersionNotFound
 	}
 
-	kv.data[key] = append(versions[:version], versions[version+1:]...)
+	if kv.deltaRuleFor(key) != nil || hasDeltas(versions) {
+		err := kv.rewriteHistoryLocked(key, func(full []KeyValue) []KeyValue {
+			return append(full[:version], full[version+1:]...)
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		kv.data[key] = append(versions[:version], versions[version+1:]...)
+	}
+	if version == len(versions)-1 {
+		// The previous version is the latest again, but the key's revision must not go back.
+		kv.restampLocked(key)
+	}
+	kv.persistKey(key)
 	return nil
 }
 
-// CompareAndSwap compares and swaps the value of a key if the current value matches the expected value.
-func (kv *KeyValueStore) CompareAndSwap(key string, oldValue, newValue string, ttl time.Duration) (bool, error) {
+// PruneHistory removes the oldest versions of a given key so that at most keep remain, and returns how many
+// were removed.
+func (kv *KeyValueStore) PruneHistory(key string, keep int) (int, error) {
+	if keep < 1 {
+		return 0, fmt.Errorf("PruneHistory: keep must be at least 1, got %d", keep)
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, fmt.Errorf("data not loaded: %w", err)
+	}
+	if err := kv.admitMutation(); err != nil {
+		return 0, err
+	}
+
 	kv.Lock()
 	defer kv.Unlock()
+	return kv.pruneLocked(key, keep)
+}
+
+// pruneLocked implements PruneHistory. The caller must hold the write lock.
+func (kv *KeyValueStore) pruneLocked(key string, keep int) (int, error) {
+	kv.flushPendingLocked(key)
+	if err := kv.faultInHistoryLocked(key); err != nil {
+		return 0, err
+	}
+
+	versions, exists := kv.data[key]
+	if !exists {
+		return 0, ErrKeyNotFound
+	}
+	removed := len(versions) - keep
+	if removed <= 0 {
+		return 0, nil
+	}
+
+	if kv.deltaRuleFor(key) != nil || hasDeltas(versions) {
+		err := kv.rewriteHistoryLocked(key, func(full []KeyValue) []KeyValue { return full[removed:] })
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		kv.data[key] = append([]KeyValue(nil), versions[removed:]...)
+	}
+	kv.persistKey(key)
+	return removed, nil
+}
+
+// CompareAndSwap compares and swaps the value of a key if the current value matches the expected value.
+func (kv *KeyValueStore) CompareAndSwap(key string, oldValue, newValue string, ttl time.Duration) (bool, error) {
+	return kv.compareAndSwap(context.Background(), key, oldValue, newValue, ttl)
+}
+
+// compareAndSwap implements CompareAndSwap and CompareAndSwapContext.
+func (kv *KeyValueStore) compareAndSwap(ctx context.Context, key string, oldValue, newValue string, ttl time.Duration) (bool, error) {
+	trace := kv.traceOp(ctx, OpCompareAndSwap, key)
+	defer trace.finish()
+	trace.valueSize(len(newValue))
+
+	if err := kv.admitMutation(); err != nil {
+		return false, err
+	}
+	if err := kv.admitWrite(); err != nil {
+		return false, err
+	}
+	key, newValue, err := kv.applyPreWriteHooks(key, newValue)
+	if err != nil {
+		return false, err
+	}
+	if err := kv.checkComputed(ctx, key); err != nil {
+		return false, err
+	}
+
+	trace.waitingForLock()
+	acquired := kv.lockWrite(OpCompareAndSwap)
+	trace.lockAcquired()
+	defer kv.unlockWrite(OpCompareAndSwap, acquired)
+
+	if err := kv.checkMutable(key); err != nil {
+		return false, err
+	}
+	// CompareAndSwap bypasses coalescing and compares against any pending value.
+	kv.flushPendingLocked(key)
 
 	values, exists := kv.data[key]
 	if !exists || len(values) == 0 {
 		log.Printf("CompareAndSwap: Key '%s' not found\n", key)
-		return false, errors.New("key not found")
+		return false, ErrKeyNotFound
 	}
 
 	if values[len(values)-1].Value != oldValue {
@@ -207,160 +906,374 @@ func (kv *KeyValueStore) CompareAndSwap(key string, oldValue, newValue string, t
 		return false, nil
 	}
 
+	// Unlike Set, a swap without a TTL leaves the key without one rather than applying the global TTL.
 	now := time.Now()
-	kv.data[key] = append(kv.data[key], KeyValue{
-		Value:     newValue,
-		Timestamp: now,
-	})
+	var exp time.Time
 	if ttl > 0 {
-		kv.expirations[key] = now.Add(ttl)
-	} else {
-		delete(kv.expirations, key)
+		exp = now.Add(ttl)
 	}
+	kv.appendUntilLocked(key, KeyValue{Value: newValue, Timestamp: now}, exp)
 	return true, nil
 }
 
 // Delete removes a key from the store.
 func (kv *KeyValueStore) Delete(key string) error {
-	kv.Lock()
-	defer kv.Unlock()
+	return kv.remove(context.Background(), key)
+}
+
+// remove implements Delete and DeleteContext.
+func (kv *KeyValueStore) remove(ctx context.Context, key string) error {
+	trace := kv.traceOp(ctx, OpDelete, key)
+	defer trace.finish()
+
+	if err := kv.admitMutation(); err != nil {
+		return err
+	}
+	if err := kv.checkComputed(ctx, key); err != nil {
+		return err
+	}
+	if err := kv.checkMutable(key); err != nil {
+		return err
+	}
+
+	trace.waitingForLock()
+	acquired := kv.lockWrite(OpDelete)
+	trace.lockAcquired()
+	defer kv.unlockWrite(OpDelete, acquired)
+
+	if err := kv.checkMutable(key); err != nil {
+		return err
+	}
+	kv.flushPendingLocked(key)
 
 	if _, exists := kv.data[key]; !exists {
-		return errors.New("key not found")
+		return ErrKeyNotFound
 	}
+	kv.deleteLocked(key)
+	return nil
+}
 
+// deleteLocked removes an existing key and sends the delete notification. The caller must hold the write lock.
+func (kv *KeyValueStore) deleteLocked(key string) {
+	last := latestValue(kv.data[key])
 	delete(kv.data, key)
 	delete(kv.expirations, key)
-	kv.notificationManager.NotifyDelete(key)
+	kv.scheduleExpiry(key)
+	kv.persistDelete(key)
+	kv.indexRemove(key)
+	kv.notificationManager.notifyChange("deleted", key, last, "", kv.globalSeq.Add(1))
+}
 
-	return nil
+// latestValue returns the value of the latest of versions, or "" if there are none.
+func latestValue(versions []KeyValue) string {
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[len(versions)-1].Value
 }
 
 // Keys returns a list of all keys in the store.
 func (kv *KeyValueStore) Keys() []string {
-	kv.RLock()
-	defer kv.RUnlock()
+	if kv.keyIndex != nil {
+		// The published slice is immutable, so a copy can be taken without locking.
+		current := kv.keyIndex.load()
+		keys := make([]string, len(current))
+		copy(keys, current)
+		return keys
+	}
+
+	acquired := kv.lockRead(OpKeys)
+	defer kv.unlockRead(OpKeys, acquired)
 
 	log.Println("Keys: Acquired RLock")
 	keys := make([]string, 0, len(kv.data))
 	for key := range kv.data {
 		keys = append(keys, key)
 	}
+	keys = append(keys, kv.pendingKeysLocked()...)
 	log.Println("Keys: Released RLock")
 	return keys
 }
 
 // Size returns the number of key-value pairs in the store.
 func (kv *KeyValueStore) Size() int {
-	kv.RLock()
-	defer kv.RUnlock()
+	acquired := kv.lockRead(OpSize)
+	defer kv.unlockRead(OpSize, acquired)
 
 	log.Println("Size: Acquired RLock")
-	size := len(kv.data)
+	size := len(kv.data) + len(kv.pendingKeysLocked())
 	log.Println("Size: Released RLock")
 	return size
 }
 
-// save saves data to a file with compression and encryption.
+// save saves data to the storage backend with compression and encryption.
 func (kv *KeyValueStore) save() error {
-	kv.RLock()
-	defer kv.RUnlock()
+	_, err := kv.saveNumbered()
+	return err
+}
+
+// saveNumbered saves the store and returns the number of the save. Saves are numbered while holding the
+// read lock, so a save numbered higher than the count seen after a write includes that write.
+func (kv *KeyValueStore) saveNumbered() (uint64, error) {
+	if err := kv.injectFault(OpSave, ""); err != nil {
+		return 0, err
+	}
+
+	acquired := kv.lockRead(OpSave)
+	defer kv.unlockRead(OpSave, acquired)
 
 	log.Println("Save: Acquired RLock")
-	data, err := json.Marshal(kv.data)
+	if err := kv.checkEncryption(); err != nil {
+		return kv.commits.saves.Add(1), err
+	}
+	seq := kv.commits.saves.Add(1)
+	if kv.records != nil {
+		return seq, kv.saveRecords()
+	}
+	dataToWrite, err := kv.encode()
 	if err != nil {
-		return fmt.Errorf("error marshalling data: %v", err)
+		return seq, err
 	}
 
-	compressedData, err := CompressData(data)
+	// Save the data (Base64 encoded)
+	if err := kv.backend.Save(dataToWrite); err != nil {
+		return seq, err
+	}
+	kv.ioStats.write(IOSnapshot, len(dataToWrite))
+	log.Println("Save: Released RLock")
+	return seq, nil
+}
+
+// encode serializes, compresses, encrypts and Base64 encodes the in-memory data.
+// The caller must hold the lock.
+func (kv *KeyValueStore) encode() ([]byte, error) {
+	return kv.encodeData(kv.data)
+}
+
+// encodeData serializes, compresses, encrypts and Base64 encodes the given version histories.
+func (kv *KeyValueStore) encodeData(histories map[string][]KeyValue) ([]byte, error) {
+	histories = kv.withSequence(withBinary(kv.withPool(histories)))
+	var data []byte
+	var err error
+	if kv.keySecret != nil {
+		snapshot, hashErr := kv.hashSnapshot(histories)
+		if hashErr != nil {
+			return nil, hashErr
+		}
+		data, err = json.Marshal(snapshot)
+	} else {
+		data, err = json.Marshal(histories)
+	}
 	if err != nil {
-		return fmt.Errorf("error compressing data: %v", err)
+		return nil, fmt.Errorf("error marshalling data: %v", err)
+	}
+	return kv.sealSnapshot(data)
+}
+
+// sealSnapshot compresses, encrypts and Base64 encodes serialized data.
+func (kv *KeyValueStore) sealSnapshot(data []byte) ([]byte, error) {
+	compressedData, err := compressData(data, kv.tuning.CompressionLevel)
+	if err != nil {
+		return nil, fmt.Errorf("error compressing data: %v", err)
 	}
 
-	var dataToWrite string
 	if len(kv.encryptionKey) > 0 {
 		log.Println("save: Encrypting data")
-		encryptedData, err := EncryptData(compressedData, kv.encryptionKey)
+		encryptedData, err := EncryptDataWithContext(compressedData, kv.encryptionKey, kv.encryptionContext)
 		if err != nil {
-			return fmt.Errorf("error encrypting data: %v", err)
+			return nil, fmt.Errorf("error encrypting data: %v", err)
 		}
 		// Base64 encode the encrypted data before writing to file
-		dataToWrite = base64.StdEncoding.EncodeToString(encryptedData)
-	} else {
-		// Encode compressed data to Base64
-		dataToWrite = base64.StdEncoding.EncodeToString(compressedData)
+		return []byte(base64.StdEncoding.EncodeToString(encryptedData)), nil
 	}
+	// Encode compressed data to Base64
+	return []byte(base64.StdEncoding.EncodeToString(compressedData)), nil
+}
 
-	// Save the data (Base64 encoded)
-	if err := os.WriteFile(kv.filePath, []byte(dataToWrite), 0644); err != nil {
-		return fmt.Errorf("error writing file: %v", err)
+// Save persists the store to its backend or record persister immediately.
+func (kv *KeyValueStore) Save() error {
+	if err := kv.ensureLoaded(); err != nil {
+		return err
+	}
+	return kv.save()
+}
+
+// SaveTo writes the store contents to w in the persisted format.
+func (kv *KeyValueStore) SaveTo(w io.Writer) error {
+	if err := kv.ensureLoaded(); err != nil {
+		return err
+	}
+
+	kv.RLock()
+	defer kv.RUnlock()
+
+	// Snapshots carry the complete history, including versions offloaded to the sidecar.
+	histories, err := kv.withOffloadedHistories()
+	if err != nil {
+		return err
+	}
+	data, err := kv.encodeData(histories)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing data: %v", err)
 	}
-	log.Println("Save: Released RLock")
 	return nil
 }
 
-// load data from a file with decompression and decryption.
+// load data from the storage backend with decompression and decryption.
 func (kv *KeyValueStore) load() error {
 	log.Println("load: Starting to load data")
+	if err := kv.checkEncryption(); err != nil {
+		return err
+	}
+	if kv.records != nil {
+		return kv.loadRecords()
+	}
 
-	file, err := os.Open(kv.filePath)
+	data, err := kv.backend.Load()
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, os.ErrNotExist) {
 			log.Println("load: No existing file, starting fresh")
-			kv.loaded = true
+			kv.loaded.Store(true)
 			return nil
 		}
-		return fmt.Errorf("error opening file: %v", err)
+		return err
+	}
+	if fb, ok := kv.backend.(*FileBackend); ok && len(kv.migrations) > 0 {
+		if data, err = kv.migrate(fb, data); err != nil {
+			return err
+		}
+	}
+
+	modTime := time.Now()
+	if mt, ok := kv.backend.(modTimer); ok {
+		if t, err := mt.ModTime(); err == nil {
+			modTime = t
+		}
+	}
+
+	return kv.install(data, modTime)
+}
+
+// decode reverses encode, turning persisted bytes back into version histories.
+func (kv *KeyValueStore) decode(data []byte) (map[string][]KeyValue, error) {
+	histories, _, err := kv.decodeSnapshot(data)
+	if err == nil {
+		takeImmutable(histories)
 	}
-	defer file.Close()
+	return histories, err
+}
 
-	data, err := os.ReadFile(kv.filePath)
+// decodeSnapshot is decode also returning the sequence number recorded in the snapshot.
+func (kv *KeyValueStore) decodeSnapshot(data []byte) (map[string][]KeyValue, uint64, error) {
+	histories, err := kv.decodeHistories(data)
 	if err != nil {
-		return fmt.Errorf("error reading file: %v", err)
+		return nil, 0, err
+	}
+	// Pooled values are hashed as stored in memory, so binary values are decoded first.
+	if err := expandBinary(histories); err != nil {
+		return nil, 0, err
 	}
+	if err := expandPool(histories); err != nil {
+		return nil, 0, err
+	}
+	return histories, takeSequence(histories), nil
+}
 
+// decodeHistories decodes persisted bytes, including the reserved sequence record.
+func (kv *KeyValueStore) decodeHistories(data []byte) (map[string][]KeyValue, error) {
 	// Decode Base64
 	decodedData, err := base64.StdEncoding.DecodeString(string(data))
 	if err != nil {
-		return fmt.Errorf("error decoding base64: %v", err)
+		return nil, fmt.Errorf("error decoding base64: %v", err)
 	}
 
 	if len(kv.encryptionKey) > 0 {
 		// Decrypt the data
-		decodedData, err = DecryptData(decodedData, kv.encryptionKey)
+		decrypted, err := DecryptDataWithContext(decodedData, kv.encryptionKey, kv.encryptionContext)
 		if err != nil {
-			return fmt.Errorf("error decrypting data: %v", err)
+			if kv.mustEncrypt && isUnencryptedSnapshot(decodedData) {
+				return nil, fmt.Errorf("%w: encrypt it in place with EnableEncryption before requiring encryption", ErrUnencryptedData)
+			}
+			return nil, fmt.Errorf("error decrypting data: %w", err)
 		}
+		decodedData = decrypted
 	}
 
 	decompressedData, err := DecompressData(decodedData)
 	if err != nil {
-		return fmt.Errorf("error decompressing data: %v", err)
+		return nil, fmt.Errorf("error decompressing data: %v", err)
+	}
+	if kv.keySecret != nil {
+		return kv.unhashSnapshot(decompressedData)
+	}
+
+	loadedData := make(map[string][]KeyValue)
+	if err := json.Unmarshal(decompressedData, &loadedData); err != nil {
+		return nil, fmt.Errorf("error unmarshalling data: %v", err)
+	}
+	if loadedData == nil {
+		// A JSON null unmarshals into a nil map, which would panic on the next write.
+		return nil, errors.New("error unmarshalling data: expected a JSON object")
+	}
+	return loadedData, nil
+}
+
+// install decodes persisted bytes, repairs them and makes them the store contents.
+// The caller must hold the write lock.
+func (kv *KeyValueStore) install(data []byte, modTime time.Time) error {
+	loadedData, seq, err := kv.decodeSnapshot(data)
+	if err != nil {
+		return err
 	}
+	immutable := takeImmutable(loadedData)
 
-	if err := json.Unmarshal(decompressedData, &kv.data); err != nil {
-		return fmt.Errorf("error unmarshalling data: %v", err)
+	report := repairData(loadedData, modTime, kv.dedupeOnLoad)
+	if report.Repaired() {
+		if kv.strictLoad {
+			return fmt.Errorf("malformed data: %s", report.describe())
+		}
+		logRepairs(report)
+		log.Printf("load: Repaired %s\n", report.describe())
+		kv.notificationManager.Notify(fmt.Sprintf("load_repaired:%d", report.Count()))
 	}
 
-	kv.loaded = true
+	kv.data = loadedData
+	kv.observeRevisionsLocked()
+	kv.rebaseDeltasLocked()
+	kv.dedupResetLocked()
+	kv.autoRenew.reset()
+	kv.valueGrowth.reset()
+	kv.resetImmutableLocked(immutable)
+	kv.indexReset()
+	kv.restoreSequence(seq)
+	kv.loadReport = report
+	// Contents installed from a snapshot are not in the records yet.
+	kv.recordsDirty.Store(kv.records != nil)
+	// Nor are they tracked for differential backups.
+	kv.backups.reset()
+	if err := kv.loadOffloadIndex(); err != nil {
+		log.Printf("load: Offloaded histories unavailable: %v\n", err)
+	}
+	kv.loaded.Store(true)
 	log.Println("load: Data loaded successfully")
 	return nil
 }
 
 // Ensure data is loaded lazily
 func (kv *KeyValueStore) ensureLoaded() error {
-	kv.RLock()
-	loaded := kv.loaded
-	kv.RUnlock()
-	if !loaded {
+	// The fast path reads the flag without the lock so it does not queue behind pending writers.
+	if !kv.loaded.Load() {
 		kv.Lock()
 		defer kv.Unlock()
 
 		// Double-check to make sure another goroutine didn't load the data
-		if !kv.loaded {
+		if !kv.loaded.Load() {
 			log.Println("ensureLoaded: Triggering load")
 			if err := kv.load(); err != nil {
-				return fmt.Errorf("failed to load data: %v", err)
+				return fmt.Errorf("failed to load data: %w", err)
 			}
 			log.Println("ensureLoaded: Data loaded")
 		}
@@ -369,7 +1282,10 @@ func (kv *KeyValueStore) ensureLoaded() error {
 }
 
 func (kv *KeyValueStore) Loaded() bool {
-	kv.RLock()
-	defer kv.RUnlock()
-	return kv.loaded
+	return kv.loaded.Load()
+}
+
+// Load loads the store contents now instead of on first use, running any migrations.
+func (kv *KeyValueStore) Load() error {
+	return kv.ensureLoaded()
 }
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// readModifyWrite replaces the value of key with the one update returns for its current value, or deletes
+// the key if update says to remove it, and retries when the key's revision changes in between, as it
+// does on every write even when a deletion or retention policy keeps the history length. update receives
+// whether the key exists and has not expired; an error from it is returned without writing. The key keeps
+// its TTL if keepTTL is set. It returns the value update was given and whether the key existed.
+func (kv *KeyValueStore) readModifyWrite(key string, keepTTL bool, update func(current string, found bool) (value string, remove bool, err error)) (string, bool, error) {
+	for {
+		values, _, err := kv.GetManyConsistent([]string{key})
+		if err != nil {
+			return "", false, err
+		}
+		info, found := values[key]
+		condition := Condition{Key: key, Absent: true}
+		var ttl time.Duration
+		if found {
+			condition = Condition{Key: key, Revision: info.Revision, ByRevision: true}
+			if keepTTL && !info.ExpiresAt.IsZero() {
+				// A TTL running out in between fails the condition; the floor keeps it from reading as none.
+				ttl = max(time.Until(info.ExpiresAt), time.Nanosecond)
+			}
+		}
+		value, remove, err := update(info.Value, found)
+		if err != nil {
+			return info.Value, found, err
+		}
+		_, err = kv.MultiCompareAndSwap([]Condition{condition}, []Update{{Key: key, Value: value, TTL: ttl, Delete: remove}})
+		if errors.Is(err, ErrConditionFailed) {
+			continue
+		}
+		return info.Value, found, err
+	}
+}
+
+// Append adds suffix to the end of the value of key, creating the key if it does not exist, and returns
+// the length of the new value. The key keeps its TTL. Concurrent appends are never lost.
+func (kv *KeyValueStore) Append(key, suffix string) (int, error) {
+	var length int
+	_, _, err := kv.readModifyWrite(key, true, func(current string, _ bool) (string, bool, error) {
+		length = len(current) + len(suffix)
+		return current + suffix, false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return length, nil
+}
+
+// GetSet sets key to value without a TTL and returns its previous value, and whether it had one, in
+// one atomic step.
+func (kv *KeyValueStore) GetSet(key, value string) (string, bool, error) {
+	return kv.readModifyWrite(key, false, func(string, bool) (string, bool, error) { return value, false, nil })
+}
+
+// SetNX sets key to value with the given TTL only if the key does not exist or has expired, and reports
+// whether it did.
+func (kv *KeyValueStore) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	_, err := kv.MultiCompareAndSwap([]Condition{{Key: key, Absent: true}}, []Update{{Key: key, Value: value, TTL: ttl}})
+	if errors.Is(err, ErrConditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,257 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the supervised background loops.
+const (
+	ComponentCleanup            = "cleanup"
+	ComponentNotifications      = "notifications"
+	ComponentHistoryAudit       = "history_audit"
+	ComponentMemoryWatchdog     = "memory_watchdog"
+	ComponentStaleReads         = "stale_reads"
+	ComponentWriteAmplification = "write_amplification"
+	ComponentAutoRenew          = "auto_renew"
+	ComponentAutosave           = "autosave"
+)
+
+// listenHeartbeat is how often the notification loop reports in while idle.
+const listenHeartbeat = time.Second
+
+// SupervisorPolicy configures how background loops are watched and restarted.
+type SupervisorPolicy struct {
+	CheckInterval time.Duration // How often loops are checked
+	StallAfter    time.Duration // Silence after which a loop counts as stalled; at least 3 of its intervals
+	Backoff       time.Duration // Delay before the first restart, doubling with each restart up to a minute
+	MaxRestarts   int           // Restarts allowed per loop before it is marked failed
+}
+
+// DefaultSupervisorPolicy is used unless WithSupervisorPolicy is given.
+var DefaultSupervisorPolicy = SupervisorPolicy{
+	CheckInterval: time.Second,
+	StallAfter:    30 * time.Second,
+	Backoff:       100 * time.Millisecond,
+	MaxRestarts:   5,
+}
+
+// ComponentHealth describes a supervised background loop.
+type ComponentHealth struct {
+	Name        string
+	Running     bool      // Whether the loop is up and heartbeating
+	Failed      bool      // Whether the loop exhausted its restart budget
+	Restarts    int       // Restarts so far
+	LastBeat    time.Time // Time of the last heartbeat
+	LastFailure string    // Why the loop was last restarted
+}
+
+// HealthReport describes the background loops of a store. The store is healthy unless a loop failed for good.
+type HealthReport struct {
+	Healthy    bool
+	Components []ComponentHealth
+}
+
+// component is a background loop under supervision. run returns when the store stops or beat returns false.
+type component struct {
+	name     string
+	interval time.Duration
+	run      func(beat func() bool)
+	tracked  bool // Whether Stop waits for the loop
+
+	generation atomic.Uint64
+	lastBeat   atomic.Int64
+
+	// Guarded by supervisor.mu.
+	down        bool
+	failed      bool
+	restarts    int
+	retryAt     time.Time
+	lastFailure string
+}
+
+// supervisor restarts background loops that panic, exit early or stop heartbeating.
+type supervisor struct {
+	mu         sync.Mutex
+	policy     SupervisorPolicy
+	components []*component
+	stop       <-chan struct{}
+	wg         *sync.WaitGroup
+	notify     func(event string)
+}
+
+// newSupervisor creates a supervisor that stops restarting loops once stop is closed.
+func newSupervisor(policy SupervisorPolicy, stop <-chan struct{}, wg *sync.WaitGroup, notify func(string)) *supervisor {
+	return &supervisor{policy: policy, stop: stop, wg: wg, notify: notify}
+}
+
+// add starts run as a supervised loop expected to heartbeat every interval. Untracked loops outlive Stop.
+func (s *supervisor) add(name string, interval time.Duration, tracked bool, run func(beat func() bool)) {
+	c := &component{name: name, interval: interval, run: run, tracked: tracked}
+	s.mu.Lock()
+	s.components = append(s.components, c)
+	s.mu.Unlock()
+	s.start(c)
+}
+
+// start runs the current generation of a loop, recording an unexpected exit or panic.
+func (s *supervisor) start(c *component) {
+	generation := c.generation.Load()
+	c.lastBeat.Store(time.Now().UnixNano())
+	beat := func() bool {
+		if c.generation.Load() != generation {
+			return false
+		}
+		c.lastBeat.Store(time.Now().UnixNano())
+		return true
+	}
+
+	if c.tracked {
+		s.wg.Add(1)
+	}
+	go func() {
+		if c.tracked {
+			defer s.wg.Done()
+		}
+		reason := "exited"
+		defer func() {
+			if r := recover(); r != nil {
+				reason = fmt.Sprintf("panic: %v", r)
+			}
+			s.exited(c, generation, reason)
+		}()
+		c.run(beat)
+	}()
+}
+
+// exited marks a loop down unless the store is stopping or the loop was already replaced.
+func (s *supervisor) exited(c *component, generation uint64, reason string) {
+	select {
+	case <-s.stop:
+		if reason == "exited" {
+			return
+		}
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.generation.Load() != generation {
+		return
+	}
+	log.Printf("supervisor: Component %s %s\n", c.name, reason)
+	c.down = true
+	c.lastFailure = reason
+}
+
+// watch checks the loops every CheckInterval until the store stops.
+func (s *supervisor) watch() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.policy.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.check(time.Now())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// check restarts loops that are down or stalled once their backoff has elapsed.
+func (s *supervisor) check(now time.Time) {
+	// Events are sent once the lock is released, as sending waits for the notification loop.
+	var events []string
+	defer func() {
+		for _, event := range events {
+			s.notify(event)
+		}
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.components {
+		if c.failed {
+			continue
+		}
+		if !c.down && now.Sub(time.Unix(0, c.lastBeat.Load())) > s.stallAfter(c) {
+			log.Printf("supervisor: Component %s stopped heartbeating\n", c.name)
+			c.down = true
+			c.lastFailure = "stalled"
+		}
+		if !c.down {
+			continue
+		}
+		if c.restarts >= s.policy.MaxRestarts {
+			log.Printf("supervisor: Component %s failed after %d restarts\n", c.name, c.restarts)
+			c.failed = true
+			// Make a stalled loop exit if it ever resumes.
+			c.generation.Add(1)
+			events = append(events, "component_failed:"+c.name)
+			continue
+		}
+		if c.retryAt.IsZero() {
+			c.retryAt = now.Add(s.backoff(c.restarts))
+		}
+		if now.Before(c.retryAt) {
+			continue
+		}
+
+		c.generation.Add(1)
+		c.restarts++
+		c.down = false
+		c.retryAt = time.Time{}
+		log.Printf("supervisor: Restarting component %s (restart %d)\n", c.name, c.restarts)
+		s.start(c)
+		events = append(events, "component_restarted:"+c.name)
+	}
+}
+
+// stallAfter returns how long a loop may go without heartbeating.
+func (s *supervisor) stallAfter(c *component) time.Duration {
+	if min := 3 * c.interval; min > s.policy.StallAfter {
+		return min
+	}
+	return s.policy.StallAfter
+}
+
+// backoff returns the delay before restart number restarts+1.
+func (s *supervisor) backoff(restarts int) time.Duration {
+	delay := s.policy.Backoff
+	for i := 0; i < restarts && delay < time.Minute; i++ {
+		delay *= 2
+	}
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	return delay
+}
+
+// health returns the state of every loop.
+func (s *supervisor) health() HealthReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := HealthReport{Healthy: true}
+	for _, c := range s.components {
+		report.Components = append(report.Components, ComponentHealth{
+			Name:        c.name,
+			Running:     !c.down && !c.failed,
+			Failed:      c.failed,
+			Restarts:    c.restarts,
+			LastBeat:    time.Unix(0, c.lastBeat.Load()),
+			LastFailure: c.lastFailure,
+		})
+		if c.failed {
+			report.Healthy = false
+		}
+	}
+	return report
+}
+
+// Health reports the state of the store's background loops, for use by readiness checks.
+func (kv *KeyValueStore) Health() HealthReport {
+	return kv.supervisor.health()
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// suspension is a pause of key notifications started by SuspendNotifications.
+type suspension struct {
+	reason string
+	counts map[string]int // Suppressed events per type
+}
+
+// summary returns the "bulk:<reason>:<type>=<count>,..." event sent when s ends.
+func (s *suspension) summary() string {
+	types := make([]string, 0, len(s.counts))
+	for eventType := range s.counts {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	counts := make([]string, len(types))
+	for i, eventType := range types {
+		counts[i] = fmt.Sprintf("%s=%d", eventType, s.counts[eventType])
+	}
+	return fmt.Sprintf("bulk:%s:%s", s.reason, strings.Join(counts, ","))
+}
+
+// SuspendNotifications stops sending key events (added, updated, deleted, expired) to subscriptions until
+// resume is called, counting them per type instead; other events are still sent. With summary, resume then
+// sends a single "bulk:<reason>:<type>=<count>,..." event, such as "bulk:import:added=120,updated=3", to
+// every subscription at that time. Suspensions nest: events are suppressed until every one has resumed, and
+// each counts the events suppressed while it was active. Suppressed events are still recorded for
+// EventsSince. Calling resume more than once has no effect.
+func (nm *NotificationManager) SuspendNotifications(reason string) (resume func(summary bool)) {
+	s := &suspension{reason: reason, counts: make(map[string]int)}
+	nm.mu.Lock()
+	nm.suspensions = append(nm.suspensions, s)
+	nm.suspended.Add(1)
+	nm.mu.Unlock()
+	log.Printf("SuspendNotifications: Suspended key notifications for '%s'\n", reason)
+
+	var once sync.Once
+	return func(summary bool) {
+		once.Do(func() {
+			nm.mu.Lock()
+			for i, active := range nm.suspensions {
+				if active == s {
+					nm.suspensions = append(nm.suspensions[:i], nm.suspensions[i+1:]...)
+					break
+				}
+			}
+			nm.suspended.Add(-1)
+			nm.mu.Unlock()
+			log.Printf("SuspendNotifications: Resumed key notifications for '%s'\n", reason)
+			if summary {
+				nm.Notify(s.summary())
+			}
+		})
+	}
+}
+
+// suppress counts a key event of eventType against the active suspensions and reports whether it must not
+// be sent.
+func (nm *NotificationManager) suppress(eventType string) bool {
+	bulk := nm.bulk.Load()
+	if bulk == nil && nm.suspended.Load() == 0 {
+		return false
+	}
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if bulk != nil {
+		bulk.counts[eventType]++
+	}
+	for _, s := range nm.suspensions {
+		s.counts[eventType]++
+	}
+	return bulk != nil || len(nm.suspensions) > 0
+}
+
+// bulkSuspension suppresses the key events of a single bulk operation, such as an import, unlike
+// SuspendNotifications, which suppresses those of every writer. Only the events sent between enter and
+// exit are counted, which the operation calls while holding the write lock, so the writes of other
+// callers between its batches are still notified.
+type bulkSuspension struct {
+	nm *NotificationManager
+	s  *suspension
+}
+
+// suspendBulk starts the suspension of a bulk operation named reason.
+func (kv *KeyValueStore) suspendBulk(reason string) *bulkSuspension {
+	return &bulkSuspension{nm: kv.notificationManager, s: &suspension{reason: reason, counts: make(map[string]int)}}
+}
+
+// enter starts suppressing key events as those of the operation. The caller must hold the write lock;
+// a nil suspension suppresses nothing.
+func (b *bulkSuspension) enter() {
+	if b != nil {
+		b.nm.bulk.Store(b.s)
+	}
+}
+
+// exit stops suppressing key events as those of the operation. The caller must hold the write lock.
+func (b *bulkSuspension) exit() {
+	if b != nil {
+		b.nm.bulk.Store(nil)
+	}
+}
+
+// resume ends the operation, sending its "bulk:<reason>:<type>=<count>,..." summary if summary is set.
+func (b *bulkSuspension) resume(summary bool) {
+	if summary {
+		b.nm.mu.Lock()
+		text := b.s.summary()
+		b.nm.mu.Unlock()
+		b.nm.Notify(text)
+	}
+}
+
+// SuspendNotifications pauses key notifications of the store, see NotificationManager.SuspendNotifications.
+func (kv *KeyValueStore) SuspendNotifications(reason string) (resume func(summary bool)) {
+	return kv.notificationManager.SuspendNotifications(reason)
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// TTL returns the time key has left to live, or NoExpiration if it does not expire, without reading its
+// value. It returns ErrKeyNotFound if the key does not exist and ErrKeyExpired if it has expired.
+func (kv *KeyValueStore) TTL(key string) (time.Duration, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, fmt.Errorf("data not loaded: %w", err)
+	}
+	acquired := kv.lockRead(OpExpire)
+	defer kv.unlockRead(OpExpire, acquired)
+	return kv.ttlLocked(key)
+}
+
+// ttlLocked implements TTL. The caller must hold the lock.
+func (kv *KeyValueStore) ttlLocked(key string) (time.Duration, error) {
+	if _, exists := kv.data[key]; !exists {
+		if _, pending := kv.pending[key]; pending {
+			return NoExpiration, nil // Coalesced writes set no TTL
+		}
+		return 0, ErrKeyNotFound
+	}
+	exp, ok := kv.expirations[key]
+	if !ok {
+		return NoExpiration, nil
+	}
+	remaining := time.Until(exp)
+	if remaining <= 0 {
+		return 0, ErrKeyExpired
+	}
+	return remaining, nil
+}
+
+// Expire makes key expire ttl from now, replacing any TTL it had, without writing a new version, and sends
+// an "expire:<key>@<seq>" notification. It returns ErrKeyNotFound or ErrKeyExpired if the key is not live,
+// and ErrImmutableKey if it is immutable, as immutable keys never expire.
+func (kv *KeyValueStore) Expire(key string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errNonPositiveTTL
+	}
+	_, err := kv.updateTTL("expire", key, func() bool {
+		kv.expirations[key] = time.Now().Add(ttl)
+		return true
+	})
+	return err
+}
+
+// Persist removes the TTL of key, without writing a new version, and reports whether it had one. A
+// "persist:<key>@<seq>" notification is sent if it did. It returns ErrKeyNotFound or ErrKeyExpired if the
+// key is not live.
+func (kv *KeyValueStore) Persist(key string) (bool, error) {
+	return kv.updateTTL("persist", key, func() bool {
+		if _, ok := kv.expirations[key]; !ok {
+			return false
+		}
+		delete(kv.expirations, key)
+		return true
+	})
+}
+
+// updateTTL calls apply under the write lock if key is live and mutable, persisting the key and notifying
+// event if apply reports a change.
+func (kv *KeyValueStore) updateTTL(event, key string, apply func() bool) (bool, error) {
+	if err := kv.ensureLoaded(); err != nil {
+		return false, fmt.Errorf("data not loaded: %w", err)
+	}
+	if err := kv.admitMutation(); err != nil {
+		return false, err
+	}
+	if err := kv.checkMutable(key); err != nil {
+		return false, err
+	}
+
+	acquired := kv.lockWrite(OpExpire)
+	defer kv.unlockWrite(OpExpire, acquired)
+	if err := kv.checkMutable(key); err != nil {
+		return false, err
+	}
+	kv.flushPendingLocked(key)
+	if _, err := kv.ttlLocked(key); err != nil {
+		return false, err
+	}
+	if !apply() {
+		return false, nil
+	}
+	kv.scheduleExpiry(key)
+	kv.persistKey(key)
+	kv.notificationManager.notifyKey(event, key, kv.globalSeq.Add(1))
+	return true, nil
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultBulkTTLBatch is how many keys ExpireByPrefix and PersistByPrefix update per write lock hold.
+const defaultBulkTTLBatch = 1000
+
+// errNonPositiveTTL is returned by ExpireByPrefix for a TTL that would expire keys immediately.
+var errNonPositiveTTL = errors.New("ttl must be positive")
+
+// BulkTTLOption configures ExpireByPrefix and PersistByPrefix.
+type BulkTTLOption func(*bulkTTL)
+
+// bulkTTL holds the settings of a bulk TTL update.
+type bulkTTL struct {
+	dryRun bool
+	batch  int
+}
+
+// BulkDryRun counts the keys a bulk TTL update would change without changing them.
+func BulkDryRun() BulkTTLOption {
+	return func(b *bulkTTL) {
+		b.dryRun = true
+	}
+}
+
+// BulkBatch sets how many keys a bulk TTL update changes per write lock hold.
+func BulkBatch(size int) BulkTTLOption {
+	return func(b *bulkTTL) {
+		if size > 0 {
+			b.batch = size
+		}
+	}
+}
+
+// ExpireByPrefix makes every live key starting with prefix expire ttl from now and returns how many keys
+// were updated. Keys are updated in batches, releasing the lock in between, and a single
+// "bulk_expire:<prefix>:<count>@<seq>" notification is sent.
+func (kv *KeyValueStore) ExpireByPrefix(prefix string, ttl time.Duration, opts ...BulkTTLOption) (int, error) {
+	if ttl <= 0 {
+		return 0, errNonPositiveTTL
+	}
+	deadline := time.Now().Add(ttl)
+	return kv.updateTTLByPrefix("bulk_expire", prefix, opts, ttlUpdate{
+		changes: func(hasTTL bool) bool { return true },
+		apply:   func(key string) { kv.expirations[key] = deadline },
+	})
+}
+
+// PersistByPrefix removes the TTL of every live key starting with prefix and returns how many keys had one.
+// Keys are updated in batches, releasing the lock in between, and a single
+// "bulk_persist:<prefix>:<count>@<seq>" notification is sent.
+func (kv *KeyValueStore) PersistByPrefix(prefix string, opts ...BulkTTLOption) (int, error) {
+	return kv.updateTTLByPrefix("bulk_persist", prefix, opts, ttlUpdate{
+		changes: func(hasTTL bool) bool { return hasTTL },
+		apply:   func(key string) { delete(kv.expirations, key) },
+	})
+}
+
+// ttlUpdate describes a bulk TTL update: changes reports whether a key is affected given whether it has a TTL,
+// and apply updates its expiration under the write lock.
+type ttlUpdate struct {
+	changes func(hasTTL bool) bool
+	apply   func(key string)
+}
+
+// affected reports whether update changes key. A key only held in a coalescing window is judged by the
+// expiration its commit will give it. The caller must hold the lock.
+func (kv *KeyValueStore) affected(key string, update ttlUpdate) bool {
+	exp, hasTTL := kv.expirations[key]
+	if _, ok := kv.data[key]; !ok {
+		p, pending := kv.pending[key]
+		if !pending {
+			return false
+		}
+		exp = kv.expiryAfter(p.at, 0)
+		hasTTL = !exp.IsZero()
+	}
+	if hasTTL && !time.Now().Before(exp) {
+		return false // Expired keys are left to the cleanup sweep
+	}
+	if _, frozen := kv.immutableValue(key); frozen {
+		return false // Immutable keys never expire
+	}
+	return update.changes(hasTTL)
+}
+
+// updateTTLByPrefix applies update to the live keys starting with prefix in batches and notifies event with
+// the number of keys changed.
+func (kv *KeyValueStore) updateTTLByPrefix(event, prefix string, opts []BulkTTLOption, update ttlUpdate) (int, error) {
+	settings := bulkTTL{batch: defaultBulkTTLBatch}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	if err := kv.ensureLoaded(); err != nil {
+		return 0, err
+	}
+	if !settings.dryRun {
+		if err := kv.admitMutation(); err != nil {
+			return 0, err
+		}
+	}
+
+	if settings.dryRun {
+		return kv.countTTLByPrefix(prefix, update), nil
+	}
+
+	keys := kv.keysWithPrefix(prefix)
+	count := 0
+	for start := 0; start < len(keys); start += settings.batch {
+		end := min(start+settings.batch, len(keys))
+		count += kv.updateTTLBatch(keys[start:end], update)
+	}
+	log.Printf("%s: Updated the TTL of %d keys starting with '%s'\n", event, count, prefix)
+	kv.notificationManager.notifyKey(event, fmt.Sprintf("%s:%d", prefix, count), kv.globalSeq.Add(1))
+	return count, nil
+}
+
+// countTTLByPrefix returns how many live keys starting with prefix update would change. It only takes the
+// read lock, so pending writes stay pending.
+func (kv *KeyValueStore) countTTLByPrefix(prefix string, update ttlUpdate) int {
+	acquired := kv.lockRead(OpExpire)
+	defer kv.unlockRead(OpExpire, acquired)
+	count := 0
+	for key := range kv.data {
+		if strings.HasPrefix(key, prefix) && kv.affected(key, update) {
+			count++
+		}
+	}
+	for _, key := range kv.pendingKeysLocked() {
+		if strings.HasPrefix(key, prefix) && kv.affected(key, update) {
+			count++
+		}
+	}
+	return count
+}
+
+// keysWithPrefix returns the sorted keys starting with prefix, committing their pending writes first.
+func (kv *KeyValueStore) keysWithPrefix(prefix string) []string {
+	acquired := kv.lockWrite(OpExpire)
+	for key := range kv.pending {
+		if strings.HasPrefix(key, prefix) {
+			kv.flushPendingLocked(key)
+		}
+	}
+	kv.unlockWrite(OpExpire, acquired)
+
+	acquired = kv.lockRead(OpExpire)
+	var keys []string
+	for key := range kv.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	kv.unlockRead(OpExpire, acquired)
+	sort.Strings(keys)
+	return keys
+}
+
+// updateTTLBatch applies update to the affected keys under a single write lock hold.
+func (kv *KeyValueStore) updateTTLBatch(keys []string, update ttlUpdate) int {
+	acquired := kv.lockWrite(OpExpire)
+	defer kv.unlockWrite(OpExpire, acquired)
+	count := 0
+	for _, key := range keys {
+		if !kv.affected(key, update) {
+			continue
+		}
+		update.apply(key)
+		kv.scheduleExpiry(key)
+		kv.persistKey(key)
+		count++
+	}
+	return count
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"compress/zlib"
+	"log"
+	"time"
+)
+
+// Tuning profiles selectable with WithTuningProfile.
+const (
+	ProfileLowMemory  = "low-memory"
+	ProfileBalanced   = "balanced"
+	ProfileThroughput = "throughput"
+)
+
+// Tunable settings, used to record which ones were set by individual options.
+const (
+	tunedCleanupInterval    = "cleanup_interval"
+	tunedCleanupBatch       = "cleanup_batch"
+	tunedCompressionLevel   = "compression_level"
+	tunedNotificationQueue  = "notification_queue"
+	tunedSubscriptionBuffer = "subscription_buffer"
+)
+
+// TuningConfig is the resolved set of internal tuning settings of a store.
+type TuningConfig struct {
+	Profile            string        // Selected profile, or "none"
+	CleanupInterval    time.Duration // How often expired keys are swept
+	CleanupBatch       int           // Expired keys removed per write lock hold; 0 removes all at once
+	CompressionLevel   int           // zlib level of persisted snapshots
+	NotificationQueue  int           // Events buffered before the notification loop dispatches them
+	SubscriptionBuffer int           // Queue size of subscriptions registered without an explicit buffer
+}
+
+// tuningProfiles are the named bundles of settings. A positive cleanup interval passed to NewKeyValueStore
+// and individual options take precedence over them.
+var tuningProfiles = map[string]TuningConfig{
+	// Sweeps often in small batches and compresses hard to keep the heap and files small, with short queues.
+	ProfileLowMemory: {
+		CleanupInterval:    10 * time.Second,
+		CleanupBatch:       256,
+		CompressionLevel:   zlib.BestCompression,
+		NotificationQueue:  16,
+		SubscriptionBuffer: 64,
+	},
+	ProfileBalanced: {
+		CleanupInterval:    time.Minute,
+		CleanupBatch:       1024,
+		CompressionLevel:   zlib.DefaultCompression,
+		NotificationQueue:  128,
+		SubscriptionBuffer: 1024,
+	},
+	// Sweeps rarely and compresses fast so writers and saves spend less time behind locks, with deep queues.
+	ProfileThroughput: {
+		CleanupInterval:    5 * time.Minute,
+		CleanupBatch:       8192,
+		CompressionLevel:   zlib.BestSpeed,
+		NotificationQueue:  4096,
+		SubscriptionBuffer: 16384,
+	},
+}
+
+// defaultTuning returns the settings of a store without a profile.
+func defaultTuning(cleanupInterval time.Duration) TuningConfig {
+	return TuningConfig{
+		Profile:            "none",
+		CleanupInterval:    cleanupInterval,
+		CompressionLevel:   zlib.DefaultCompression,
+		NotificationQueue:  10,
+		SubscriptionBuffer: defaultSubscriptionBuffer,
+	}
+}
+
+// markTuned records that an individual option set a tunable, so the profile does not override it.
+func (kv *KeyValueStore) markTuned(setting string) {
+	if kv.tuned == nil {
+		kv.tuned = make(map[string]bool)
+	}
+	kv.tuned[setting] = true
+}
+
+// resolveTuning fills the settings not set by individual options from the selected profile.
+func (kv *KeyValueStore) resolveTuning() {
+	if kv.tuningProfile == "" {
+		return
+	}
+	profile, ok := tuningProfiles[kv.tuningProfile]
+	if !ok {
+		log.Printf("NewKeyValueStore: Unknown tuning profile '%s', using the defaults\n", kv.tuningProfile)
+		return
+	}
+
+	kv.tuning.Profile = kv.tuningProfile
+	if !kv.tuned[tunedCleanupInterval] {
+		kv.tickerInterval = profile.CleanupInterval
+	}
+	if !kv.tuned[tunedCleanupBatch] {
+		kv.tuning.CleanupBatch = profile.CleanupBatch
+	}
+	if !kv.tuned[tunedCompressionLevel] {
+		kv.tuning.CompressionLevel = profile.CompressionLevel
+	}
+	if !kv.tuned[tunedNotificationQueue] {
+		kv.tuning.NotificationQueue = profile.NotificationQueue
+	}
+	if !kv.tuned[tunedSubscriptionBuffer] {
+		kv.tuning.SubscriptionBuffer = profile.SubscriptionBuffer
+	}
+}
+
+// EffectiveConfig returns the tuning settings the store resolved from its profile and options.
+func (kv *KeyValueStore) EffectiveConfig() TuningConfig {
+	config := kv.tuning
+	config.CleanupInterval = kv.tickerInterval
+	return config
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+// ErrTxnDone is returned by the methods of a Txn that was already committed or rolled back.
+var ErrTxnDone = errors.New("transaction already committed or rolled back")
+
+// Txn stages sets and deletes to apply together on Commit. Reads see the staged writes, and every key
+// read from the store must be unchanged when the transaction commits. A Txn is not safe for concurrent use.
+type Txn struct {
+	kv     *KeyValueStore
+	writes map[string]Update
+	order  []string // Keys in the order they were first written
+	reads  map[string]Condition
+	done   bool
+}
+
+// Begin starts a transaction on the store. Nothing is locked until Commit.
+func (kv *KeyValueStore) Begin() *Txn {
+	return &Txn{kv: kv, writes: make(map[string]Update), reads: make(map[string]Condition)}
+}
+
+// Get returns the latest value of key as staged by the transaction, or as stored. A key read from the
+// store becomes a condition of Commit, whether it was found or not.
+func (t *Txn) Get(key string) (string, error) {
+	if t.done {
+		return "", ErrTxnDone
+	}
+	if update, staged := t.writes[key]; staged {
+		if update.Delete {
+			return "", ErrKeyNotFound
+		}
+		return update.Value, nil
+	}
+
+	values, _, err := t.kv.GetManyConsistent([]string{key})
+	if err != nil {
+		return "", err
+	}
+	info, found := values[key]
+	if _, read := t.reads[key]; !read {
+		if found {
+			t.reads[key] = Condition{Key: key, Revision: info.Revision, ByRevision: true}
+		} else {
+			t.reads[key] = Condition{Key: key, Absent: true}
+		}
+	}
+	if !found {
+		return "", ErrKeyNotFound
+	}
+	return info.Value, nil
+}
+
+// Set stages setting key to value with the given TTL, replacing any earlier write to key in the transaction.
+func (t *Txn) Set(key, value string, ttl time.Duration) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.stage(Update{Key: key, Value: value, TTL: ttl})
+	return nil
+}
+
+// Delete stages removing key, failing with ErrKeyNotFound like the store's Delete if the transaction
+// does not see it.
+func (t *Txn) Delete(key string) error {
+	if _, err := t.Get(key); err != nil {
+		return err
+	}
+	t.stage(Update{Key: key, Delete: true})
+	return nil
+}
+
+// stage records update as the write of its key.
+func (t *Txn) stage(update Update) {
+	if _, staged := t.writes[update.Key]; !staged {
+		t.order = append(t.order, update.Key)
+	}
+	t.writes[update.Key] = update
+}
+
+// Commit applies the staged writes atomically with MultiCompareAndSwap, provided no key the transaction
+// read from the store changed since. Otherwise nothing is written and the error wraps ErrConditionFailed,
+// so the caller can retry with a new transaction. The transaction is done either way.
+func (t *Txn) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.done = true
+
+	conditions := make([]Condition, 0, len(t.reads))
+	for _, condition := range t.reads {
+		conditions = append(conditions, condition)
+	}
+	sort.Slice(conditions, func(i, j int) bool { return conditions[i].Key < conditions[j].Key })
+	updates := make([]Update, len(t.order))
+	for i, key := range t.order {
+		updates[i] = t.writes[key]
+	}
+	if _, err := t.kv.MultiCompareAndSwap(conditions, updates); err != nil {
+		log.Printf("Commit: Transaction of %d writes aborted: %v\n", len(updates), err)
+		return err
+	}
+	return nil
+}
+
+// Rollback discards the staged writes.
+func (t *Txn) Rollback() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.done = true
+	t.writes, t.order, t.reads = nil, nil, nil
+	return nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TypedStore reads and writes values of type T in a KeyValueStore, stored as JSON.
+type TypedStore[T any] struct {
+	kv *KeyValueStore
+}
+
+// NewTypedStore returns a TypedStore for values of type T in kv.
+func NewTypedStore[T any](kv *KeyValueStore) TypedStore[T] {
+	return TypedStore[T]{kv: kv}
+}
+
+// Set stores value under key as JSON, like Set.
+func (s TypedStore[T]) Set(key string, value T, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error encoding value of key '%s': %w", key, err)
+	}
+	return s.kv.Set(key, string(data), expiration)
+}
+
+// Get returns the latest value of key decoded from JSON, failing like Get, or with the decoding error if
+// the value is not the JSON of a T.
+func (s TypedStore[T]) Get(key string) (T, error) {
+	var value T
+	data, err := s.kv.Get(key)
+	if err != nil {
+		return value, err
+	}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		var zero T
+		return zero, fmt.Errorf("error decoding value of key '%s': %w", key, err)
+	}
+	return value, nil
+}
+
+// GetOrDefault returns the latest value of key, or def if it is missing, expired or not the JSON of a T.
+func (s TypedStore[T]) GetOrDefault(key string, def T) T {
+	value, err := s.Get(key)
+	if err != nil {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrValueTooLarge is returned for a write whose value exceeds ValueGrowthConfig.MaxValueBytes.
+var ErrValueTooLarge = errors.New("value too large")
+
+// ValueGrowthConfig configures WithValueGrowthAlerts. Zero fields disable their check.
+type ValueGrowthConfig struct {
+	Threshold int           // Alert when the latest value of a key grows beyond this many bytes
+	Factor    float64       // Alert when a value grows by more than this factor within Window
+	Window    time.Duration // Period over which Factor applies; 1h if zero
+	// MaxValueBytes refuses writes of larger values with ErrValueTooLarge. Without it the alerts are advisory.
+	MaxValueBytes int
+}
+
+// KeySize is the size of the latest value of a key, as listed by LargestKeys.
+type KeySize struct {
+	Key  string
+	Size int
+}
+
+// growthState is the size history of a key tracked by valueGrowth.
+type growthState struct {
+	size        int
+	windowSize  int // Size when the current window started
+	windowStart time.Time
+	overLimit   bool // Alerted for crossing the threshold; re-armed once the value shrinks below it
+	grew        bool // Alerted for growing by the factor in the current window
+}
+
+// valueGrowth tracks the size of the latest value of each key.
+type valueGrowth struct {
+	config ValueGrowthConfig
+	mu     sync.Mutex
+	keys   map[string]*growthState
+}
+
+// newValueGrowth creates a valueGrowth tracker.
+func newValueGrowth(config ValueGrowthConfig) *valueGrowth {
+	if config.Window <= 0 {
+		config.Window = time.Hour
+	}
+	return &valueGrowth{config: config, keys: make(map[string]*growthState)}
+}
+
+// record notes that the latest value of key is now size bytes and returns the alert to send, if any.
+// Each crossing of the threshold alerts once, as does growing by the factor within a window.
+func (g *valueGrowth) record(key string, size int, now time.Time) (string, bool) {
+	if g == nil {
+		return "", false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	state, tracked := g.keys[key]
+	if !tracked {
+		state = &growthState{size: size, windowSize: size, windowStart: now}
+		g.keys[key] = state
+	}
+	if now.Sub(state.windowStart) > g.config.Window {
+		state.windowSize, state.windowStart, state.grew = state.size, now, false
+	}
+	old := state.size
+	state.size = size
+
+	alert := false
+	if g.config.Threshold > 0 {
+		if size <= g.config.Threshold {
+			state.overLimit = false
+		} else if !state.overLimit {
+			state.overLimit, alert = true, true
+		}
+	}
+	if g.config.Factor > 0 && !state.grew && state.windowSize > 0 && float64(size) > g.config.Factor*float64(state.windowSize) {
+		state.grew, alert = true, true
+	}
+	if !alert {
+		return "", false
+	}
+
+	rate := 0.0
+	if elapsed := now.Sub(state.windowStart).Seconds(); elapsed > 0 {
+		rate = float64(size-state.windowSize) / elapsed
+	}
+	return fmt.Sprintf("value_growth:%s@%d:%d:%.0f", key, old, size, rate), true
+}
+
+// forget stops tracking key.
+func (g *valueGrowth) forget(key string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	delete(g.keys, key)
+	g.mu.Unlock()
+}
+
+// reset stops tracking every key, after the store contents were replaced.
+func (g *valueGrowth) reset() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	g.keys = make(map[string]*growthState)
+	g.mu.Unlock()
+}
+
+// checkValueSize returns ErrValueTooLarge if value exceeds the configured MaxValueBytes.
+func (kv *KeyValueStore) checkValueSize(key, value string) error {
+	if kv.valueGrowth == nil || kv.valueGrowth.config.MaxValueBytes <= 0 || len(value) <= kv.valueGrowth.config.MaxValueBytes {
+		return nil
+	}
+	log.Printf("checkValueSize: Refusing %d bytes for key '%s'\n", len(value), key)
+	return fmt.Errorf("%w: %d bytes for key '%s', at most %d allowed", ErrValueTooLarge, len(value), key, kv.valueGrowth.config.MaxValueBytes)
+}
+
+// recordValueSize tracks the size of the new latest value of key and sends a value_growth notification
+// when it crosses a threshold of WithValueGrowthAlerts. The caller must hold the write lock.
+func (kv *KeyValueStore) recordValueSize(key string, size int, now time.Time) {
+	if event, alert := kv.valueGrowth.record(key, size, now); alert {
+		log.Printf("recordValueSize: %s\n", event)
+		kv.notificationManager.Notify(event)
+	}
+}
+
+// LargestKeys returns the n live keys with the largest latest values, largest first, ties ordered by key.
+func (kv *KeyValueStore) LargestKeys(n int) []KeySize {
+	if err := kv.ensureLoaded(); err != nil {
+		log.Printf("LargestKeys: Data not loaded: %v\n", err)
+		return nil
+	}
+	kv.RLock()
+	now := time.Now()
+	sizes := make([]KeySize, 0, len(kv.data))
+	for key, versions := range kv.data {
+		if exp, ok := kv.expirations[key]; len(versions) == 0 || (ok && now.After(exp)) {
+			continue
+		}
+		sizes = append(sizes, KeySize{Key: key, Size: len(versions[len(versions)-1].Value)})
+	}
+	kv.RUnlock()
+
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].Size != sizes[j].Size {
+			return sizes[i].Size > sizes[j].Size
+		}
+		return sizes[i].Key < sizes[j].Key
+	})
+	if n >= 0 && n < len(sizes) {
+		sizes = sizes[:n]
+	}
+	return sizes
+}
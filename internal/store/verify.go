@@ -0,0 +1,110 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+)
+
+// VerifyReport lists the differences between the live store and a snapshot.
+type VerifyReport struct {
+	Missing   []string // Keys present in the snapshot but not in the store
+	Extra     []string // Keys present in the store but not in the snapshot
+	Divergent []string // Keys whose content differs
+	Repaired  []string // Divergent keys replaced with the snapshot's history
+}
+
+// Consistent reports whether the store matched the snapshot.
+func (r VerifyReport) Consistent() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Divergent) == 0
+}
+
+// contentHash returns the canonical hash of a key's content: its latest value and version count.
+func contentHash(versions []KeyValue) string {
+	h := sha256.New()
+	if len(versions) > 0 {
+		h.Write([]byte(versions[len(versions)-1].Value))
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(len(versions))))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify compares the store with a snapshot in the persisted format (as written by SaveTo) read from other.
+func (kv *KeyValueStore) Verify(other io.Reader) (VerifyReport, error) {
+	return kv.verify(other, false)
+}
+
+// Repair compares the store with a snapshot like Verify and replaces divergent keys with the snapshot's history,
+// emitting an update event for each repaired key.
+func (kv *KeyValueStore) Repair(other io.Reader) (VerifyReport, error) {
+	return kv.verify(other, true)
+}
+
+// verify compares the store with a snapshot and optionally repairs divergent keys.
+func (kv *KeyValueStore) verify(other io.Reader, repair bool) (VerifyReport, error) {
+	var report VerifyReport
+	if err := kv.ensureLoaded(); err != nil {
+		return report, err
+	}
+
+	data, err := io.ReadAll(other)
+	if err != nil {
+		return report, fmt.Errorf("error reading snapshot: %v", err)
+	}
+	snapshot, err := kv.decode(data)
+	if err != nil {
+		return report, err
+	}
+
+	if repair {
+		kv.Lock()
+		defer kv.Unlock()
+	} else {
+		kv.RLock()
+		defer kv.RUnlock()
+	}
+
+	histories, err := kv.withOffloadedHistories()
+	if err != nil {
+		return report, err
+	}
+	for key, versions := range snapshot {
+		live, exists := histories[key]
+		if !exists {
+			report.Missing = append(report.Missing, key)
+			continue
+		}
+		if contentHash(live) != contentHash(versions) {
+			report.Divergent = append(report.Divergent, key)
+		}
+	}
+	for key := range kv.data {
+		if _, exists := snapshot[key]; !exists {
+			report.Extra = append(report.Extra, key)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Extra)
+	sort.Strings(report.Divergent)
+
+	if repair {
+		for _, key := range report.Divergent {
+			previous := latestValue(kv.data[key])
+			kv.data[key] = snapshot[key]
+			kv.restampLocked(key)
+			kv.forgetHistory(key)
+			kv.persistKey(key)
+			kv.notificationManager.notifyChange("updated", key, previous, latestValue(snapshot[key]), kv.globalSeq.Add(1))
+			report.Repaired = append(report.Repaired, key)
+		}
+	}
+
+	log.Printf("Verify: %d missing, %d extra, %d divergent, %d repaired\n",
+		len(report.Missing), len(report.Extra), len(report.Divergent), len(report.Repaired))
+	return report, nil
+}
@@ -0,0 +1,124 @@
+// Package ttl parses the TTL fields accepted by the store's request surfaces into a time.Duration.
+package ttl
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+)
+
+// Field names accepted in requests.
+const (
+	FieldTTL        = "ttl"
+	FieldTTLSeconds = "ttl_seconds"
+	FieldExpiresAt  = "expires_at"
+)
+
+// Input holds the TTL fields of a request; nil fields were not supplied.
+type Input struct {
+	TTL        *string // Go duration string such as "5m" or "1h30m"
+	TTLSeconds *int64  // Whole seconds
+	ExpiresAt  *string // RFC3339 absolute time
+}
+
+// FieldError reports an invalid TTL field.
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+// Error returns the field and the reason it was rejected.
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// invalid returns an InvalidArgument error for field.
+func invalid(field, format string, args ...any) error {
+	return errs.Wrap(errs.InvalidArgument, &FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Parse returns the TTL described by in, relative to now. Zero means no expiration. At most one field
+// may be set; bare integers in ttl are rejected as ambiguous. Errors are InvalidArgument *FieldErrors.
+func Parse(in Input, now time.Time) (time.Duration, error) {
+	var set []string
+	if in.TTL != nil {
+		set = append(set, FieldTTL)
+	}
+	if in.TTLSeconds != nil {
+		set = append(set, FieldTTLSeconds)
+	}
+	if in.ExpiresAt != nil {
+		set = append(set, FieldExpiresAt)
+	}
+	if len(set) > 1 {
+		return 0, invalid(set[1], "conflicts with %s; set only one TTL field", set[0])
+	}
+
+	switch {
+	case in.TTL != nil:
+		return parseDuration(*in.TTL)
+	case in.TTLSeconds != nil:
+		if *in.TTLSeconds < 0 {
+			return 0, invalid(FieldTTLSeconds, "must not be negative")
+		}
+		return fromCount(FieldTTLSeconds, *in.TTLSeconds, time.Second)
+	case in.ExpiresAt != nil:
+		expiresAt, err := time.Parse(time.RFC3339, *in.ExpiresAt)
+		if err != nil {
+			return 0, invalid(FieldExpiresAt, "must be an RFC3339 time such as 2024-01-02T15:04:05Z")
+		}
+		if !expiresAt.After(now) {
+			return 0, invalid(FieldExpiresAt, "must be in the future")
+		}
+		return expiresAt.Sub(now), nil
+	default:
+		return 0, nil
+	}
+}
+
+// ParseCount parses s as a whole number of unit, such as the seconds of the RESP EX option. Zero and
+// negative counts are returned as they are for the caller to interpret. Errors are InvalidArgument
+// *FieldErrors naming field.
+func ParseCount(field, s string, unit time.Duration) (time.Duration, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, invalid(field, "%q is not a whole number", s)
+	}
+	return fromCount(field, n, unit)
+}
+
+// maxDuration is the largest representable time.Duration.
+const maxDuration = time.Duration(1<<63 - 1)
+
+// fromCount returns n times unit, rejecting counts the result cannot represent.
+func fromCount(field string, n int64, unit time.Duration) (time.Duration, error) {
+	if limit := int64(maxDuration / unit); n > limit || n < -limit {
+		return 0, invalid(field, "too large")
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// parseDuration parses a Go duration string, rejecting unitless numbers.
+func parseDuration(s string) (time.Duration, error) {
+	if _, err := strconv.ParseFloat(s, 64); err == nil && s != "0" {
+		return 0, invalid(FieldTTL, "%q has no unit; use a duration such as %ss or the %s field", s, s, FieldTTLSeconds)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, invalid(FieldTTL, "%q is not a duration such as 5m or 1h30m", s)
+	}
+	if d < 0 {
+		return 0, invalid(FieldTTL, "must not be negative")
+	}
+	return d, nil
+}
+
+// ExpiresAt returns the absolute expiration applied for ttl, or the zero time if ttl is zero.
+func ExpiresAt(ttl time.Duration, now time.Time) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
@@ -0,0 +1,172 @@
+// Package ui serves a read-only HTML view of a KeyValueStore, for glancing at keys without the CLI.
+package ui
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// defaultPageSize is the number of keys per page of the key list.
+const defaultPageSize = 50
+
+// Root is the path the UI is served under.
+const Root = "/ui/"
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// pages holds the parsed templates; every page template includes the header and footer of base.html.
+var pages = template.Must(template.New("").Funcs(template.FuncMap{"keyURL": keyURL}).ParseFS(templateFiles, "templates/*.html"))
+
+// Config configures the UI.
+type Config struct {
+	Enabled  bool // Serve the UI; when false, Register adds no routes and its paths are not found
+	PageSize int  // Keys per page of the key list; 50 if zero
+}
+
+// Register adds the UI routes to mux when cfg enables it. Every route only answers GET. Values are read
+// with the request context, so the store's Authorizer sees the principal the server's authentication put
+// there and can restrict the UI to the user role.
+func Register(mux *http.ServeMux, kv *store.KeyValueStore, cfg Config) {
+	if !cfg.Enabled {
+		return
+	}
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = defaultPageSize
+	}
+	u := &ui{kv: kv, pageSize: cfg.PageSize}
+	mux.HandleFunc("GET "+Root+"{$}", u.keys)
+	mux.HandleFunc("GET "+Root+"keys/{key...}", u.key)
+}
+
+// ui serves the pages of one store.
+type ui struct {
+	kv       *store.KeyValueStore
+	pageSize int
+}
+
+// keyURL returns the path of the detail page of key.
+func keyURL(key string) string {
+	return Root + "keys/" + url.PathEscape(key)
+}
+
+// listURL returns the path of the key list page starting at offset of a listing.
+func listURL(prefix, listing string, offset int) string {
+	query := url.Values{"prefix": {prefix}, "listing": {listing}, "offset": {strconv.Itoa(offset)}}
+	return Root + "?" + query.Encode()
+}
+
+// keys renders a page of the keys starting with the prefix parameter. Pages are taken from a key listing,
+// whose ID the pagination links carry, so paging does not skip or repeat keys written in between.
+func (u *ui) keys(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	offset, err := strconv.Atoi(query.Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	listing := query.Get("listing")
+	page, err := u.kv.KeyListingPage(listing, offset, u.pageSize)
+	if errors.Is(err, store.ErrListingExpired) {
+		// A new search, or a listing that expired: list the prefix afresh.
+		if listing, err = u.kv.BeginKeyListing(prefix); err == nil {
+			page, err = u.kv.KeyListingPage(listing, offset, u.pageSize)
+		}
+	}
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	data := struct {
+		Title, Prefix    string
+		Keys             []string
+		PrevURL, NextURL string
+	}{Title: "Keys", Prefix: prefix, Keys: page.Keys}
+	if offset > 0 {
+		data.PrevURL = listURL(prefix, listing, max(offset-u.pageSize, 0))
+	}
+	if !page.Done {
+		data.NextURL = listURL(prefix, listing, page.Next)
+	}
+	render(w, "keys.html", data)
+}
+
+// version is a row of the history table.
+type version struct {
+	Version   int
+	Timestamp string
+	Value     string
+}
+
+// key renders the latest value, TTL and history of a key.
+func (u *ui) key(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	value, err := u.kv.GetContext(r.Context(), key)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	_, ttl, err := u.kv.GetWithTTL(key)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	history, err := u.kv.GetHistory(key)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+
+	data := struct {
+		Title, Value string
+		TTL          time.Duration
+		History      []version
+	}{Title: key, Value: pretty(value), TTL: ttl.Round(time.Second)}
+	// Newest first, as the latest version is the one usually looked for.
+	for i := len(history) - 1; i >= 0; i-- {
+		data.History = append(data.History, version{
+			Version:   i,
+			Timestamp: history[i].Timestamp.Format(time.RFC3339),
+			Value:     pretty(history[i].Value),
+		})
+	}
+	render(w, "key.html", data)
+}
+
+// pretty returns value indented if it is a JSON document, and unchanged otherwise.
+func pretty(value string) string {
+	var b bytes.Buffer
+	if json.Indent(&b, []byte(value), "", "  ") != nil {
+		return value
+	}
+	return b.String()
+}
+
+// render writes the page template name executed with data.
+func render(w http.ResponseWriter, name string, data any) {
+	var b bytes.Buffer
+	if err := pages.ExecuteTemplate(&b, name, data); err != nil {
+		fail(w, errs.Wrap(errs.Internal, err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// fail writes err with the HTTP status of its kind.
+func fail(w http.ResponseWriter, err error) {
+	status, _ := errs.HTTPStatusFor(errs.KindOf(err))
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,121 @@
+// Package watch streams the key events of a KeyValueStore to HTTP clients as Server-Sent Events.
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// Pattern is the route Handler serves. The prefix query parameter limits the stream to keys starting
+// with it.
+const Pattern = "GET /api/v1/watch"
+
+// heartbeat is how often an idle stream sends a comment, so proxies keep the connection open. Events of
+// bulk operations, which send a single summary notification, are also picked up by then at the latest.
+const heartbeat = 15 * time.Second
+
+// event is the data of a streamed event.
+type event struct {
+	Seq  uint64    `json:"seq"`
+	Type string    `json:"type"`
+	Key  string    `json:"key"`
+	Time time.Time `json:"time"`
+}
+
+// Handler returns an HTTP handler streaming the added, updated, deleted and expired events of kv as
+// Server-Sent Events, each with the event's sequence number as its ID and a JSON object as its data.
+// A client reconnecting with the Last-Event-ID header, or the since query parameter, resumes after that
+// sequence number. When the events it missed are no longer available the stream ends with a "truncated"
+// event, and the client must read the keys afresh before watching again.
+func Handler(kv *store.KeyValueStore) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(Pattern, func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			fail(w, errs.Errorf(errs.Internal, "streaming unsupported"))
+			return
+		}
+		prefix := r.URL.Query().Get("prefix")
+		since := r.Header.Get("Last-Event-ID")
+		if since == "" {
+			since = r.URL.Query().Get("since")
+		}
+
+		// Subscribe before reading the sequence number, so no event falls in between.
+		wake := make(chan struct{}, 1)
+		id := kv.SubscribeFiltered(store.EventFilter{Include: []string{prefix}}, 1, func(string) {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		})
+		defer kv.Unsubscribe(id)
+
+		last := kv.LastSequence()
+		if since != "" {
+			seq, err := strconv.ParseUint(since, 10, 64)
+			if err != nil {
+				fail(w, errs.Errorf(errs.InvalidArgument, "invalid event ID '%s'", since))
+				return
+			}
+			last = seq
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		for {
+			events, err := kv.EventsSince(last)
+			var truncated *store.EventsTruncatedError
+			if errors.As(err, &truncated) {
+				fmt.Fprintf(w, "event: truncated\ndata: {\"oldest\":%d,\"latest\":%d}\n\n", truncated.Oldest, truncated.Latest)
+				flusher.Flush()
+				return
+			}
+			if err != nil {
+				log.Printf("watch: Error reading events: %v\n", err)
+				return
+			}
+			for _, e := range events {
+				last = e.Seq
+				if !strings.HasPrefix(e.Key, prefix) {
+					continue
+				}
+				data, _ := json.Marshal(event{Seq: e.Seq, Type: e.Type, Key: e.Key, Time: e.Time})
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data)
+			}
+			if len(events) > 0 {
+				flusher.Flush()
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-wake:
+			case <-ticker.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				flusher.Flush()
+			}
+		}
+	})
+	return mux
+}
+
+// fail writes err with the HTTP status of its kind.
+func fail(w http.ResponseWriter, err error) {
+	status, _ := errs.HTTPStatusFor(errs.KindOf(err))
+	http.Error(w, err.Error(), status)
+}
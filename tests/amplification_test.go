@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/sqlitestore"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// amplificationWorkload writes 100 versions of 100 key and value bytes each.
+func amplificationWorkload(t *testing.T, kvStore *store.KeyValueStore) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if err := kvStore.Set(fmt.Sprintf("k%03d", i%50), strings.Repeat("v", 96), 0); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+}
+
+// expectIO checks the bytes and writes counted for a subsystem, allowing a relative tolerance on bytes.
+func expectIO(t *testing.T, stats store.WriteAmplificationStats, s store.IOSubsystem, bytes, writes uint64, tolerance float64) {
+	t.Helper()
+	got := stats.Subsystems[s]
+	if math.Abs(float64(got.Bytes)-float64(bytes)) > tolerance*float64(bytes) || got.Writes != writes {
+		t.Errorf("Expected %s to write %d bytes in %d writes, got %+v", s, bytes, writes, got)
+	}
+}
+
+func TestWriteAmplificationPerSubsystem(t *testing.T) {
+	t.Run("snapshot", func(t *testing.T) {
+		backend := store.NewMemoryBackend()
+		kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(backend))
+		defer kvStore.Stop()
+		amplificationWorkload(t, kvStore)
+		if err := kvStore.Save(); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+
+		stats := kvStore.WriteAmplification()
+		saved, _ := backend.Load()
+		if stats.LogicalBytes != 10000 {
+			t.Errorf("Expected 10000 logical bytes, got %d", stats.LogicalBytes)
+		}
+		expectIO(t, stats, store.IOSnapshot, uint64(len(saved)), 1, 0)
+		expectIO(t, stats, store.IORecords, 0, 0, 0)
+		if stats.PhysicalBytes != uint64(len(saved)) || stats.Factor != float64(len(saved))/10000 {
+			t.Errorf("Expected the factor of a single save, got %+v", stats)
+		}
+	})
+
+	t.Run("records", func(t *testing.T) {
+		db, err := sqlitestore.Open(filepath.Join(t.TempDir(), "data.db"))
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		kvStore := store.NewKeyValueStore("", nil, 0, time.Minute, store.WithRecordPersister(db))
+		defer kvStore.Stop()
+		amplificationWorkload(t, kvStore)
+		kvStore.Delete("k000")
+
+		// Every version is written through once, plus the deleted key; values are not encrypted.
+		stats := kvStore.WriteAmplification()
+		expectIO(t, stats, store.IORecords, 10000+4, 101, 0)
+		expectIO(t, stats, store.IOSnapshot, 0, 0, 0)
+		if stats.Factor < 0.99 || stats.Factor > 1.01 {
+			t.Errorf("Expected a write-through factor of about 1, got %v", stats.Factor)
+		}
+	})
+
+	t.Run("backup", func(t *testing.T) {
+		kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(store.NewMemoryBackend()))
+		defer kvStore.Stop()
+		amplificationWorkload(t, kvStore)
+		dir := t.TempDir()
+		entry, err := kvStore.Backup(dir, store.BackupFull)
+		if err != nil {
+			t.Fatalf("Backup failed: %v", err)
+		}
+
+		backup, _ := os.Stat(filepath.Join(dir, entry.Name))
+		manifest, _ := os.Stat(filepath.Join(dir, "manifest.json"))
+		stats := kvStore.WriteAmplification()
+		expectIO(t, stats, store.IOBackup, uint64(backup.Size()+manifest.Size()), 2, 0)
+		expectIO(t, stats, store.IOSnapshot, 0, 0, 0)
+	})
+}
+
+func TestWriteAmplificationCeiling(t *testing.T) {
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute,
+		store.WithBackend(store.NewMemoryBackend()), store.WithWriteAmplificationCeiling(2, 20*time.Millisecond))
+	defer kvStore.Stop()
+	warnings := make(chan string, 10)
+	kvStore.Subscribe("write_amplification:*", 10, func(event string) {
+		select {
+		case warnings <- event:
+		default:
+		}
+	})
+
+	// Saving after every write rewrites the whole store each time.
+	deadline := time.After(2 * time.Second)
+	for i := 0; ; i++ {
+		kvStore.Set(fmt.Sprintf("k%03d", i%50), strings.Repeat("v", 96), 0)
+		kvStore.Save()
+		select {
+		case <-warnings:
+			if kvStore.WriteAmplification().Warnings == 0 {
+				t.Error("Expected the warning to be counted")
+			}
+			return
+		case <-deadline:
+			t.Fatalf("Expected a warning, got %+v", kvStore.WriteAmplification())
+		default:
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// usageOf returns the aggregate of prefix in report.
+func usageOf(t *testing.T, report store.AnalysisReport, prefix string) store.PrefixUsage {
+	t.Helper()
+	for _, u := range report.Prefixes {
+		if u.Prefix == prefix {
+			return u
+		}
+	}
+	t.Fatalf("No aggregate for prefix %q in %+v", prefix, report.Prefixes)
+	return store.PrefixUsage{}
+}
+
+func TestAnalyzeAggregatesByPrefix(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+
+	// "user" keys: 2 keys of 6 bytes, one with three versions of 10 bytes, one with a single 10-byte value.
+	kvStore.Set("user:1", "aaaaaaaaaa", 0)
+	kvStore.Set("user:1", "bbbbbbbbbb", 0)
+	kvStore.Set("user:1", "cccccccccc", 0)
+	kvStore.Set("user:2", "dddddddddd", 0)
+	time.Sleep(20 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	// "session" keys: 3 keys of 9 bytes with 100-byte values and a TTL.
+	big := string(make([]byte, 100))
+	for _, key := range []string{"session:a", "session:b", "session:c"} {
+		kvStore.Set(key, big, time.Hour)
+	}
+	// A key without a prefix.
+	kvStore.Set("motd", "hi", 0)
+
+	report, err := kvStore.Analyze(store.AnalyzeBatch(2))
+	if err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if len(report.Prefixes) != 3 || report.Prefixes[0].Prefix != "session" || report.Prefixes[2].Prefix != "" {
+		t.Fatalf("Expected three prefixes, largest first, got %+v", report.Prefixes)
+	}
+
+	users := usageOf(t, report, "user")
+	if users.Keys != 2 || users.Bytes != 2*6+4*10 || users.HistoryBytes != 2*10 || users.WithTTL != 0 || users.WithoutTTL != 2 {
+		t.Errorf("Unexpected user aggregate %+v", users)
+	}
+	if !users.OldestWrite.Before(users.NewestWrite) || !users.NewestWrite.Before(cutoff) {
+		t.Errorf("Expected user writes before the cutoff, got %v to %v", users.OldestWrite, users.NewestWrite)
+	}
+	sessions := usageOf(t, report, "session")
+	if sessions.Keys != 3 || sessions.Bytes != 3*(9+100) || sessions.HistoryBytes != 0 || sessions.WithTTL != 3 {
+		t.Errorf("Unexpected session aggregate %+v", sessions)
+	}
+	if motd := usageOf(t, report, ""); motd.Keys != 1 || motd.Bytes != 4+2 {
+		t.Errorf("Unexpected aggregate for keys without a prefix %+v", motd)
+	}
+	if total := report.Total; total.Keys != 6 || total.Bytes != 52+327+6 || total.WithTTL != 3 || total.WithoutTTL != 3 || total.Reclaimable != 0 {
+		t.Errorf("Unexpected total %+v", total)
+	}
+
+	// Keeping one version drops the two older versions of user:1.
+	report, _ = kvStore.Analyze(store.AnalyzeRetention(store.RetentionPolicy{KeepVersions: 1}))
+	if got := usageOf(t, report, "user").Reclaimable; got != 20 {
+		t.Errorf("Expected 20 reclaimable user bytes when keeping one version, got %d", got)
+	}
+	if report.Total.Reclaimable != 20 {
+		t.Errorf("Expected 20 reclaimable bytes in total, got %d", report.Total.Reclaimable)
+	}
+
+	// Dropping keys not written in the 10ms before the cutoff drops the user keys whole.
+	policy := store.RetentionPolicy{KeepVersions: 1, MaxAge: 10 * time.Millisecond}
+	report, _ = kvStore.Analyze(store.AnalyzeRetention(policy), store.AnalyzeAsOf(cutoff))
+	if got := usageOf(t, report, "user").Reclaimable; got != 52 {
+		t.Errorf("Expected every user byte to be reclaimable, got %d", got)
+	}
+	if got := usageOf(t, report, "session").Reclaimable; got != 0 {
+		t.Errorf("Expected sessions written after the cutoff to be kept, got %d", got)
+	}
+	if report.Policy != policy || !report.AsOf.Equal(cutoff) {
+		t.Errorf("Expected the report to record its policy, got %+v as of %v", report.Policy, report.AsOf)
+	}
+}
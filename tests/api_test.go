@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/api"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// apiError is the error body of the API.
+type apiError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newAPIServer serves the API of kvStore, with requests made as principal if it is set.
+func newAPIServer(t *testing.T, kvStore *store.KeyValueStore, principal string) *httptest.Server {
+	handler := api.Handler(kvStore)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal != "" {
+			r = r.WithContext(store.WithPrincipal(r.Context(), principal))
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// callAPI makes a request to path and decodes the JSON response into out, if set, returning the status.
+func callAPI(t *testing.T, server *httptest.Server, method, path string, out any) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, server.URL+path, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if out != nil && len(body) > 0 {
+		if err := json.Unmarshal(body, out); err != nil {
+			t.Fatalf("%s %s: invalid JSON %q: %v", method, path, body, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAPIVersions(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	for _, value := range []string{"v1", "v2", "v3"} {
+		kvStore.Set("config/app", value, 0)
+	}
+	server := newAPIServer(t, kvStore, "")
+
+	var list struct {
+		Key      string
+		Versions []string
+	}
+	if status := callAPI(t, server, http.MethodGet, "/api/v1/keys/config%2Fapp/versions", &list); status != http.StatusOK {
+		t.Fatalf("Expected 200 listing versions, got %d", status)
+	}
+	if list.Key != "config/app" || !reflect.DeepEqual(list.Versions, []string{"v1", "v2", "v3"}) {
+		t.Errorf("Unexpected versions: %+v", list)
+	}
+
+	var version struct {
+		Key     string
+		Version int
+		Value   string
+	}
+	if status := callAPI(t, server, http.MethodGet, "/api/v1/keys/config%2Fapp/versions/1", &version); status != http.StatusOK {
+		t.Fatalf("Expected 200 getting a version, got %d", status)
+	}
+	if version.Version != 1 || version.Value != "v2" {
+		t.Errorf("Expected version 1 to be v2, got %+v", version)
+	}
+
+	var history struct {
+		History []struct {
+			Version   int
+			Value     string
+			Timestamp time.Time
+			Revision  uint64
+		}
+	}
+	if status := callAPI(t, server, http.MethodGet, "/api/v1/keys/config%2Fapp/history", &history); status != http.StatusOK {
+		t.Fatalf("Expected 200 getting the history, got %d", status)
+	}
+	if len(history.History) != 3 || history.History[2].Value != "v3" || history.History[2].Timestamp.IsZero() {
+		t.Errorf("Unexpected history: %+v", history)
+	}
+	infos, _, _ := kvStore.GetManyConsistent([]string{"config/app"})
+	if want := infos["config/app"].Revision; history.History[2].Revision != want {
+		t.Errorf("Expected the latest version to carry revision %d, got %d", want, history.History[2].Revision)
+	}
+
+	if status := callAPI(t, server, http.MethodDelete, "/api/v1/keys/config%2Fapp/versions/0", nil); status != http.StatusNoContent {
+		t.Fatalf("Expected 204 removing a version, got %d", status)
+	}
+	if versions, _ := kvStore.GetAllVersions("config/app"); !reflect.DeepEqual(versions, []string{"v2", "v3"}) {
+		t.Errorf("Expected the oldest version to be removed, got %v", versions)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/api/v1/keys/missing/versions", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/api/v1/keys/missing/history", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/api/v1/keys/config%2Fapp/versions/5", http.StatusNotFound, "not_found"},
+		{http.MethodDelete, "/api/v1/keys/config%2Fapp/versions/5", http.StatusNotFound, "not_found"},
+		{http.MethodGet, "/api/v1/keys/config%2Fapp/versions/-1", http.StatusBadRequest, "invalid_argument"},
+		{http.MethodDelete, "/api/v1/keys/config%2Fapp/versions/first", http.StatusBadRequest, "invalid_argument"},
+	} {
+		var body apiError
+		if status := callAPI(t, server, tc.method, tc.path, &body); status != tc.status || body.Error.Code != tc.code {
+			t.Errorf("%s %s: expected %d %s, got %d %+v", tc.method, tc.path, tc.status, tc.code, status, body)
+		}
+	}
+}
+
+func TestAPIVersionsAuthorized(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithAuthorizer(ownPrefix))
+	defer kvStore.Stop()
+	kvStore.Set("alice/profile", "A1", 0)
+	kvStore.Set("alice/profile", "A2", 0)
+	kvStore.Set("shared/motd", "hello", 0)
+	kvStore.Set("shared/motd", "hi", 0)
+	server := newAPIServer(t, kvStore, "bob")
+
+	var body apiError
+	if status := callAPI(t, server, http.MethodGet, "/api/v1/keys/alice%2Fprofile/history", &body); status != http.StatusForbidden || body.Error.Code != "forbidden" {
+		t.Errorf("Expected bob to be forbidden from alice's history, got %d %+v", status, body)
+	}
+	if status := callAPI(t, server, http.MethodGet, "/api/v1/keys/shared%2Fmotd/versions/0", nil); status != http.StatusOK {
+		t.Errorf("Expected bob to read a shared version, got %d", status)
+	}
+	if status := callAPI(t, server, http.MethodDelete, "/api/v1/keys/shared%2Fmotd/versions/0", nil); status != http.StatusForbidden {
+		t.Errorf("Expected removing a version to be authorized as a delete, got %d", status)
+	}
+	if versions, _ := kvStore.GetAllVersions("shared/motd"); len(versions) != 2 {
+		t.Errorf("Expected the denied removal to leave both versions, got %v", versions)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// ownPrefix allows principals to touch keys under "<principal>/" and admins to touch everything.
+func ownPrefix(ctx context.Context, op store.Op, key string) error {
+	principal, ok := store.PrincipalFrom(ctx)
+	switch {
+	case !ok:
+		return errors.New("no principal")
+	case principal == "admin", strings.HasPrefix(key, principal+"/"):
+		return nil
+	case op == store.OpGet && strings.HasPrefix(key, "shared/"):
+		return nil
+	}
+	return store.ErrForbidden
+}
+
+func TestAuthorizerEnforcesOwnership(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithAuthorizer(ownPrefix))
+	defer kvStore.Stop()
+
+	alice := store.WithPrincipal(context.Background(), "alice")
+	bob := store.WithPrincipal(context.Background(), "bob")
+	admin := store.WithPrincipal(context.Background(), "admin")
+
+	if err := kvStore.SetContext(alice, "alice/profile", "A", 0); err != nil {
+		t.Fatalf("Expected alice to set her own key: %v", err)
+	}
+	if err := kvStore.SetContext(admin, "shared/motd", "hello", 0); err != nil {
+		t.Fatalf("Expected admin to set any key: %v", err)
+	}
+
+	err := kvStore.SetContext(bob, "alice/profile", "B", 0)
+	if !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for bob writing alice's key, got %v", err)
+	}
+	if status := errs.HTTPStatus(err); status != http.StatusForbidden {
+		t.Errorf("Expected a denial to map to 403, got %d", status)
+	}
+	if _, err := kvStore.GetContext(bob, "alice/profile"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for bob reading alice's key, got %v", err)
+	}
+	if value, err := kvStore.GetContext(bob, "shared/motd"); err != nil || value != "hello" {
+		t.Errorf("Expected bob to read shared keys, got %q (error: %v)", value, err)
+	}
+	if _, err := kvStore.CompareAndSwapContext(bob, "alice/profile", "A", "B", 0); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for bob swapping alice's key, got %v", err)
+	}
+	if err := kvStore.DeleteContext(bob, "alice/profile"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for bob deleting alice's key, got %v", err)
+	}
+
+	// Errors other than ErrForbidden are wrapped so they still classify as denials.
+	if _, err := kvStore.GetContext(context.Background(), "alice/profile"); !errors.Is(err, store.ErrForbidden) || !strings.Contains(err.Error(), "no principal") {
+		t.Errorf("Expected a wrapped denial without a principal, got %v", err)
+	}
+
+	// A cancelled context never reaches the store.
+	cancelled, cancel := context.WithCancel(alice)
+	cancel()
+	if err := kvStore.SetContext(cancelled, "alice/profile", "late", 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	if value, _ := kvStore.Get("alice/profile"); value != "A" {
+		t.Errorf("Expected alice's key to be untouched, got %q", value)
+	}
+}
+
+func TestAuthorizerChecksBulkOperations(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithAuthorizer(ownPrefix))
+	defer kvStore.Stop()
+
+	alice := store.WithPrincipal(context.Background(), "alice")
+	bob := store.WithPrincipal(context.Background(), "bob")
+
+	result := kvStore.SetManyContext(alice, []store.Entry{
+		{Key: "alice/a", Value: "1"},
+		{Key: "bob/a", Value: "1"},
+		{Key: "alice/b", Value: "2"},
+	})
+	if strings.Join(result.Created, ",") != "alice/a,alice/b" {
+		t.Errorf("Expected only alice's keys to be created, got %v", result.Created)
+	}
+	if !errors.Is(result.Errors["bob/a"], store.ErrForbidden) || len(result.Errors) != 1 {
+		t.Errorf("Expected ErrForbidden for bob/a only, got %v", result.Errors)
+	}
+
+	// One key under the prefix bob may not delete blocks the whole deletion.
+	kvStore.SetContext(bob, "bob/x", "1", 0)
+	kvStore.Set("b-shared", "1", 0)
+	if _, err := kvStore.DeleteByPrefixContext(bob, "b"); !errors.Is(err, store.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden when the prefix covers other keys, got %v", err)
+	}
+	if kvStore.Size() != 4 {
+		t.Errorf("Expected nothing to be deleted after a denial, got %d keys", kvStore.Size())
+	}
+
+	deleted, err := kvStore.DeleteByPrefixContext(alice, "alice/")
+	if err != nil || deleted != 2 {
+		t.Errorf("Expected alice to delete her 2 keys, got %d (error: %v)", deleted, err)
+	}
+	if deleted, err := kvStore.DeleteByPrefix("b"); err != nil || deleted != 2 {
+		t.Errorf("Expected the context-free DeleteByPrefix to skip authorization, got %d (error: %v)", deleted, err)
+	}
+	if kvStore.Size() != 0 {
+		t.Errorf("Expected an empty store, got %d keys", kvStore.Size())
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// newAutoRenewStore creates a store renewing "cache:" keys read more than 3 times, for at most maxLifetime.
+func newAutoRenewStore(t *testing.T, maxLifetime time.Duration) (*store.KeyValueStore, chan string) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 10*time.Millisecond,
+		store.WithAutoRenew("cache:", 3, maxLifetime))
+	t.Cleanup(kvStore.Stop)
+	extended := make(chan string, 100)
+	kvStore.Subscribe("ttl_extended:*", 100, func(event string) { extended <- event })
+	return kvStore, extended
+}
+
+// readTimes reads key n times.
+func readTimes(kvStore *store.KeyValueStore, key string, n int) {
+	for i := 0; i < n; i++ {
+		kvStore.Get(key)
+	}
+}
+
+func TestAutoRenewExtendsHotKeys(t *testing.T) {
+	kvStore, extended := newAutoRenewStore(t, time.Hour)
+	kvStore.Set("cache:hot", "v", 200*time.Millisecond)
+
+	readTimes(kvStore, "cache:hot", 3)
+	time.Sleep(20 * time.Millisecond)
+	if _, ttl, _ := kvStore.GetWithTTL("cache:hot"); ttl > 200*time.Millisecond {
+		t.Fatalf("Expected no extension at the threshold, got a TTL of %v", ttl)
+	}
+
+	readTimes(kvStore, "cache:hot", 1)
+	select {
+	case event := <-extended:
+		if event != "ttl_extended:cache:hot" {
+			t.Errorf("Unexpected notification %q", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the hot key to be extended")
+	}
+	// The extension adds the original TTL to the deadline.
+	if _, ttl, err := kvStore.GetWithTTL("cache:hot"); err != nil || ttl < 300*time.Millisecond || ttl > 400*time.Millisecond {
+		t.Errorf("Expected a TTL of about 400ms less the time elapsed, got %v (%v)", ttl, err)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	if value, err := kvStore.Get("cache:hot"); err != nil || value != "v" {
+		t.Errorf("Expected the key to outlive its original TTL, got %q (%v)", value, err)
+	}
+	if stats := kvStore.AutoRenewStats(); stats.Extensions != 1 || stats.Tracked != 1 {
+		t.Errorf("Expected a single extension, got %+v", stats)
+	}
+}
+
+func TestAutoRenewLifetimeCap(t *testing.T) {
+	kvStore, _ := newAutoRenewStore(t, 300*time.Millisecond)
+	start := time.Now()
+	kvStore.Set("cache:capped", "v", 200*time.Millisecond)
+
+	// Reading continuously would extend the key forever without the cap.
+	for time.Since(start) < 500*time.Millisecond {
+		kvStore.Get("cache:capped")
+		time.Sleep(2 * time.Millisecond)
+	}
+	if _, err := kvStore.Get("cache:capped"); err == nil {
+		t.Fatal("Expected the key to expire at its maximum lifetime")
+	}
+	if stats := kvStore.AutoRenewStats(); stats.Extensions != 1 || stats.Capped != 1 {
+		t.Errorf("Expected one extension cut short by the cap, got %+v", stats)
+	}
+}
+
+func TestAutoRenewLeavesColdKeys(t *testing.T) {
+	kvStore, extended := newAutoRenewStore(t, time.Hour)
+	kvStore.Set("cache:cold", "v", 100*time.Millisecond)
+	kvStore.Set("other:hot", "v", 100*time.Millisecond)
+
+	readTimes(kvStore, "cache:cold", 2)
+	readTimes(kvStore, "other:hot", 10)
+	time.Sleep(150 * time.Millisecond)
+	for _, key := range []string{"cache:cold", "other:hot"} {
+		if _, err := kvStore.Get(key); err == nil {
+			t.Errorf("Expected %s to expire on time", key)
+		}
+	}
+	select {
+	case event := <-extended:
+		t.Errorf("Expected no extension, got %q", event)
+	default:
+	}
+
+	// A new write starts a new lifetime, so reads before it do not count.
+	kvStore.Set("cache:rewritten", "v1", time.Minute)
+	readTimes(kvStore, "cache:rewritten", 3)
+	kvStore.Set("cache:rewritten", "v2", time.Minute)
+	readTimes(kvStore, "cache:rewritten", 1)
+	time.Sleep(20 * time.Millisecond)
+	if stats := kvStore.AutoRenewStats(); stats.Extensions != 0 {
+		t.Errorf("Expected reads before a write not to count, got %+v", stats)
+	}
+}
+
+func TestAutoRenewTracksCompareAndSwap(t *testing.T) {
+	kvStore, extended := newAutoRenewStore(t, time.Hour)
+	kvStore.Set("cache:swapped", "v1", 0)
+
+	// The TTL is only given by the swap, which must start the key's lifetime like Set does.
+	if swapped, err := kvStore.CompareAndSwap("cache:swapped", "v1", "v2", 200*time.Millisecond); err != nil || !swapped {
+		t.Fatalf("CompareAndSwap failed: swapped=%v, error=%v", swapped, err)
+	}
+	readTimes(kvStore, "cache:swapped", 4)
+	select {
+	case event := <-extended:
+		if event != "ttl_extended:cache:swapped" {
+			t.Errorf("Unexpected notification %q", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the key set by CompareAndSwap to be extended")
+	}
+	if stats := kvStore.AutoRenewStats(); stats.Extensions != 1 || stats.Tracked != 1 {
+		t.Errorf("Expected a single extension, got %+v", stats)
+	}
+}
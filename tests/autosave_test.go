@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// manualClock is a clock that only moves when advanced.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// clockedBackend is a backend whose saves take delay on clock, without sleeping.
+type clockedBackend struct {
+	*store.MemoryBackend
+	clock *manualClock
+	delay time.Duration
+}
+
+func (b *clockedBackend) Save(data []byte) error {
+	b.clock.advance(b.delay)
+	return b.MemoryBackend.Save(data)
+}
+
+// autosaveUnderLoad writes continuously to a store autosaving to a backend taking delay per save until it
+// has autosaved saves times, and returns its stats. Save durations and write rates are measured on a
+// manual clock advanced only by the saves, so they do not depend on the speed of the host.
+func autosaveUnderLoad(t *testing.T, delay time.Duration, config store.AutosaveConfig, saves uint64) store.AutosaveStats {
+	t.Helper()
+	clock := &manualClock{now: time.Unix(0, 0)}
+	config.Clock = clock.Now
+	backend := &clockedBackend{MemoryBackend: store.NewMemoryBackend(), clock: clock, delay: delay}
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute,
+		store.WithBackend(backend), store.WithAdaptiveAutosave(config))
+	defer kvStore.Stop()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for i := 0; kvStore.AutosaveStats().Saves < saves; i++ {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d autosaves, got %+v", saves, kvStore.AutosaveStats())
+		}
+		kvStore.Set(fmt.Sprintf("k%d", i%100), "v", 0)
+		time.Sleep(time.Millisecond)
+	}
+	return kvStore.AutosaveStats()
+}
+
+func TestAdaptiveAutosaveSlowSaves(t *testing.T) {
+	// Saves of 20ms may take a tenth of the time: one every 200ms.
+	stats := autosaveUnderLoad(t, 20*time.Millisecond,
+		store.AutosaveConfig{MaxOverhead: 0.1, MinInterval: 10 * time.Millisecond, MaxInterval: 5 * time.Second}, 4)
+	if stats.Interval != 200*time.Millisecond {
+		t.Errorf("Expected an interval of ten save durations, got %+v", stats)
+	}
+	if stats.SaveP90 != 20*time.Millisecond || stats.WriteRate <= 0 {
+		t.Errorf("Expected the save durations and write rate to be measured, got %+v", stats)
+	}
+}
+
+func TestAdaptiveAutosaveFastSaves(t *testing.T) {
+	stats := autosaveUnderLoad(t, 0,
+		store.AutosaveConfig{MaxOverhead: 0.5, MinInterval: 20 * time.Millisecond, MaxInterval: time.Second}, 5)
+	if stats.Interval != 20*time.Millisecond {
+		t.Errorf("Expected fast saves to run at the minimum interval, got %+v", stats)
+	}
+}
+
+func TestAdaptiveAutosaveCeiling(t *testing.T) {
+	// A 1% overhead would mean saving every 3s; the ceiling bounds the writes at risk instead.
+	stats := autosaveUnderLoad(t, 30*time.Millisecond,
+		store.AutosaveConfig{MaxOverhead: 0.01, MinInterval: 10 * time.Millisecond, MaxInterval: 100 * time.Millisecond}, 2)
+	if stats.Interval != 100*time.Millisecond {
+		t.Errorf("Expected the interval to stop at the ceiling, got %+v", stats)
+	}
+}
+
+func TestAdaptiveAutosaveSkipsIdleStores(t *testing.T) {
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(store.NewMemoryBackend()),
+		store.WithAdaptiveAutosave(store.AutosaveConfig{MinInterval: 10 * time.Millisecond, MaxInterval: time.Second}))
+	defer kvStore.Stop()
+	kvStore.Set("key", "value", 0)
+	// Manual saves are not autosaves and do not change the interval.
+	kvStore.Save()
+
+	if !waitFor(t, 2*time.Second, func() bool { return kvStore.AutosaveStats().Skipped > 0 }) {
+		t.Fatalf("Expected idle autosaves to be skipped, got %+v", kvStore.AutosaveStats())
+	}
+	if stats := kvStore.AutosaveStats(); stats.Saves != 1 {
+		t.Errorf("Expected only the write to be autosaved, got %+v", stats)
+	}
+	if stats := store.NewPassive().AutosaveStats(); stats.Enabled {
+		t.Error("Expected autosave to be off by default")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestNewKeyValueStoreFromReader(t *testing.T) {
+	source := store.NewKeyValueStore(filepath.Join(t.TempDir(), "source.json"), encryptionKey, 0, 1*time.Minute)
+	defer source.Stop()
+
+	if err := source.Set("name", "Jane", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if err := source.Set("name", "John", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if err := source.Set("city", "Paris", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := source.SaveTo(&buf); err != nil {
+		t.Fatalf("Failed to save store: %v", err)
+	}
+
+	backend := store.NewMemoryBackend()
+	kvStore, err := store.NewKeyValueStoreFromReader(&buf, encryptionKey, store.WithBackend(backend))
+	if err != nil {
+		t.Fatalf("Failed to create store from reader: %v", err)
+	}
+
+	if !kvStore.Loaded() {
+		t.Errorf("Expected store created from a reader to be loaded")
+	}
+	if value, err := kvStore.Get("city"); err != nil || value != "Paris" {
+		t.Errorf("Expected 'Paris', got %q (error: %v)", value, err)
+	}
+	versions, err := kvStore.GetAllVersions("name")
+	if err != nil || strings.Join(versions, ",") != "Jane,John" {
+		t.Errorf("Expected versions [Jane John], got %v (error: %v)", versions, err)
+	}
+
+	// Stopping persists to the configured backend rather than a file.
+	kvStore.Stop()
+	data, err := backend.Load()
+	if err != nil {
+		t.Fatalf("Expected data in memory backend: %v", err)
+	}
+	reloaded, err := store.NewKeyValueStoreFromReader(bytes.NewReader(data), encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to reload store: %v", err)
+	}
+	defer reloaded.Stop()
+	if value, err := reloaded.Get("name"); err != nil || value != "John" {
+		t.Errorf("Expected 'John' after reload, got %q (error: %v)", value, err)
+	}
+}
+
+func TestNewKeyValueStoreFromReaderWrongKey(t *testing.T) {
+	source := store.NewKeyValueStore(filepath.Join(t.TempDir(), "source.json"), encryptionKey, 0, 1*time.Minute)
+	defer source.Stop()
+	if err := source.Set("key", "value", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := source.SaveTo(&buf); err != nil {
+		t.Fatalf("Failed to save store: %v", err)
+	}
+
+	if _, err := store.NewKeyValueStoreFromReader(&buf, []byte("0123456789abcdef")); err == nil {
+		t.Fatalf("Expected error when decrypting with the wrong key")
+	}
+}
+
+func TestFileBackendMissingFile(t *testing.T) {
+	backend := store.NewFileBackend(filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := backend.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not-exist error, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// takeBackup takes a backup and checks how many keys it captured.
+func takeBackup(t *testing.T, kvStore *store.KeyValueStore, dir string, mode store.BackupMode, keys int) store.BackupEntry {
+	t.Helper()
+	entry, err := kvStore.Backup(dir, mode)
+	if err != nil {
+		t.Fatalf("%s backup failed: %v", mode, err)
+	}
+	if entry.Keys != keys {
+		t.Errorf("Expected the %s backup to capture %d keys, got %d", mode, keys, entry.Keys)
+	}
+	return entry
+}
+
+// contentHashOf returns the content hash of kvStore.
+func contentHashOf(t *testing.T, kvStore *store.KeyValueStore) string {
+	t.Helper()
+	hash, err := kvStore.ContentHash()
+	if err != nil {
+		t.Fatalf("ContentHash failed: %v", err)
+	}
+	return hash
+}
+
+// backupChain takes a full backup followed by two differentials and returns the live store.
+func backupChain(t *testing.T, dir string) *store.KeyValueStore {
+	t.Helper()
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		kvStore.Set(key, key+"1", 0)
+	}
+	takeBackup(t, kvStore, dir, store.BackupFull, 4)
+
+	kvStore.Set("a", "a2", 0)
+	kvStore.Delete("b")
+	kvStore.Set("e", "e1", 0)
+	takeBackup(t, kvStore, dir, store.BackupDiff, 3)
+
+	kvStore.Set("a", "a3", 0)
+	kvStore.Delete("e")
+	takeBackup(t, kvStore, dir, store.BackupDiff, 2)
+	return kvStore
+}
+
+func TestRestoreDifferentialChain(t *testing.T) {
+	dir := t.TempDir()
+	live := backupChain(t, dir)
+	defer live.Stop()
+
+	manifest, err := store.ReadBackupManifest(dir)
+	if err != nil || len(manifest.Backups) != 3 {
+		t.Fatalf("Expected a chain of three backups, got %+v (error: %v)", manifest, err)
+	}
+	if manifest.Backups[2].Parent != manifest.Backups[1].Name || manifest.Backups[2].BaseSeq != manifest.Backups[1].Seq {
+		t.Errorf("Expected each differential to reference its parent, got %+v", manifest.Backups)
+	}
+
+	restored := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer restored.Stop()
+	entry, err := restored.RestoreBackup(dir)
+	if err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if entry.Name != manifest.Backups[2].Name {
+		t.Errorf("Expected the latest backup to be reported, got %s", entry.Name)
+	}
+	if got, want := contentHashOf(t, restored), contentHashOf(t, live); got != want {
+		t.Errorf("Expected the restored content hash %s to match the live store's %s", got, want)
+	}
+	if versions, err := restored.GetAllVersions("a"); err != nil || len(versions) != 3 || versions[2] != "a3" {
+		t.Errorf("Expected the full history of 'a' to be restored, got %v (error: %v)", versions, err)
+	}
+	for _, key := range []string{"b", "e"} {
+		if _, err := restored.Get(key); !errors.Is(err, store.ErrKeyNotFound) {
+			t.Errorf("Expected deleted key %s to stay deleted, got error %v", key, err)
+		}
+	}
+	if restored.LastSequence() < entry.Seq {
+		t.Errorf("Expected the sequence to continue from %d, got %d", entry.Seq, restored.LastSequence())
+	}
+}
+
+func TestDifferentialBackupWithoutTrackedChanges(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.NewKeyValueStore(path, encryptionKey, 0, time.Minute)
+	kvStore.Set("a", "a1", 0)
+	kvStore.Set("b", "b1", 0)
+	takeBackup(t, kvStore, dir, store.BackupFull, 2)
+	kvStore.Stop()
+
+	// A restarted store has no record of what changed, so it compares with the chain.
+	reopened := store.NewKeyValueStore(path, encryptionKey, 0, time.Minute)
+	defer reopened.Stop()
+	reopened.Set("b", "b2", 0)
+	takeBackup(t, reopened, dir, store.BackupDiff, 1)
+	takeBackup(t, reopened, dir, store.BackupDiff, 0)
+
+	restored := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer restored.Stop()
+	if _, err := restored.RestoreBackup(dir); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if got, want := contentHashOf(t, restored), contentHashOf(t, reopened); got != want {
+		t.Errorf("Expected the restored content hash %s to match the live store's %s", got, want)
+	}
+}
+
+func TestRestoreRefusesBrokenChains(t *testing.T) {
+	dir := t.TempDir()
+	live := backupChain(t, dir)
+	defer live.Stop()
+	manifest, _ := store.ReadBackupManifest(dir)
+
+	restoreFrom := func(manifest store.BackupManifest) error {
+		broken := t.TempDir()
+		for _, entry := range manifest.Backups {
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name))
+			if err != nil {
+				t.Fatalf("Failed to read backup: %v", err)
+			}
+			os.WriteFile(filepath.Join(broken, entry.Name), data, 0644)
+		}
+		data, _ := json.Marshal(manifest)
+		os.WriteFile(filepath.Join(broken, "manifest.json"), data, 0644)
+
+		kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+		defer kvStore.Stop()
+		_, err := kvStore.RestoreBackup(broken)
+		return err
+	}
+
+	gap := store.BackupManifest{Backups: []store.BackupEntry{manifest.Backups[0], manifest.Backups[2]}}
+	if err := restoreFrom(gap); !errors.Is(err, store.ErrBackupChain) {
+		t.Errorf("Expected a missing differential to be refused, got %v", err)
+	}
+	noBase := store.BackupManifest{Backups: manifest.Backups[1:]}
+	if err := restoreFrom(noBase); !errors.Is(err, store.ErrBackupChain) {
+		t.Errorf("Expected a chain without a full backup to be refused, got %v", err)
+	}
+	tampered := store.BackupManifest{Backups: append([]store.BackupEntry(nil), manifest.Backups...)}
+	tampered.Backups[1].ContentHash = "0"
+	if err := restoreFrom(tampered); !errors.Is(err, store.ErrBackupChain) {
+		t.Errorf("Expected a content hash mismatch to be refused, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, manifest.Backups[1].Name), []byte("corrupt"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt backup: %v", err)
+	}
+	if err := restoreFrom(manifest); !errors.Is(err, store.ErrBackupChain) {
+		t.Errorf("Expected a corrupt backup file to be refused, got %v", err)
+	}
+
+	if _, err := live.Backup(t.TempDir(), store.BackupDiff); !errors.Is(err, store.ErrBackupChain) {
+		t.Errorf("Expected a differential without a full backup to fail, got %v", err)
+	}
+}
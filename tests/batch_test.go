@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestBatch(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("stale", "x", 0)
+	events := allEvents(kvStore)
+
+	ops := []store.Update{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "2"},
+		{Key: "a", Value: "3"},
+		{Key: "stale", Delete: true},
+		{Key: "missing", Delete: true},
+	}
+	if err := kvStore.Batch(ops); err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	if a, _ := kvStore.Get("a"); a != "3" {
+		t.Errorf("Expected operations to apply in order, got a=%q", a)
+	}
+	if _, err := kvStore.Get("stale"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected stale to be deleted, got %v", err)
+	}
+	want := fmt.Sprint([]string{"added:a", "added:b", "updated:a", "deleted:stale"})
+	if got := fmt.Sprint(*events); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestBatchIsAllOrNothing(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("locked", "v", 0)
+	kvStore.MarkImmutable("locked")
+	kvStore.RegisterPreWriteHook("num:", func(key, value string) (string, string, error) {
+		if value == "" {
+			return "", "", errors.New("empty value")
+		}
+		return key, value, nil
+	})
+
+	for _, bad := range []store.Update{{Key: "num:x", Value: ""}, {Key: "locked", Delete: true}} {
+		err := kvStore.Batch([]store.Update{{Key: "a", Value: "1"}, bad, {Key: "b", Value: "2"}})
+		if err == nil {
+			t.Fatalf("Expected %+v to fail the batch", bad)
+		}
+		if kvStore.Size() != 1 {
+			t.Errorf("Expected nothing to be written when %+v fails, got %v", bad, kvStore.Keys())
+		}
+	}
+}
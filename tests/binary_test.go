@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/sqlitestore"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// blob is a value that is not valid UTF-8.
+var blob = []byte{0x00, 0xff, 0xfe, 'a', 0x80, 0xc3, '"', '\\', 0x01}
+
+// binaryRoundTrip checks that binary and text values survive restarts of the stores returned by open.
+func binaryRoundTrip(t *testing.T, open func() *store.KeyValueStore) {
+	kvStore := open()
+	kvStore.SetBytes("blob", blob, 0)
+	kvStore.SetBytes("blob", append([]byte("v2"), blob...), 0)
+	kvStore.SetBytes("copy", blob, 0)
+	kvStore.Set("text", "héllo", 0)
+	kvStore.Stop()
+
+	reopened := open()
+	defer reopened.Stop()
+	if value, err := reopened.GetBytes("blob"); err != nil || !bytes.Equal(value, append([]byte("v2"), blob...)) {
+		t.Errorf("Expected the binary value to survive, got %q (%v)", value, err)
+	}
+	if value, err := reopened.GetVersion("blob", 0); err != nil || value != string(blob) {
+		t.Errorf("Expected the binary history to survive, got %q (%v)", value, err)
+	}
+	if value, err := reopened.GetBytes("copy"); err != nil || !bytes.Equal(value, blob) {
+		t.Errorf("Expected the copy to survive, got %q (%v)", value, err)
+	}
+	if value, err := reopened.Get("text"); err != nil || value != "héllo" {
+		t.Errorf("Expected the text value to survive, got %q (%v)", value, err)
+	}
+}
+
+func TestBinaryValuesSurviveRestart(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "data.json")
+		binaryRoundTrip(t, func() *store.KeyValueStore {
+			return store.New(filePath, store.WithEncryptionKey(encryptionKey))
+		})
+	})
+	t.Run("deduplicated", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "data.json")
+		binaryRoundTrip(t, func() *store.KeyValueStore {
+			return store.New(filePath, store.WithEncryptionKey(encryptionKey), store.WithValueDeduplication(0))
+		})
+	})
+	t.Run("hashed keys", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "data.json")
+		binaryRoundTrip(t, func() *store.KeyValueStore {
+			return store.New(filePath, store.WithEncryptionKey(encryptionKey), store.WithKeyHashing(keySecret))
+		})
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := sqlitestore.Open(filepath.Join(t.TempDir(), "data.db"))
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		binaryRoundTrip(t, func() *store.KeyValueStore {
+			return store.New("", store.WithRecordPersister(db))
+		})
+	})
+}
+
+func TestBinaryValuesSurviveKeyRotationAndBackups(t *testing.T) {
+	kvStore := store.New(filepath.Join(t.TempDir(), "data.json"), store.WithEncryptionKey(encryptionKey))
+	defer kvStore.Stop()
+	kvStore.SetBytes("blob", blob, time.Hour)
+
+	if err := kvStore.RotateEncryptionKey([]byte("fedcba9876543210fedcba9876543210")); err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	if value, _ := kvStore.GetBytes("blob"); !bytes.Equal(value, blob) {
+		t.Fatalf("Expected the binary value to survive key rotation, got %q", value)
+	}
+
+	dir := t.TempDir()
+	takeBackup(t, kvStore, dir, store.BackupFull, 1)
+	kvStore.SetBytes("blob", []byte("replaced"), 0)
+	if _, err := kvStore.RestoreBackup(dir); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if value, _ := kvStore.GetBytes("blob"); !bytes.Equal(value, blob) {
+		t.Errorf("Expected the binary value to be restored, got %q", value)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// buildCLI builds the command-line tool into a temporary directory and returns its path.
+func buildCLI(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "minikeyvalue")
+	if out, err := exec.Command("go", "build", "-o", bin, "github.com/Chahine-tech/minikeyvalue/cmd").CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build the command-line tool: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// runCLI runs the command-line tool with args and returns its exit code and output.
+func runCLI(t *testing.T, bin string, args ...string) (int, string) {
+	t.Helper()
+	out, err := exec.Command(bin, args...).CombinedOutput()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatalf("Failed to run %v: %v", args, err)
+	}
+	if exit != nil {
+		return exit.ExitCode(), string(out)
+	}
+	return 0, string(out)
+}
+
+// exitCodeFor returns the exit code of errors of kind.
+func exitCodeFor(t *testing.T, kind errs.Kind) int {
+	t.Helper()
+	code, ok := errs.ExitCodeFor(kind)
+	if !ok {
+		t.Fatalf("No exit code for %s", kind)
+	}
+	return code
+}
+
+func TestCLIBackupVerifyRestoreExitCodes(t *testing.T) {
+	bin := buildCLI(t)
+	dir := t.TempDir()
+	dataFile, copyFile, backupDir := filepath.Join(dir, "data.json"), filepath.Join(dir, "copy.json"), filepath.Join(dir, "backups")
+	key := "-key=" + string(encryptionKey)
+
+	kvStore := store.NewKeyValueStore(dataFile, encryptionKey, 0, time.Minute)
+	kvStore.Set("a", "1", 0)
+	kvStore.Set("b", "2", 0)
+	if err := kvStore.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	kvStore.Stop()
+	data, err := os.ReadFile(dataFile)
+	if err != nil {
+		t.Fatalf("Failed to read data file: %v", err)
+	}
+	if err := os.WriteFile(copyFile, data, 0644); err != nil {
+		t.Fatalf("Failed to copy data file: %v", err)
+	}
+
+	if code, out := runCLI(t, bin, "backup", key, dataFile, backupDir); code != 0 {
+		t.Fatalf("Expected backup to exit 0, got %d: %s", code, out)
+	}
+	if code, out := runCLI(t, bin, "verify", key, dataFile, copyFile); code != 0 {
+		t.Errorf("Expected verify of matching files to exit 0, got %d: %s", code, out)
+	}
+
+	kvStore = store.NewKeyValueStore(dataFile, encryptionKey, 0, time.Minute)
+	kvStore.Set("c", "3", 0)
+	if err := kvStore.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	kvStore.Stop()
+	if code, out := runCLI(t, bin, "verify", key, dataFile, copyFile); code != 1 {
+		t.Errorf("Expected verify of diverging files to exit 1, got %d: %s", code, out)
+	}
+
+	if code, out := runCLI(t, bin, "restore", key, backupDir, dataFile); code != 0 {
+		t.Fatalf("Expected restore to exit 0, got %d: %s", code, out)
+	}
+	if code, out := runCLI(t, bin, "verify", key, dataFile, copyFile); code != 0 {
+		t.Errorf("Expected the restored file to match, got %d: %s", code, out)
+	}
+
+	// Failures exit with the code of their kind.
+	invalid, notFound := exitCodeFor(t, errs.InvalidArgument), exitCodeFor(t, errs.NotFound)
+	if code, out := runCLI(t, bin, "verify", key, dataFile); code != invalid {
+		t.Errorf("Expected a missing argument to exit %d, got %d: %s", invalid, code, out)
+	}
+	if code, out := runCLI(t, bin, "verify", key, dataFile, filepath.Join(dir, "missing.json")); code != notFound {
+		t.Errorf("Expected a missing backup file to exit %d, got %d: %s", notFound, code, out)
+	}
+	if code, out := runCLI(t, bin, "backup", key, "-mode=partial", dataFile, backupDir); code != invalid {
+		t.Errorf("Expected an unknown mode to exit %d, got %d: %s", invalid, code, out)
+	}
+	if code, out := runCLI(t, bin, "restore", key, "-strategy=newest", backupDir, dataFile); code != invalid {
+		t.Errorf("Expected an unknown strategy to exit %d, got %d: %s", invalid, code, out)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/client"
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+var (
+	clientKey     = []byte("client-key-the-server-never-has!")
+	nextClientKey = []byte("rotated-client-key-32-bytes-long")
+)
+
+// encryptedClient returns a client over s with key.
+func encryptedClient(t *testing.T, s client.Store, key []byte, opts ...client.Option) *client.Encrypted {
+	t.Helper()
+	c, err := client.NewEncrypted(s, key, opts...)
+	if err != nil {
+		t.Fatalf("NewEncrypted failed: %v", err)
+	}
+	return c
+}
+
+func TestClientEncryptionRoundTrip(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	c := encryptedClient(t, kvStore, clientKey)
+
+	c.Set("patient:1", "diagnosis: flu", 0)
+	c.Set("patient:1", "diagnosis: cold", 0)
+
+	stored, err := kvStore.Get("patient:1")
+	if err != nil || !store.IsClientEncrypted(stored) || strings.Contains(stored, "diagnosis") {
+		t.Fatalf("Expected the store to hold marked ciphertext, got %q (error: %v)", stored, err)
+	}
+	if value, err := c.Get("patient:1"); err != nil || value != "diagnosis: cold" {
+		t.Errorf("Expected the decrypted value, got %q (error: %v)", value, err)
+	}
+	if history, err := c.History("patient:1"); err != nil || strings.Join(history, ",") != "diagnosis: flu,diagnosis: cold" {
+		t.Errorf("Expected the decrypted history, got %v (error: %v)", history, err)
+	}
+
+	// Ciphertext is bound to its key.
+	kvStore.Set("patient:2", stored, 0)
+	if _, err := c.Get("patient:2"); err == nil {
+		t.Error("Expected ciphertext copied to another key to fail to decrypt")
+	}
+	if _, err := encryptedClient(t, kvStore, nextClientKey).Get("patient:1"); err == nil {
+		t.Error("Expected a client with another key to fail to decrypt")
+	}
+	if _, err := client.NewEncrypted(kvStore, []byte("short")); err == nil {
+		t.Error("Expected an invalid key size to be rejected")
+	}
+}
+
+func TestClientEncryptionMixedModeFailsLoudly(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	c := encryptedClient(t, kvStore, clientKey)
+
+	kvStore.Set("plain", "not encrypted", 0)
+	if value, err := c.Get("plain"); !errors.Is(err, client.ErrNotClientEncrypted) {
+		t.Errorf("Expected ErrNotClientEncrypted, got %q (error: %v)", value, err)
+	}
+
+	// Store features needing the plaintext refuse client-encrypted values.
+	c.Set("secret", "value", 0)
+	if _, _, err := kvStore.GetDecoded("secret"); !errors.Is(err, store.ErrClientEncrypted) {
+		t.Errorf("Expected GetDecoded to report ErrClientEncrypted, got %v", err)
+	}
+	kvStore.RegisterPreWriteHook("validated:", func(key, value string) (string, string, error) {
+		return key, value, nil
+	})
+	err := c.Set("validated:x", "value", 0)
+	if !errors.Is(err, store.ErrClientEncrypted) || errs.KindOf(err) != errs.InvalidArgument {
+		t.Errorf("Expected the hook to reject the client-encrypted value, got %v", err)
+	}
+}
+
+func TestClientEncryptionHashesKeys(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	c := encryptedClient(t, kvStore, clientKey, client.WithKeyHMAC([]byte("key secret")))
+
+	c.Set("jane@example.com", "value", 0)
+	if keys := kvStore.Keys(); len(keys) != 1 || strings.Contains(keys[0], "jane") {
+		t.Errorf("Expected only a hashed key in the store, got %v", keys)
+	}
+	if value, err := c.Get("jane@example.com"); err != nil || value != "value" {
+		t.Errorf("Expected the decrypted value, got %q (error: %v)", value, err)
+	}
+	if _, err := c.RotatePrefix("jane", c); err == nil {
+		t.Error("Expected rotation by prefix to be refused for hashed keys")
+	}
+}
+
+func TestClientEncryptionRotatePrefix(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	old := encryptedClient(t, kvStore, clientKey)
+	next := encryptedClient(t, kvStore, nextClientKey)
+
+	old.Set("tenant:a", "1", 0)
+	old.Set("tenant:b", "2", time.Hour)
+	old.Set("other:c", "3", 0)
+
+	n, err := old.RotatePrefix("tenant:", next)
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 keys to be rotated, got %d (error: %v)", n, err)
+	}
+	for key, want := range map[string]string{"tenant:a": "1", "tenant:b": "2"} {
+		if value, err := next.Get(key); err != nil || value != want {
+			t.Errorf("Expected %s=%q under the new key, got %q (error: %v)", key, want, value, err)
+		}
+		if _, err := old.Get(key); err == nil {
+			t.Errorf("Expected %s to be unreadable with the old key", key)
+		}
+	}
+	if _, ttl, _ := kvStore.GetWithTTL("tenant:b"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected the TTL to be kept, got %v", ttl)
+	}
+	if value, err := old.Get("other:c"); err != nil || value != "3" {
+		t.Errorf("Expected keys outside the prefix to keep the old key, got %q (error: %v)", value, err)
+	}
+}
+
+// racingStore runs race once, right after the first GetWithTTL, like a write landing mid-rotation.
+type racingStore struct {
+	*store.KeyValueStore
+	race func()
+}
+
+func (s *racingStore) GetWithTTL(key string) (string, time.Duration, error) {
+	value, ttl, err := s.KeyValueStore.GetWithTTL(key)
+	if race := s.race; race != nil {
+		s.race = nil
+		race()
+	}
+	return value, ttl, err
+}
+
+func TestClientEncryptionRotatePrefixConcurrentWrite(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	writer := encryptedClient(t, kvStore, clientKey)
+	next := encryptedClient(t, kvStore, nextClientKey)
+	writer.Set("tenant:a", "1", 0)
+
+	racing := &racingStore{KeyValueStore: kvStore, race: func() { writer.Set("tenant:a", "2", 0) }}
+	old, err := client.NewEncrypted(racing, clientKey)
+	if err != nil {
+		t.Fatalf("NewEncrypted failed: %v", err)
+	}
+	if n, err := old.RotatePrefix("tenant:", next); err != nil || n != 1 {
+		t.Fatalf("Expected 1 key to be rotated, got %d (error: %v)", n, err)
+	}
+	if value, err := next.Get("tenant:a"); err != nil || value != "2" {
+		t.Errorf("Expected the concurrent write to be rotated, not overwritten, got %q (error: %v)", value, err)
+	}
+}
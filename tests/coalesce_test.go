@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestWriteCoalescing(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 1*time.Minute,
+		store.WithWriteCoalescing("telemetry:", 100*time.Millisecond))
+	defer kvStore.Stop()
+
+	for i := 0; i < 50; i++ {
+		if err := kvStore.Set("telemetry:device1", fmt.Sprintf("%d", i), 0); err != nil {
+			t.Fatalf("Failed to set key: %v", err)
+		}
+		// Writers read their own writes while the window is open.
+		if value, err := kvStore.Get("telemetry:device1"); err != nil || value != fmt.Sprintf("%d", i) {
+			t.Fatalf("Expected pending value %d, got %q (error: %v)", i, value, err)
+		}
+	}
+	// Other readers show the pending write as the version it will be committed as.
+	if history, err := kvStore.GetHistory("telemetry:device1"); err != nil || len(history) != 1 || history[0].Value != "49" {
+		t.Errorf("Expected the pending write as the only version, got %+v (error: %v)", history, err)
+	}
+	if value, ttl, err := kvStore.GetWithTTL("telemetry:device1"); err != nil || value != "49" || ttl != store.NoExpiration {
+		t.Errorf("Expected the pending value without expiration, got %q, %v (error: %v)", value, ttl, err)
+	}
+	if keys := kvStore.Keys(); len(keys) != 1 || keys[0] != "telemetry:device1" {
+		t.Errorf("Expected the pending key to be listed, got %v", keys)
+	}
+	if size := kvStore.Size(); size != 1 {
+		t.Errorf("Expected size 1 with a pending key, got %d", size)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	history, err := kvStore.GetHistory("telemetry:device1")
+	if err != nil || len(history) != 1 {
+		t.Fatalf("Expected a single committed version, got %v (error: %v)", history, err)
+	}
+	if history[0].Value != "49" || history[0].Collapsed != 49 {
+		t.Errorf("Expected value '49' with 49 collapsed writes, got %+v", history[0])
+	}
+
+	// Keys outside the prefix are not coalesced.
+	kvStore.Set("config", "a", 0)
+	kvStore.Set("config", "b", 0)
+	if versions, _ := kvStore.GetAllVersions("config"); len(versions) != 2 {
+		t.Errorf("Expected 2 versions for an uncoalesced key, got %v", versions)
+	}
+
+	// Explicit-TTL writes and CompareAndSwap bypass coalescing, after committing the pending value.
+	kvStore.Set("telemetry:device2", "a", 0)
+	kvStore.Set("telemetry:device2", "b", time.Hour)
+	if versions, _ := kvStore.GetAllVersions("telemetry:device2"); len(versions) != 2 || versions[1] != "b" {
+		t.Errorf("Expected pending and TTL writes as 2 versions, got %v", versions)
+	}
+	kvStore.Set("telemetry:device3", "a", 0)
+	swapped, err := kvStore.CompareAndSwap("telemetry:device3", "a", "b", 0)
+	if err != nil || !swapped {
+		t.Errorf("Expected CompareAndSwap against the pending value to succeed, got %v (error: %v)", swapped, err)
+	}
+	if versions, _ := kvStore.GetAllVersions("telemetry:device3"); len(versions) != 2 {
+		t.Errorf("Expected 2 versions after CompareAndSwap, got %v", versions)
+	}
+}
+
+func TestWriteCoalescingFlushOnStop(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute,
+		store.WithWriteCoalescing("", time.Hour))
+	kvStore.Set("name", "Jane", 0)
+	kvStore.Set("name", "John", 0)
+	kvStore.Stop()
+
+	reloaded := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute)
+	defer reloaded.Stop()
+	if value, err := reloaded.Get("name"); err != nil || value != "John" {
+		t.Fatalf("Expected 'John' after reload, got %q (error: %v)", value, err)
+	}
+	history, err := reloaded.GetHistory("name")
+	if err != nil || len(history) != 1 || history[0].Value != "John" || history[0].Collapsed != 1 {
+		t.Errorf("Expected the pending write to be flushed on Stop, got %+v (error: %v)", history, err)
+	}
+}
+
+func TestWriteCoalescingExpiry(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 1*time.Minute,
+		store.WithWriteCoalescing("telemetry:", time.Hour), store.WithCopyOnWriteIndex())
+	defer kvStore.Stop()
+
+	kvStore.Set("telemetry:device1", "a", 50*time.Millisecond)
+	// The pending write clears the TTL as the write it stands for does.
+	kvStore.Set("telemetry:device1", "b", 0)
+	time.Sleep(100 * time.Millisecond)
+	if value, err := kvStore.Get("telemetry:device1"); err != nil || value != "b" {
+		t.Errorf("Expected the pending value 'b', got %q (error: %v)", value, err)
+	}
+
+	kvStore.Set("telemetry:device2", "a", 0)
+	kvStore.Set("telemetry:device2", "b", 0)
+	if keys := kvStore.Keys(); len(keys) != 2 {
+		t.Errorf("Expected each key listed once, got %v", keys)
+	}
+}
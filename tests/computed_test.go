@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// fakeTicker hands out tick channels that the test fires by hand.
+type fakeTicker struct {
+	mu    sync.Mutex
+	ticks []chan time.Time
+}
+
+func (f *fakeTicker) newTicker(every time.Duration) (<-chan time.Time, func()) {
+	ticks := make(chan time.Time)
+	f.mu.Lock()
+	f.ticks = append(f.ticks, ticks)
+	f.mu.Unlock()
+	return ticks, func() {}
+}
+
+// tick fires the ticker of the i-th registered computed key and waits for the tick to be taken.
+func (f *fakeTicker) tick(i int) {
+	f.mu.Lock()
+	ticks := f.ticks[i]
+	f.mu.Unlock()
+	ticks <- time.Now()
+}
+
+// waitForRuns waits until the computed key has run at least runs times and returns its status.
+func waitForRuns(t *testing.T, kvStore *store.KeyValueStore, key string, runs int) store.ComputedStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, status := range kvStore.ComputedStats() {
+			if status.Key == key && status.Runs >= runs {
+				return status
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Computed key %s did not run %d times", key, runs)
+	return store.ComputedStatus{}
+}
+
+// countSessions counts the keys starting with "session:".
+func countSessions(view store.ReadView) (string, error) {
+	n := 0
+	for _, key := range view.Keys() {
+		if strings.HasPrefix(key, "session:") {
+			n++
+		}
+	}
+	return strconv.Itoa(n), nil
+}
+
+func TestComputedKeyRecomputesOnSchedule(t *testing.T) {
+	var clock fakeTicker
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithComputedTicker(clock.newTicker))
+	defer kvStore.Stop()
+
+	kvStore.Set("session:a", "1", 0)
+	if err := kvStore.RegisterComputed("stats:total_sessions", time.Minute, countSessions, store.ComputedTTL(time.Hour)); err != nil {
+		t.Fatalf("RegisterComputed failed: %v", err)
+	}
+	waitForRuns(t, kvStore, "stats:total_sessions", 1)
+	if value, err := kvStore.Get("stats:total_sessions"); err != nil || value != "1" {
+		t.Errorf("Expected the value to be computed on registration, got %q (error: %v)", value, err)
+	}
+
+	kvStore.Set("session:b", "1", 0)
+	clock.tick(0)
+	waitForRuns(t, kvStore, "stats:total_sessions", 2)
+	if versions, err := kvStore.GetAllVersions("stats:total_sessions"); err != nil || len(versions) != 2 || versions[1] != "2" {
+		t.Errorf("Expected a new version after the tick, got %v (error: %v)", versions, err)
+	}
+	if _, ttl, err := kvStore.GetWithTTL("stats:total_sessions"); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected the computed value to carry its TTL, got %v (error: %v)", ttl, err)
+	}
+	if !kvStore.IsComputed("stats:total_sessions") || kvStore.IsComputed("session:a") {
+		t.Error("Expected only the registered key to be computed")
+	}
+	if err := kvStore.RegisterComputed("stats:total_sessions", time.Minute, countSessions); err == nil {
+		t.Error("Expected registering a key twice to fail")
+	}
+}
+
+func TestComputedKeyFailureKeepsPreviousValue(t *testing.T) {
+	var clock fakeTicker
+	var events eventRecorder
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithComputedTicker(clock.newTicker))
+	defer kvStore.Stop()
+	kvStore.RegisterNotificationListener(events.record)
+
+	var mu sync.Mutex
+	fail := false
+	err := kvStore.RegisterComputed("stats:flaky", time.Minute, func(view store.ReadView) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return "", errors.New("upstream unavailable")
+		}
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterComputed failed: %v", err)
+	}
+	waitForRuns(t, kvStore, "stats:flaky", 1)
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	clock.tick(0)
+	status := waitForRuns(t, kvStore, "stats:flaky", 2)
+	if status.Failures != 1 || status.LastError != "upstream unavailable" || status.LastSuccess.After(status.LastRun) {
+		t.Errorf("Expected the failure to be recorded, got %+v", status)
+	}
+	if value, err := kvStore.Get("stats:flaky"); err != nil || value != "ok" {
+		t.Errorf("Expected the previous value to be kept, got %q (error: %v)", value, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !events.has("computed_failed:stats:flaky") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !events.has("computed_failed:stats:flaky") {
+		t.Error("Expected a computed_failed notification")
+	}
+
+	// A panicking function counts as a failure instead of crashing the store.
+	if err := kvStore.RegisterComputed("stats:panics", time.Minute, func(store.ReadView) (string, error) {
+		panic("boom")
+	}); err != nil {
+		t.Fatalf("RegisterComputed failed: %v", err)
+	}
+	if status := waitForRuns(t, kvStore, "stats:panics", 1); status.Failures != 1 || !strings.Contains(status.LastError, "boom") {
+		t.Errorf("Expected the panic to be recorded as a failure, got %+v", status)
+	}
+}
+
+func TestComputedKeyRejectsClientWrites(t *testing.T) {
+	var clock fakeTicker
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithComputedTicker(clock.newTicker))
+	defer kvStore.Stop()
+
+	if err := kvStore.RegisterComputed("stats:total", time.Minute, func(store.ReadView) (string, error) { return "42", nil }); err != nil {
+		t.Fatalf("RegisterComputed failed: %v", err)
+	}
+	waitForRuns(t, kvStore, "stats:total", 1)
+
+	if err := kvStore.Set("stats:total", "0", 0); !errors.Is(err, store.ErrComputedKey) {
+		t.Errorf("Expected Set to be rejected, got %v", err)
+	}
+	if _, err := kvStore.CompareAndSwap("stats:total", "42", "0", 0); !errors.Is(err, store.ErrComputedKey) {
+		t.Errorf("Expected CompareAndSwap to be rejected, got %v", err)
+	}
+	if result := kvStore.SetMany([]store.Entry{{Key: "stats:total", Value: "0"}, {Key: "other", Value: "1"}}); !errors.Is(result.Errors["stats:total"], store.ErrComputedKey) || len(result.Created) != 1 {
+		t.Errorf("Expected only the computed key to be rejected from SetMany, got %+v", result)
+	}
+	if err := kvStore.Delete("stats:total"); !errors.Is(err, store.ErrComputedKey) {
+		t.Errorf("Expected Delete to be rejected, got %v", err)
+	}
+	if _, err := kvStore.DeleteByPrefix("stats:"); !errors.Is(err, store.ErrComputedKey) {
+		t.Errorf("Expected DeleteByPrefix to be rejected, got %v", err)
+	}
+	if value, _ := kvStore.Get("stats:total"); value != "42" {
+		t.Errorf("Expected the computed value to be untouched, got %q", value)
+	}
+
+	forced := store.WithComputedOverride(context.Background())
+	if err := kvStore.SetContext(forced, "stats:total", "7", 0); err != nil {
+		t.Fatalf("Expected a forced write to succeed, got %v", err)
+	}
+	if value, _ := kvStore.Get("stats:total"); value != "7" {
+		t.Errorf("Expected the forced value, got %q", value)
+	}
+}
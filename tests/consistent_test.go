@@ -0,0 +1,127 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestGetManyConsistentReportsVersions(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+
+	kvStore.Set("config", "v1", 0)
+	kvStore.Set("config", "v2", 0)
+	kvStore.Set("session", "abc", time.Hour)
+	kvStore.Set("gone", "x", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	values, seq, err := kvStore.GetManyConsistent([]string{"config", "session", "gone", "missing"})
+	if err != nil {
+		t.Fatalf("GetManyConsistent failed: %v", err)
+	}
+	if seq != kvStore.LastSequence() {
+		t.Errorf("Expected sequence %d, got %d", kvStore.LastSequence(), seq)
+	}
+	if len(values) != 2 {
+		t.Fatalf("Expected only live keys to be returned, got %v", values)
+	}
+	config := values["config"]
+	if config.Value != "v2" || config.Version != 1 || config.Revision == 0 || config.Timestamp.IsZero() || !config.ExpiresAt.IsZero() {
+		t.Errorf("Unexpected info for 'config': %+v", config)
+	}
+	if value, _ := kvStore.GetVersion("config", config.Version); value != config.Value {
+		t.Errorf("Expected the version index to address the value, got %q", value)
+	}
+	if session := values["session"]; session.ExpiresAt.IsZero() {
+		t.Errorf("Expected 'session' to report its expiration, got %+v", session)
+	}
+}
+
+func TestGetManyConsistentRevisionsSurviveReload(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute)
+	kvStore.Set("a", "1", 0)
+	kvStore.Set("b", "1", 0)
+	values, _, _ := kvStore.GetManyConsistent([]string{"a", "b"})
+	kvStore.Stop()
+
+	reopened := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute)
+	defer reopened.Stop()
+	loaded, _, err := reopened.GetManyConsistent([]string{"a", "b"})
+	if err != nil {
+		t.Fatalf("GetManyConsistent failed: %v", err)
+	}
+	if loaded["a"].Revision != values["a"].Revision || loaded["b"].Revision != values["b"].Revision {
+		t.Errorf("Expected revisions %+v after reload, got %+v", values, loaded)
+	}
+	reopened.Set("a", "2", 0)
+	if updated, _, _ := reopened.GetManyConsistent([]string{"a"}); updated["a"].Revision <= values["b"].Revision {
+		t.Errorf("Expected a write after reload to get a newer revision than %d, got %d", values["b"].Revision, updated["a"].Revision)
+	}
+}
+
+func TestGetManyConsistentNeverSeesTornWrites(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	kvStore.SetMany([]store.Entry{{Key: "from", Value: "0"}, {Key: "to", Value: "0"}})
+
+	const writers, writes, readers = 4, 200, 4
+	var writeWG, readWG sync.WaitGroup
+	done := make(chan struct{})
+	for w := 0; w < writers; w++ {
+		writeWG.Add(1)
+		go func(w int) {
+			defer writeWG.Done()
+			for i := 0; i < writes; i++ {
+				n := strconv.Itoa(w*writes + i + 1)
+				kvStore.SetMany([]store.Entry{{Key: "from", Value: n}, {Key: "to", Value: n}})
+			}
+		}(w)
+	}
+
+	failures := make(chan string, readers)
+	for r := 0; r < readers; r++ {
+		readWG.Add(1)
+		go func() {
+			defer readWG.Done()
+			var lastSeq uint64
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				values, seq, err := kvStore.GetManyConsistent([]string{"from", "to"})
+				from, to := values["from"], values["to"]
+				switch {
+				case err != nil:
+					failures <- err.Error()
+				case from.Value != to.Value || from.Version != to.Version:
+					failures <- "torn read: " + from.Value + " / " + to.Value
+				case seq < lastSeq:
+					failures <- "sequence went backwards"
+				default:
+					lastSeq = seq
+					continue
+				}
+				return
+			}
+		}()
+	}
+
+	writeWG.Wait()
+	close(done)
+	readWG.Wait()
+	close(failures)
+	for msg := range failures {
+		t.Error(msg)
+	}
+	if versions, _ := kvStore.GetAllVersions("from"); len(versions) != writers*writes+1 {
+		t.Errorf("Expected %d versions, got %d", writers*writes+1, len(versions))
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// slowBackend delays every save to simulate a slow disk.
+type slowBackend struct {
+	*store.MemoryBackend
+	delay time.Duration
+}
+
+func (b *slowBackend) Save(data []byte) error {
+	time.Sleep(b.delay)
+	return b.MemoryBackend.Save(data)
+}
+
+func TestContentionReportSurfacesSlowSave(t *testing.T) {
+	backend := &slowBackend{MemoryBackend: store.NewMemoryBackend(), delay: 100 * time.Millisecond}
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, 1*time.Minute,
+		store.WithBackend(backend), store.WithContentionProfiling(50*time.Millisecond))
+
+	if err := kvStore.Set("name", "John", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	kvStore.Get("name")
+
+	// Writes issued during the save have to wait for it to finish.
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(20 * time.Millisecond)
+			kvStore.Set(fmt.Sprintf("key-%d", i), "value", 0)
+		}(i)
+	}
+	kvStore.Stop()
+	wg.Wait()
+
+	report := kvStore.ContentionReport()
+	if len(report.LongestHolds) == 0 {
+		t.Fatalf("Expected lock holds in the report")
+	}
+	longest := report.LongestHolds[0]
+	if longest.Op != store.OpSave || longest.Mode != store.LockRead || longest.Duration < 100*time.Millisecond {
+		t.Errorf("Expected the save to be the longest hold, got %+v", longest)
+	}
+
+	if len(report.Waits) == 0 {
+		t.Fatalf("Expected lock waits in the report")
+	}
+	worst := report.Waits[0]
+	if worst.Op != store.OpSet || worst.Mode != store.LockWrite || worst.Max < 50*time.Millisecond {
+		t.Errorf("Expected the sets blocked by the save to have the worst wait, got %+v", worst)
+	}
+}
+
+func TestContentionReportDisabled(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 1*time.Minute)
+	defer kvStore.Stop()
+
+	kvStore.Set("name", "John", 0)
+	if report := kvStore.ContentionReport(); len(report.Waits) != 0 || len(report.LongestHolds) != 0 {
+		t.Errorf("Expected an empty report without profiling, got %+v", report)
+	}
+}
+
+func benchmarkSetGet(b *testing.B, opts ...store.Option) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	kvStore := store.NewKeyValueStore("", nil, 0, 1*time.Minute, append([]store.Option{store.WithBackend(store.NewMemoryBackend())}, opts...)...)
+	defer kvStore.Stop()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := fmt.Sprintf("key-%d", i%100)
+			if i%4 == 0 {
+				kvStore.Set(key, "value", 0)
+			} else {
+				kvStore.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkContentionProfiling(b *testing.B) {
+	b.Run("Disabled", func(b *testing.B) { benchmarkSetGet(b) })
+	b.Run("Enabled", func(b *testing.B) { benchmarkSetGet(b, store.WithContentionProfiling(0)) })
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// flagPayload returns an incompressible feature flag payload of about size bytes.
+func flagPayload(size int) string {
+	raw := make([]byte, size*3/4)
+	rand.Read(raw)
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// expectDedup checks the distinct pooled values and references of kvStore.
+func expectDedup(t *testing.T, kvStore *store.KeyValueStore, values, refs int) store.DedupStats {
+	t.Helper()
+	stats := kvStore.DedupStats()
+	if !stats.Enabled || stats.PoolValues != values || stats.References != refs {
+		t.Fatalf("Expected %d pooled values with %d references, got %+v", values, refs, stats)
+	}
+	return stats
+}
+
+func TestValueDeduplicationCountsReferences(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithValueDeduplication(64))
+	defer kvStore.Stop()
+
+	a, b := flagPayload(1024), flagPayload(512)
+	for i := 0; i < 10; i++ {
+		kvStore.Set(fmt.Sprintf("flags:a:%d", i), strings.Clone(a), 0)
+	}
+	for i := 0; i < 5; i++ {
+		kvStore.Set(fmt.Sprintf("flags:b:%d", i), strings.Clone(b), 0)
+	}
+	kvStore.Set("small", "below the threshold", 0)
+	stats := expectDedup(t, kvStore, 2, 15)
+	if stats.PoolBytes != int64(len(a)+len(b)) || stats.LogicalBytes != int64(10*len(a)+5*len(b)) {
+		t.Errorf("Unexpected pool sizes %+v", stats)
+	}
+	if stats.BytesSaved != int64(9*len(a)+4*len(b)) || stats.Ratio <= 5 {
+		t.Errorf("Unexpected savings %+v", stats)
+	}
+
+	// Every version of a history holds a reference until pruned.
+	for _, value := range []string{a, b, a, b} {
+		kvStore.Set("flags:history", strings.Clone(value), 0)
+	}
+	expectDedup(t, kvStore, 2, 19)
+	if removed, err := kvStore.PruneHistory("flags:history", 1); err != nil || removed != 3 {
+		t.Fatalf("Expected 3 versions pruned, got %d (error: %v)", removed, err)
+	}
+	expectDedup(t, kvStore, 2, 16)
+
+	for i := 0; i < 5; i++ {
+		kvStore.Delete(fmt.Sprintf("flags:a:%d", i))
+		kvStore.Delete(fmt.Sprintf("flags:b:%d", i))
+	}
+	expectDedup(t, kvStore, 2, 6)
+	kvStore.Delete("flags:history")
+	expectDedup(t, kvStore, 1, 5)
+
+	// Overwriting with a new value adds a reference without dropping the old version's.
+	kvStore.Set("flags:a:9", strings.Clone(b), 0)
+	expectDedup(t, kvStore, 2, 6)
+	if value, _ := kvStore.Get("flags:a:9"); value != b {
+		t.Error("Expected Get to return the pooled value")
+	}
+	if value, _ := kvStore.GetVersion("flags:a:9", 0); value != a {
+		t.Error("Expected the previous version to keep its pooled value")
+	}
+	for i := 5; i < 10; i++ {
+		kvStore.Delete(fmt.Sprintf("flags:a:%d", i))
+	}
+	if stats := kvStore.DedupStats(); stats.PoolValues != 0 || stats.PoolBytes != 0 || stats.Ratio != 1 {
+		t.Errorf("Expected an empty pool, got %+v", stats)
+	}
+}
+
+func TestValueDeduplicationRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	// Payloads larger than the compression window, which would otherwise find most of the copies.
+	var flags []string
+	for i := 0; i < 8; i++ {
+		flags = append(flags, flagPayload(40<<10))
+	}
+	fill := func(path string, opts ...store.Option) int64 {
+		kvStore := store.NewKeyValueStore(path, encryptionKey, 0, time.Minute, opts...)
+		for i := 0; i < 64; i++ {
+			kvStore.Set(fmt.Sprintf("flags:user:%d", i), strings.Clone(flags[i%len(flags)]), 0)
+		}
+		kvStore.Set("flags:user:0", strings.Clone(flags[1]), 0)
+		kvStore.Stop()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Expected a data file: %v", err)
+		}
+		return info.Size()
+	}
+	dedupPath, fullPath := filepath.Join(dir, "dedup.json"), filepath.Join(dir, "full.json")
+	dedupSize := fill(dedupPath, store.WithValueDeduplication(0))
+	fullSize := fill(fullPath)
+	if dedupSize*4 > fullSize {
+		t.Errorf("Expected the deduplicated file to be at least 4 times smaller, got %d and %d bytes", dedupSize, fullSize)
+	}
+
+	check := func(kvStore *store.KeyValueStore) {
+		t.Helper()
+		for _, i := range []int{0, 1, 2, 63} {
+			want := flags[i%len(flags)]
+			if i == 0 {
+				want = flags[1]
+			}
+			if value, err := kvStore.Get(fmt.Sprintf("flags:user:%d", i)); err != nil || value != want {
+				t.Errorf("Unexpected value of flags:user:%d (error: %v)", i, err)
+			}
+		}
+		if kvStore.Size() != 64 {
+			t.Errorf("Expected 64 keys, got %d", kvStore.Size())
+		}
+		if value, _ := kvStore.GetVersion("flags:user:0", 0); value != flags[0] {
+			t.Error("Expected the history to survive the round trip")
+		}
+	}
+
+	reloaded := store.NewKeyValueStore(dedupPath, encryptionKey, 0, time.Minute, store.WithValueDeduplication(0))
+	defer reloaded.Stop()
+	check(reloaded)
+	expectDedup(t, reloaded, 8, 65)
+
+	// Stores not deduplicating values read the pooled snapshot too.
+	plain := store.NewKeyValueStore(dedupPath, encryptionKey, 0, time.Minute)
+	defer plain.Stop()
+	check(plain)
+	if plain.DedupStats().Enabled {
+		t.Error("Expected deduplication to stay off")
+	}
+}
+
+func BenchmarkValueDeduplication(b *testing.B) {
+	var flags []string
+	for i := 0; i < 8; i++ {
+		flags = append(flags, flagPayload(40<<10))
+	}
+	for _, tc := range []struct {
+		name string
+		opts []store.Option
+	}{
+		{"Copies", nil},
+		{"Dedup", []store.Option{store.WithValueDeduplication(0)}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			path := filepath.Join(b.TempDir(), "data.json")
+			kvStore := store.NewKeyValueStore(path, encryptionKey, 0, time.Minute, tc.opts...)
+			defer kvStore.Stop()
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			for i := 0; i < b.N; i++ {
+				// Values arriving from clients are separate copies even when identical.
+				kvStore.Set(fmt.Sprintf("flags:user:%d", i), strings.Clone(flags[i%len(flags)]), 0)
+			}
+			b.StopTimer()
+
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			kvStore.Save()
+			info, _ := os.Stat(path)
+			b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-B/key")
+			b.ReportMetric(float64(info.Size())/float64(b.N), "file-B/key")
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestDeliveryWorkersKeepPerKeyOrder(t *testing.T) {
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute,
+		store.WithBackend(store.NewMemoryBackend()), store.WithDeliveryWorkers(4))
+	defer kvStore.Stop()
+
+	const writers, writes = 8, 100
+	keys := []string{"k0", "k1", "k2", "k3", "k4", "k5"}
+
+	var mu sync.Mutex
+	lastSeq := map[string]uint64{}
+	received := 0
+	var inFlight, maxInFlight atomic.Int32
+	id := kvStore.Subscribe("updated:*", writers*writes, func(event string) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if n <= seen || maxInFlight.CompareAndSwap(seen, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Microsecond)
+
+		key, seqText, _ := strings.Cut(strings.TrimPrefix(event, "updated:"), "@")
+		seq, err := strconv.ParseUint(seqText, 10, 64)
+		if err != nil {
+			t.Errorf("Unexpected event %q", event)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if seq <= lastSeq[key] {
+			t.Errorf("Key %s: event %d delivered after %d", key, seq, lastSeq[key])
+		}
+		lastSeq[key] = seq
+		received++
+	})
+
+	for _, key := range keys {
+		kvStore.Set(key, "initial", 0)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				kvStore.Set(keys[(w+i)%len(keys)], fmt.Sprintf("%d-%d", w, i), 0)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if !waitFor(t, 5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return received == writers*writes
+	}) {
+		t.Fatalf("Expected %d updates to be delivered", writers*writes)
+	}
+	if maxInFlight.Load() < 2 {
+		t.Error("Expected events of different keys to be delivered concurrently")
+	}
+
+	for _, info := range kvStore.Subscriptions() {
+		if info.ID != id {
+			continue
+		}
+		if len(info.Workers) != 4 || info.Dropped != 0 {
+			t.Fatalf("Expected 4 workers and no drops, got %+v", info)
+		}
+		busy := 0
+		for _, worker := range info.Workers {
+			if worker.Delivered > 0 {
+				busy++
+			}
+			if worker.Pending != 0 {
+				t.Errorf("Expected worker %d to be drained, got %+v", worker.ID, worker)
+			}
+		}
+		if busy < 2 {
+			t.Errorf("Expected the keys to be spread over several workers, got %+v", info.Workers)
+		}
+	}
+}
+
+func TestSingleDeliveryWorkerByDefault(t *testing.T) {
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(store.NewMemoryBackend()))
+	defer kvStore.Stop()
+	kvStore.Subscribe("", 10, func(string) {})
+	kvStore.Set("a", "1", 0)
+
+	delivered := func() bool {
+		infos := kvStore.Subscriptions()
+		return len(infos) == 1 && len(infos[0].Workers) == 1 && infos[0].Workers[0].Delivered == 1
+	}
+	if !waitFor(t, 2*time.Second, delivered) {
+		t.Errorf("Expected a single worker having delivered the event, got %+v", kvStore.Subscriptions())
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/sqlitestore"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// configVersion returns a large config document differing from the previous version in one line.
+func configVersion(n int) string {
+	var b strings.Builder
+	for line := 0; line < 200; line++ {
+		if line == n%200 {
+			fmt.Fprintf(&b, "setting_%03d = changed in version %d\n", line, n)
+			continue
+		}
+		fmt.Fprintf(&b, "setting_%03d = default value for this setting\n", line)
+	}
+	return b.String()
+}
+
+// expectVersions checks every version of key against want, through GetVersion, GetAllVersions and GetHistory.
+func expectVersions(t *testing.T, kvStore *store.KeyValueStore, key string, want []string) {
+	t.Helper()
+	all, err := kvStore.GetAllVersions(key)
+	if err != nil || len(all) != len(want) {
+		t.Fatalf("Expected %d versions, got %d (error: %v)", len(want), len(all), err)
+	}
+	history, err := kvStore.GetHistory(key)
+	if err != nil || len(history) != len(want) {
+		t.Fatalf("Expected a history of %d versions, got %d (error: %v)", len(want), len(history), err)
+	}
+	for i, value := range want {
+		got, err := kvStore.GetVersion(key, i)
+		if err != nil || got != value {
+			t.Fatalf("Version %d was not reconstructed (error: %v)", i, err)
+		}
+		if all[i] != value || history[i].Value != value || history[i].Delta {
+			t.Fatalf("Version %d differs between GetAllVersions and GetHistory", i)
+		}
+	}
+}
+
+func TestDeltaVersionsReconstruct(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute, store.WithDeltaVersions("config:", 4))
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		want = append(want, configVersion(i))
+		kvStore.Set("config:app", want[i], 0)
+		kvStore.Set("plain", want[i], 0)
+	}
+	if value, err := kvStore.Get("config:app"); err != nil || value != want[9] {
+		t.Fatalf("Expected the latest version in full (error: %v)", err)
+	}
+	expectVersions(t, kvStore, "config:app", want)
+
+	stats := kvStore.DeltaStats()
+	// Versions 0, 4 and 8 are keyframes and version 9 is the latest.
+	if stats.Keys != 1 || stats.DeltaVersions != 6 {
+		t.Errorf("Expected 6 delta versions of one key, got %+v", stats)
+	}
+	if stats.BytesSaved <= 0 || stats.BytesSaved != stats.FullBytes-stats.StoredBytes {
+		t.Errorf("Expected bytes to be saved, got %+v", stats)
+	}
+	if history, _ := kvStore.GetHistory("plain"); len(history) != 10 {
+		t.Errorf("Expected keys outside the prefix to keep all versions, got %d", len(history))
+	}
+
+	if err := kvStore.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	kvStore.Stop()
+
+	reopened := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute, store.WithDeltaVersions("config:", 4))
+	defer reopened.Stop()
+	if value, err := reopened.Get("config:app"); err != nil || value != want[9] {
+		t.Fatalf("Expected the latest version after a restart (error: %v)", err)
+	}
+	expectVersions(t, reopened, "config:app", want)
+	if stats := reopened.DeltaStats(); stats.DeltaVersions != 6 {
+		t.Errorf("Expected deltas to survive a restart, got %+v", stats)
+	}
+}
+
+func TestDeltaVersionsRebaseOnRemoval(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithDeltaVersions("config:", 3))
+	defer kvStore.Stop()
+
+	var want []string
+	for i := 0; i < 12; i++ {
+		want = append(want, configVersion(i))
+		kvStore.Set("config:app", want[i], 0)
+	}
+
+	// Removing a keyframe and a version deltas depend on must leave the others intact.
+	for _, version := range []int{3, 0, 5} {
+		if err := kvStore.RemoveVersion("config:app", version); err != nil {
+			t.Fatalf("RemoveVersion(%d) failed: %v", version, err)
+		}
+		want = append(want[:version], want[version+1:]...)
+		expectVersions(t, kvStore, "config:app", want)
+	}
+
+	removed, err := kvStore.PruneHistory("config:app", 5)
+	if err != nil || removed != 4 {
+		t.Fatalf("Expected 4 versions to be pruned, got %d (error: %v)", removed, err)
+	}
+	want = want[4:]
+	expectVersions(t, kvStore, "config:app", want)
+
+	// Versions written after a rebase are encoded against the new layout.
+	for i := 12; i < 16; i++ {
+		want = append(want, configVersion(i))
+		kvStore.Set("config:app", want[len(want)-1], 0)
+	}
+	expectVersions(t, kvStore, "config:app", want)
+
+	if removed, err := kvStore.PruneHistory("config:app", 100); err != nil || removed != 0 {
+		t.Errorf("Expected nothing to be pruned, got %d (error: %v)", removed, err)
+	}
+	if _, err := kvStore.PruneHistory("config:app", 0); err == nil {
+		t.Error("Expected PruneHistory to reject keeping no versions")
+	}
+}
+
+func TestDeltaVersionsRecordPersister(t *testing.T) {
+	db, err := sqlitestore.Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	open := func() *store.KeyValueStore {
+		return store.NewKeyValueStore("", encryptionKey, 0, time.Minute,
+			store.WithRecordPersister(db), store.WithDeltaVersions("config:", 4))
+	}
+
+	kvStore := open()
+	var want []string
+	for i := 0; i < 4; i++ {
+		want = append(want, configVersion(i))
+		kvStore.Set("config:app", want[i], 0)
+	}
+	// Removing a version rewrites the whole history, deltas included, through the persister.
+	if err := kvStore.RemoveVersion("config:app", 0); err != nil {
+		t.Fatalf("RemoveVersion failed: %v", err)
+	}
+	want = want[1:]
+	expectVersions(t, kvStore, "config:app", want)
+	kvStore.Stop()
+
+	reopened := open()
+	defer reopened.Stop()
+	if value, err := reopened.Get("config:app"); err != nil || value != want[len(want)-1] {
+		t.Fatalf("Expected the latest version after a restart (error: %v)", err)
+	}
+	expectVersions(t, reopened, "config:app", want)
+}
+
+func TestDeltaVersionsKeepUnrelatedValuesInFull(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithDeltaVersions("config:", 16))
+	defer kvStore.Stop()
+
+	want := []string{"alpha", "beta", "gamma\nno trailing newline", "", "delta\n"}
+	for _, value := range want {
+		kvStore.Set("config:small", value, 0)
+	}
+	expectVersions(t, kvStore, "config:small", want)
+	if stats := kvStore.DeltaStats(); stats.DeltaVersions != 0 {
+		t.Errorf("Expected values a delta would not shrink to be kept in full, got %+v", stats)
+	}
+}
+
+func BenchmarkDeltaVersions(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts []store.Option
+	}{
+		{"Full", nil},
+		{"Delta", []store.Option{store.WithDeltaVersions("config:", 16)}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			kvStore := store.NewKeyValueStore(filepath.Join(b.TempDir(), "data.json"), encryptionKey, 0, time.Minute, tc.opts...)
+			defer kvStore.Stop()
+			for i := 0; i < b.N; i++ {
+				kvStore.Set("config:app", configVersion(i), 0)
+			}
+			b.StopTimer()
+
+			stored := 0
+			if stats := kvStore.DeltaStats(); stats.Keys > 0 {
+				stored = int(stats.StoredBytes)
+			} else {
+				history, _ := kvStore.GetHistory("config:app")
+				for _, version := range history {
+					stored += len(version.Value)
+				}
+			}
+			b.ReportMetric(float64(stored)/float64(b.N), "stored-B/version")
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestDiffVersionsJSON(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	kvStore.Set("config", `{"db":{"host":"a","port":5432},"debug":true,"tags":["x"]}`, 0)
+	kvStore.Set("config", `{"db":{"host":"b","port":5432,"pool":10},"tags":["x","y"],"owner":"ops"}`, 0)
+
+	diff, err := kvStore.DiffVersions("config", 0, 1)
+	if err != nil {
+		t.Fatalf("DiffVersions failed: %v", err)
+	}
+	if !diff.JSON || diff.Lines != nil {
+		t.Fatalf("Expected a field-level diff, got %+v", diff)
+	}
+	want := []store.FieldChange{
+		{Path: "db.host", Type: "changed", OldValue: []byte(`"a"`), NewValue: []byte(`"b"`)},
+		{Path: "db.pool", Type: "added", NewValue: []byte(`10`)},
+		{Path: "debug", Type: "removed", OldValue: []byte(`true`)},
+		{Path: "owner", Type: "added", NewValue: []byte(`"ops"`)},
+		{Path: "tags", Type: "changed", OldValue: []byte(`["x"]`), NewValue: []byte(`["x","y"]`)},
+	}
+	if !reflect.DeepEqual(diff.Fields, want) {
+		t.Errorf("Expected %v, got %v", want, diff.Fields)
+	}
+	wantText := "config: version 0 -> 1\n" +
+		"~ db.host: \"a\" -> \"b\"\n" +
+		"+ db.pool: 10\n" +
+		"- debug: true\n" +
+		"+ owner: \"ops\"\n" +
+		"~ tags: [\"x\"] -> [\"x\",\"y\"]\n"
+	if diff.String() != wantText {
+		t.Errorf("Expected\n%s\ngot\n%s", wantText, diff.String())
+	}
+
+	if same, _ := kvStore.DiffVersions("config", 1, 1); same.Changed() {
+		t.Errorf("Expected a version not to differ from itself, got %v", same.Fields)
+	}
+}
+
+func TestDiffVersionsLines(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	kvStore.Set("nginx.conf", "listen 80;\nroot /srv;\nindex a.html;\ngzip on;\n", 0)
+	kvStore.Set("nginx.conf", "listen 80;\nroot /var/www;\nindex a.html;\ngzip on;\nexpires 1h;\n", 0)
+
+	diff, err := kvStore.DiffVersions("nginx.conf", 0, 1)
+	if err != nil {
+		t.Fatalf("DiffVersions failed: %v", err)
+	}
+	wantText := "nginx.conf: version 0 -> 1\n" +
+		"  listen 80;\n" +
+		"- root /srv;\n" +
+		"+ root /var/www;\n" +
+		"  index a.html;\n" +
+		"  gzip on;\n" +
+		"+ expires 1h;\n"
+	if diff.JSON || diff.String() != wantText {
+		t.Errorf("Expected\n%s\ngot\n%s", wantText, diff.String())
+	}
+	if !diff.Changed() {
+		t.Error("Expected Changed to report the difference")
+	}
+
+	// A JSON object compared with another value falls back to lines.
+	kvStore.Set("nginx.conf", `{"listen":80}`, 0)
+	if mixed, _ := kvStore.DiffVersions("nginx.conf", 1, 2); mixed.JSON {
+		t.Error("Expected a line diff between text and JSON")
+	}
+
+	if _, err := kvStore.DiffVersions("nginx.conf", 0, 3); !errors.Is(err, store.ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound, got %v", err)
+	}
+	if _, err := kvStore.DiffVersions("missing", 0, 0); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// recordingBackend keeps every saved snapshot and can slow down or fail saves.
+type recordingBackend struct {
+	mu    sync.Mutex
+	delay time.Duration
+	err   error
+	saves [][]byte
+}
+
+func (b *recordingBackend) Load() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.saves) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return b.saves[len(b.saves)-1], nil
+}
+
+func (b *recordingBackend) Save(data []byte) error {
+	time.Sleep(b.delay)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return b.err
+	}
+	b.saves = append(b.saves, append([]byte(nil), data...))
+	return nil
+}
+
+// saveCount returns how many saves succeeded.
+func (b *recordingBackend) saveCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.saves)
+}
+
+// latest decodes the most recent saved snapshot.
+func (b *recordingBackend) latest(t *testing.T) *store.KeyValueStore {
+	t.Helper()
+	data, _ := b.Load()
+	kv, err := store.NewKeyValueStoreFromReader(bytes.NewReader(data), encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to decode saved snapshot: %v", err)
+	}
+	return kv
+}
+
+func TestSetDurableIsSavedBeforeAck(t *testing.T) {
+	backend := &recordingBackend{}
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(backend))
+	defer kvStore.Stop()
+
+	if err := kvStore.Set("async", "a", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if backend.saveCount() != 0 {
+		t.Fatalf("Expected Set not to save, got %d saves", backend.saveCount())
+	}
+
+	if err := kvStore.SetDurable("sync", "b", 0); err != nil {
+		t.Fatalf("Failed to set key durably: %v", err)
+	}
+	saved := backend.latest(t)
+	defer saved.Stop()
+	for key, want := range map[string]string{"async": "a", "sync": "b"} {
+		if got, err := saved.Get(key); err != nil || got != want {
+			t.Errorf("Expected saved %s=%q before the ack, got %q (%v)", key, want, got, err)
+		}
+	}
+
+	stats := kvStore.DurabilityStats()
+	if stats.SyncWrites != 1 || stats.AsyncWrites != 1 || stats.Flushes != 1 {
+		t.Errorf("Expected 1 sync write, 1 async write and 1 flush, got %+v", stats)
+	}
+}
+
+func TestSetDurableSharesSaves(t *testing.T) {
+	backend := &recordingBackend{delay: 20 * time.Millisecond}
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(backend))
+	defer kvStore.Stop()
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := kvStore.SetDurable(fmt.Sprintf("key%d", i), "v", 0); err != nil {
+				t.Errorf("Failed to set key durably: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := backend.saveCount(); n >= writers {
+		t.Errorf("Expected concurrent durable writes to share saves, got %d saves for %d writes", n, writers)
+	}
+	saved := backend.latest(t)
+	defer saved.Stop()
+	if n := saved.Size(); n != writers {
+		t.Errorf("Expected every acknowledged write to be saved, got %d keys", n)
+	}
+	stats := kvStore.DurabilityStats()
+	if stats.SyncWrites != writers || stats.AvgFlushWait <= 0 {
+		t.Errorf("Expected %d sync writes with a flush wait, got %+v", writers, stats)
+	}
+}
+
+func TestSetDurableReportsSaveFailure(t *testing.T) {
+	backend := &recordingBackend{err: errors.New("disk full")}
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(backend))
+	defer kvStore.Stop()
+
+	if err := kvStore.SetDurable("key", "value", 0); err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected the save error, got %v", err)
+	}
+	// The write itself is applied in memory.
+	if got, err := kvStore.Get("key"); err != nil || got != "value" {
+		t.Errorf("Expected the value in memory, got %q (%v)", got, err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/sqlitestore"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func gzipString(t *testing.T, s string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatalf("Failed to gzip: %v", err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+// encodedValues sets one key per encoding and returns the expected decoded value and encoding of each.
+func encodedValues(t *testing.T, kvStore *store.KeyValueStore) map[string][2]string {
+	t.Helper()
+	const payload = "hello, encoded world"
+	values := map[string][3]string{
+		"plain":   {payload, "", ""},
+		"gzip":    {gzipString(t, payload), "gzip", "gzip"},
+		"base64":  {base64.StdEncoding.EncodeToString([]byte(payload)), "base64", "base64"},
+		"double":  {base64.StdEncoding.EncodeToString([]byte(gzipString(t, payload))), "GZIP,base64", "gzip, base64"},
+		"future":  {"zstd-bytes", "zstd", "zstd"},
+		"partial": {"opaque", "base64, brotli", "base64, brotli"},
+	}
+	want := make(map[string][2]string)
+	for key, v := range values {
+		if err := kvStore.SetWithEncoding(key, v[0], v[1], 0); err != nil {
+			t.Fatalf("SetWithEncoding(%s) failed: %v", key, err)
+		}
+		decoded := payload
+		if key == "future" || key == "partial" {
+			decoded = v[0] // Unknown encodings pass through untouched
+		}
+		want[key] = [2]string{decoded, v[2]}
+	}
+	return want
+}
+
+func assertDecoded(t *testing.T, kvStore *store.KeyValueStore, want map[string][2]string) {
+	t.Helper()
+	for key, w := range want {
+		decoded, encoding, err := kvStore.GetDecoded(key)
+		if err != nil {
+			t.Errorf("GetDecoded(%s) failed: %v", key, err)
+			continue
+		}
+		if string(decoded) != w[0] || encoding != w[1] {
+			t.Errorf("GetDecoded(%s) = %q, %q; expected %q, %q", key, decoded, encoding, w[0], w[1])
+		}
+	}
+}
+
+func TestGetDecoded(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute)
+	want := encodedValues(t, kvStore)
+	assertDecoded(t, kvStore, want)
+
+	// Get returns the stored bytes unchanged.
+	if value, _ := kvStore.Get("base64"); value != base64.StdEncoding.EncodeToString([]byte("hello, encoded world")) {
+		t.Errorf("Expected Get to return the encoded value, got %q", value)
+	}
+
+	// A plain Set records no encoding for its version.
+	kvStore.Set("gzip", "now plain", 0)
+	if decoded, encoding, _ := kvStore.GetDecoded("gzip"); string(decoded) != "now plain" || encoding != "" {
+		t.Errorf("Expected the plain version to decode as is, got %q, %q", decoded, encoding)
+	}
+	delete(want, "gzip")
+
+	kvStore.SetWithEncoding("broken", "not base64!", "base64", 0)
+	if _, _, err := kvStore.GetDecoded("broken"); err == nil {
+		t.Error("Expected invalid base64 to fail to decode")
+	}
+	if _, _, err := kvStore.GetDecoded("missing"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	kvStore.Stop()
+
+	reopened := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute)
+	defer reopened.Stop()
+	assertDecoded(t, reopened, want)
+}
+
+func TestGetDecodedSQLite(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+
+	// A database created before the encoding column existed is upgraded on open.
+	old, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := old.Exec(`CREATE TABLE versions (key_id INTEGER NOT NULL, seq INTEGER NOT NULL, value TEXT NOT NULL,
+		timestamp TEXT NOT NULL, collapsed INTEGER NOT NULL DEFAULT 0, PRIMARY KEY (key_id, seq))`); err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+	old.Close()
+
+	db, err := sqlitestore.Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithRecordPersister(db))
+	want := encodedValues(t, kvStore)
+	kvStore.Stop()
+
+	reopened := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithRecordPersister(db))
+	defer reopened.Stop()
+	assertDecoded(t, reopened, want)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// writePlaintextFixture encodes a raw JSON fixture from testdata into the store's file format without encryption.
+func writePlaintextFixture(t *testing.T, fixture, filePath string) {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %v", fixture, err)
+	}
+	compressedData, err := store.CompressData(raw)
+	if err != nil {
+		t.Fatalf("Failed to compress fixture: %v", err)
+	}
+	if err := os.WriteFile(filePath, []byte(base64.StdEncoding.EncodeToString(compressedData)), 0644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+}
+
+func TestRequireEncryptionRejectsMissingKey(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	for name, key := range map[string][]byte{"nil": nil, "empty": {}, "short": []byte("encryptionKey")} {
+		if _, err := store.OpenKeyValueStore(filePath, key, 0, time.Minute, store.RequireEncryption()); !errors.Is(err, store.ErrEncryptionRequired) {
+			t.Errorf("%s key: expected ErrEncryptionRequired, got %v", name, err)
+		}
+	}
+	if _, err := store.NewKeyValueStoreFromReader(bytes.NewReader(nil), nil, store.RequireEncryption()); !errors.Is(err, store.ErrEncryptionRequired) {
+		t.Errorf("Expected NewKeyValueStoreFromReader to require a key, got %v", err)
+	}
+
+	// A store created without the error-returning constructor refuses to load or write.
+	kvStore := store.NewKeyValueStore(filePath, nil, 0, time.Minute, store.RequireEncryption())
+	defer kvStore.Stop()
+	if err := kvStore.Set("key", "value", 0); !errors.Is(err, store.ErrEncryptionRequired) {
+		t.Errorf("Expected Set to fail without a key, got %v", err)
+	}
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		t.Errorf("Expected no plaintext file to be written, got %v", err)
+	}
+
+	kvStore, err := store.OpenKeyValueStore(filePath, encryptionKey, 0, time.Minute, store.RequireEncryption())
+	if err != nil {
+		t.Fatalf("Expected a valid key to be accepted, got %v", err)
+	}
+	defer kvStore.Stop()
+	if status := kvStore.EncryptionStatus(); !status.Encrypted || !status.Required {
+		t.Errorf("Expected an encrypted store requiring encryption, got %+v", status)
+	}
+}
+
+func TestRequireEncryptionRefusesPlaintextFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	writePlaintextFixture(t, "plaintext.json", filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute, store.RequireEncryption())
+	defer kvStore.Stop()
+	if _, err := kvStore.Get("name"); !errors.Is(err, store.ErrUnencryptedData) {
+		t.Errorf("Expected the plaintext file to be refused, got %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read data file: %v", err)
+	}
+	if _, err := store.NewKeyValueStoreFromReader(bytes.NewReader(data), encryptionKey, store.RequireEncryption()); !errors.Is(err, store.ErrUnencryptedData) {
+		t.Errorf("Expected NewKeyValueStoreFromReader to refuse plaintext data, got %v", err)
+	}
+}
+
+func TestEnableEncryptionInPlace(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	writePlaintextFixture(t, "plaintext.json", filePath)
+
+	plain := store.NewKeyValueStore(filePath, nil, 0, time.Minute)
+	if status := plain.EncryptionStatus(); status.Encrypted {
+		t.Errorf("Expected a store without a key to report no encryption, got %+v", status)
+	}
+	if err := plain.EnableEncryption([]byte("short")); !errors.Is(err, store.ErrEncryptionRequired) {
+		t.Errorf("Expected an invalid key to be rejected, got %v", err)
+	}
+	if err := plain.EnableEncryption(encryptionKey); err != nil {
+		t.Fatalf("EnableEncryption failed: %v", err)
+	}
+	if err := plain.EnableEncryption(encryptionKey); err == nil {
+		t.Error("Expected encrypting an encrypted store to fail")
+	}
+	plain.Stop()
+
+	kvStore, err := store.OpenKeyValueStore(filePath, encryptionKey, 0, time.Minute, store.RequireEncryption())
+	if err != nil {
+		t.Fatalf("OpenKeyValueStore failed: %v", err)
+	}
+	defer kvStore.Stop()
+	if value, err := kvStore.Get("name"); err != nil || value != "plaintext" {
+		t.Errorf("Expected the migrated value, got %q (error: %v)", value, err)
+	}
+	if versions, err := kvStore.GetAllVersions("config"); err != nil || len(versions) != 2 || versions[0] != "v1" {
+		t.Errorf("Expected the history to survive the migration, got %v (error: %v)", versions, err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestEncryptDataWithContext(t *testing.T) {
+	ciphertext, err := store.EncryptDataWithContext([]byte("secret"), encryptionKey, []byte("prod"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if bytes.Contains(ciphertext, []byte("prod")) {
+		t.Errorf("Expected the context not to be stored in the ciphertext")
+	}
+
+	plaintext, err := store.DecryptDataWithContext(ciphertext, encryptionKey, []byte("prod"))
+	if err != nil || string(plaintext) != "secret" {
+		t.Errorf("Expected 'secret', got %q (error: %v)", plaintext, err)
+	}
+	if _, err := store.DecryptDataWithContext(ciphertext, encryptionKey, []byte("staging")); !errors.Is(err, store.ErrWrongEncryptionContext) {
+		t.Errorf("Expected ErrWrongEncryptionContext, got %v", err)
+	}
+	if _, err := store.DecryptData(ciphertext, encryptionKey); err == nil {
+		t.Errorf("Expected decryption without the context to fail")
+	}
+}
+
+func TestEncryptionContextBindsStoreFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	prodContext := store.WithEncryptionContext("prod-cluster:" + filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute, prodContext)
+	if err := kvStore.Set("name", "John", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	kvStore.Stop()
+
+	// The file copied to a store configured with another context must not decrypt.
+	staging := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute, store.WithEncryptionContext("staging-cluster:"+filePath))
+	if _, err := staging.Get("name"); !errors.Is(err, store.ErrWrongEncryptionContext) {
+		t.Errorf("Expected ErrWrongEncryptionContext, got %v", err)
+	}
+	if err := staging.Set("name", "Jane", 0); !errors.Is(err, store.ErrWrongEncryptionContext) {
+		t.Errorf("Expected ErrWrongEncryptionContext on write, got %v", err)
+	}
+	staging.Stop()
+
+	// Rotating the key keeps the context, and the file is untouched by the failed store.
+	reopened := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute, prodContext)
+	if value, err := reopened.Get("name"); err != nil || value != "John" {
+		t.Fatalf("Expected 'John', got %q (error: %v)", value, err)
+	}
+	newKey := []byte("fedcba9876543210")
+	if err := reopened.RotateEncryptionKey(newKey); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	reopened.Stop()
+
+	rotated := store.NewKeyValueStore(filePath, newKey, 0, 1*time.Minute, prodContext)
+	defer rotated.Stop()
+	if value, err := rotated.Get("name"); err != nil || value != "John" {
+		t.Errorf("Expected 'John' after rotation, got %q (error: %v)", value, err)
+	}
+	var snapshot bytes.Buffer
+	if err := rotated.SaveTo(&snapshot); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	if _, err := store.NewKeyValueStoreFromReader(&snapshot, newKey); err == nil {
+		t.Errorf("Expected snapshot to require the encryption context")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/client"
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestErrorKindsMapInEverySurface(t *testing.T) {
+	kinds := errs.Kinds()
+	if len(kinds) != 8 {
+		t.Errorf("Expected 8 error kinds, got %d", len(kinds))
+	}
+	for _, kind := range kinds {
+		t.Run(kind.String(), func(t *testing.T) {
+			status, ok := errs.HTTPStatusFor(kind)
+			if !ok || status < 400 {
+				t.Errorf("Missing HTTP status for %s", kind)
+			}
+			code, ok := errs.GRPCCodeFor(kind)
+			if !ok || code == 0 {
+				t.Errorf("Missing gRPC code for %s", kind)
+			}
+			exit, ok := errs.ExitCodeFor(kind)
+			if !ok || exit < 2 {
+				t.Errorf("Missing CLI exit code for %s", kind)
+			}
+
+			err := errs.Wrap(kind, errors.New("boom"))
+			if errs.HTTPStatus(err) != status || errs.GRPCCode(err) != code || errs.ExitCode(err) != exit {
+				t.Errorf("Wrapped error does not map like its kind")
+			}
+		})
+	}
+}
+
+func TestKindOfStoreErrors(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 1*time.Minute)
+	defer kvStore.Stop()
+	kvStore.Set("name", "John", 0)
+
+	_, missingKey := kvStore.Get("missing")
+	_, missingVersion := kvStore.GetVersion("name", 5)
+	_, missingFile := os.Open(filepath.Join(t.TempDir(), "missing"))
+	_, invalidKeep := kvStore.Compact(0)
+
+	tests := []struct {
+		name string
+		err  error
+		kind errs.Kind
+	}{
+		{"key not found", missingKey, errs.NotFound},
+		{"version not found", missingVersion, errs.NotFound},
+		{"wrapped key not found", fmt.Errorf("lookup: %w", store.ErrKeyNotFound), errs.NotFound},
+		{"missing file", missingFile, errs.NotFound},
+		{"events truncated", &store.EventsTruncatedError{Since: 1, Oldest: 5}, errs.NotFound},
+		{"memory pressure", store.ErrMemoryPressure, errs.ResourceExhausted},
+		{"wrong encryption context", store.ErrWrongEncryptionContext, errs.Unauthorized},
+		{"encryption required", store.ErrEncryptionRequired, errs.InvalidArgument},
+		{"invalid compaction keep", invalidKeep, errs.InvalidArgument},
+		{"reserved key", fmt.Errorf("%w: %q", store.ErrReservedKey, "\x00immutable"), errs.InvalidArgument},
+		{"not client-encrypted", fmt.Errorf("key 'k': %w", client.ErrNotClientEncrypted), errs.InvalidArgument},
+		{"unencrypted data", store.ErrUnencryptedData, errs.Conflict},
+		{"job running", store.ErrJobRunning, errs.Conflict},
+		{"computed key", store.ErrComputedKey, errs.Conflict},
+		{"broken backup chain", store.ErrBackupChain, errs.Conflict},
+		{"data file in use", store.ErrDataFileInUse, errs.Conflict},
+		{"namespace exists", fmt.Errorf("%w: 'b:x'", store.ErrNamespaceExists), errs.Conflict},
+		{"transaction done", store.ErrTxnDone, errs.Conflict},
+		{"migration verification", store.ErrMigrationVerification, errs.Conflict},
+		{"job not found", store.ErrJobNotFound, errs.NotFound},
+		{"stale reads disabled", store.ErrStaleReadsDisabled, errs.Unavailable},
+		{"deadline", context.DeadlineExceeded, errs.Unavailable},
+		{"explicit kind", errs.Errorf(errs.Conflict, "version mismatch"), errs.Conflict},
+		{"unknown", errors.New("boom"), errs.Internal},
+	}
+	for _, tt := range tests {
+		if got := errs.KindOf(tt.err); got != tt.kind {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.kind, got)
+		}
+	}
+
+	if errs.HTTPStatus(nil) != http.StatusOK || errs.GRPCCode(nil) != 0 || errs.ExitCode(nil) != 0 {
+		t.Errorf("Expected nil to map to success in every surface")
+	}
+	if errs.HTTPStatus(missingKey) != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing key, got %d", errs.HTTPStatus(missingKey))
+	}
+}
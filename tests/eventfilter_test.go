@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// eventSeq matches the sequence number of an event, which depends on the writes made before it.
+var eventSeq = regexp.MustCompile(`@\d+`)
+
+// deliveredEvents records the events delivered to a subscription without their sequence numbers.
+type deliveredEvents []string
+
+func (d *deliveredEvents) record(event string) {
+	*d = append(*d, eventSeq.ReplaceAllString(event, ""))
+}
+
+func (d deliveredEvents) sorted() []string {
+	events := append([]string{}, d...)
+	sort.Strings(events)
+	return events
+}
+
+// sessionTraffic writes, deletes and expires session and user keys.
+func sessionTraffic(t *testing.T, kvStore *store.KeyValueStore) {
+	t.Helper()
+	for _, key := range []string{"sessions:a", "sessions:internal:x", "users:1"} {
+		kvStore.Set(key, "v1", 0)
+		kvStore.Set(key, "v2:"+key, 0)
+	}
+	kvStore.Set("sessions:b", "token-b", 10*time.Millisecond)
+	kvStore.Set("sessions:internal:y", "token-y", 10*time.Millisecond)
+	kvStore.Notify("hotkey:sessions:a")
+	for _, key := range []string{"sessions:a", "sessions:internal:x", "users:1"} {
+		if err := kvStore.Delete(key); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := kvStore.SweepExpired(); err != nil {
+		t.Fatalf("SweepExpired failed: %v", err)
+	}
+}
+
+func TestSubscribeFilteredDeliverySets(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter store.EventFilter
+		want   []string
+	}{
+		{
+			name: "removed sessions except internal, with values",
+			filter: store.EventFilter{
+				Include:       []string{"sessions:"},
+				Exclude:       []string{"sessions:internal:"},
+				Types:         []string{"deleted", "expired"},
+				IncludeValues: true,
+			},
+			want: []string{"deleted:sessions:a=v2:sessions:a", "expired:sessions:b=token-b"},
+		},
+		{
+			name: "exclusion wins over a more specific inclusion",
+			filter: store.EventFilter{
+				Include: []string{"users:", "sessions:internal:x"},
+				Exclude: []string{"sessions:internal:"},
+				Types:   []string{"deleted"},
+			},
+			want: []string{"deleted:users:1"},
+		},
+		{
+			name:   "notifications that are not key events match on the text after their type",
+			filter: store.EventFilter{Include: []string{"sessions:a"}, Types: []string{"hotkey", "added"}},
+			want:   []string{"added:sessions:a", "hotkey:sessions:a"},
+		},
+		{
+			name: "predicate",
+			filter: store.EventFilter{
+				Types:     []string{"updated"},
+				Predicate: func(event store.Event) bool { return event.Key != "users:1" },
+			},
+			want: []string{"updated:sessions:a", "updated:sessions:internal:x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A passive store delivers events before each write returns, so the delivery set is final.
+			kvStore := store.NewPassive()
+			defer kvStore.Stop()
+			var delivered deliveredEvents
+			kvStore.SubscribeFiltered(tt.filter, 0, delivered.record)
+
+			sessionTraffic(t, kvStore)
+			if got := delivered.sorted(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSubscribeFilteredQueued(t *testing.T) {
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(store.NewMemoryBackend()))
+	defer kvStore.Stop()
+	events := make(chan string, 10)
+	id := kvStore.SubscribeFiltered(store.EventFilter{Include: []string{"sessions:"}, Types: []string{"deleted"}, IncludeValues: true},
+		10, func(event string) { events <- event })
+
+	kvStore.Set("users:1", "u", 0)
+	kvStore.Set("sessions:a", "s", 0)
+	kvStore.Delete("users:1")
+	kvStore.Delete("sessions:a")
+	select {
+	case event := <-events:
+		if eventSeq.ReplaceAllString(event, "") != "deleted:sessions:a=s" {
+			t.Errorf("Expected the session deletion, got %s", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the session deletion to be delivered")
+	}
+
+	for _, info := range kvStore.Subscriptions() {
+		if info.ID != id {
+			continue
+		}
+		if info.Dropped != 0 || info.EventFilter == nil || info.EventFilter.Types[0] != "deleted" {
+			t.Errorf("Expected the filter in the subscription info, got %+v", info)
+		}
+	}
+}
+
+func TestEventFilterJSON(t *testing.T) {
+	var filter store.EventFilter
+	config := `{"include":["sessions:"],"exclude":["sessions:internal:"],"types":["deleted","expired"],"include_values":true}`
+	if err := json.Unmarshal([]byte(config), &filter); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	want := store.EventFilter{
+		Include:       []string{"sessions:"},
+		Exclude:       []string{"sessions:internal:"},
+		Types:         []string{"deleted", "expired"},
+		IncludeValues: true,
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("Expected %+v, got %+v", want, filter)
+	}
+}
+
+func BenchmarkEventFiltering(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	filter := store.EventFilter{Include: []string{"sessions:"}, Exclude: []string{"sessions:internal:"}, Types: []string{"deleted"}}
+	for _, subscriptions := range []int{0, 100} {
+		b.Run(fmt.Sprintf("non_matching_subscriptions=%d", subscriptions), func(b *testing.B) {
+			nm := store.NewNotificationManager()
+			defer nm.Stop()
+			for i := 0; i < subscriptions; i++ {
+				nm.SubscribeFiltered(filter, 0, func(string) { b.Error("Expected no delivery") })
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				nm.NotifyUpdate("users:1", uint64(i))
+			}
+		})
+	}
+}
+
+func TestKeyAndPrefixListeners(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	var forKey, forPrefix, keysAndPrefix deliveredEvents
+	keyID := kvStore.RegisterNotificationListenerForKey("user:1", forKey.record)
+	kvStore.RegisterNotificationListenerForPrefix("user:2", forPrefix.record)
+	kvStore.SubscribeFiltered(store.EventFilter{Keys: []string{"user:1"}, Include: []string{"order:"}}, 0, keysAndPrefix.record)
+
+	for _, key := range []string{"user:1", "user:10", "user:2", "user:20", "order:1"} {
+		kvStore.Set(key, "v", 0)
+	}
+	kvStore.Delete("user:1")
+
+	if want := "[added:user:1 deleted:user:1]"; fmt.Sprint(forKey) != want {
+		t.Errorf("Expected the key listener to get %s, got %v", want, forKey)
+	}
+	if want := "[added:user:2 added:user:20]"; fmt.Sprint(forPrefix) != want {
+		t.Errorf("Expected the prefix listener to get %s, got %v", want, forPrefix)
+	}
+	if want := "[added:user:1 added:order:1 deleted:user:1]"; fmt.Sprint(keysAndPrefix) != want {
+		t.Errorf("Expected keys and prefixes to combine into %s, got %v", want, keysAndPrefix)
+	}
+
+	if !kvStore.Unsubscribe(keyID) {
+		t.Fatal("Expected the key listener to be unsubscribed")
+	}
+	kvStore.Set("user:1", "again", 0)
+	if len(forKey) != 2 {
+		t.Errorf("Expected no events after Unsubscribe, got %v", forKey)
+	}
+}
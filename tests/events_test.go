@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/sqlitestore"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// expectTruncated checks that EventsSince(seq) reports a truncation with the given oldest sequence number.
+func expectTruncated(t *testing.T, kvStore *store.KeyValueStore, seq, oldest uint64) {
+	t.Helper()
+	events, err := kvStore.EventsSince(seq)
+	var truncated *store.EventsTruncatedError
+	if !errors.As(err, &truncated) || !errors.Is(err, store.ErrEventsTruncated) {
+		t.Fatalf("Expected EventsSince(%d) to be truncated, got %v (error: %v)", seq, events, err)
+	}
+	if truncated.Oldest != oldest || truncated.Latest != kvStore.LastSequence() {
+		t.Errorf("Expected events from %d to %d, got %+v", oldest, kvStore.LastSequence(), truncated)
+	}
+}
+
+// eventsSequenceSuite checks that numbering continues across restarts of the stores returned by open.
+func eventsSequenceSuite(t *testing.T, open func() *store.KeyValueStore) {
+	kvStore := open()
+	kvStore.Set("a", "1", 0)
+	kvStore.Set("b", "2", 0)
+	kvStore.Set("a", "3", 0)
+	before := kvStore.LastSequence()
+	if before != 3 {
+		t.Fatalf("Expected sequence 3, got %d", before)
+	}
+	kvStore.Stop()
+
+	reopened := open()
+	defer reopened.Stop()
+	if seq := reopened.LastSequence(); seq != before {
+		t.Fatalf("Expected the sequence to survive the restart, got %d", seq)
+	}
+	if reopened.Size() != 2 {
+		t.Errorf("Expected the sequence record to stay out of the keys, got %v", reopened.Keys())
+	}
+
+	reopened.Set("c", "4", 0)
+	reopened.Delete("b")
+
+	// A consumer that saw everything before the restart resumes seamlessly.
+	events, err := reopened.EventsSince(before)
+	if err != nil {
+		t.Fatalf("EventsSince failed: %v", err)
+	}
+	want := []store.Event{{Seq: 4, Type: "added", Key: "c"}, {Seq: 5, Type: "deleted", Key: "b"}}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %+v", len(want), events)
+	}
+	for i, event := range events {
+		if event.Seq != want[i].Seq || event.Type != want[i].Type || event.Key != want[i].Key {
+			t.Errorf("Expected event %+v, got %+v", want[i], event)
+		}
+	}
+
+	// One that missed events from before the restart must resynchronize.
+	expectTruncated(t, reopened, before-1, before+1)
+}
+
+func TestEventSequenceSurvivesRestart(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "data.json")
+		eventsSequenceSuite(t, func() *store.KeyValueStore {
+			return store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute)
+		})
+	})
+	t.Run("hashed keys", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "data.json")
+		eventsSequenceSuite(t, func() *store.KeyValueStore {
+			return store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute, store.WithKeyHashing(keySecret))
+		})
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := sqlitestore.Open(filepath.Join(t.TempDir(), "data.db"))
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		eventsSequenceSuite(t, func() *store.KeyValueStore {
+			return store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithRecordPersister(db))
+		})
+	})
+}
+
+func TestEventLogEvictsOldestEvents(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithEventLog(4))
+	defer kvStore.Stop()
+
+	for i := 1; i <= 10; i++ {
+		kvStore.Set(fmt.Sprintf("key%d", i), "v", 0)
+	}
+	expectTruncated(t, kvStore, 0, 7)
+	expectTruncated(t, kvStore, 5, 7)
+
+	events, err := kvStore.EventsSince(6)
+	if err != nil || len(events) != 4 || events[0].Seq != 7 || events[3].Key != "key10" {
+		t.Errorf("Expected events 7 to 10, got %+v (error: %v)", events, err)
+	}
+	if events, err := kvStore.EventsSince(10); err != nil || len(events) != 0 {
+		t.Errorf("Expected no events after the latest, got %+v (error: %v)", events, err)
+	}
+}
+
+func TestEventsSinceAheadOfStore(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	kvStore.Set("a", "1", 0)
+
+	// A client of a store that lost its latest writes may present a sequence number not issued yet.
+	expectTruncated(t, kvStore, 5, 1)
+}
+
+func TestSequenceRecordIsReserved(t *testing.T) {
+	db, err := sqlitestore.Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	open := func() *store.KeyValueStore {
+		return store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithRecordPersister(db))
+	}
+
+	kvStore := open()
+	for i := 0; i < 5; i++ {
+		kvStore.Set("a", fmt.Sprint(i), 0)
+	}
+	before := kvStore.LastSequence()
+
+	// Writing the record of the sequence number as a key would replace it in the persister.
+	const record = "\x00sequence"
+	if err := kvStore.Set(record, "1", 0); !errors.Is(err, store.ErrReservedKey) {
+		t.Errorf("Expected Set to fail with ErrReservedKey, got %v", err)
+	}
+	if err := kvStore.Delete(record); !errors.Is(err, store.ErrReservedKey) {
+		t.Errorf("Expected Delete to fail with ErrReservedKey, got %v", err)
+	}
+	kvStore.Stop()
+
+	kvStore = open()
+	defer kvStore.Stop()
+	if got := kvStore.LastSequence(); got != before {
+		t.Errorf("Expected the sequence to continue from %d, got %d", before, got)
+	}
+	if kvStore.Size() != 1 {
+		t.Errorf("Expected only key a, got %v", kvStore.Keys())
+	}
+}
+
+func TestMergeIgnoresSequenceRecord(t *testing.T) {
+	source := store.NewKeyValueStore(filepath.Join(t.TempDir(), "source.json"), encryptionKey, 0, time.Minute)
+	for i := 0; i < 5; i++ {
+		source.Set("a", fmt.Sprint(i), 0)
+	}
+	var snapshot bytes.Buffer
+	if err := source.SaveTo(&snapshot); err != nil {
+		t.Fatalf("SaveTo failed: %v", err)
+	}
+	source.Stop()
+
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	report, err := kvStore.Merge(&snapshot, store.MergeOptions{})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if len(report.Imported) != 1 || kvStore.Size() != 1 {
+		t.Errorf("Expected only key a to be imported, got %+v and keys %v", report, kvStore.Keys())
+	}
+}
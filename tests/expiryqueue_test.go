@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestSweepVisitsDueKeys(t *testing.T) {
+	kvStore := store.NewPassive(store.WithCleanupBatch(3))
+	defer kvStore.Stop()
+
+	for i := 0; i < 10; i++ {
+		kvStore.Set(fmt.Sprintf("short:%d", i), "v", 10*time.Millisecond)
+	}
+	kvStore.Set("extended", "v", 10*time.Millisecond)
+	kvStore.Expire("extended", time.Hour)
+	kvStore.Set("persisted", "v", 10*time.Millisecond)
+	kvStore.Persist("persisted")
+	kvStore.Set("rewritten", "v", 10*time.Millisecond)
+	kvStore.Set("rewritten", "v2", 0)
+	kvStore.Set("long", "v", time.Hour)
+	time.Sleep(20 * time.Millisecond)
+
+	removed, err := kvStore.SweepExpired()
+	if err != nil || removed != 10 {
+		t.Errorf("Expected the 10 due keys to be removed across batches, got %d (%v)", removed, err)
+	}
+	for _, key := range []string{"extended", "persisted", "rewritten", "long"} {
+		if _, err := kvStore.Get(key); err != nil {
+			t.Errorf("Expected %s to outlive its original deadline, got %v", key, err)
+		}
+	}
+	if removed, _ := kvStore.SweepExpired(); removed != 0 {
+		t.Errorf("Expected nothing left to sweep, got %d", removed)
+	}
+}
+
+func TestSweepAfterManyTTLChanges(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	// Each Expire leaves a stale deadline behind for the sweep to skip.
+	kvStore.Set("k", "v", time.Hour)
+	for i := 0; i < 5000; i++ {
+		kvStore.Expire("k", time.Duration(i+1)*time.Millisecond)
+	}
+	kvStore.Expire("k", time.Hour)
+	time.Sleep(10 * time.Millisecond)
+	if removed, _ := kvStore.SweepExpired(); removed != 0 {
+		t.Errorf("Expected stale deadlines to be skipped, got %d removed", removed)
+	}
+	kvStore.Expire("k", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if removed, _ := kvStore.SweepExpired(); removed != 1 {
+		t.Errorf("Expected the key to expire at its last deadline, got %d removed", removed)
+	}
+}
+
+// BenchmarkSweep sweeps a store where few of many keys with a TTL are due.
+func BenchmarkSweep(b *testing.B) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	for i := 0; i < 100000; i++ {
+		kvStore.Set(fmt.Sprintf("key:%d", i), "v", time.Hour)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		kvStore.Set("due", "v", time.Nanosecond)
+		kvStore.SweepExpired()
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestFaultInjectorIsInertUntilEnabled(t *testing.T) {
+	faults := store.NewFaultInjector()
+	faults.AddRule(store.FaultRule{Op: store.OpSet, Probability: 1, Err: errors.New("injected")})
+
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "store.json"), encryptionKey, 0, 1*time.Minute,
+		store.WithFaultInjector(faults))
+	defer kvStore.Stop()
+
+	if err := kvStore.Set("key", "value", 0); err != nil {
+		t.Fatalf("Expected disabled injector to be inert, got %v", err)
+	}
+
+	faults.Enable(true)
+	if err := kvStore.Set("key", "value", 0); err == nil || err.Error() != "injected" {
+		t.Errorf("Expected injected error, got %v", err)
+	}
+
+	faults.Enable(false)
+	if err := kvStore.Set("key", "value", 0); err != nil {
+		t.Errorf("Expected injector to be inert after disabling, got %v", err)
+	}
+
+	if n := faults.Stats().Errors[store.OpSet]; n != 1 {
+		t.Errorf("Expected 1 injected set error, got %d", n)
+	}
+}
+
+func TestFaultInjectorLatencyByPattern(t *testing.T) {
+	faults := store.NewFaultInjector()
+	faults.AddRule(store.FaultRule{Op: store.OpGet, KeyPattern: "slow:*", Probability: 1, Latency: 200 * time.Millisecond})
+	faults.Enable(true)
+
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "store.json"), encryptionKey, 0, 1*time.Minute,
+		store.WithFaultInjector(faults))
+	defer kvStore.Stop()
+
+	if err := kvStore.Set("slow:key", "value", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if err := kvStore.Set("fast:key", "value", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := kvStore.Get("slow:key"); err != nil {
+		t.Fatalf("Failed to get key: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected injected latency of at least 200ms, got %v", elapsed)
+	}
+
+	start = time.Now()
+	if _, err := kvStore.Get("fast:key"); err != nil {
+		t.Fatalf("Failed to get key: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("Expected no latency for non-matching key, got %v", elapsed)
+	}
+
+	if n := faults.Stats().Latencies[store.OpGet]; n != 1 {
+		t.Errorf("Expected 1 injected get latency, got %d", n)
+	}
+}
+
+func TestFaultInjectorSaveErrorAndPanic(t *testing.T) {
+	faults := store.NewFaultInjector()
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "store.json"), encryptionKey, 0, 1*time.Minute,
+		store.WithFaultInjector(faults))
+	defer kvStore.Stop()
+
+	if err := kvStore.Set("key", "value", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	faults.Enable(true)
+	faults.AddRule(store.FaultRule{Op: store.OpSave, Probability: 1, Err: errors.New("disk full")})
+	if err := kvStore.RotateEncryptionKey([]byte("newkey0123456789")); err == nil {
+		t.Errorf("Expected injected save error to fail the key rotation")
+	}
+
+	faults.PanicOnKey("boom")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected Get of 'boom' to panic")
+			}
+		}()
+		_, _ = kvStore.Get("boom")
+	}()
+
+	if _, err := kvStore.Get("key"); err != nil {
+		t.Errorf("Expected other keys to be unaffected, got %v", err)
+	}
+	if stats := faults.Stats(); stats.Panics != 1 || stats.Errors[store.OpSave] != 1 {
+		t.Errorf("Expected 1 panic and 1 save error, got %+v", stats)
+	}
+	faults.Reset()
+}
+
+func TestSetManyReportsPerKeyErrors(t *testing.T) {
+	faults := store.NewFaultInjector()
+	faults.AddRule(store.FaultRule{Op: store.OpSet, KeyPattern: "bad:*", Probability: 1, Err: errors.New("rejected")})
+	faults.Enable(true)
+
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "store.json"), encryptionKey, 0, 1*time.Minute,
+		store.WithFaultInjector(faults))
+	defer kvStore.Stop()
+
+	result := kvStore.SetMany([]store.Entry{
+		{Key: "good:1", Value: "value"},
+		{Key: "bad:1", Value: "value"},
+	})
+
+	if len(result.Created) != 1 || result.Created[0] != "good:1" {
+		t.Errorf("Expected only good:1 to be created, got %v", result.Created)
+	}
+	if err := result.Errors["bad:1"]; err == nil || err.Error() != "rejected" {
+		t.Errorf("Expected bad:1 to be rejected, got %v", err)
+	}
+	if _, err := kvStore.Get("bad:1"); err == nil {
+		t.Errorf("Expected bad:1 not to be stored")
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/flags"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// newFlagStore creates a store holding the given flag documents.
+func newFlagStore(t *testing.T, documents map[string]string) *store.KeyValueStore {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	t.Cleanup(kvStore.Stop)
+	for key, document := range documents {
+		kvStore.Set(key, document, 0)
+	}
+	return kvStore
+}
+
+// waitForEvaluation evaluates the flag until it returns want.
+func waitForEvaluation(t *testing.T, e *flags.Evaluator, key string, subject flags.Subject, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, err := e.Evaluate(key, subject)
+		if err == nil && got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s to evaluate to %v, got %v (error: %v)", key, want, got, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlagBucketing(t *testing.T) {
+	if flags.Bucket("checkout", "user-1") != flags.Bucket("checkout", "user-1") {
+		t.Fatal("Expected the bucket of a subject to be stable")
+	}
+
+	quarter, _ := flags.Parse(`{"enabled": true, "percentage": 25}`)
+	half, _ := flags.Parse(`{"enabled": true, "percentage": 50}`)
+	inQuarter, inHalf, inOther := 0, 0, 0
+	for i := 0; i < 10000; i++ {
+		subject := flags.Subject{ID: fmt.Sprintf("user-%d", i)}
+		q, h := quarter.Evaluate("checkout", subject), half.Evaluate("checkout", subject)
+		if q && !h {
+			t.Fatalf("Expected %s to stay in the rollout as it grows", subject.ID)
+		}
+		if q {
+			inQuarter++
+		}
+		if h {
+			inHalf++
+		}
+		if quarter.Evaluate("search", subject) {
+			inOther++
+		}
+	}
+	if inQuarter < 2300 || inQuarter > 2700 || inHalf < 4700 || inHalf > 5300 {
+		t.Errorf("Expected about 25%% and 50%% of subjects, got %d and %d of 10000", inQuarter, inHalf)
+	}
+	if inOther < 2300 || inOther > 2700 {
+		t.Errorf("Expected about 25%% of subjects in another flag, got %d", inOther)
+	}
+	if quarter.Evaluate("checkout", flags.Subject{}) {
+		t.Error("Expected subjects without an ID to stay out of partial rollouts")
+	}
+}
+
+func TestFlagRules(t *testing.T) {
+	document := `{"enabled": true, "rules": [
+		{"attribute": "country", "operator": "in", "values": ["FR", "DE"]},
+		{"attribute": "plan", "operator": "not_in", "values": ["free"]},
+		{"attribute": "email", "operator": "prefix", "values": ["qa+", "dev+"]}]}`
+	flag, err := flags.Parse(document)
+	if err != nil {
+		t.Fatalf("Failed to parse flag: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		attributes map[string]string
+		want       bool
+	}{
+		{"all rules match", map[string]string{"country": "FR", "plan": "pro", "email": "qa+1@example.com"}, true},
+		{"missing not_in attribute", map[string]string{"country": "DE", "email": "dev+2@example.com"}, true},
+		{"country not listed", map[string]string{"country": "US", "plan": "pro", "email": "qa+1@example.com"}, false},
+		{"excluded plan", map[string]string{"country": "FR", "plan": "free", "email": "qa+1@example.com"}, false},
+		{"missing in attribute", map[string]string{"plan": "pro", "email": "qa+1@example.com"}, false},
+		{"prefix not matching", map[string]string{"country": "FR", "email": "someone@example.com"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := flag.Evaluate("beta", flags.Subject{ID: "u", Attributes: tt.attributes}); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	disabled, _ := flags.Parse(`{"enabled": false}`)
+	if disabled.Evaluate("beta", flags.Subject{ID: "u"}) {
+		t.Error("Expected a disabled flag to be off")
+	}
+}
+
+func TestFlagCacheInvalidation(t *testing.T) {
+	kvStore := newFlagStore(t, map[string]string{"flags:checkout": `{"enabled": false}`})
+	e := flags.NewEvaluator(kvStore)
+	defer e.Close()
+	subject := flags.Subject{ID: "user-1"}
+
+	for i := 0; i < 3; i++ {
+		if on, err := e.Evaluate("flags:checkout", subject); on || err != nil {
+			t.Fatalf("Expected the flag to be off, got %v (error: %v)", on, err)
+		}
+	}
+	if stats := e.Stats(); stats.Misses != 1 || stats.Hits != 2 {
+		t.Fatalf("Expected one store read and two cache hits, got %+v", stats)
+	}
+
+	kvStore.Set("flags:checkout", `{"enabled": true}`, 0)
+	waitForEvaluation(t, e, "flags:checkout", subject, true)
+	if stats := e.Stats(); stats.Invalidations != 1 {
+		t.Errorf("Expected the update to invalidate the cached flag, got %+v", stats)
+	}
+
+	kvStore.Delete("flags:checkout")
+	waitForEvaluation(t, e, "flags:checkout", subject, false)
+	if on, err := e.Evaluate("flags:missing", subject); on || err != nil {
+		t.Errorf("Expected a missing flag to be off without error, got %v (error: %v)", on, err)
+	}
+
+	// The shared evaluator caches too.
+	kvStore.Set("flags:search", `{"enabled": true}`, 0)
+	if on, err := flags.Evaluate(kvStore, "flags:search", subject); !on || err != nil {
+		t.Errorf("Expected the shared evaluator to see the flag on, got %v (error: %v)", on, err)
+	}
+}
+
+func TestFlagCacheInvalidationAfterImport(t *testing.T) {
+	// A passive store delivers notifications before each write returns.
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("flags:checkout", `{"enabled": false}`, 0)
+	e := flags.NewEvaluator(kvStore)
+	defer e.Close()
+	subject := flags.Subject{ID: "user-1"}
+
+	if on, err := e.Evaluate("flags:checkout", subject); on || err != nil {
+		t.Fatalf("Expected the flag to be off, got %v (error: %v)", on, err)
+	}
+	// An import sends a bulk summary instead of the key's update, which drops every cached flag.
+	if _, err := kvStore.ImportRedis(strings.NewReader(`SET flags:checkout '{"enabled": true}'` + "\n")); err != nil {
+		t.Fatalf("ImportRedis failed: %v", err)
+	}
+	if on, err := e.Evaluate("flags:checkout", subject); !on || err != nil {
+		t.Errorf("Expected the imported flag to be on, got %v (error: %v)", on, err)
+	}
+}
+
+func TestFlagMalformedDocument(t *testing.T) {
+	kvStore := newFlagStore(t, map[string]string{"flags:typo": `{"enabled": true, "percentag": 50}`})
+	events := make(chan string, 10)
+	kvStore.Subscribe(flags.MalformedEvent+"*", 10, func(event string) { events <- event })
+	e := flags.NewEvaluator(kvStore)
+	defer e.Close()
+
+	for i := 0; i < 2; i++ {
+		on, err := e.Evaluate("flags:typo", flags.Subject{ID: "user-1"})
+		if on || !errors.Is(err, flags.ErrMalformedFlag) {
+			t.Fatalf("Expected a malformed flag to be off with ErrMalformedFlag, got %v (error: %v)", on, err)
+		}
+	}
+	select {
+	case event := <-events:
+		if event != flags.MalformedEvent+"flags:typo" {
+			t.Errorf("Unexpected notification %q", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the malformed flag to be reported")
+	}
+	if stats := e.Stats(); stats.Malformed != 1 {
+		t.Errorf("Expected the malformed document to be reported once, got %+v", stats)
+	}
+
+	for _, document := range []string{`not json`, `{"enabled": true, "percentage": 150}`,
+		`{"enabled": true, "rules": [{"attribute": "country", "operator": "like"}]}`, `{"enabled": true} {}`} {
+		if _, err := flags.Parse(document); !errors.Is(err, flags.ErrMalformedFlag) {
+			t.Errorf("Expected %s to be malformed, got %v", document, err)
+		}
+	}
+}
+
+func TestFlagHandler(t *testing.T) {
+	kvStore := newFlagStore(t, map[string]string{
+		"beta": `{"enabled": true, "rules": [{"attribute": "country", "operator": "in", "values": ["FR"]}]}`,
+		"typo": `{"enable": true}`,
+	})
+	e := flags.NewEvaluator(kvStore)
+	defer e.Close()
+	server := httptest.NewServer(flags.Handler(e))
+	defer server.Close()
+
+	tests := []struct {
+		path    string
+		status  int
+		enabled bool
+	}{
+		{"/api/v1/flags/beta/evaluate?subject_id=u1&country=FR", http.StatusOK, true},
+		{"/api/v1/flags/beta/evaluate?subject_id=u1&country=US", http.StatusOK, false},
+		{"/api/v1/flags/typo/evaluate?subject_id=u1", http.StatusOK, false},
+		{"/api/v1/flags/beta/evaluate", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		var body struct {
+			Key     string `json:"key"`
+			Enabled bool   `json:"enabled"`
+			Error   string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || body.Enabled != tt.enabled {
+			t.Errorf("GET %s: expected %d and enabled %v, got %d and %+v", tt.path, tt.status, tt.enabled, resp.StatusCode, body)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func FuzzLoad(f *testing.F) {
+	f.Add([]byte(`{}`))
+	f.Add([]byte(`{"key":[{"Value":"value","Timestamp":"2024-01-01T00:00:00Z"}]}`))
+	f.Add([]byte(`{"key":[{"Value":"v1"},{"Value":"v2","Timestamp":"0001-01-01T00:00:00Z"}],"empty":[]}`))
+	for _, fixture := range []string{"malformed_empty_history.json", "malformed_missing_timestamps.json", "malformed_duplicates.json"} {
+		if raw, err := os.ReadFile(filepath.Join("testdata", fixture)); err == nil {
+			f.Add(raw)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		compressedData, err := store.CompressData(data)
+		if err != nil {
+			t.Fatalf("Failed to compress input: %v", err)
+		}
+		filePath := filepath.Join(t.TempDir(), "store.json")
+		if err := os.WriteFile(filePath, []byte(base64.StdEncoding.EncodeToString(compressedData)), 0644); err != nil {
+			t.Fatalf("Failed to write input: %v", err)
+		}
+
+		kvStore := store.NewKeyValueStore(filePath, nil, 0, 1*time.Minute)
+		defer kvStore.Stop()
+
+		if _, err := kvStore.Get("key"); err != nil && !kvStore.Loaded() {
+			// Rejected input must surface as an error, never a panic.
+			return
+		}
+		for _, key := range kvStore.Keys() {
+			if _, err := kvStore.GetHistory(key); err != nil {
+				t.Errorf("Listed key %q has no history: %v", key, err)
+			}
+		}
+		if err := kvStore.Set("fuzz", "value", 0); err != nil {
+			t.Errorf("Failed to set key after load: %v", err)
+		}
+	})
+}
+
+func FuzzCompression(f *testing.F) {
+	f.Add([]byte(""))
+	f.Add([]byte("abcdefghijklmnopqrstuvwxyz0123456789"))
+	f.Add(bytes.Repeat([]byte("a"), 10000))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		compressedData, err := store.CompressData(data)
+		if err != nil {
+			t.Fatalf("Failed to compress: %v", err)
+		}
+		decompressedData, err := store.DecompressData(compressedData)
+		if err != nil {
+			t.Fatalf("Failed to decompress: %v", err)
+		}
+		if !bytes.Equal(data, decompressedData) {
+			t.Errorf("Round trip mismatch")
+		}
+
+		// Arbitrary input must be rejected with an error, not a panic.
+		_, _ = store.DecompressData(data)
+	})
+}
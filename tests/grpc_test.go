@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	kvgrpc "github.com/Chahine-tech/minikeyvalue/internal/grpc"
+	"github.com/Chahine-tech/minikeyvalue/internal/grpc/kvpb"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// newGRPCClient serves the KeyValue service of kvStore over an in-memory connection and returns a
+// client of it.
+func newGRPCClient(t *testing.T, kvStore *store.KeyValueStore, opts ...kvgrpc.Option) kvpb.KeyValueClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	kvgrpc.Register(server, kvStore, opts...)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return kvpb.NewKeyValueClient(conn)
+}
+
+func TestGRPCKeys(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	client := newGRPCClient(t, kvStore)
+	ctx := context.Background()
+
+	if _, err := client.Set(ctx, &kvpb.SetRequest{Key: "config/app", Value: "v1", TtlMs: 60000}); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	got, err := client.Get(ctx, &kvpb.GetRequest{Key: "config/app"})
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got.Value != "v1" || got.TtlMs <= 0 || got.TtlMs > 60000 {
+		t.Errorf("Expected v1 with a TTL of at most a minute, got %+v", got)
+	}
+
+	swap, err := client.CompareAndSwap(ctx, &kvpb.CompareAndSwapRequest{Key: "config/app", OldValue: "stale", NewValue: "v2"})
+	if err != nil || swap.Swapped {
+		t.Errorf("Expected a stale old value not to swap, got %+v, %v", swap, err)
+	}
+	swap, err = client.CompareAndSwap(ctx, &kvpb.CompareAndSwapRequest{Key: "config/app", OldValue: "v1", NewValue: "v2"})
+	if err != nil || !swap.Swapped {
+		t.Errorf("Expected the current value to swap, got %+v, %v", swap, err)
+	}
+	if value, _ := kvStore.Get("config/app"); value != "v2" {
+		t.Errorf("Expected v2 after the swap, got %q", value)
+	}
+
+	if _, err := client.Delete(ctx, &kvpb.DeleteRequest{Key: "config/app"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := client.Get(ctx, &kvpb.GetRequest{Key: "config/app"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for a deleted key, got %v", err)
+	}
+	if _, err := client.Set(ctx, &kvpb.SetRequest{Key: "k", Value: "v", TtlMs: -1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument for a negative TTL, got %v", err)
+	}
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	kvStore := store.NewPassive(store.WithAuthorizer(ownPrefix))
+	defer kvStore.Stop()
+	client := newGRPCClient(t, kvStore, kvgrpc.WithAPIKeys(map[string]string{"alice-key": "alice"}))
+	alice := metadata.AppendToOutgoingContext(context.Background(), kvgrpc.APIKeyMetadata, "alice-key")
+
+	if _, err := client.Set(context.Background(), &kvpb.SetRequest{Key: "alice/profile", Value: "A"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated without an API key, got %v", err)
+	}
+	unknown := metadata.AppendToOutgoingContext(context.Background(), kvgrpc.APIKeyMetadata, "guess")
+	if _, err := client.Get(unknown, &kvpb.GetRequest{Key: "alice/profile"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected Unauthenticated for an unknown API key, got %v", err)
+	}
+
+	if _, err := client.Set(alice, &kvpb.SetRequest{Key: "alice/profile", Value: "A"}); err != nil {
+		t.Fatalf("Expected alice to set her own key: %v", err)
+	}
+	if _, err := client.Set(alice, &kvpb.SetRequest{Key: "bob/profile", Value: "B"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied for another principal's key, got %v", err)
+	}
+	if _, err := kvStore.Get("bob/profile"); err == nil {
+		t.Error("Expected the denied set not to be applied")
+	}
+}
+
+func TestGRPCWatch(t *testing.T) {
+	kvStore := store.NewPassive(store.WithEventLog(4))
+	defer kvStore.Stop()
+	client := newGRPCClient(t, kvStore)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	kvStore.Set("user:old", "before the stream", 0)
+	// The stream starts after the current sequence number, however late the server handles it.
+	stream, err := client.Watch(ctx, &kvpb.WatchRequest{Prefix: "user:", Since: kvStore.LastSequence()})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	kvStore.Set("user:0", "a", 0)
+	first, err := stream.Recv()
+	if err != nil || first.Key != "user:0" || first.Type != "added" {
+		t.Fatalf("Expected the added event of user:0, got %+v, %v", first, err)
+	}
+	kvStore.Set("order:1", "other prefix", 0)
+	kvStore.Set("user:0", "b", 0)
+	kvStore.Delete("user:0")
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		e, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if e.Time.AsTime().IsZero() {
+			t.Errorf("Expected the event time, got %+v", e)
+		}
+		got = append(got, e.Type+":"+e.Key)
+	}
+	if want := fmt.Sprint([]string{"updated:user:0", "deleted:user:0"}); fmt.Sprint(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	resumed, err := client.Watch(ctx, &kvpb.WatchRequest{Since: first.Seq})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if e, err := resumed.Recv(); err != nil || e.Key != "order:1" {
+		t.Errorf("Expected to resume with order:1, got %+v, %v", e, err)
+	}
+
+	// Events evicted from the log cannot be replayed.
+	for i := 0; i < 10; i++ {
+		kvStore.Set("d", fmt.Sprint(i), 0)
+	}
+	stale, err := client.Watch(ctx, &kvpb.WatchRequest{Since: first.Seq})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if _, err := stale.Recv(); status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for evicted events, got %v", err)
+	}
+}
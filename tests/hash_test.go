@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestHashOperations(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	if added, err := kvStore.HSet("user:1", map[string]string{"name": "Jane", "city": "Paris"}); err != nil || added != 2 {
+		t.Fatalf("Expected HSet to add 2 fields, got %d (%v)", added, err)
+	}
+	if added, _ := kvStore.HSet("user:1", map[string]string{"city": "Lyon", "age": "30"}); added != 1 {
+		t.Errorf("Expected 1 new field, got %d", added)
+	}
+	if value, err := kvStore.HGet("user:1", "city"); err != nil || value != "Lyon" {
+		t.Errorf("Expected Lyon, got %q (%v)", value, err)
+	}
+	if _, err := kvStore.HGet("user:1", "email"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound for a missing field, got %v", err)
+	}
+	want := map[string]string{"name": "Jane", "city": "Lyon", "age": "30"}
+	if hash, _ := kvStore.HGetAll("user:1"); !reflect.DeepEqual(hash, want) {
+		t.Errorf("Expected %v, got %v", want, hash)
+	}
+
+	if removed, _ := kvStore.HDel("user:1", "age", "email"); removed != 1 {
+		t.Errorf("Expected 1 field removed, got %d", removed)
+	}
+	kvStore.HDel("user:1", "name", "city")
+	if _, err := kvStore.Get("user:1"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected removing the last field to delete the key, got %v", err)
+	}
+	if hash, err := kvStore.HGetAll("user:1"); err != nil || len(hash) != 0 {
+		t.Errorf("Expected a missing hash to be empty, got %v (%v)", hash, err)
+	}
+	if _, err := kvStore.HGet("user:1", "name"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound for a missing key, got %v", err)
+	}
+}
+
+func TestHashWrongTypeAndTTL(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	kvStore.RPush("queue", "a")
+	if _, err := kvStore.HSet("queue", map[string]string{"f": "v"}); !errors.Is(err, store.ErrWrongType) {
+		t.Errorf("Expected ErrWrongType setting a field of a list, got %v", err)
+	}
+	kvStore.Set("null", "null", 0)
+	if _, err := kvStore.HGetAll("null"); !errors.Is(err, store.ErrWrongType) {
+		t.Errorf("Expected ErrWrongType reading null as a hash, got %v", err)
+	}
+
+	kvStore.Set("session", `{"user":"jane"}`, time.Hour)
+	kvStore.HSet("session", map[string]string{"role": "admin"})
+	if value, ttl, _ := kvStore.GetWithTTL("session"); value != `{"role":"admin","user":"jane"}` || ttl <= 59*time.Minute {
+		t.Errorf("Expected HSet to keep the TTL, got %s with %v", value, ttl)
+	}
+}
+
+func TestHashConcurrentFields(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				field := fmt.Sprintf("f%d-%d", w, i)
+				if _, err := kvStore.HSet("counters", map[string]string{field: "1"}); err != nil {
+					t.Errorf("HSet failed: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if hash, _ := kvStore.HGetAll("counters"); len(hash) != 80 {
+		t.Errorf("Expected 80 fields, got %d", len(hash))
+	}
+}
+
+func TestHashConcurrentFieldsUnderRetention(t *testing.T) {
+	// Deleting the last field deletes the key, and the next HSet creates it at the same history length.
+	kvStore := store.NewPassive(store.WithVersionRetention(store.VersionRetention{MaxVersions: 1}))
+	defer kvStore.Stop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				field := fmt.Sprintf("f%d-%d", w, i)
+				if _, err := kvStore.HSet("counters", map[string]string{field: "1"}); err != nil {
+					t.Errorf("HSet failed: %v", err)
+				}
+				if i%2 == 1 {
+					if n, err := kvStore.HDel("counters", field); err != nil || n != 1 {
+						t.Errorf("Expected HDel to remove %s, got %d (%v)", field, n, err)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if hash, _ := kvStore.HGetAll("counters"); len(hash) != 200 {
+		t.Errorf("Expected 200 fields, got %d", len(hash))
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestPreWriteHooks(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 1*time.Minute)
+	defer kvStore.Stop()
+
+	var mu sync.Mutex
+	var events []string
+	kvStore.RegisterNotificationListener(func(event string) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+
+	var order []string
+	kvStore.RegisterPreWriteHook("", func(key, value string) (string, string, error) {
+		order = append(order, "trim")
+		return key, strings.TrimSpace(value), nil
+	})
+	kvStore.RegisterPreWriteHook("user:", func(key, value string) (string, string, error) {
+		order = append(order, "tenant")
+		if value == "" {
+			return "", "", errors.New("empty value")
+		}
+		return "acme/" + key, value, nil
+	})
+
+	if err := kvStore.Set("user:1", "  Jane  ", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if strings.Join(order, ",") != "trim,tenant" {
+		t.Errorf("Expected hooks in registration order, got %v", order)
+	}
+	if value, err := kvStore.Get("acme/user:1"); err != nil || value != "Jane" {
+		t.Errorf("Expected rewritten key to hold 'Jane', got %q (error: %v)", value, err)
+	}
+	if _, err := kvStore.Get("user:1"); err == nil {
+		t.Errorf("Expected the original key not to be stored")
+	}
+
+	// Hooks only apply to keys matching their prefix.
+	order = nil
+	kvStore.Set("city", " Paris ", 0)
+	if strings.Join(order, ",") != "trim" {
+		t.Errorf("Expected only the catch-all hook to run, got %v", order)
+	}
+
+	// An error from a hook aborts the write.
+	if err := kvStore.Set("user:2", "   ", 0); err == nil || !strings.Contains(err.Error(), "empty value") {
+		t.Errorf("Expected the write to be aborted, got %v", err)
+	}
+	if _, err := kvStore.Get("acme/user:2"); err == nil {
+		t.Errorf("Expected aborted write not to be stored")
+	}
+
+	swapped, err := kvStore.CompareAndSwap("user:1", "Jane", " John ", 0)
+	if err != nil || !swapped {
+		t.Errorf("Expected CompareAndSwap on the rewritten key to succeed, got %v (error: %v)", swapped, err)
+	}
+	if value, _ := kvStore.Get("acme/user:1"); value != "John" {
+		t.Errorf("Expected 'John' after CompareAndSwap, got %q", value)
+	}
+
+	result := kvStore.SetMany([]store.Entry{{Key: "user:3", Value: " Jack "}, {Key: "user:4", Value: ""}})
+	if strings.Join(result.Created, ",") != "acme/user:3" || result.Errors["user:4"] == nil {
+		t.Errorf("Unexpected SetMany result: %+v", result)
+	}
+
+	// Notifications carry the rewritten keys.
+	waitFor(t, time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) >= 4
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	for _, event := range events {
+		if strings.Contains(event, ":user:") {
+			t.Errorf("Expected notifications to carry rewritten keys, got %q", event)
+		}
+	}
+	if len(events) == 0 || !strings.HasPrefix(events[0], "added:acme/user:1@") {
+		t.Errorf("Expected an added event for the rewritten key, got %v", events)
+	}
+}
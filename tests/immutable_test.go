@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/sqlitestore"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestMarkImmutable(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("config:region", "eu-west", time.Hour)
+	kvStore.Set("config:other", "x", 0)
+
+	if err := kvStore.MarkImmutable("missing"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected missing keys to be refused, got %v", err)
+	}
+	if err := kvStore.MarkImmutable("config:region"); err != nil {
+		t.Fatalf("MarkImmutable failed: %v", err)
+	}
+	if value, ttl, err := kvStore.GetWithTTL("config:region"); err != nil || value != "eu-west" || ttl > 0 {
+		t.Errorf("Expected the key to be readable without a TTL, got %q with %v (%v)", value, ttl, err)
+	}
+	if got := kvStore.ImmutableKeys(); !reflect.DeepEqual(got, []string{"config:region"}) {
+		t.Errorf("Expected config:region to be immutable, got %v", got)
+	}
+
+	err := kvStore.Set("config:region", "us-east", 0)
+	if !errors.Is(err, store.ErrImmutableKey) || errs.KindOf(err) != errs.Conflict {
+		t.Errorf("Expected Set to fail with ErrImmutableKey as a conflict, got %v", err)
+	}
+	if _, err := kvStore.CompareAndSwap("config:region", "eu-west", "us-east", 0); !errors.Is(err, store.ErrImmutableKey) {
+		t.Errorf("Expected CompareAndSwap to fail with ErrImmutableKey, got %v", err)
+	}
+	result := kvStore.SetMany([]store.Entry{{Key: "config:region", Value: "us-east"}, {Key: "config:other", Value: "y"}})
+	if len(result.Errors) != 1 || result.Errors["config:region"] == nil {
+		t.Errorf("Expected SetMany to refuse only the immutable key, got %v", result.Errors)
+	}
+	if err := kvStore.Delete("config:region"); err == nil {
+		t.Error("Expected Delete to be refused")
+	}
+	if _, err := kvStore.ExpireByPrefix("config:", time.Minute); err != nil {
+		t.Fatalf("ExpireByPrefix failed: %v", err)
+	}
+	if _, ttl, _ := kvStore.GetWithTTL("config:region"); ttl > 0 {
+		t.Errorf("Expected bulk TTL updates to skip immutable keys, got %v", ttl)
+	}
+	if value, _ := kvStore.Get("config:region"); value != "eu-west" {
+		t.Errorf("Expected the value to be unchanged, got %q", value)
+	}
+
+	if err := kvStore.UnmarkImmutable("config:region"); err != nil {
+		t.Fatalf("UnmarkImmutable failed: %v", err)
+	}
+	if err := kvStore.Set("config:region", "us-east", 0); err != nil {
+		t.Fatalf("Expected writes after unfreezing, got %v", err)
+	}
+	if value, _ := kvStore.Get("config:region"); value != "us-east" {
+		t.Errorf("Expected the new value, got %q", value)
+	}
+}
+
+func TestForceDeleteImmutable(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("flag", "on", 0)
+	kvStore.MarkImmutable("flag")
+
+	if err := kvStore.ForceDelete("flag"); err != nil {
+		t.Fatalf("ForceDelete failed: %v", err)
+	}
+	if _, err := kvStore.Get("flag"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected the key to be gone, got %v", err)
+	}
+	if got := kvStore.ImmutableKeys(); len(got) != 0 {
+		t.Errorf("Expected the key to be unfrozen by the delete, got %v", got)
+	}
+	if err := kvStore.Set("flag", "off", 0); err != nil {
+		t.Errorf("Expected a recreated key to be writable, got %v", err)
+	}
+}
+
+func TestMarkImmutableRacingWrite(t *testing.T) {
+	// The write passes its immutability check, then waits before taking the lock.
+	faults := store.NewFaultInjector()
+	faults.AddRule(store.FaultRule{Op: store.OpSet, KeyPattern: "flag", Probability: 1, Latency: 100 * time.Millisecond})
+	faults.Enable(true)
+	kvStore := store.NewPassive(store.WithFaultInjector(faults))
+	defer kvStore.Stop()
+	kvStore.Set("flag", "on", 0)
+
+	written := make(chan error, 1)
+	go func() { written <- kvStore.Set("flag", "off", 0) }()
+	time.Sleep(20 * time.Millisecond)
+	if err := kvStore.MarkImmutable("flag"); err != nil {
+		t.Fatalf("MarkImmutable failed: %v", err)
+	}
+	if err := <-written; !errors.Is(err, store.ErrImmutableKey) {
+		t.Errorf("Expected the write to find the key frozen, got %v", err)
+	}
+
+	// The lock-free read agrees with the stored history.
+	value, _ := kvStore.Get("flag")
+	history, _ := kvStore.GetAllVersions("flag")
+	if value != "on" || !reflect.DeepEqual(history, []string{"on"}) {
+		t.Errorf("Expected the frozen value to be the latest version, got %q with history %v", value, history)
+	}
+}
+
+// immutableRestartSuite checks that immutable keys stay frozen across restarts of the stores returned by open.
+func immutableRestartSuite(t *testing.T, open func() *store.KeyValueStore) {
+	kvStore := open()
+	kvStore.Set("frozen", "1", 0)
+	kvStore.Set("thawed", "2", 0)
+	kvStore.MarkImmutable("frozen")
+	kvStore.MarkImmutable("thawed")
+	kvStore.UnmarkImmutable("thawed")
+	kvStore.Stop()
+
+	reopened := open()
+	defer reopened.Stop()
+	if got := reopened.ImmutableKeys(); !reflect.DeepEqual(got, []string{"frozen"}) {
+		t.Fatalf("Expected frozen to stay immutable, got %v", got)
+	}
+	if reopened.Size() != 2 {
+		t.Errorf("Expected the immutable record to stay out of the keys, got %v", reopened.Keys())
+	}
+	if value, err := reopened.Get("frozen"); err != nil || value != "1" {
+		t.Errorf("Expected the frozen value, got %q (%v)", value, err)
+	}
+	if err := reopened.Set("frozen", "changed", 0); !errors.Is(err, store.ErrImmutableKey) {
+		t.Errorf("Expected writes to be refused after the restart, got %v", err)
+	}
+	if err := reopened.Set("thawed", "changed", 0); err != nil {
+		t.Errorf("Expected the unfrozen key to be writable, got %v", err)
+	}
+}
+
+func TestImmutableSurvivesRestart(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "data.json")
+		immutableRestartSuite(t, func() *store.KeyValueStore {
+			return store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute)
+		})
+	})
+	t.Run("hashed keys", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "data.json")
+		immutableRestartSuite(t, func() *store.KeyValueStore {
+			return store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute, store.WithKeyHashing(keySecret))
+		})
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := sqlitestore.Open(filepath.Join(t.TempDir(), "data.db"))
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		immutableRestartSuite(t, func() *store.KeyValueStore {
+			return store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithRecordPersister(db))
+		})
+	})
+}
+
+func TestImmutableRecordIsReserved(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute)
+	kvStore.Set("config", "value", 0)
+	if err := kvStore.MarkImmutable("config"); err != nil {
+		t.Fatalf("MarkImmutable failed: %v", err)
+	}
+
+	// Writing the record of the immutable keys as a key would replace it in the next snapshot.
+	const record = "\x00immutable"
+	err := kvStore.Set(record, "{}", 0)
+	if !errors.Is(err, store.ErrReservedKey) || errs.KindOf(err) != errs.InvalidArgument {
+		t.Errorf("Expected Set to fail with ErrReservedKey as an invalid argument, got %v", err)
+	}
+	if _, err := kvStore.CompareAndSwap(record, "", "{}", 0); !errors.Is(err, store.ErrReservedKey) {
+		t.Errorf("Expected CompareAndSwap to fail with ErrReservedKey, got %v", err)
+	}
+	result := kvStore.SetMany([]store.Entry{{Key: record, Value: "{}"}, {Key: "other", Value: "x"}})
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[record], store.ErrReservedKey) {
+		t.Errorf("Expected SetMany to refuse only the reserved key, got %v", result.Errors)
+	}
+	if err := kvStore.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	kvStore.Stop()
+
+	kvStore = store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	if got := kvStore.ImmutableKeys(); !reflect.DeepEqual(got, []string{"config"}) {
+		t.Errorf("Expected config to stay immutable, got %v", got)
+	}
+	if value, err := kvStore.Get("other"); err != nil || value != "x" {
+		t.Errorf("Expected 'x', got %q (error: %v)", value, err)
+	}
+}
+
+func BenchmarkImmutableGet(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, frozen := range []bool{false, true} {
+		b.Run(fmt.Sprintf("immutable=%v", frozen), func(b *testing.B) {
+			kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(store.NewMemoryBackend()))
+			defer kvStore.Stop()
+			kvStore.Set("config", "value", 0)
+			if frozen {
+				kvStore.MarkImmutable("config")
+			}
+
+			// Writers keep the store lock busy while the benchmark reads.
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			for w := 0; w < 4; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; ; i++ {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						kvStore.Set(fmt.Sprintf("w%d:%d", w, i%100), "v", 0)
+					}
+				}(w)
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					kvStore.Get("config")
+				}
+			})
+			b.StopTimer()
+			close(stop)
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// slowRecords is an in-memory record persister that takes delay to rewrite a key.
+type slowRecords struct {
+	mu    sync.Mutex
+	delay time.Duration
+	data  map[string][]store.KeyValue
+}
+
+func (r *slowRecords) LoadRecords() (map[string][]store.KeyValue, map[string]time.Time, error) {
+	return make(map[string][]store.KeyValue), make(map[string]time.Time), nil
+}
+
+func (r *slowRecords) AppendVersion(key string, version store.KeyValue, expiresAt time.Time) error {
+	return nil
+}
+
+func (r *slowRecords) ReplaceKey(key string, versions []store.KeyValue, expiresAt time.Time) error {
+	time.Sleep(r.delay)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[key] = versions
+	return nil
+}
+
+func (r *slowRecords) DeleteKey(key string) error { return nil }
+
+func (r *slowRecords) ReplaceAll(data map[string][]store.KeyValue, expirations map[string]time.Time) error {
+	return nil
+}
+
+// waitForJob polls the job until done reports true for its status.
+func waitForJob(t *testing.T, kvStore *store.KeyValueStore, id string, done func(store.JobStatus) bool) store.JobStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		status, err := kvStore.JobStatus(id)
+		if err != nil {
+			t.Fatalf("JobStatus failed: %v", err)
+		}
+		if done(status) {
+			return status
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not reach the expected state", id)
+	return store.JobStatus{}
+}
+
+func TestCompactionJobCancel(t *testing.T) {
+	const keys, versions = 2000, 4
+	records := &slowRecords{delay: 200 * time.Microsecond, data: make(map[string][]store.KeyValue)}
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithRecordPersister(records))
+	defer kvStore.Stop()
+	for i := 0; i < keys; i++ {
+		for v := 0; v < versions; v++ {
+			kvStore.Set(fmt.Sprintf("key%05d", i), fmt.Sprintf("v%d", v), 0)
+		}
+	}
+
+	id, err := kvStore.StartCompaction(1)
+	if err != nil {
+		t.Fatalf("StartCompaction failed: %v", err)
+	}
+	if _, err := kvStore.StartCompaction(1); !errors.Is(err, store.ErrJobRunning) {
+		t.Errorf("Expected a second job to be refused, got %v", err)
+	}
+
+	status := waitForJob(t, kvStore, id, func(s store.JobStatus) bool { return s.Done > 0 })
+	if status.State != store.JobRunning || status.Total != keys || status.Percent <= 0 || status.Percent >= 100 {
+		t.Fatalf("Expected a running job with partial progress, got %+v", status)
+	}
+	if err := kvStore.CancelJob(id); err != nil {
+		t.Fatalf("CancelJob failed: %v", err)
+	}
+	status = waitForJob(t, kvStore, id, func(s store.JobStatus) bool { return s.State != store.JobRunning })
+	if status.State != store.JobCanceled || status.Done >= keys || status.Finished.IsZero() {
+		t.Fatalf("Expected the job to be canceled midway, got %+v", status)
+	}
+
+	// Keys are compacted in sorted order: those reported done lost their old versions, the rest kept them.
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key%05d", i)
+		history, err := kvStore.GetHistory(key)
+		if err != nil {
+			t.Fatalf("GetHistory(%s) failed: %v", key, err)
+		}
+		want := versions
+		if i < status.Done {
+			want = 1
+		}
+		if len(history) != want || history[len(history)-1].Value != fmt.Sprintf("v%d", versions-1) {
+			t.Fatalf("Expected %s to hold %d versions ending with the latest, got %+v", key, want, history)
+		}
+	}
+
+	// Another job may start once the canceled one has finished.
+	id, err = kvStore.StartCompaction(2)
+	if err != nil {
+		t.Fatalf("StartCompaction after cancel failed: %v", err)
+	}
+	status = waitForJob(t, kvStore, id, func(s store.JobStatus) bool { return s.State != store.JobRunning })
+	if status.State != store.JobSucceeded || status.Percent != 100 {
+		t.Errorf("Expected the second compaction to succeed, got %+v", status)
+	}
+	if jobs := kvStore.Jobs(); len(jobs) != 2 || jobs[0].State != store.JobCanceled {
+		t.Errorf("Expected both jobs to be listed, got %+v", jobs)
+	}
+}
+
+func TestJobFailureAndUnknownJob(t *testing.T) {
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(store.NewMemoryBackend()))
+	defer kvStore.Stop()
+
+	id, err := kvStore.StartJob("broken", func(ctx context.Context, progress func(done, total int)) error {
+		progress(1, 4)
+		return errors.New("disk on fire")
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	status := waitForJob(t, kvStore, id, func(s store.JobStatus) bool { return s.State != store.JobRunning })
+	if status.State != store.JobFailed || status.Error != "disk on fire" || status.Percent != 25 {
+		t.Errorf("Expected a failed job at 25%%, got %+v", status)
+	}
+
+	if _, err := kvStore.JobStatus("job-404"); !errors.Is(err, store.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+	if err := kvStore.CancelJob("job-404"); !errors.Is(err, store.ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestStopCancelsRunningJob(t *testing.T) {
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(store.NewMemoryBackend()))
+	started := make(chan struct{})
+	id, err := kvStore.StartJob("wait", func(ctx context.Context, progress func(done, total int)) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("StartJob failed: %v", err)
+	}
+	<-started
+	kvStore.Stop()
+	if status, _ := kvStore.JobStatus(id); status.State != store.JobCanceled {
+		t.Errorf("Expected Stop to cancel the job, got %+v", status)
+	}
+}
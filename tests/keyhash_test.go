@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/sqlitestore"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+var keySecret = []byte("key-hashing-secret")
+
+func TestPersistenceSuiteHashedKeys(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "data.json")
+		persistenceSuite(t, func() *store.KeyValueStore {
+			return store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute, store.WithKeyHashing(keySecret))
+		})
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := sqlitestore.Open(filepath.Join(t.TempDir(), "data.db"))
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		defer db.Close()
+		persistenceSuite(t, func() *store.KeyValueStore {
+			return store.NewKeyValueStore("", encryptionKey, 0, 1*time.Minute, store.WithKeyHashing(keySecret), store.WithRecordPersister(db))
+		})
+	})
+}
+
+func TestHashedKeysNeverPersistedInPlaintext(t *testing.T) {
+	const email = "jane.doe@example.com"
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "data.db")
+	db, err := sqlitestore.Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, 1*time.Minute, store.WithKeyHashing(keySecret), store.WithRecordPersister(db))
+	kvStore.Set("user:"+email, "profile", 0)
+	kvStore.Set("user:"+email, "profile v2", time.Hour)
+	kvStore.Set("session:"+email, "token", 0)
+	kvStore.Delete("session:" + email)
+	var snapshot bytes.Buffer
+	if err := kvStore.SaveTo(&snapshot); err != nil {
+		t.Fatalf("SaveTo failed: %v", err)
+	}
+	kvStore.Stop()
+	db.Close()
+
+	raw, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+	for _, needle := range []string{email, "jane.doe", "user:"} {
+		if bytes.Contains(raw, []byte(needle)) {
+			t.Errorf("Database file contains plaintext key material %q", needle)
+		}
+	}
+
+	// Loading restores the plaintext keys, prefix scans included.
+	db, err = sqlitestore.Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+	reopened := store.NewKeyValueStore("", encryptionKey, 0, 1*time.Minute, store.WithKeyHashing(keySecret), store.WithRecordPersister(db))
+	defer reopened.Stop()
+	if value, err := reopened.Get("user:" + email); err != nil || value != "profile v2" {
+		t.Errorf("Expected 'profile v2', got %q (error: %v)", value, err)
+	}
+	if _, ttl, err := reopened.GetWithTTL("user:" + email); err != nil || ttl <= 0 {
+		t.Errorf("Expected the expiration to survive, got %v (error: %v)", ttl, err)
+	}
+	listingID, err := reopened.BeginKeyListing("user:")
+	if err != nil {
+		t.Fatalf("BeginKeyListing failed: %v", err)
+	}
+	if page, _ := reopened.KeyListingPage(listingID, 0, 10); strings.Join(page.Keys, ",") != "user:"+email {
+		t.Errorf("Expected the prefix scan to find the plaintext key, got %v", page.Keys)
+	}
+
+	// A store with a different secret refuses the data.
+	wrongSecret, err := store.NewKeyValueStoreFromReader(bytes.NewReader(snapshot.Bytes()), encryptionKey, store.WithKeyHashing([]byte("other")))
+	if err == nil {
+		wrongSecret.Stop()
+		t.Error("Expected loading with the wrong key secret to fail")
+	}
+}
+
+func TestDumpRevealsHashedKeys(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 1*time.Minute, store.WithKeyHashing(keySecret))
+	defer kvStore.Stop()
+	kvStore.Set("user:jane@example.com", "Jane", 0)
+
+	var hashed, revealed bytes.Buffer
+	if err := kvStore.DumpTo(&hashed, false); err != nil {
+		t.Fatalf("DumpTo failed: %v", err)
+	}
+	if err := kvStore.DumpTo(&revealed, true); err != nil {
+		t.Fatalf("DumpTo failed: %v", err)
+	}
+
+	plain, err := store.NewKeyValueStoreFromReader(&revealed, encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to load revealed dump without a secret: %v", err)
+	}
+	defer plain.Stop()
+	if value, err := plain.Get("user:jane@example.com"); err != nil || value != "Jane" {
+		t.Errorf("Expected 'Jane' from the revealed dump, got %q (error: %v)", value, err)
+	}
+
+	if _, err := store.NewKeyValueStoreFromReader(&hashed, encryptionKey); err == nil {
+		t.Error("Expected a hashed dump to be unreadable as plaintext keys")
+	}
+}
+
+func TestKeyHashingRequiresEncryptionKey(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), nil, 0, 1*time.Minute, store.WithKeyHashing(keySecret))
+	defer kvStore.Stop()
+	kvStore.Set("name", "Jane", 0)
+	if err := kvStore.Save(); err == nil {
+		t.Error("Expected saving hashed keys without an encryption key to fail")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestCopyOnWriteIndex(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 50*time.Millisecond, store.WithCopyOnWriteIndex())
+
+	kvStore.Set("a", "1", 0)
+	kvStore.Set("b", "2", 0)
+	kvStore.Set("b", "3", 0)
+	kvStore.Set("c", "4", 0)
+	kvStore.Set("temp", "5", 10*time.Millisecond)
+	if err := kvStore.Delete("c"); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+
+	keys := kvStore.Keys()
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "a,b,temp" {
+		t.Errorf("Expected keys [a b temp], got %v", keys)
+	}
+
+	// Mutating the returned slice must not affect the index.
+	keys[0] = "mutated"
+
+	time.Sleep(200 * time.Millisecond)
+	keys = kvStore.Keys()
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "a,b" {
+		t.Errorf("Expected expired key to leave the index, got %v", keys)
+	}
+	kvStore.Stop()
+
+	reloaded := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute, store.WithCopyOnWriteIndex())
+	defer reloaded.Stop()
+	reloaded.Set("d", "6", 0)
+	keys = reloaded.Keys()
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "a,b,d" {
+		t.Errorf("Expected index rebuilt on load, got %v", keys)
+	}
+}
+
+func TestCopyOnWriteIndexConcurrent(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 1*time.Minute, store.WithCopyOnWriteIndex())
+	defer kvStore.Stop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("w%d-%d", w, i)
+				kvStore.Set(key, "value", 0)
+				if i%2 == 1 {
+					kvStore.Delete(key)
+				}
+			}
+		}(w)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				seen := make(map[string]bool)
+				for _, key := range kvStore.Keys() {
+					if seen[key] {
+						t.Errorf("Duplicate key %q in index", key)
+						return
+					}
+					seen[key] = true
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(kvStore.Keys()); got != kvStore.Size() || got != 200 {
+		t.Errorf("Expected 200 keys in index and store, got %d and %d", got, kvStore.Size())
+	}
+}
+
+func benchmarkKeysUnderWrites(b *testing.B, opts ...store.Option) {
+	kvStore := store.NewKeyValueStore(filepath.Join(b.TempDir(), "data.json"), nil, 0, 1*time.Minute, opts...)
+	defer kvStore.Stop()
+	for i := 0; i < 1000; i++ {
+		kvStore.Set(fmt.Sprintf("key-%d", i), "value", 0)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%10 == 0 {
+				kvStore.Set(fmt.Sprintf("key-%d", i%1000), "value", 0)
+			} else {
+				kvStore.Keys()
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkKeysUnderWrites(b *testing.B) {
+	b.Run("RWMutex", func(b *testing.B) { benchmarkKeysUnderWrites(b) })
+	b.Run("CopyOnWrite", func(b *testing.B) { benchmarkKeysUnderWrites(b, store.WithCopyOnWriteIndex()) })
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestKeyTTL(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	var notifications []string
+	kvStore.RegisterNotificationListener(func(n string) { notifications = append(notifications, n) })
+
+	kvStore.Set("session", "s", 0)
+	if ttl, err := kvStore.TTL("session"); err != nil || ttl != store.NoExpiration {
+		t.Errorf("Expected NoExpiration, got %v (%v)", ttl, err)
+	}
+	if err := kvStore.Expire("session", time.Hour); err != nil {
+		t.Fatalf("Expire failed: %v", err)
+	}
+	if ttl, _ := kvStore.TTL("session"); ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expected about an hour left, got %v", ttl)
+	}
+	if versions, _ := kvStore.GetAllVersions("session"); len(versions) != 1 {
+		t.Errorf("Expected Expire not to write a version, got %v", versions)
+	}
+
+	if had, err := kvStore.Persist("session"); err != nil || !had {
+		t.Errorf("Expected Persist to remove the TTL, got %v (%v)", had, err)
+	}
+	if had, _ := kvStore.Persist("session"); had {
+		t.Error("Expected Persist to report no TTL the second time")
+	}
+	if ttl, _ := kvStore.TTL("session"); ttl != store.NoExpiration {
+		t.Errorf("Expected NoExpiration after Persist, got %v", ttl)
+	}
+	// TTL changes are sequenced like writes, so consumers replaying events do not miss them.
+	seq := kvStore.LastSequence()
+	if last := notifications[len(notifications)-1]; last != fmt.Sprintf("persist:session@%d", seq) {
+		t.Errorf("Expected a persist notification at sequence %d, got %q", seq, last)
+	}
+	events, err := kvStore.EventsSince(seq - 2)
+	if err != nil || len(events) != 2 || events[0].Type != "expire" || events[1].Type != "persist" || events[1].Seq != seq {
+		t.Errorf("Expected the expire and persist events to be replayed, got %+v (error: %v)", events, err)
+	}
+
+	kvStore.Expire("session", 20*time.Millisecond)
+	time.Sleep(40 * time.Millisecond)
+	if _, err := kvStore.TTL("session"); !errors.Is(err, store.ErrKeyExpired) {
+		t.Errorf("Expected ErrKeyExpired, got %v", err)
+	}
+	if err := kvStore.Expire("session", time.Hour); !errors.Is(err, store.ErrKeyExpired) {
+		t.Errorf("Expected Expire not to revive an expired key, got %v", err)
+	}
+	if _, err := kvStore.TTL("missing"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if err := kvStore.Expire("missing", time.Hour); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if err := kvStore.Expire("missing", 0); err == nil {
+		t.Error("Expected a zero TTL to be rejected")
+	}
+
+	kvStore.Set("frozen", "f", 0)
+	kvStore.MarkImmutable("frozen")
+	if err := kvStore.Expire("frozen", time.Hour); !errors.Is(err, store.ErrImmutableKey) {
+		t.Errorf("Expected ErrImmutableKey, got %v", err)
+	}
+}
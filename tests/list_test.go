@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestListPushPopRange(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	if n, err := kvStore.RPush("queue", "b", "c"); err != nil || n != 2 {
+		t.Fatalf("Expected RPush to create a list of 2, got %d (%v)", n, err)
+	}
+	if n, _ := kvStore.LPush("queue", "a", "z"); n != 4 {
+		t.Errorf("Expected length 4, got %d", n)
+	}
+	if list, _ := kvStore.LRange("queue", 0, -1); !reflect.DeepEqual(list, []string{"z", "a", "b", "c"}) {
+		t.Errorf("Expected [z a b c], got %v", list)
+	}
+	if value, _ := kvStore.Get("queue"); value != `["z","a","b","c"]` {
+		t.Errorf("Expected the list to be stored as a JSON array, got %s", value)
+	}
+
+	ranges := []struct {
+		start, stop int
+		want        []string
+	}{
+		{1, 2, []string{"a", "b"}},
+		{-2, -1, []string{"b", "c"}},
+		{-100, 0, []string{"z"}},
+		{2, 100, []string{"b", "c"}},
+		{3, 1, []string{}},
+		{4, 10, []string{}},
+	}
+	for _, r := range ranges {
+		if list, _ := kvStore.LRange("queue", r.start, r.stop); !reflect.DeepEqual(list, r.want) {
+			t.Errorf("LRange(%d, %d): expected %v, got %v", r.start, r.stop, r.want, list)
+		}
+	}
+
+	if value, _ := kvStore.LPop("queue"); value != "z" {
+		t.Errorf("Expected LPop to return z, got %q", value)
+	}
+	if value, _ := kvStore.RPop("queue"); value != "c" {
+		t.Errorf("Expected RPop to return c, got %q", value)
+	}
+	kvStore.LPop("queue")
+	kvStore.LPop("queue")
+	if _, err := kvStore.Get("queue"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected popping the last element to delete the key, got %v", err)
+	}
+	if _, err := kvStore.RPop("queue"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound popping a missing list, got %v", err)
+	}
+	if list, err := kvStore.LRange("queue", 0, -1); err != nil || len(list) != 0 {
+		t.Errorf("Expected a missing list to be empty, got %v (%v)", list, err)
+	}
+}
+
+func TestListWrongTypeAndTTL(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	kvStore.Set("name", "Jane", 0)
+	if _, err := kvStore.RPush("name", "x"); !errors.Is(err, store.ErrWrongType) {
+		t.Errorf("Expected ErrWrongType pushing to a string, got %v", err)
+	}
+	if _, err := kvStore.LRange("name", 0, -1); !errors.Is(err, store.ErrWrongType) {
+		t.Errorf("Expected ErrWrongType reading a string as a list, got %v", err)
+	}
+	if value, _ := kvStore.Get("name"); value != "Jane" {
+		t.Errorf("Expected a failed push to leave the value alone, got %q", value)
+	}
+
+	kvStore.Set("jobs", `["a"]`, time.Hour)
+	kvStore.RPush("jobs", "b")
+	if value, ttl, _ := kvStore.GetWithTTL("jobs"); value != `["a","b"]` || ttl <= 59*time.Minute {
+		t.Errorf("Expected RPush to keep the TTL, got %s with %v", value, ttl)
+	}
+}
+
+func TestListPersisted(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.New(dataFile, store.WithEncryptionKey(encryptionKey))
+	kvStore.RPush("queue", "a", "b")
+	kvStore.Stop()
+
+	reloaded := store.New(dataFile, store.WithEncryptionKey(encryptionKey))
+	defer reloaded.Stop()
+	if list, _ := reloaded.LRange("queue", 0, -1); !reflect.DeepEqual(list, []string{"a", "b"}) {
+		t.Errorf("Expected the list to survive a reload, got %v", list)
+	}
+}
+
+func TestListConcurrentPushes(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if _, err := kvStore.RPush("queue", "x"); err != nil {
+					t.Errorf("RPush failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if list, _ := kvStore.LRange("queue", 0, -1); len(list) != 160 {
+		t.Errorf("Expected 160 elements, got %d", len(list))
+	}
+}
+
+func TestListQueueUnderRetention(t *testing.T) {
+	// Pops empty the list, deleting the key, and pushes create it again at the same history length.
+	kvStore := store.NewPassive(store.WithVersionRetention(store.VersionRetention{MaxVersions: 1}))
+	defer kvStore.Stop()
+
+	var producers, consumers sync.WaitGroup
+	var mu sync.Mutex
+	popped := map[string]int{}
+	done := make(chan struct{})
+	for w := 0; w < 4; w++ {
+		producers.Add(1)
+		go func(w int) {
+			defer producers.Done()
+			for i := 0; i < 40; i++ {
+				push := kvStore.RPush
+				if i%2 == 1 {
+					push = kvStore.LPush
+				}
+				if _, err := push("queue", fmt.Sprintf("%d-%d", w, i)); err != nil {
+					t.Errorf("Push failed: %v", err)
+				}
+			}
+		}(w)
+		consumers.Add(1)
+		go func(w int) {
+			defer consumers.Done()
+			for {
+				pop := kvStore.LPop
+				if w%2 == 1 {
+					pop = kvStore.RPop
+				}
+				value, err := pop("queue")
+				if errors.Is(err, store.ErrKeyNotFound) {
+					select {
+					case <-done:
+						return
+					default:
+						continue
+					}
+				}
+				if err != nil {
+					t.Errorf("Pop failed: %v", err)
+					return
+				}
+				mu.Lock()
+				popped[value]++
+				mu.Unlock()
+			}
+		}(w)
+	}
+	producers.Wait()
+	close(done)
+	consumers.Wait()
+
+	remaining, _ := kvStore.LRange("queue", 0, -1)
+	for _, value := range remaining {
+		popped[value]++
+	}
+	if len(popped) != 160 {
+		t.Errorf("Expected all 160 elements to be popped or left, got %d", len(popped))
+	}
+	for value, n := range popped {
+		if n != 1 {
+			t.Errorf("Expected %q once, got it %d times", value, n)
+		}
+	}
+}
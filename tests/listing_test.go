@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestKeyListingSurvivesMutations(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+
+	for i := 0; i < 200; i++ {
+		kvStore.Set(fmt.Sprintf("user:%03d", i), "v", 0)
+	}
+	kvStore.Set("other", "v", 0)
+
+	listingID, err := kvStore.BeginKeyListing("user:")
+	if err != nil {
+		t.Fatalf("BeginKeyListing failed: %v", err)
+	}
+
+	seen := make(map[string]int)
+	offset, page := 0, 0
+	for {
+		result, err := kvStore.KeyListingPage(listingID, offset, 17)
+		if err != nil {
+			t.Fatalf("KeyListingPage failed: %v", err)
+		}
+		for _, key := range result.Keys {
+			seen[key]++
+		}
+
+		// Delete keys ahead of and behind the cursor, and insert keys that sort before it.
+		for i := 0; i < 5; i++ {
+			kvStore.Delete(fmt.Sprintf("user:%03d", (page*37+i*11)%200))
+			kvStore.Set(fmt.Sprintf("user:%03d-new%d", page, i), "v", 0)
+			kvStore.Set(fmt.Sprintf("user:!%d-%d", page, i), "v", 0)
+		}
+		page++
+
+		offset = result.Next
+		if result.Done {
+			break
+		}
+	}
+
+	if len(seen) != 200 {
+		t.Fatalf("Expected 200 distinct keys, got %d", len(seen))
+	}
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("user:%03d", i)
+		if seen[key] != 1 {
+			t.Errorf("Expected %s exactly once, got %d", key, seen[key])
+		}
+	}
+	if stats := kvStore.KeyListingStats(); stats.Active != 1 || stats.Keys != 200 || stats.Bytes != 200*int64(len("user:000")) {
+		t.Errorf("Unexpected listing stats: %+v", stats)
+	}
+
+	kvStore.EndKeyListing(listingID)
+	if _, err := kvStore.KeyListingPage(listingID, 0, 10); !errors.Is(err, store.ErrListingExpired) {
+		t.Errorf("Expected ErrListingExpired after EndKeyListing, got %v", err)
+	}
+}
+
+func TestKeyListingExpiry(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithKeyListingLimits(50*time.Millisecond, 2, 3))
+	defer kvStore.Stop()
+
+	for _, key := range []string{"a1", "a2", "a3", "b1", "b2", "b3", "b4"} {
+		kvStore.Set(key, "v", 0)
+	}
+
+	if _, err := kvStore.BeginKeyListing("b"); err == nil {
+		t.Error("Expected a listing above the key limit to fail")
+	}
+
+	listingID, err := kvStore.BeginKeyListing("a")
+	if err != nil {
+		t.Fatalf("BeginKeyListing failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	_, err = kvStore.KeyListingPage(listingID, 0, 10)
+	if !errors.Is(err, store.ErrListingExpired) {
+		t.Fatalf("Expected ErrListingExpired, got %v", err)
+	}
+	if kind := errs.KindOf(err); kind != errs.NotFound {
+		t.Errorf("Expected an expired listing to map to NotFound, got %v", kind)
+	}
+	if _, err := kvStore.KeyListingPage("unknown", 0, 10); !errors.Is(err, store.ErrListingExpired) {
+		t.Errorf("Expected ErrListingExpired for an unknown listing, got %v", err)
+	}
+
+	// Beyond the listing limit, the oldest listing is evicted.
+	first, _ := kvStore.BeginKeyListing("a")
+	kvStore.BeginKeyListing("a")
+	kvStore.BeginKeyListing("a")
+	if _, err := kvStore.KeyListingPage(first, 0, 10); !errors.Is(err, store.ErrListingExpired) {
+		t.Errorf("Expected the oldest listing to be evicted, got %v", err)
+	}
+	if stats := kvStore.KeyListingStats(); stats.Active != 2 || stats.Keys != 6 {
+		t.Errorf("Unexpected listing stats: %+v", stats)
+	}
+}
+
+func TestKeyListingDefaultLimits(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithKeyListingLimits(0, 0, -1))
+	defer kvStore.Stop()
+	kvStore.Set("a1", "v", 0)
+
+	// Limits <= 0 fall back to the defaults instead of rejecting or evicting every listing.
+	listingID, err := kvStore.BeginKeyListing("a")
+	if err != nil {
+		t.Fatalf("BeginKeyListing failed: %v", err)
+	}
+	if page, err := kvStore.KeyListingPage(listingID, 0, 10); err != nil || len(page.Keys) != 1 {
+		t.Errorf("Expected a page of 1 key, got %+v (error: %v)", page, err)
+	}
+}
+
+func TestKeysPage(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	for _, key := range []string{"user:c", "user:a", "user:e", "user:b", "user:d", "order:1"} {
+		kvStore.Set(key, "v", 0)
+	}
+
+	var pages [][]string
+	cursor := ""
+	for {
+		keys, next, err := kvStore.KeysPage("user:", cursor, 2)
+		if err != nil {
+			t.Fatalf("KeysPage failed: %v", err)
+		}
+		pages = append(pages, keys)
+		if next == "" {
+			break
+		}
+		cursor = next
+		if len(pages) == 1 {
+			// Keys written behind the cursor are not returned, keys ahead of it are.
+			kvStore.Set("user:0", "v", 0)
+			kvStore.Set("user:f", "v", 0)
+		}
+	}
+	want := "[[user:a user:b] [user:c user:d] [user:e user:f]]"
+	if got := fmt.Sprint(pages); got != want {
+		t.Errorf("Expected pages %s, got %s", want, got)
+	}
+
+	if keys, next, _ := kvStore.KeysPage("", "", 100); len(keys) != 8 || next != "" {
+		t.Errorf("Expected every key on a single page, got %v (next %q)", keys, next)
+	}
+	if _, _, err := kvStore.KeysPage("", "", 0); err == nil {
+		t.Error("Expected a zero limit to fail")
+	}
+}
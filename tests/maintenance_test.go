@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 20*time.Millisecond)
+	defer kvStore.Stop()
+
+	var mu sync.Mutex
+	var events []string
+	kvStore.RegisterNotificationListener(func(event string) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+	eventCount := func(prefix string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, event := range events {
+			if strings.HasPrefix(event, prefix) {
+				n++
+			}
+		}
+		return n
+	}
+
+	kvStore.Set("name", "John", 0)
+	kvStore.Set("temp", "soon gone", 50*time.Millisecond)
+
+	kvStore.SetMaintenanceMode(true, "restoring backup")
+	if on, reason := kvStore.MaintenanceMode(); !on || reason != "restoring backup" {
+		t.Errorf("Expected maintenance mode with its reason, got %v %q", on, reason)
+	}
+
+	err := kvStore.Set("name", "Jane", 0)
+	if !errors.Is(err, store.ErrMaintenanceMode) || !strings.Contains(err.Error(), "restoring backup") {
+		t.Errorf("Expected ErrMaintenanceMode with the reason, got %v", err)
+	}
+	if errs.HTTPStatus(err) != http.StatusServiceUnavailable {
+		t.Errorf("Expected a 503 mapping, got %d", errs.HTTPStatus(err))
+	}
+	if err := kvStore.Delete("name"); !errors.Is(err, store.ErrMaintenanceMode) {
+		t.Errorf("Expected Delete to be fenced, got %v", err)
+	}
+	if _, err := kvStore.CompareAndSwap("name", "John", "Jane", 0); !errors.Is(err, store.ErrMaintenanceMode) {
+		t.Errorf("Expected CompareAndSwap to be fenced, got %v", err)
+	}
+	if result := kvStore.SetMany([]store.Entry{{Key: "a", Value: "1"}}); !errors.Is(result.Errors["a"], store.ErrMaintenanceMode) {
+		t.Errorf("Expected SetMany to be fenced, got %v", result.Errors)
+	}
+	if value, err := kvStore.Get("name"); err != nil || value != "John" {
+		t.Errorf("Expected reads to be served, got %q (error: %v)", value, err)
+	}
+
+	// The key becomes overdue during maintenance but is not swept.
+	time.Sleep(150 * time.Millisecond)
+	if eventCount("expired:") != 0 {
+		t.Errorf("Expected no expirations during maintenance")
+	}
+	if kvStore.Size() != 2 {
+		t.Errorf("Expected the overdue key to be kept during maintenance, got %d keys", kvStore.Size())
+	}
+
+	kvStore.SetMaintenanceMode(false, "")
+	if !waitFor(t, time.Second, func() bool { return eventCount("expired:temp@") == 1 }) {
+		t.Errorf("Expected the overdue key to expire after maintenance")
+	}
+	if kvStore.Size() != 1 {
+		t.Errorf("Expected only the persistent key to remain, got %d keys", kvStore.Size())
+	}
+	if err := kvStore.Set("name", "Jane", 0); err != nil {
+		t.Errorf("Expected writes after maintenance: %v", err)
+	}
+	if eventCount("maintenance_on:restoring backup") != 1 || eventCount("maintenance_off") != 1 {
+		t.Errorf("Expected enter and exit notifications, got %v", events)
+	}
+}
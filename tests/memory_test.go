@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// waitFor polls cond until it holds or the timeout expires.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestMemoryWatchdog(t *testing.T) {
+	var usage atomic.Uint64
+	usage.Store(10)
+	reader := func() (uint64, error) { return usage.Load(), nil }
+
+	backend := store.NewMemoryBackend()
+	thresholds := store.MemoryThresholds{HighWater: 100, LowWater: 50, RejectWrites: true}
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, 1*time.Minute,
+		store.WithBackend(backend), store.WithMemoryWatchdog(5*time.Millisecond, thresholds, reader))
+	defer kvStore.Stop()
+
+	var mu sync.Mutex
+	var events []string
+	kvStore.RegisterNotificationListener(func(event string) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+	hasEvent := func(want string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, event := range events {
+			if event == want {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := kvStore.Set("name", "John", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	usage.Store(200)
+	if !waitFor(t, time.Second, kvStore.MemoryPressure) {
+		t.Fatalf("Expected the watchdog to report memory pressure")
+	}
+	if !waitFor(t, time.Second, func() bool { return hasEvent("memory_pressure:200") }) {
+		t.Errorf("Expected a memory_pressure notification, got %v", events)
+	}
+
+	// The priority save persisted the write made before the pressure.
+	data, err := backend.Load()
+	if err != nil {
+		t.Fatalf("Expected a priority save: %v", err)
+	}
+	saved, err := store.NewKeyValueStoreFromReader(bytes.NewReader(data), encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to read saved data: %v", err)
+	}
+	if value, err := saved.Get("name"); err != nil || value != "John" {
+		t.Errorf("Expected 'John' in the priority save, got %q (error: %v)", value, err)
+	}
+	saved.Stop()
+
+	if err := kvStore.Set("city", "Paris", 0); !errors.Is(err, store.ErrMemoryPressure) {
+		t.Errorf("Expected ErrMemoryPressure, got %v", err)
+	}
+	if result := kvStore.SetMany([]store.Entry{{Key: "city", Value: "Paris"}}); !errors.Is(result.Errors["city"], store.ErrMemoryPressure) {
+		t.Errorf("Expected SetMany to reject the write, got %v", result.Errors)
+	}
+	if err := kvStore.Delete("name"); err != nil {
+		t.Errorf("Expected deletes to be allowed under pressure: %v", err)
+	}
+
+	// Thresholds can be changed at runtime.
+	thresholds.RejectWrites = false
+	if err := kvStore.SetMemoryThresholds(thresholds); err != nil {
+		t.Fatalf("Failed to set thresholds: %v", err)
+	}
+	if err := kvStore.Set("city", "Paris", 0); err != nil {
+		t.Errorf("Expected writes to be accepted once rejection is disabled: %v", err)
+	}
+	if err := kvStore.SetMemoryThresholds(store.MemoryThresholds{HighWater: 10, LowWater: 20}); err == nil {
+		t.Errorf("Expected an error for a low-water mark above the high-water mark")
+	}
+
+	// Usage between the marks keeps the pressure; dropping below the low-water mark clears it.
+	usage.Store(70)
+	time.Sleep(30 * time.Millisecond)
+	if !kvStore.MemoryPressure() {
+		t.Errorf("Expected pressure to persist above the low-water mark")
+	}
+	usage.Store(40)
+	if !waitFor(t, time.Second, func() bool { return !kvStore.MemoryPressure() }) {
+		t.Errorf("Expected pressure to clear below the low-water mark")
+	}
+	if !waitFor(t, time.Second, func() bool { return hasEvent("memory_pressure_cleared:40") }) {
+		t.Errorf("Expected a memory_pressure_cleared notification, got %v", events)
+	}
+}
+
+func TestMemoryWatchdogDefaultInterval(t *testing.T) {
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, 1*time.Minute,
+		store.WithBackend(store.NewMemoryBackend()),
+		store.WithMemoryWatchdog(0, store.MemoryThresholds{HighWater: 100}, func() (uint64, error) { return 10, nil }),
+		store.WithSupervisorPolicy(fastSupervision))
+	defer kvStore.Stop()
+
+	// A zero interval falls back to the default rather than crashing the loop until it is given up on.
+	time.Sleep(100 * time.Millisecond)
+	if health := componentHealth(kvStore, store.ComponentMemoryWatchdog); !health.Running || health.Restarts != 0 {
+		t.Errorf("Expected the watchdog to keep running, got %+v", health)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+var mergeBase = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// history builds versions from alternating values and minute offsets from mergeBase.
+func history(entries ...any) []store.KeyValue {
+	var versions []store.KeyValue
+	for i := 0; i < len(entries); i += 2 {
+		versions = append(versions, store.KeyValue{
+			Value:     entries[i].(string),
+			Timestamp: mergeBase.Add(time.Duration(entries[i+1].(int)) * time.Minute),
+		})
+	}
+	return versions
+}
+
+// encodeSnapshot encodes histories in the persisted format.
+func encodeSnapshot(t *testing.T, histories map[string][]store.KeyValue) []byte {
+	t.Helper()
+	data, err := json.Marshal(histories)
+	if err != nil {
+		t.Fatalf("Failed to marshal snapshot: %v", err)
+	}
+	compressed, err := store.CompressData(data)
+	if err != nil {
+		t.Fatalf("Failed to compress snapshot: %v", err)
+	}
+	encrypted, err := store.EncryptData(compressed, encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to encrypt snapshot: %v", err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(encrypted))
+}
+
+// divergentStores returns a live store and a diverged snapshot of it.
+func divergentStores(t *testing.T) (*store.KeyValueStore, []byte) {
+	t.Helper()
+	live := map[string][]store.KeyValue{
+		"same":       history("a", 0, "b", 1),
+		"live-newer": history("a", 0, "live", 10),
+		"dump-newer": history("a", 0, "live", 5),
+		"tie":        history("a", 0, "live", 7),
+		"longer":     history("a", 0, "b", 1, "c", 2),
+		"live-only":  history("x", 0),
+	}
+	dump := map[string][]store.KeyValue{
+		"same":       history("a", 0, "b", 1),
+		"live-newer": history("a", 0, "dump", 8),
+		"dump-newer": history("a", 0, "dump", 9),
+		"tie":        history("a", 0, "dump", 7),
+		"longer":     history("a", 0, "z", 3),
+		"dump-only":  history("y", 0),
+	}
+	kvStore, err := store.NewKeyValueStoreFromReader(bytes.NewReader(encodeSnapshot(t, live)), encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to load live store: %v", err)
+	}
+	t.Cleanup(kvStore.Stop)
+	return kvStore, encodeSnapshot(t, dump)
+}
+
+// resolutions maps each conflicting key to its resolution and reason.
+func resolutions(report store.MergeReport) map[string]string {
+	byKey := make(map[string]string)
+	for _, c := range report.Conflicts {
+		byKey[c.Key] = c.Resolution + " (" + c.Reason + ")"
+	}
+	return byKey
+}
+
+func assertVersions(t *testing.T, kvStore *store.KeyValueStore, key, want string) {
+	t.Helper()
+	versions, err := kvStore.GetAllVersions(key)
+	if err != nil || strings.Join(versions, ",") != want {
+		t.Errorf("Expected %s versions [%s], got %v (error: %v)", key, want, versions, err)
+	}
+}
+
+func TestMergeKeepNewest(t *testing.T) {
+	kvStore, dump := divergentStores(t)
+	report, err := kvStore.Merge(bytes.NewReader(dump), store.MergeOptions{Policy: store.KeepNewest})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if strings.Join(report.Imported, ",") != "dump-only" || report.Unchanged != 1 {
+		t.Errorf("Expected dump-only imported and one unchanged key, got %+v", report)
+	}
+	want := map[string]string{
+		"live-newer": "kept-live (newer)",
+		"dump-newer": "took-incoming (newer)",
+		"tie":        "kept-live (timestamp tie)",
+		"longer":     "took-incoming (newer)",
+	}
+	got := resolutions(report)
+	if len(got) != len(want) {
+		t.Errorf("Expected %d conflicts, got %v", len(want), got)
+	}
+	for key, resolution := range want {
+		if got[key] != resolution {
+			t.Errorf("Expected %s to be %s, got %q", key, resolution, got[key])
+		}
+	}
+
+	assertVersions(t, kvStore, "live-newer", "a,live")
+	assertVersions(t, kvStore, "dump-newer", "a,dump")
+	assertVersions(t, kvStore, "tie", "a,live")
+	assertVersions(t, kvStore, "dump-only", "y")
+	assertVersions(t, kvStore, "live-only", "x")
+}
+
+func TestMergeRejectsEmptyHistory(t *testing.T) {
+	kvStore, _ := divergentStores(t)
+	dump := encodeSnapshot(t, map[string][]store.KeyValue{"live-newer": {}, "empty": {}})
+	report, err := kvStore.Merge(bytes.NewReader(dump), store.MergeOptions{Policy: store.KeepNewest})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if len(report.Errors) != 2 || len(report.Imported) != 0 || len(report.Conflicts) != 0 {
+		t.Errorf("Expected both empty histories to be rejected, got %+v", report)
+	}
+	assertVersions(t, kvStore, "live-newer", "a,live")
+	if _, err := kvStore.Get("empty"); err == nil {
+		t.Errorf("Expected a key with an empty history not to be imported")
+	}
+}
+
+func TestMergeKeepLongestHistory(t *testing.T) {
+	kvStore, dump := divergentStores(t)
+	report, err := kvStore.Merge(bytes.NewReader(dump), store.MergeOptions{Policy: store.KeepLongestHistory})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	got := resolutions(report)
+	if got["longer"] != "kept-live (longer history)" {
+		t.Errorf("Expected the longer live history to win, got %q", got["longer"])
+	}
+	if got["dump-newer"] != "took-incoming (equal history length, newer)" {
+		t.Errorf("Expected equal lengths to fall back to the newest, got %q", got["dump-newer"])
+	}
+	if got["tie"] != "kept-live (equal history length, timestamp tie)" {
+		t.Errorf("Expected a full tie to keep the live history, got %q", got["tie"])
+	}
+	assertVersions(t, kvStore, "longer", "a,b,c")
+}
+
+func TestMergeHistories(t *testing.T) {
+	kvStore, dump := divergentStores(t)
+	report, err := kvStore.Merge(bytes.NewReader(dump), store.MergeOptions{Policy: store.MergeHistories})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if len(report.Conflicts) != 4 {
+		t.Errorf("Expected 4 merged conflicts, got %+v", report.Conflicts)
+	}
+	// The shared first version appears once; a timestamp tie puts the live version first.
+	assertVersions(t, kvStore, "live-newer", "a,dump,live")
+	assertVersions(t, kvStore, "dump-newer", "a,live,dump")
+	assertVersions(t, kvStore, "tie", "a,live,dump")
+	assertVersions(t, kvStore, "longer", "a,b,c,z")
+	for _, c := range report.Conflicts {
+		if c.Key == "longer" && c.Versions != 4 {
+			t.Errorf("Expected 4 versions kept for longer, got %d", c.Versions)
+		}
+	}
+}
+
+func TestMergeWithCallback(t *testing.T) {
+	kvStore, dump := divergentStores(t)
+
+	if _, err := kvStore.Merge(bytes.NewReader(dump), store.MergeOptions{Policy: store.ResolveWithCallback}); err == nil {
+		t.Error("Expected the callback policy without a callback to fail")
+	}
+
+	var seen []string
+	report, err := kvStore.Merge(bytes.NewReader(dump), store.MergeOptions{
+		Policy: store.ResolveWithCallback,
+		Resolve: func(c store.MergeConflict) ([]store.KeyValue, error) {
+			seen = append(seen, c.Key)
+			if c.Key == "tie" {
+				return nil, errors.New("needs a human")
+			}
+			last := c.Incoming[len(c.Incoming)-1]
+			last.Value = "resolved-" + last.Value
+			return append(c.Live, last), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	if strings.Join(seen, ",") != "dump-newer,live-newer,longer,tie" {
+		t.Errorf("Expected the callback for each conflict in key order, got %v", seen)
+	}
+	if report.Errors["tie"] == nil || len(report.Errors) != 1 {
+		t.Errorf("Expected the failed callback to be reported for tie, got %v", report.Errors)
+	}
+	if got := resolutions(report); got["longer"] != "callback (resolved by callback)" {
+		t.Errorf("Unexpected resolution for longer: %q", got["longer"])
+	}
+	assertVersions(t, kvStore, "longer", "a,b,c,resolved-z")
+	assertVersions(t, kvStore, "tie", "a,live")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// copyLegacyFixture copies the legacy flat map fixture to a data file and returns its path and contents.
+func copyLegacyFixture(t *testing.T) (string, []byte) {
+	t.Helper()
+	legacy, err := os.ReadFile(filepath.Join("testdata", "legacy_flat_map.json"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(path, legacy, 0644); err != nil {
+		t.Fatalf("Failed to write data file: %v", err)
+	}
+	return path, legacy
+}
+
+func TestMigrationChain(t *testing.T) {
+	path, legacy := copyLegacyFixture(t)
+
+	kvStore := store.NewKeyValueStore(path, encryptionKey, 0, time.Minute, store.WithMigrations(store.DefaultMigrations()...))
+	plan, err := kvStore.PlanMigrations()
+	if err != nil {
+		t.Fatalf("PlanMigrations failed: %v", err)
+	}
+	if len(plan.Steps) != 2 || plan.Steps[0].Name != "flat-map" || plan.Steps[1].Name != "seal-plain-json" || plan.Keys != 3 {
+		t.Fatalf("Expected both migrations to be planned for 3 keys, got %+v", plan)
+	}
+	if plan.Preserve != path+".pre-migration-1" {
+		t.Errorf("Expected the original to be preserved as generation 1, got %s", plan.Preserve)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, legacy) {
+		t.Fatal("Expected planning to leave the data file unchanged")
+	}
+
+	for key, want := range map[string]string{"user:1": "alice", "user:2": "bob", "config/theme": "dark"} {
+		if got, err := kvStore.Get(key); err != nil || got != want {
+			t.Errorf("Expected %s to be %q after migrating, got %q (%v)", key, want, got, err)
+		}
+	}
+	kvStore.Stop()
+
+	if preserved, err := os.ReadFile(plan.Preserve); err != nil || !bytes.Equal(preserved, legacy) {
+		t.Fatalf("Expected the original to be preserved, got %v", err)
+	}
+	if _, err := os.Stat(path + ".migrating"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no generation file to be left, got %v", err)
+	}
+
+	// The migrated file is in the current format and needs no migration.
+	reopened := store.NewKeyValueStore(path, encryptionKey, 0, time.Minute)
+	defer reopened.Stop()
+	if got, err := reopened.Get("user:2"); err != nil || got != "bob" {
+		t.Errorf("Expected the migrated file to load without migrations, got %q (%v)", got, err)
+	}
+}
+
+func TestMigrationVerificationCatchesCorruption(t *testing.T) {
+	path, legacy := copyLegacyFixture(t)
+	faults := store.NewFaultInjector()
+	faults.AddRule(store.FaultRule{Op: store.OpMigrate, Probability: 1, Corrupt: true})
+	faults.Enable(true)
+
+	kvStore := store.NewKeyValueStore(path, encryptionKey, 0, time.Minute,
+		store.WithMigrations(store.DefaultMigrations()...), store.WithFaultInjector(faults))
+	if _, err := kvStore.Get("user:1"); !errors.Is(err, store.ErrMigrationVerification) {
+		t.Fatalf("Expected the corrupted generation to fail verification, got %v", err)
+	}
+	kvStore.Stop()
+	if n := faults.Stats().Corruptions[store.OpMigrate]; n != 1 {
+		t.Errorf("Expected one corruption, got %d", n)
+	}
+
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, legacy) {
+		t.Error("Expected the original data file to be left untouched")
+	}
+	for _, suffix := range []string{".migrating", ".pre-migration-1"} {
+		if _, err := os.Stat(path + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected no %s file after a failed migration, got %v", suffix, err)
+		}
+	}
+
+	// Without the fault, the same file migrates.
+	faults.Enable(false)
+	retry := store.NewKeyValueStore(path, encryptionKey, 0, time.Minute, store.WithMigrations(store.DefaultMigrations()...))
+	defer retry.Stop()
+	if got, err := retry.Get("user:1"); err != nil || got != "alice" {
+		t.Errorf("Expected the retry to migrate, got %q (%v)", got, err)
+	}
+}
+
+func TestMigrationRollback(t *testing.T) {
+	path, legacy := copyLegacyFixture(t)
+	if _, err := store.RollbackMigration(path, 0); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected nothing to roll back before a migration, got %v", err)
+	}
+
+	kvStore := store.NewKeyValueStore(path, encryptionKey, 0, time.Minute, store.WithMigrations(store.DefaultMigrations()...))
+	if err := kvStore.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	kvStore.Stop()
+	migrated, _ := os.ReadFile(path)
+
+	owner, err := store.OpenKeyValueStore(path, encryptionKey, 0, time.Minute, store.WithOwnerFile())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if _, err := store.RollbackMigration(path, 0); !errors.Is(err, store.ErrDataFileInUse) {
+		t.Errorf("Expected rollback to refuse an owned data file, got %v", err)
+	}
+	owner.Stop()
+
+	generation, err := store.RollbackMigration(path, 0)
+	if err != nil || generation != 1 {
+		t.Fatalf("Expected generation 1 to be restored, got %d (%v)", generation, err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, legacy) {
+		t.Error("Expected the legacy original to be restored")
+	}
+	if kept, _ := os.ReadFile(path + ".post-migration-1"); !bytes.Equal(kept, migrated) {
+		t.Error("Expected the migrated file to be kept")
+	}
+	if _, err := os.Stat(path + ".pre-migration-1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the preserved original to be moved back, got %v", err)
+	}
+}
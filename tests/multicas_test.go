@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// promote moves the staging config to active, provided neither changed since they were read.
+func promote(kvStore *store.KeyValueStore, active, staging, by string) (bool, error) {
+	return kvStore.MultiCompareAndSwap(
+		[]store.Condition{{Key: "config:active", Value: active}, {Key: "config:staging", Value: staging}},
+		[]store.Update{{Key: "config:active", Value: staging}, {Key: "config:staging", Value: "promoted by " + by}})
+}
+
+func TestMultiCompareAndSwapRacingPromoters(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+
+	for round := 0; round < 50; round++ {
+		active, staging := fmt.Sprintf("v%d", round), fmt.Sprintf("v%d", round+1)
+		kvStore.Set("config:active", active, 0)
+		kvStore.Set("config:staging", staging, 0)
+
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		mixed := make(chan string, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				values, _, _ := kvStore.GetManyConsistent([]string{"config:active", "config:staging"})
+				a, s := values["config:active"].Value, values["config:staging"].Value
+				if (a == active) != (s == staging) {
+					select {
+					case mixed <- fmt.Sprintf("active %q with staging %q", a, s):
+					default:
+					}
+				}
+			}
+		}()
+
+		results := make(chan error, 2)
+		for _, by := range []string{"a", "b"} {
+			go func(by string) {
+				ok, err := promote(kvStore, active, staging, by)
+				if ok != (err == nil) {
+					t.Errorf("Expected success exactly when there is no error, got %v and %v", ok, err)
+				}
+				results <- err
+			}(by)
+		}
+		succeeded := 0
+		for i := 0; i < 2; i++ {
+			err := <-results
+			var failed *store.ConditionFailedError
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.As(err, &failed):
+				if failed.Index != 0 || failed.Value != staging {
+					t.Errorf("Expected the loser to fail on the active config, now %q, got %+v", staging, failed)
+				}
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}
+		close(stop)
+		wg.Wait()
+
+		if succeeded != 1 {
+			t.Fatalf("Round %d: expected exactly one promoter to succeed, got %d", round, succeeded)
+		}
+		select {
+		case state := <-mixed:
+			t.Fatalf("Round %d: observed a mixed state: %s", round, state)
+		default:
+		}
+		if value, _ := kvStore.Get("config:active"); value != staging {
+			t.Fatalf("Round %d: expected %q to be active, got %q", round, staging, value)
+		}
+	}
+}
+
+func TestMultiCompareAndSwapConditions(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	kvStore.Set("a", "1", 0)
+	kvStore.Set("a", "2", 0)
+	kvStore.Set("b", "x", 0)
+	events := make(chan string, 10)
+	kvStore.Subscribe("*", 10, func(event string) { events <- event })
+
+	values, _, _ := kvStore.GetManyConsistent([]string{"a"})
+	revision := values["a"].Revision
+
+	// A stale revision fails without writing anything.
+	ok, err := kvStore.MultiCompareAndSwap(
+		[]store.Condition{{Key: "b", Value: "x"}, {Key: "a", Revision: revision - 1, ByRevision: true}},
+		[]store.Update{{Key: "b", Value: "y"}})
+	var failed *store.ConditionFailedError
+	if ok || !errors.As(err, &failed) || failed.Index != 1 || failed.Revision != revision || errs.KindOf(err) != errs.Conflict {
+		t.Fatalf("Expected the revision condition to fail as a conflict, got %v, %v", ok, err)
+	}
+	if value, _ := kvStore.Get("b"); value != "x" {
+		t.Errorf("Expected no update after a failed condition, got %q", value)
+	}
+
+	// A missing key fails its condition.
+	if _, err := kvStore.MultiCompareAndSwap([]store.Condition{{Key: "missing"}}, nil); !errors.As(err, &failed) || failed.Found {
+		t.Errorf("Expected a missing key to fail its condition, got %v", err)
+	}
+
+	ok, err = kvStore.MultiCompareAndSwap(
+		[]store.Condition{{Key: "a", Revision: revision, ByRevision: true}},
+		[]store.Update{{Key: "b", Delete: true}, {Key: "c", Value: "new", TTL: time.Hour}})
+	if !ok || err != nil {
+		t.Fatalf("Expected the swap to apply, got %v, %v", ok, err)
+	}
+	if _, err := kvStore.Get("b"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected b to be deleted, got %v", err)
+	}
+	if _, ttl, err := kvStore.GetWithTTL("c"); err != nil || ttl <= 0 {
+		t.Errorf("Expected c to be set with a TTL, got %v (%v)", ttl, err)
+	}
+	// Events of the setup writes may still be in flight.
+	seen := map[string]bool{}
+	for !seen["deleted:b@4"] || !seen["added:c@5"] {
+		select {
+		case event := <-events:
+			seen[event] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected an event per update, got %v", seen)
+		}
+	}
+}
+
+func TestMultiCompareAndSwapRevisionAfterRecreate(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	kvStore.Set("k", "x", 0)
+
+	// A transaction reads k, which is then deleted and set again with the same history length.
+	txn := kvStore.Begin()
+	value, err := txn.Get("k")
+	if err != nil {
+		t.Fatalf("Failed to read k: %v", err)
+	}
+	kvStore.Delete("k")
+	kvStore.Set("k", "x2", 0)
+	txn.Set("k", value+"+txn", 0)
+
+	var failed *store.ConditionFailedError
+	if err := txn.Commit(); !errors.As(err, &failed) || failed.Value != "x2" {
+		t.Fatalf("Expected the commit to fail on the re-created key, got %v", err)
+	}
+	if value, _ := kvStore.Get("k"); value != "x2" {
+		t.Errorf("Expected the re-created value to be kept, got %q", value)
+	}
+
+	// Removing the latest version does not bring its predecessor's revision back.
+	kvStore.Set("k", "x3", 0)
+	values, _, _ := kvStore.GetManyConsistent([]string{"k"})
+	before := values["k"].Revision
+	kvStore.Set("k", "x4", 0)
+	if err := kvStore.RemoveVersion("k", 2); err != nil {
+		t.Fatalf("Failed to remove the latest version: %v", err)
+	}
+	values, _, _ = kvStore.GetManyConsistent([]string{"k"})
+	if values["k"].Value != "x3" || values["k"].Revision <= before {
+		t.Errorf("Expected x3 at a revision after %d, got %+v", before, values["k"])
+	}
+	ok, err := kvStore.MultiCompareAndSwap([]store.Condition{{Key: "k", Revision: before, ByRevision: true}}, []store.Update{{Key: "k", Value: "stale"}})
+	if ok || !errors.Is(err, store.ErrConditionFailed) {
+		t.Errorf("Expected the revision read before the removal to fail, got %v, %v", ok, err)
+	}
+}
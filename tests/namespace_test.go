@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// configNamespace returns a store holding a config namespace and an unrelated key.
+func configNamespace(t *testing.T) *store.KeyValueStore {
+	t.Helper()
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(store.NewMemoryBackend()))
+	t.Cleanup(kvStore.Stop)
+	kvStore.Set("config:a", "a1", 0)
+	kvStore.Set("config:a", "a2", 0)
+	kvStore.Set("config:b", "b1", time.Hour)
+	kvStore.Set("configuration", "unrelated", 0)
+	return kvStore
+}
+
+func TestCloneNamespace(t *testing.T) {
+	kvStore := configNamespace(t)
+
+	count, err := kvStore.CloneNamespace("config:", "config-candidate:", false)
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 keys to be cloned, got %d (%v)", count, err)
+	}
+	assertVersions(t, kvStore, "config-candidate:a", "a2")
+	if value, ttl, err := kvStore.GetWithTTL("config-candidate:b"); err != nil || value != "b1" || ttl <= 50*time.Minute {
+		t.Errorf("Expected b to be cloned with its TTL, got %q with %v (%v)", value, ttl, err)
+	}
+	if _, err := kvStore.Get("config-candidate:tion"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected keys outside the namespace to be left alone, got %v", err)
+	}
+
+	if _, err := kvStore.CloneNamespace("config:", "history:", false, store.CloneHistory()); err != nil {
+		t.Fatalf("CloneNamespace failed: %v", err)
+	}
+	assertVersions(t, kvStore, "history:a", "a1,a2")
+
+	if _, err := kvStore.CloneNamespace("config:", "config:copy:", false); err == nil {
+		t.Error("Expected nested namespaces to be refused")
+	}
+}
+
+func TestCloneNamespaceCollisions(t *testing.T) {
+	kvStore := configNamespace(t)
+	kvStore.Set("config-candidate:a", "stale", 0)
+
+	count, err := kvStore.CloneNamespace("config:", "config-candidate:", false)
+	if !errors.Is(err, store.ErrNamespaceExists) || count != 0 {
+		t.Fatalf("Expected ErrNamespaceExists, got %d (%v)", count, err)
+	}
+	if _, err := kvStore.Get("config-candidate:b"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected nothing to be copied on a collision, got %v", err)
+	}
+
+	count, err = kvStore.CloneNamespace("config:", "config-candidate:", true, store.CloneDryRun())
+	if err != nil || count != 2 {
+		t.Errorf("Expected a dry run to count 2 keys, got %d (%v)", count, err)
+	}
+	if value, _ := kvStore.Get("config-candidate:a"); value != "stale" {
+		t.Errorf("Expected a dry run to change nothing, got %q", value)
+	}
+
+	count, err = kvStore.CloneNamespace("config:", "config-candidate:", true, store.CloneBatch(1))
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 keys to be cloned, got %d (%v)", count, err)
+	}
+	assertVersions(t, kvStore, "config-candidate:a", "a2")
+}
+
+func TestPromoteNamespaceIsAtomic(t *testing.T) {
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute, store.WithBackend(store.NewMemoryBackend()))
+	defer kvStore.Stop()
+	events := &eventRecorder{}
+	kvStore.Subscribe("namespace_*", 10, events.record)
+
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("config:k%d", i)
+		keys = append(keys, key)
+		kvStore.Set(key, "blue", 0)
+	}
+	kvStore.Set("config:retired", "blue", 0)
+	if _, err := kvStore.CloneNamespace("config:", "config-candidate:", false); err != nil {
+		t.Fatalf("CloneNamespace failed: %v", err)
+	}
+	for _, key := range keys {
+		kvStore.Set("config-candidate:"+key[len("config:"):], "green", 0)
+	}
+	kvStore.Delete("config-candidate:retired")
+	kvStore.Set("config-candidate:added", "green", time.Hour)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	mixed := make(chan string, 1)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				values, _, _ := kvStore.GetManyConsistent(keys)
+				for _, key := range keys[1:] {
+					if values[key].Value != values[keys[0]].Value {
+						select {
+						case mixed <- fmt.Sprintf("%s=%q with %s=%q", keys[0], values[keys[0]].Value, key, values[key].Value):
+						default:
+						}
+					}
+				}
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := kvStore.PromoteNamespace("config-candidate:", "config:"); err != nil {
+		t.Fatalf("PromoteNamespace failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	select {
+	case state := <-mixed:
+		t.Fatalf("Observed a mix of namespaces: %s", state)
+	default:
+	}
+
+	for _, key := range keys {
+		if value, _ := kvStore.Get(key); value != "green" {
+			t.Fatalf("Expected %s to be promoted, got %q", key, value)
+		}
+	}
+	if _, ttl, err := kvStore.GetWithTTL("config:added"); err != nil || ttl <= 0 {
+		t.Errorf("Expected the added key to be promoted with its TTL, got %v (%v)", ttl, err)
+	}
+	if _, err := kvStore.Get("config:retired"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected the retired key to leave the target namespace, got %v", err)
+	}
+	if value, _ := kvStore.Get("config-candidate:retired"); value != "blue" {
+		t.Errorf("Expected the previous namespace to be kept as the candidate, got %q", value)
+	}
+	if value, _ := kvStore.Get("config-candidate:k0"); value != "blue" {
+		t.Errorf("Expected the previous value under the candidate prefix, got %q", value)
+	}
+	assertVersions(t, kvStore, "config:k0", "blue,green")
+	if !waitFor(t, 2*time.Second, func() bool { return events.has("namespace_promoted:config::21") }) {
+		t.Error("Expected a namespace_promoted summary")
+	}
+}
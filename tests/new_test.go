@@ -0,0 +1,67 @@
+package main
+
+import (
+	"compress/zlib"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	open := func() *store.KeyValueStore {
+		return store.New(filePath,
+			store.WithEncryptionKey(encryptionKey),
+			store.WithGlobalTTL(time.Hour),
+			store.WithCompressionLevel(zlib.BestCompression),
+			store.WithAutoSave(20*time.Millisecond),
+		)
+	}
+
+	kvStore := open()
+	kvStore.Set("session", "abc", 0)
+	if _, ttl, err := kvStore.GetWithTTL("session"); err != nil || ttl <= 59*time.Minute {
+		t.Errorf("Expected the global TTL to apply, got %v (%v)", ttl, err)
+	}
+
+	// The autosave persists the write without an explicit Save.
+	if !waitFor(t, 2*time.Second, func() bool { _, err := os.Stat(filePath); return err == nil }) {
+		t.Fatal("Expected the write to be autosaved")
+	}
+	snapshot, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("Failed to open the data file: %v", err)
+	}
+	defer snapshot.Close()
+	saved, err := store.NewKeyValueStoreFromReader(snapshot, encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to read the autosaved data: %v", err)
+	}
+	defer saved.Stop()
+	if value, err := saved.Get("session"); err != nil || value != "abc" {
+		t.Errorf("Expected the autosaved value, got %q (%v)", value, err)
+	}
+	kvStore.Stop()
+
+	wrongKey := store.New(filePath, store.WithEncryptionKey([]byte("wrong-key-wrong-key-wrong-key-32")))
+	defer wrongKey.Stop()
+	if _, err := wrongKey.Get("session"); err == nil {
+		t.Error("Expected the data to be encrypted with the configured key")
+	}
+}
+
+func TestOpenReportsConfigurationErrors(t *testing.T) {
+	_, err := store.Open(filepath.Join(t.TempDir(), "data.json"), store.RequireEncryption())
+	if !errors.Is(err, store.ErrEncryptionRequired) {
+		t.Errorf("Expected ErrEncryptionRequired without a key, got %v", err)
+	}
+	kvStore, err := store.Open(filepath.Join(t.TempDir(), "data.json"), store.RequireEncryption(), store.WithEncryptionKey(encryptionKey))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	kvStore.Stop()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestOffloadFaultInUnderConcurrency(t *testing.T) {
+	sidecar := store.NewMemoryBackend()
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 1*time.Minute,
+		store.WithHistoryOffload(2, 0, sidecar))
+	defer kvStore.Stop()
+
+	for i := 0; i < 10; i++ {
+		if err := kvStore.Set("counter", fmt.Sprintf("v%d", i), 0); err != nil {
+			t.Fatalf("Failed to set key: %v", err)
+		}
+	}
+
+	n, err := kvStore.OffloadColdHistories()
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 key offloaded, got %d (error: %v)", n, err)
+	}
+	stats := kvStore.OffloadStats()
+	if stats.Keys != 1 || stats.Versions != 8 || stats.BytesReclaimed != 16 {
+		t.Errorf("Unexpected offload stats: %+v", stats)
+	}
+	if value, err := kvStore.Get("counter"); err != nil || value != "v9" {
+		t.Errorf("Expected latest value 'v9', got %q (error: %v)", value, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				versions, err := kvStore.GetAllVersions("counter")
+				if err != nil || len(versions) < 10 {
+					t.Errorf("Expected full history, got %v (error: %v)", versions, err)
+				}
+				return
+			}
+			value, err := kvStore.GetVersion("counter", 0)
+			if err != nil || value != "v0" {
+				t.Errorf("Expected oldest version 'v0', got %q (error: %v)", value, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if stats := kvStore.OffloadStats(); stats.Keys != 0 || stats.BytesReclaimed != 0 {
+		t.Errorf("Expected nothing offloaded after fault-in, got %+v", stats)
+	}
+
+	// A key that was just read is hot and is not offloaded again until it goes idle.
+	idleStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "idle.json"), encryptionKey, 0, 1*time.Minute,
+		store.WithHistoryOffload(1, time.Hour, store.NewMemoryBackend()))
+	defer idleStore.Stop()
+	idleStore.Set("name", "Jane", 0)
+	idleStore.Set("name", "John", 0)
+	if n, err := idleStore.OffloadColdHistories(); err != nil || n != 0 {
+		t.Errorf("Expected hot key to stay in memory, got %d offloaded (error: %v)", n, err)
+	}
+}
+
+func TestOffloadSaveLoadRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "data.json")
+	sidecar := store.NewFileBackend(filepath.Join(dir, "data.history"))
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute, store.WithHistoryOffload(1, 0, sidecar))
+	for _, value := range []string{"Jane", "John", "Jack"} {
+		if err := kvStore.Set("name", value, 0); err != nil {
+			t.Fatalf("Failed to set key: %v", err)
+		}
+	}
+	kvStore.Set("city", "Paris", 0)
+	if _, err := kvStore.OffloadColdHistories(); err != nil {
+		t.Fatalf("Failed to offload histories: %v", err)
+	}
+	kvStore.Stop()
+
+	reloaded := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute, store.WithHistoryOffload(1, 0, sidecar))
+	defer reloaded.Stop()
+
+	if value, err := reloaded.Get("name"); err != nil || value != "Jack" {
+		t.Errorf("Expected 'Jack', got %q (error: %v)", value, err)
+	}
+	if stats := reloaded.OffloadStats(); stats.Keys != 1 || stats.Versions != 2 {
+		t.Errorf("Expected offloaded state to survive reload, got %+v", stats)
+	}
+	history, err := reloaded.GetHistory("name")
+	if err != nil || len(history) != 3 || history[0].Value != "Jane" || history[2].Value != "Jack" {
+		t.Errorf("Expected full history after reload, got %v (error: %v)", history, err)
+	}
+
+	// Deleting a key drops its offloaded versions so a new key with the same name starts fresh.
+	reloaded.OffloadColdHistories()
+	if err := reloaded.Delete("name"); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+	reloaded.Set("name", "Jill", 0)
+	if versions, err := reloaded.GetAllVersions("name"); err != nil || len(versions) != 1 {
+		t.Errorf("Expected a single version after re-creating the key, got %v (error: %v)", versions, err)
+	}
+}
+
+func TestOffloadForgottenOnExpiry(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 1*time.Minute,
+		store.WithHistoryOffload(1, 0, store.NewMemoryBackend()))
+	defer kvStore.Stop()
+
+	kvStore.Set("session", "old1", 0)
+	kvStore.Set("session", "old2", 0)
+	kvStore.Set("session", "old3", 20*time.Millisecond)
+	if n, err := kvStore.OffloadColdHistories(); err != nil || n != 1 {
+		t.Fatalf("Expected 1 key offloaded, got %d (error: %v)", n, err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if n, err := kvStore.SweepExpired(); err != nil || n != 1 {
+		t.Fatalf("Expected 1 key swept, got %d (error: %v)", n, err)
+	}
+
+	// A key created again after expiring does not inherit the offloaded versions of the expired one.
+	kvStore.Set("session", "new", 0)
+	if versions, err := kvStore.GetAllVersions("session"); err != nil || len(versions) != 1 || versions[0] != "new" {
+		t.Errorf("Expected [new] after re-creating the expired key, got %v (error: %v)", versions, err)
+	}
+	if stats := kvStore.OffloadStats(); stats.Keys != 0 {
+		t.Errorf("Expected nothing offloaded after expiry, got %+v", stats)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestOwnerFileAnnouncesRunningStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	kvStore, err := store.OpenKeyValueStore(path, encryptionKey, 0, time.Minute, store.WithOwnerFile())
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	data, err := os.ReadFile(path + ".owner")
+	if err != nil || strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+		t.Fatalf("Expected the owner file to hold this process, got %q (%v)", data, err)
+	}
+	if pid, owned, err := store.DataFileOwner(path); err != nil || !owned || pid != os.Getpid() {
+		t.Errorf("Expected this process to own the data file, got %d, %v, %v", pid, owned, err)
+	}
+
+	kvStore.Set("key", "value", 0)
+	kvStore.Stop()
+	if _, err := os.Stat(path + ".owner"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected Stop to remove the owner file, got %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected saving to leave no temporary file, got %v", err)
+	}
+	if _, owned, _ := store.DataFileOwner(path); owned {
+		t.Error("Expected no owner after Stop")
+	}
+}
+
+func TestOwnerFileRefusesLiveOwner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	owner := os.Getppid()
+	if err := os.WriteFile(path+".owner", []byte(strconv.Itoa(owner)+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write owner file: %v", err)
+	}
+
+	if _, err := store.OpenKeyValueStore(path, encryptionKey, 0, time.Minute, store.WithOwnerFile()); !errors.Is(err, store.ErrDataFileInUse) {
+		t.Fatalf("Expected ErrDataFileInUse, got %v", err)
+	}
+	if pid, owned, err := store.DataFileOwner(path); err != nil || !owned || pid != owner {
+		t.Errorf("Expected process %d to still own the data file, got %d, %v, %v", owner, pid, owned, err)
+	}
+}
+
+func TestOwnerFileReplacesStaleOwner(t *testing.T) {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("Cannot run a short-lived process: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "data.json")
+	if err := os.WriteFile(path+".owner", []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write owner file: %v", err)
+	}
+
+	if pid, owned, err := store.DataFileOwner(path); err != nil || owned {
+		t.Fatalf("Expected an exited process not to own the data file, got %d, %v, %v", pid, owned, err)
+	}
+	if _, err := os.Stat(path + ".owner"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the stale owner file to be removed, got %v", err)
+	}
+
+	os.WriteFile(path+".owner", []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644)
+	kvStore, err := store.OpenKeyValueStore(path, encryptionKey, 0, time.Minute, store.WithOwnerFile())
+	if err != nil {
+		t.Fatalf("Expected a stale owner file to be taken over, got %v", err)
+	}
+	defer kvStore.Stop()
+	if pid, owned, _ := store.DataFileOwner(path); !owned || pid != os.Getpid() {
+		t.Errorf("Expected this process to own the data file, got %d, %v", pid, owned)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// storeModes creates a store persisting to path, with and without background goroutines.
+var storeModes = []struct {
+	name string
+	open func(path string) *store.KeyValueStore
+}{
+	{"background", func(path string) *store.KeyValueStore {
+		return store.NewKeyValueStore(path, encryptionKey, 0, 10*time.Millisecond)
+	}},
+	{"passive", func(path string) *store.KeyValueStore {
+		return store.NewPassive(store.WithBackend(store.NewFileBackend(path)), store.WithEncryptionKey(encryptionKey))
+	}},
+}
+
+func TestStoreModes(t *testing.T) {
+	for _, mode := range storeModes {
+		t.Run(mode.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "data.json")
+			kvStore := mode.open(path)
+			events := &eventRecorder{}
+			kvStore.Subscribe("", 100, events.record)
+
+			kvStore.Set("config", "v1", 0)
+			kvStore.Set("config", "v2", 0)
+			if value, err := kvStore.Get("config"); err != nil || value != "v2" {
+				t.Errorf("Expected v2, got %q (%v)", value, err)
+			}
+			if history, err := kvStore.GetHistory("config"); err != nil || len(history) != 2 {
+				t.Errorf("Expected two versions, got %v (%v)", history, err)
+			}
+			if ok, err := kvStore.CompareAndSwap("config", "v2", "v3", 0); !ok || err != nil {
+				t.Errorf("Expected the swap to apply, got %v (%v)", ok, err)
+			}
+			if result := kvStore.SetMany([]store.Entry{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}}); len(result.Created) != 2 {
+				t.Errorf("Expected SetMany to create two keys, got %+v", result)
+			}
+			if err := kvStore.Delete("b"); err != nil {
+				t.Errorf("Delete failed: %v", err)
+			}
+
+			kvStore.Set("session", "s", 20*time.Millisecond)
+			time.Sleep(40 * time.Millisecond)
+			if _, err := kvStore.Get("session"); err == nil {
+				t.Error("Expected the expired key to be refused")
+			}
+			if _, err := kvStore.SweepExpired(); err != nil {
+				t.Errorf("SweepExpired failed: %v", err)
+			}
+			if _, err := kvStore.Get("session"); !errors.Is(err, store.ErrKeyNotFound) {
+				t.Errorf("Expected the swept key to be gone, got %v", err)
+			}
+
+			for _, prefix := range []string{"added:config@", "updated:config@", "deleted:b@", "expired:session@"} {
+				if !waitFor(t, 2*time.Second, func() bool { return events.has(prefix) }) {
+					t.Errorf("Expected a %s event", prefix)
+				}
+			}
+
+			kvStore.Stop()
+			reopened := mode.open(path)
+			defer reopened.Stop()
+			if value, err := reopened.Get("config"); err != nil || value != "v3" {
+				t.Errorf("Expected the saved value after reopening, got %q (%v)", value, err)
+			}
+			if size := reopened.Size(); size != 2 {
+				t.Errorf("Expected 2 keys after reopening, got %d", size)
+			}
+		})
+	}
+}
+
+func TestPassiveStoreStartsNoGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	kvStore := store.NewPassive(store.WithGlobalTTL(time.Hour))
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("Expected no goroutines after construction, got %d more", n-before)
+	}
+
+	var delivered []string
+	kvStore.Subscribe("", 0, func(event string) { delivered = append(delivered, event) })
+	kvStore.Set("key", "value", 0)
+	// Notifications are delivered before Set returns.
+	if len(delivered) != 1 || !strings.HasPrefix(delivered[0], "added:key@") {
+		t.Errorf("Expected the event to be delivered inline, got %v", delivered)
+	}
+	if _, ttl, _ := kvStore.GetWithTTL("key"); ttl <= 0 {
+		t.Errorf("Expected the global TTL, got %v", ttl)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("Expected no goroutines while in use, got %d more", n-before)
+	}
+
+	kvStore.Stop()
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("Expected no goroutines after Stop, got %d more", n-before)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestGetAt(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	beforeFirst := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	kvStore.Set("price", "10", 0)
+	time.Sleep(2 * time.Millisecond)
+	afterFirst := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	kvStore.Set("price", "12", 0)
+	time.Sleep(2 * time.Millisecond)
+	afterSecond := time.Now()
+
+	if value, err := kvStore.GetAt("price", afterFirst); err != nil || value != "10" {
+		t.Errorf("Expected 10 after the first write, got %q (%v)", value, err)
+	}
+	if value, _ := kvStore.GetAt("price", afterSecond); value != "12" {
+		t.Errorf("Expected 12 after the second write, got %q", value)
+	}
+	history, _ := kvStore.GetHistory("price")
+	if value, _ := kvStore.GetAt("price", history[1].Timestamp); value != "12" {
+		t.Errorf("Expected a version to be current at its own timestamp, got %q", value)
+	}
+	if _, err := kvStore.GetAt("price", beforeFirst); !errors.Is(err, store.ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound before the first write, got %v", err)
+	}
+	if _, err := kvStore.GetAt("missing", afterSecond); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestGetAtExpiredKey(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	kvStore.Set("session", "token", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	// The passive store has no cleanup, so the expired history is still held.
+	if _, err := kvStore.Get("session"); !errors.Is(err, store.ErrKeyExpired) {
+		t.Fatalf("Expected Get to report ErrKeyExpired, got %v", err)
+	}
+	if value, err := kvStore.GetAt("session", time.Now()); !errors.Is(err, store.ErrKeyExpired) {
+		t.Errorf("Expected GetAt to report ErrKeyExpired like Get, got %q (%v)", value, err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// expiryRecorder records when each key's expiration event arrived.
+type expiryRecorder struct {
+	mu     sync.Mutex
+	at     map[string]time.Time
+	counts map[string]int
+}
+
+func newExpiryRecorder(kvStore *store.KeyValueStore) *expiryRecorder {
+	r := &expiryRecorder{at: make(map[string]time.Time), counts: make(map[string]int)}
+	kvStore.Subscribe("expired:*", 4096, func(event string) {
+		key := strings.TrimPrefix(event[:strings.LastIndex(event, "@")], "expired:")
+		r.mu.Lock()
+		r.at[key] = time.Now()
+		r.counts[key]++
+		r.mu.Unlock()
+	})
+	return r
+}
+
+func (r *expiryRecorder) get(key string) (time.Time, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.at[key], r.counts[key]
+}
+
+func TestPrecisionExpiryFiresOnDeadline(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithPrecisionExpiry(0, "wf:"))
+	defer kvStore.Stop()
+	expired := newExpiryRecorder(kvStore)
+
+	deadline := time.Now().Add(50 * time.Millisecond)
+	kvStore.Set("wf:approve", "pending", 50*time.Millisecond)
+	kvStore.Set("other", "slow", 50*time.Millisecond)
+
+	if !waitFor(t, time.Second, func() bool { _, n := expired.get("wf:approve"); return n == 1 }) {
+		t.Fatal("Expected the precision key to expire without waiting for the sweep")
+	}
+	at, _ := expired.get("wf:approve")
+	if late := at.Sub(deadline); late < 0 || late > 30*time.Millisecond {
+		t.Errorf("Expected the expiration within 30ms of the deadline, got %v", late)
+	}
+	if _, n := expired.get("other"); n != 0 {
+		t.Error("Expected keys outside the prefix to wait for the sweep")
+	}
+	if stats := kvStore.PrecisionExpiryStats(); stats.Fired != 1 || stats.Timers != 0 {
+		t.Errorf("Unexpected precision stats: %+v", stats)
+	}
+}
+
+func TestPrecisionExpiryRescheduledOnChange(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithPrecisionExpiry(0, "wf:"))
+	defer kvStore.Stop()
+	expired := newExpiryRecorder(kvStore)
+
+	kvStore.Set("wf:persisted", "v", 30*time.Millisecond)
+	kvStore.Set("wf:persisted", "v2", 0) // No TTL any more
+	kvStore.Set("wf:deleted", "v", 30*time.Millisecond)
+	kvStore.Delete("wf:deleted")
+	kvStore.Set("wf:extended", "v", 30*time.Millisecond)
+	extendedAt := time.Now().Add(150 * time.Millisecond)
+	kvStore.Set("wf:extended", "v2", 150*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	for _, key := range []string{"wf:persisted", "wf:deleted", "wf:extended"} {
+		if _, n := expired.get(key); n != 0 {
+			t.Errorf("Expected no expiration for %s yet", key)
+		}
+	}
+	if _, err := kvStore.Get("wf:persisted"); err != nil {
+		t.Errorf("Expected the key without TTL to survive: %v", err)
+	}
+
+	if !waitFor(t, time.Second, func() bool { _, n := expired.get("wf:extended"); return n == 1 }) {
+		t.Fatal("Expected the extended key to expire at its new deadline")
+	}
+	if at, _ := expired.get("wf:extended"); at.Before(extendedAt) {
+		t.Errorf("Expected the extended key to expire after %v, expired at %v", extendedAt, at)
+	}
+}
+
+func TestPrecisionExpiryAndSweepNeverDoubleFire(t *testing.T) {
+	// A 1ms sweep races the timers for every key.
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Millisecond,
+		store.WithPrecisionExpiry(0, "wf:"))
+	defer kvStore.Stop()
+	expired := newExpiryRecorder(kvStore)
+
+	const keys = 300
+	for i := 0; i < keys; i++ {
+		kvStore.Set(fmt.Sprintf("wf:%d", i), "v", time.Duration(10+i%20)*time.Millisecond)
+	}
+	if !waitFor(t, 2*time.Second, func() bool { return kvStore.Size() == 0 }) {
+		t.Fatalf("Expected every key to expire, %d left", kvStore.Size())
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	fired := kvStore.PrecisionExpiryStats().Fired
+	for i := 0; i < keys; i++ {
+		if _, n := expired.get(fmt.Sprintf("wf:%d", i)); n != 1 {
+			t.Errorf("Expected exactly one expiration for wf:%d, got %d", i, n)
+		}
+	}
+	t.Logf("%d of %d keys expired by their timer", fired, keys)
+}
+
+func TestPrecisionExpiryLimit(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 20*time.Millisecond,
+		store.WithPrecisionExpiry(2, "wf:"))
+	defer kvStore.Stop()
+	expired := newExpiryRecorder(kvStore)
+
+	for _, key := range []string{"wf:a", "wf:b", "wf:c"} {
+		kvStore.Set(key, "v", time.Hour)
+	}
+	if stats := kvStore.PrecisionExpiryStats(); stats.Timers != 2 || stats.Overflow != 1 {
+		t.Errorf("Expected 2 timers and 1 overflow, got %+v", stats)
+	}
+
+	// The overflowing key still expires through the sweep.
+	kvStore.Set("wf:c", "v", 10*time.Millisecond)
+	if !waitFor(t, time.Second, func() bool { _, n := expired.get("wf:c"); return n == 1 }) {
+		t.Error("Expected the key beyond the limit to expire through the sweep")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// importRedisFixture imports a Redis commands fixture from testdata into a new store.
+func importRedisFixture(t *testing.T, fixture string) (*store.KeyValueStore, store.RedisImportReport) {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("Failed to open fixture %s: %v", fixture, err)
+	}
+	defer file.Close()
+
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	t.Cleanup(kvStore.Stop)
+	report, err := kvStore.ImportRedis(file)
+	if err != nil {
+		t.Fatalf("ImportRedis failed: %v", err)
+	}
+	return kvStore, report
+}
+
+// expectTTL checks that key has a TTL within a second of want, or none if want is store.NoExpiration.
+func expectTTL(t *testing.T, kvStore *store.KeyValueStore, key string, want time.Duration) {
+	t.Helper()
+	ttl := ttlOf(t, kvStore, key)
+	if want == store.NoExpiration {
+		if ttl != store.NoExpiration {
+			t.Errorf("Expected %s to have no TTL, got %v", key, ttl)
+		}
+		return
+	}
+	if ttl > want || ttl < want-time.Second {
+		t.Errorf("Expected %s to have a TTL of about %v, got %v", key, want, ttl)
+	}
+}
+
+var redisInlineValues = map[string]string{
+	"plain":         "hello world",
+	"session:1":     "token-1",
+	"session:2":     "token-2",
+	"cache:page":    "<html>\n</html>",
+	"binary":        "\x00\x01\xff\"quoted\"\\ tab\there",
+	"single quoted": "it's fine",
+	"short":         "soon",
+	"m1":            "one",
+	"m2":            "two",
+}
+
+func TestImportRedisInline(t *testing.T) {
+	kvStore, report := importRedisFixture(t, "redis_commands.txt")
+
+	if report.Imported != len(redisInlineValues) || report.WithTTL != 4 || report.Expired != 1 {
+		t.Errorf("Expected %d keys, 4 with TTL and 1 expired, got %+v", len(redisInlineValues), report)
+	}
+	for _, kind := range []string{"hash", "list", "set", "zset", "stream"} {
+		if report.Unsupported[kind] != 1 {
+			t.Errorf("Expected one unsupported %s command, got %v", kind, report.Unsupported)
+		}
+	}
+	if strings.Join(report.Skipped, ",") != "events,queue,scores,tags,user:1" {
+		t.Errorf("Expected the keys of unsupported types to be reported, got %v", report.Skipped)
+	}
+
+	for key, want := range redisInlineValues {
+		if value, err := kvStore.Get(key); err != nil || value != want {
+			t.Errorf("Expected %s to be %q, got %q (error: %v)", key, want, value, err)
+		}
+	}
+	for _, key := range []string{"deleted", "expired", "user:1", "queue"} {
+		if _, err := kvStore.Get(key); err == nil {
+			t.Errorf("Expected %s not to be imported", key)
+		}
+	}
+	expectTTL(t, kvStore, "plain", store.NoExpiration)
+	expectTTL(t, kvStore, "session:1", time.Hour)
+	expectTTL(t, kvStore, "session:2", 2*time.Minute)
+	expectTTL(t, kvStore, "cache:page", 10*time.Minute)
+	expectTTL(t, kvStore, "short", 1500*time.Millisecond)
+}
+
+func TestImportRedisRESP(t *testing.T) {
+	kvStore, report := importRedisFixture(t, "redis_commands.resp")
+
+	if report.Imported != 3 || report.Unsupported["hash"] != 1 || report.Unsupported["SELECT"] != 1 {
+		t.Errorf("Expected 3 keys and 2 skipped commands, got %+v", report)
+	}
+	if value, err := kvStore.Get("resp:binary"); err != nil || value != "line1\r\nline2\x00\xfe" {
+		t.Errorf("Expected the binary value to be kept, got %q (error: %v)", value, err)
+	}
+	expectTTL(t, kvStore, "resp:plain", 90*time.Second)
+	expectTTL(t, kvStore, "resp:ttl", 5*time.Minute)
+}
+
+func TestImportRedisRejectsMalformedInput(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+
+	for _, input := range []string{
+		"SET a \"unterminated\n",
+		"SET a b EX soon\n",
+		"SET a\n",
+		"*2\r\n$3\r\nSET\r\n$10\r\nshort\r\n",
+		"*1\r\n$9223372036854775807\r\nx\r\n",
+		"*9223372036854775807\r\n$3\r\nSET\r\n",
+	} {
+		if _, err := kvStore.ImportRedis(strings.NewReader(input)); err == nil {
+			t.Errorf("Expected %q to be rejected", input)
+		}
+	}
+	if kvStore.Size() != 0 {
+		t.Errorf("Expected nothing to be imported from malformed input, got %v", kvStore.Keys())
+	}
+}
+
+func TestRedisExportRoundTrip(t *testing.T) {
+	source, _ := importRedisFixture(t, "redis_commands.txt")
+
+	var exported bytes.Buffer
+	n, err := source.ExportRedis(&exported)
+	if err != nil || n != len(redisInlineValues) {
+		t.Fatalf("Expected %d keys to be exported, got %d (error: %v)", len(redisInlineValues), n, err)
+	}
+	if !strings.Contains(exported.String(), "EXPIRE \"session:1\" 3600\n") {
+		t.Errorf("Expected an EXPIRE command for session:1, got:\n%s", exported.String())
+	}
+
+	imported := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer imported.Stop()
+	report, err := imported.ImportRedis(&exported)
+	if err != nil || report.Imported != n || len(report.Unsupported) != 0 {
+		t.Fatalf("Expected the export to import cleanly, got %+v (error: %v)", report, err)
+	}
+	for key, want := range redisInlineValues {
+		if value, err := imported.Get(key); err != nil || value != want {
+			t.Errorf("Expected %s to round-trip as %q, got %q (error: %v)", key, want, value, err)
+		}
+	}
+	expectTTL(t, imported, "plain", store.NoExpiration)
+	expectTTL(t, imported, "session:1", time.Hour)
+	expectTTL(t, imported, "cache:page", 10*time.Minute)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/api"
+	"github.com/Chahine-tech/minikeyvalue/internal/client"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// remoteServer serves the API of kvStore, counting the requests that reach it.
+type remoteServer struct {
+	*httptest.Server
+	requests atomic.Int64
+}
+
+// newRemoteServer serves api.Handler for kvStore with opts, and returns it with a client for it.
+func newRemoteServer(t *testing.T, kvStore *store.KeyValueStore, opts []api.Option, clientOpts ...client.RemoteOption) (*remoteServer, *client.Remote) {
+	handler := api.Handler(kvStore, opts...)
+	s := &remoteServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	remote, err := client.NewRemote(s.URL, clientOpts...)
+	if err != nil {
+		t.Fatalf("NewRemote failed: %v", err)
+	}
+	t.Cleanup(remote.Close)
+	return s, remote
+}
+
+func TestRemoteKeys(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	_, remote := newRemoteServer(t, kvStore, nil)
+	ctx := context.Background()
+
+	if err := remote.SetContext(ctx, "config/app", "v1", 0); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := remote.SetContext(ctx, "config/app", "v2", time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, ttl, err := remote.GetWithTTLContext(ctx, "config/app"); err != nil || value != "v2" || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expected v2 with an hour to live, got %q %v (error: %v)", value, ttl, err)
+	}
+	remote.Set("config/db", "postgres", 0)
+	if _, ttl, _ := remote.GetWithTTL("config/db"); ttl != store.NoExpiration {
+		t.Errorf("Expected a key without TTL to report NoExpiration, got %v", ttl)
+	}
+
+	if swapped, err := remote.CompareAndSwapContext(ctx, "config/app", "v1", "v3", 0); err != nil || swapped {
+		t.Errorf("Expected a swap from a stale value to fail, got %v (error: %v)", swapped, err)
+	}
+	if swapped, err := remote.CompareAndSwapContext(ctx, "config/app", "v2", "v3", 0); err != nil || !swapped {
+		t.Errorf("Expected the swap to succeed, got %v (error: %v)", swapped, err)
+	}
+
+	history, err := remote.GetHistoryContext(ctx, "config/app")
+	if err != nil || len(history) != 3 || history[2].Value != "v3" || history[2].Revision == 0 || history[2].Timestamp.IsZero() {
+		t.Errorf("Unexpected history %+v (error: %v)", history, err)
+	}
+	if value, err := remote.GetVersionContext(ctx, "config/app", 0); err != nil || value != "v1" {
+		t.Errorf("Expected version 0 to be v1, got %q (error: %v)", value, err)
+	}
+	if err := remote.RemoveVersionContext(ctx, "config/app", 0); err != nil {
+		t.Errorf("RemoveVersion failed: %v", err)
+	}
+	if versions, err := remote.GetAllVersionsContext(ctx, "config/app"); err != nil || !reflect.DeepEqual(versions, []string{"v2", "v3"}) {
+		t.Errorf("Expected [v2 v3], got %v (error: %v)", versions, err)
+	}
+
+	remote.Set("config/cache", "redis", 0)
+	remote.Set("other", "x", 0)
+	page, next, err := remote.KeysPageContext(ctx, "config/", "", 2)
+	if err != nil || !reflect.DeepEqual(page, []string{"config/app", "config/cache"}) || next == "" {
+		t.Errorf("Unexpected first page %v, next %q (error: %v)", page, next, err)
+	}
+	if keys, err := remote.KeysContext(ctx, "config/"); err != nil || !reflect.DeepEqual(keys, []string{"config/app", "config/cache", "config/db"}) {
+		t.Errorf("Expected the config keys, got %v (error: %v)", keys, err)
+	}
+
+	if err := remote.DeleteContext(ctx, "config/db"); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	_, err = remote.GetContext(ctx, "config/db")
+	var apiErr *client.APIError
+	if !errors.Is(err, client.ErrKeyNotFound) || !errors.As(err, &apiErr) || apiErr.Status != http.StatusNotFound {
+		t.Errorf("Expected a deleted key to be not found, got %v", err)
+	}
+	if _, err := remote.GetVersionContext(ctx, "config/app", 9); !errors.Is(err, client.ErrKeyNotFound) {
+		t.Errorf("Expected a missing version to be not found, got %v", err)
+	}
+}
+
+func TestRemoteMultiCompareAndSwap(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	_, remote := newRemoteServer(t, kvStore, nil)
+	kvStore.Set("a", "1", 0)
+
+	ok, err := remote.MultiCompareAndSwap(
+		[]store.Condition{{Key: "a", Value: "1"}, {Key: "b", Absent: true}},
+		[]store.Update{{Key: "a", Value: "2"}, {Key: "b", Value: "new", TTL: time.Hour}})
+	if err != nil || !ok {
+		t.Fatalf("Expected the swap to apply, got %v (error: %v)", ok, err)
+	}
+	if value, ttl, _ := kvStore.GetWithTTL("b"); value != "new" || ttl <= 0 {
+		t.Errorf("Expected b to be set with a TTL, got %q %v", value, ttl)
+	}
+
+	conditions := []store.Condition{{Key: "b", Value: "new"}, {Key: "a", Value: "1"}}
+	ok, err = remote.MultiCompareAndSwap(conditions, []store.Update{{Key: "a", Delete: true}})
+	var failed *store.ConditionFailedError
+	if ok || !errors.Is(err, client.ErrConflict) || !errors.As(err, &failed) {
+		t.Fatalf("Expected a conflict naming the failed condition, got %v (error: %v)", ok, err)
+	}
+	if failed.Index != 1 || failed.Condition != conditions[1] || !failed.Found || failed.Value != "2" {
+		t.Errorf("Unexpected failed condition %+v", failed)
+	}
+	if value, _ := kvStore.Get("a"); value != "2" {
+		t.Errorf("Expected nothing to be written, got a=%q", value)
+	}
+}
+
+func TestRemoteAuthentication(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithAuthorizer(ownPrefix))
+	defer kvStore.Stop()
+	keys := map[string]string{"alice-key": "alice", "bob-key": "bob"}
+	server, alice := newRemoteServer(t, kvStore, []api.Option{api.WithAPIKeys(keys)}, client.WithAPIKey("alice-key"))
+
+	if err := alice.Set("alice/profile", "A", 0); err != nil {
+		t.Fatalf("Expected alice to set her own key: %v", err)
+	}
+	kvStore.Set("bob/profile", "B", 0)
+	if keys, err := alice.KeysContext(context.Background(), ""); err != nil || !reflect.DeepEqual(keys, []string{"alice/profile"}) {
+		t.Errorf("Expected alice to list only her keys, got %v (error: %v)", keys, err)
+	}
+
+	bob, _ := client.NewRemote(server.URL, client.WithAPIKey("bob-key"))
+	defer bob.Close()
+	if _, err := bob.Get("alice/profile"); !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("Expected bob to be forbidden from alice's key, got %v", err)
+	}
+	for name, opts := range map[string][]client.RemoteOption{"no key": nil, "unknown key": {client.WithAPIKey("mallory-key")}} {
+		anonymous, _ := client.NewRemote(server.URL, opts...)
+		defer anonymous.Close()
+		if _, err := anonymous.Get("alice/profile"); !errors.Is(err, client.ErrUnauthorized) {
+			t.Errorf("%s: expected ErrUnauthorized, got %v", name, err)
+		}
+		err := anonymous.Watch(context.Background(), "", 0, func(store.Event) error { return nil })
+		if !errors.Is(err, client.ErrUnauthorized) {
+			t.Errorf("%s: expected the watch stream to be unauthorized, got %v", name, err)
+		}
+	}
+}
+
+func TestRemoteEncrypted(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	_, remote := newRemoteServer(t, kvStore, nil)
+	old := encryptedClient(t, remote, clientKey)
+	next := encryptedClient(t, remote, nextClientKey)
+
+	old.Set("tenant:a", "1", 0)
+	old.Set("tenant:b", "2", time.Hour)
+	if value, _ := kvStore.Get("tenant:a"); value == "1" {
+		t.Error("Expected the server to hold ciphertext")
+	}
+	if n, err := old.RotatePrefix("tenant:", next); err != nil || n != 2 {
+		t.Fatalf("Expected 2 keys to be rotated over HTTP, got %d (error: %v)", n, err)
+	}
+	if value, err := next.Get("tenant:b"); err != nil || value != "2" {
+		t.Errorf("Expected tenant:b under the new key, got %q (error: %v)", value, err)
+	}
+}
+
+func TestRemoteRetries(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	policy := client.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+	server, remote := newRemoteServer(t, kvStore, nil, client.WithRetryPolicy(policy))
+
+	// The server turns writes away with Retry-After while in maintenance mode; the client waits that long.
+	kvStore.SetMaintenanceMode(true, "upgrade")
+	time.AfterFunc(200*time.Millisecond, func() { kvStore.SetMaintenanceMode(false, "") })
+	start := time.Now()
+	if err := remote.Set("k", "v", 0); err != nil {
+		t.Fatalf("Expected the write to succeed once maintenance ends: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected the retry to honor Retry-After, retried after %v", elapsed)
+	}
+	if n := server.requests.Load(); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+
+	// Errors that retrying cannot fix are returned at once.
+	server.requests.Store(0)
+	if _, err := remote.Get("missing"); !errors.Is(err, client.ErrKeyNotFound) || server.requests.Load() != 1 {
+		t.Errorf("Expected a single request for a missing key, got %d (error: %v)", server.requests.Load(), err)
+	}
+
+	// Attempts run out, and the last error is returned.
+	server.requests.Store(0)
+	kvStore.SetMaintenanceMode(true, "upgrade")
+	defer kvStore.SetMaintenanceMode(false, "")
+	once, _ := client.NewRemote(server.URL, client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 1}))
+	defer once.Close()
+	var apiErr *client.APIError
+	if _, err := once.CompareAndSwap("k", "v", "w", 0); !errors.As(err, &apiErr) || apiErr.Status != http.StatusServiceUnavailable || apiErr.Code != "unavailable" {
+		t.Errorf("Expected the unavailable error, got %v", err)
+	}
+	if n := server.requests.Load(); n != 1 {
+		t.Errorf("Expected a single attempt, got %d", n)
+	}
+}
+
+func TestRemoteTimeoutAndPooling(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	handler := api.Handler(kvStore)
+	var slow atomic.Bool
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	remote, _ := client.NewRemote(server.URL, client.WithTimeout(50*time.Millisecond),
+		client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: 1}))
+	defer remote.Close()
+	for i := 0; i < 20; i++ {
+		if err := remote.Set("k", "v", 0); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("Expected sequential calls to reuse a single connection, opened %d", n)
+	}
+
+	slow.Store(true)
+	start := time.Now()
+	if _, err := remote.Get("k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the call to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the timeout to cut the call short, took %v", elapsed)
+	}
+}
+
+func TestRemoteWatch(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	policy := client.RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	server, remote := newRemoteServer(t, kvStore, nil, client.WithRetryPolicy(policy))
+
+	kvStore.Set("user:0", "before", 0)
+	since := kvStore.LastSequence()
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var seen []string
+	done := make(chan error, 1)
+	go func() {
+		done <- remote.Watch(ctx, "user:", since, func(e store.Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			seen = append(seen, e.Type+":"+e.Key)
+			return nil
+		})
+	}()
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen)
+	}
+
+	kvStore.Set("user:1", "a", 0)
+	kvStore.Set("order:1", "x", 0)
+	kvStore.Set("user:1", "b", 0)
+	if !waitFor(t, time.Second, func() bool { return count() == 2 }) {
+		t.Fatalf("Expected 2 events, got %d", count())
+	}
+
+	// A dropped stream resumes after the last event handled, without losing the events in between.
+	server.CloseClientConnections()
+	kvStore.Delete("user:1")
+	kvStore.Set("user:2", "c", 0)
+	if !waitFor(t, 2*time.Second, func() bool { return count() == 4 }) {
+		t.Fatalf("Expected 4 events after reconnecting, got %d", count())
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Watch to end with the context, got %v", err)
+	}
+	want := []string{"added:user:1", "updated:user:1", "deleted:user:1", "added:user:2"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("Expected %v, got %v", want, seen)
+	}
+
+	// Events that can no longer be replayed end the watch.
+	err := remote.Watch(context.Background(), "", kvStore.LastSequence()+100, func(store.Event) error { return nil })
+	var truncated *store.EventsTruncatedError
+	if !errors.As(err, &truncated) || truncated.Latest != kvStore.LastSequence() {
+		t.Errorf("Expected an EventsTruncatedError, got %v", err)
+	}
+
+	// An error from the handler ends the watch with it.
+	stop := errors.New("stop")
+	go kvStore.Set("user:3", "d", 0)
+	if err := remote.Watch(context.Background(), "user:", kvStore.LastSequence(), func(store.Event) error { return stop }); err != stop {
+		t.Errorf("Expected the handler's error, got %v", err)
+	}
+}
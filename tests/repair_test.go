@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// writeFixture encodes a raw JSON fixture from testdata into the store's file format.
+func writeFixture(t *testing.T, fixture, filePath string) {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %s: %v", fixture, err)
+	}
+	compressedData, err := store.CompressData(raw)
+	if err != nil {
+		t.Fatalf("Failed to compress fixture: %v", err)
+	}
+	encryptedData, err := store.EncryptData(compressedData, encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to encrypt fixture: %v", err)
+	}
+	if err := os.WriteFile(filePath, []byte(base64.StdEncoding.EncodeToString(encryptedData)), 0644); err != nil {
+		t.Fatalf("Failed to write fixture: %v", err)
+	}
+}
+
+func TestLoadDropsEmptyHistories(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "store.json")
+	writeFixture(t, "malformed_empty_history.json", filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute)
+	defer kvStore.Stop()
+
+	repaired := make(chan string, 1)
+	kvStore.RegisterNotificationListener(func(event string) {
+		if strings.HasPrefix(event, "load_repaired:") {
+			repaired <- event
+		}
+	})
+
+	if value, err := kvStore.Get("good"); err != nil || value != "value" {
+		t.Fatalf("Expected 'good' to load, got %q (error: %v)", value, err)
+	}
+
+	keys := kvStore.Keys()
+	if len(keys) != 1 || keys[0] != "good" {
+		t.Errorf("Expected only 'good' to remain, got %v", keys)
+	}
+
+	report := kvStore.LastLoadReport()
+	if len(report.DroppedKeys) != 1 || report.DroppedKeys[0] != "empty" {
+		t.Errorf("Expected 'empty' to be reported as dropped, got %v", report.DroppedKeys)
+	}
+
+	select {
+	case event := <-repaired:
+		if event != "load_repaired:1" {
+			t.Errorf("Expected 'load_repaired:1', got %s", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Timeout waiting for load_repaired notification")
+	}
+}
+
+func TestLoadFillsMissingTimestamps(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "store.json")
+	writeFixture(t, "malformed_missing_timestamps.json", filePath)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("Failed to stat fixture: %v", err)
+	}
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute)
+	defer kvStore.Stop()
+
+	if _, err := kvStore.Get("key"); err != nil {
+		t.Fatalf("Failed to get key: %v", err)
+	}
+
+	history, err := kvStore.GetHistory("key")
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if !history[0].Timestamp.Equal(info.ModTime()) || !history[1].Timestamp.Equal(info.ModTime()) {
+		t.Errorf("Expected missing timestamps to be filled with %v, got %v and %v", info.ModTime(), history[0].Timestamp, history[1].Timestamp)
+	}
+	if history[2].Timestamp.Year() != 2024 {
+		t.Errorf("Expected existing timestamp to be kept, got %v", history[2].Timestamp)
+	}
+
+	if filled := kvStore.LastLoadReport().FilledTimestamps["key"]; filled != 2 {
+		t.Errorf("Expected 2 filled timestamps, got %d", filled)
+	}
+}
+
+func TestLoadDeduplicatesVersions(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "store.json")
+	writeFixture(t, "malformed_duplicates.json", filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute, store.WithLoadDeduplication())
+	defer kvStore.Stop()
+
+	if _, err := kvStore.Get("key"); err != nil {
+		t.Fatalf("Failed to get key: %v", err)
+	}
+
+	versions, err := kvStore.GetAllVersions("key")
+	if err != nil {
+		t.Fatalf("Failed to get versions: %v", err)
+	}
+	if strings.Join(versions, ",") != "a,b,a" {
+		t.Errorf("Expected versions [a b a], got %v", versions)
+	}
+	if removed := kvStore.LastLoadReport().RemovedDuplicates["key"]; removed != 2 {
+		t.Errorf("Expected 2 removed duplicates, got %d", removed)
+	}
+}
+
+func TestStrictLoadRejectsMalformedData(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "store.json")
+	writeFixture(t, "malformed_empty_history.json", filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute, store.WithStrictLoad())
+	defer kvStore.Stop()
+
+	_, err := kvStore.Get("good")
+	if err == nil || !strings.Contains(err.Error(), "malformed data") {
+		t.Fatalf("Expected malformed data error, got %v", err)
+	}
+	if kvStore.Loaded() {
+		t.Errorf("Expected store to stay unloaded after a strict load failure")
+	}
+
+	// Stopping must leave the malformed file untouched for investigation.
+	before, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	kvStore.Stop()
+	after, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("Expected file to be left untouched after a failed load")
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/resp"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// respClient sends commands to a RESP server and reads the replies as Go values: strings for simple and
+// bulk strings, "(error) ..." for errors, int64 for integers, nil for null and []any for arrays.
+type respClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newRESPServer serves kvStore on a local port and connects a client to it.
+func newRESPServer(t *testing.T, kvStore *store.KeyValueStore) (*resp.Server, *respClient) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := resp.NewServer(kvStore)
+	go server.Serve(l)
+	t.Cleanup(func() { server.Close() })
+	return server, dialRESP(t, l.Addr().String())
+}
+
+// dialRESP connects a client to addr.
+func dialRESP(t *testing.T, addr string) *respClient {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &respClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send writes a command as an array of bulk strings.
+func (c *respClient) send(args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		c.t.Fatalf("Write failed: %v", err)
+	}
+}
+
+// do sends a command and returns its reply.
+func (c *respClient) do(args ...string) any {
+	c.send(args...)
+	return c.reply()
+}
+
+// reply reads the next reply.
+func (c *respClient) reply() any {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("Read failed: %v", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return "(error) " + line[1:]
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '$':
+		size, _ := strconv.Atoi(line[1:])
+		if size < 0 {
+			return nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			c.t.Fatalf("Read failed: %v", err)
+		}
+		return string(buf[:size])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]any, n)
+		for i := range items {
+			items[i] = c.reply()
+		}
+		return items
+	}
+	c.t.Fatalf("Unexpected reply %q", line)
+	return nil
+}
+
+func TestRESPCommands(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	_, client := newRESPServer(t, kvStore)
+
+	steps := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"ping", "hi"}, "hi"},
+		{[]string{"ECHO", "line\r\nbreak"}, "line\r\nbreak"},
+		{[]string{"GET", "greeting"}, nil},
+		{[]string{"SET", "greeting", "hello"}, "OK"},
+		{[]string{"GET", "greeting"}, "hello"},
+		{[]string{"SET", "greeting", "again", "NX"}, nil},
+		{[]string{"SET", "fresh", "1", "nx"}, "OK"},
+		{[]string{"SET", "binary", "\x00\xff\r\n"}, "OK"},
+		{[]string{"GET", "binary"}, "\x00\xff\r\n"},
+		{[]string{"TTL", "greeting"}, int64(-1)},
+		{[]string{"TTL", "missing"}, int64(-2)},
+		{[]string{"SET", "session", "s", "EX", "100"}, "OK"},
+		{[]string{"TTL", "session"}, int64(100)},
+		{[]string{"SET", "short", "s", "PX", "2400"}, "OK"},
+		{[]string{"TTL", "short"}, int64(2)},
+		{[]string{"EXPIRE", "greeting", "50"}, int64(1)},
+		{[]string{"TTL", "greeting"}, int64(50)},
+		{[]string{"PERSIST", "greeting"}, int64(1)},
+		{[]string{"PERSIST", "greeting"}, int64(0)},
+		{[]string{"TTL", "greeting"}, int64(-1)},
+		{[]string{"EXPIRE", "missing", "50"}, int64(0)},
+		{[]string{"EXPIRE", "greeting", "soon"}, "(error) ERR value is not an integer or out of range"},
+		{[]string{"SET", "doomed", "d"}, "OK"},
+		{[]string{"EXPIRE", "doomed", "0"}, int64(1)},
+		{[]string{"GET", "doomed"}, nil},
+		{[]string{"SET", "bad", "v", "EX", "0"}, "(error) ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "bad", "v", "XX"}, "(error) ERR syntax error"},
+		{[]string{"DEL", "fresh", "binary", "missing"}, int64(2)},
+		{[]string{"GET"}, "(error) ERR wrong number of arguments for 'get' command"},
+		{[]string{"FLUSHALL"}, "(error) ERR unknown command 'FLUSHALL'"},
+	}
+	for _, step := range steps {
+		if got := client.do(step.args...); fmt.Sprintf("%#v", got) != fmt.Sprintf("%#v", step.want) {
+			t.Errorf("%q: expected %#v, got %#v", step.args, step.want, got)
+		}
+	}
+
+	if value, _ := kvStore.Get("session"); value != "s" {
+		t.Errorf("Expected RESP writes in the store, got %q", value)
+	}
+	kvStore.Set("user:1:session", "a", 0)
+	kvStore.Set("user:2:session", "b", 0)
+	kvStore.Set("user:2:profile", "c", 0)
+	keys, _ := client.do("KEYS", "user:*:session").([]any)
+	sort.Slice(keys, func(i, j int) bool { return keys[i].(string) < keys[j].(string) })
+	if got := fmt.Sprint(keys); got != "[user:1:session user:2:session]" {
+		t.Errorf("Unexpected KEYS reply %s", got)
+	}
+
+	if got := client.do("QUIT"); got != "OK" {
+		t.Errorf("Expected QUIT to reply OK, got %#v", got)
+	}
+	if _, err := client.r.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to close after QUIT, got %v", err)
+	}
+}
+
+func TestRESPPipeliningAndInlineCommands(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	_, client := newRESPServer(t, kvStore)
+
+	for i := 0; i < 100; i++ {
+		client.send("SET", fmt.Sprintf("k%d", i), strconv.Itoa(i))
+	}
+	for i := 0; i < 100; i++ {
+		if got := client.reply(); got != "OK" {
+			t.Fatalf("Pipelined SET %d: expected OK, got %#v", i, got)
+		}
+	}
+	if kvStore.Size() != 100 {
+		t.Errorf("Expected 100 keys, got %d", kvStore.Size())
+	}
+
+	io.WriteString(client.conn, "GET k42\r\n\r\nset inline yes\n")
+	if got := client.reply(); got != "42" {
+		t.Errorf("Expected the inline GET to reply 42, got %#v", got)
+	}
+	if got := client.reply(); got != "OK" {
+		t.Errorf("Expected the inline SET to reply OK, got %#v", got)
+	}
+
+	io.WriteString(client.conn, "*1\r\n!4\r\nPING\r\n")
+	if got, ok := client.reply().(string); !ok || !strings.HasPrefix(got, "(error) ERR Protocol error") {
+		t.Errorf("Expected a protocol error, got %#v", got)
+	}
+	if _, err := client.r.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to close after a protocol error, got %v", err)
+	}
+}
+
+func TestRESPClose(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	server := resp.NewServer(kvStore)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(l) }()
+
+	client := dialRESP(t, l.Addr().String())
+	if got := client.do("PING"); got != "PONG" {
+		t.Fatalf("Expected PONG, got %#v", got)
+	}
+	server.Close()
+	if err := <-served; err != nil {
+		t.Errorf("Expected Serve to return nil after Close, got %v", err)
+	}
+	if _, err := client.r.ReadByte(); err != io.EOF {
+		t.Errorf("Expected Close to end open connections, got %v", err)
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Error("Expected the listener to be closed")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// divergentBackup backs up a snapshot to a directory and returns it with a live store that kept serving
+// writes since.
+func divergentBackup(t *testing.T) (*store.KeyValueStore, string) {
+	t.Helper()
+	backup := map[string][]store.KeyValue{
+		"same":         history("a", 0, "b", 1),
+		"backup-newer": history("a", 0, "backup", 9),
+		"live-newer":   history("a", 0, "backup", 8),
+		"tie":          history("a", 0, "backup", 7),
+		"backup-only":  history("y", 0),
+	}
+	live := map[string][]store.KeyValue{
+		"same":         history("a", 0, "b", 1),
+		"backup-newer": history("a", 0, "live", 5),
+		"live-newer":   history("a", 0, "live", 10),
+		"tie":          history("a", 0, "live", 7),
+		"live-only":    history("x", 0),
+	}
+
+	dir := t.TempDir()
+	backupStore, err := store.NewKeyValueStoreFromReader(bytes.NewReader(encodeSnapshot(t, backup)), encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to load backup store: %v", err)
+	}
+	defer backupStore.Stop()
+	takeBackup(t, backupStore, dir, store.BackupFull, len(backup))
+
+	kvStore, err := store.NewKeyValueStoreFromReader(bytes.NewReader(encodeSnapshot(t, live)), encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to load live store: %v", err)
+	}
+	t.Cleanup(kvStore.Stop)
+	return kvStore, dir
+}
+
+func TestRestoreStrategies(t *testing.T) {
+	tests := []struct {
+		strategy store.RestoreStrategy
+		report   store.RestoreReport
+		contents map[string]string // Latest value per key after the restore
+		events   []string
+	}{
+		{
+			strategy: store.RestoreOverwrite,
+			report: store.RestoreReport{
+				Added:       []string{"backup-only"},
+				Overwritten: []string{"backup-newer", "live-newer", "tie"},
+				Removed:     []string{"live-only"},
+				Unchanged:   1,
+			},
+			contents: map[string]string{"same": "b", "backup-newer": "backup", "live-newer": "backup", "tie": "backup", "backup-only": "y"},
+			events: []string{"added:backup-only", "updated:backup-newer", "updated:live-newer", "updated:tie",
+				"deleted:live-only", "backup_restored"},
+		},
+		{
+			strategy: store.RestoreLastWriteWins,
+			report: store.RestoreReport{
+				Added:       []string{"backup-only"},
+				Overwritten: []string{"backup-newer"},
+				Skipped:     []string{"live-newer", "tie"},
+				Unchanged:   1,
+			},
+			contents: map[string]string{"same": "b", "backup-newer": "backup", "live-newer": "live", "tie": "live", "backup-only": "y", "live-only": "x"},
+			events:   []string{"added:backup-only", "updated:backup-newer", "backup_restored"},
+		},
+		{
+			strategy: store.RestoreFirstWriteWins,
+			report: store.RestoreReport{
+				Added:     []string{"backup-only"},
+				Skipped:   []string{"backup-newer", "live-newer", "tie"},
+				Unchanged: 1,
+			},
+			contents: map[string]string{"same": "b", "backup-newer": "live", "live-newer": "live", "tie": "live", "backup-only": "y", "live-only": "x"},
+			events:   []string{"added:backup-only", "backup_restored"},
+		},
+		{
+			strategy: store.RestoreReportOnly,
+			report: store.RestoreReport{
+				Added:       []string{"backup-only"},
+				Overwritten: []string{"backup-newer", "live-newer", "tie"},
+				Removed:     []string{"live-only"},
+				Unchanged:   1,
+			},
+			contents: map[string]string{"same": "b", "backup-newer": "live", "live-newer": "live", "tie": "live", "live-only": "x"},
+		},
+	}
+	// Drop sequence numbers and backup names, which differ between runs.
+	eventKey := regexp.MustCompile(`(@\d+|^(backup_restored):.*)$`)
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			kvStore, dir := divergentBackup(t)
+			events := make(chan string, 20)
+			kvStore.Subscribe("", 20, func(event string) { events <- eventKey.ReplaceAllString(event, "$2") })
+
+			report, err := kvStore.RestoreBackupWith(dir, tt.strategy)
+			if err != nil {
+				t.Fatalf("RestoreBackupWith failed: %v", err)
+			}
+			tt.report.Strategy, tt.report.Backup = tt.strategy, report.Backup
+			if !reflect.DeepEqual(report, tt.report) {
+				t.Errorf("Expected report %+v, got %+v", tt.report, report)
+			}
+
+			keys := kvStore.Keys()
+			if len(keys) != len(tt.contents) {
+				t.Errorf("Expected keys %v, got %v", tt.contents, keys)
+			}
+			for key, want := range tt.contents {
+				if value, err := kvStore.Get(key); err != nil || value != want {
+					t.Errorf("Expected %s to be %q, got %q (%v)", key, want, value, err)
+				}
+			}
+
+			var got []string
+			for len(got) < len(tt.events) {
+				select {
+				case event := <-events:
+					got = append(got, event)
+				case <-time.After(2 * time.Second):
+					t.Fatalf("Expected events %v, got %v", tt.events, got)
+				}
+			}
+			select {
+			case event := <-events:
+				t.Errorf("Unexpected event %s after %v", event, got)
+			case <-time.After(20 * time.Millisecond):
+			}
+			if !reflect.DeepEqual(got, tt.events) {
+				t.Errorf("Expected events %v, got %v", tt.events, got)
+			}
+		})
+	}
+}
+
+func TestRestoreUnknownStrategy(t *testing.T) {
+	kvStore, dir := divergentBackup(t)
+	if _, err := kvStore.RestoreBackupWith(dir, "newest"); err == nil {
+		t.Error("Expected an unknown strategy to be refused")
+	}
+	if value, _ := kvStore.Get("tie"); value != "live" {
+		t.Errorf("Expected the store to be left alone, got %q", value)
+	}
+}
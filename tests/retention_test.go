@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// historyValues returns the values of every version of key, oldest first.
+func historyValues(t *testing.T, kv *store.KeyValueStore, key string) []string {
+	t.Helper()
+	values, err := kv.GetAllVersions(key)
+	if err != nil {
+		t.Fatalf("GetAllVersions(%s) failed: %v", key, err)
+	}
+	return values
+}
+
+func TestVersionRetentionMaxVersions(t *testing.T) {
+	kvStore := store.NewPassive(
+		store.WithVersionRetention(store.VersionRetention{MaxVersions: 3}),
+		store.WithKeyRetention("audit:", store.VersionRetention{}),
+		store.WithKeyRetention("config:main", store.VersionRetention{MaxVersions: 1}),
+	)
+	defer kvStore.Stop()
+
+	for i := 1; i <= 5; i++ {
+		kvStore.Set("user", fmt.Sprint(i), 0)
+		kvStore.Set("audit:log", fmt.Sprint(i), 0)
+		kvStore.Set("config:main", fmt.Sprint(i), 0)
+	}
+	if values := historyValues(t, kvStore, "user"); !reflect.DeepEqual(values, []string{"3", "4", "5"}) {
+		t.Errorf("Expected the last 3 versions, got %v", values)
+	}
+	if values := historyValues(t, kvStore, "audit:log"); len(values) != 5 {
+		t.Errorf("Expected the zero policy of audit: to keep every version, got %v", values)
+	}
+	if values := historyValues(t, kvStore, "config:main"); !reflect.DeepEqual(values, []string{"5"}) {
+		t.Errorf("Expected only the latest version, got %v", values)
+	}
+}
+
+func TestVersionRetentionCompareAndSwap(t *testing.T) {
+	kvStore := store.NewPassive(store.WithVersionRetention(store.VersionRetention{MaxVersions: 3}))
+	defer kvStore.Stop()
+	kvStore.Set("counter", "0", 0)
+
+	// A key only ever updated by CompareAndSwap is held to the policy like one written by Set.
+	for i := 1; i <= 10; i++ {
+		if swapped, err := kvStore.CompareAndSwap("counter", fmt.Sprint(i-1), fmt.Sprint(i), 0); err != nil || !swapped {
+			t.Fatalf("CompareAndSwap %d failed: swapped=%v, error=%v", i, swapped, err)
+		}
+	}
+	if values := historyValues(t, kvStore, "counter"); !reflect.DeepEqual(values, []string{"8", "9", "10"}) {
+		t.Errorf("Expected the last 3 versions, got %v", values)
+	}
+}
+
+func TestVersionRetentionKeepsConditionsStrict(t *testing.T) {
+	kvStore := store.NewPassive(store.WithVersionRetention(store.VersionRetention{MaxVersions: 2}))
+	defer kvStore.Stop()
+	kvStore.Set("k", "1", 0)
+	kvStore.Set("k", "2", 0)
+
+	// Each write at the cap drops a version, so the history keeps its length.
+	values, _, _ := kvStore.GetManyConsistent([]string{"k"})
+	read := values["k"]
+	kvStore.Set("k", "3", 0)
+	if values, _, _ := kvStore.GetManyConsistent([]string{"k"}); values["k"].Version != read.Version {
+		t.Fatalf("Expected the history length to stay at the cap, got versions %d and %d", read.Version, values["k"].Version)
+	}
+	ok, err := kvStore.MultiCompareAndSwap(
+		[]store.Condition{{Key: "k", Revision: read.Revision, ByRevision: true}},
+		[]store.Update{{Key: "k", Value: read.Value + "+cas"}})
+	if ok || !errors.Is(err, store.ErrConditionFailed) {
+		t.Errorf("Expected the condition on the value read before the write to fail, got %v, %v", ok, err)
+	}
+	if values := historyValues(t, kvStore, "k"); !reflect.DeepEqual(values, []string{"2", "3"}) {
+		t.Errorf("Expected the write to be kept, got %v", values)
+	}
+}
+
+func TestVersionRetentionMaxAge(t *testing.T) {
+	kvStore := store.NewPassive(store.WithVersionRetention(store.VersionRetention{MaxAge: 50 * time.Millisecond}))
+	defer kvStore.Stop()
+
+	kvStore.Set("a", "1", 0)
+	kvStore.Set("a", "2", 0)
+	kvStore.Set("b", "1", 0)
+	kvStore.Set("b", "2", 0)
+	time.Sleep(80 * time.Millisecond)
+
+	kvStore.Set("a", "3", 0)
+	if values := historyValues(t, kvStore, "a"); !reflect.DeepEqual(values, []string{"3"}) {
+		t.Errorf("Expected Set to drop the aged versions, got %v", values)
+	}
+	if values := historyValues(t, kvStore, "b"); len(values) != 2 {
+		t.Errorf("Expected keys not written to keep their versions until pruned, got %v", values)
+	}
+	removed, err := kvStore.PruneVersions()
+	if err != nil || removed != 1 {
+		t.Errorf("Expected PruneVersions to remove 1 version, got %d (%v)", removed, err)
+	}
+	if values := historyValues(t, kvStore, "b"); !reflect.DeepEqual(values, []string{"2"}) {
+		t.Errorf("Expected the latest version to be kept however old, got %v", values)
+	}
+}
+
+func TestVersionRetentionCleanupLoop(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.New(dataFile,
+		store.WithEncryptionKey(encryptionKey),
+		store.WithCleanupInterval(20*time.Millisecond),
+		store.WithVersionRetention(store.VersionRetention{MaxAge: 30 * time.Millisecond}),
+	)
+	kvStore.Set("k", "1", 0)
+	kvStore.Set("k", "2", 0)
+	if !waitFor(t, time.Second, func() bool { return len(historyValues(t, kvStore, "k")) == 1 }) {
+		t.Errorf("Expected the cleanup loop to prune the aged version, got %v", historyValues(t, kvStore, "k"))
+	}
+	kvStore.Stop()
+
+	reloaded := store.New(dataFile, store.WithEncryptionKey(encryptionKey))
+	defer reloaded.Stop()
+	reloaded.Get("k") // GetAllVersions does not trigger the lazy load
+	if values := historyValues(t, reloaded, "k"); !reflect.DeepEqual(values, []string{"2"}) {
+		t.Errorf("Expected the pruned history to be saved, got %v", values)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestRollbackToVersion(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	var events []store.Event
+	kvStore.SubscribeEvents(store.EventFilter{}, 16, func(e store.Event) { events = append(events, e) })
+
+	kvStore.Set("config", "v1", 0)
+	kvStore.Set("config", "v2", 0)
+	kvStore.Set("config", "v3", time.Hour)
+
+	if err := kvStore.RollbackToVersion("config", 0); err != nil {
+		t.Fatalf("RollbackToVersion failed: %v", err)
+	}
+	if value, ttl, _ := kvStore.GetWithTTL("config"); value != "v1" || ttl <= 59*time.Minute {
+		t.Errorf("Expected v1 with the TTL kept, got %q with %v", value, ttl)
+	}
+	if values, _ := kvStore.GetAllVersions("config"); !reflect.DeepEqual(values, []string{"v1", "v2", "v3", "v1"}) {
+		t.Errorf("Expected the rollback to append a version, got %v", values)
+	}
+	last := events[len(events)-1]
+	if last.Type != "updated" || last.OldValue != "v3" || last.NewValue != "v1" {
+		t.Errorf("Expected an update from v3 to v1, got %+v", last)
+	}
+
+	for _, version := range []int{-1, 4} {
+		if err := kvStore.RollbackToVersion("config", version); !errors.Is(err, store.ErrVersionNotFound) {
+			t.Errorf("Expected ErrVersionNotFound for version %d, got %v", version, err)
+		}
+	}
+	if err := kvStore.RollbackToVersion("missing", 0); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	kvStore.MarkImmutable("config")
+	if err := kvStore.RollbackToVersion("config", 1); !errors.Is(err, store.ErrImmutableKey) {
+		t.Errorf("Expected ErrImmutableKey, got %v", err)
+	}
+}
+
+func TestRollbackToVersionRetriesOnRecreatedKey(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("config", "v1", 0)
+	kvStore.Set("config", "v2", 0)
+	kvStore.Set("config", "v3", 0)
+
+	// Between the rollback's read and its write, the key is deleted and written again as often.
+	var fired atomic.Bool
+	kvStore.RegisterPreWriteHook("config", func(key, value string) (string, string, error) {
+		if fired.CompareAndSwap(false, true) {
+			kvStore.Delete("config")
+			for _, value := range []string{"x", "y", "z"} {
+				kvStore.Set("config", value, 0)
+			}
+		}
+		return key, value, nil
+	})
+	if err := kvStore.RollbackToVersion("config", 0); err != nil {
+		t.Fatalf("RollbackToVersion failed: %v", err)
+	}
+	if values, _ := kvStore.GetAllVersions("config"); !reflect.DeepEqual(values, []string{"x", "y", "z", "x"}) {
+		t.Errorf("Expected the rollback to the re-created key's first version, got %v", values)
+	}
+}
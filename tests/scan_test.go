@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// scanned formats the result of a Scan in key order.
+func scanned(t *testing.T, kvStore *store.KeyValueStore, prefix string) string {
+	t.Helper()
+	values, err := kvStore.Scan(prefix)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + values[key]
+	}
+	return fmt.Sprint(pairs)
+}
+
+func TestScan(t *testing.T) {
+	for name, opts := range map[string][]store.Option{"FullScan": nil, "PrefixIndex": {store.WithPrefixIndex()}} {
+		t.Run(name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "data.json")
+			kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute, opts...)
+			kvStore.Set("user:2", "bob", 0)
+			kvStore.Set("user:1", "alice", 0)
+			kvStore.Set("user:1", "alicia", 0)
+			kvStore.Set("user:3", "carol", 0)
+			kvStore.Set("users", "not a user", 0)
+			kvStore.Set("order:1", "x", 0)
+			kvStore.Delete("user:3")
+
+			if got, want := scanned(t, kvStore, "user:"), "[user:1=alicia user:2=bob]"; got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			if got, want := scanned(t, kvStore, "nothing"), "[]"; got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			if values, _ := kvStore.Scan(""); len(values) != 4 {
+				t.Errorf("Expected an empty prefix to match every live key, got %v", values)
+			}
+			kvStore.Stop()
+
+			reloaded := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute, opts...)
+			defer reloaded.Stop()
+			reloaded.Set("user:0", "dave", 0)
+			if got, want := scanned(t, reloaded, "user:"), "[user:0=dave user:1=alicia user:2=bob]"; got != want {
+				t.Errorf("Expected the index rebuilt on load, %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestScanSkipsExpiredAndSeesCoalescedWrites(t *testing.T) {
+	kvStore := store.NewPassive(store.WithPrefixIndex(), store.WithWriteCoalescing("metric:", time.Hour))
+	defer kvStore.Stop()
+	kvStore.Set("metric:cpu", "1", 0)
+	kvStore.Set("metric:cpu", "2", 0)
+	kvStore.Set("metric:old", "3", 10*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if got, want := scanned(t, kvStore, "metric:"), "[metric:cpu=2]"; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	for name, opts := range map[string][]store.Option{"FullScan": nil, "PrefixIndex": {store.WithPrefixIndex()}} {
+		b.Run(name, func(b *testing.B) {
+			kvStore := store.NewPassive(opts...)
+			defer kvStore.Stop()
+			for i := 0; i < 100000; i++ {
+				kvStore.Set(fmt.Sprintf("tenant:%03d:%d", i%1000, i), "v", 0)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				kvStore.Scan("tenant:042:")
+			}
+			b.StopTimer()
+		})
+	}
+}
+
+func TestKeysMatching(t *testing.T) {
+	keys := []string{
+		"user:1:session", "user:2:session", "user:2:profile", "user:10:session", "users",
+		"path/a/b", "h?llo", "hello", "hallo", "hxllo", "a*b", "back\\slash", "[x]",
+	}
+	cases := map[string]string{
+		"user:*:session": "[user:10:session user:1:session user:2:session]",
+		"user:?:*":       "[user:1:session user:2:profile user:2:session]",
+		"user*":          "[user:10:session user:1:session user:2:profile user:2:session users]",
+		"path/*":         "[path/a/b]",
+		"h[ae]llo":       "[hallo hello]",
+		"h[^e]llo":       "[h?llo hallo hxllo]",
+		"h[a-f]llo":      "[hallo hello]",
+		"h\\?llo":        "[h?llo]",
+		"a\\*b":          "[a*b]",
+		"back\\\\slash":  "[back\\slash]",
+		"[[]x]":          "[[x]]",
+		"[x":             "[]",
+		"*":              fmt.Sprint(len(keys)),
+		"nothing*":       "[]",
+	}
+	for name, opts := range map[string][]store.Option{"FullScan": nil, "PrefixIndex": {store.WithPrefixIndex()}} {
+		t.Run(name, func(t *testing.T) {
+			kvStore := store.NewPassive(opts...)
+			defer kvStore.Stop()
+			for _, key := range keys {
+				kvStore.Set(key, "v", 0)
+			}
+			for pattern, want := range cases {
+				matched, err := kvStore.KeysMatching(pattern)
+				if err != nil {
+					t.Fatalf("KeysMatching(%q) failed: %v", pattern, err)
+				}
+				sort.Strings(matched)
+				got := fmt.Sprint(matched)
+				if pattern == "*" {
+					got = fmt.Sprint(len(matched))
+				}
+				if got != want {
+					t.Errorf("KeysMatching(%q): expected %s, got %s", pattern, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestShardedKeyValueStore(t *testing.T) {
+	baseDir := t.TempDir()
+	shards := map[string]string{
+		"user:":       "users/data.json",
+		"user:admin:": "admins/data.json",
+	}
+	opts := []store.Option{
+		store.WithEncryptionKey(encryptionKey),
+		store.WithShard("order:", "orders/data.json"),
+	}
+	sharded := store.NewShardedKeyValueStore(baseDir, shards, opts...)
+
+	entries := map[string]string{
+		"user:1":       "Jane",
+		"user:admin:1": "Root",
+		"order:42":     "pending",
+		"config":       "on",
+	}
+	for key, value := range entries {
+		if err := sharded.Set(key, value, 0); err != nil {
+			t.Fatalf("Failed to set %s: %v", key, err)
+		}
+	}
+	for key, value := range entries {
+		if got, err := sharded.Get(key); err != nil || got != value {
+			t.Errorf("Expected %q for %s, got %q (error: %v)", value, key, got, err)
+		}
+	}
+
+	// Each shard only holds its own keys, with the longest prefix winning.
+	routes := map[string][]string{
+		"user:1":       {"user:1"},
+		"user:admin:1": {"user:admin:1"},
+		"order:42":     {"order:42"},
+		"config":       {"config"},
+	}
+	for key, want := range routes {
+		got := sharded.Shard(key).Keys()
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected shard of %s to hold %v, got %v", key, want, got)
+		}
+	}
+	if sharded.Size() != 4 {
+		t.Errorf("Expected 4 keys across shards, got %d", sharded.Size())
+	}
+	keys := sharded.Keys()
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "config,order:42,user:1,user:admin:1" {
+		t.Errorf("Unexpected keys: %v", keys)
+	}
+
+	if err := sharded.Delete("user:1"); err != nil {
+		t.Fatalf("Failed to delete key: %v", err)
+	}
+	if _, err := sharded.Get("user:admin:1"); err != nil {
+		t.Errorf("Deleting from one shard affected another: %v", err)
+	}
+	sharded.Stop()
+
+	for _, file := range []string{"data.json", "users/data.json", "admins/data.json", "orders/data.json"} {
+		if _, err := os.Stat(filepath.Join(baseDir, file)); err != nil {
+			t.Errorf("Expected shard file %s: %v", file, err)
+		}
+	}
+
+	// Reopening reads each shard back from its own file.
+	reopened := store.NewShardedKeyValueStore(baseDir, shards, opts...)
+	defer reopened.Stop()
+	if got, err := reopened.Get("order:42"); err != nil || got != "pending" {
+		t.Errorf("Expected 'pending' after reopening, got %q (error: %v)", got, err)
+	}
+	if _, err := reopened.Get("user:1"); err == nil {
+		t.Errorf("Expected deleted key to stay deleted")
+	}
+	orders := store.NewKeyValueStore(filepath.Join(baseDir, "orders/data.json"), encryptionKey, 0, 1*time.Minute)
+	defer orders.Stop()
+	if got, err := orders.Get("order:42"); err != nil || got != "pending" {
+		t.Errorf("Expected order shard file to hold its key, got %q (error: %v)", got, err)
+	}
+	if _, err := orders.Get("config"); err == nil {
+		t.Errorf("Expected order shard file not to hold other keys")
+	}
+}
+
+func TestShardedKeyValueStoreRejectsSharedStorage(t *testing.T) {
+	baseDir := t.TempDir()
+	shards := map[string]string{"a:": "a.json", "b:": "b.json"}
+	shared := store.NewMemoryBackend()
+	sharded := store.NewShardedKeyValueStore(baseDir, shards, store.WithBackend(shared))
+	sharded.Set("a:1", "one", 0)
+	sharded.Set("b:1", "two", 0)
+	sharded.Stop()
+
+	// Each shard kept its own file rather than overwriting the shared backend.
+	reopened := store.NewShardedKeyValueStore(baseDir, shards)
+	defer reopened.Stop()
+	for key, want := range map[string]string{"a:1": "one", "b:1": "two"} {
+		if got, err := reopened.Get(key); err != nil || got != want {
+			t.Errorf("Expected %q for %s after reopening, got %q (error: %v)", want, key, got, err)
+		}
+	}
+}
+
+func TestShardedKeyValueStoreCommitDelay(t *testing.T) {
+	baseDir := t.TempDir()
+	sharded := store.NewShardedKeyValueStore(baseDir, map[string]string{"a:": "a.json"},
+		store.WithCommitDelay(5*time.Millisecond))
+	defer sharded.Stop()
+
+	if err := sharded.Shard("a:1").SetDurable("a:1", "v", 0); err != nil {
+		t.Fatalf("SetDurable failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(baseDir, "a.json")); err != nil {
+		t.Errorf("Expected the durable write to be saved to its shard: %v", err)
+	}
+}
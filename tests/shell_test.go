@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/shell"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// terminal drives an interactive shell session through pipes, collecting its output as it is written.
+type terminal struct {
+	t     *testing.T
+	input *io.PipeWriter
+	mu    sync.Mutex
+	out   strings.Builder
+	read  int // Output already returned by expect
+	done  chan error
+}
+
+// newTerminal starts an interactive session on kvStore.
+func newTerminal(t *testing.T, kvStore *store.KeyValueStore, opts shell.Options) *terminal {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	term := &terminal{t: t, input: inW, done: make(chan error, 1)}
+	go func() {
+		err := shell.New(kvStore, inR, outW, opts).Run()
+		outW.Close()
+		term.done <- err
+	}()
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := outR.Read(buf)
+			term.mu.Lock()
+			term.out.Write(buf[:n])
+			term.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return term
+}
+
+// send types a line.
+func (term *terminal) send(line string) {
+	term.t.Helper()
+	if _, err := io.WriteString(term.input, line+"\n"); err != nil {
+		term.t.Fatalf("Failed to send %q: %v", line, err)
+	}
+}
+
+// expect waits until want appears in the output not yet returned and returns the output up to it.
+func (term *terminal) expect(want string) string {
+	term.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		term.mu.Lock()
+		unread := term.out.String()[term.read:]
+		term.mu.Unlock()
+		if i := strings.Index(unread, want); i >= 0 {
+			term.read += i + len(want)
+			return unread[:i+len(want)]
+		}
+		if time.Now().After(deadline) {
+			term.t.Fatalf("Timed out waiting for %q, got %q", want, unread)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// close ends the input and waits for the session to finish.
+func (term *terminal) close() error {
+	term.input.Close()
+	return <-term.done
+}
+
+// newShellStore creates a store seeded with a few users.
+func newShellStore(t *testing.T) *store.KeyValueStore {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	t.Cleanup(kvStore.Stop)
+	kvStore.Set("user:alice", "1", 0)
+	kvStore.Set("user:bob", "2", 0)
+	kvStore.Set("session:x", "s", 0)
+	return kvStore
+}
+
+func TestShellCompletion(t *testing.T) {
+	term := newTerminal(t, newShellStore(t), shell.Options{})
+	term.expect(shell.Prompt)
+
+	term.send("h\t")
+	if got := term.expect(shell.Prompt); !strings.HasPrefix(got, "help history\n") {
+		t.Errorf("Expected command completions, got %q", got)
+	}
+	term.send("get user:\t")
+	if got := term.expect(shell.Prompt); !strings.HasPrefix(got, "user:alice user:bob\n") {
+		t.Errorf("Expected key completions, got %q", got)
+	}
+	term.send("get user:a\t")
+	if got := term.expect(shell.Prompt); !strings.HasPrefix(got, "user:alice\n") {
+		t.Errorf("Expected a single completion, got %q", got)
+	}
+	if err := term.close(); err != nil {
+		t.Errorf("Expected the session to end cleanly, got %v", err)
+	}
+}
+
+func TestShellConfirmsDangerousCommands(t *testing.T) {
+	kvStore := newShellStore(t)
+	term := newTerminal(t, kvStore, shell.Options{})
+	term.expect(shell.Prompt)
+
+	term.send("deletebyprefix user:")
+	term.expect("[y/N] ")
+	term.send("n")
+	term.expect("aborted")
+	if kvStore.Size() != 3 {
+		t.Fatalf("Expected nothing to be deleted after declining, got %d keys", kvStore.Size())
+	}
+
+	term.send("deletebyprefix user:")
+	term.expect("[y/N] ")
+	term.send("y")
+	term.expect("deleted 2 keys")
+	term.send("quit")
+	if err := term.close(); err != nil {
+		t.Errorf("Expected the session to end cleanly, got %v", err)
+	}
+	if keys := kvStore.Keys(); len(keys) != 1 || keys[0] != "session:x" {
+		t.Errorf("Expected only the session to remain, got %v", keys)
+	}
+}
+
+func TestShellPagesLongOutput(t *testing.T) {
+	kvStore := newShellStore(t)
+	term := newTerminal(t, kvStore, shell.Options{PageSize: 2})
+	term.expect(shell.Prompt)
+
+	term.send("keys")
+	if got := term.expect("more"); !strings.Contains(got, "session:x\nuser:alice\n-- 1 more") {
+		t.Errorf("Expected the listing to pause after a page, got %q", got)
+	}
+	term.send("")
+	if got := term.expect("(3 keys)"); !strings.Contains(got, "user:bob") {
+		t.Errorf("Expected the rest of the listing, got %q", got)
+	}
+	term.close()
+}
+
+func TestShellScript(t *testing.T) {
+	kvStore := newShellStore(t)
+	script := strings.Join([]string{
+		"# seed a greeting",
+		"set greeting hello world",
+		"setex temp 1h value",
+		"get greeting",
+		"ttl temp",
+		"search alice",
+		"history greeting",
+	}, "\n")
+	var out bytes.Buffer
+	if err := shell.New(kvStore, strings.NewReader(script), &out, shell.Options{Script: true}).Run(); err != nil {
+		t.Fatalf("Script failed: %v\n%s", err, out.String())
+	}
+	for _, want := range []string{"hello world\n", "1h0m0s\n", "user:alice\n(1 keys)\n", "0\t"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in the output, got %q", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), shell.Prompt) {
+		t.Error("Expected scripts to run without prompting")
+	}
+
+	tests := []struct {
+		name     string
+		script   string
+		yes      bool
+		succeeds bool
+		err      error
+		kind     errs.Kind
+	}{
+		{"missing key", "get user:alice\nget missing\nset never ran", false, false, store.ErrKeyNotFound, errs.NotFound},
+		{"unknown command", "frobnicate", false, false, nil, errs.InvalidArgument},
+		{"unconfirmed clear", "clear", false, false, nil, errs.InvalidArgument},
+		{"confirmed clear", "clear", true, true, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := shell.New(kvStore, strings.NewReader(tt.script), &out, shell.Options{Script: true, Yes: tt.yes}).Run()
+			if tt.succeeds {
+				if err != nil {
+					t.Errorf("Expected the script to succeed, got %v", err)
+				}
+				return
+			}
+			if err == nil || errs.KindOf(err) != tt.kind || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Errorf("Expected a %v error, got %v", tt.kind, err)
+			}
+		})
+	}
+	if _, err := kvStore.Get("never"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Error("Expected a script to stop at its first failing command")
+	}
+	if kvStore.Size() != 0 {
+		t.Errorf("Expected the confirmed clear to delete every key, got %d", kvStore.Size())
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestSlowOpLogRecordsSlowGet(t *testing.T) {
+	faults := store.NewFaultInjector()
+	faults.AddRule(store.FaultRule{Op: store.OpGet, KeyPattern: "slow:*", Probability: 1, Latency: 50 * time.Millisecond})
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithFaultInjector(faults), store.WithSlowOpLog(store.SlowOpLogConfig{Threshold: 20 * time.Millisecond, Log: true}))
+	defer kvStore.Stop()
+
+	kvStore.Set("slow:key", "twelve bytes", 0)
+	kvStore.Set("fast:key", "value", 0)
+	faults.Enable(true)
+
+	ctx := store.WithRequestID(context.Background(), "req-42")
+	if _, err := kvStore.GetContext(ctx, "slow:key"); err != nil {
+		t.Fatalf("Failed to get key: %v", err)
+	}
+	kvStore.Get("fast:key")
+
+	ops := kvStore.SlowOps(10)
+	if len(ops) != 1 {
+		t.Fatalf("Expected only the slow Get to be recorded, got %+v", ops)
+	}
+	op := ops[0]
+	if op.Op != store.OpGet || op.Key != "slow:key" || op.RequestID != "req-42" {
+		t.Errorf("Expected a Get of slow:key for req-42, got %+v", op)
+	}
+	if op.Duration < 50*time.Millisecond || op.Exec < 50*time.Millisecond || op.LockWait+op.Exec != op.Duration {
+		t.Errorf("Expected the injected latency to count as execution, got %+v", op)
+	}
+	if op.ValueSize != len("twelve bytes") || op.LazyLoad || op.FaultIn {
+		t.Errorf("Expected a 12 byte value without lazy load or fault-in, got %+v", op)
+	}
+}
+
+func TestSlowOpLogRecordsLazyLoad(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute)
+	kvStore.Set("name", "John", 0)
+	kvStore.Stop()
+
+	kvStore = store.NewKeyValueStore(filePath, encryptionKey, 0, time.Minute, store.WithSlowOpLog(store.SlowOpLogConfig{}))
+	defer kvStore.Stop()
+	kvStore.Get("name")
+	kvStore.Get("name")
+
+	ops := kvStore.SlowOps(0)
+	if len(ops) != 2 || ops[0].LazyLoad || !ops[1].LazyLoad {
+		t.Errorf("Expected only the first Get to have waited for the load, got %+v", ops)
+	}
+}
+
+func TestSlowOpLogSplitsLockWait(t *testing.T) {
+	backend := &slowBackend{MemoryBackend: store.NewMemoryBackend(), delay: 100 * time.Millisecond}
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, time.Minute,
+		store.WithBackend(backend), store.WithSlowOpLog(store.SlowOpLogConfig{Threshold: 50 * time.Millisecond}))
+	defer kvStore.Stop()
+	kvStore.Set("name", "John", 0)
+
+	saved := make(chan error)
+	go func() { saved <- kvStore.Save() }()
+	time.Sleep(20 * time.Millisecond)
+	kvStore.Set("name", "Jane", 0) // Waits for the save to release its read lock
+	if err := <-saved; err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	ops := kvStore.SlowOps(1)
+	if len(ops) != 1 || ops[0].Op != store.OpSet || ops[0].ValueSize != len("Jane") {
+		t.Fatalf("Expected the blocked Set to be recorded, got %+v", ops)
+	}
+	if ops[0].LockWait < 50*time.Millisecond || ops[0].Exec > ops[0].LockWait {
+		t.Errorf("Expected the Set to have spent its time waiting for the lock, got %+v", ops[0])
+	}
+}
+
+func TestSlowOpThresholdAdjustableAtRuntime(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithSlowOpLog(store.SlowOpLogConfig{Threshold: time.Hour, Size: 3}))
+	defer kvStore.Stop()
+
+	kvStore.Set("a", "1", 0)
+	if ops := kvStore.SlowOps(0); len(ops) != 0 {
+		t.Fatalf("Expected no slow operations under a one hour threshold, got %+v", ops)
+	}
+
+	kvStore.SetSlowOpThreshold(0)
+	if threshold := kvStore.SlowOpThreshold(); threshold != 0 {
+		t.Errorf("Expected a zero threshold, got %v", threshold)
+	}
+	for _, key := range []string{"b", "c", "d", "e"} {
+		kvStore.Set(key, "v", 0)
+	}
+	ops := kvStore.SlowOps(0)
+	if len(ops) != 3 || ops[0].Key != "e" || ops[2].Key != "c" {
+		t.Errorf("Expected the 3 most recent operations, newest first, got %+v", ops)
+	}
+	if ops := kvStore.SlowOps(2); len(ops) != 2 || ops[1].Key != "d" {
+		t.Errorf("Expected the limit to apply, got %+v", ops)
+	}
+}
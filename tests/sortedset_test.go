@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestSortedSetLeaderboard(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	added, err := kvStore.ZAdd("board", map[string]float64{"alice": 30, "bob": 10, "carol": 20, "dave": 20})
+	if err != nil || added != 4 {
+		t.Fatalf("Expected ZAdd to add 4 members, got %d (%v)", added, err)
+	}
+	if added, _ := kvStore.ZAdd("board", map[string]float64{"bob": 5, "erin": 40}); added != 1 {
+		t.Errorf("Expected 1 new member, got %d", added)
+	}
+	if score, err := kvStore.ZIncrBy("board", "bob", 50); err != nil || score != 55 {
+		t.Errorf("Expected bob's score to be 55, got %v (%v)", score, err)
+	}
+	if score, _ := kvStore.ZIncrBy("board", "frank", 1); score != 1 {
+		t.Errorf("Expected ZIncrBy to add a missing member with the delta, got %v", score)
+	}
+
+	all, _ := kvStore.ZRange("board", 0, -1)
+	want := []store.ScoredMember{{Member: "frank", Score: 1}, {Member: "carol", Score: 20}, {Member: "dave", Score: 20}, {Member: "alice", Score: 30}, {Member: "erin", Score: 40}, {Member: "bob", Score: 55}}
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("Expected %v, got %v", want, all)
+	}
+	if top, _ := kvStore.ZRange("board", -2, -1); !reflect.DeepEqual(top, want[4:]) {
+		t.Errorf("Expected the top two %v, got %v", want[4:], top)
+	}
+	if none, _ := kvStore.ZRange("board", 4, 2); len(none) != 0 {
+		t.Errorf("Expected an empty range, got %v", none)
+	}
+	if middle, _ := kvStore.ZRangeByScore("board", 20, 30); !reflect.DeepEqual(middle, want[1:4]) {
+		t.Errorf("Expected %v, got %v", want[1:4], middle)
+	}
+	if rank, err := kvStore.ZRank("board", "alice"); err != nil || rank != 3 {
+		t.Errorf("Expected alice at rank 3, got %d (%v)", rank, err)
+	}
+	if _, err := kvStore.ZRank("board", "zoe"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound for a missing member, got %v", err)
+	}
+	if empty, err := kvStore.ZRange("missing", 0, -1); err != nil || len(empty) != 0 {
+		t.Errorf("Expected a missing key to be an empty set, got %v (%v)", empty, err)
+	}
+}
+
+func TestSortedSetErrors(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	if _, err := kvStore.ZAdd("board", map[string]float64{"a": math.NaN()}); !errors.Is(err, store.ErrInvalidScore) {
+		t.Errorf("Expected ErrInvalidScore for NaN, got %v", err)
+	}
+	kvStore.ZAdd("board", map[string]float64{"a": math.MaxFloat64})
+	if _, err := kvStore.ZIncrBy("board", "a", math.MaxFloat64); !errors.Is(err, store.ErrInvalidScore) {
+		t.Errorf("Expected ErrInvalidScore on overflow, got %v", err)
+	}
+	kvStore.Set("name", "Jane", 0)
+	if _, err := kvStore.ZAdd("name", map[string]float64{"a": 1}); !errors.Is(err, store.ErrWrongType) {
+		t.Errorf("Expected ErrWrongType, got %v", err)
+	}
+}
+
+func TestSortedSetFollowsValue(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	kvStore.ZAdd("board", map[string]float64{"a": 1, "b": 2})
+	kvStore.ZRange("board", 0, -1)
+	// A write through Set replaces the cached skiplist.
+	kvStore.Set("board", `{"c":3,"a":4}`, 0)
+	want := []store.ScoredMember{{Member: "c", Score: 3}, {Member: "a", Score: 4}}
+	if members, _ := kvStore.ZRange("board", 0, -1); !reflect.DeepEqual(members, want) {
+		t.Errorf("Expected %v, got %v", want, members)
+	}
+	kvStore.ZAdd("board", map[string]float64{"b": 5})
+	if value, _ := kvStore.Get("board"); value != `{"a":4,"b":5,"c":3}` {
+		t.Errorf("Expected the set to be stored as a JSON object, got %s", value)
+	}
+}
+
+func TestSortedSetMatchesSort(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	rng := rand.New(rand.NewSource(1))
+	scores := make(map[string]float64)
+	for i := 0; i < 2000; i++ {
+		member := fmt.Sprintf("m%d", rng.Intn(500))
+		score := float64(rng.Intn(100))
+		scores[member] = score
+		kvStore.ZAdd("board", map[string]float64{member: score})
+	}
+
+	want := make([]store.ScoredMember, 0, len(scores))
+	for member, score := range scores {
+		want = append(want, store.ScoredMember{Member: member, Score: score})
+	}
+	sort.Slice(want, func(i, j int) bool {
+		if want[i].Score != want[j].Score {
+			return want[i].Score < want[j].Score
+		}
+		return want[i].Member < want[j].Member
+	})
+	if members, _ := kvStore.ZRange("board", 0, -1); !reflect.DeepEqual(members, want) {
+		t.Fatalf("Expected ZRange to match the sorted members")
+	}
+	for i := 0; i < len(want); i += 37 {
+		if rank, _ := kvStore.ZRank("board", want[i].Member); rank != i {
+			t.Errorf("Expected %s at rank %d, got %d", want[i].Member, i, rank)
+		}
+		if page, _ := kvStore.ZRange("board", i, i+2); !reflect.DeepEqual(page, want[i:min(i+3, len(want))]) {
+			t.Errorf("ZRange(%d, %d): expected %v, got %v", i, i+2, want[i:min(i+3, len(want))], page)
+		}
+	}
+}
+
+func TestSortedSetConcurrentIncrements(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if _, err := kvStore.ZIncrBy("board", fmt.Sprintf("player%d", i%5), 1); err != nil {
+					t.Errorf("ZIncrBy failed: %v", err)
+				}
+				kvStore.ZRange("board", 0, -1)
+			}
+		}()
+	}
+	wg.Wait()
+	members, _ := kvStore.ZRange("board", 0, -1)
+	if len(members) != 5 {
+		t.Fatalf("Expected 5 players, got %v", members)
+	}
+	for _, m := range members {
+		if m.Score != 40 {
+			t.Errorf("Expected every player to score 40, got %v", members)
+		}
+	}
+}
+
+func TestSortedSetConcurrentUpdatesUnderRetention(t *testing.T) {
+	kvStore := store.NewPassive(store.WithVersionRetention(store.VersionRetention{MaxVersions: 1}))
+	defer kvStore.Stop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if _, err := kvStore.ZIncrBy("board", fmt.Sprintf("player%d", i%5), 1); err != nil {
+					t.Errorf("ZIncrBy failed: %v", err)
+				}
+				if _, err := kvStore.ZAdd("board", map[string]float64{fmt.Sprintf("guest%d-%d", w, i): 0}); err != nil {
+					t.Errorf("ZAdd failed: %v", err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	members, _ := kvStore.ZRange("board", 0, -1)
+	if len(members) != 805 {
+		t.Fatalf("Expected 5 players and 800 guests, got %d members", len(members))
+	}
+	for _, m := range members {
+		if strings.HasPrefix(m.Member, "player") && m.Score != 160 {
+			t.Errorf("Expected %s to score 160, got %v", m.Member, m.Score)
+		}
+	}
+}
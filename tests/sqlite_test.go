@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/sqlitestore"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// persistenceSuite runs the same store behavior against a persistence engine. open returns a store
+// over the same underlying storage each time it is called.
+func persistenceSuite(t *testing.T, open func() *store.KeyValueStore) {
+	kvStore := open()
+	kvStore.Set("name", "Jane", 0)
+	kvStore.Set("name", "John", 0)
+	kvStore.Set("city", "Paris", 0)
+	kvStore.Set("tmp", "gone", 0)
+	kvStore.Set("history", "a", 0)
+	kvStore.Set("history", "b", 0)
+	kvStore.Set("history", "c", 0)
+	if swapped, err := kvStore.CompareAndSwap("city", "Paris", "Lyon", 0); err != nil || !swapped {
+		t.Fatalf("CompareAndSwap failed: %v (error: %v)", swapped, err)
+	}
+	if err := kvStore.Delete("tmp"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := kvStore.RemoveVersion("history", 1); err != nil {
+		t.Fatalf("RemoveVersion failed: %v", err)
+	}
+	kvStore.Stop()
+
+	reopened := open()
+	defer reopened.Stop()
+	if value, err := reopened.Get("name"); err != nil || value != "John" {
+		t.Errorf("Expected 'John', got %q (error: %v)", value, err)
+	}
+	if versions, err := reopened.GetAllVersions("name"); err != nil || strings.Join(versions, ",") != "Jane,John" {
+		t.Errorf("Expected versions [Jane John], got %v (error: %v)", versions, err)
+	}
+	if versions, _ := reopened.GetAllVersions("city"); strings.Join(versions, ",") != "Paris,Lyon" {
+		t.Errorf("Expected versions [Paris Lyon], got %v", versions)
+	}
+	if versions, _ := reopened.GetAllVersions("history"); strings.Join(versions, ",") != "a,c" {
+		t.Errorf("Expected versions [a c], got %v", versions)
+	}
+	if _, err := reopened.Get("tmp"); err == nil {
+		t.Errorf("Expected deleted key to stay deleted")
+	}
+	if reopened.Size() != 3 {
+		t.Errorf("Expected 3 keys, got %d", reopened.Size())
+	}
+}
+
+func TestPersistenceSuiteFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "data.json")
+	persistenceSuite(t, func() *store.KeyValueStore {
+		return store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute)
+	})
+}
+
+func TestPersistenceSuiteSQLite(t *testing.T) {
+	db, err := sqlitestore.Open(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	persistenceSuite(t, func() *store.KeyValueStore {
+		return store.NewKeyValueStore("", encryptionKey, 0, 1*time.Minute, store.WithRecordPersister(db))
+	})
+}
+
+func TestSQLiteWriteThroughAndQueryableHistory(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+	db, err := sqlitestore.Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Without an encryption key, values are stored in clear and can be queried directly.
+	kvStore := store.NewKeyValueStore("", nil, 0, 1*time.Minute, store.WithRecordPersister(db))
+	defer kvStore.Stop()
+	kvStore.Set("name", "Jane", 0)
+	kvStore.Set("name", "John", time.Hour)
+
+	// Writes are visible in the database before the store is stopped.
+	sqlDB, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer sqlDB.Close()
+	rows, err := sqlDB.Query(`SELECT v.value FROM versions v JOIN keys k ON k.id = v.key_id WHERE k.name = 'name' ORDER BY v.seq`)
+	if err != nil {
+		t.Fatalf("Failed to query history: %v", err)
+	}
+	var values []string
+	for rows.Next() {
+		var value string
+		rows.Scan(&value)
+		values = append(values, value)
+	}
+	rows.Close()
+	if strings.Join(values, ",") != "Jane,John" {
+		t.Errorf("Expected history [Jane John] in SQL, got %v", values)
+	}
+	var expirations int
+	sqlDB.QueryRow(`SELECT COUNT(*) FROM expirations`).Scan(&expirations)
+	if expirations != 1 {
+		t.Errorf("Expected 1 expiration row, got %d", expirations)
+	}
+
+	// TTLs survive a reopen.
+	reopened := store.NewKeyValueStore("", nil, 0, 1*time.Minute, store.WithRecordPersister(db))
+	defer reopened.Stop()
+	if _, ttl, err := reopened.GetWithTTL("name"); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected the TTL to be restored, got %v (error: %v)", ttl, err)
+	}
+}
+
+func TestSQLiteEncryptsValues(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+	db, err := sqlitestore.Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	kvStore := store.NewKeyValueStore("", encryptionKey, 0, 1*time.Minute, store.WithRecordPersister(db))
+	kvStore.Set("name", "John", 0)
+	kvStore.Stop()
+
+	records, _, err := db.LoadRecords()
+	if err != nil {
+		t.Fatalf("Failed to load records: %v", err)
+	}
+	if len(records["name"]) != 1 || records["name"][0].Value == "John" {
+		t.Errorf("Expected the value to be stored encrypted, got %+v", records["name"])
+	}
+}
+
+func TestMigrateFileToSQLiteAndBack(t *testing.T) {
+	dir := t.TempDir()
+	source := store.NewKeyValueStore(filepath.Join(dir, "data.json"), encryptionKey, 0, 1*time.Minute)
+	source.Set("name", "Jane", 0)
+	source.Set("name", "John", 0)
+	source.Set("city", "Paris", 0)
+	var snapshot bytes.Buffer
+	if err := source.SaveTo(&snapshot); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	source.Stop()
+
+	db, err := sqlitestore.Open(filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	imported, err := store.NewKeyValueStoreFromReader(bytes.NewReader(snapshot.Bytes()), encryptionKey, store.WithRecordPersister(db))
+	if err != nil {
+		t.Fatalf("Failed to import snapshot: %v", err)
+	}
+	if err := imported.Save(); err != nil {
+		t.Fatalf("Failed to write database: %v", err)
+	}
+	imported.Stop()
+
+	fromDB := store.NewKeyValueStore("", encryptionKey, 0, 1*time.Minute, store.WithRecordPersister(db))
+	defer fromDB.Stop()
+	var exported bytes.Buffer
+	if err := fromDB.SaveTo(&exported); err != nil {
+		t.Fatalf("Failed to export database: %v", err)
+	}
+
+	report, err := fromDB.Verify(bytes.NewReader(snapshot.Bytes()))
+	if err != nil || !report.Consistent() {
+		t.Errorf("Expected the database to match the original file, got %+v (error: %v)", report, err)
+	}
+	roundTrip, err := store.NewKeyValueStoreFromReader(&exported, encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to read exported file: %v", err)
+	}
+	defer roundTrip.Stop()
+	if versions, _ := roundTrip.GetAllVersions("name"); strings.Join(versions, ",") != "Jane,John" {
+		t.Errorf("Expected versions [Jane John] after the round trip, got %v", versions)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// waitForStale waits until GetStale returns want for key and returns the snapshot age it reported.
+func waitForStale(t *testing.T, kvStore *store.KeyValueStore, key, want string, within time.Duration) time.Duration {
+	t.Helper()
+	deadline := time.Now().Add(within)
+	for time.Now().Before(deadline) {
+		if value, age, err := kvStore.GetStale(key); err == nil && value == want {
+			return age
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("GetStale(%s) did not return %q within %v", key, want, within)
+	return 0
+}
+
+func TestStaleReadsRefreshWithinMaxStaleness(t *testing.T) {
+	const maxStaleness = 100 * time.Millisecond
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithStaleReads(maxStaleness, 0))
+	defer kvStore.Stop()
+
+	kvStore.Set("config", "v1", 0)
+	if value, age, err := kvStore.GetStale("config"); err != nil || value != "v1" || age > maxStaleness {
+		t.Fatalf("Expected the first read to take a fresh snapshot, got %q aged %v (error: %v)", value, age, err)
+	}
+
+	kvStore.Set("config", "v2", 0)
+	start := time.Now()
+	waitForStale(t, kvStore, "config", "v2", 5*time.Second)
+	// Allow for the check interval and scheduling on a loaded machine.
+	if elapsed := time.Since(start); elapsed > maxStaleness+time.Second {
+		t.Errorf("Expected the write to be visible within about %v, took %v", maxStaleness, elapsed)
+	}
+
+	for i := 0; i < 20; i++ {
+		if _, age, err := kvStore.GetStale("config"); err != nil || age > maxStaleness+time.Second {
+			t.Fatalf("Expected the snapshot to stay within its staleness bound, got age %v (error: %v)", age, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStaleReadsRefreshAfterDirtyThreshold(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithStaleReads(time.Hour, 10))
+	defer kvStore.Stop()
+
+	kvStore.Set("user:0", "x", 0)
+	if keys, _, err := kvStore.KeysStale("user:"); err != nil || len(keys) != 1 {
+		t.Fatalf("Expected one key in the first snapshot, got %v (error: %v)", keys, err)
+	}
+
+	kvStore.Set("user:1", "x", 0)
+	time.Sleep(50 * time.Millisecond)
+	if _, _, err := kvStore.GetStale("user:1"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Fatalf("Expected a write below the threshold to stay invisible, got error %v", err)
+	}
+
+	for i := 2; i <= 10; i++ {
+		kvStore.Set(fmt.Sprintf("user:%d", i), "x", 0)
+	}
+	waitForStale(t, kvStore, "user:10", "x", 5*time.Second)
+
+	keys, _, err := kvStore.KeysStale("user:1")
+	if err != nil || !reflect.DeepEqual(keys, []string{"user:1", "user:10"}) {
+		t.Errorf("Expected KeysStale to list the keys with the prefix in order, got %v (error: %v)", keys, err)
+	}
+	if stats := kvStore.StaleStats(); !stats.Enabled || stats.Keys != 11 || stats.Refreshes < 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestStaleReadsHonourExpiration(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithStaleReads(time.Hour, 0))
+	defer kvStore.Stop()
+
+	kvStore.Set("session", "abc", 50*time.Millisecond)
+	kvStore.Set("user", "jane", 0)
+	if err := kvStore.RefreshStale(); err != nil {
+		t.Fatalf("RefreshStale failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if _, _, err := kvStore.GetStale("session"); !errors.Is(err, store.ErrKeyExpired) {
+		t.Errorf("Expected a key expired since the snapshot to be reported expired, got %v", err)
+	}
+	if keys, _, _ := kvStore.KeysStale(""); !reflect.DeepEqual(keys, []string{"user"}) {
+		t.Errorf("Expected KeysStale to skip expired keys, got %v", keys)
+	}
+}
+
+func TestStaleReadersDoNotTakeTheLock(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithStaleReads(time.Hour, 0))
+	defer kvStore.Stop()
+
+	kvStore.Set("config", "v1", 0)
+	if err := kvStore.RefreshStale(); err != nil {
+		t.Fatalf("RefreshStale failed: %v", err)
+	}
+
+	// Hold the write lock as a writer would: stale reads must still complete, so they can never make
+	// a writer wait.
+	kvStore.Lock()
+	done := make(chan string)
+	go func() {
+		value, _, _ := kvStore.GetStale("config")
+		keys, _, _ := kvStore.KeysStale("")
+		done <- value + strings.Join(keys, ",")
+	}()
+	select {
+	case got := <-done:
+		if got != "v1config" {
+			t.Errorf("Unexpected stale read %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stale reads blocked on the write lock")
+	}
+	kvStore.Unlock()
+
+	// The staleness budget decides between the snapshot and a locked read.
+	kvStore.Set("config", "v2", 0)
+	if value, _ := kvStore.GetAllowStale("config", time.Hour); value != "v1" {
+		t.Errorf("Expected a generous budget to be served from the snapshot, got %q", value)
+	}
+	if value, _ := kvStore.GetAllowStale("config", 0); value != "v2" {
+		t.Errorf("Expected a zero budget to read the latest value, got %q", value)
+	}
+}
+
+func TestStaleSnapshotSharesValues(t *testing.T) {
+	const keys, valueSize = 200, 64 << 10
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithStaleReads(time.Hour, 0))
+	defer kvStore.Stop()
+
+	value := strings.Repeat("x", valueSize)
+	for i := 0; i < keys; i++ {
+		kvStore.Set(fmt.Sprintf("blob:%03d", i), value, 0)
+	}
+	if err := kvStore.RefreshStale(); err != nil {
+		t.Fatalf("RefreshStale failed: %v", err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if err := kvStore.RefreshStale(); err != nil {
+		t.Fatalf("RefreshStale failed: %v", err)
+	}
+	runtime.ReadMemStats(&after)
+
+	// The snapshot copies the map and key list, not the 12.5 MiB of values.
+	allocated := after.TotalAlloc - before.TotalAlloc
+	if allocated > keys*valueSize/10 {
+		t.Errorf("Expected a refresh to share values with the store, allocated %d bytes", allocated)
+	}
+}
+
+func TestStaleReadsRefreshChangedKeys(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithStaleReads(time.Hour, 0), store.WithWriteCoalescing("telemetry:", time.Hour))
+	defer kvStore.Stop()
+
+	for i := 0; i < 100; i++ {
+		kvStore.Set(fmt.Sprintf("key:%03d", i), "v1", 0)
+	}
+	kvStore.Set("session", "s", time.Hour)
+	if err := kvStore.RefreshStale(); err != nil {
+		t.Fatalf("RefreshStale failed: %v", err)
+	}
+
+	// Every kind of change reaches the next snapshot without it reading every key again.
+	kvStore.Set("key:000", "v2", 0)
+	kvStore.Delete("key:001")
+	kvStore.Set("key:100", "new", 0)
+	kvStore.Set("telemetry:cpu", "42", 0)
+	kvStore.Expire("key:002", time.Millisecond)
+	kvStore.Persist("session")
+	if err := kvStore.RefreshStale(); err != nil {
+		t.Fatalf("RefreshStale failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	expect := map[string]string{"key:000": "v2", "key:003": "v1", "key:100": "new", "telemetry:cpu": "42", "session": "s"}
+	for key, want := range expect {
+		if value, _, err := kvStore.GetStale(key); err != nil || value != want {
+			t.Errorf("Expected GetStale(%s) to return %q, got %q (error: %v)", key, want, value, err)
+		}
+	}
+	if _, _, err := kvStore.GetStale("key:001"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected the deleted key to be gone, got %v", err)
+	}
+	if _, _, err := kvStore.GetStale("key:002"); !errors.Is(err, store.ErrKeyExpired) {
+		t.Errorf("Expected the new TTL of key:002 to apply, got %v", err)
+	}
+	if keys, _, _ := kvStore.KeysStale("key:1"); !reflect.DeepEqual(keys, []string{"key:100"}) {
+		t.Errorf("Expected the new key to be listed, got %v", keys)
+	}
+	if stats := kvStore.StaleStats(); stats.Refreshes != 2 || stats.Rebuilds != 1 {
+		t.Errorf("Expected the second refresh to read only the changed keys, got %+v", stats)
+	}
+
+	// Replacing the contents of the store makes the next refresh read every key.
+	dir := t.TempDir()
+	if _, err := kvStore.Backup(dir, store.BackupFull); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	kvStore.Set("key:003", "unsaved", 0)
+	if _, err := kvStore.RestoreBackup(dir); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if err := kvStore.RefreshStale(); err != nil {
+		t.Fatalf("RefreshStale failed: %v", err)
+	}
+	if value, _, _ := kvStore.GetStale("key:003"); value != "v1" {
+		t.Errorf("Expected the restored value, got %q", value)
+	}
+	if stats := kvStore.StaleStats(); stats.Rebuilds != 2 {
+		t.Errorf("Expected a restore to rebuild the snapshot, got %+v", stats)
+	}
+}
+
+func TestStaleReadsDisabled(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+
+	kvStore.Set("config", "v1", 0)
+	if _, _, err := kvStore.GetStale("config"); !errors.Is(err, store.ErrStaleReadsDisabled) {
+		t.Errorf("Expected ErrStaleReadsDisabled, got %v", err)
+	}
+	if value, err := kvStore.GetAllowStale("config", time.Hour); err != nil || value != "v1" {
+		t.Errorf("Expected GetAllowStale to fall back to Get, got %q (error: %v)", value, err)
+	}
+	if kvStore.StaleStats().Enabled {
+		t.Error("Expected stats to report stale reads disabled")
+	}
+}
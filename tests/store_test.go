@@ -7,11 +7,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/Chahine-tech/minikeyvalue/internal/kvtest"
 	"github.com/Chahine-tech/minikeyvalue/internal/store"
 )
 
@@ -21,7 +23,7 @@ func init() {
 	go func() {
 		fmt.Println("Starting pprof on http://localhost:6060")
 		if err := http.ListenAndServe("localhost:6060", nil); err != nil {
-			log.Fatalf("Failed to start pprof server: %v", err)
+			log.Printf("Failed to start pprof server: %v", err)
 		}
 	}()
 }
@@ -78,26 +80,15 @@ func TestKeyValueStore(t *testing.T) {
 }
 
 func TestCleanupExpiredItems(t *testing.T) {
-	fmt.Println("Running TestCleanupExpiredItems")
-	const persistenceFile = "test_kvstore_cleanup.json"
-	defer os.Remove(persistenceFile) // Supprimez le fichier après le test
+	kv := kvtest.New(t).
+		WithGlobalTTL(10*time.Second).
+		WithKeys(map[string]string{"temp": "data"}).
+		WithTTL("temp", 1*time.Second).
+		Build()
 
-	// Set a global TTL of 10 seconds.
-	globalTTL := 10 * time.Second
-
-	kv := store.NewKeyValueStore(persistenceFile, encryptionKey, 1*time.Second, globalTTL)
-	defer kv.Stop()
-
-	if err := kv.Set("temp", "data", 1*time.Second); err != nil {
-		t.Errorf("error setting key 'temp': %v", err)
-	}
-	time.Sleep(3 * time.Second)
+	kv.AdvanceAndSweep(2 * time.Second)
 
-	if _, err := kv.Get("temp"); err == nil {
-		t.Errorf("expected 'temp' key to have expired")
-	}
-
-	fmt.Println("Finished TestCleanupExpiredItems")
+	kv.AssertKeyAbsent("temp")
 }
 
 func TestKeyValueStoreConcurrency(t *testing.T) {
@@ -407,27 +398,9 @@ func saveNewFormat(filePath string, newData map[string][]store.KeyValue, encrypt
 }
 
 func TestGetVersion(t *testing.T) {
-	filePath := "test_get_version.json"
-	defer os.Remove(filePath)
-
-	// Set a global TTL of 10 seconds.
-	globalTTL := 10 * time.Second
-	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 1*time.Second, globalTTL)
-	defer kvStore.Stop()
-
-	// Add multiple versions
-	err := kvStore.Set("key", "value1", 0)
-	if err != nil {
-		t.Fatalf("Failed to set initial value: %v", err)
-	}
-	err = kvStore.Set("key", "value2", 0)
-	if err != nil {
-		t.Fatalf("Failed to set second value: %v", err)
-	}
-	err = kvStore.Set("key", "value3", 0)
-	if err != nil {
-		t.Fatalf("Failed to set third value: %v", err)
-	}
+	kvStore := kvtest.New(t).
+		WithHistory("key", "value1", "value2", "value3").
+		Build()
 
 	// Test
 	v1, err := kvStore.GetVersion("key", 0)
@@ -448,27 +421,9 @@ func TestGetVersion(t *testing.T) {
 }
 
 func TestGetAllVersions(t *testing.T) {
-	filePath := "test_get_all_versions.json"
-	defer os.Remove(filePath)
-
-	// Set a global TTL of 10 seconds.
-	globalTTL := 10 * time.Second
-	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 1*time.Second, globalTTL)
-	defer kvStore.Stop()
-
-	// Add multiple versions
-	err := kvStore.Set("key", "value1", 0)
-	if err != nil {
-		t.Fatalf("Failed to set initial value: %v", err)
-	}
-	err = kvStore.Set("key", "value2", 0)
-	if err != nil {
-		t.Fatalf("Failed to set second value: %v", err)
-	}
-	err = kvStore.Set("key", "value3", 0)
-	if err != nil {
-		t.Fatalf("Failed to set third value: %v", err)
-	}
+	kvStore := kvtest.New(t).
+		WithHistory("key", "value1", "value2", "value3").
+		Build()
 
 	// Test retrieving all versions
 	versions, err := kvStore.GetAllVersions("key")
@@ -521,31 +476,12 @@ func TestGetHistory(t *testing.T) {
 	}
 }
 func TestRemoveVersion(t *testing.T) {
-	filePath := "test_remove_version.json"
-	defer os.Remove(filePath)
-
-	// Set a global TTL of 10 seconds.
-	globalTTL := 10 * time.Second
-
-	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 1*time.Second, globalTTL)
-	defer kvStore.Stop()
-
-	// Add multiple versions
-	err := kvStore.Set("key", "value1", 0)
-	if err != nil {
-		t.Fatalf("Failed to set initial value: %v", err)
-	}
-	err = kvStore.Set("key", "value2", 0)
-	if err != nil {
-		t.Fatalf("Failed to set second value: %v", err)
-	}
-	err = kvStore.Set("key", "value3", 0)
-	if err != nil {
-		t.Fatalf("Failed to set third value: %v", err)
-	}
+	kvStore := kvtest.New(t).
+		WithHistory("key", "value1", "value2", "value3").
+		Build()
 
 	// Remove the second version
-	err = kvStore.RemoveVersion("key", 1)
+	err := kvStore.RemoveVersion("key", 1)
 	if err != nil {
 		t.Fatalf("Failed to remove version 1: %v", err)
 	}
@@ -623,7 +559,7 @@ func TestKeyExpirationNotifications(t *testing.T) {
 
 	kvStore.RegisterNotificationListener(func(event string) {
 		if len(event) > 0 && event[:8] == "expired:" {
-			notifications = append(notifications, event[8:])
+			notifications = append(notifications, strings.SplitN(event[8:], "@", 2)[0])
 			if len(notifications) == 1 {
 				close(done)
 			}
@@ -690,7 +626,7 @@ func TestMultipleNotifications(t *testing.T) {
 
 	select {
 	case <-done:
-		expectedNotifications := []string{"added:temp-key", "updated:temp-key", "deleted:temp-key"}
+		expectedNotifications := []string{"added:temp-key@1", "updated:temp-key@2", "deleted:temp-key@3"}
 		for i, expected := range expectedNotifications {
 			log.Printf("Checking notification: %s == %s ?", expected, notifications[i])
 			if notifications[i] != expected {
@@ -961,3 +897,543 @@ func TestKeyRotationWithIncorrectOldKey(t *testing.T) {
 
 	kvStore.Stop()
 }
+
+func TestSequenceNumbers(t *testing.T) {
+	filePath := "test_sequence_numbers.json"
+	defer os.Remove(filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 2*time.Minute, 1*time.Second)
+	defer kvStore.Stop()
+
+	seqs := make([]uint64, 0, 100)
+	done := make(chan struct{})
+
+	kvStore.RegisterNotificationListener(func(event string) {
+		parts := strings.SplitN(event, "@", 2)
+		if len(parts) != 2 {
+			t.Errorf("Expected event with sequence number, got %s", event)
+			return
+		}
+		seq, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			t.Errorf("Invalid sequence number in event %s: %v", event, err)
+			return
+		}
+		seqs = append(seqs, seq)
+		if len(seqs) == 100 {
+			close(done)
+		}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := kvStore.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i), 0); err != nil {
+				t.Errorf("error setting key 'key%d': %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	select {
+	case <-done:
+		for i, seq := range seqs {
+			if seq != uint64(i+1) {
+				t.Fatalf("Expected sequence %d at position %d, got %d", i+1, i, seq)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for notifications, got %d", len(seqs))
+	}
+
+	if last := kvStore.LastSequence(); last != 100 {
+		t.Errorf("Expected last sequence 100, got %d", last)
+	}
+}
+
+func TestGetWithTTL(t *testing.T) {
+	filePath := "test_get_with_ttl.json"
+	defer os.Remove(filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Second)
+	defer kvStore.Stop()
+
+	if err := kvStore.Set("persistent", "value", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if err := kvStore.Set("short", "value", 1*time.Second); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	if err := kvStore.Set("long", "value", 1*time.Hour); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	_, ttl, err := kvStore.GetWithTTL("persistent")
+	if err != nil || ttl != store.NoExpiration {
+		t.Errorf("Expected NoExpiration for persistent key, got %v (error: %v)", ttl, err)
+	}
+
+	value, ttl, err := kvStore.GetWithTTL("long")
+	if err != nil || value != "value" {
+		t.Fatalf("Failed to get key 'long': %v", err)
+	}
+	if ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expected remaining TTL close to 1h, got %v", ttl)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, _, err := kvStore.GetWithTTL("short"); err == nil {
+		t.Errorf("Expected key 'short' to be expired")
+	}
+
+	if _, _, err := kvStore.GetWithTTL("missing"); err == nil {
+		t.Errorf("Expected error for missing key")
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	kvStore := kvtest.New(t).
+		WithTickerInterval(1*time.Minute).
+		WithKeys(map[string]string{"key1": "val1", "key3": "val3", "expiring": "gone"}).
+		WithTTL("expiring", 500*time.Millisecond).
+		Build()
+	time.Sleep(600 * time.Millisecond)
+
+	values, keyErrors := kvStore.GetMulti([]string{"key1", "key2", "key3", "expiring"})
+
+	if len(values) != 2 || values["key1"] != "val1" || values["key3"] != "val3" {
+		t.Errorf("Expected values for key1 and key3, got %v", values)
+	}
+	if err := keyErrors["key2"]; err == nil || err.Error() != "key not found" {
+		t.Errorf("Expected 'key not found' for key2, got %v", err)
+	}
+	if err := keyErrors["expiring"]; err == nil || err.Error() != "key expired" {
+		t.Errorf("Expected 'key expired' for expiring, got %v", err)
+	}
+	if len(keyErrors) != 2 {
+		t.Errorf("Expected 2 per-key errors, got %v", keyErrors)
+	}
+}
+
+func TestValueSize(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("blob", strings.Repeat("x", 100), 0)
+	kvStore.Set("blob", "\x00\xffé", 0)
+	kvStore.Set("expiring", "gone", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if size, err := kvStore.ValueSize("blob"); err != nil || size != 4 {
+		t.Errorf("Expected the byte size of the latest value, got %d (%v)", size, err)
+	}
+	if _, err := kvStore.ValueSize("expiring"); err == nil || err.Error() != "key expired" {
+		t.Errorf("Expected 'key expired', got %v", err)
+	}
+	if _, err := kvStore.ValueSize("missing"); err == nil || err.Error() != "key not found" {
+		t.Errorf("Expected 'key not found', got %v", err)
+	}
+}
+
+func TestVersionHistoryAudit(t *testing.T) {
+	filePath := "test_version_history_audit.json"
+	defer os.Remove(filePath)
+
+	type report struct {
+		key   string
+		count int
+	}
+	reports := make(chan report, 10)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute,
+		store.WithVersionHistoryAudit(100, 200*time.Millisecond, func(key string, count int) {
+			reports <- report{key: key, count: count}
+		}))
+	defer kvStore.Stop()
+
+	for i := 0; i < 200; i++ {
+		if err := kvStore.Set("busy", fmt.Sprintf("value%d", i), 0); err != nil {
+			t.Fatalf("Failed to set key 'busy': %v", err)
+		}
+	}
+	if err := kvStore.Set("quiet", "value", 0); err != nil {
+		t.Fatalf("Failed to set key 'quiet': %v", err)
+	}
+
+	select {
+	case r := <-reports:
+		if r.key != "busy" || r.count != 200 {
+			t.Errorf("Expected report for 'busy' with 200 versions, got %s with %d", r.key, r.count)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timeout waiting for version history audit")
+	}
+}
+
+func TestVersionHistoryAuditDefaultInterval(t *testing.T) {
+	filePath := "test_version_history_audit_default.json"
+	defer os.Remove(filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute,
+		store.WithVersionHistoryAudit(100, 0, func(string, int) {}),
+		store.WithSupervisorPolicy(fastSupervision))
+	defer kvStore.Stop()
+
+	// A zero interval falls back to the default rather than crashing the loop until it is given up on.
+	time.Sleep(100 * time.Millisecond)
+	if health := componentHealth(kvStore, store.ComponentHistoryAudit); !health.Running || health.Restarts != 0 {
+		t.Errorf("Expected the audit to keep running, got %+v", health)
+	}
+}
+
+func TestHotKeyDetection(t *testing.T) {
+	filePath := "test_hot_keys.json"
+	defer os.Remove(filePath)
+
+	start := time.Now()
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute,
+		store.WithHotKeyDetection(2, 10*time.Second, 0.5))
+	defer kvStore.Stop()
+
+	alerts := make(chan string, 10)
+	kvStore.RegisterNotificationListener(func(event string) {
+		if strings.HasPrefix(event, "hotkey:") {
+			alerts <- strings.TrimPrefix(event, "hotkey:")
+		}
+	})
+
+	for i := 0; i < 50; i++ {
+		if err := kvStore.Set(fmt.Sprintf("cold%d", i), "value", 0); err != nil {
+			t.Fatalf("Failed to set key: %v", err)
+		}
+	}
+	if err := kvStore.Set("hot", "value", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		if _, err := kvStore.Get("hot"); err != nil {
+			t.Fatalf("Failed to get key: %v", err)
+		}
+		if i%20 == 0 {
+			if _, err := kvStore.Get(fmt.Sprintf("cold%d", i/20)); err != nil {
+				t.Fatalf("Failed to get key: %v", err)
+			}
+		}
+	}
+	elapsed := time.Since(start)
+
+	hotKeys := kvStore.HotKeys(3)
+	if len(hotKeys) != 3 {
+		t.Fatalf("Expected 3 hot keys, got %v", hotKeys)
+	}
+	if hotKeys[0].Key != "hot" {
+		t.Fatalf("Expected 'hot' to be the hottest key, got %v", hotKeys)
+	}
+	// 1001 of 1101 accesses went to the hot key.
+	if hotKeys[0].Share < 0.85 || hotKeys[0].Share > 0.95 {
+		t.Errorf("Expected share around 0.91, got %.2f", hotKeys[0].Share)
+	}
+	expectedRate := 1001 / elapsed.Seconds()
+	if hotKeys[0].Rate < expectedRate/2 || hotKeys[0].Rate > expectedRate*2 {
+		t.Errorf("Expected rate around %.0f/s, got %.0f/s", expectedRate, hotKeys[0].Rate)
+	}
+
+	select {
+	case key := <-alerts:
+		if key != "hot" {
+			t.Errorf("Expected hot-key alert for 'hot', got %s", key)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Timeout waiting for hot-key notification")
+	}
+}
+
+func TestHotKeyDetectionDefaultWindow(t *testing.T) {
+	filePath := "test_hot_keys_default_window.json"
+	defer os.Remove(filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute,
+		store.WithHotKeyDetection(1, 0, 0.5))
+	defer kvStore.Stop()
+
+	// A zero window falls back to the default rather than dividing by zero.
+	kvStore.Set("hot", "value", 0)
+	kvStore.Get("hot")
+	if hotKeys := kvStore.HotKeys(1); len(hotKeys) != 1 || hotKeys[0].Key != "hot" {
+		t.Errorf("Expected 'hot' to be tracked, got %v", hotKeys)
+	}
+}
+
+func TestSubscriptionStatistics(t *testing.T) {
+	filePath := "test_subscription_statistics.json"
+	defer os.Remove(filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute)
+	defer kvStore.Stop()
+
+	var mu sync.Mutex
+	received := make(map[string]int)
+	allDelivered := make(chan struct{})
+	count := func(name string) func(string) {
+		return func(event string) {
+			mu.Lock()
+			defer mu.Unlock()
+			received[name]++
+			if received["all"] == 20 && received["updates"] == 19 {
+				close(allDelivered)
+			}
+		}
+	}
+
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	kvStore.RegisterNotificationListener(count("all"))
+	kvStore.Subscribe("updated:*", 100, count("updates"))
+	slowID := kvStore.Subscribe("", 1, func(event string) {
+		if event == "added:key@1" {
+			close(blocked)
+		}
+		<-release
+	})
+
+	if err := kvStore.Set("key", "value0", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	<-blocked
+
+	for i := 1; i < 20; i++ {
+		if err := kvStore.Set("key", fmt.Sprintf("value%d", i), 0); err != nil {
+			t.Fatalf("Failed to set key: %v", err)
+		}
+	}
+
+	select {
+	case <-allDelivered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for notifications, got %v", received)
+	}
+
+	subscriptions := kvStore.Subscriptions()
+	if len(subscriptions) != 3 {
+		t.Fatalf("Expected 3 subscriptions, got %d", len(subscriptions))
+	}
+	for _, sub := range subscriptions {
+		if sub.RegisteredAt.IsZero() {
+			t.Errorf("Expected registration time for subscription %d", sub.ID)
+		}
+		if sub.ID == slowID {
+			// The first event is being handled, the second waits in the queue and the rest are dropped.
+			if sub.ChannelBuffer != 1 || sub.Pending != 1 || sub.Dropped != 18 {
+				t.Errorf("Expected slow subscription with buffer 1, 1 pending and 18 dropped, got %+v", sub)
+			}
+		} else if sub.Pending != 0 || sub.Dropped != 0 {
+			t.Errorf("Expected subscription %d to be drained, got %+v", sub.ID, sub)
+		}
+	}
+
+	kvStore.DeregisterAllSubscriptions()
+	if subscriptions := kvStore.Subscriptions(); len(subscriptions) != 0 {
+		t.Errorf("Expected no subscriptions after deregistering, got %d", len(subscriptions))
+	}
+}
+
+func TestRehydrateTTLs(t *testing.T) {
+	filePath := "test_rehydrate_ttls.json"
+	defer os.Remove(filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute)
+	defer kvStore.Stop()
+
+	expired := make(chan string, 10)
+	kvStore.RegisterNotificationListener(func(event string) {
+		if strings.HasPrefix(event, "expired:") {
+			expired <- strings.SplitN(event[8:], "@", 2)[0]
+		}
+	})
+
+	if err := kvStore.Set("stale", "value", 0); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := kvStore.Set(fmt.Sprintf("key%d", i), "value", 0); err != nil {
+			t.Fatalf("Failed to set key: %v", err)
+		}
+	}
+	if err := kvStore.Set("ttl", "value", 1*time.Hour); err != nil {
+		t.Fatalf("Failed to set key: %v", err)
+	}
+
+	// Keep reading while the rehydration runs and record the slowest read.
+	stop := make(chan struct{})
+	var maxLatency time.Duration
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			start := time.Now()
+			if _, err := kvStore.Get("key0"); err != nil {
+				t.Errorf("Failed to get key during rehydration: %v", err)
+				return
+			}
+			if latency := time.Since(start); latency > maxLatency {
+				maxLatency = latency
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	rule := func(key string, history []store.KeyValue) (time.Duration, bool) {
+		time.Sleep(100 * time.Microsecond)
+		if key == "stale" {
+			return -time.Second, true
+		}
+		return store.TTLFromLastWrite(time.Hour)(key, history)
+	}
+	report, err := kvStore.RehydrateTTLs(rule)
+	close(stop)
+	readers.Wait()
+	if err != nil {
+		t.Fatalf("Failed to rehydrate TTLs: %v", err)
+	}
+
+	if report.Scanned != 1001 || report.Assigned != 1000 || report.Expired != 1 {
+		t.Errorf("Expected 1001 scanned, 1000 assigned and 1 expired, got %+v", report)
+	}
+	if maxLatency > 50*time.Millisecond {
+		t.Errorf("Expected reads to proceed during rehydration, slowest read took %v", maxLatency)
+	}
+
+	_, ttl, err := kvStore.GetWithTTL("key1")
+	if err != nil || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("Expected rehydrated TTL close to 1h, got %v (error: %v)", ttl, err)
+	}
+	if _, err := kvStore.Get("stale"); err == nil {
+		t.Errorf("Expected 'stale' to be expired immediately")
+	}
+
+	select {
+	case key := <-expired:
+		if key != "stale" {
+			t.Errorf("Expected expiration event for 'stale', got %s", key)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("Timeout waiting for expiration event")
+	}
+}
+
+func TestRehydrateTTLsSkipsPrunedRewrite(t *testing.T) {
+	filePath := "test_rehydrate_pruned.json"
+	defer os.Remove(filePath)
+
+	kvStore := store.NewKeyValueStore(filePath, encryptionKey, 0, 1*time.Minute,
+		store.WithVersionRetention(store.VersionRetention{MaxVersions: 1}))
+	defer kvStore.Stop()
+	kvStore.Set("session", "old", 0)
+
+	// The write lands between the read and the update, and pruning keeps the history at one version.
+	rule := func(key string, history []store.KeyValue) (time.Duration, bool) {
+		kvStore.Set(key, "new", 0)
+		return -time.Second, true
+	}
+	report, err := kvStore.RehydrateTTLs(rule)
+	if err != nil {
+		t.Fatalf("Failed to rehydrate TTLs: %v", err)
+	}
+	if report.Expired != 0 || report.Skipped != 1 {
+		t.Errorf("Expected the rewritten key to be skipped, got %+v", report)
+	}
+	if value, err := kvStore.Get("session"); err != nil || value != "new" {
+		t.Errorf("Expected the concurrent write to survive, got %q (error: %v)", value, err)
+	}
+}
+
+func TestGetOrDefault(t *testing.T) {
+	kvStore := kvtest.New(t).
+		WithKeys(map[string]string{"name": "Jane", "count": "42", "invalid": "forty-two", "expiring": "7"}).
+		WithTTL("expiring", 500*time.Millisecond).
+		Build()
+	time.Sleep(600 * time.Millisecond)
+
+	if value := kvStore.GetOrDefault("name", "default"); value != "Jane" {
+		t.Errorf("Expected 'Jane', got '%s'", value)
+	}
+	if value := kvStore.GetOrDefault("missing", "default"); value != "default" {
+		t.Errorf("Expected default for missing key, got '%s'", value)
+	}
+	if value := kvStore.GetOrDefault("expiring", "default"); value != "default" {
+		t.Errorf("Expected default for expired key, got '%s'", value)
+	}
+
+	if n := kvStore.GetOrDefaultInt("count", -1); n != 42 {
+		t.Errorf("Expected 42, got %d", n)
+	}
+	if n := kvStore.GetOrDefaultInt("missing", -1); n != -1 {
+		t.Errorf("Expected default for missing key, got %d", n)
+	}
+	if n := kvStore.GetOrDefaultInt("expiring", -1); n != -1 {
+		t.Errorf("Expected default for expired key, got %d", n)
+	}
+	if n := kvStore.GetOrDefaultInt("invalid", -1); n != -1 {
+		t.Errorf("Expected default for non-integer value, got %d", n)
+	}
+}
+
+func TestMustGet(t *testing.T) {
+	kvStore := kvtest.New(t).
+		WithKeys(map[string]string{"name": "Jane"}).
+		Build()
+
+	if value := kvStore.KeyValueStore.MustGet("name"); value != "Jane" {
+		t.Errorf("Expected 'Jane', got '%s'", value)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected MustGet to panic for a missing key")
+		}
+	}()
+	kvStore.KeyValueStore.MustGet("missing")
+}
+
+func TestSetMany(t *testing.T) {
+	kvStore := kvtest.New(t).
+		WithKeys(map[string]string{"existing1": "old", "existing2": "old"}).
+		Build()
+
+	result := kvStore.SetMany([]store.Entry{
+		{Key: "existing1", Value: "new"},
+		{Key: "fresh1", Value: "new"},
+		{Key: "existing2", Value: "new", TTL: time.Hour},
+		{Key: "fresh2", Value: "new"},
+	})
+
+	if strings.Join(result.Created, ",") != "fresh1,fresh2" {
+		t.Errorf("Expected created [fresh1 fresh2], got %v", result.Created)
+	}
+	if strings.Join(result.Updated, ",") != "existing1,existing2" {
+		t.Errorf("Expected updated [existing1 existing2], got %v", result.Updated)
+	}
+	if len(result.Errors) != 0 {
+		t.Errorf("Expected no errors, got %v", result.Errors)
+	}
+
+	for _, key := range []string{"existing1", "existing2", "fresh1", "fresh2"} {
+		kvStore.AssertValue(key, "new")
+	}
+	if versions, _ := kvStore.GetAllVersions("existing1"); len(versions) != 2 {
+		t.Errorf("Expected 2 versions for existing1, got %v", versions)
+	}
+	if _, ttl, _ := kvStore.GetWithTTL("existing2"); ttl <= 0 {
+		t.Errorf("Expected TTL for existing2, got %v", ttl)
+	}
+}
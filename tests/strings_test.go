@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestAppend(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	if n, err := kvStore.Append("log", "a"); err != nil || n != 1 {
+		t.Fatalf("Expected Append to create the key with length 1, got %d (%v)", n, err)
+	}
+	if n, _ := kvStore.Append("log", "bc"); n != 3 {
+		t.Errorf("Expected length 3, got %d", n)
+	}
+	if value, _ := kvStore.Get("log"); value != "abc" {
+		t.Errorf("Expected abc, got %q", value)
+	}
+	if versions, _ := kvStore.GetAllVersions("log"); len(versions) != 2 {
+		t.Errorf("Expected each append to add a version, got %v", versions)
+	}
+
+	kvStore.Set("session", "x", time.Hour)
+	kvStore.Append("session", "y")
+	if value, ttl, _ := kvStore.GetWithTTL("session"); value != "xy" || ttl <= 59*time.Minute {
+		t.Errorf("Expected Append to keep the TTL, got %q with %v", value, ttl)
+	}
+
+	kvStore.Set("locked", "v", 0)
+	kvStore.MarkImmutable("locked")
+	if _, err := kvStore.Append("locked", "!"); !errors.Is(err, store.ErrImmutableKey) {
+		t.Errorf("Expected ErrImmutableKey, got %v", err)
+	}
+}
+
+func TestAppendIsAtomic(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if _, err := kvStore.Append("counter", "."); err != nil {
+					t.Errorf("Append failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := kvStore.Get("counter"); value != strings.Repeat(".", 200) {
+		t.Errorf("Expected 200 appends, got %d", len(value))
+	}
+}
+
+func TestStringUpdatesUnderRetention(t *testing.T) {
+	// A single retained version keeps the history length constant across writes.
+	kvStore := store.NewPassive(store.WithVersionRetention(store.VersionRetention{MaxVersions: 1}))
+	defer kvStore.Stop()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	previous := map[string]int{}
+	created := 0
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if _, err := kvStore.Append("log", "."); err != nil {
+					t.Errorf("Append failed: %v", err)
+				}
+				old, found, err := kvStore.GetSet("swap", fmt.Sprintf("%d-%d", w, i))
+				if err != nil {
+					t.Errorf("GetSet failed: %v", err)
+				}
+				set, err := kvStore.SetNX(fmt.Sprintf("lock-%d", i), strconv.Itoa(w), 0)
+				if err != nil {
+					t.Errorf("SetNX failed: %v", err)
+				}
+				mu.Lock()
+				if found {
+					previous[old]++
+				}
+				if set {
+					created++
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if value, _ := kvStore.Get("log"); value != strings.Repeat(".", 200) {
+		t.Errorf("Expected 200 appends, got %d", len(value))
+	}
+	// Every value but the last is returned by exactly one GetSet.
+	last, _ := kvStore.Get("swap")
+	if len(previous) != 199 || previous[last] != 0 {
+		t.Errorf("Expected 199 distinct previous values other than %q, got %d", last, len(previous))
+	}
+	for value, n := range previous {
+		if n != 1 {
+			t.Errorf("Expected %q to be replaced once, got %d", value, n)
+		}
+	}
+	if created != 25 {
+		t.Errorf("Expected one SetNX per key to set, got %d for 25 keys", created)
+	}
+
+	// An append retries when the key is deleted and set again in between.
+	kvStore.Set("recreated", "a", 0)
+	var fired atomic.Bool
+	kvStore.RegisterPreWriteHook("recreated", func(key, value string) (string, string, error) {
+		// Runs between the append's read and its write.
+		if fired.CompareAndSwap(false, true) {
+			kvStore.Delete("recreated")
+			kvStore.Set("recreated", "b", 0)
+		}
+		return key, value, nil
+	})
+	if _, err := kvStore.Append("recreated", "!"); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if value, _ := kvStore.Get("recreated"); value != "b!" {
+		t.Errorf("Expected the append to apply to the re-created value, got %q", value)
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	if old, found, err := kvStore.GetSet("k", "1"); err != nil || found || old != "" {
+		t.Errorf("Expected no previous value, got %q, %v (%v)", old, found, err)
+	}
+	kvStore.Set("k", "2", time.Hour)
+	if old, found, _ := kvStore.GetSet("k", "3"); !found || old != "2" {
+		t.Errorf("Expected the previous value 2, got %q, %v", old, found)
+	}
+	if value, ttl, _ := kvStore.GetWithTTL("k"); value != "3" || ttl != store.NoExpiration {
+		t.Errorf("Expected GetSet to clear the TTL like Set, got %q with %v", value, ttl)
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+
+	if set, err := kvStore.SetNX("lock", "a", 20*time.Millisecond); err != nil || !set {
+		t.Fatalf("Expected the first SetNX to set, got %v (%v)", set, err)
+	}
+	if set, _ := kvStore.SetNX("lock", "b", 0); set {
+		t.Error("Expected SetNX on an existing key not to set")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if set, _ := kvStore.SetNX("lock", "c", 0); !set {
+		t.Error("Expected SetNX to set a key that expired")
+	}
+	if value, _ := kvStore.Get("lock"); value != "c" {
+		t.Errorf("Expected c, got %q", value)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestSubscribeEvents(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("other", "x", 0)
+
+	var events []store.Event
+	kvStore.SubscribeEvents(store.EventFilter{Include: []string{"user:", "hotkey"}}, 0, func(e store.Event) {
+		events = append(events, e)
+	})
+	var texts deliveredEvents
+	kvStore.Subscribe("", 0, texts.record)
+
+	kvStore.Set("other", "y", 0)
+	kvStore.Set("user:1", "a", 0)
+	kvStore.Set("user:1", "b", 0)
+	kvStore.CompareAndSwap("user:1", "b", "c", 0)
+	kvStore.Set("user:2", "short", 10*time.Millisecond)
+	kvStore.Delete("user:1")
+	time.Sleep(20 * time.Millisecond)
+	kvStore.SweepExpired()
+	kvStore.Notify("hotkey:user:1")
+
+	var got []string
+	for _, e := range events {
+		got = append(got, fmt.Sprintf("%s %s %q->%q", e.Type, e.Key, e.OldValue, e.NewValue))
+		if e.Type != "hotkey" && (e.Seq == 0 || e.Time.IsZero()) {
+			t.Errorf("Expected key events to carry a sequence number and time, got %+v", e)
+		}
+	}
+	want := []string{
+		`added user:1 ""->"a"`,
+		`updated user:1 "a"->"b"`,
+		`updated user:1 "b"->"c"`,
+		`added user:2 ""->"short"`,
+		`deleted user:1 "c"->""`,
+		`expired user:2 "short"->""`,
+		`hotkey user:1 ""->""`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected events\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	// String listeners receive the same events as text, which Event.String reproduces.
+	var strung deliveredEvents
+	for _, e := range events {
+		strung.record(e.String())
+	}
+	if fmt.Sprint(texts) != fmt.Sprint(append(deliveredEvents{"updated:other"}, strung...)) {
+		t.Errorf("Expected Event.String to match string listeners, got %v and %v", strung, texts)
+	}
+}
+
+func TestEventLogHoldsNoValues(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("secret", "hunter2", 0)
+	kvStore.Set("secret", "hunter3", 0)
+
+	events, err := kvStore.EventsSince(0)
+	if err != nil {
+		t.Fatalf("EventsSince failed: %v", err)
+	}
+	for _, e := range events {
+		if e.OldValue != "" || e.NewValue != "" {
+			t.Errorf("Expected the event log to hold no values, got %+v", e)
+		}
+	}
+}
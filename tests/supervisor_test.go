@@ -0,0 +1,179 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+var fastSupervision = store.SupervisorPolicy{
+	CheckInterval: 5 * time.Millisecond,
+	StallAfter:    100 * time.Millisecond,
+	Backoff:       5 * time.Millisecond,
+	MaxRestarts:   2,
+}
+
+// componentHealth returns the health of the named component.
+func componentHealth(kvStore *store.KeyValueStore, name string) store.ComponentHealth {
+	for _, c := range kvStore.Health().Components {
+		if c.Name == name {
+			return c
+		}
+	}
+	return store.ComponentHealth{}
+}
+
+// eventRecorder collects notifications.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *eventRecorder) record(event string) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+// has reports whether an event starting with prefix was recorded.
+func (r *eventRecorder) has(prefix string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, event := range r.events {
+		if strings.HasPrefix(event, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSupervisorRestartsCleanupLoop(t *testing.T) {
+	faults := store.NewFaultInjector()
+	faults.Enable(true)
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 10*time.Millisecond,
+		store.WithFaultInjector(faults), store.WithSupervisorPolicy(fastSupervision))
+	defer kvStore.Stop()
+
+	var events eventRecorder
+	kvStore.RegisterNotificationListener(events.record)
+
+	faults.PanicInLoop(store.ComponentCleanup, 1)
+	if !waitFor(t, time.Second, func() bool { return componentHealth(kvStore, store.ComponentCleanup).Restarts == 1 }) {
+		t.Fatalf("Expected the cleanup loop to be restarted, got %+v", componentHealth(kvStore, store.ComponentCleanup))
+	}
+	health := componentHealth(kvStore, store.ComponentCleanup)
+	if !strings.HasPrefix(health.LastFailure, "panic:") || !health.Running {
+		t.Errorf("Expected a running loop restarted after a panic, got %+v", health)
+	}
+	if !waitFor(t, time.Second, func() bool { return events.has("component_restarted:cleanup") }) {
+		t.Error("Expected a component_restarted:cleanup notification")
+	}
+
+	// The restarted loop still expires keys.
+	kvStore.Set("temp", "soon gone", 20*time.Millisecond)
+	if !waitFor(t, time.Second, func() bool { return events.has("expired:temp@") }) {
+		t.Error("Expected the restarted cleanup loop to expire keys")
+	}
+	if !kvStore.Health().Healthy {
+		t.Errorf("Expected the store to stay healthy, got %+v", kvStore.Health())
+	}
+}
+
+func TestSupervisorRestartsNotificationLoop(t *testing.T) {
+	faults := store.NewFaultInjector()
+	faults.Enable(true)
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithFaultInjector(faults), store.WithSupervisorPolicy(fastSupervision))
+	defer kvStore.Stop()
+
+	var events eventRecorder
+	kvStore.RegisterNotificationListener(events.record)
+
+	faults.PanicInLoop(store.ComponentNotifications, 1)
+	kvStore.Set("lost", "v", 0) // Delivered to the loop that dies
+	if !waitFor(t, time.Second, func() bool { return componentHealth(kvStore, store.ComponentNotifications).Restarts == 1 }) {
+		t.Fatalf("Expected the notification loop to be restarted, got %+v", componentHealth(kvStore, store.ComponentNotifications))
+	}
+
+	kvStore.Set("name", "John", 0)
+	if !waitFor(t, time.Second, func() bool { return events.has("added:name@") }) {
+		t.Error("Expected events to be delivered after the restart")
+	}
+	if !events.has("component_restarted:notifications") {
+		t.Error("Expected a component_restarted:notifications notification")
+	}
+}
+
+func TestSupervisorRestartsStalledLoop(t *testing.T) {
+	release := make(chan struct{})
+	var calls sync.Once
+	reader := func() (uint64, error) {
+		// The first sample hangs, stalling the watchdog loop.
+		stalled := false
+		calls.Do(func() { stalled = true })
+		if stalled {
+			<-release
+		}
+		return 0, nil
+	}
+
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithMemoryWatchdog(5*time.Millisecond, store.MemoryThresholds{HighWater: 100}, reader),
+		store.WithSupervisorPolicy(fastSupervision))
+	defer kvStore.Stop()
+	// Stop waits for the stalled loop, so let it finish first.
+	defer close(release)
+
+	if !waitFor(t, 2*time.Second, func() bool { return componentHealth(kvStore, store.ComponentMemoryWatchdog).Restarts == 1 }) {
+		t.Fatalf("Expected the stalled watchdog to be restarted, got %+v", componentHealth(kvStore, store.ComponentMemoryWatchdog))
+	}
+	if health := componentHealth(kvStore, store.ComponentMemoryWatchdog); health.LastFailure != "stalled" {
+		t.Errorf("Expected the restart to be recorded as a stall, got %+v", health)
+	}
+	before := componentHealth(kvStore, store.ComponentMemoryWatchdog).LastBeat
+	if !waitFor(t, time.Second, func() bool { return componentHealth(kvStore, store.ComponentMemoryWatchdog).LastBeat.After(before) }) {
+		t.Error("Expected the replacement loop to heartbeat")
+	}
+}
+
+func TestSupervisorGivesUpAfterRestartBudget(t *testing.T) {
+	faults := store.NewFaultInjector()
+	faults.Enable(true)
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 5*time.Millisecond,
+		store.WithFaultInjector(faults), store.WithSupervisorPolicy(fastSupervision))
+	defer kvStore.Stop()
+
+	var events eventRecorder
+	kvStore.RegisterNotificationListener(events.record)
+
+	faults.PanicInLoop(store.ComponentCleanup, 100)
+	if !waitFor(t, 2*time.Second, func() bool { return !kvStore.Health().Healthy }) {
+		t.Fatalf("Expected the store to turn unhealthy, got %+v", kvStore.Health())
+	}
+	health := componentHealth(kvStore, store.ComponentCleanup)
+	if !health.Failed || health.Running || health.Restarts != fastSupervision.MaxRestarts {
+		t.Errorf("Expected cleanup to fail after %d restarts, got %+v", fastSupervision.MaxRestarts, health)
+	}
+	if !waitFor(t, time.Second, func() bool { return events.has("component_failed:cleanup") }) {
+		t.Error("Expected a component_failed:cleanup notification")
+	}
+	if notifications := componentHealth(kvStore, store.ComponentNotifications); !notifications.Running || notifications.Restarts != 0 {
+		t.Errorf("Expected the notification loop to be unaffected, got %+v", notifications)
+	}
+}
+
+func TestSupervisorPartialPolicy(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithSupervisorPolicy(store.SupervisorPolicy{MaxRestarts: 10}))
+	defer kvStore.Stop()
+
+	// Fields left zero take their defaults instead of starting the checks with a zero interval.
+	kvStore.Set("name", "Jane", 0)
+	if health := kvStore.Health(); !health.Healthy {
+		t.Errorf("Expected a healthy store, got %+v", health)
+	}
+}
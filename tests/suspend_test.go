@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// allEvents subscribes to every event of a passive store, delivered before each write returns.
+func allEvents(kvStore *store.KeyValueStore) *deliveredEvents {
+	events := &deliveredEvents{}
+	kvStore.Subscribe("", 0, events.record)
+	return events
+}
+
+func TestImportSuspendsNotifications(t *testing.T) {
+	var commands strings.Builder
+	var entries []store.Entry
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&commands, "SET key%d v%d\n", i, i)
+		entries = append(entries, store.Entry{Key: fmt.Sprintf("key%d", i), Value: fmt.Sprintf("v%d", i)})
+	}
+
+	unsuspended := store.NewPassive()
+	defer unsuspended.Stop()
+	unsuspended.Set("key0", "old", 0)
+	perKey := allEvents(unsuspended)
+	unsuspended.SetMany(entries)
+	if len(*perKey) != 50 {
+		t.Fatalf("Expected an event per key without suspension, got %d", len(*perKey))
+	}
+
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("key0", "old", 0)
+	events := allEvents(kvStore)
+	report, err := kvStore.ImportRedis(strings.NewReader(commands.String()))
+	if err != nil || report.Imported != 50 {
+		t.Fatalf("Expected 50 keys to be imported, got %d (%v)", report.Imported, err)
+	}
+	if want := []string{"bulk:import_redis:added=49,updated=1"}; !reflect.DeepEqual([]string(*events), want) {
+		t.Errorf("Expected a single summary matching the mutations, got %v", *events)
+	}
+
+	kvStore.Set("key0", "new", 0)
+	if len(*events) != 2 || (*events)[1] != "updated:key0" {
+		t.Errorf("Expected notifications to resume after the import, got %v", *events)
+	}
+}
+
+func TestImportKeepsConcurrentNotifications(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	events := allEvents(kvStore)
+
+	// A write by another caller while the import runs is not one of its mutations and is still sent.
+	kvStore.RegisterPreWriteHook("key0", func(key, value string) (string, string, error) {
+		kvStore.Set("other", "v", 0)
+		return key, value, nil
+	})
+	if _, err := kvStore.ImportRedis(strings.NewReader("SET key0 a\nSET key1 b\n")); err != nil {
+		t.Fatalf("ImportRedis failed: %v", err)
+	}
+	if want := []string{"added:other", "bulk:import_redis:added=2"}; !reflect.DeepEqual([]string(*events), want) {
+		t.Errorf("Expected %v, got %v", want, *events)
+	}
+}
+
+func TestNestedSuspensions(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	events := allEvents(kvStore)
+
+	resumeOuter := kvStore.SuspendNotifications("outer")
+	kvStore.Set("a", "1", 0)
+	resumeInner := kvStore.SuspendNotifications("inner")
+	kvStore.Set("a", "2", 0)
+	kvStore.Delete("a")
+	kvStore.Notify("custom:event")
+	resumeInner(true)
+	resumeInner(true)
+
+	// Subscriptions made during a suspension receive its summary.
+	var late []string
+	kvStore.Subscribe("bulk:*", 0, func(event string) { late = append(late, event) })
+	kvStore.Set("b", "1", 0)
+	resumeOuter(true)
+
+	want := []string{"custom:event", "bulk:inner:deleted=1,updated=1", "bulk:outer:added=2,deleted=1,updated=1"}
+	if !reflect.DeepEqual([]string(*events), want) {
+		t.Errorf("Expected %v, got %v", want, *events)
+	}
+	if !reflect.DeepEqual(late, want[2:]) {
+		t.Errorf("Expected the late subscription to receive the outer summary, got %v", late)
+	}
+
+	// Suppressed events stay available to consumers resynchronizing from the event log.
+	if log, err := kvStore.EventsSince(0); err != nil || len(log) != 4 {
+		t.Errorf("Expected 4 logged events, got %+v (%v)", log, err)
+	}
+
+	resumeQuiet := kvStore.SuspendNotifications("quiet")
+	kvStore.Set("c", "1", 0)
+	resumeQuiet(false)
+	if len(*events) != 3 {
+		t.Errorf("Expected no summary, got %v", *events)
+	}
+}
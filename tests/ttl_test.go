@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/ttl"
+)
+
+func TestParseTTL(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	str := func(s string) *string { return &s }
+	secs := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name      string
+		in        ttl.Input
+		want      time.Duration
+		wantField string
+	}{
+		{"none", ttl.Input{}, 0, ""},
+		{"minutes", ttl.Input{TTL: str("5m")}, 5 * time.Minute, ""},
+		{"compound", ttl.Input{TTL: str("1h30m")}, 90 * time.Minute, ""},
+		{"zero", ttl.Input{TTL: str("0")}, 0, ""},
+		{"zero with unit", ttl.Input{TTL: str("0s")}, 0, ""},
+		{"bare integer", ttl.Input{TTL: str("300")}, 0, ttl.FieldTTL},
+		{"bare float", ttl.Input{TTL: str("1.5")}, 0, ttl.FieldTTL},
+		{"garbage", ttl.Input{TTL: str("soon")}, 0, ttl.FieldTTL},
+		{"empty", ttl.Input{TTL: str("")}, 0, ttl.FieldTTL},
+		{"negative", ttl.Input{TTL: str("-5m")}, 0, ttl.FieldTTL},
+		{"seconds", ttl.Input{TTLSeconds: secs(300)}, 300 * time.Second, ""},
+		{"zero seconds", ttl.Input{TTLSeconds: secs(0)}, 0, ""},
+		{"negative seconds", ttl.Input{TTLSeconds: secs(-1)}, 0, ttl.FieldTTLSeconds},
+		{"overflowing seconds", ttl.Input{TTLSeconds: secs(1 << 62)}, 0, ttl.FieldTTLSeconds},
+		{"expires at", ttl.Input{ExpiresAt: str("2024-01-02T16:04:05Z")}, time.Hour, ""},
+		{"expires at with offset", ttl.Input{ExpiresAt: str("2024-01-02T17:04:05+01:00")}, time.Hour, ""},
+		{"expires at in the past", ttl.Input{ExpiresAt: str("2024-01-02T14:04:05Z")}, 0, ttl.FieldExpiresAt},
+		{"expires at now", ttl.Input{ExpiresAt: str("2024-01-02T15:04:05Z")}, 0, ttl.FieldExpiresAt},
+		{"expires at not RFC3339", ttl.Input{ExpiresAt: str("tomorrow")}, 0, ttl.FieldExpiresAt},
+		{"ttl and seconds", ttl.Input{TTL: str("5m"), TTLSeconds: secs(300)}, 0, ttl.FieldTTLSeconds},
+		{"ttl and expires at", ttl.Input{TTL: str("5m"), ExpiresAt: str("2024-01-02T16:04:05Z")}, 0, ttl.FieldExpiresAt},
+		{"seconds and expires at", ttl.Input{TTLSeconds: secs(1), ExpiresAt: str("2024-01-02T16:04:05Z")}, 0, ttl.FieldExpiresAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ttl.Parse(tt.in, now)
+			if tt.wantField == "" {
+				if err != nil || got != tt.want {
+					t.Errorf("Expected %v, got %v (error: %v)", tt.want, got, err)
+				}
+				return
+			}
+			var fieldErr *ttl.FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != tt.wantField {
+				t.Fatalf("Expected an error naming %s, got %v", tt.wantField, err)
+			}
+			if errs.HTTPStatus(err) != http.StatusBadRequest {
+				t.Errorf("Expected a 400 mapping, got %d", errs.HTTPStatus(err))
+			}
+		})
+	}
+}
+
+func TestTTLExpiresAt(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	if !ttl.ExpiresAt(0, now).IsZero() {
+		t.Errorf("Expected no expiration for a zero TTL")
+	}
+	if got := ttl.ExpiresAt(time.Minute, now); !got.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected %v, got %v", now.Add(time.Minute), got)
+	}
+}
+
+func TestTTLParseCount(t *testing.T) {
+	tests := []struct {
+		in      string
+		unit    time.Duration
+		want    time.Duration
+		wantErr bool
+	}{
+		{"10", time.Second, 10 * time.Second, false},
+		{"1500", time.Millisecond, 1500 * time.Millisecond, false},
+		{"0", time.Second, 0, false},
+		{"-1", time.Second, -time.Second, false},
+		{"1.5", time.Second, 0, true},
+		{"10s", time.Second, 0, true},
+		{"9223372036854775807", time.Second, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ttl.ParseCount("EX", tt.in, tt.unit)
+		if tt.wantErr {
+			var fieldErr *ttl.FieldError
+			if !errors.As(err, &fieldErr) || fieldErr.Field != "EX" {
+				t.Errorf("Expected an error naming EX for %q, got %v (error: %v)", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Expected %v for %q, got %v (error: %v)", tt.want, tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// tenantStore returns a store with tenant keys with and without TTLs, an expired tenant key and another tenant.
+func tenantStore(t *testing.T, opts ...store.Option) *store.KeyValueStore {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute, opts...)
+	kvStore.Set("tenant1:session:a", "a", 0)
+	kvStore.Set("tenant1:session:b", "b", time.Hour)
+	kvStore.Set("tenant1:session:c", "c", 2*time.Hour)
+	kvStore.Set("tenant1:expired", "x", time.Millisecond)
+	kvStore.Set("tenant2:session:a", "a", 0)
+	time.Sleep(5 * time.Millisecond)
+	return kvStore
+}
+
+// ttlOf returns the remaining TTL of key, or store.NoExpiration if it has none.
+func ttlOf(t *testing.T, kvStore *store.KeyValueStore, key string) time.Duration {
+	t.Helper()
+	_, ttl, err := kvStore.GetWithTTL(key)
+	if err != nil {
+		t.Fatalf("GetWithTTL(%s) failed: %v", key, err)
+	}
+	return ttl
+}
+
+func TestExpireByPrefix(t *testing.T) {
+	var events eventRecorder
+	kvStore := tenantStore(t)
+	defer kvStore.Stop()
+	kvStore.RegisterNotificationListener(events.record)
+
+	if n, err := kvStore.ExpireByPrefix("tenant1:", time.Minute, store.BulkDryRun()); err != nil || n != 3 {
+		t.Fatalf("Expected a dry run to count 3 keys, got %d (error: %v)", n, err)
+	}
+	if ttl := ttlOf(t, kvStore, "tenant1:session:a"); ttl != store.NoExpiration {
+		t.Errorf("Expected the dry run to leave keys unchanged, got TTL %v", ttl)
+	}
+
+	n, err := kvStore.ExpireByPrefix("tenant1:", time.Minute, store.BulkBatch(2))
+	if err != nil || n != 3 {
+		t.Fatalf("Expected 3 keys to be updated, got %d (error: %v)", n, err)
+	}
+	for _, key := range []string{"tenant1:session:a", "tenant1:session:b", "tenant1:session:c"} {
+		if ttl := ttlOf(t, kvStore, key); ttl <= 0 || ttl > time.Minute {
+			t.Errorf("Expected %s to expire within a minute, got TTL %v", key, ttl)
+		}
+	}
+	if ttl := ttlOf(t, kvStore, "tenant2:session:a"); ttl != store.NoExpiration {
+		t.Errorf("Expected other tenants to be untouched, got TTL %v", ttl)
+	}
+	seq := kvStore.LastSequence()
+	if !waitFor(t, time.Second, func() bool { return events.has(fmt.Sprintf("bulk_expire:tenant1::3@%d", seq)) }) {
+		t.Errorf("Expected a single summarizing notification at sequence %d, got %v", seq, events.events)
+	}
+	if replayed, err := kvStore.EventsSince(seq - 1); err != nil || len(replayed) != 1 || replayed[0].Type != "bulk_expire" {
+		t.Errorf("Expected the summarizing event to be replayed, got %+v (error: %v)", replayed, err)
+	}
+	if events.has("updated:") {
+		t.Errorf("Expected no per-key notifications, got %v", events.events)
+	}
+
+	if _, err := kvStore.ExpireByPrefix("tenant1:", 0); err == nil {
+		t.Error("Expected a zero TTL to be rejected")
+	}
+}
+
+func TestPersistByPrefix(t *testing.T) {
+	kvStore := tenantStore(t)
+	defer kvStore.Stop()
+
+	if n, err := kvStore.PersistByPrefix("tenant1:", store.BulkDryRun()); err != nil || n != 2 {
+		t.Fatalf("Expected a dry run to count the 2 live keys with a TTL, got %d (error: %v)", n, err)
+	}
+	n, err := kvStore.PersistByPrefix("tenant1:")
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 keys to be persisted, got %d (error: %v)", n, err)
+	}
+	for _, key := range []string{"tenant1:session:a", "tenant1:session:b", "tenant1:session:c"} {
+		if ttl := ttlOf(t, kvStore, key); ttl != store.NoExpiration {
+			t.Errorf("Expected %s to have no TTL, got %v", key, ttl)
+		}
+	}
+	if _, err := kvStore.Get("tenant1:expired"); err == nil {
+		t.Error("Expected the expired key to stay expired")
+	}
+}
+
+func TestBulkDryRunLeavesPendingWrites(t *testing.T) {
+	kvStore := tenantStore(t, store.WithWriteCoalescing("tenant1:pending", time.Minute))
+	defer kvStore.Stop()
+	kvStore.Set("tenant1:pending", "1", 0)
+
+	if n, err := kvStore.ExpireByPrefix("tenant1:", time.Minute, store.BulkDryRun()); err != nil || n != 4 {
+		t.Fatalf("Expected a dry run to count the pending key too, got %d (error: %v)", n, err)
+	}
+	if n, err := kvStore.PersistByPrefix("tenant1:", store.BulkDryRun()); err != nil || n != 2 {
+		t.Fatalf("Expected the pending key to have no TTL to remove, got %d (error: %v)", n, err)
+	}
+
+	// A write still pending after the dry runs collapses into the same version.
+	kvStore.Set("tenant1:pending", "2", 0)
+	if _, err := kvStore.ExpireByPrefix("tenant1:", time.Minute); err != nil {
+		t.Fatalf("ExpireByPrefix failed: %v", err)
+	}
+	history, err := kvStore.GetHistory("tenant1:pending")
+	if err != nil || len(history) != 1 || history[0].Value != "2" || history[0].Collapsed != 1 {
+		t.Errorf("Expected a single version collapsing both writes, got %+v (error: %v)", history, err)
+	}
+}
+
+func TestExpireByPrefixDoesNotStarveReaders(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	entries := make([]store.Entry, 50000)
+	for i := range entries {
+		entries[i] = store.Entry{Key: fmt.Sprintf("tenant:%05d", i), Value: "v"}
+	}
+	kvStore.SetMany(entries)
+	kvStore.Set("other", "v", 0)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var during atomic.Int64
+	var worst atomic.Int64
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			start := time.Now()
+			kvStore.Get("other")
+			if latency := int64(time.Since(start)); latency > worst.Load() {
+				worst.Store(latency)
+			}
+			during.Add(1)
+		}
+	}()
+
+	start := time.Now()
+	n, err := kvStore.ExpireByPrefix("tenant:", time.Hour, store.BulkBatch(500))
+	total := time.Since(start)
+	close(done)
+	wg.Wait()
+	if err != nil || n != len(entries) {
+		t.Fatalf("Expected %d keys to be updated, got %d (error: %v)", len(entries), n, err)
+	}
+	if during.Load() < 10 {
+		t.Errorf("Expected reads to proceed between batches, got %d reads in %v", during.Load(), total)
+	}
+	// An update holding the lock throughout would block a read for its whole duration.
+	if latency := time.Duration(worst.Load()); latency >= total {
+		t.Errorf("Expected batching to bound Get latency, got %v during a %v update", latency, total)
+	}
+}
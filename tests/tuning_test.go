@@ -0,0 +1,103 @@
+package main
+
+import (
+	"compress/zlib"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestTuningProfileResolution(t *testing.T) {
+	newStoreWithInterval := func(interval time.Duration, opts ...store.Option) *store.KeyValueStore {
+		kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, interval, opts...)
+		t.Cleanup(kvStore.Stop)
+		return kvStore
+	}
+	newStore := func(opts ...store.Option) *store.KeyValueStore {
+		return newStoreWithInterval(2*time.Minute, opts...)
+	}
+
+	defaults := newStore().EffectiveConfig()
+	if defaults.Profile != "none" || defaults.CleanupInterval != 2*time.Minute || defaults.NotificationQueue != 10 {
+		t.Errorf("Expected the defaults without a profile, got %+v", defaults)
+	}
+
+	lowMemory := newStoreWithInterval(0, store.WithTuningProfile(store.ProfileLowMemory)).EffectiveConfig()
+	want := store.TuningConfig{
+		Profile:            store.ProfileLowMemory,
+		CleanupInterval:    10 * time.Second,
+		CleanupBatch:       256,
+		CompressionLevel:   zlib.BestCompression,
+		NotificationQueue:  16,
+		SubscriptionBuffer: 64,
+	}
+	if lowMemory != want {
+		t.Errorf("Expected %+v, got %+v", want, lowMemory)
+	}
+
+	// A cleanup interval passed to the constructor overrides the profile like an individual option.
+	if config := newStore(store.WithTuningProfile(store.ProfileLowMemory)).EffectiveConfig(); config.CleanupInterval != 2*time.Minute || config.CleanupBatch != 256 {
+		t.Errorf("Expected the constructor's cleanup interval with the profile's other settings, got %+v", config)
+	}
+
+	// Individual options override the profile whether they come before or after it.
+	for name, opts := range map[string][]store.Option{
+		"before": {store.WithCleanupInterval(time.Second), store.WithCompressionLevel(3), store.WithTuningProfile(store.ProfileThroughput)},
+		"after":  {store.WithTuningProfile(store.ProfileThroughput), store.WithCleanupInterval(time.Second), store.WithCompressionLevel(3)},
+	} {
+		config := newStore(opts...).EffectiveConfig()
+		if config.Profile != store.ProfileThroughput || config.CleanupInterval != time.Second || config.CompressionLevel != 3 {
+			t.Errorf("%s: expected the individual options to win, got %+v", name, config)
+		}
+		if config.NotificationQueue != 4096 || config.CleanupBatch != 8192 {
+			t.Errorf("%s: expected the remaining settings from the profile, got %+v", name, config)
+		}
+	}
+
+	if config := newStore(store.WithTuningProfile("turbo")).EffectiveConfig(); config != defaults {
+		t.Errorf("Expected an unknown profile to keep the defaults, got %+v", config)
+	}
+}
+
+func TestCleanupBatchesRemoveEveryExpiredKey(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, 10*time.Millisecond,
+		store.WithCleanupBatch(7))
+	defer kvStore.Stop()
+
+	for i := 0; i < 100; i++ {
+		kvStore.Set(fmt.Sprintf("key%d", i), "v", time.Millisecond)
+	}
+	kvStore.Set("kept", "v", 0)
+	if !waitFor(t, time.Second, func() bool { return kvStore.Size() == 1 }) {
+		t.Errorf("Expected a single sweep to remove every expired key in batches, %d keys left", kvStore.Size())
+	}
+}
+
+// BenchmarkTuningProfiles runs a synthetic workload under each profile: writes with TTLs, a subscriber,
+// and a snapshot. Compare ns/op (write and save cost) with snapshot-bytes (persisted size) and write-amp
+// (bytes persisted per byte written).
+func BenchmarkTuningProfiles(b *testing.B) {
+	for _, profile := range []string{store.ProfileLowMemory, store.ProfileBalanced, store.ProfileThroughput} {
+		b.Run(profile, func(b *testing.B) {
+			var stats store.WriteAmplificationStats
+			for i := 0; i < b.N; i++ {
+				kvStore := store.NewKeyValueStore("", encryptionKey, 0, 0,
+					store.WithBackend(store.NewMemoryBackend()), store.WithTuningProfile(profile))
+				kvStore.RegisterNotificationListener(func(string) {})
+				for j := 0; j < 2000; j++ {
+					kvStore.Set(fmt.Sprintf("session:%d", j%500), fmt.Sprintf(`{"user":%d,"cart":[1,2,3],"seen":%d}`, j%500, j), time.Hour)
+				}
+				if err := kvStore.Save(); err != nil {
+					b.Fatalf("Save failed: %v", err)
+				}
+				stats = kvStore.WriteAmplification()
+				kvStore.Stop()
+			}
+			b.ReportMetric(float64(stats.Subsystems[store.IOSnapshot].Bytes), "snapshot-bytes")
+			b.ReportMetric(stats.Factor, "write-amp")
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+func TestTxnCommit(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("from", "10", 0)
+	kvStore.Set("old", "x", 0)
+
+	txn := kvStore.Begin()
+	txn.Set("from", "7", 0)
+	txn.Set("to", "3", 0)
+	if err := txn.Delete("old"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if value, err := txn.Get("from"); err != nil || value != "7" {
+		t.Errorf("Expected the transaction to read its own write, got %q (%v)", value, err)
+	}
+	if _, err := txn.Get("old"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected the transaction to see its own delete, got %v", err)
+	}
+	if err := txn.Delete("never"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected deleting a missing key to fail, got %v", err)
+	}
+	if value, _ := kvStore.Get("from"); value != "10" {
+		t.Errorf("Expected staged writes to stay invisible before Commit, got %q", value)
+	}
+
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	from, _ := kvStore.Get("from")
+	to, _ := kvStore.Get("to")
+	_, err := kvStore.Get("old")
+	if from != "7" || to != "3" || !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected every write to be applied, got from=%q to=%q old: %v", from, to, err)
+	}
+	if err := txn.Set("from", "0", 0); !errors.Is(err, store.ErrTxnDone) {
+		t.Errorf("Expected ErrTxnDone after Commit, got %v", err)
+	}
+}
+
+func TestTxnRollback(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("a", "1", 0)
+
+	txn := kvStore.Begin()
+	txn.Set("a", "2", 0)
+	txn.Set("b", "2", 0)
+	if err := txn.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if value, _ := kvStore.Get("a"); value != "1" || kvStore.Size() != 1 {
+		t.Errorf("Expected nothing to be applied, got a=%q and keys %v", value, kvStore.Keys())
+	}
+	if err := txn.Commit(); !errors.Is(err, store.ErrTxnDone) {
+		t.Errorf("Expected ErrTxnDone after Rollback, got %v", err)
+	}
+}
+
+func TestTxnConflicts(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("balance", "100", 0)
+
+	txn := kvStore.Begin()
+	txn.Get("balance")
+	txn.Get("lock")
+	txn.Set("balance", "50", 0)
+	kvStore.Set("balance", "80", 0)
+	err := txn.Commit()
+	var failed *store.ConditionFailedError
+	if !errors.As(err, &failed) || failed.Condition.Key != "balance" {
+		t.Fatalf("Expected a conflict on balance, got %v", err)
+	}
+	if value, _ := kvStore.Get("balance"); value != "80" {
+		t.Errorf("Expected the conflicting transaction to write nothing, got %q", value)
+	}
+
+	// A key read as missing must still be missing.
+	txn = kvStore.Begin()
+	txn.Get("lock")
+	txn.Set("lock", "mine", 0)
+	kvStore.Set("lock", "theirs", 0)
+	if err := txn.Commit(); !errors.Is(err, store.ErrConditionFailed) {
+		t.Errorf("Expected a conflict on the created key, got %v", err)
+	}
+
+	// Writes without reads never conflict.
+	txn = kvStore.Begin()
+	txn.Set("balance", "0", 0)
+	kvStore.Set("balance", "1", 0)
+	if err := txn.Commit(); err != nil {
+		t.Errorf("Expected a blind write to commit, got %v", err)
+	}
+}
+
+func TestTxnIncrementsAreSerializable(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("counter", "0", 0)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				for {
+					txn := kvStore.Begin()
+					value, _ := txn.Get("counter")
+					n, _ := strconv.Atoi(value)
+					txn.Set("counter", strconv.Itoa(n+1), 0)
+					if err := txn.Commit(); err == nil {
+						break
+					} else if !errors.Is(err, store.ErrConditionFailed) {
+						t.Errorf("Commit failed: %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := kvStore.Get("counter"); value != "200" {
+		t.Errorf("Expected 200 increments, got %s", value)
+	}
+}
+
+func TestTxnConflictsUnderRetention(t *testing.T) {
+	kvStore := store.NewPassive(store.WithVersionRetention(store.VersionRetention{MaxVersions: 2}))
+	defer kvStore.Stop()
+	kvStore.Set("k", "x0", 0)
+	kvStore.Set("k", "x1", 0)
+
+	// At the cap, the write in between leaves the history as long as the transaction read it.
+	txn := kvStore.Begin()
+	value, _ := txn.Get("k")
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		kvStore.Set("k", "x2", 0)
+	}()
+	<-written
+	txn.Set("k", value+"+txn", 0)
+	if err := txn.Commit(); !errors.Is(err, store.ErrConditionFailed) {
+		t.Fatalf("Expected a conflict with the concurrent write, got %v", err)
+	}
+	if value, _ := kvStore.Get("k"); value != "x2" {
+		t.Errorf("Expected the concurrent write to be kept, got %q", value)
+	}
+
+	// Nor are increments lost to each other.
+	kvStore.Set("counter", "0", 0)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				for {
+					txn := kvStore.Begin()
+					value, _ := txn.Get("counter")
+					n, _ := strconv.Atoi(value)
+					txn.Set("counter", strconv.Itoa(n+1), 0)
+					if err := txn.Commit(); err == nil {
+						break
+					} else if !errors.Is(err, store.ErrConditionFailed) {
+						t.Errorf("Commit failed: %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := kvStore.Get("counter"); value != "200" {
+		t.Errorf("Expected 200 increments, got %s", value)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+type profile struct {
+	Name  string   `json:"name"`
+	Age   int      `json:"age"`
+	Roles []string `json:"roles"`
+}
+
+func TestTypedStore(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	profiles := store.NewTypedStore[profile](kvStore)
+
+	want := profile{Name: "Jane", Age: 31, Roles: []string{"admin"}}
+	if err := profiles.Set("user:1", want, time.Hour); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	got, err := profiles.Get("user:1")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v (%v)", want, got, err)
+	}
+	if raw, _ := kvStore.Get("user:1"); raw != `{"name":"Jane","age":31,"roles":["admin"]}` {
+		t.Errorf("Expected the value to be stored as JSON, got %s", raw)
+	}
+	if _, ttl, _ := kvStore.GetWithTTL("user:1"); ttl <= 59*time.Minute {
+		t.Errorf("Expected the TTL to apply, got %v", ttl)
+	}
+
+	if _, err := profiles.Get("user:2"); !errors.Is(err, store.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	kvStore.Set("user:3", "not json", 0)
+	var syntaxErr *json.SyntaxError
+	if value, err := profiles.Get("user:3"); !errors.As(err, &syntaxErr) || !reflect.DeepEqual(value, profile{}) {
+		t.Errorf("Expected a decoding error and the zero value, got %+v (%v)", value, err)
+	}
+	if value := profiles.GetOrDefault("user:3", profile{Name: "guest"}); value.Name != "guest" {
+		t.Errorf("Expected the default, got %+v", value)
+	}
+
+	counters := store.NewTypedStore[map[string]int](kvStore)
+	counters.Set("counts", map[string]int{"a": 1}, 0)
+	if counts, err := counters.Get("counts"); err != nil || counts["a"] != 1 {
+		t.Errorf("Expected map values to round-trip, got %v (%v)", counts, err)
+	}
+	if err := store.NewTypedStore[func()](kvStore).Set("f", func() {}, 0); err == nil {
+		t.Error("Expected values JSON cannot encode to be refused")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+	"github.com/Chahine-tech/minikeyvalue/internal/ui"
+)
+
+// newUIServer serves the UI of kvStore.
+func newUIServer(t *testing.T, kvStore *store.KeyValueStore, cfg ui.Config) *httptest.Server {
+	mux := http.NewServeMux()
+	ui.Register(mux, kvStore, cfg)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// fetch returns the status and body of a GET of path.
+func fetch(t *testing.T, server *httptest.Server, path string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+var nextLink = regexp.MustCompile(`<a href="([^"]+)" rel="next">`)
+
+func TestUIKeyListPages(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	for i := 0; i < 5; i++ {
+		kvStore.Set(fmt.Sprintf("config:%d", i), "v", 0)
+	}
+	kvStore.Set("other", "v", 0)
+	server := newUIServer(t, kvStore, ui.Config{Enabled: true, PageSize: 2})
+
+	var seen []string
+	path := "/ui/?prefix=config:"
+	for pages := 0; path != ""; pages++ {
+		if pages == 5 {
+			t.Fatal("Expected the pagination to end")
+		}
+		status, body := fetch(t, server, path)
+		if status != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", path, status, body)
+		}
+		if pages > 0 && !strings.Contains(body, `rel="prev"`) {
+			t.Errorf("Expected a link to the previous page on page %d", pages+1)
+		}
+		seen = append(seen, regexp.MustCompile(`href="/ui/keys/[^"]+">([^<]+)</a>`).FindAllString(body, -1)...)
+		path = ""
+		if m := nextLink.FindStringSubmatch(body); m != nil {
+			path = html.UnescapeString(m[1])
+			// Keys written while paging do not shift the listing.
+			kvStore.Set("config:0a", "v", 0)
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("Expected each of the 5 keys once over 3 pages, got %v", seen)
+	}
+	if strings.Contains(strings.Join(seen, " "), "other") {
+		t.Error("Expected keys outside the prefix to be left out")
+	}
+}
+
+func TestUIKeyDetail(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute)
+	defer kvStore.Stop()
+	kvStore.Set("config/app", "plain first version", 0)
+	kvStore.Set("config/app", `{"theme":"dark","beta":true}`, time.Hour)
+	server := newUIServer(t, kvStore, ui.Config{Enabled: true})
+
+	status, body := fetch(t, server, "/ui/keys/config%2Fapp")
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", status, body)
+	}
+	for _, want := range []string{"config/app</h1>", "TTL: 1h0m0s", "{\n  &#34;theme&#34;: &#34;dark&#34;,", "plain first version", "<td>0</td>", "<td>1</td>"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the page, got %s", want, body)
+		}
+	}
+
+	if status, _ := fetch(t, server, "/ui/keys/missing"); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing key, got %d", status)
+	}
+	resp, err := http.Post(server.URL+"/ui/keys/config%2Fapp", "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected the UI to refuse POST, got %d", resp.StatusCode)
+	}
+}
+
+func TestUIAuthorizationAndDisabling(t *testing.T) {
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "data.json"), encryptionKey, 0, time.Minute,
+		store.WithAuthorizer(func(ctx context.Context, op store.Op, key string) error {
+			if strings.HasPrefix(key, "secret:") {
+				return store.ErrForbidden
+			}
+			return nil
+		}))
+	defer kvStore.Stop()
+	kvStore.Set("secret:token", "hunter2", 0)
+
+	server := newUIServer(t, kvStore, ui.Config{Enabled: true})
+	if status, body := fetch(t, server, "/ui/keys/secret:token"); status != http.StatusForbidden || strings.Contains(body, "hunter2") {
+		t.Errorf("Expected the authorizer to hide the value, got %d: %s", status, body)
+	}
+
+	disabled := newUIServer(t, kvStore, ui.Config{})
+	for _, path := range []string{"/ui/", "/ui/keys/secret:token"} {
+		if status, _ := fetch(t, disabled, path); status != http.StatusNotFound {
+			t.Errorf("Expected %s to be missing with the UI disabled, got %d", path, status)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/errs"
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// growthAlerts returns a passive store with value growth alerts and the value_growth events it sends,
+// delivered before each write returns, without their rates.
+func growthAlerts(t *testing.T, config store.ValueGrowthConfig) (*store.KeyValueStore, *[]string) {
+	t.Helper()
+	kvStore := store.NewPassive(store.WithValueGrowthAlerts(config))
+	t.Cleanup(kvStore.Stop)
+	var alerts []string
+	kvStore.Subscribe("value_growth:*", 0, func(event string) {
+		alerts = append(alerts, event[:strings.LastIndex(event, ":")])
+	})
+	return kvStore, &alerts
+}
+
+// grow sets key to values of sizes from to to in steps.
+func grow(t *testing.T, kvStore *store.KeyValueStore, key string, from, to, step int) {
+	t.Helper()
+	for size := from; size <= to; size += step {
+		if err := kvStore.Set(key, strings.Repeat("x", size), 0); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+}
+
+func TestValueGrowthThreshold(t *testing.T) {
+	kvStore, alerts := growthAlerts(t, store.ValueGrowthConfig{Threshold: 1000})
+
+	grow(t, kvStore, "log", 100, 2000, 100)
+	if want := []string{"value_growth:log@1000:1100"}; !reflect.DeepEqual(*alerts, want) {
+		t.Fatalf("Expected a single alert when crossing the threshold, got %v", *alerts)
+	}
+
+	// Shrinking below the threshold re-arms the alert.
+	grow(t, kvStore, "log", 500, 500, 1)
+	grow(t, kvStore, "log", 900, 1500, 300)
+	if want := []string{"value_growth:log@1000:1100", "value_growth:log@900:1200"}; !reflect.DeepEqual(*alerts, want) {
+		t.Errorf("Expected a second alert after shrinking, got %v", *alerts)
+	}
+}
+
+func TestValueGrowthFactor(t *testing.T) {
+	kvStore, alerts := growthAlerts(t, store.ValueGrowthConfig{Factor: 2, Window: 100 * time.Millisecond})
+
+	grow(t, kvStore, "list", 100, 500, 50)
+	if want := []string{"value_growth:list@200:250"}; !reflect.DeepEqual(*alerts, want) {
+		t.Fatalf("Expected a single alert when doubling within the window, got %v", *alerts)
+	}
+
+	// A new window measures growth from the size it starts at.
+	time.Sleep(150 * time.Millisecond)
+	grow(t, kvStore, "list", 600, 1200, 100)
+	if want := []string{"value_growth:list@200:250", "value_growth:list@1000:1100"}; !reflect.DeepEqual(*alerts, want) {
+		t.Errorf("Expected one alert per window, got %v", *alerts)
+	}
+
+	// Slow growth never doubles within a window.
+	kvStore.Delete("list")
+	for size := 100; size <= 300; size += 50 {
+		grow(t, kvStore, "slow", size, size, 1)
+		time.Sleep(60 * time.Millisecond)
+	}
+	if len(*alerts) != 2 {
+		t.Errorf("Expected no alert for slow growth, got %v", *alerts)
+	}
+}
+
+func TestMaxValueBytes(t *testing.T) {
+	advisory, alerts := growthAlerts(t, store.ValueGrowthConfig{Threshold: 10})
+	if err := advisory.Set("big", strings.Repeat("x", 100), 0); err != nil || len(*alerts) != 1 {
+		t.Errorf("Expected alerts to be advisory, got %v with alerts %v", err, *alerts)
+	}
+
+	enforced, _ := growthAlerts(t, store.ValueGrowthConfig{Threshold: 10, MaxValueBytes: 50})
+	err := enforced.Set("big", strings.Repeat("x", 100), 0)
+	if !errors.Is(err, store.ErrValueTooLarge) || errs.KindOf(err) != errs.InvalidArgument {
+		t.Errorf("Expected ErrValueTooLarge as an invalid argument, got %v", err)
+	}
+	if _, err := enforced.CompareAndSwap("big", "", strings.Repeat("x", 51), 0); !errors.Is(err, store.ErrValueTooLarge) {
+		t.Errorf("Expected CompareAndSwap to be limited too, got %v", err)
+	}
+	if err := enforced.Set("big", strings.Repeat("x", 50), 0); err != nil {
+		t.Errorf("Expected a value at the limit to be accepted, got %v", err)
+	}
+}
+
+func TestLargestKeys(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	for i, size := range []int{30, 10, 50, 30, 20} {
+		kvStore.Set(fmt.Sprintf("k%d", i), strings.Repeat("x", size), 0)
+	}
+	kvStore.Set("k1", strings.Repeat("x", 40), 0)
+	kvStore.Set("expired", strings.Repeat("x", 100), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	want := []store.KeySize{{Key: "k2", Size: 50}, {Key: "k1", Size: 40}, {Key: "k0", Size: 30}, {Key: "k3", Size: 30}}
+	if got := kvStore.LargestKeys(4); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := kvStore.LargestKeys(10); len(got) != 5 {
+		t.Errorf("Expected every live key, got %v", got)
+	}
+}
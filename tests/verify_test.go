@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+)
+
+// snapshotOf builds a store with the given histories and returns its SaveTo output.
+func snapshotOf(t *testing.T, histories map[string][]string) []byte {
+	t.Helper()
+	kvStore := store.NewKeyValueStore(filepath.Join(t.TempDir(), "snapshot.json"), encryptionKey, 0, 1*time.Minute)
+	defer kvStore.Stop()
+	for key, values := range histories {
+		for _, value := range values {
+			if err := kvStore.Set(key, value, 0); err != nil {
+				t.Fatalf("Failed to set key: %v", err)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := kvStore.SaveTo(&buf); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerify(t *testing.T) {
+	backup := snapshotOf(t, map[string][]string{
+		"same":      {"v1", "v2"},
+		"changed":   {"v1", "backup"},
+		"truncated": {"v1", "v2", "v3"},
+		"missing":   {"v1"},
+	})
+	live := snapshotOf(t, map[string][]string{
+		"same":      {"v1", "v2"},
+		"changed":   {"v1", "live"},
+		"truncated": {"v2", "v3"},
+		"extra":     {"v1"},
+	})
+
+	kvStore, err := store.NewKeyValueStoreFromReader(bytes.NewReader(live), encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to load live store: %v", err)
+	}
+	defer kvStore.Stop()
+
+	report, err := kvStore.Verify(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+
+	if strings.Join(report.Missing, ",") != "missing" {
+		t.Errorf("Expected missing [missing], got %v", report.Missing)
+	}
+	if strings.Join(report.Extra, ",") != "extra" {
+		t.Errorf("Expected extra [extra], got %v", report.Extra)
+	}
+	if strings.Join(report.Divergent, ",") != "changed,truncated" {
+		t.Errorf("Expected divergent [changed truncated], got %v", report.Divergent)
+	}
+	if len(report.Repaired) != 0 || report.Consistent() {
+		t.Errorf("Expected an inconsistent report without repairs, got %+v", report)
+	}
+	if value, _ := kvStore.Get("changed"); value != "live" {
+		t.Errorf("Expected Verify to leave 'changed' untouched, got %s", value)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	backup := snapshotOf(t, map[string][]string{
+		"changed":   {"v1", "backup"},
+		"truncated": {"v1", "v2", "v3"},
+	})
+	live := snapshotOf(t, map[string][]string{
+		"changed":   {"v1", "live"},
+		"truncated": {"v2", "v3"},
+		"extra":     {"v1"},
+	})
+
+	kvStore, err := store.NewKeyValueStoreFromReader(bytes.NewReader(live), encryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to load live store: %v", err)
+	}
+	defer kvStore.Stop()
+
+	events := make(chan string, 10)
+	kvStore.RegisterNotificationListener(func(event string) {
+		events <- event
+	})
+
+	report, err := kvStore.Repair(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if strings.Join(report.Repaired, ",") != "changed,truncated" {
+		t.Errorf("Expected repaired [changed truncated], got %v", report.Repaired)
+	}
+
+	if value, _ := kvStore.Get("changed"); value != "backup" {
+		t.Errorf("Expected 'changed' to be repaired to 'backup', got %s", value)
+	}
+	if versions, _ := kvStore.GetAllVersions("truncated"); strings.Join(versions, ",") != "v1,v2,v3" {
+		t.Errorf("Expected full history for 'truncated', got %v", versions)
+	}
+	if _, err := kvStore.Get("extra"); err != nil {
+		t.Errorf("Expected extra key to be kept, got %v", err)
+	}
+
+	for _, expected := range []string{"updated:changed@", "updated:truncated@"} {
+		select {
+		case event := <-events:
+			if !strings.HasPrefix(event, expected) {
+				t.Errorf("Expected event %s*, got %s", expected, event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout waiting for repair events")
+		}
+	}
+
+	after, err := kvStore.Verify(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(after.Divergent) != 0 {
+		t.Errorf("Expected no divergent keys after repair, got %v", after.Divergent)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Chahine-tech/minikeyvalue/internal/store"
+	"github.com/Chahine-tech/minikeyvalue/internal/watch"
+)
+
+// sseEvent is an event read from a Server-Sent Events stream.
+type sseEvent struct {
+	id, name, data string
+}
+
+// watchStream opens a watch stream at path, with lastEventID as the Last-Event-ID header if set, and
+// returns its events as they arrive.
+func watchStream(t *testing.T, server *httptest.Server, path, lastEventID string) <-chan sseEvent {
+	req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan sseEvent, 100)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var e sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "id":
+				e.id = value
+			case "event":
+				e.name = value
+			case "data":
+				e.data = value
+			case "":
+				if e.name != "" {
+					events <- e
+				}
+				e = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+// newWatchServer serves the watch handler of kvStore. It is closed after the streams opened on it.
+func newWatchServer(t *testing.T, kvStore *store.KeyValueStore) *httptest.Server {
+	server := httptest.NewServer(watch.Handler(kvStore))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// nextEvent returns the next event of a stream, failing if none arrives.
+func nextEvent(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("Stream ended")
+		}
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+	return sseEvent{}
+}
+
+func TestWatchStreamsKeyEvents(t *testing.T) {
+	kvStore := store.NewPassive()
+	defer kvStore.Stop()
+	kvStore.Set("user:old", "before the stream", 0)
+	server := newWatchServer(t, kvStore)
+
+	events := watchStream(t, server, "/api/v1/watch?prefix=user:", "")
+	kvStore.Set("order:1", "other prefix", 0)
+	kvStore.Set("user:1", "a", 0)
+	kvStore.Set("user:1", "b", 0)
+	kvStore.Set("user:line\nbreak", "c", 0)
+	kvStore.Delete("user:1")
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		e := nextEvent(t, events)
+		var data struct {
+			Seq  uint64 `json:"seq"`
+			Type string `json:"type"`
+			Key  string `json:"key"`
+		}
+		if err := json.Unmarshal([]byte(e.data), &data); err != nil {
+			t.Fatalf("Malformed event data %q: %v", e.data, err)
+		}
+		if e.id != fmt.Sprint(data.Seq) || e.name != data.Type {
+			t.Errorf("Expected the ID and name to match the data, got %+v", e)
+		}
+		got = append(got, data.Type+":"+data.Key)
+	}
+	want := fmt.Sprint([]string{"added:user:1", "updated:user:1", "added:user:line\nbreak", "deleted:user:1"})
+	if fmt.Sprint(got) != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestWatchResumesAfterLastEventID(t *testing.T) {
+	kvStore := store.NewPassive(store.WithEventLog(4))
+	defer kvStore.Stop()
+	server := newWatchServer(t, kvStore)
+
+	kvStore.Set("a", "1", 0)
+	resumeFrom := fmt.Sprint(kvStore.LastSequence())
+	kvStore.Set("b", "1", 0)
+	kvStore.Set("c", "1", 0)
+
+	events := watchStream(t, server, "/api/v1/watch", resumeFrom)
+	if e := nextEvent(t, events); !strings.Contains(e.data, `"key":"b"`) {
+		t.Errorf("Expected to resume with b, got %+v", e)
+	}
+	if e := nextEvent(t, events); !strings.Contains(e.data, `"key":"c"`) {
+		t.Errorf("Expected c next, got %+v", e)
+	}
+
+	// Events evicted from the log cannot be replayed.
+	for i := 0; i < 10; i++ {
+		kvStore.Set("d", fmt.Sprint(i), 0)
+	}
+	stale := watchStream(t, server, "/api/v1/watch?since="+resumeFrom, "")
+	if e := nextEvent(t, stale); e.name != "truncated" {
+		t.Errorf("Expected a truncated event, got %+v", e)
+	}
+	if _, open := <-stale; open {
+		t.Error("Expected the stream to end after a truncated event")
+	}
+
+	resp, err := http.Get(server.URL + "/api/v1/watch?since=abc")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed event ID, got %d", resp.StatusCode)
+	}
+}